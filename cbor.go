@@ -0,0 +1,343 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// This file implements CBOR (RFC 8949) marshaling of pipelines and steps. The
+// pipeline or step is converted to its generic form (as for Encode), and that
+// is written as CBOR with mappings in their original order. Only the subset of
+// CBOR needed for pipelines is supported: indefinite-length items and maps
+// with non-string keys are rejected when unmarshaling.
+
+var (
+	_ = []interface {
+		MarshalCBOR() ([]byte, error)
+		UnmarshalCBOR([]byte) error
+	}{
+		(*Pipeline)(nil),
+		(*CommandStep)(nil),
+		(*GroupStep)(nil),
+		(*TriggerStep)(nil),
+		(*WaitStep)(nil),
+		(*InputStep)(nil),
+	}
+)
+
+// CBOR major types.
+const (
+	cborUint byte = iota << 5
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// MarshalCBOR marshals the pipeline to CBOR.
+func (p *Pipeline) MarshalCBOR() ([]byte, error) { return marshalCBOR(p) }
+
+// UnmarshalCBOR unmarshals the pipeline from CBOR. Warnings are passed through
+// the err return, as for Parse.
+func (p *Pipeline) UnmarshalCBOR(b []byte) error { return unmarshalCBOR(b, p) }
+
+// MarshalCBOR marshals the step to CBOR.
+func (c *CommandStep) MarshalCBOR() ([]byte, error) { return marshalCBOR(c) }
+
+// UnmarshalCBOR unmarshals the step from CBOR.
+func (c *CommandStep) UnmarshalCBOR(b []byte) error { return unmarshalCBOR(b, c) }
+
+// MarshalCBOR marshals the step to CBOR.
+func (g *GroupStep) MarshalCBOR() ([]byte, error) { return marshalCBOR(g) }
+
+// UnmarshalCBOR unmarshals the step from CBOR.
+func (g *GroupStep) UnmarshalCBOR(b []byte) error { return unmarshalCBOR(b, g) }
+
+// MarshalCBOR marshals the step to CBOR.
+func (t *TriggerStep) MarshalCBOR() ([]byte, error) { return marshalCBOR(t) }
+
+// UnmarshalCBOR unmarshals the step from CBOR.
+func (t *TriggerStep) UnmarshalCBOR(b []byte) error { return unmarshalCBOR(b, t) }
+
+// MarshalCBOR marshals the step to CBOR.
+func (s *WaitStep) MarshalCBOR() ([]byte, error) { return marshalCBOR(s) }
+
+// UnmarshalCBOR unmarshals the step from CBOR.
+func (s *WaitStep) UnmarshalCBOR(b []byte) error { return unmarshalCBOR(b, s) }
+
+// MarshalCBOR marshals the step to CBOR.
+func (s *InputStep) MarshalCBOR() ([]byte, error) { return marshalCBOR(s) }
+
+// UnmarshalCBOR unmarshals the step from CBOR.
+func (s *InputStep) UnmarshalCBOR(b []byte) error { return unmarshalCBOR(b, s) }
+
+func marshalCBOR(x any) ([]byte, error) {
+	v, err := toGeneric(x)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling CBOR: %w", err)
+	}
+	b, err := appendCBOR(nil, v)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling CBOR: %w", err)
+	}
+	return b, nil
+}
+
+func unmarshalCBOR(b []byte, dst any) error {
+	d := &cborDecoder{b: b}
+	v, err := d.value()
+	if err != nil {
+		return fmt.Errorf("unmarshaling CBOR: %w", err)
+	}
+	if len(d.b) > 0 {
+		return errors.New("unmarshaling CBOR: trailing data")
+	}
+	return fromGeneric(v, dst)
+}
+
+// appendCBORHead appends the initial byte(s) of an item with major type mt
+// and argument n.
+func appendCBORHead(b []byte, mt byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, mt|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, mt|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, mt|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, mt|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, mt|27), n)
+	}
+}
+
+func appendCBOR(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple|22), nil
+
+	case bool:
+		if v {
+			return append(b, cborSimple|21), nil
+		}
+		return append(b, cborSimple|20), nil
+
+	case int:
+		if v < 0 {
+			return appendCBORHead(b, cborNegInt, uint64(-(v + 1))), nil
+		}
+		return appendCBORHead(b, cborUint, uint64(v)), nil
+
+	case uint64:
+		return appendCBORHead(b, cborUint, v), nil
+
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, cborSimple|27), math.Float64bits(v)), nil
+
+	case string:
+		return append(appendCBORHead(b, cborText, uint64(len(v))), v...), nil
+
+	case []any:
+		b = appendCBORHead(b, cborArray, uint64(len(v)))
+		for _, e := range v {
+			var err error
+			if b, err = appendCBOR(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+
+	case *ordered.MapSA:
+		b = appendCBORHead(b, cborMap, uint64(v.Len()))
+		for k, e := range v.All() {
+			b = append(appendCBORHead(b, cborText, uint64(len(k))), k...)
+			var err error
+			if b, err = appendCBOR(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// cborDecoder decodes CBOR items from the front of b.
+type cborDecoder struct {
+	b     []byte
+	depth int // of arrays, maps, and tags
+}
+
+var errCBORTruncated = errors.New("truncated data")
+
+// head reads the initial byte(s) of an item, returning the major type, the
+// additional information, and the argument.
+func (d *cborDecoder) head() (mt, info byte, n uint64, err error) {
+	if len(d.b) == 0 {
+		return 0, 0, 0, errCBORTruncated
+	}
+	mt, info = d.b[0]&0xe0, d.b[0]&0x1f
+	d.b = d.b[1:]
+
+	size := 0
+	switch {
+	case info < 24:
+		return mt, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, 0, errors.New("indefinite-length items are not supported")
+	default:
+		return 0, 0, 0, fmt.Errorf("invalid additional information %d", info)
+	}
+	if len(d.b) < size {
+		return 0, 0, 0, errCBORTruncated
+	}
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	return mt, info, n, nil
+}
+
+// length checks that n is a plausible length for the remaining data.
+func (d *cborDecoder) length(n uint64) (int, error) {
+	if n > uint64(len(d.b)) {
+		return 0, errCBORTruncated
+	}
+	return int(n), nil
+}
+
+func (d *cborDecoder) value() (any, error) {
+	mt, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if mt == cborArray || mt == cborMap || mt == cborTag {
+		if d.depth >= maxNestingDepth {
+			return nil, ErrNestingTooDeep
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+	}
+	switch mt {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int(n), nil
+
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("negative integer out of range")
+		}
+		return -int(n) - 1, nil
+
+	case cborBytes, cborText:
+		l, err := d.length(n)
+		if err != nil {
+			return nil, err
+		}
+		s := string(d.b[:l])
+		d.b = d.b[l:]
+		return s, nil
+
+	case cborArray:
+		// Every item is at least one byte.
+		l, err := d.length(n)
+		if err != nil {
+			return nil, err
+		}
+		a := make([]any, 0, l)
+		for i := 0; i < l; i++ {
+			e, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, e)
+		}
+		return a, nil
+
+	case cborMap:
+		l, err := d.length(n)
+		if err != nil {
+			return nil, err
+		}
+		m := ordered.NewMap[string, any](l)
+		for i := 0; i < l; i++ {
+			k, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key has type %T, want string", k)
+			}
+			e, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			m.Set(ks, e)
+		}
+		return m, nil
+
+	case cborTag:
+		// Tags only add meaning to the item that follows, which is all that
+		// pipelines need.
+		return d.value()
+
+	default: // cborSimple
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23: // null, undefined
+			return nil, nil
+		case 25:
+			return float16ToFloat64(uint16(n)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			return math.Float64frombits(n), nil
+		default:
+			return nil, fmt.Errorf("unsupported simple value %d", n)
+		}
+	}
+}
+
+// float16ToFloat64 converts an IEEE 754 half-precision float.
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	default:
+		return sign * math.Ldexp(frac+1024, exp-25)
+	}
+}
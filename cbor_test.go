@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	want, err := Parse(strings.NewReader(binaryTestPipeline))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	b, err := want.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("want.MarshalCBOR() error = %v", err)
+	}
+	got := new(Pipeline)
+	if err := got.UnmarshalCBOR(b); err != nil {
+		t.Fatalf("got.UnmarshalCBOR(b) error = %v", err)
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("unmarshaled pipeline diff (-got +want):\n%s", diff)
+	}
+
+	// Each step type should also round-trip on its own.
+	for _, step := range want.Steps {
+		m, ok := step.(interface {
+			MarshalCBOR() ([]byte, error)
+			UnmarshalCBOR([]byte) error
+		})
+		if !ok {
+			t.Fatalf("step of type %T does not implement CBOR marshaling", step)
+		}
+		b, err := m.MarshalCBOR()
+		if err != nil {
+			t.Fatalf("%T.MarshalCBOR() error = %v", step, err)
+		}
+		got := reflect.New(reflect.TypeOf(step).Elem()).Interface()
+		if err := got.(interface{ UnmarshalCBOR([]byte) error }).UnmarshalCBOR(b); err != nil {
+			t.Fatalf("%T.UnmarshalCBOR(b) error = %v", got, err)
+		}
+		if diff := cmp.Diff(got, step, cmp.Comparer(ordered.EqualSS), cmp.Comparer(ordered.EqualSA), allowUnexported); diff != "" {
+			t.Errorf("unmarshaled %T diff (-got +want):\n%s", step, diff)
+		}
+	}
+}
+
+func TestCBORPreservesOrder(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "ZEBRA", Value: "stripes"},
+			ordered.TupleSS{Key: "ANIMAL", Value: "llama"},
+		),
+	}
+	b, err := p.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("p.MarshalCBOR() error = %v", err)
+	}
+	if z, a := bytes.Index(b, []byte("ZEBRA")), bytes.Index(b, []byte("ANIMAL")); z < 0 || a < z {
+		t.Errorf("p.MarshalCBOR() = %x, want ZEBRA before ANIMAL", b)
+	}
+}
+
+func TestUnmarshalCBORBadInput(t *testing.T) {
+	t.Parallel()
+
+	b, err := (&Pipeline{Steps: Steps{&CommandStep{Command: "make"}}}).MarshalCBOR()
+	if err != nil {
+		t.Fatalf("p.MarshalCBOR() error = %v", err)
+	}
+
+	tests := map[string][]byte{
+		"empty":           nil,
+		"truncated":       b[:len(b)-1],
+		"trailing data":   append(bytes.Clone(b), 0xf6),
+		"indefinite map":  {0xbf, 0xff},
+		"integer map key": {0xa1, 0x01, 0x01},
+		"huge array":      {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, input := range tests {
+		if err := new(Pipeline).UnmarshalCBOR(input); err == nil {
+			t.Errorf("UnmarshalCBOR(%s) error = %v, want non-nil error", name, err)
+		}
+	}
+}
+
+func TestUnmarshalCBORDeeplyNested(t *testing.T) {
+	t.Parallel()
+
+	// Untrusted input mustn't be able to overflow the stack.
+	tests := map[string][]byte{
+		"arrays": bytes.Repeat([]byte{0x81}, 1_000_000), // [[[...
+		"tags":   bytes.Repeat([]byte{0xc6}, 1_000_000), // tag 6(tag 6(...
+	}
+	for name, input := range tests {
+		if err := new(Pipeline).UnmarshalCBOR(input); !errors.Is(err, ErrNestingTooDeep) {
+			t.Errorf("UnmarshalCBOR(%s) error = %v, want %v", name, err, ErrNestingTooDeep)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+// Command go-pipeline parses, lints, signs, and verifies Buildkite pipelines,
+// for use from tooling that isn't written in Go.
+//
+// Usage:
+//
+//	go-pipeline parse  [-format json|yaml] [-interpolate] [file]
+//	go-pipeline lint   [-format json|yaml] [file]
+//	go-pipeline sign   [-format json|yaml] -jwks path [-key-id id] -repo url [-sign-groups]
+//	                   [-only-key glob] [-only-label regexp] [-force] [-profile compat|strict] [file]
+//	go-pipeline verify [-format json|yaml] -jwks path -repo url [-require-signed-groups]
+//	                   [-profile compat|strict] [file]
+//
+// The pipeline is read from file, or from stdin if file is omitted or "-". It
+// can be YAML or JSON, and either a mapping or a bare list of steps.
+// parse and sign write the resulting pipeline, and lint and verify write a
+// list of results. lint and verify exit with status 1 if any errors are found.
+// sign leaves steps that already have a valid signature unchanged, unless
+// -force is given; steps changed since they were signed are signed again.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/buildkite/go-pipeline/signature"
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"gopkg.in/yaml.v3"
+)
+
+// errFailed is returned by a command that has written its results, but found
+// problems that should cause a non-zero exit status.
+var errFailed = errors.New("failed")
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command described by args, and returns the exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	commands := map[string]func(context.Context, *flag.FlagSet, []string, io.Reader, io.Writer) error{
+		"parse":  parseCmd,
+		"lint":   lintCmd,
+		"sign":   signCmd,
+		"verify": verifyCmd,
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: go-pipeline parse|lint|sign|verify [flags] [file]")
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "go-pipeline: unknown command %q\n", args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("go-pipeline "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := cmd(ctx, fs, args[1:], stdin, stdout); err != nil {
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errFailed):
+			return 1
+		}
+		fmt.Fprintf(stderr, "go-pipeline %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// common holds the flags shared by all commands.
+type common struct {
+	format string
+}
+
+func (c *common) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.format, "format", "yaml", "output format: json or yaml")
+}
+
+// write writes v to w in the chosen format.
+func (c *common) write(w io.Writer, v any) error {
+	switch c.format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+
+	default:
+		return fmt.Errorf("unknown format %q, want json or yaml", c.format)
+	}
+}
+
+// parseFlags parses the flags, and then parses the pipeline named by the
+// remaining argument. Parse warnings are passed to warn.
+func parseFlags(fs *flag.FlagSet, args []string, stdin io.Reader, warn func(error)) (*pipeline.Pipeline, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var src io.Reader
+	switch fs.NArg() {
+	case 0:
+		src = stdin
+
+	case 1:
+		if fs.Arg(0) == "-" {
+			src = stdin
+			break
+		}
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		src = f
+
+	default:
+		return nil, fmt.Errorf("too many arguments: %q", fs.Args())
+	}
+
+	p, _, err := pipeline.ParseAuto(src)
+	if w := warning.As(err); w != nil {
+		warn(w)
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseCmd(_ context.Context, fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	var c common
+	c.register(fs)
+	interpolate := fs.Bool("interpolate", false, "interpolate environment variables from the process environment into the pipeline")
+
+	p, err := parseFlags(fs, args, stdin, func(w error) {
+		fmt.Fprintf(fs.Output(), "warning: %v\n", w)
+	})
+	if err != nil {
+		return err
+	}
+
+	if *interpolate {
+		if err := p.Interpolate(environ(), false); err != nil {
+			return fmt.Errorf("interpolating pipeline: %w", err)
+		}
+	}
+	return c.write(stdout, p)
+}
+
+// problem is a single lint result.
+type problem struct {
+	Level   string `json:"level" yaml:"level"`
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+	Code    string `json:"code,omitempty" yaml:"code,omitempty"`
+	Message string `json:"message" yaml:"message"`
+	Fix     string `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+func lintCmd(_ context.Context, fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	var c common
+	c.register(fs)
+
+	problems := []problem{}
+	p, err := parseFlags(fs, args, stdin, func(w error) {
+		problems = append(problems, problem{Level: "warning", Message: w.Error()})
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	if err := p.Validate(); err != nil {
+		level := "warning"
+		if !warning.Is(err) {
+			level = "error"
+			failed = true
+		}
+		// Both ValidationErrors and warnings wrap a ValidationError for each
+		// problem.
+		errs := []error{err}
+		if u, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = u.Unwrap()
+		}
+		for _, e := range errs {
+			pr := problem{Level: level, Message: e.Error()}
+			var ve *pipeline.ValidationError
+			if errors.As(e, &ve) {
+				pr.Path, pr.Code, pr.Message, pr.Fix = ve.Path, ve.Code(), ve.Err.Error(), ve.Fix
+			}
+			problems = append(problems, pr)
+		}
+	}
+
+	if err := c.write(stdout, problems); err != nil {
+		return err
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+func signCmd(ctx context.Context, fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	var c common
+	c.register(fs)
+	jwksPath := fs.String("jwks", "", "path to a JSON Web Key Set containing the signing key (required)")
+	keyID := fs.String("key-id", "", "ID of the signing key, if the key set contains more than one key")
+	repoURL := fs.String("repo", "", "URL of the repository the pipeline belongs to (required)")
+	signGroups := fs.Bool("sign-groups", false, "also sign group steps")
+	profile := fs.String("profile", string(signature.ProfileCompat), "signing profile: compat, artifacts, or strict")
+	onlyKey := fs.String("only-key", "", "only sign steps with keys matching this glob pattern")
+	onlyLabel := fs.String("only-label", "", "only sign steps with labels matching this regular expression")
+	force := fs.Bool("force", false, "re-sign steps that are already signed")
+
+	p, err := parseFlags(fs, args, stdin, func(w error) {
+		fmt.Fprintf(fs.Output(), "warning: %v\n", w)
+	})
+	if err != nil {
+		return err
+	}
+	if *jwksPath == "" || *repoURL == "" {
+		return errors.New("-jwks and -repo are required")
+	}
+
+	jwkKey, err := jwkutil.LoadKey(*jwksPath, *keyID)
+	if err != nil {
+		return fmt.Errorf("loading signing key: %w", err)
+	}
+	key, err := signature.NewSigningKey(jwkKey)
+	if err != nil {
+		return fmt.Errorf("loading signing key: %w", err)
+	}
+
+	prof, err := parseProfile(*profile)
+	if err != nil {
+		return err
+	}
+
+	opts := []signature.Option{
+		signature.WithProfile(prof),
+		signature.WithSignedGroups(*signGroups),
+		signature.WithSkipSigned(!*force),
+	}
+	if *onlyKey != "" {
+		filter, err := signature.MatchStepKey(*onlyKey)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, signature.WithStepFilter(filter))
+	}
+	if *onlyLabel != "" {
+		re, err := regexp.Compile(*onlyLabel)
+		if err != nil {
+			return fmt.Errorf("invalid label pattern: %w", err)
+		}
+		opts = append(opts, signature.WithStepFilter(signature.MatchStepLabel(re)))
+	}
+
+	if err := signature.SignSteps(ctx, p.Steps, key, *repoURL, opts...); err != nil {
+		return fmt.Errorf("signing pipeline: %w", err)
+	}
+	return c.write(stdout, p)
+}
+
+// parseProfile checks that s names a signing profile.
+func parseProfile(s string) (signature.Profile, error) {
+	switch p := signature.Profile(s); p {
+	case signature.ProfileCompat, signature.ProfileArtifacts, signature.ProfileStrict:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown signing profile %q, want compat, artifacts, or strict", s)
+	}
+}
+
+// verifyResult is the result of verifying a single step.
+type verifyResult struct {
+	Path  string `json:"path" yaml:"path"`
+	Key   string `json:"key,omitempty" yaml:"key,omitempty"`
+	OK    bool   `json:"ok" yaml:"ok"`
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func verifyCmd(ctx context.Context, fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	var c common
+	c.register(fs)
+	jwksPath := fs.String("jwks", "", "path to a JSON Web Key Set containing the verification keys (required)")
+	repoURL := fs.String("repo", "", "URL of the repository the pipeline belongs to (required)")
+	requireGroups := fs.Bool("require-signed-groups", false, "fail group steps that aren't signed")
+	profile := fs.String("profile", string(signature.ProfileCompat), "signing profile that signatures must satisfy: compat, artifacts, or strict")
+
+	p, err := parseFlags(fs, args, stdin, func(w error) {
+		fmt.Fprintf(fs.Output(), "warning: %v\n", w)
+	})
+	if err != nil {
+		return err
+	}
+	if *jwksPath == "" || *repoURL == "" {
+		return errors.New("-jwks and -repo are required")
+	}
+
+	set, err := jwk.ReadFile(*jwksPath)
+	if err != nil {
+		return fmt.Errorf("reading verification keys: %w", err)
+	}
+	keySet, err := signature.NewVerificationKeySet(set)
+	if err != nil {
+		return fmt.Errorf("loading verification keys: %w", err)
+	}
+
+	results := []verifyResult{}
+	prof, err := parseProfile(*profile)
+	if err != nil {
+		return err
+	}
+
+	res, err := signature.VerifyPipelineParallel(ctx, p, keySet, signature.CollectAllFailures, 0, *repoURL,
+		signature.WithProfile(prof),
+		signature.WithRequireSignedGroups(*requireGroups),
+	)
+	for _, r := range res.Steps {
+		vr := verifyResult{Path: r.Path, Key: pipeline.StepKey(r.Step), OK: r.Err == nil}
+		if r.Err != nil {
+			vr.Error = r.Err.Error()
+		}
+		results = append(results, vr)
+	}
+
+	if err := c.write(stdout, results); err != nil {
+		return err
+	}
+	if err != nil {
+		return errFailed
+	}
+	return nil
+}
+
+// environ returns the process environment as an InterpolationEnv.
+func environ() pipeline.InterpolationEnv {
+	m := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return env.New(env.FromMap(m))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+func runTest(t *testing.T, stdin string, args ...string) (stdout string, status int) {
+	t.Helper()
+	var out, errOut strings.Builder
+	status = run(context.Background(), args, strings.NewReader(stdin), &out, &errOut)
+	if errOut.Len() > 0 {
+		t.Logf("run(%q) stderr:\n%s", args, errOut.String())
+	}
+	return out.String(), status
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	got, status := runTest(t, "steps:\n  - command: make\n", "parse", "-format", "json")
+	if status != 0 {
+		t.Fatalf("run(parse) status = %d, want 0", status)
+	}
+	want := `{
+  "steps": [
+    {
+      "command": "make"
+    }
+  ]
+}
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("run(parse) stdout diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	input := `steps:
+  - command: make
+    key: build
+  - command: make test
+    key: build
+`
+	got, status := runTest(t, input, "lint", "-format", "json")
+	if status != 1 {
+		t.Errorf("run(lint) status = %d, want 1", status)
+	}
+
+	var problems []problem
+	if err := json.Unmarshal([]byte(got), &problems); err != nil {
+		t.Fatalf("json.Unmarshal(stdout) error = %v", err)
+	}
+	if len(problems) != 1 || problems[0].Level != "error" || problems[0].Path != "steps[1]" || problems[0].Code != "duplicate_key" {
+		t.Errorf("run(lint) problems = %+v, want one duplicate_key error at steps[1]", problems)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	priv, pub, err := jwkutil.NewKeyPair("test", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(test, EdDSA) error = %v", err)
+	}
+	dir := t.TempDir()
+	privPath, pubPath := filepath.Join(dir, "private.json"), filepath.Join(dir, "public.json")
+	for path, set := range map[string]any{privPath: priv, pubPath: pub} {
+		b, err := json.Marshal(set)
+		if err != nil {
+			t.Fatalf("json.Marshal(%s) error = %v", path, err)
+		}
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatalf("os.WriteFile(%s) error = %v", path, err)
+		}
+	}
+
+	const repo = "git@github.com:buildkite/go-pipeline.git"
+	signed, status := runTest(t, "steps:\n  - command: make\n    key: build\n", "sign", "-jwks", privPath, "-repo", repo)
+	if status != 0 {
+		t.Fatalf("run(sign) status = %d, want 0", status)
+	}
+
+	got, status := runTest(t, signed, "verify", "-format", "json", "-jwks", pubPath, "-repo", repo)
+	if status != 0 {
+		t.Errorf("run(verify) status = %d, want 0", status)
+	}
+	want := `[
+  {
+    "path": "steps[0]",
+    "key": "build",
+    "ok": true
+  }
+]
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("run(verify) stdout diff (-got +want):\n%s", diff)
+	}
+
+	tampered := strings.Replace(signed, "command: make", "command: make evil", 1)
+	if _, status := runTest(t, tampered, "verify", "-jwks", pubPath, "-repo", repo); status != 1 {
+		t.Errorf("run(verify) on tampered pipeline status = %d, want 1", status)
+	}
+}
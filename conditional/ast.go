@@ -0,0 +1,154 @@
+package conditional
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node of the syntax tree of an expression. It is implemented by
+// *Literal, *Variable, *Call, *Regexp, *Unary, and *Binary.
+type Expr interface {
+	// Pos returns the byte offset of the start of the expression in the
+	// source.
+	Pos() int
+
+	// String returns the expression in source form. Parsing it returns an
+	// equivalent expression.
+	String() string
+
+	exprTag()
+}
+
+// Literal is a string, number (float64), boolean, or null (nil).
+type Literal struct {
+	Offset int
+	Value  any
+}
+
+// Variable is a variable, such as build.branch. Path holds its parts, such as
+// ["build", "branch"].
+type Variable struct {
+	Offset int
+	Path   []string
+}
+
+// Call is a call of a function, such as build.env("DEPLOY").
+type Call struct {
+	Func *Variable
+	Args []Expr
+}
+
+// Regexp is a regular expression, such as /^release-/i.
+type Regexp struct {
+	Offset  int
+	Pattern string // as written, between the slashes
+	Flags   string // as written, after the final slash
+
+	re *regexp.Regexp
+}
+
+// Unary is an expression with a prefix operator. The only one is "!".
+type Unary struct {
+	Offset int
+	Op     string
+	X      Expr
+}
+
+// Binary is an expression with an infix operator: "==", "!=", "=~", "!~",
+// "includes", "&&", or "||".
+type Binary struct {
+	Op   string
+	X, Y Expr
+}
+
+// Regexp returns the compiled regular expression.
+func (r *Regexp) Regexp() *regexp.Regexp { return r.re }
+
+func (l *Literal) Pos() int  { return l.Offset }
+func (v *Variable) Pos() int { return v.Offset }
+func (c *Call) Pos() int     { return c.Func.Offset }
+func (r *Regexp) Pos() int   { return r.Offset }
+func (u *Unary) Pos() int    { return u.Offset }
+func (b *Binary) Pos() int   { return b.X.Pos() }
+
+func (l *Literal) String() string {
+	switch v := l.Value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return "<invalid>"
+	}
+}
+
+func (v *Variable) String() string { return strings.Join(v.Path, ".") }
+
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = a.String()
+	}
+	return c.Func.String() + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (r *Regexp) String() string { return "/" + r.Pattern + "/" + r.Flags }
+
+func (u *Unary) String() string { return u.Op + operand(u.X, precUnary) }
+
+func (b *Binary) String() string {
+	p := precedence[b.Op]
+	// The operators are left-associative, so the right operand needs
+	// parentheses if it has the same precedence.
+	return operand(b.X, p) + " " + b.Op + " " + operand(b.Y, p+1)
+}
+
+// operand returns x in source form as an operand of an operator with
+// precedence prec, parenthesised if need be.
+func operand(x Expr, prec int) string {
+	if b, ok := x.(*Binary); ok && precedence[b.Op] < prec {
+		return "(" + b.String() + ")"
+	}
+	return x.String()
+}
+
+func (*Literal) exprTag()  {}
+func (*Variable) exprTag() {}
+func (*Call) exprTag()     {}
+func (*Regexp) exprTag()   {}
+func (*Unary) exprTag()    {}
+func (*Binary) exprTag()   {}
+
+// Variables returns the variables used by the expression (other than the
+// functions it calls), such as "build.branch", in the order they are used,
+// without duplicates.
+func Variables(e Expr) []string {
+	var out []string
+	seen := make(map[string]bool)
+	var walk func(Expr)
+	walk = func(e Expr) {
+		switch e := e.(type) {
+		case *Variable:
+			if name := e.String(); !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		case *Call:
+			for _, a := range e.Args {
+				walk(a)
+			}
+		case *Unary:
+			walk(e.X)
+		case *Binary:
+			walk(e.X)
+			walk(e.Y)
+		}
+	}
+	walk(e)
+	return out
+}
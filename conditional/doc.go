@@ -0,0 +1,19 @@
+// Package conditional parses and evaluates the expressions in the `if`
+// attribute of steps, such as:
+//
+//	build.branch == "main" && !build.pull_request.draft
+//
+// Expressions are made of:
+//   - literals: strings ("main" or 'main'), numbers, true, false, and null,
+//   - variables, such as build.branch and pipeline.slug,
+//   - function calls, such as build.env("DEPLOY"),
+//   - regular expressions, such as /^release-/i (flags i and m are supported),
+//   - comparisons: ==, !=, =~ (matches a regular expression), !~ (doesn't
+//     match), and includes (a list contains a value),
+//   - logical operators: !, &&, and ||, and parentheses.
+//
+// Parse returns the syntax tree of an expression. Eval evaluates it against a
+// Context holding the variables and functions, for example to preview which
+// steps a build would run, and Constant evaluates the parts of it that don't
+// depend on the build, to find conditions that are always false (or true).
+package conditional
@@ -0,0 +1,336 @@
+package conditional
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Errors returned (wrapped) by Eval.
+var (
+	ErrType            = errors.New("type error")
+	ErrUnknownFunction = errors.New("unknown function")
+)
+
+// Context holds the values of the variables and functions an expression can
+// use, as nested maps: build.branch is looked up as
+// ctx["build"].(map[string]any)["branch"]. Variables that aren't in the
+// context are null, as in Buildkite. Values can be strings, numbers, bools,
+// nil, lists ([]any or []string, for includes), maps (map[string]any or
+// Context), or functions (Func).
+type Context map[string]any
+
+// Func is a function that can be called from an expression, such as
+// build.env.
+type Func func(args ...any) (any, error)
+
+// Eval evaluates the expression against the context.
+func Eval(e Expr, ctx Context) (any, error) {
+	ev := &evaluator{ctx: ctx}
+	return ev.eval(e)
+}
+
+// EvalBool evaluates the expression against the context, and checks that the
+// result is a boolean, as it must be to decide whether a step runs.
+func EvalBool(e Expr, ctx Context) (bool, error) {
+	v, err := Eval(e, ctx)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: expression is %s, want a boolean", ErrType, describe(v))
+	}
+	return b, nil
+}
+
+// Constant evaluates the parts of the expression that don't depend on any
+// variables or functions, and reports whether the result doesn't either. For
+// example, `false && build.branch == "main"` is always false, and
+// `"main" =~ /^release-/` is always false, whatever the build. Expressions
+// that fail to evaluate are not constant.
+func Constant(e Expr) (any, bool) {
+	ev := &evaluator{partial: true}
+	v, err := ev.eval(e)
+	if err != nil || v == unknown {
+		return nil, false
+	}
+	return v, true
+}
+
+// AlwaysFalse reports whether the expression is false whatever the build (see
+// Constant), so that a step with it as its condition never runs.
+func AlwaysFalse(e Expr) bool {
+	v, ok := Constant(e)
+	return ok && v == false
+}
+
+// AlwaysTrue reports whether the expression is true whatever the build (see
+// Constant), so that a step with it as its condition always runs.
+func AlwaysTrue(e Expr) bool {
+	v, ok := Constant(e)
+	return ok && v == true
+}
+
+// unknown is the value of expressions that depend on the build, when
+// evaluating partially.
+var unknown = &struct{ unknown bool }{}
+
+type evaluator struct {
+	ctx     Context
+	partial bool // variables and calls are unknown
+}
+
+func (ev *evaluator) eval(e Expr) (any, error) {
+	switch e := e.(type) {
+	case *Literal:
+		return e.Value, nil
+
+	case *Regexp:
+		return e.re, nil
+
+	case *Variable:
+		if ev.partial {
+			return unknown, nil
+		}
+		return ev.lookup(e.Path), nil
+
+	case *Call:
+		return ev.call(e)
+
+	case *Unary:
+		x, err := ev.eval(e.X)
+		if err != nil || x == unknown {
+			return x, err
+		}
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: ! of %s, want a boolean", ErrType, describe(x))
+		}
+		return !b, nil
+
+	case *Binary:
+		switch e.Op {
+		case "&&", "||":
+			return ev.logical(e)
+		}
+		x, err := ev.eval(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := ev.eval(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		if x == unknown || y == unknown {
+			return unknown, nil
+		}
+		return compare(e.Op, x, y)
+
+	default:
+		return nil, fmt.Errorf("unknown expression %T", e)
+	}
+}
+
+// logical evaluates && and ||, which only evaluate their right operand if
+// need be.
+func (ev *evaluator) logical(e *Binary) (any, error) {
+	// The value of x that decides the result without y.
+	decisive := e.Op == "||"
+
+	x, err := ev.eval(e.X)
+	if err != nil {
+		return nil, err
+	}
+	if x != unknown {
+		xb, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s of %s, want a boolean", ErrType, e.Op, describe(x))
+		}
+		if xb == decisive {
+			return xb, nil
+		}
+	}
+
+	y, err := ev.eval(e.Y)
+	if err != nil {
+		return nil, err
+	}
+	if y == unknown {
+		return unknown, nil
+	}
+	yb, ok := y.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s of %s, want a boolean", ErrType, e.Op, describe(y))
+	}
+	if x == unknown && yb != decisive {
+		return unknown, nil
+	}
+	return yb, nil
+}
+
+// lookup returns the value of the variable, or nil if it isn't in the
+// context.
+func (ev *evaluator) lookup(path []string) any {
+	var v any = map[string]any(ev.ctx)
+	for _, name := range path {
+		switch m := v.(type) {
+		case map[string]any:
+			v = m[name]
+		case Context:
+			v = m[name]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func (ev *evaluator) call(c *Call) (any, error) {
+	args := make([]any, len(c.Args))
+	for i, a := range c.Args {
+		v, err := ev.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if ev.partial {
+		return unknown, nil
+	}
+	var f Func
+	switch fn := ev.lookup(c.Func.Path).(type) {
+	case Func:
+		f = fn
+	case func(...any) (any, error):
+		f = fn
+	default:
+		return nil, fmt.Errorf("%w %s", ErrUnknownFunction, c.Func)
+	}
+	v, err := f(args...)
+	if err != nil {
+		return nil, fmt.Errorf("calling %s: %w", c.Func, err)
+	}
+	return v, nil
+}
+
+// compare evaluates a comparison.
+func compare(op string, x, y any) (any, error) {
+	switch op {
+	case "==":
+		return equal(x, y), nil
+
+	case "!=":
+		return !equal(x, y), nil
+
+	case "=~", "!~":
+		var re *regexp.Regexp
+		switch y := y.(type) {
+		case *regexp.Regexp:
+			re = y
+		case string:
+			var err error
+			if re, err = regexp.Compile(y); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrType, op, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s with %s, want a regular expression", ErrType, op, describe(y))
+		}
+		var matched bool
+		switch x := x.(type) {
+		case nil:
+			// An unset variable doesn't match.
+		case string:
+			matched = re.MatchString(x)
+		default:
+			return nil, fmt.Errorf("%w: %s of %s, want a string", ErrType, op, describe(x))
+		}
+		return matched == (op == "=~"), nil
+
+	case "includes":
+		switch x := x.(type) {
+		case nil:
+			return false, nil
+		case []any:
+			for _, v := range x {
+				if equal(v, y) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case []string:
+			for _, v := range x {
+				if equal(v, y) {
+					return true, nil
+				}
+			}
+			return false, nil
+		default:
+			return nil, fmt.Errorf("%w: includes of %s, want a list", ErrType, describe(x))
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+}
+
+// equal reports whether two values are equal. Numbers of any type are
+// compared as numbers; values of different types are not equal.
+func equal(x, y any) bool {
+	if xn, ok := number(x); ok {
+		yn, ok := number(y)
+		return ok && xn == yn
+	}
+	switch x := x.(type) {
+	case nil, string, bool:
+		return x == y
+	default:
+		return false
+	}
+}
+
+// number returns v as a float64, if it is a number.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// describe describes the type of a value for errors.
+func describe(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case bool:
+		return fmt.Sprintf("the boolean %t", v)
+	case *regexp.Regexp:
+		return "a regular expression"
+	case []any, []string:
+		return "a list"
+	case map[string]any, Context:
+		return "a map"
+	case Func, func(...any) (any, error):
+		return "a function"
+	}
+	if n, ok := number(v); ok {
+		return fmt.Sprintf("the number %v", n)
+	}
+	return fmt.Sprintf("a %T", v)
+}
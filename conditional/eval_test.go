@@ -0,0 +1,131 @@
+package conditional
+
+import (
+	"errors"
+	"testing"
+)
+
+func testContext() Context {
+	env := map[string]string{"DEPLOY": "true"}
+	return Context{
+		"build": map[string]any{
+			"branch":  "main",
+			"tag":     nil,
+			"message": "Fix things [skip tests]",
+			"number":  42,
+			"pull_request": map[string]any{
+				"draft":  false,
+				"labels": []string{"ci", "docs"},
+			},
+			"env": Func(func(args ...any) (any, error) {
+				if len(args) != 1 {
+					return nil, errors.New("want one argument")
+				}
+				name, _ := args[0].(string)
+				if v, ok := env[name]; ok {
+					return v, nil
+				}
+				return nil, nil
+			}),
+		},
+		"pipeline": Context{"slug": "app"},
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`build.branch == "main" && !build.pull_request.draft`, true},
+		{`build.branch != "main"`, false},
+		{`build.branch =~ /^MA/i`, true},
+		{`build.branch !~ /^release-/`, true},
+		{`build.tag =~ /^v/`, false},
+		{`build.tag == null`, true},
+		{`build.message =~ /\[skip tests\]/`, true},
+		{`build.number == 42`, true},
+		{`build.number == 42.0 && build.number != "42"`, true},
+		{`build.pull_request.labels includes "docs"`, true},
+		{`build.pull_request.labels includes "nope"`, false},
+		{`build.nonexistent == null`, true},
+		{`build.env("DEPLOY") == "true"`, true},
+		{`build.env("OTHER") == null`, true},
+		{`pipeline.slug == 'app' || build.number`, true},
+		{`false && build.number`, false},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.src, err)
+		}
+		got, err := EvalBool(e, testContext())
+		if err != nil {
+			t.Errorf("EvalBool(%q) error = %v", test.src, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("EvalBool(%q) = %t, want %t", test.src, got, test.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src     string
+		wantErr error
+	}{
+		{`build.branch`, ErrType},
+		{`!build.branch`, ErrType},
+		{`build.number && true`, ErrType},
+		{`build.number =~ /4/`, ErrType},
+		{`build.branch =~ 4`, ErrType},
+		{`build.branch includes "m"`, ErrType},
+		{`build.nope("x")`, ErrUnknownFunction},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.src, err)
+		}
+		if _, err := EvalBool(e, testContext()); !errors.Is(err, test.wantErr) {
+			t.Errorf("EvalBool(%q) error = %v, want %v", test.src, err, test.wantErr)
+		}
+	}
+}
+
+func TestConstant(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src                 string
+		wantFalse, wantTrue bool
+	}{
+		{src: `build.branch == "main"`},
+		{src: `false`, wantFalse: true},
+		{src: `false && build.branch == "main"`, wantFalse: true},
+		{src: `build.branch == "main" && false`, wantFalse: true},
+		{src: `build.branch == "main" || true`, wantTrue: true},
+		{src: `build.branch == "main" || false`},
+		{src: `"main" =~ /^release-/`, wantFalse: true},
+		{src: `!("main" == "main") || build.env("X") == "1"`},
+		{src: `1 == 1`, wantTrue: true},
+		{src: `"a" && build.branch`},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.src, err)
+		}
+		if got := AlwaysFalse(e); got != test.wantFalse {
+			t.Errorf("AlwaysFalse(%q) = %t, want %t", test.src, got, test.wantFalse)
+		}
+		if got := AlwaysTrue(e); got != test.wantTrue {
+			t.Errorf("AlwaysTrue(%q) = %t, want %t", test.src, got, test.wantTrue)
+		}
+	}
+}
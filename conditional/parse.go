@@ -0,0 +1,330 @@
+package conditional
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError is returned by Parse when an expression can't be parsed.
+type SyntaxError struct {
+	// Offset is the byte offset in the source where the problem was found.
+	Offset int
+
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Operator precedences, loosest first.
+const (
+	precOr = iota + 1
+	precAnd
+	precCompare
+	precUnary
+)
+
+var precedence = map[string]int{
+	"||":       precOr,
+	"&&":       precAnd,
+	"==":       precCompare,
+	"!=":       precCompare,
+	"=~":       precCompare,
+	"!~":       precCompare,
+	"includes": precCompare,
+}
+
+// Parse parses an expression.
+func Parse(src string) (Expr, error) {
+	p := &parser{src: src}
+	e, err := p.parseBinary(precOr)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+// parser is a recursive-descent parser. Tokens are scanned as needed, since
+// whether a "/" starts a regular expression depends on where it is.
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// parseBinary parses an expression with operators of at least precedence
+// prec.
+func (p *parser) parseBinary(prec int) (Expr, error) {
+	if prec == precUnary {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(prec + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOperator()
+		if op == "" || precedence[op] != prec {
+			return x, nil
+		}
+		p.pos += len(op)
+		y, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &Binary{Op: op, X: x, Y: y}
+	}
+}
+
+// peekOperator returns the infix operator at the current position, if any.
+func (p *parser) peekOperator() string {
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	for _, op := range []string{"||", "&&", "==", "!=", "=~", "!~"} {
+		if strings.HasPrefix(rest, op) {
+			return op
+		}
+	}
+	if strings.HasPrefix(rest, "includes") && !isIdentByte(rest, len("includes")) {
+		return "includes"
+	}
+	return ""
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], "!") {
+		start := p.pos
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Offset: start, Op: "!", X: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	start := p.pos
+	switch c := p.src[p.pos]; {
+	case c == '(':
+		p.pos++
+		x, err := p.parseBinary(precOr)
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); !strings.HasPrefix(p.src[p.pos:], ")") {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+
+	case c == '"' || c == '\'':
+		s, err := p.parseString(c)
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{Offset: start, Value: s}, nil
+
+	case c == '/':
+		return p.parseRegexp()
+
+	case c >= '0' && c <= '9' || c == '-':
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", text)
+		}
+		return &Literal{Offset: start, Value: n}, nil
+
+	case isIdentByte(p.src, p.pos):
+		return p.parseName()
+
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+// parseName parses a literal, variable, or call, starting with a name.
+func (p *parser) parseName() (Expr, error) {
+	start := p.pos
+	var path []string
+	for {
+		n := p.pos
+		for p.pos < len(p.src) && isIdentByte(p.src, p.pos) {
+			p.pos++
+		}
+		if p.pos == n {
+			return nil, p.errorf("expected a name after %q", p.src[start:p.pos])
+		}
+		path = append(path, p.src[n:p.pos])
+		if !strings.HasPrefix(p.src[p.pos:], ".") {
+			break
+		}
+		p.pos++
+	}
+
+	if len(path) == 1 {
+		switch path[0] {
+		case "true":
+			return &Literal{Offset: start, Value: true}, nil
+		case "false":
+			return &Literal{Offset: start, Value: false}, nil
+		case "null", "nil":
+			return &Literal{Offset: start, Value: nil}, nil
+		case "includes":
+			p.pos = start
+			return nil, p.errorf("unexpected includes")
+		}
+	}
+	v := &Variable{Offset: start, Path: path}
+
+	if p.skipSpace(); !strings.HasPrefix(p.src[p.pos:], "(") {
+		return v, nil
+	}
+	p.pos++
+	call := &Call{Func: v}
+	if p.skipSpace(); strings.HasPrefix(p.src[p.pos:], ")") {
+		p.pos++
+		return call, nil
+	}
+	for {
+		arg, err := p.parseBinary(precOr)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		p.skipSpace()
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], ","):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], ")"):
+			p.pos++
+			return call, nil
+		default:
+			return nil, p.errorf("expected , or ) in call of %s", v)
+		}
+	}
+}
+
+// parseString parses a string quoted with quote. Backslash escapes the next
+// character, and \n and \t are a newline and tab.
+func (p *parser) parseString(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return sb.String(), nil
+		case '\\':
+			if p.pos == len(p.src) {
+				break
+			}
+			switch e := p.src[p.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(e)
+			}
+			p.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+// parseRegexp parses a regular expression, such as /^release-/i. Within it,
+// "\/" is a slash.
+func (p *parser) parseRegexp() (Expr, error) {
+	start := p.pos
+	p.pos++
+	var pat strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			p.pos = start
+			return nil, p.errorf("unterminated regular expression")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		pat.WriteByte(c)
+		if c == '\\' && p.pos < len(p.src) {
+			pat.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+	}
+	flagsStart := p.pos
+	for p.pos < len(p.src) && isIdentByte(p.src, p.pos) {
+		p.pos++
+	}
+	r := &Regexp{Offset: start, Pattern: pat.String(), Flags: p.src[flagsStart:p.pos]}
+
+	goFlags := ""
+	for _, f := range r.Flags {
+		switch f {
+		case 'i':
+			goFlags += "i"
+		case 'm':
+			// As in Ruby, m makes . match newlines.
+			goFlags += "s"
+		default:
+			p.pos = flagsStart
+			return nil, p.errorf("unsupported regular expression flag %q", f)
+		}
+	}
+	goPat := strings.ReplaceAll(r.Pattern, `\/`, "/")
+	if goFlags != "" {
+		goPat = "(?" + goFlags + ")" + goPat
+	}
+	re, err := regexp.Compile(goPat)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid regular expression: %v", err)
+	}
+	r.re = re
+	return r, nil
+}
+
+// isIdentByte reports whether s[i] can be part of a name.
+func isIdentByte(s string, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+	c := s[i]
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,178 @@
+package conditional
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src  string
+		want Expr
+	}{
+		{
+			src: `build.branch == "main" && !build.pull_request.draft`,
+			want: &Binary{
+				Op: "&&",
+				X: &Binary{
+					Op: "==",
+					X:  &Variable{Offset: 0, Path: []string{"build", "branch"}},
+					Y:  &Literal{Offset: 16, Value: "main"},
+				},
+				Y: &Unary{
+					Offset: 26,
+					Op:     "!",
+					X:      &Variable{Offset: 27, Path: []string{"build", "pull_request", "draft"}},
+				},
+			},
+		},
+		{
+			src: `a || b && c`,
+			want: &Binary{
+				Op: "||",
+				X:  &Variable{Offset: 0, Path: []string{"a"}},
+				Y: &Binary{
+					Op: "&&",
+					X:  &Variable{Offset: 5, Path: []string{"b"}},
+					Y:  &Variable{Offset: 10, Path: []string{"c"}},
+				},
+			},
+		},
+		{
+			src: `(a || b) && build.env('X') != null`,
+			want: &Binary{
+				Op: "&&",
+				X: &Binary{
+					Op: "||",
+					X:  &Variable{Offset: 1, Path: []string{"a"}},
+					Y:  &Variable{Offset: 6, Path: []string{"b"}},
+				},
+				Y: &Binary{
+					Op: "!=",
+					X: &Call{
+						Func: &Variable{Offset: 12, Path: []string{"build", "env"}},
+						Args: []Expr{&Literal{Offset: 22, Value: "X"}},
+					},
+					Y: &Literal{Offset: 30, Value: nil},
+				},
+			},
+		},
+		{
+			src: `build.tag =~ /^v\d+\/x/i`,
+			want: &Binary{
+				Op: "=~",
+				X:  &Variable{Offset: 0, Path: []string{"build", "tag"}},
+				Y:  &Regexp{Offset: 13, Pattern: `^v\d+\/x`, Flags: "i"},
+			},
+		},
+		{
+			src: `build.pull_request.labels includes "ci" || 1.5 == -2`,
+			want: &Binary{
+				Op: "||",
+				X: &Binary{
+					Op: "includes",
+					X:  &Variable{Offset: 0, Path: []string{"build", "pull_request", "labels"}},
+					Y:  &Literal{Offset: 35, Value: "ci"},
+				},
+				Y: &Binary{
+					Op: "==",
+					X:  &Literal{Offset: 43, Value: 1.5},
+					Y:  &Literal{Offset: 50, Value: -2.0},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse(test.src)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.src, err)
+			}
+			if diff := cmp.Diff(got, test.want, cmpopts.IgnoreUnexported(Regexp{})); diff != "" {
+				t.Errorf("Parse(%q) diff (-got +want):\n%s", test.src, diff)
+			}
+		})
+	}
+}
+
+func TestExprString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src, want string
+	}{
+		{`build.branch=="main"&&!build.pull_request.draft`, `build.branch == "main" && !build.pull_request.draft`},
+		{`(a || b) && c`, `(a || b) && c`},
+		{`a || (b && c)`, `a || b && c`},
+		{`!(a == 'x')`, `!(a == "x")`},
+		{`a == (b == c)`, `a == (b == c)`},
+		{`build.env( "X" , 1 )`, `build.env("X", 1)`},
+		{`x =~ /a\/b/m`, `x =~ /a\/b/m`},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.src, err)
+		}
+		got := e.String()
+		if got != test.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", test.src, got, test.want)
+		}
+		if _, err := Parse(got); err != nil {
+			t.Errorf("Parse(%q) (the String of %q) error = %v", got, test.src, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src        string
+		wantOffset int
+	}{
+		{``, 0},
+		{`build.branch ==`, 15},
+		{`build.branch == "main`, 16},
+		{`(a || b`, 7},
+		{`a b`, 2},
+		{`build.`, 6},
+		{`x =~ /[/`, 5},
+		{`x =~ /a/g`, 8},
+		{`f(a b)`, 4},
+		{`includes x`, 0},
+		{`a = b`, 2},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.src)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("Parse(%q) error = %v, want a *SyntaxError", test.src, err)
+			continue
+		}
+		if serr.Offset != test.wantOffset {
+			t.Errorf("Parse(%q) error offset = %d, want %d (error: %v)", test.src, serr.Offset, test.wantOffset, err)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	t.Parallel()
+
+	e, err := Parse(`build.branch == "main" || build.env("X") == build.branch && !pipeline.slug`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []string{"build.branch", "pipeline.slug"}
+	if diff := cmp.Diff(Variables(e), want); diff != "" {
+		t.Errorf("Variables(e) diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,607 @@
+package gitlabci
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/ordered"
+	"gopkg.in/yaml.v3"
+)
+
+// maxGitLabRetries is the most times GitLab CI retries a job.
+const maxGitLabRetries = 2
+
+// Export converts a pipeline into a GitLab CI configuration, and returns
+// warnings about anything that couldn't be converted exactly (see the package
+// comment). The pipeline should be interpolated first, if it uses
+// environment variables that GitLab CI wouldn't have.
+//
+// Each run of steps between wait steps becomes a stage, named after the
+// group step in it if there is only one (as with pipelines converted by
+// Import), and "stage-N" otherwise. Block steps become manual jobs that
+// must be run before later stages continue. Steps are converted as follows:
+//   - the command becomes the script, with {{matrix}} tokens replaced by
+//     variables, and env becomes variables,
+//   - the image of the docker plugin becomes the image (other plugins are
+//     not converted),
+//   - the agent queue becomes a tag,
+//   - depends_on becomes needs,
+//   - branch filters become only and except,
+//   - matrix, parallelism, soft_fail, retry, timeout_in_minutes,
+//     artifact_paths, cache, and concurrency_group become the equivalent
+//     keywords, and
+//   - trigger steps become trigger jobs.
+//
+// Jobs are named after the keys of the steps, or their labels.
+func Export(p *pipeline.Pipeline) ([]byte, []error, error) {
+	ex := &exporter{
+		config: ordered.NewMap[string, any](len(p.Steps) + 2),
+		names:  make(map[string]string),
+	}
+	if err := ex.pipeline(p); err != nil {
+		return nil, nil, err
+	}
+	b, err := yaml.Marshal(ex.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, ex.warns, nil
+}
+
+type exporter struct {
+	config *ordered.MapSA
+	warns  warnings
+
+	stages []string
+	jobs   []exportJob
+
+	// names maps step keys to job names.
+	names map[string]string
+}
+
+// exportJob is a job being converted.
+type exportJob struct {
+	name string
+	def  *ordered.MapSA
+	step pipeline.Step
+	path string
+}
+
+func (ex *exporter) pipeline(p *pipeline.Pipeline) error {
+	var defaults *ordered.MapSA
+	for k, v := range p.RemainingFields {
+		if k != "agents" {
+			ex.warns.unsupported(k, "%s has no equivalent", k)
+			continue
+		}
+		var agents pipeline.Agents
+		if err := agents.UnmarshalOrdered(v); err != nil {
+			return fmt.Errorf("agents: %w", err)
+		}
+		if queue, ok := agents.Get("queue"); ok {
+			defaults = ordered.MapFromItems(ordered.TupleSA{Key: "tags", Value: []string{queue}})
+		}
+		if agents.Len() > 1 || agents.Len() == 1 && !agentsHasQueue(&agents) {
+			ex.warns.unsupported("agents", "only the queue is converted, as a tag")
+		}
+	}
+	if len(p.Notify) > 0 {
+		ex.warns.unsupported("notify", "configure notifications in the project's integrations")
+	}
+
+	// Split the steps into stages at wait steps (and block steps, which
+	// also wait for the steps before them).
+	var stage []stepAt
+	for i, s := range p.Steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		switch s := s.(type) {
+		case *pipeline.WaitStep:
+			if s.ContinueOnFailure {
+				ex.warns.approximate(path, "continue_on_failure: later stages don't run after failures")
+			}
+			ex.stage(stage)
+			stage = nil
+		case *pipeline.InputStep:
+			stage = append(stage, stepAt{path, s})
+			if k := s.Kind(); k != pipeline.InputStepInput {
+				ex.stage(stage)
+				stage = nil
+			}
+		default:
+			stage = append(stage, stepAt{path, s})
+		}
+	}
+	ex.stage(stage)
+
+	if len(ex.stages) > 0 {
+		ex.config.Set("stages", ex.stages)
+	}
+	if p.Env != nil && p.Env.Len() > 0 {
+		vars := ordered.NewMap[string, any](p.Env.Len())
+		for k, v := range p.Env.All() {
+			vars.Set(k, v)
+		}
+		ex.config.Set("variables", vars)
+	}
+	if defaults != nil {
+		ex.config.Set("default", defaults)
+	}
+	for _, j := range ex.jobs {
+		if err := ex.job(j); err != nil {
+			return err
+		}
+		ex.config.Set(j.name, j.def)
+	}
+	return nil
+}
+
+// agentsHasQueue reports whether the agents include a queue.
+func agentsHasQueue(a *pipeline.Agents) bool {
+	_, ok := a.Get("queue")
+	return ok
+}
+
+// stepAt is a step and its path.
+type stepAt struct {
+	path string
+	step pipeline.Step
+}
+
+// stage adds a stage containing the steps.
+func (ex *exporter) stage(steps []stepAt) {
+	if len(steps) == 0 {
+		return
+	}
+	name := fmt.Sprintf("stage-%d", len(ex.stages)+1)
+	if len(steps) == 1 {
+		if g, ok := steps[0].step.(*pipeline.GroupStep); ok && g.HasLabel() {
+			name = g.Label()
+		}
+	}
+	for slices.Contains(ex.stages, name) {
+		name += "-" + strconv.Itoa(len(ex.stages)+1)
+	}
+	ex.stages = append(ex.stages, name)
+
+	var add func(steps []stepAt)
+	add = func(steps []stepAt) {
+		for _, s := range steps {
+			g, ok := s.step.(*pipeline.GroupStep)
+			if !ok {
+				def := ordered.NewMap[string, any](8)
+				def.Set("stage", name)
+				ex.jobs = append(ex.jobs, exportJob{name: ex.jobName(s.step, s.path), def: def, step: s.step, path: s.path})
+				continue
+			}
+			if g.RemainingFields["depends_on"] != nil || g.RemainingFields["if"] != nil {
+				ex.warns.unsupported(s.path, "conditions and dependencies of groups are not converted")
+			}
+			inner := make([]stepAt, 0, len(g.Steps))
+			for i, gs := range g.Steps {
+				inner = append(inner, stepAt{fmt.Sprintf("%s.steps[%d]", s.path, i), gs})
+			}
+			add(inner)
+		}
+	}
+	add(steps)
+}
+
+// jobName returns a unique job name for a step, and records it so that
+// depends_on can be converted.
+func (ex *exporter) jobName(s pipeline.Step, path string) string {
+	key := pipeline.StepKey(s)
+	name := key
+	if name == "" {
+		switch s := s.(type) {
+		case *pipeline.CommandStep:
+			name = s.Label
+		case *pipeline.TriggerStep:
+			name = s.Label
+		case *pipeline.InputStep:
+			name = s.Label
+		}
+	}
+	if name == "" || slices.Contains(keywords, name) || strings.HasPrefix(name, ".") {
+		name = strings.NewReplacer("[", "-", "]", "", ".", "-").Replace(path)
+	}
+	base := name
+	for i := 2; ex.hasJob(name); i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	if key != "" {
+		ex.names[key] = name
+	}
+	return name
+}
+
+// hasJob reports whether a job has been given the name.
+func (ex *exporter) hasJob(name string) bool {
+	return slices.ContainsFunc(ex.jobs, func(j exportJob) bool { return j.name == name })
+}
+
+// job fills in the definition of a job from its step.
+func (ex *exporter) job(j exportJob) error {
+	switch s := j.step.(type) {
+	case *pipeline.CommandStep:
+		return ex.command(j, s)
+	case *pipeline.TriggerStep:
+		return ex.trigger(j, s)
+	case *pipeline.InputStep:
+		return ex.input(j, s)
+	default:
+		ex.warns.unsupported(j.path, "steps of type %T are not converted", s)
+		j.def.Set("script", []string{"true"})
+		return nil
+	}
+}
+
+// matrixToken matches the {{matrix}} tokens in a command.
+var matrixToken = regexp.MustCompile(`\{\{\s*matrix(?:\.([A-Za-z0-9_]+))?\s*\}\}`)
+
+func (ex *exporter) command(j exportJob, c *pipeline.CommandStep) error {
+	def, path := j.def, j.path
+
+	for _, pl := range c.Plugins {
+		if pl == nil {
+			continue
+		}
+		if !pl.Matches("docker") {
+			ex.warns.unsupported(path, "plugin %s has no equivalent", pl.Source)
+			continue
+		}
+		if image, ok := configString(pl.Config, "image"); ok {
+			def.Set("image", image)
+		}
+		if n := configLen(pl.Config); n > 1 {
+			ex.warns.unsupported(path, "only the image of the docker plugin is converted")
+		}
+	}
+	if c.Agents != nil {
+		if queue, ok := c.Agents.Get("queue"); ok {
+			def.Set("tags", []string{queue})
+		}
+		if c.Agents.Len() > 1 || c.Agents.Len() == 1 && !agentsHasQueue(c.Agents) {
+			ex.warns.unsupported(path+".agents", "only the queue is converted, as a tag")
+		}
+	}
+	commands, env := c.Commands(), c.Env
+	if !c.Matrix.IsEmpty() {
+		dims := ex.matrix(def, path, c.Matrix)
+		replace := func(s string) string {
+			return matrixToken.ReplaceAllStringFunc(s, func(tok string) string {
+				name := matrixToken.FindStringSubmatch(tok)[1]
+				if name == "" {
+					name = anonymousDimension
+				}
+				if !slices.Contains(dims, name) {
+					return tok
+				}
+				return "${" + name + "}"
+			})
+		}
+		for i, cmd := range commands {
+			commands[i] = replace(cmd)
+		}
+		// GitLab CI sets a variable for each dimension, so env vars that
+		// only pass on the matrix values (as Import adds) aren't needed.
+		env = make(map[string]string, len(c.Env))
+		for k, v := range c.Env {
+			if v = replace(v); v != "${"+k+"}" {
+				env[k] = v
+			}
+		}
+	}
+	if len(env) > 0 {
+		def.Set("variables", sortedVariables(env))
+	}
+	if len(commands) == 0 {
+		commands = []string{"true"}
+	}
+	def.Set("script", commands)
+
+	if n, ok := c.Parallelism.Get(); ok && n > 1 && c.Matrix.IsEmpty() {
+		def.Set("parallel", n)
+	}
+	if n, ok := c.TimeoutInMinutes.Get(); ok && n > 0 {
+		def.Set("timeout", strconv.Itoa(n)+" minutes")
+	}
+	if c.SoftFail != nil {
+		if c.SoftFail.All {
+			def.Set("allow_failure", true)
+		} else if codes := softFailCodes(c.SoftFail); len(codes) > 0 {
+			def.Set("allow_failure", ordered.MapFromItems(ordered.TupleSA{Key: "exit_codes", Value: codes}))
+		}
+	}
+	if c.Retry != nil && c.Retry.Automatic != nil && !c.Retry.Automatic.Disabled {
+		ex.retry(def, path, c.Retry.Automatic)
+	}
+	if c.ArtifactPaths != nil && len(c.ArtifactPaths.Paths) > 0 {
+		def.Set("artifacts", ordered.MapFromItems(ordered.TupleSA{Key: "paths", Value: c.ArtifactPaths.Paths}))
+	}
+	if c.Cache != nil && !c.Cache.Disabled && len(c.Cache.Paths) > 0 {
+		cache := ordered.NewMap[string, any](2)
+		if c.Cache.Name != "" {
+			cache.Set("key", c.Cache.Name)
+		}
+		cache.Set("paths", c.Cache.Paths)
+		def.Set("cache", cache)
+	}
+	if c.ConcurrencyGroup != "" {
+		def.Set("resource_group", c.ConcurrencyGroup)
+		if n, ok := c.Concurrency.Get(); ok && n != 1 {
+			ex.warns.approximate(path+".concurrency", "jobs in a resource group run one at a time")
+		}
+	}
+	if len(c.Notify) > 0 {
+		ex.warns.unsupported(path+".notify", "configure notifications in the project's integrations")
+	}
+	return ex.common(j, c.RemainingFields)
+}
+
+// anonymousDimension is the variable that the values of a matrix without
+// named dimensions are passed in.
+const anonymousDimension = "MATRIX"
+
+// matrix converts a matrix into parallel:matrix, and returns the names of
+// the variables of the dimensions.
+func (ex *exporter) matrix(def *ordered.MapSA, path string, m *pipeline.Matrix) []string {
+	if len(m.Adjustments) > 0 {
+		ex.warns.unsupported(path+".matrix.adjustments", "GitLab CI matrices can't be adjusted")
+	}
+	dims := make([]string, 0, len(m.Setup))
+	for name := range m.Setup {
+		dims = append(dims, name)
+	}
+	slices.Sort(dims)
+	setup := ordered.NewMap[string, any](len(dims))
+	for i, name := range dims {
+		values := m.Setup[name]
+		if name == "" {
+			name = anonymousDimension
+			dims[i] = name
+		}
+		setup.Set(name, values)
+	}
+	def.Set("parallel", ordered.MapFromItems(ordered.TupleSA{Key: "matrix", Value: []any{setup}}))
+	return dims
+}
+
+// retry converts automatic retries. GitLab CI can't retry as many times as
+// Buildkite, nor retry some exit statuses more than others, so the most
+// retries of any rule is used.
+func (ex *exporter) retry(def *ordered.MapSA, path string, a *pipeline.AutomaticRetry) {
+	limit, anyStatus := 0, false
+	var codes []int
+	for _, r := range a.Rules {
+		n := 2 // Buildkite's default limit
+		if r.Limit != nil {
+			n = *r.Limit
+		}
+		limit = max(limit, n)
+		if r.ExitStatus == nil || r.ExitStatus.Any {
+			anyStatus = true
+		} else {
+			codes = append(codes, r.ExitStatus.Statuses...)
+		}
+		if r.Signal != "" || r.SignalReason != "" {
+			ex.warns.unsupported(path+".retry", "retrying by signal has no equivalent")
+		}
+	}
+	if len(a.Rules) == 0 {
+		limit, anyStatus = 2, true
+	}
+	if len(a.Rules) > 1 {
+		ex.warns.approximate(path+".retry", "the rules were combined into one, with the greatest limit")
+	}
+	if limit > maxGitLabRetries {
+		ex.warns.approximate(path+".retry", "GitLab CI retries at most %d times, not %d", maxGitLabRetries, limit)
+		limit = maxGitLabRetries
+	}
+	if limit <= 0 {
+		return
+	}
+	if anyStatus || len(codes) == 0 {
+		def.Set("retry", limit)
+		return
+	}
+	slices.Sort(codes)
+	def.Set("retry", ordered.MapFromItems(
+		ordered.TupleSA{Key: "max", Value: limit},
+		ordered.TupleSA{Key: "exit_codes", Value: slices.Compact(codes)},
+	))
+}
+
+func (ex *exporter) trigger(j exportJob, t *pipeline.TriggerStep) error {
+	trigger := ordered.NewMap[string, any](3)
+	trigger.Set("project", t.Trigger)
+	ex.warns.approximate(j.path, "pipeline %q became project %q; use the project's full path", t.Trigger, t.Trigger)
+	if t.Build != nil {
+		if t.Build.Branch != "" {
+			trigger.Set("branch", t.Build.Branch)
+		}
+		if len(t.Build.Env) > 0 {
+			j.def.Set("variables", sortedVariables(t.Build.Env))
+		}
+		if t.Build.Message != "" || t.Build.Commit != "" || len(t.Build.MetaData) > 0 {
+			ex.warns.unsupported(j.path+".build", "only the branch and env of triggered builds are converted")
+		}
+	}
+	if !t.Async {
+		trigger.Set("strategy", "depend")
+	}
+	j.def.Set("trigger", trigger)
+	if t.Branches != "" {
+		ex.branches(j.def, t.Branches)
+	}
+	if t.Skip != nil && t.Skip != false {
+		j.def.Set("when", "never")
+		ex.warns.approximate(j.path+".skip", "the job is never run")
+	}
+	return ex.common(j, t.RemainingFields)
+}
+
+// input converts a block (or input) step into a manual job. Block steps are
+// not allowed to fail, so that later stages wait for them.
+func (ex *exporter) input(j exportJob, s *pipeline.InputStep) error {
+	label := s.Label
+	if label == "" {
+		label, _ = s.RemainingFields[string(s.Kind())].(string)
+	}
+	j.def.Set("script", []string{"echo " + strconv.Quote("Unblocked: "+label)})
+	j.def.Set("when", "manual")
+	if s.Kind() != pipeline.InputStepInput {
+		j.def.Set("allow_failure", false)
+	}
+	if len(s.Fields) > 0 {
+		ex.warns.unsupported(j.path+".fields", "manual jobs can't collect information; use variables when running the job")
+	}
+	if s.If != "" {
+		ex.warns.unsupported(j.path+".if", "rewrite the condition as rules")
+	}
+	fields := make(map[string]any, len(s.RemainingFields))
+	for k, v := range s.RemainingFields {
+		if k != string(s.Kind()) && k != "type" {
+			fields[k] = v
+		}
+	}
+	return ex.common(j, fields)
+}
+
+// common converts the attributes of steps kept in their remaining fields.
+func (ex *exporter) common(j exportJob, fields map[string]any) error {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		v := fields[k]
+		switch k {
+		case "depends_on":
+			deps, err := pipeline.StepDependencies(j.step)
+			if err != nil {
+				return fmt.Errorf("%s.depends_on: %w", j.path, err)
+			}
+			needs := make([]any, 0, len(deps))
+			for _, d := range deps {
+				name, ok := ex.names[d.Key]
+				if !ok {
+					ex.warns.unsupported(j.path+".depends_on", "step %q isn't in the pipeline", d.Key)
+					continue
+				}
+				needs = append(needs, name)
+				if d.AllowFailure {
+					ex.warns.unsupported(j.path+".depends_on", "allow_failure of dependencies has no equivalent")
+				}
+			}
+			if len(needs) > 0 {
+				j.def.Set("needs", needs)
+			}
+		case "branches":
+			filter, _ := v.(string)
+			if list, ok := stringList(v); ok {
+				filter = strings.Join(list, " ")
+			}
+			ex.branches(j.def, filter)
+		case "skip":
+			if v != false && v != "" {
+				j.def.Set("when", "never")
+				ex.warns.approximate(j.path+".skip", "the job is never run")
+			}
+		case "if":
+			ex.warns.unsupported(j.path+".if", "rewrite the condition %q as rules", v)
+		case "if_changed":
+			if glob, ok := v.(string); ok {
+				j.def.Set("only", ordered.MapFromItems(ordered.TupleSA{Key: "changes", Value: []string{glob}}))
+			} else {
+				ex.warns.unsupported(j.path+".if_changed", "only a single glob is converted")
+			}
+		case "key", "type":
+		default:
+			ex.warns.unsupported(j.path+"."+k, "%s has no equivalent", k)
+		}
+	}
+	return nil
+}
+
+// branches converts a branch filter into only and except.
+func (ex *exporter) branches(def *ordered.MapSA, filter string) {
+	var only, except []string
+	for _, pat := range strings.Fields(filter) {
+		neg := strings.HasPrefix(pat, "!")
+		pat = strings.TrimPrefix(pat, "!")
+		ref := pat
+		if strings.Contains(pat, "*") {
+			parts := strings.Split(pat, "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			ref = "/^" + strings.ReplaceAll(strings.Join(parts, ".*"), "/", `\/`) + "$/"
+		}
+		if neg {
+			except = append(except, ref)
+		} else {
+			only = append(only, ref)
+		}
+	}
+	if len(only) > 0 {
+		def.Set("only", only)
+	}
+	if len(except) > 0 {
+		def.Set("except", except)
+	}
+}
+
+// sortedVariables returns env vars as variables, sorted by name.
+func sortedVariables(env map[string]string) *ordered.MapSA {
+	names := make([]string, 0, len(env))
+	for k := range env {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	vars := ordered.NewMap[string, any](len(names))
+	for _, k := range names {
+		vars.Set(k, env[k])
+	}
+	return vars
+}
+
+// softFailCodes returns the exit statuses of soft_fail rules.
+func softFailCodes(s *pipeline.SoftFail) []int {
+	var codes []int
+	for _, r := range s.Rules {
+		if r.ExitStatus != nil {
+			codes = append(codes, r.ExitStatus.Statuses...)
+		}
+	}
+	return codes
+}
+
+// configString returns a string item of a plugin's config.
+func configString(config any, key string) (string, bool) {
+	var v any
+	switch c := config.(type) {
+	case map[string]any:
+		v = c[key]
+	case *ordered.MapSA:
+		v, _ = c.Get(key)
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// configLen returns the number of items in a plugin's config.
+func configLen(config any) int {
+	switch c := config.(type) {
+	case map[string]any:
+		return len(c)
+	case *ordered.MapSA:
+		return c.Len()
+	default:
+		return 0
+	}
+}
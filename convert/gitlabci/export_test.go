@@ -0,0 +1,199 @@
+package gitlabci
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	const src = `
+agents:
+  queue: linux
+env:
+  GO_VERSION: "1.23"
+steps:
+  - key: build
+    label: Build
+    command:
+      - go build ./...
+    plugins:
+      - docker#v5.12.0:
+          image: golang:1.23
+    artifact_paths: bin/*
+  - wait
+  - key: test
+    command: GOOS={{matrix.os}} go test ./...
+    matrix:
+      setup:
+        os: [linux, darwin]
+    depends_on: build
+    retry:
+      automatic:
+        - exit_status: -1
+          limit: 3
+    soft_fail:
+      - exit_status: 42
+  - label: Lint
+    command: golangci-lint run
+    branches: "main release/* !release/old-*"
+    timeout_in_minutes: 10
+    if: build.message !~ /skip lint/
+  - block: Deploy?
+    key: approve
+  - group: Deploy
+    steps:
+      - key: deploy
+        command: ./deploy.sh
+        concurrency: 1
+        concurrency_group: production
+        env:
+          TARGET: production
+      - trigger: downstream
+        build:
+          branch: main
+`
+	p, err := pipeline.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("pipeline.Parse(src) error = %v", err)
+	}
+
+	got, warns, err := Export(p)
+	if err != nil {
+		t.Fatalf("Export(p) error = %v", err)
+	}
+
+	const want = `stages:
+    - stage-1
+    - stage-2
+    - Deploy
+variables:
+    GO_VERSION: "1.23"
+default:
+    tags:
+        - linux
+build:
+    stage: stage-1
+    image: golang:1.23
+    script:
+        - go build ./...
+    artifacts:
+        paths:
+            - bin/*
+test:
+    stage: stage-2
+    parallel:
+        matrix:
+            - os:
+                - linux
+                - darwin
+    script:
+        - GOOS=${os} go test ./...
+    allow_failure:
+        exit_codes:
+            - 42
+    retry:
+        max: 2
+        exit_codes:
+            - -1
+    needs:
+        - build
+Lint:
+    stage: stage-2
+    script:
+        - golangci-lint run
+    timeout: 10 minutes
+    only:
+        - main
+        - /^release\/.*$/
+    except:
+        - /^release\/old-.*$/
+approve:
+    stage: stage-2
+    script:
+        - 'echo "Unblocked: Deploy?"'
+    when: manual
+    allow_failure: false
+deploy:
+    stage: Deploy
+    variables:
+        TARGET: production
+    script:
+        - ./deploy.sh
+    resource_group: production
+steps-5-steps-1:
+    stage: Deploy
+    trigger:
+        project: downstream
+        branch: main
+        strategy: depend
+`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("Export(p) diff (-got +want):\n%s", diff)
+	}
+
+	gotWarns := make([]string, 0, len(warns))
+	for _, w := range warns {
+		gotWarns = append(gotWarns, w.Error())
+	}
+	wantWarns := []string{
+		"steps[2].retry: converted approximately: GitLab CI retries at most 2 times, not 3",
+		`steps[3].if: not converted: rewrite the condition "build.message !~ /skip lint/" as rules`,
+		`steps[5].steps[1]: converted approximately: pipeline "downstream" became project "downstream"; use the project's full path`,
+	}
+	if diff := cmp.Diff(gotWarns, wantWarns); diff != "" {
+		t.Errorf("Export(p) warnings diff (-got +want):\n%s", diff)
+	}
+	for _, w := range warns {
+		if !errors.Is(w, ErrUnsupported) && !errors.Is(w, ErrApproximate) {
+			t.Errorf("warning %q wraps neither ErrUnsupported nor ErrApproximate", w)
+		}
+	}
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	const config = `stages:
+    - build
+    - test
+build:
+    stage: build
+    image: golang:1.23
+    script:
+        - go build ./...
+test:
+    stage: test
+    parallel:
+        matrix:
+            - GOOS:
+                - linux
+                - darwin
+    script:
+        - go test ./...
+    needs:
+        - build
+`
+	p, warns, err := Import(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Import(config) error = %v", err)
+	}
+	if len(warns) > 0 {
+		t.Errorf("Import(config) warnings = %v, want none", warns)
+	}
+	got, warns, err := Export(p)
+	if err != nil {
+		t.Fatalf("Export(p) error = %v", err)
+	}
+	if len(warns) > 0 {
+		t.Errorf("Export(p) warnings = %v, want none", warns)
+	}
+	if diff := cmp.Diff(string(got), config); diff != "" {
+		t.Errorf("Export(Import(config)) diff (-got +want):\n%s", diff)
+	}
+}
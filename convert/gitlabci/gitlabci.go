@@ -0,0 +1,99 @@
+// Package gitlabci converts between GitLab CI configuration (.gitlab-ci.yml)
+// and Buildkite pipelines, to help migrate from one to the other.
+//
+// Import converts each stage of a GitLab CI configuration into a group step,
+// with wait steps between them so that the stages run in order, and each job
+// into a command (or trigger) step within its stage's group. Export converts
+// a pipeline the other way: each run of steps between wait steps becomes a
+// stage.
+//
+// The two systems don't have the same features, so conversions can be lossy.
+// Both functions return warnings (see the warning package) for each feature
+// that was not converted, or was converted approximately. The warnings wrap
+// ErrUnsupported or ErrApproximate, and start with the path of the job or step
+// they are about:
+//
+//	p, warns, err := gitlabci.Import(f)
+//	if err != nil {
+//		return err
+//	}
+//	for _, w := range warns {
+//		log.Print(w)
+//	}
+package gitlabci
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/buildkite/go-pipeline/warning"
+)
+
+// Errors wrapped by the warnings of Import and Export.
+var (
+	// ErrUnsupported is wrapped by warnings about features that were not
+	// converted, because there is nothing equivalent.
+	ErrUnsupported = errors.New("not converted")
+
+	// ErrApproximate is wrapped by warnings about features that were
+	// converted to something that behaves differently, and should be
+	// reviewed.
+	ErrApproximate = errors.New("converted approximately")
+)
+
+// DockerPlugin is the plugin (and version) that Import uses to run jobs with
+// an image.
+const DockerPlugin = "docker#v5.12.0"
+
+// warnings collects the warnings of a conversion.
+type warnings []error
+
+// unsupported adds a warning that the item at path was not converted.
+func (w *warnings) unsupported(path, format string, args ...any) {
+	*w = append(*w, warning.Newf("%s: %w: %s", path, ErrUnsupported, fmt.Sprintf(format, args...)))
+}
+
+// approximate adds a warning that the item at path was converted to
+// something that behaves differently.
+func (w *warnings) approximate(path, format string, args ...any) {
+	*w = append(*w, warning.Newf("%s: %w: %s", path, ErrApproximate, fmt.Sprintf(format, args...)))
+}
+
+// scalarString returns a scalar value (a string, number, or boolean) as a
+// string.
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// stringList returns a string, or a list of them (possibly nested, as GitLab
+// CI flattens nested lists of commands), as a list of strings.
+func stringList(v any) ([]string, bool) {
+	if s, ok := scalarString(v); ok {
+		return []string{s}, true
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	var out []string
+	for _, item := range items {
+		ss, ok := stringList(item)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, ss...)
+	}
+	return out, true
+}
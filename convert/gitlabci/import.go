@@ -0,0 +1,1034 @@
+package gitlabci
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/ordered"
+	"gopkg.in/yaml.v3"
+)
+
+// keywords are the top-level keys of a GitLab CI configuration that aren't
+// jobs.
+var keywords = []string{
+	"after_script", "before_script", "cache", "default", "image", "include",
+	"services", "stages", "variables", "workflow",
+}
+
+// defaultKeywords are the job keywords that can be given defaults with
+// default (or, for some, at the top level).
+var defaultKeywords = []string{
+	"after_script", "artifacts", "before_script", "cache", "hooks",
+	"id_tokens", "image", "interruptible", "retry", "services", "tags",
+	"timeout",
+}
+
+// defaultStages are the stages of a configuration that doesn't list them.
+var defaultStages = []string{".pre", "build", "test", "deploy", ".post"}
+
+// ErrEmptyConfiguration is returned by Import for a configuration with nothing
+// in it (such as an empty file, or one with only comments).
+var ErrEmptyConfiguration = errors.New("empty configuration")
+
+// Import converts a GitLab CI configuration into a pipeline, and returns
+// warnings about anything that couldn't be converted exactly (see the package
+// comment).
+//
+// Jobs are converted as follows:
+//   - script (with before_script and after_script) becomes the command,
+//   - image runs the command in a container with DockerPlugin,
+//   - variables become env (and top-level variables the pipeline's env),
+//   - the first of the tags becomes the agent queue,
+//   - needs becomes depends_on,
+//   - only and except become if conditions, and their changes if_changed,
+//   - allow_failure, retry, timeout, parallel (including matrices),
+//     artifacts:paths, cache, and resource_group become the equivalent
+//     attributes,
+//   - when: manual adds a block step that the step depends on,
+//   - trigger jobs become trigger steps, and
+//   - extends, !reference tags, YAML anchors, and defaults are resolved
+//     first. Hidden jobs (starting with ".") are only used as templates.
+//
+// Keys are derived from job names, which are kept as labels. A configuration
+// without any jobs to convert becomes a pipeline with no steps.
+func Import(src io.Reader) (*pipeline.Pipeline, []error, error) {
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc.Kind == 0 {
+		// There were no documents.
+		return nil, nil, ErrEmptyConfiguration
+	}
+	if err := resolveReferences(&doc); err != nil {
+		return nil, nil, err
+	}
+	v, err := ordered.DecodeYAML(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v == nil {
+		// There was a document, but it was null.
+		return nil, nil, ErrEmptyConfiguration
+	}
+	config, ok := v.(*ordered.MapSA)
+	if !ok {
+		return nil, nil, fmt.Errorf("configuration is %T, want a mapping", v)
+	}
+
+	im := &importer{config: config, keys: make(map[string]string)}
+	p, err := im.pipeline()
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, im.warns, nil
+}
+
+type importer struct {
+	config *ordered.MapSA
+	warns  warnings
+
+	// keys maps job names to step keys.
+	keys map[string]string
+	used []string
+}
+
+// job is a job being converted.
+type job struct {
+	name  string
+	def   *ordered.MapSA // with extends and defaults resolved
+	stage string
+}
+
+func (im *importer) pipeline() (*pipeline.Pipeline, error) {
+	p := &pipeline.Pipeline{Steps: pipeline.Steps{}}
+
+	stages := defaultStages
+	if v, ok := im.config.Get("stages"); ok {
+		list, ok := stringList(v)
+		if !ok {
+			return nil, fmt.Errorf("stages is %T, want a list of strings", v)
+		}
+		// .pre and .post are always the first and last stages.
+		stages = append([]string{".pre"}, slices.DeleteFunc(list, func(s string) bool {
+			return s == ".pre" || s == ".post"
+		})...)
+		stages = append(stages, ".post")
+	}
+
+	if v, ok := im.config.Get("variables"); ok {
+		vars, err := im.variables("variables", v)
+		if err != nil {
+			return nil, err
+		}
+		if vars.Len() > 0 {
+			p.Env = vars
+		}
+	}
+	for _, kw := range []string{"include", "workflow"} {
+		if im.config.Contains(kw) {
+			im.warns.unsupported(kw, "%s has no equivalent in a single pipeline", kw)
+		}
+	}
+
+	// Work out the jobs, and their keys, before converting any, so that needs
+	// can refer to later jobs.
+	var jobs []*job
+	for name, v := range im.config.All() {
+		if slices.Contains(keywords, name) || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if _, ok := v.(*ordered.MapSA); !ok {
+			im.warns.unsupported(name, "not a job (it is %T)", v)
+			continue
+		}
+		def, err := im.resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		im.applyDefaults(name, def)
+		stage := "test"
+		if s, ok := def.Get("stage"); ok {
+			if stage, ok = s.(string); !ok {
+				return nil, fmt.Errorf("%s.stage is %T, want a string", name, s)
+			}
+		}
+		if !slices.Contains(stages, stage) {
+			return nil, fmt.Errorf("%s: stage %q is not one of the stages %q", name, stage, stages)
+		}
+		im.keys[name] = im.newKey(name)
+		jobs = append(jobs, &job{name: name, def: def, stage: stage})
+	}
+
+	for _, stage := range stages {
+		var steps pipeline.Steps
+		for _, j := range jobs {
+			if j.stage != stage {
+				continue
+			}
+			s, err := im.job(j)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s...)
+		}
+		if len(steps) == 0 {
+			continue
+		}
+		if len(p.Steps) > 0 {
+			p.Steps = append(p.Steps, &pipeline.WaitStep{Scalar: "wait"})
+		}
+		g := &pipeline.GroupStep{Steps: steps}
+		g.SetLabel(stage)
+		p.Steps = append(p.Steps, g)
+	}
+	return p, nil
+}
+
+// resolve returns the definition of a job (or template) with its extends
+// resolved: the definitions it extends are merged in order, then the job's
+// own definition. Mappings are merged deeply; other values are replaced.
+func (im *importer) resolve(name string, seen []string) (*ordered.MapSA, error) {
+	if slices.Contains(seen, name) {
+		return nil, fmt.Errorf("%s: extends loop: %s", name, strings.Join(append(seen, name), " -> "))
+	}
+	v, ok := im.config.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%s extends %q, which doesn't exist", seen[len(seen)-1], name)
+	}
+	def, ok := v.(*ordered.MapSA)
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, want a mapping", name, v)
+	}
+
+	merged := ordered.NewMap[string, any](def.Len())
+	if ext, ok := def.Get("extends"); ok {
+		parents, ok := stringList(ext)
+		if !ok {
+			return nil, fmt.Errorf("%s.extends is %T, want a string or a list of strings", name, ext)
+		}
+		for _, parent := range parents {
+			pdef, err := im.resolve(parent, append(seen, name))
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeMaps(merged, pdef)
+		}
+	}
+	merged = mergeMaps(merged, def)
+	merged.Delete("extends")
+	return merged, nil
+}
+
+// mergeMaps returns a copy of dst, with the items of src merged into it.
+func mergeMaps(dst, src *ordered.MapSA) *ordered.MapSA {
+	out := ordered.NewMap[string, any](dst.Len() + src.Len())
+	for k, v := range dst.All() {
+		out.Set(k, v)
+	}
+	for k, v := range src.All() {
+		if sm, ok := v.(*ordered.MapSA); ok {
+			if dv, ok := out.Get(k); ok {
+				if dm, ok := dv.(*ordered.MapSA); ok {
+					out.Set(k, mergeMaps(dm, sm))
+					continue
+				}
+			}
+		}
+		out.Set(k, v)
+	}
+	return out
+}
+
+// applyDefaults adds the defaults (from default, or the top level) that the
+// job inherits and doesn't override. Top-level variables become the
+// pipeline's env, so the job's variables blank those it doesn't inherit.
+func (im *importer) applyDefaults(name string, def *ordered.MapSA) {
+	inheritDefault, inheritVars := any(true), any(true)
+	if v, ok := def.Get("inherit"); ok {
+		if m, ok := v.(*ordered.MapSA); ok {
+			if d, ok := m.Get("default"); ok {
+				inheritDefault = d
+			}
+			if d, ok := m.Get("variables"); ok {
+				inheritVars = d
+			}
+		}
+		def.Delete("inherit")
+	}
+	inherits := func(setting any, name string) bool {
+		if b, ok := setting.(bool); ok {
+			return b
+		}
+		list, _ := stringList(setting)
+		return slices.Contains(list, name)
+	}
+
+	defaults, _ := im.config.Get("default")
+	dm, _ := defaults.(*ordered.MapSA)
+	for _, kw := range defaultKeywords {
+		if def.Contains(kw) || !inherits(inheritDefault, kw) {
+			continue
+		}
+		if dm != nil {
+			if v, ok := dm.Get(kw); ok {
+				def.Set(kw, v)
+				continue
+			}
+		}
+		if v, ok := im.config.Get(kw); ok && slices.Contains(keywords, kw) {
+			def.Set(kw, v)
+		}
+	}
+
+	if inheritVars == true {
+		return
+	}
+	top, ok := im.config.Get("variables")
+	if !ok {
+		return
+	}
+	tm, ok := top.(*ordered.MapSA)
+	if !ok {
+		return
+	}
+	// Copy the job's variables, which may be shared with other jobs.
+	vm := ordered.NewMap[string, any](0)
+	if vars, ok := def.Get("variables"); ok {
+		if m, ok := vars.(*ordered.MapSA); ok {
+			vm = mergeMaps(vm, m)
+		}
+	}
+	for v := range tm.Keys() {
+		if !inherits(inheritVars, v) && !vm.Contains(v) {
+			vm.Set(v, "")
+			im.warns.approximate(name+".inherit.variables", "%s is set to the empty string rather than unset", v)
+		}
+	}
+	if vm.Len() > 0 {
+		def.Set("variables", vm)
+	}
+}
+
+// invalidKeyChars matches the characters that Import replaces in job names to
+// make keys.
+var invalidKeyChars = regexp.MustCompile(`[^A-Za-z0-9_:-]+`)
+
+// newKey returns a unique step key for a name.
+func (im *importer) newKey(name string) string {
+	base := strings.Trim(invalidKeyChars.ReplaceAllString(name, "-"), "-")
+	if base == "" {
+		base = "job"
+	}
+	key := base
+	for i := 2; slices.Contains(im.used, key); i++ {
+		key = base + "-" + strconv.Itoa(i)
+	}
+	im.used = append(im.used, key)
+	return key
+}
+
+// job converts a job into its steps: usually one, but a block step is added
+// before jobs that are run manually, and a step is made for each matrix of
+// parallel:matrix.
+func (im *importer) job(j *job) (pipeline.Steps, error) {
+	if j.def.Contains("trigger") {
+		t, err := im.trigger(j)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		return pipeline.Steps{t}, nil
+	}
+
+	c := &pipeline.CommandStep{
+		Key:             im.keys[j.name],
+		Label:           j.name,
+		RemainingFields: make(map[string]any),
+	}
+	var (
+		steps    pipeline.Steps
+		matrices []*ordered.MapSA
+		script   = make(map[string][]string)
+		conds    []string
+	)
+	for kw, v := range j.def.All() {
+		path := j.name + "." + kw
+		switch kw {
+		case "stage":
+			// Handled by the caller.
+
+		case "script", "before_script", "after_script":
+			lines, ok := stringList(v)
+			if !ok {
+				return nil, fmt.Errorf("%s is %T, want a string or a list of strings", path, v)
+			}
+			script[kw] = lines
+
+		case "image":
+			image := v
+			if m, ok := v.(*ordered.MapSA); ok {
+				image, _ = m.Get("name")
+				for k := range m.Keys() {
+					if k != "name" {
+						im.warns.unsupported(path+"."+k, "set it in the config of the %s plugin", DockerPlugin)
+					}
+				}
+			}
+			name, ok := image.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s is %T, want an image name", path, v)
+			}
+			c.Plugins = append(c.Plugins, &pipeline.Plugin{
+				Source: DockerPlugin,
+				Config: ordered.MapFromItems(ordered.TupleSA{Key: "image", Value: name}),
+			})
+
+		case "variables":
+			vars, err := im.variables(path, v)
+			if err != nil {
+				return nil, err
+			}
+			if vars.Len() > 0 {
+				c.Env = vars.ToMap()
+			}
+
+		case "tags":
+			tags, ok := stringList(v)
+			if !ok {
+				return nil, fmt.Errorf("%s is %T, want a list of strings", path, v)
+			}
+			if len(tags) == 0 {
+				break
+			}
+			c.Agents = pipeline.NewAgents(map[string]string{"queue": tags[0]})
+			if len(tags) > 1 {
+				im.warns.approximate(path, "only the first tag (%q) was used, as the agent queue", tags[0])
+			}
+
+		case "needs":
+			deps, err := im.needs(path, v)
+			if err != nil {
+				return nil, err
+			}
+			if len(deps) > 0 {
+				c.RemainingFields["depends_on"] = deps
+			}
+
+		case "only", "except":
+			if cond := im.onlyExcept(c.RemainingFields, path, kw, v); cond != "" {
+				conds = append(conds, cond)
+			}
+
+		case "rules":
+			im.warns.unsupported(path, "rewrite the rules as an if condition")
+
+		case "when":
+			when, _ := v.(string)
+			switch when {
+			case "on_success":
+				// The default.
+			case "manual":
+				block := &pipeline.InputStep{
+					Key:             im.newKey(c.Key + "-manual"),
+					RemainingFields: map[string]any{"block": "Run " + j.name + "?"},
+				}
+				steps = append(steps, block)
+				c.RemainingFields["depends_on"] = append(asList(c.RemainingFields["depends_on"]), block.Key)
+			case "always":
+				c.AllowDependencyFailure = true
+				im.warns.approximate(path, "the step runs even if its dependencies fail, but not after failures in earlier stages")
+			case "never":
+				c.RemainingFields["skip"] = true
+			default:
+				im.warns.unsupported(path, "when: %v has no equivalent", v)
+			}
+
+		case "allow_failure":
+			sf, err := softFail(path, v)
+			if err != nil {
+				return nil, err
+			}
+			c.SoftFail = sf
+
+		case "retry":
+			r, err := im.retry(path, v)
+			if err != nil {
+				return nil, err
+			}
+			c.Retry = r
+
+		case "timeout":
+			s, _ := v.(string)
+			mins, err := parseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			c.TimeoutInMinutes = pipeline.NewInt(mins)
+
+		case "parallel":
+			switch v := v.(type) {
+			case int:
+				c.Parallelism = pipeline.NewInt(v)
+			case *ordered.MapSA:
+				list, _ := v.Get("matrix")
+				items, ok := list.([]any)
+				if !ok {
+					return nil, fmt.Errorf("%s.matrix is %T, want a list", path, list)
+				}
+				for _, item := range items {
+					m, ok := item.(*ordered.MapSA)
+					if !ok {
+						return nil, fmt.Errorf("%s.matrix item is %T, want a mapping", path, item)
+					}
+					matrices = append(matrices, m)
+				}
+			default:
+				return nil, fmt.Errorf("%s is %T, want a number or a matrix", path, v)
+			}
+
+		case "artifacts":
+			m, ok := v.(*ordered.MapSA)
+			if !ok {
+				return nil, fmt.Errorf("%s is %T, want a mapping", path, v)
+			}
+			for k, v := range m.All() {
+				if k != "paths" {
+					im.warns.unsupported(path+"."+k, "only artifact paths are converted")
+					continue
+				}
+				paths, ok := stringList(v)
+				if !ok {
+					return nil, fmt.Errorf("%s.paths is %T, want a list of strings", path, v)
+				}
+				c.ArtifactPaths = &pipeline.ArtifactPaths{Paths: paths}
+			}
+
+		case "cache":
+			cache, err := im.cache(path, v)
+			if err != nil {
+				return nil, err
+			}
+			c.Cache = cache
+
+		case "resource_group":
+			group, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s is %T, want a string", path, v)
+			}
+			c.ConcurrencyGroup = group
+			c.Concurrency = pipeline.NewInt(1)
+
+		case "dependencies":
+			im.warns.unsupported(path, "download artifacts with buildkite-agent artifact download")
+
+		case "services":
+			im.warns.unsupported(path, "run services with the docker-compose plugin")
+
+		case "interruptible":
+			if v == true {
+				im.warns.unsupported(path, "use the pipeline's cancel intermediate builds setting")
+			}
+
+		default:
+			im.warns.unsupported(path, "%s has no equivalent", kw)
+		}
+	}
+
+	lines := slices.Concat(script["before_script"], script["script"], script["after_script"])
+	if len(script["script"]) == 0 {
+		im.warns.unsupported(j.name, "the job has no script")
+	}
+	if len(script["after_script"]) > 0 {
+		im.warns.approximate(j.name+".after_script", "the commands only run if the script succeeds")
+	}
+	c.SetCommands(lines)
+	if len(conds) > 0 {
+		c.RemainingFields["if"] = strings.Join(conds, " && ")
+	}
+	if len(c.RemainingFields) == 0 {
+		c.RemainingFields = nil
+	}
+
+	if len(matrices) == 0 {
+		return append(steps, c), nil
+	}
+	for i, m := range matrices {
+		mc := *c
+		mc.RemainingFields = maps.Clone(c.RemainingFields)
+		if len(matrices) > 1 {
+			mc.Key = im.newKey(fmt.Sprintf("%s-%d", c.Key, i+1))
+		}
+		if err := im.matrix(&mc, j.name+".parallel.matrix", m); err != nil {
+			return nil, err
+		}
+		steps = append(steps, &mc)
+	}
+	if len(matrices) > 1 {
+		im.warns.approximate(j.name+".parallel.matrix", "each matrix became a separate step, with keys %s-1 to %s-%d", c.Key, c.Key, len(matrices))
+	}
+	return steps, nil
+}
+
+// matrix sets the matrix of a step. The matrix values are passed to the
+// command in env vars named after the dimensions, as in GitLab CI.
+func (im *importer) matrix(c *pipeline.CommandStep, path string, m *ordered.MapSA) error {
+	setup := make(pipeline.MatrixSetup, m.Len())
+	env := make(map[string]string, len(c.Env)+m.Len())
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	for name, v := range m.All() {
+		values, ok := stringList(v)
+		if !ok {
+			return fmt.Errorf("%s.%s is %T, want a list of values", path, name, v)
+		}
+		setup[name] = values
+		env[name] = "{{matrix." + name + "}}"
+	}
+	c.Matrix = &pipeline.Matrix{Setup: setup}
+	c.Env = env
+	return nil
+}
+
+// variables converts variables, which can be written as values or as
+// mappings with a value and a description.
+func (im *importer) variables(path string, v any) (*ordered.MapSS, error) {
+	m, ok := v.(*ordered.MapSA)
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, want a mapping", path, v)
+	}
+	out := ordered.NewMap[string, string](m.Len())
+	for name, v := range m.All() {
+		if vm, ok := v.(*ordered.MapSA); ok {
+			v, _ = vm.Get("value")
+			if vm.Contains("options") {
+				im.warns.unsupported(path+"."+name+".options", "use an input step to choose values")
+			}
+			if e, ok := vm.Get("expand"); ok && e == false {
+				im.warns.approximate(path+"."+name+".expand", "the value is interpolated; escape $ as $$")
+			}
+		}
+		if v == nil {
+			v = ""
+		}
+		s, ok := scalarString(v)
+		if !ok {
+			return nil, fmt.Errorf("%s.%s is %T, want a value", path, name, v)
+		}
+		out.Set(name, s)
+	}
+	return out, nil
+}
+
+// needs converts needs into depends_on.
+func (im *importer) needs(path string, v any) ([]any, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, want a list", path, v)
+	}
+	if len(items) == 0 {
+		im.warns.approximate(path, "the step still waits for earlier stages")
+	}
+	var deps []any
+	for _, item := range items {
+		name, ok := item.(string)
+		optional := false
+		if m, isMap := item.(*ordered.MapSA); isMap {
+			if m.Contains("pipeline") || m.Contains("project") {
+				im.warns.unsupported(path, "needs from other pipelines have no equivalent")
+				continue
+			}
+			n, _ := m.Get("job")
+			name, ok = n.(string)
+			optional = isTrue(m, "optional")
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s item is %T, want a job name", path, item)
+		}
+		key, ok := im.keys[name]
+		if !ok {
+			if optional {
+				continue
+			}
+			return nil, fmt.Errorf("%s: job %q doesn't exist", path, name)
+		}
+		deps = append(deps, key)
+	}
+	return deps, nil
+}
+
+// onlyExcept converts only or except into a condition, and changes into
+// if_changed. The condition can be combined with others with &&.
+func (im *importer) onlyExcept(fields map[string]any, path, kw string, v any) string {
+	refs, ok := stringList(v)
+	if m, isMap := v.(*ordered.MapSA); isMap {
+		refs, ok = nil, true
+		for k, v := range m.All() {
+			switch k {
+			case "refs":
+				refs, ok = stringList(v)
+			case "changes":
+				globs, isList := stringList(v)
+				if kw == "only" && isList && len(globs) > 0 {
+					fields["if_changed"] = globAny(globs)
+				} else {
+					im.warns.unsupported(path+"."+k, "only only:changes has an equivalent (if_changed)")
+				}
+			default:
+				im.warns.unsupported(path+"."+k, "rewrite it as an if condition")
+			}
+		}
+	}
+	if !ok {
+		im.warns.unsupported(path, "it is %T, want a list of refs", v)
+		return ""
+	}
+
+	conds := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		cond, ok := refCondition(ref)
+		if !ok {
+			im.warns.unsupported(path, "%q has no equivalent", ref)
+			continue
+		}
+		conds = append(conds, cond)
+	}
+	switch {
+	case len(conds) == 0:
+		return ""
+	case kw == "except":
+		return "!(" + strings.Join(conds, " || ") + ")"
+	case len(conds) == 1:
+		return conds[0]
+	default:
+		return "(" + strings.Join(conds, " || ") + ")"
+	}
+}
+
+// globAny returns a list of globs in the form of if_changed: a single glob
+// as it is, or several combined with braces.
+func globAny(globs []string) string {
+	if len(globs) == 1 {
+		return globs[0]
+	}
+	return "{" + strings.Join(globs, ",") + "}"
+}
+
+// refCondition returns the condition equivalent to a ref of only or except.
+func refCondition(ref string) (string, bool) {
+	switch ref {
+	case "branches":
+		return "build.tag == null", true
+	case "tags":
+		return "build.tag != null", true
+	case "merge_requests", "external_pull_requests":
+		return "build.pull_request.id != null", true
+	case "schedules":
+		return `build.source == "schedule"`, true
+	case "api":
+		return `build.source == "api"`, true
+	case "web":
+		return `build.source == "ui"`, true
+	case "triggers", "pipelines":
+		return `build.source == "trigger_job"`, true
+	case "pushes":
+		return `build.source == "webhook"`, true
+	case "chat":
+		return "", false
+	}
+	if len(ref) > 1 && strings.HasPrefix(ref, "/") && strings.LastIndex(ref, "/") > 0 {
+		return "build.branch =~ " + ref, true
+	}
+	return "build.branch == " + strconv.Quote(ref), true
+}
+
+// softFail converts allow_failure.
+func softFail(path string, v any) (*pipeline.SoftFail, error) {
+	switch v := v.(type) {
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return &pipeline.SoftFail{All: true}, nil
+	case *ordered.MapSA:
+		codes, _ := v.Get("exit_codes")
+		statuses, err := intList(codes)
+		if err != nil {
+			return nil, fmt.Errorf("%s.exit_codes: %w", path, err)
+		}
+		return pipeline.NewSoftFail(statuses...), nil
+	default:
+		return nil, fmt.Errorf("%s is %T, want a boolean or a mapping", path, v)
+	}
+}
+
+// retry converts retry.
+func (im *importer) retry(path string, v any) (*pipeline.Retry, error) {
+	rule := new(pipeline.AutomaticRetryRule)
+	switch v := v.(type) {
+	case int:
+		rule.Limit = &v
+	case *ordered.MapSA:
+		max, _ := v.Get("max")
+		n, ok := max.(int)
+		if !ok {
+			return nil, fmt.Errorf("%s.max is %T, want a number", path, max)
+		}
+		rule.Limit = &n
+		if codes, ok := v.Get("exit_codes"); ok {
+			statuses, err := intList(codes)
+			if err != nil {
+				return nil, fmt.Errorf("%s.exit_codes: %w", path, err)
+			}
+			rule.ExitStatus = &pipeline.ExitStatus{Statuses: statuses}
+		}
+		if when, ok := v.Get("when"); ok && when != "always" {
+			im.warns.approximate(path+".when", "the step is retried whatever the reason for the failure")
+		}
+	default:
+		return nil, fmt.Errorf("%s is %T, want a number or a mapping", path, v)
+	}
+	if *rule.Limit <= 0 {
+		return nil, nil
+	}
+	if rule.ExitStatus == nil {
+		rule.ExitStatus = &pipeline.ExitStatus{Any: true}
+	}
+	return &pipeline.Retry{Automatic: pipeline.NewAutomaticRetry(rule)}, nil
+}
+
+// cache converts cache. Only the first cache is converted if there are
+// several.
+func (im *importer) cache(path string, v any) (*pipeline.Cache, error) {
+	if list, ok := v.([]any); ok {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		if len(list) > 1 {
+			im.warns.unsupported(path, "only the first cache was converted")
+		}
+		v = list[0]
+	}
+	m, ok := v.(*ordered.MapSA)
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, want a mapping", path, v)
+	}
+	cache := new(pipeline.Cache)
+	for k, v := range m.All() {
+		switch k {
+		case "paths":
+			paths, ok := stringList(v)
+			if !ok {
+				return nil, fmt.Errorf("%s.paths is %T, want a list of strings", path, v)
+			}
+			cache.Paths = paths
+		case "key":
+			if name, ok := v.(string); ok {
+				cache.Name = name
+			} else {
+				im.warns.unsupported(path+".key", "only string cache keys are converted")
+			}
+		default:
+			im.warns.unsupported(path+"."+k, "%s has no equivalent", k)
+		}
+	}
+	return cache, nil
+}
+
+// trigger converts a trigger job. It returns nil if the job triggers a child
+// pipeline, which can't be converted.
+func (im *importer) trigger(j *job) (*pipeline.TriggerStep, error) {
+	path := j.name + ".trigger"
+	v, _ := j.def.Get("trigger")
+	project, _ := v.(string)
+	t := &pipeline.TriggerStep{Key: im.keys[j.name], Label: j.name, Async: true}
+	if m, ok := v.(*ordered.MapSA); ok {
+		if m.Contains("include") {
+			im.warns.unsupported(path+".include", "convert the child pipeline, and upload it with buildkite-agent pipeline upload")
+			return nil, nil
+		}
+		p, _ := m.Get("project")
+		project, _ = p.(string)
+		if b, ok := m.Get("branch"); ok {
+			branch, _ := b.(string)
+			t.Build = &pipeline.TriggerBuild{Branch: branch}
+		}
+		if s, ok := m.Get("strategy"); ok && s == "depend" {
+			t.Async = false
+		}
+	}
+	if project == "" {
+		return nil, fmt.Errorf("%s has no project", path)
+	}
+	t.Trigger = project[strings.LastIndex(project, "/")+1:]
+	im.warns.approximate(path, "project %q became pipeline %q; check the pipeline's slug", project, t.Trigger)
+
+	for kw, v := range j.def.All() {
+		switch kw {
+		case "trigger", "stage":
+		case "variables":
+			vars, err := im.variables(j.name+".variables", v)
+			if err != nil {
+				return nil, err
+			}
+			if vars.Len() > 0 {
+				if t.Build == nil {
+					t.Build = new(pipeline.TriggerBuild)
+				}
+				t.Build.Env = vars.ToMap()
+			}
+		case "needs":
+			deps, err := im.needs(j.name+".needs", v)
+			if err != nil {
+				return nil, err
+			}
+			if len(deps) > 0 {
+				t.RemainingFields = map[string]any{"depends_on": deps}
+			}
+		default:
+			if !slices.Contains(defaultKeywords, kw) {
+				im.warns.unsupported(j.name+"."+kw, "%s has no equivalent for trigger steps", kw)
+			}
+		}
+	}
+	return t, nil
+}
+
+// durationUnits are the units of GitLab CI durations, in minutes.
+var durationUnits = map[string]float64{
+	"s": 1.0 / 60, "sec": 1.0 / 60, "secs": 1.0 / 60, "second": 1.0 / 60, "seconds": 1.0 / 60,
+	"m": 1, "min": 1, "mins": 1, "minute": 1, "minutes": 1,
+	"h": 60, "hr": 60, "hrs": 60, "hour": 60, "hours": 60,
+	"d": 24 * 60, "day": 24 * 60, "days": 24 * 60,
+}
+
+// durationPart matches a number and unit in a duration.
+var durationPart = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*([a-z]+)`)
+
+// parseDuration parses a duration such as "1h 30m" or "3 hours", and returns
+// it in minutes, rounded up.
+func parseDuration(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+	var mins float64
+	rest := durationPart.ReplaceAllStringFunc(s, func(part string) string {
+		m := durationPart.FindStringSubmatch(part)
+		unit, ok := durationUnits[m[2]]
+		if !ok {
+			return part
+		}
+		n, _ := strconv.ParseFloat(m[1], 64)
+		mins += n * unit
+		return ""
+	})
+	if strings.Trim(rest, " ,and") != "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return int(math.Ceil(mins)), nil
+}
+
+// intList returns a number, or a list of numbers, as a list.
+func intList(v any) ([]int, error) {
+	switch v := v.(type) {
+	case int:
+		return []int{v}, nil
+	case []any:
+		out := make([]int, 0, len(v))
+		for _, item := range v {
+			n, ok := item.(int)
+			if !ok {
+				return nil, fmt.Errorf("%T is not a number", item)
+			}
+			out = append(out, n)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%T is not a number or a list of numbers", v)
+	}
+}
+
+// asList returns a depends_on value as a list.
+func asList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+// isTrue reports whether m has the key set to true.
+func isTrue(m *ordered.MapSA, key string) bool {
+	v, _ := m.Get(key)
+	return v == true
+}
+
+// resolveReferences replaces the !reference tags in a document, such as
+// `!reference [.setup, script]`, with the parts of the document they refer
+// to.
+func resolveReferences(doc *yaml.Node) error {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	var walk func(n *yaml.Node, depth int) error
+	walk = func(n *yaml.Node, depth int) error {
+		if depth > 10 {
+			return errors.New("!reference tags nested too deeply")
+		}
+		if n.Tag == "!reference" {
+			target, err := lookupReference(root, n)
+			if err != nil {
+				return err
+			}
+			*n = *target
+			return walk(n, depth+1)
+		}
+		for _, c := range n.Content {
+			if err := walk(c, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, 0)
+}
+
+// lookupReference returns a copy of the node a !reference tag refers to.
+func lookupReference(root, ref *yaml.Node) (*yaml.Node, error) {
+	if ref.Kind != yaml.SequenceNode || len(ref.Content) == 0 {
+		return nil, fmt.Errorf("line %d: !reference must be a list of keys", ref.Line)
+	}
+	n := root
+	var path []string
+	for _, k := range ref.Content {
+		path = append(path, k.Value)
+		for n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		var next *yaml.Node
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == k.Value {
+					next = n.Content[i+1]
+				}
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("line %d: !reference to %s, which doesn't exist", ref.Line, strings.Join(path, "."))
+		}
+		n = next
+	}
+	cp := *n
+	return &cp, nil
+}
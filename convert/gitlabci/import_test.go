@@ -0,0 +1,317 @@
+package gitlabci
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	const config = `
+stages: [build, test, deploy]
+variables:
+  GO_VERSION: "1.23"
+  DEPLOY_ENV:
+    value: staging
+    description: Where to deploy
+default:
+  image: golang:1.23
+  tags: [linux]
+.setup:
+  before_script:
+    - go mod download
+build:
+  stage: build
+  extends: .setup
+  script: go build ./...
+  artifacts:
+    paths: [bin/]
+    expire_in: 1 week
+test:
+  script:
+    - !reference [.setup, before_script]
+    - go test ./...
+  parallel:
+    matrix:
+      - GOOS: [linux]
+  retry: 2
+  allow_failure:
+    exit_codes: [42]
+  needs: [build]
+lint:
+  image: golangci/golangci-lint
+  script: golangci-lint run
+  only: [main, /^release-.*$/]
+  except: [tags]
+  timeout: 1h 30m
+deploy:
+  stage: deploy
+  script: ./deploy.sh
+  when: manual
+  resource_group: production
+  tags: [deploy, linux]
+  environment: production
+  inherit:
+    default: false
+downstream:
+  stage: deploy
+  trigger:
+    project: my-group/other-project
+    strategy: depend
+`
+
+	p, warns, err := Import(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Import(config) error = %v", err)
+	}
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p) error = %v", err)
+	}
+
+	const want = `steps:
+    - group: build
+      steps:
+        - key: build
+          label: build
+          command: |-
+            go mod download
+            go build ./...
+          plugins:
+            - github.com/buildkite-plugins/docker-buildkite-plugin#v5.12.0:
+                image: golang:1.23
+          agents:
+            queue: linux
+          artifact_paths:
+            - bin/
+    - wait
+    - group: test
+      steps:
+        - key: test
+          label: test
+          command: |-
+            go mod download
+            go test ./...
+          plugins:
+            - github.com/buildkite-plugins/docker-buildkite-plugin#v5.12.0:
+                image: golang:1.23
+          env:
+            GOOS: '{{matrix.GOOS}}'
+          matrix:
+            setup:
+                GOOS:
+                    - linux
+          retry:
+            automatic:
+                - exit_status: '*'
+                  limit: 2
+          agents:
+            queue: linux
+          soft_fail:
+            - exit_status: 42
+          depends_on:
+            - build
+        - key: lint
+          label: lint
+          command: golangci-lint run
+          plugins:
+            - github.com/buildkite-plugins/docker-buildkite-plugin#v5.12.0:
+                image: golangci/golangci-lint
+          agents:
+            queue: linux
+          timeout_in_minutes: 90
+          if: (build.branch == "main" || build.branch =~ /^release-.*$/) && !(build.tag != null)
+    - wait
+    - group: deploy
+      steps:
+        - key: deploy-manual
+          block: Run deploy?
+        - key: deploy
+          label: deploy
+          command: ./deploy.sh
+          agents:
+            queue: deploy
+          concurrency: 1
+          concurrency_group: production
+          depends_on:
+            - deploy-manual
+        - key: downstream
+          label: downstream
+          trigger: other-project
+env:
+    GO_VERSION: "1.23"
+    DEPLOY_ENV: staging
+`
+	if diff := cmp.Diff(string(b), want); diff != "" {
+		t.Errorf("Import(config) pipeline diff (-got +want):\n%s", diff)
+	}
+
+	gotWarns := make([]string, 0, len(warns))
+	for _, w := range warns {
+		gotWarns = append(gotWarns, w.Error())
+	}
+	wantWarns := []string{
+		"build.artifacts.expire_in: not converted: only artifact paths are converted",
+		`deploy.tags: converted approximately: only the first tag ("deploy") was used, as the agent queue`,
+		"deploy.environment: not converted: environment has no equivalent",
+		`downstream.trigger: converted approximately: project "my-group/other-project" became pipeline "other-project"; check the pipeline's slug`,
+	}
+	if diff := cmp.Diff(gotWarns, wantWarns); diff != "" {
+		t.Errorf("Import(config) warnings diff (-got +want):\n%s", diff)
+	}
+	for _, w := range warns {
+		if !errors.Is(w, ErrUnsupported) && !errors.Is(w, ErrApproximate) {
+			t.Errorf("warning %q wraps neither ErrUnsupported nor ErrApproximate", w)
+		}
+	}
+}
+
+func TestImportMultipleMatrices(t *testing.T) {
+	t.Parallel()
+
+	const config = `
+test:
+  script: make test
+  parallel:
+    matrix:
+      - OS: [linux, darwin]
+      - OS: [windows]
+        SHELL: [pwsh]
+`
+	p, warns, err := Import(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Import(config) error = %v", err)
+	}
+	if len(p.Steps) != 1 {
+		t.Fatalf("len(p.Steps) = %d, want 1", len(p.Steps))
+	}
+	b, err := yaml.Marshal(p.Steps)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p.Steps) error = %v", err)
+	}
+	const want = `- group: test
+  steps:
+    - key: test-1
+      label: test
+      command: make test
+      env:
+        OS: '{{matrix.OS}}'
+      matrix:
+        setup:
+            OS:
+                - linux
+                - darwin
+    - key: test-2
+      label: test
+      command: make test
+      env:
+        OS: '{{matrix.OS}}'
+        SHELL: '{{matrix.SHELL}}'
+      matrix:
+        setup:
+            OS:
+                - windows
+            SHELL:
+                - pwsh
+`
+	if diff := cmp.Diff(string(b), want); diff != "" {
+		t.Errorf("Import(config) steps diff (-got +want):\n%s", diff)
+	}
+	if len(warns) != 1 || !errors.Is(warns[0], ErrApproximate) {
+		t.Errorf("Import(config) warnings = %v, want one wrapping ErrApproximate", warns)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc, config string
+	}{
+		{
+			desc:   "extends loop",
+			config: ".a: {extends: .b}\n.b: {extends: .a}\njob: {extends: .a, script: x}\n",
+		},
+		{
+			desc:   "missing extends",
+			config: "job: {extends: .nope, script: x}\n",
+		},
+		{
+			desc:   "unknown stage",
+			config: "stages: [build]\njob: {stage: test, script: x}\n",
+		},
+		{
+			desc:   "unknown needs",
+			config: "job: {needs: [nope], script: x}\n",
+		},
+		{
+			desc:   "missing reference",
+			config: "job: {script: !reference [.setup, script]}\n",
+		},
+		{
+			desc:   "bad timeout",
+			config: "job: {timeout: soon, script: x}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			if _, _, err := Import(strings.NewReader(test.config)); err == nil {
+				t.Errorf("Import(%q) error = nil, want an error", test.config)
+			}
+		})
+	}
+}
+
+func TestImportEmpty(t *testing.T) {
+	t.Parallel()
+
+	for _, config := range []string{"", "# nothing here\n", "---\n", "null\n"} {
+		if _, _, err := Import(strings.NewReader(config)); !errors.Is(err, ErrEmptyConfiguration) {
+			t.Errorf("Import(%q) error = %v, want %v", config, err, ErrEmptyConfiguration)
+		}
+	}
+
+	// A configuration with no jobs to convert has no steps, rather than nil
+	// steps.
+	const config = "stages: [build]\n.template: {script: make}\n"
+	p, _, err := Import(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Import(%q) error = %v", config, err)
+	}
+	if p.Steps == nil || len(p.Steps) != 0 {
+		t.Errorf("Import(%q) steps = %#v, want empty, non-nil steps", config, p.Steps)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{input: "30m", want: 30},
+		{input: "1h 30m", want: 90},
+		{input: "3 hours", want: 180},
+		{input: "1 hour and 15 minutes", want: 75},
+		{input: "90 seconds", want: 2},
+		{input: "2d", want: 2 * 24 * 60},
+	}
+	for _, test := range tests {
+		got, err := parseDuration(test.input)
+		if err != nil {
+			t.Errorf("parseDuration(%q) error = %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseDuration(%q) = %d, want %d", test.input, got, test.want)
+		}
+	}
+}
@@ -10,4 +10,8 @@
 //     round-trip may produce different output.
 //   - It is non-canonical: using the object model does not guarantee that a
 //     pipeline will be accepted by the pipeline upload API.
+//   - It is not synchronised: a parsed pipeline can be read (marshaled,
+//     validated, and so on) by multiple goroutines at once, but methods that
+//     modify it (such as Interpolate) need exclusive access. Give each
+//     goroutine that modifies a pipeline its own copy.
 package pipeline
@@ -0,0 +1,123 @@
+package evaluate
+
+import (
+	"fmt"
+
+	"github.com/buildkite/go-pipeline/conditional"
+)
+
+// Build describes a simulated build: the values a real build would have when
+// the pipeline is uploaded to it.
+type Build struct {
+	Branch  string
+	Tag     string
+	Commit  string
+	Message string
+	Number  int
+
+	// Source is what created the build, such as "webhook", "ui", "api",
+	// "trigger_job", or "schedule".
+	Source string
+
+	// PullRequest is nil unless the build is for a pull request.
+	PullRequest *PullRequest
+
+	// Pipeline and Organization describe where the build runs.
+	Pipeline     Pipeline
+	Organization string // slug
+
+	// Env holds the build's environment variables, for build.env().
+	Env map[string]string
+
+	// MetaData holds meta-data already set on the build. Block and input
+	// steps whose fields all have values here are treated as already
+	// answered (see Step.WaitsForInput).
+	MetaData map[string]string
+}
+
+// PullRequest describes the pull request a build is for.
+type PullRequest struct {
+	ID         string
+	BaseBranch string
+	Repository string
+	Draft      bool
+	Labels     []string
+}
+
+// Pipeline describes the pipeline a build belongs to.
+type Pipeline struct {
+	Slug          string
+	DefaultBranch string
+	Repository    string
+}
+
+// Context returns the variables and functions available to step conditions
+// for the build, as in Buildkite: build.branch, build.tag, build.commit,
+// build.message, build.number, build.source, build.env(), build.pull_request.*,
+// pipeline.slug, pipeline.default_branch, pipeline.repository, and
+// organization.slug. Values that the build doesn't have (such as build.tag
+// for builds that aren't for a tag) are null. Callers can add more to the
+// returned context before evaluating conditions with it.
+func (b *Build) Context() conditional.Context {
+	pr := map[string]any{
+		"id":          nil,
+		"base_branch": nil,
+		"repository":  nil,
+		"draft":       false,
+		"labels":      []string{},
+	}
+	if b.PullRequest != nil {
+		pr["id"] = nullIfEmpty(b.PullRequest.ID)
+		pr["base_branch"] = nullIfEmpty(b.PullRequest.BaseBranch)
+		pr["repository"] = nullIfEmpty(b.PullRequest.Repository)
+		pr["draft"] = b.PullRequest.Draft
+		if b.PullRequest.Labels != nil {
+			pr["labels"] = b.PullRequest.Labels
+		}
+	}
+
+	return conditional.Context{
+		"build": map[string]any{
+			"branch":       nullIfEmpty(b.Branch),
+			"tag":          nullIfEmpty(b.Tag),
+			"commit":       nullIfEmpty(b.Commit),
+			"message":      nullIfEmpty(b.Message),
+			"number":       b.Number,
+			"source":       nullIfEmpty(b.Source),
+			"pull_request": pr,
+			"env":          conditional.Func(b.env),
+		},
+		"pipeline": map[string]any{
+			"slug":           nullIfEmpty(b.Pipeline.Slug),
+			"default_branch": nullIfEmpty(b.Pipeline.DefaultBranch),
+			"repository":     nullIfEmpty(b.Pipeline.Repository),
+		},
+		"organization": map[string]any{
+			"slug": nullIfEmpty(b.Organization),
+		},
+	}
+}
+
+// env implements build.env(): the value of an environment variable, or null
+// if it isn't set.
+func (b *Build) env(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("got %d arguments, want 1", len(args))
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: argument is %T, want a string", conditional.ErrType, args[0])
+	}
+	if v, ok := b.Env[name]; ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+// nullIfEmpty returns s, or nil if it is empty.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+)
+
+// Env returns the environment variables a job for the step would have in the
+// build, as the agent would set them, for previewing (or testing) scripts
+// that read them. The step must be a command step, as returned by Evaluate;
+// parallelJob is the index of the job among the step's parallel jobs, and
+// must be 0 if the step has no parallelism.
+//
+// The environment is made of, in increasing order of precedence:
+//   - the build's Env,
+//   - the pipeline's env,
+//   - the step's env, and
+//   - the standard BUILDKITE_* variables describing the build (such as
+//     BUILDKITE_BRANCH and BUILDKITE_PULL_REQUEST) and the step (such as
+//     BUILDKITE_LABEL, BUILDKITE_STEP_KEY, BUILDKITE_COMMAND,
+//     BUILDKITE_PLUGINS, and BUILDKITE_PARALLEL_JOB), along with BUILDKITE
+//     and CI, which are "true".
+//
+// Variables that depend on where and when the job runs, such as
+// BUILDKITE_JOB_ID and BUILDKITE_AGENT_NAME, are not included. As in
+// Buildkite, there are no variables for the values of a matrix: they appear
+// where the step uses them, since steps expanded from a matrix have them
+// substituted into their label, command, and env.
+func Env(p *pipeline.Pipeline, b *Build, s *Step, parallelJob int) (map[string]string, error) {
+	c, ok := s.Step.(*pipeline.CommandStep)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T is not a command step, so doesn't run jobs", s.Path, s.Step)
+	}
+
+	env := maps.Clone(b.Env)
+	if env == nil {
+		env = make(map[string]string)
+	}
+	if p.Env != nil {
+		for k, v := range p.Env.All() {
+			env[k] = v
+		}
+	}
+	maps.Copy(env, c.Env)
+
+	env["BUILDKITE"] = "true"
+	env["CI"] = "true"
+
+	env["BUILDKITE_BRANCH"] = b.Branch
+	env["BUILDKITE_TAG"] = b.Tag
+	env["BUILDKITE_COMMIT"] = b.Commit
+	env["BUILDKITE_MESSAGE"] = b.Message
+	env["BUILDKITE_BUILD_NUMBER"] = strconv.Itoa(b.Number)
+	env["BUILDKITE_SOURCE"] = b.Source
+	env["BUILDKITE_PIPELINE_SLUG"] = b.Pipeline.Slug
+	env["BUILDKITE_PIPELINE_DEFAULT_BRANCH"] = b.Pipeline.DefaultBranch
+	env["BUILDKITE_REPO"] = b.Pipeline.Repository
+	env["BUILDKITE_ORGANIZATION_SLUG"] = b.Organization
+
+	// For builds that aren't for a pull request, BUILDKITE_PULL_REQUEST is
+	// "false" and the other variables are empty.
+	env["BUILDKITE_PULL_REQUEST"] = "false"
+	env["BUILDKITE_PULL_REQUEST_BASE_BRANCH"] = ""
+	env["BUILDKITE_PULL_REQUEST_REPO"] = ""
+	env["BUILDKITE_PULL_REQUEST_DRAFT"] = "false"
+	env["BUILDKITE_PULL_REQUEST_LABELS"] = ""
+	if pr := b.PullRequest; pr != nil {
+		if pr.ID != "" {
+			env["BUILDKITE_PULL_REQUEST"] = pr.ID
+		}
+		env["BUILDKITE_PULL_REQUEST_BASE_BRANCH"] = pr.BaseBranch
+		env["BUILDKITE_PULL_REQUEST_REPO"] = pr.Repository
+		env["BUILDKITE_PULL_REQUEST_DRAFT"] = strconv.FormatBool(pr.Draft)
+		env["BUILDKITE_PULL_REQUEST_LABELS"] = strings.Join(pr.Labels, ",")
+	}
+
+	env["BUILDKITE_LABEL"] = c.Label
+	env["BUILDKITE_STEP_KEY"] = c.Key
+	env["BUILDKITE_COMMAND"] = c.Command
+
+	env["BUILDKITE_ARTIFACT_PATHS"] = ""
+	if c.ArtifactPaths != nil {
+		env["BUILDKITE_ARTIFACT_PATHS"] = strings.Join(c.ArtifactPaths.Paths, ";")
+	}
+
+	env["BUILDKITE_TIMEOUT"] = "false"
+	if t, ok := c.TimeoutInMinutes.Get(); ok && t > 0 {
+		env["BUILDKITE_TIMEOUT"] = strconv.Itoa(t)
+	}
+
+	if len(c.Plugins) > 0 {
+		plugins, err := json.Marshal(c.Plugins)
+		if err != nil {
+			return nil, fmt.Errorf("%s: marshalling plugins: %w", s.Path, err)
+		}
+		env["BUILDKITE_PLUGINS"] = string(plugins)
+	}
+
+	if c.Parallelism == nil {
+		if parallelJob != 0 {
+			return nil, fmt.Errorf("%s: parallel job %d of a step without parallelism", s.Path, parallelJob)
+		}
+		return env, nil
+	}
+	n, ok := c.Parallelism.Get()
+	if !ok {
+		return nil, fmt.Errorf("%s: parallelism %q is not an integer", s.Path, c.Parallelism)
+	}
+	if parallelJob < 0 || parallelJob >= n {
+		return nil, fmt.Errorf("%s: parallel job %d out of range [0, %d)", s.Path, parallelJob, n)
+	}
+	env["BUILDKITE_PARALLEL_JOB"] = strconv.Itoa(parallelJob)
+	env["BUILDKITE_PARALLEL_JOB_COUNT"] = strconv.Itoa(n)
+	return env, nil
+}
@@ -0,0 +1,169 @@
+package evaluate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testEnvPipeline = `---
+env:
+  SHARED: pipeline
+  FROM_PIPELINE: "1"
+steps:
+  - key: test
+    label: ":go: Test {{matrix.os}}"
+    command:
+      - go test ./...
+      - make lint
+    env:
+      SHARED: step
+      GOOS: "{{matrix.os}}"
+    plugins:
+      - docker#v5.12.0:
+          image: golang
+    artifact_paths:
+      - "coverage/*"
+      - report.xml
+    timeout_in_minutes: 10
+    parallelism: 3
+    matrix:
+      setup:
+        os: [linux, darwin]
+  - wait
+`
+
+func TestEnv(t *testing.T) {
+	t.Parallel()
+
+	p, err := pipeline.Parse(strings.NewReader(testEnvPipeline))
+	if err != nil {
+		t.Fatalf("pipeline.Parse(testEnvPipeline) error = %v", err)
+	}
+	build := &Build{
+		Branch:  "feature",
+		Commit:  "abc123",
+		Message: "Add things",
+		Number:  42,
+		Source:  "webhook",
+		PullRequest: &PullRequest{
+			ID:         "7",
+			BaseBranch: "main",
+			Repository: "git@github.com:fork/repo.git",
+			Labels:     []string{"docs", "go"},
+		},
+		Pipeline:     Pipeline{Slug: "repo", DefaultBranch: "main", Repository: "git@github.com:org/repo.git"},
+		Organization: "org",
+		Env:          map[string]string{"FROM_BUILD": "yes", "SHARED": "build"},
+	}
+	steps, err := Evaluate(p, build)
+	if err != nil {
+		t.Fatalf("Evaluate(p, build) error = %v", err)
+	}
+
+	got, err := Env(p, build, steps[1], 2)
+	if err != nil {
+		t.Fatalf("Env(p, build, steps[1], 2) error = %v", err)
+	}
+	want := map[string]string{
+		"FROM_BUILD":    "yes",
+		"FROM_PIPELINE": "1",
+		"SHARED":        "step",
+		"GOOS":          "darwin",
+
+		"BUILDKITE": "true",
+		"CI":        "true",
+
+		"BUILDKITE_BRANCH":                  "feature",
+		"BUILDKITE_TAG":                     "",
+		"BUILDKITE_COMMIT":                  "abc123",
+		"BUILDKITE_MESSAGE":                 "Add things",
+		"BUILDKITE_BUILD_NUMBER":            "42",
+		"BUILDKITE_SOURCE":                  "webhook",
+		"BUILDKITE_PIPELINE_SLUG":           "repo",
+		"BUILDKITE_PIPELINE_DEFAULT_BRANCH": "main",
+		"BUILDKITE_REPO":                    "git@github.com:org/repo.git",
+		"BUILDKITE_ORGANIZATION_SLUG":       "org",
+
+		"BUILDKITE_PULL_REQUEST":             "7",
+		"BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main",
+		"BUILDKITE_PULL_REQUEST_REPO":        "git@github.com:fork/repo.git",
+		"BUILDKITE_PULL_REQUEST_DRAFT":       "false",
+		"BUILDKITE_PULL_REQUEST_LABELS":      "docs,go",
+
+		"BUILDKITE_LABEL":              ":go: Test darwin",
+		"BUILDKITE_STEP_KEY":           "test",
+		"BUILDKITE_COMMAND":            "go test ./...\nmake lint",
+		"BUILDKITE_ARTIFACT_PATHS":     "coverage/*;report.xml",
+		"BUILDKITE_TIMEOUT":            "10",
+		"BUILDKITE_PLUGINS":            `[{"github.com/buildkite-plugins/docker-buildkite-plugin#v5.12.0":{"image":"golang"}}]`,
+		"BUILDKITE_PARALLEL_JOB":       "2",
+		"BUILDKITE_PARALLEL_JOB_COUNT": "3",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Env(p, build, steps[1], 2) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestEnv_NoPullRequest(t *testing.T) {
+	t.Parallel()
+
+	step := &Step{Path: "steps[0]", Step: &pipeline.CommandStep{Command: "true"}}
+	got, err := Env(&pipeline.Pipeline{}, &Build{Branch: "main"}, step, 0)
+	if err != nil {
+		t.Fatalf("Env(p, build, step, 0) error = %v", err)
+	}
+	for k, v := range map[string]string{
+		"BUILDKITE_PULL_REQUEST":       "false",
+		"BUILDKITE_PULL_REQUEST_DRAFT": "false",
+		"BUILDKITE_TIMEOUT":            "false",
+		"BUILDKITE_LABEL":              "",
+	} {
+		if got[k] != v {
+			t.Errorf("Env(p, build, step, 0)[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+	for _, k := range []string{"BUILDKITE_PLUGINS", "BUILDKITE_PARALLEL_JOB", "BUILDKITE_PARALLEL_JOB_COUNT"} {
+		if v, ok := got[k]; ok {
+			t.Errorf("Env(p, build, step, 0)[%q] = %q, want unset", k, v)
+		}
+	}
+}
+
+func TestEnv_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc        string
+		step        pipeline.Step
+		parallelJob int
+	}{
+		{
+			desc: "not a command step",
+			step: &pipeline.WaitStep{},
+		},
+		{
+			desc:        "no parallelism",
+			step:        &pipeline.CommandStep{Command: "true"},
+			parallelJob: 1,
+		},
+		{
+			desc:        "parallel job out of range",
+			step:        &pipeline.CommandStep{Command: "true", Parallelism: pipeline.NewInt(2)},
+			parallelJob: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			step := &Step{Path: "steps[0]", Step: test.step}
+			if _, err := Env(&pipeline.Pipeline{}, &Build{}, step, test.parallelJob); err == nil {
+				t.Errorf("Env(p, build, step, %d) error = nil, want an error", test.parallelJob)
+			}
+		})
+	}
+}
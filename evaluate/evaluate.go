@@ -0,0 +1,329 @@
+// Package evaluate simulates what a pipeline would do in a build: given a
+// parsed pipeline and a description of a build (its branch, environment,
+// meta-data, and so on), it produces the effective list of steps, with step
+// conditions (if) resolved, branch filters applied, command step matrices
+// expanded, and skipped steps marked. This is useful for previewing a change
+// to a pipeline, in CI or in an editor:
+//
+//	steps, err := evaluate.Evaluate(p, &evaluate.Build{Branch: "main"})
+//	if err != nil {
+//		return err
+//	}
+//	for _, s := range steps {
+//		if !s.Skipped {
+//			fmt.Println(s.Path, pipeline.StepKey(s.Step))
+//		}
+//	}
+//
+// Env then previews the environment variables (such as BUILDKITE_LABEL and
+// BUILDKITE_PARALLEL_JOB) that a job for one of the steps would run with.
+//
+// The pipeline is evaluated as written: it should be interpolated first (see
+// Pipeline.Interpolate) if it uses environment variables.
+package evaluate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/conditional"
+)
+
+// Step is a step of the pipeline as it would be in the build.
+type Step struct {
+	// Path locates the step in the pipeline, such as "steps[1].steps[0]".
+	// Each step expanded from a matrix has the path of the original step.
+	Path string
+
+	// Step is the step. For a command step with a matrix, it is a copy
+	// expanded for one permutation (see CommandStep.ExpandMatrix); other
+	// steps are those of the pipeline, and must not be modified.
+	Step pipeline.Step
+
+	// Permutation is the choice of matrix values for a command step expanded
+	// from a matrix, and nil otherwise.
+	Permutation pipeline.MatrixPermutation
+
+	// Skipped is true if the step wouldn't run in the build, and Reason says
+	// why, such as `skip: "flaky"` or `if: build.branch == "main"`.
+	Skipped bool
+	Reason  string
+
+	// WaitsForInput is true for block and input steps that would wait for
+	// someone to answer them, because the build's meta-data doesn't already
+	// have values for all their fields.
+	WaitsForInput bool
+}
+
+// Evaluate returns the steps of the pipeline as they would be in the build,
+// in order, including those within group steps (each group is followed by
+// its steps). Steps that wouldn't run are included, with Skipped set:
+//   - steps with skip set to true or a reason,
+//   - steps with branch filters that don't match the build's branch,
+//   - steps with conditions that are false for the build, and
+//   - the steps within skipped groups.
+//
+// Command steps with a matrix are replaced by a step for each permutation;
+// permutations skipped by the matrix's adjustments are omitted. Evaluate
+// returns an error if a condition can't be parsed or evaluated, as uploading
+// the pipeline would fail.
+func Evaluate(p *pipeline.Pipeline, b *Build) ([]*Step, error) {
+	ev := &evaluator{build: b, ctx: b.Context()}
+	if err := ev.steps(p.Steps, pipeline.StepPath{}, ""); err != nil {
+		return nil, err
+	}
+	return ev.out, nil
+}
+
+type evaluator struct {
+	build *Build
+	ctx   conditional.Context
+	out   []*Step
+}
+
+// steps evaluates the steps within the group at parent. If skipReason is not
+// empty, the group is skipped, and so are the steps.
+func (ev *evaluator) steps(steps pipeline.Steps, parent pipeline.StepPath, skipReason string) error {
+	for i, s := range steps {
+		sp := pipeline.StepPath{
+			Groups:  parent.Groups,
+			Indices: append(slices.Clone(parent.Indices), i),
+		}
+		path := sp.String()
+
+		if c, ok := s.(*pipeline.CommandStep); ok && !c.Matrix.IsEmpty() && skipReason == "" {
+			if err := ev.matrix(c, path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			continue
+		}
+
+		reason := skipReason
+		if reason == "" {
+			r, err := ev.skipReason(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			reason = r
+		}
+
+		switch s := s.(type) {
+
+		case *pipeline.GroupStep:
+			ev.add(&Step{Path: path, Step: s}, reason)
+			if reason != "" && skipReason == "" {
+				reason = "group " + path + " is skipped"
+			}
+			inner := pipeline.StepPath{
+				Groups:  append(slices.Clone(parent.Groups), s),
+				Indices: sp.Indices,
+			}
+			if err := ev.steps(s.Steps, inner, reason); err != nil {
+				return err
+			}
+
+		case *pipeline.InputStep:
+			ev.add(&Step{
+				Path:          path,
+				Step:          s,
+				WaitsForInput: reason == "" && !ev.answered(s),
+			}, reason)
+
+		default:
+			ev.add(&Step{Path: path, Step: s}, reason)
+		}
+	}
+	return nil
+}
+
+// matrix evaluates a command step with a matrix, by expanding it. The
+// conditions of each expanded step are checked separately, since they may
+// use the matrix.
+func (ev *evaluator) matrix(c *pipeline.CommandStep, path string) error {
+	exps, err := c.ExpandMatrix()
+	if err != nil {
+		return fmt.Errorf("expanding matrix: %w", err)
+	}
+	for _, exp := range exps {
+		reason, err := ev.skipReason(exp.Step)
+		if err != nil {
+			return fmt.Errorf("matrix permutation %v: %w", exp.Permutation, err)
+		}
+		ev.add(&Step{Path: path, Step: exp.Step, Permutation: exp.Permutation}, reason)
+	}
+	return nil
+}
+
+// add appends a step to the output, skipped if reason isn't empty.
+func (ev *evaluator) add(s *Step, reason string) {
+	s.Skipped = reason != ""
+	s.Reason = reason
+	ev.out = append(ev.out, s)
+}
+
+// skipReason returns why the step wouldn't run in the build, or the empty
+// string if it would: because of skip, branches, or if, checked in that
+// order.
+func (ev *evaluator) skipReason(s pipeline.Step) (string, error) {
+	if reason, ok := skipped(s); ok {
+		return reason, nil
+	}
+	if filter := branches(s); filter != "" && !MatchBranches(filter, ev.build.Branch) {
+		return fmt.Sprintf("branches: %q", filter), nil
+	}
+	cond := condition(s)
+	if cond == "" {
+		return "", nil
+	}
+	e, err := conditional.Parse(cond)
+	if err != nil {
+		return "", fmt.Errorf("parsing if: %w", err)
+	}
+	ok, err := conditional.EvalBool(e, ev.ctx)
+	if err != nil {
+		return "", fmt.Errorf("evaluating if: %w", err)
+	}
+	if !ok {
+		return "if: " + cond, nil
+	}
+	return "", nil
+}
+
+// answered reports whether the build's meta-data has values for all the
+// fields of a block or input step.
+func (ev *evaluator) answered(s *pipeline.InputStep) bool {
+	if len(s.Fields) == 0 {
+		return false
+	}
+	for _, f := range s.Fields {
+		if _, ok := ev.build.MetaData[f.FieldKey()]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// remainingFields returns the remaining fields of a step, where the
+// attributes not modelled by its type (such as if on a command step) are.
+func remainingFields(s pipeline.Step) map[string]any {
+	switch s := s.(type) {
+	case *pipeline.CommandStep:
+		return s.RemainingFields
+	case *pipeline.GroupStep:
+		return s.RemainingFields
+	case *pipeline.InputStep:
+		return s.RemainingFields
+	case *pipeline.TriggerStep:
+		return s.RemainingFields
+	case *pipeline.WaitStep:
+		return s.RemainingFields
+	default:
+		return nil
+	}
+}
+
+// skipped reports whether the step has skip set, and the reason. Buildkite
+// accepts true or a reason; false and the empty string don't skip.
+func skipped(s pipeline.Step) (string, bool) {
+	var skip any
+	if t, ok := s.(*pipeline.TriggerStep); ok {
+		skip = t.Skip
+	} else {
+		skip = remainingFields(s)["skip"]
+	}
+	switch skip := skip.(type) {
+	case bool:
+		if skip {
+			return "skip: true", true
+		}
+	case string:
+		if skip != "" {
+			return fmt.Sprintf("skip: %q", skip), true
+		}
+	}
+	return "", false
+}
+
+// branches returns the step's branch filter, with the patterns separated by
+// spaces. Buildkite also accepts a list of patterns.
+func branches(s pipeline.Step) string {
+	if t, ok := s.(*pipeline.TriggerStep); ok {
+		return t.Branches
+	}
+	switch b := remainingFields(s)["branches"].(type) {
+	case string:
+		return b
+	case []string:
+		return strings.Join(b, " ")
+	case []any:
+		patterns := make([]string, 0, len(b))
+		for _, p := range b {
+			if p, ok := p.(string); ok {
+				patterns = append(patterns, p)
+			}
+		}
+		return strings.Join(patterns, " ")
+	default:
+		return ""
+	}
+}
+
+// condition returns the step's condition (if), or the empty string.
+func condition(s pipeline.Step) string {
+	switch s := s.(type) {
+	case *pipeline.WaitStep:
+		return s.If
+	case *pipeline.InputStep:
+		return s.If
+	}
+	cond, _ := remainingFields(s)["if"].(string)
+	return cond
+}
+
+// MatchBranches reports whether a branch matches a branch filter, as in the
+// branches attribute of steps. The filter is a list of patterns separated by
+// spaces. In each, * matches any sequence of characters (including /), and a
+// leading ! negates the pattern. The branch matches if it matches none of
+// the negated patterns, and either matches one of the other patterns or
+// there are none. For example, "main release/* !release/old-*" matches main
+// and release/2.0, but not release/old-1.0 or feature/x.
+func MatchBranches(filter, branch string) bool {
+	positive, matched := false, false
+	for _, pat := range strings.Fields(filter) {
+		if neg, ok := strings.CutPrefix(pat, "!"); ok {
+			if globMatch(neg, branch) {
+				return false
+			}
+			continue
+		}
+		positive = true
+		if globMatch(pat, branch) {
+			matched = true
+		}
+	}
+	return matched || !positive
+}
+
+// globMatch reports whether s matches pattern, in which * matches any
+// sequence of characters.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	first, last := parts[0], parts[len(parts)-1]
+	if !strings.HasPrefix(s, first) || len(s) < len(first)+len(last) {
+		return false
+	}
+	s = s[len(first):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
@@ -0,0 +1,252 @@
+package evaluate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/conditional"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testEvaluatePipeline = `---
+steps:
+  - key: test
+    command: make test
+  - key: flaky
+    command: make flaky
+    skip: "too flaky"
+  - key: release
+    command: make release
+    branches: "main release/* !release/old-*"
+  - key: deploy
+    command: make deploy
+    if: build.branch == pipeline.default_branch && build.env("DEPLOY") == "1"
+  - key: cross
+    command: make GOOS={{matrix.os}}
+    if: build.pull_request.id == null || "{{matrix.os}}" == "linux"
+    matrix:
+      setup:
+        os: [linux, darwin, windows]
+      adjustments:
+        - with: { os: windows }
+          skip: true
+  - wait: ~
+    if: build.tag != null
+  - block: Ship it?
+    key: ship
+    fields:
+      - text: Version
+        key: version
+  - group: Docs
+    key: docs
+    if: build.pull_request.labels includes "docs"
+    steps:
+      - key: docs-build
+        command: make docs
+  - trigger: downstream
+    key: downstream
+    branches: main
+`
+
+// evaluated is the parts of a Step that the tests compare.
+type evaluated struct {
+	Path          string
+	Key           string
+	Permutation   pipeline.MatrixPermutation
+	Reason        string
+	WaitsForInput bool
+}
+
+func summarise(steps []*Step) []evaluated {
+	out := make([]evaluated, 0, len(steps))
+	for _, s := range steps {
+		if s.Skipped != (s.Reason != "") {
+			panic("Skipped and Reason disagree")
+		}
+		out = append(out, evaluated{
+			Path:          s.Path,
+			Key:           pipeline.StepKey(s.Step),
+			Permutation:   s.Permutation,
+			Reason:        s.Reason,
+			WaitsForInput: s.WaitsForInput,
+		})
+	}
+	return out
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	p, err := pipeline.Parse(strings.NewReader(testEvaluatePipeline))
+	if err != nil {
+		t.Fatalf("pipeline.Parse(testEvaluatePipeline) error = %v", err)
+	}
+
+	tests := []struct {
+		desc  string
+		build *Build
+		want  []evaluated
+	}{
+		{
+			desc: "main branch",
+			build: &Build{
+				Branch:   "main",
+				Pipeline: Pipeline{DefaultBranch: "main"},
+				Env:      map[string]string{"DEPLOY": "1"},
+			},
+			want: []evaluated{
+				{Path: "steps[0]", Key: "test"},
+				{Path: "steps[1]", Key: "flaky", Reason: `skip: "too flaky"`},
+				{Path: "steps[2]", Key: "release"},
+				{Path: "steps[3]", Key: "deploy"},
+				{Path: "steps[4]", Key: "cross", Permutation: pipeline.MatrixPermutation{"os": "linux"}},
+				{Path: "steps[4]", Key: "cross", Permutation: pipeline.MatrixPermutation{"os": "darwin"}},
+				{Path: "steps[5]", Reason: "if: build.tag != null"},
+				{Path: "steps[6]", Key: "ship", WaitsForInput: true},
+				{Path: "steps[7]", Key: "docs", Reason: `if: build.pull_request.labels includes "docs"`},
+				{Path: "steps[7].steps[0]", Key: "docs-build", Reason: "group steps[7] is skipped"},
+				{Path: "steps[8]", Key: "downstream"},
+			},
+		},
+		{
+			desc: "pull request",
+			build: &Build{
+				Branch:      "release/old-1.0",
+				Tag:         "v1.0.1",
+				Pipeline:    Pipeline{DefaultBranch: "main"},
+				PullRequest: &PullRequest{ID: "42", Labels: []string{"docs"}},
+				MetaData:    map[string]string{"version": "1.0.1"},
+			},
+			want: []evaluated{
+				{Path: "steps[0]", Key: "test"},
+				{Path: "steps[1]", Key: "flaky", Reason: `skip: "too flaky"`},
+				{Path: "steps[2]", Key: "release", Reason: `branches: "main release/* !release/old-*"`},
+				{Path: "steps[3]", Key: "deploy", Reason: `if: build.branch == pipeline.default_branch && build.env("DEPLOY") == "1"`},
+				{Path: "steps[4]", Key: "cross", Permutation: pipeline.MatrixPermutation{"os": "linux"}},
+				{Path: "steps[4]", Key: "cross", Permutation: pipeline.MatrixPermutation{"os": "darwin"}, Reason: `if: build.pull_request.id == null || "darwin" == "linux"`},
+				{Path: "steps[5]"},
+				{Path: "steps[6]", Key: "ship"},
+				{Path: "steps[7]", Key: "docs"},
+				{Path: "steps[7].steps[0]", Key: "docs-build"},
+				{Path: "steps[8]", Key: "downstream", Reason: `branches: "main"`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Evaluate(p, test.build)
+			if err != nil {
+				t.Fatalf("Evaluate(p, %+v) error = %v", test.build, err)
+			}
+			if diff := cmp.Diff(summarise(got), test.want); diff != "" {
+				t.Errorf("Evaluate(p, %+v) diff (-got +want):\n%s", test.build, diff)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpandsMatrixCopies(t *testing.T) {
+	t.Parallel()
+
+	p, err := pipeline.Parse(strings.NewReader(testEvaluatePipeline))
+	if err != nil {
+		t.Fatalf("pipeline.Parse(testEvaluatePipeline) error = %v", err)
+	}
+	got, err := Evaluate(p, &Build{Branch: "main"})
+	if err != nil {
+		t.Fatalf("Evaluate(p, main) error = %v", err)
+	}
+	for _, s := range got {
+		if s.Permutation == nil {
+			continue
+		}
+		c := s.Step.(*pipeline.CommandStep)
+		if want := "make GOOS=" + s.Permutation["os"]; c.Command != want {
+			t.Errorf("expanded step %v Command = %q, want %q", s.Permutation, c.Command, want)
+		}
+	}
+	if orig := p.Steps[4].(*pipeline.CommandStep); orig.Matrix == nil {
+		t.Errorf("Evaluate modified the original step's matrix")
+	}
+}
+
+func TestEvaluateConditionErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc    string
+		yaml    string
+		wantErr error
+	}{
+		{
+			desc: "syntax error",
+			yaml: "steps:\n  - command: x\n    if: build.branch ==\n",
+		},
+		{
+			desc:    "not a boolean",
+			yaml:    "steps:\n  - wait: ~\n    if: build.branch\n",
+			wantErr: conditional.ErrType,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := pipeline.Parse(strings.NewReader(test.yaml))
+			if err != nil {
+				t.Fatalf("pipeline.Parse(%q) error = %v", test.yaml, err)
+			}
+			_, err = Evaluate(p, &Build{Branch: "main"})
+			if err == nil {
+				t.Fatalf("Evaluate(p, main) error = nil, want an error")
+			}
+			if !strings.HasPrefix(err.Error(), "steps[0]: ") {
+				t.Errorf("Evaluate(p, main) error = %q, want it to start with the step's path", err)
+			}
+			var syntaxErr *conditional.SyntaxError
+			if test.wantErr == nil && !errors.As(err, &syntaxErr) {
+				t.Errorf("Evaluate(p, main) error = %v, want a *conditional.SyntaxError", err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("Evaluate(p, main) error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchBranches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		filter, branch string
+		want           bool
+	}{
+		{filter: "", branch: "main", want: true},
+		{filter: "main", branch: "main", want: true},
+		{filter: "main", branch: "mainline", want: false},
+		{filter: "main develop", branch: "develop", want: true},
+		{filter: "release/*", branch: "release/2.0/hotfix", want: true},
+		{filter: "*-stable", branch: "3-stable", want: true},
+		{filter: "*-stable", branch: "stable", want: false},
+		{filter: "feature/*-wip", branch: "feature/x-wip", want: true},
+		{filter: "a*b*a", branch: "aba", want: true},
+		{filter: "a*b*a", branch: "ab", want: false},
+		{filter: "!main", branch: "main", want: false},
+		{filter: "!main", branch: "develop", want: true},
+		{filter: "release/* !release/old-*", branch: "release/old-1", want: false},
+		{filter: "release/* !release/old-*", branch: "release/2", want: true},
+		{filter: "release/* !release/old-*", branch: "main", want: false},
+	}
+
+	for _, test := range tests {
+		if got := MatchBranches(test.filter, test.branch); got != test.want {
+			t.Errorf("MatchBranches(%q, %q) = %t, want %t", test.filter, test.branch, got, test.want)
+		}
+	}
+}
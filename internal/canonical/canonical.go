@@ -0,0 +1,23 @@
+// Package canonical encodes values as canonical JSON, for signing and hashing.
+package canonical
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gowebpki/jcs"
+)
+
+// JSON marshals v to JSON, and then canonicalises it using JCS (RFC 8785), so
+// that equal values always produce the same sequence of bytes.
+func JSON(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling JSON: %w", err)
+	}
+	out, err := jcs.Transform(raw)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalising JSON: %w", err)
+	}
+	return out, nil
+}
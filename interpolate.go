@@ -1,6 +1,10 @@
 package pipeline
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/buildkite/go-pipeline/ordered"
 	"github.com/buildkite/interpolate"
 )
@@ -13,15 +17,224 @@ type stringTransformer interface {
 	Transform(string) (string, error)
 }
 
+// Errors that can be returned while interpolating env keys (wrapped - use
+// errors.Is).
+var (
+	ErrEnvKeyInterpolationDisallowed = errors.New("interpolation in env keys is disallowed")
+	ErrInvalidEnvKey                 = errors.New("invalid env key")
+)
+
+// ErrVariableNotSet is returned (wrapped - use errors.Is) when interpolating
+// with InterpolateStrict and a referenced variable is unset.
+var ErrVariableNotSet = errors.New("not set")
+
+// InterpolateOption configures Pipeline.Interpolate.
+type InterpolateOption func(*interpolateConfig)
+
+type interpolateConfig struct {
+	disallowEnvKeyInterpolation bool
+	errorsAsWarnings            bool
+	strict                      bool
+
+	// skip contains the paths of step fields not to interpolate (see
+	// SkipInterpolation).
+	skip [][]string
+
+	// report receives the substitutions made (see RecordSubstitutions).
+	report *[]Substitution
+
+	// secrets receives the values of variables matching secretNames (see
+	// WithValueRedactor).
+	secretNames []string
+	secrets     *[]string
+}
+
+// DisallowEnvKeyInterpolation causes Interpolate to return an error wrapping
+// ErrEnvKeyInterpolationDisallowed if the key of any env var (in the pipeline
+// env block or a command step env) contains a "$", instead of interpolating
+// it. This prevents the names of variables from being controlled by the
+// runtime environment.
+func DisallowEnvKeyInterpolation() InterpolateOption {
+	return func(cfg *interpolateConfig) {
+		cfg.disallowEnvKeyInterpolation = true
+	}
+}
+
+// InterpolationErrorsAsWarnings causes Interpolate to carry on past strings
+// that fail to interpolate (due to bad syntax, ${FOO?error}, invalid env keys,
+// and so on), leaving them unaltered. The problems are returned together as a
+// warning (see the warning package), with one error per string. This is
+// intended for best-effort output, such as previews in an editor.
+func InterpolationErrorsAsWarnings() InterpolateOption {
+	return func(cfg *interpolateConfig) {
+		cfg.errorsAsWarnings = true
+	}
+}
+
+// InterpolateStrict causes Interpolate to return an error wrapping
+// ErrVariableNotSet when a string references a variable that is unset, instead
+// of substituting an empty string. Expansions that supply a default (such as
+// ${FOO:-default} or ${FOO-default}) are still allowed, and escaped variables
+// ($$FOO) are not checked. Variables that are set to an empty string are not
+// an error.
+func InterpolateStrict() InterpolateOption {
+	return func(cfg *interpolateConfig) {
+		cfg.strict = true
+	}
+}
+
 // envInterpolator returns a reusable string transform that replaces
 // variables (${FOO}) with their values from a map.
 type envInterpolator struct {
 	env interpolate.Env
+
+	// noEnvKeys disables interpolation of env keys (see transformEnvKey).
+	noEnvKeys bool
+
+	// strict causes references to unset variables to fail (see
+	// InterpolateStrict).
+	strict bool
+
+	// If warns is not nil, errors are appended to it instead of being
+	// returned, and the string that failed is returned unaltered.
+	warns *[]error
+
+	// If subs is not nil, the variables substituted into each string are
+	// recorded in it.
+	subs *substitutionRecorder
+
+	// If secrets is not nil, the values of secret variables substituted
+	// into each string are recorded in it.
+	secrets *secretRecorder
 }
 
 // Transform calls interpolate.Interpolate to transform the string.
 func (e envInterpolator) Transform(s string) (string, error) {
-	return interpolate.Interpolate(e.env, s)
+	out, err := e.interpolate(s)
+	if err != nil {
+		return e.recover(s, &InterpolationError{
+			StepIndex: -1,
+			Variable:  variableOf(err),
+			Value:     s,
+			Err:       fmt.Errorf("interpolating %q: %w", s, err),
+		})
+	}
+	return out, nil
+}
+
+// interpolate expands the variables in s. This is interpolate.Interpolate,
+// except that in strict mode plain variable expansions must refer to set
+// variables, and the variables used are recorded if subs or secrets is not nil.
+func (e envInterpolator) interpolate(s string) (string, error) {
+	env := e.env
+	var rec *recordingEnv
+	if e.subs != nil || e.secrets != nil {
+		rec = &recordingEnv{Env: env}
+		env = rec
+	}
+
+	var out string
+	var err error
+	if e.strict {
+		var expr interpolate.Expression
+		expr, err = interpolate.NewParser(s).Parse()
+		if err == nil {
+			out, err = strictExpression(expr).Expand(env)
+		}
+	} else {
+		out, err = interpolate.Interpolate(env, s)
+	}
+	if err != nil {
+		return "", err
+	}
+	if rec != nil {
+		e.subs.add(out, rec)
+		e.secrets.add(rec)
+	}
+	return out, nil
+}
+
+// strictExpression returns a copy of expr where every expansion that would
+// silently expand an unset variable to an empty string instead fails. Default
+// values and error messages are expanded lazily, so they are made strict too.
+func strictExpression(expr interpolate.Expression) interpolate.Expression {
+	out := make(interpolate.Expression, len(expr))
+	for i, item := range expr {
+		switch x := item.Expansion.(type) {
+		case interpolate.VariableExpansion:
+			item.Expansion = strictExpansion{Expansion: x, identifier: x.Identifier}
+
+		case interpolate.SubstringExpansion:
+			item.Expansion = strictExpansion{Expansion: x, identifier: x.Identifier}
+
+		case interpolate.EmptyValueExpansion:
+			x.Content = strictExpression(x.Content)
+			item.Expansion = x
+
+		case interpolate.UnsetValueExpansion:
+			x.Content = strictExpression(x.Content)
+			item.Expansion = x
+
+		case interpolate.RequiredExpansion:
+			x.Message = strictExpression(x.Message)
+			item.Expansion = x
+		}
+		out[i] = item
+	}
+	return out
+}
+
+// strictExpansion wraps an expansion of a variable, and fails if the variable
+// is unset.
+type strictExpansion struct {
+	interpolate.Expansion
+	identifier string
+}
+
+func (e strictExpansion) Expand(env interpolate.Env) (string, error) {
+	if _, ok := env.Get(e.identifier); !ok {
+		return "", fmt.Errorf("$%s: %w", e.identifier, ErrVariableNotSet)
+	}
+	return e.Expansion.Expand(env)
+}
+
+// recover either returns err, or if errors are being treated as warnings,
+// records err and returns s unaltered.
+func (e envInterpolator) recover(s string, err error) (string, error) {
+	if e.warns == nil {
+		return "", err
+	}
+	*e.warns = append(*e.warns, err)
+	return s, nil
+}
+
+// transformEnvKey interpolates the key of an env var. Keys support the same
+// expansion syntax as values (including ${FOO:-default} and ${FOO?error}),
+// but the result must be usable as a variable name: non-empty, and without
+// "=" or NUL.
+func (e envInterpolator) transformEnvKey(k string) (string, error) {
+	keyErr := func(variable string, err error) (string, error) {
+		return e.recover(k, &InterpolationError{StepIndex: -1, Variable: variable, Value: k, Err: err})
+	}
+
+	if e.noEnvKeys {
+		if strings.Contains(k, "$") {
+			return keyErr("", fmt.Errorf("%w: %q", ErrEnvKeyInterpolationDisallowed, k))
+		}
+		return k, nil
+	}
+
+	intk, err := e.interpolate(k)
+	if err != nil {
+		return keyErr(variableOf(err), fmt.Errorf("env key %q: %w", k, err))
+	}
+	switch {
+	case intk == "":
+		return keyErr("", fmt.Errorf("%w: %q interpolated to an empty string", ErrInvalidEnvKey, k))
+	case strings.ContainsAny(intk, "=\x00"):
+		return keyErr("", fmt.Errorf("%w: %q interpolated to %q, which contains \"=\" or NUL", ErrInvalidEnvKey, k, intk))
+	}
+	return intk, nil
 }
 
 // selfInterpolater describes types that can interpolate themselves in-place.
@@ -148,10 +361,30 @@ func interpolateMap[K comparable, V any, M ~map[K]V](tf stringTransformer, m M)
 	return nil
 }
 
+// interpolateEnvMap interpolates the keys (with transformEnvKey) and values
+// of an env map. The map is altered in-place.
+func interpolateEnvMap(e envInterpolator, m map[string]string) error {
+	for k, v := range m {
+		intk, err := e.transformEnvKey(k)
+		if err != nil {
+			return err
+		}
+		intv, err := e.Transform(v)
+		if err != nil {
+			return err
+		}
+		if k != intk {
+			delete(m, k)
+		}
+		m[intk] = intv
+	}
+	return nil
+}
+
 // interpolateOrderedMap applies interpolateAny over any type of ordered.Map.
 // The map is altered in-place.
 func interpolateOrderedMap[K comparable, V any](tf stringTransformer, m *ordered.Map[K, V]) error {
-	return m.Range(func(k K, v V) error {
+	for k, v := range m.All() {
 		// We interpolate both keys and values.
 		intk, err := interpolateAny(tf, k)
 		if err != nil {
@@ -163,6 +396,6 @@ func interpolateOrderedMap[K comparable, V any](tf stringTransformer, m *ordered
 		}
 
 		m.Replace(k, intk, intv)
-		return nil
-	})
+	}
+	return nil
 }
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// InterpolationError is the error (possibly wrapped - use errors.As) for a
+// string that failed to interpolate, such as one referring to an unset
+// variable with ${FOO?}, or with bad syntax. Interpolate fills in where in the
+// pipeline the string was found.
+type InterpolationError struct {
+	// Field is the path to the field containing the string, such as "command"
+	// or "env.FOO", relative to the step at StepIndex (or to the pipeline, if
+	// StepIndex is -1). Fields within group steps are paths such as
+	// "steps[1].command". Field is empty if it couldn't be determined.
+	Field string
+
+	// StepIndex is the index of the step within the pipeline's steps, or -1
+	// if the string is not within a step (for example, it is in the pipeline
+	// env block).
+	StepIndex int
+
+	// Variable is the name of the variable that caused the failure, if there
+	// was one (syntax errors are not caused by a particular variable).
+	Variable string
+
+	// Value is the string that failed to interpolate.
+	Value string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the underlying error's message.
+func (e *InterpolationError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *InterpolationError) Unwrap() error { return e.Err }
+
+// variableOf returns the name of the variable that caused err, an error from
+// interpolate.Interpolate, or "" if there isn't one. The only such error has a
+// message of the form "$FOO: message".
+func variableOf(err error) string {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "$") {
+		return ""
+	}
+	name, _, _ := strings.Cut(msg[1:], ":")
+	return name
+}
+
+// locateInterpolationError fills in the location of an InterpolationError
+// within err, if there is one (and it hasn't already been located). The
+// field is found by looking for the string that failed within x, a step or
+// map, which is possible because strings that fail are left unaltered.
+func locateInterpolationError(err error, stepIndex int, x any) {
+	var ie *InterpolationError
+	if !errors.As(err, &ie) || ie.Field != "" {
+		return
+	}
+	ie.StepIndex = stepIndex
+	ie.Field = fieldContaining(x, ie.Value)
+}
+
+// fieldContaining returns the path to the first field within x, a step or
+// map, that is the string s or is a map item with s as its key. It returns ""
+// if there is no such field.
+func fieldContaining(x any, s string) string {
+	g, err := toGeneric(x)
+	if err != nil {
+		return ""
+	}
+	quoted, _ := json.Marshal(s)
+	for _, f := range flattenFields(g) {
+		if f.value == string(quoted) || f.path == s || strings.HasSuffix(f.path, "."+s) {
+			return f.path
+		}
+	}
+	return ""
+}
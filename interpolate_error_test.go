@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestInterpolationError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc  string
+		input string
+		opts  []InterpolateOption
+		want  []*InterpolationError
+	}{
+		{
+			desc: "unset required variable in command",
+			input: `steps:
+  - command: make
+  - label: Deploy
+    command: deploy ${TARGET?}
+`,
+			want: []*InterpolationError{{
+				Field:     "command",
+				StepIndex: 1,
+				Variable:  "TARGET",
+				Value:     "deploy ${TARGET?}",
+			}},
+		},
+		{
+			desc: "bad syntax in pipeline env",
+			input: `env:
+  GREETING: "hello ${NAME"
+steps:
+  - command: make
+`,
+			want: []*InterpolationError{{
+				Field:     "env.GREETING",
+				StepIndex: -1,
+				Value:     "hello ${NAME",
+			}},
+		},
+		{
+			desc: "disallowed env key in a group",
+			input: `steps:
+  - group: Tests
+    steps:
+      - command: make
+      - command: make test
+        env:
+          $KEY: value
+`,
+			opts: []InterpolateOption{DisallowEnvKeyInterpolation()},
+			want: []*InterpolationError{{
+				Field:     "steps[1].env.$KEY",
+				StepIndex: 0,
+				Value:     "$KEY",
+			}},
+		},
+		{
+			desc: "as warnings",
+			input: `steps:
+  - command: echo ${A?}
+  - trigger: ${B?}
+`,
+			opts: []InterpolateOption{InterpolationErrorsAsWarnings()},
+			want: []*InterpolationError{
+				{Field: "command", StepIndex: 0, Variable: "A", Value: "echo ${A?}"},
+				{Field: "trigger", StepIndex: 1, Variable: "B", Value: "${B?}"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+			err = p.Interpolate(nil, false, test.opts...)
+			if err == nil {
+				t.Fatalf("p.Interpolate(nil, false, opts...) error = nil, want an error")
+			}
+
+			// Collect the InterpolationErrors in the tree.
+			var got []*InterpolationError
+			var collect func(error)
+			collect = func(err error) {
+				var ie *InterpolationError
+				if errors.As(err, &ie) && err == error(ie) {
+					got = append(got, ie)
+					return
+				}
+				switch err := err.(type) {
+				case interface{ Unwrap() []error }:
+					for _, e := range err.Unwrap() {
+						collect(e)
+					}
+				case interface{ Unwrap() error }:
+					collect(err.Unwrap())
+				}
+			}
+			collect(err)
+
+			if diff := cmp.Diff(got, test.want, cmpopts.IgnoreFields(InterpolationError{}, "Err")); diff != "" {
+				t.Errorf("InterpolationErrors diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
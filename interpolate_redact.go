@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+)
+
+// WithValueRedactor causes Interpolate to append to secrets the value of every
+// variable whose name matches one of secretNames (patterns, as for
+// path.Match, such as "*_TOKEN") that it substitutes into the pipeline. Each
+// value is appended once, and empty values are not appended. Callers can then
+// register the values with their log redaction before the pipeline is run,
+// since they now appear in the pipeline itself. Interpolate returns an error
+// if any of secretNames is not a valid pattern.
+func WithValueRedactor(secretNames []string, secrets *[]string) InterpolateOption {
+	return func(cfg *interpolateConfig) {
+		cfg.secretNames = secretNames
+		cfg.secrets = secrets
+	}
+}
+
+// checkSecretNames reports an error if any of the secret name patterns are
+// invalid.
+func (cfg *interpolateConfig) checkSecretNames() error {
+	for _, name := range cfg.secretNames {
+		if _, err := path.Match(name, ""); err != nil {
+			return fmt.Errorf("secret name %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// secretRecorder collects the values of secret variables as strings are
+// interpolated.
+type secretRecorder struct {
+	names  []string
+	values *[]string
+	seen   map[string]bool
+}
+
+// add records the values of the secret variables looked up while
+// interpolating a string. r may be nil, in which case add does nothing.
+func (r *secretRecorder) add(env *recordingEnv) {
+	if r == nil {
+		return
+	}
+	for _, l := range env.lookups {
+		if l.value == "" || r.seen[l.value] || !isSecretName(l.name, r.names) {
+			continue
+		}
+		r.seen[l.value] = true
+		*r.values = append(*r.values, l.value)
+	}
+}
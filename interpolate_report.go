@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/buildkite/interpolate"
+)
+
+// Substitution records a variable that Interpolate substituted into the
+// pipeline.
+type Substitution struct {
+	// Path is the path to the field the variable was substituted into, such
+	// as "env.FOO", "steps[1].command", or "steps[0].steps[2].label". It is
+	// empty if it couldn't be determined.
+	Path string
+
+	// Variable is the name of the variable.
+	Variable string
+
+	// MaskedValue stands in for the value of the variable, which could be
+	// secret. It is empty if the value was empty, and otherwise "sha256:"
+	// followed by the first 16 hex digits of the SHA-256 digest of the value.
+	// This is enough to tell whether a variable had the same value in two
+	// builds, without revealing it.
+	MaskedValue string
+}
+
+// RecordSubstitutions causes Interpolate to append a Substitution to report
+// for every variable it substitutes into the pipeline (once per variable per
+// string), in the order they happen. Variables that are referenced but unset
+// are not recorded.
+func RecordSubstitutions(report *[]Substitution) InterpolateOption {
+	return func(cfg *interpolateConfig) {
+		cfg.report = report
+	}
+}
+
+// maskValue masks the value of a variable for a Substitution.
+func maskValue(v string) string {
+	if v == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(v))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// substitutionRecorder collects substitutions as strings are interpolated,
+// and adds them to the report once it is known where the strings are.
+type substitutionRecorder struct {
+	report  *[]Substitution
+	pending []pendingSubstitution
+}
+
+// pendingSubstitution is a substitution into a string that has not been
+// located yet.
+type pendingSubstitution struct {
+	result   string // the interpolated string
+	variable string
+	value    string
+}
+
+// add records the variables looked up while interpolating a string into
+// result. r may be nil, in which case add does nothing.
+func (r *substitutionRecorder) add(result string, env *recordingEnv) {
+	if r == nil {
+		return
+	}
+	seen := make(map[string]bool, len(env.lookups))
+	for _, l := range env.lookups {
+		if seen[l.name] {
+			continue
+		}
+		seen[l.name] = true
+		r.pending = append(r.pending, pendingSubstitution{result: result, variable: l.name, value: l.value})
+	}
+}
+
+// flush locates the pending substitutions within x, a step or map at path
+// prefix within the pipeline, and adds them to the report. r may be nil, in
+// which case flush does nothing.
+func (r *substitutionRecorder) flush(prefix string, x any) {
+	if r == nil {
+		return
+	}
+	for _, ps := range r.pending {
+		path := fieldContaining(x, ps.result)
+		if path != "" {
+			path = joinPath(prefix, path)
+		}
+		*r.report = append(*r.report, Substitution{
+			Path:        path,
+			Variable:    ps.variable,
+			MaskedValue: maskValue(ps.value),
+		})
+	}
+	r.pending = nil
+}
+
+// recordingEnv records the variables that are set when they are looked up.
+type recordingEnv struct {
+	interpolate.Env
+	lookups []lookup
+}
+
+type lookup struct {
+	name, value string
+}
+
+// Get gets the variable from the underlying env, and records it if it is set.
+func (e *recordingEnv) Get(name string) (string, bool) {
+	v, ok := e.Env.Get(name)
+	if ok {
+		e.lookups = append(e.lookups, lookup{name: name, value: v})
+	}
+	return v, ok
+}
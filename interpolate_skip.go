@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// SkipInterpolation causes Interpolate to leave the selected step fields
+// alone, so that (for example) variables in commands are expanded by the
+// shell at job runtime rather than when the pipeline is uploaded. Each
+// selector is the name of a field within a step, such as "command" or "if",
+// or a dot-separated path to a field within it, such as "env.PATH" or
+// "build.message". Selectors apply to every step, including steps within
+// groups. Strings within skipped fields are never interpolated, so they can't
+// cause interpolation errors either.
+func SkipInterpolation(selectors ...string) InterpolateOption {
+	return func(cfg *interpolateConfig) {
+		for _, s := range selectors {
+			if s != "" {
+				cfg.skip = append(cfg.skip, strings.Split(s, "."))
+			}
+		}
+	}
+}
+
+// interpolateStep interpolates a step, apart from the fields selected with
+// SkipInterpolation, and returns the result. Without any selected fields, the
+// step is interpolated in-place and returned. Otherwise, each string within
+// the selected fields is hidden behind a placeholder that interpolation won't
+// alter, and a new step with the original strings is returned.
+func (cfg *interpolateConfig) interpolateStep(tf stringTransformer, s Step) (Step, error) {
+	if len(cfg.skip) == 0 {
+		return s, s.interpolate(tf)
+	}
+
+	g, err := toGeneric(s)
+	if err != nil {
+		return s, fmt.Errorf("skipping interpolation: %w", err)
+	}
+	h := &fieldHider{hidden: make(map[string]string)}
+	h.hideStep(g, cfg.skip)
+	if len(h.hidden) == 0 {
+		return s, s.interpolate(tf)
+	}
+
+	hs, err := stepFromGeneric(g)
+	if err != nil {
+		return s, err
+	}
+	if err := hs.interpolate(tf); err != nil {
+		return s, err
+	}
+	g, err = toGeneric(hs)
+	if err != nil {
+		return s, fmt.Errorf("skipping interpolation: %w", err)
+	}
+	return stepFromGeneric(h.reveal(g))
+}
+
+// stepFromGeneric unmarshals a step from its generic form. The step was
+// already parsed once, so warnings are not reported again.
+func stepFromGeneric(g any) (Step, error) {
+	s, err := unmarshalStep(g)
+	if err != nil && s == nil {
+		return nil, fmt.Errorf("skipping interpolation: %w", err)
+	}
+	return s, nil
+}
+
+// fieldHider replaces strings in the generic form of steps with placeholders,
+// and later puts them back.
+type fieldHider struct {
+	// hidden maps placeholders to the strings they replaced.
+	hidden map[string]string
+}
+
+// hideStep hides the fields of the step g selected by paths, and those of any
+// steps within it.
+func (h *fieldHider) hideStep(g any, paths [][]string) {
+	m, ok := g.(*ordered.MapSA)
+	if !ok {
+		return
+	}
+	for _, path := range paths {
+		h.hidePath(m, path)
+	}
+	if steps, ok := m.Get("steps"); ok {
+		if steps, ok := steps.([]any); ok {
+			for _, s := range steps {
+				h.hideStep(s, paths)
+			}
+		}
+	}
+}
+
+// hidePath hides everything at path within m.
+func (h *fieldHider) hidePath(m *ordered.MapSA, path []string) {
+	v, ok := m.Get(path[0])
+	if !ok {
+		return
+	}
+	if len(path) > 1 {
+		if vm, ok := v.(*ordered.MapSA); ok {
+			h.hidePath(vm, path[1:])
+		}
+		return
+	}
+	m.Set(path[0], h.hide(v))
+}
+
+// hide replaces all the strings within v (including mapping keys) with
+// placeholders.
+func (h *fieldHider) hide(v any) any {
+	switch v := v.(type) {
+	case string:
+		// Placeholders contain neither "$" nor "\", so interpolation leaves
+		// them alone.
+		p := fmt.Sprintf("\x00skipped %d\x00", len(h.hidden))
+		h.hidden[p] = v
+		return p
+
+	case []any:
+		for i, e := range v {
+			v[i] = h.hide(e)
+		}
+		return v
+
+	case *ordered.MapSA:
+		out := ordered.NewMap[string, any](v.Len())
+		for k, e := range v.All() {
+			out.Set(h.hide(k).(string), h.hide(e))
+		}
+		return out
+
+	default:
+		return v
+	}
+}
+
+// reveal replaces the placeholders within v with the original strings.
+func (h *fieldHider) reveal(v any) any {
+	switch v := v.(type) {
+	case string:
+		if s, ok := h.hidden[v]; ok {
+			return s
+		}
+		return v
+
+	case []any:
+		for i, e := range v {
+			v[i] = h.reveal(e)
+		}
+		return v
+
+	case *ordered.MapSA:
+		out := ordered.NewMap[string, any](v.Len())
+		for k, e := range v.All() {
+			out.Set(h.reveal(k).(string), h.reveal(e))
+		}
+		return out
+
+	default:
+		return v
+	}
+}
@@ -1,10 +1,14 @@
 package pipeline
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/buildkite/go-pipeline/internal/env"
 	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
 	"gotest.tools/v3/assert"
 )
 
@@ -296,3 +300,446 @@ func TestInterpolator(t *testing.T) {
 		})
 	}
 }
+
+func TestInterpolateEnvKeys(t *testing.T) {
+	t.Parallel()
+
+	runtimeEnv := map[string]string{"PREFIX": "APP"}
+
+	tests := []struct {
+		desc     string
+		env      *ordered.MapSS
+		stepEnv  map[string]string
+		opts     []InterpolateOption
+		wantEnv  *ordered.MapSS
+		wantStep map[string]string
+		wantErr  error
+	}{
+		{
+			desc: "default and required expansions",
+			env: ordered.MapFromItems(
+				ordered.TupleSS{Key: "${PREFIX?prefix is required}_NAME", Value: "a"},
+				ordered.TupleSS{Key: "${MISSING:-FALLBACK}_NAME", Value: "b"},
+			),
+			stepEnv: map[string]string{"${PREFIX:-X}_STEP": "c"},
+			wantEnv: ordered.MapFromItems(
+				ordered.TupleSS{Key: "APP_NAME", Value: "a"},
+				ordered.TupleSS{Key: "FALLBACK_NAME", Value: "b"},
+			),
+			wantStep: map[string]string{"APP_STEP": "c"},
+		},
+		{
+			desc: "required expansion in pipeline env key",
+			env: ordered.MapFromItems(
+				ordered.TupleSS{Key: "${MISSING?must be set}", Value: "a"},
+			),
+		},
+		{
+			desc: "empty pipeline env key",
+			env: ordered.MapFromItems(
+				ordered.TupleSS{Key: "${MISSING}", Value: "a"},
+			),
+			wantErr: ErrInvalidEnvKey,
+		},
+		{
+			desc:    "step env key containing =",
+			stepEnv: map[string]string{"${PREFIX}=X": "a"},
+			wantErr: ErrInvalidEnvKey,
+		},
+		{
+			desc: "key interpolation disallowed",
+			env: ordered.MapFromItems(
+				ordered.TupleSS{Key: "${PREFIX}_NAME", Value: "a"},
+			),
+			opts:    []InterpolateOption{DisallowEnvKeyInterpolation()},
+			wantErr: ErrEnvKeyInterpolationDisallowed,
+		},
+		{
+			desc:    "step key interpolation disallowed",
+			stepEnv: map[string]string{"${PREFIX}_NAME": "a"},
+			opts:    []InterpolateOption{DisallowEnvKeyInterpolation()},
+			wantErr: ErrEnvKeyInterpolationDisallowed,
+		},
+		{
+			desc: "key interpolation disallowed, values still interpolated",
+			env: ordered.MapFromItems(
+				ordered.TupleSS{Key: "NAME", Value: "${PREFIX}"},
+			),
+			stepEnv: map[string]string{"STEP": "${PREFIX}"},
+			opts:    []InterpolateOption{DisallowEnvKeyInterpolation()},
+			wantEnv: ordered.MapFromItems(
+				ordered.TupleSS{Key: "NAME", Value: "APP"},
+			),
+			wantStep: map[string]string{"STEP": "APP"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Pipeline{
+				Env:   test.env,
+				Steps: Steps{&CommandStep{Env: test.stepEnv}},
+			}
+			err := p.Interpolate(env.New(env.FromMap(runtimeEnv)), false, test.opts...)
+
+			if test.wantEnv == nil && test.wantStep == nil {
+				if err == nil {
+					t.Fatalf("p.Interpolate() error = nil, want non-nil error")
+				}
+				if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+					t.Errorf("p.Interpolate() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("p.Interpolate() error = %v", err)
+			}
+			if diff := cmp.Diff(p.Env, test.wantEnv, cmp.Comparer(ordered.EqualSS)); diff != "" {
+				t.Errorf("p.Env diff (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(p.Steps[0].(*CommandStep).Env, test.wantStep); diff != "" {
+				t.Errorf("step env diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInterpolationErrorsAsWarnings(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "GOOD", Value: "${NAME}"},
+			ordered.TupleSS{Key: "BAD", Value: "${MISSING?is required}"},
+		),
+		Steps: Steps{
+			&CommandStep{
+				Command: "echo ${NAME} ${GOOD}",
+				Label:   "${NAME:bogus}",
+			},
+			&CommandStep{
+				Command: "echo fine",
+				Env:     map[string]string{"${MISSING}": "empty key"},
+			},
+		},
+	}
+
+	err := p.Interpolate(env.New(env.FromMap(map[string]string{"NAME": "world"})), false, InterpolationErrorsAsWarnings())
+	w := warning.As(err)
+	if w == nil {
+		t.Fatalf("p.Interpolate() error = %v, want a warning", err)
+	}
+	if !errors.Is(err, ErrInvalidEnvKey) {
+		t.Errorf("errors.Is(%v, ErrInvalidEnvKey) = false, want true", err)
+	}
+	for _, want := range []string{"while interpolating env", "is required", "while interpolating step 0", "${NAME:bogus}", "while interpolating step 1"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("p.Interpolate() error = %q, want it to contain %q", err, want)
+		}
+	}
+
+	want := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "GOOD", Value: "world"},
+			ordered.TupleSS{Key: "BAD", Value: "${MISSING?is required}"},
+		),
+		Steps: Steps{
+			&CommandStep{
+				Command: "echo world world",
+				Label:   "${NAME:bogus}",
+			},
+			&CommandStep{
+				Command: "echo fine",
+				Env:     map[string]string{"${MISSING}": "empty key"},
+			},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("interpolated pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestInterpolateWithPipelineEnvOnly(t *testing.T) {
+	// Not parallel: uses t.Setenv.
+	t.Setenv("HOST_SECRET", "hunter2")
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "GREETING", Value: "hello"},
+		),
+		Steps: Steps{
+			&CommandStep{Command: "echo ${GREETING} ${HOST_SECRET} ${greeting}"},
+		},
+	}
+	if err := p.InterpolateWithPipelineEnvOnly(); err != nil {
+		t.Fatalf("p.InterpolateWithPipelineEnvOnly() error = %v", err)
+	}
+
+	want := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "GREETING", Value: "hello"},
+		),
+		Steps: Steps{
+			&CommandStep{Command: "echo hello  "},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("interpolated pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestInterpolateStrict(t *testing.T) {
+	t.Parallel()
+
+	runtimeEnv := map[string]string{"NAME": "world", "EMPTY": ""}
+
+	tests := []struct {
+		desc         string
+		command      string
+		want         string
+		wantVariable string
+	}{
+		{
+			desc:    "set variables",
+			command: "echo $NAME ${NAME} ${NAME:0:3} [${EMPTY}]",
+			want:    "echo world world wor []",
+		},
+		{
+			desc:    "defaults and escapes",
+			command: "echo ${MISSING:-a} ${MISSING-b} $$MISSING ${NAME?}",
+			want:    "echo a b $MISSING world",
+		},
+		{
+			desc:         "unset variable",
+			command:      "echo hello ${MISSING}",
+			wantVariable: "MISSING",
+		},
+		{
+			desc:         "unset variable without braces",
+			command:      "echo hello $MISSING",
+			wantVariable: "MISSING",
+		},
+		{
+			desc:         "unset variable in substring",
+			command:      "echo ${MISSING:0:3}",
+			wantVariable: "MISSING",
+		},
+		{
+			desc:         "unset variable in default",
+			command:      "echo ${MISSING:-$ALSO_MISSING}",
+			wantVariable: "ALSO_MISSING",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Pipeline{Steps: Steps{&CommandStep{Command: test.command}}}
+			err := p.Interpolate(env.New(env.FromMap(runtimeEnv)), false, InterpolateStrict())
+
+			if test.wantVariable != "" {
+				if !errors.Is(err, ErrVariableNotSet) {
+					t.Fatalf("p.Interpolate() error = %v, want %v", err, ErrVariableNotSet)
+				}
+				var ie *InterpolationError
+				if !errors.As(err, &ie) {
+					t.Fatalf("errors.As(%v, *InterpolationError) = false, want true", err)
+				}
+				if got := ie.Variable; got != test.wantVariable {
+					t.Errorf("InterpolationError.Variable = %q, want %q", got, test.wantVariable)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("p.Interpolate() error = %v", err)
+			}
+			if got := p.Steps[0].(*CommandStep).Command; got != test.want {
+				t.Errorf("command = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateStrictEnvBlock(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "FIRST", Value: "one"},
+			ordered.TupleSS{Key: "SECOND", Value: "${FIRST} ${THIRD}"},
+		),
+		Steps: Steps{&CommandStep{Command: "echo ${FIRST}"}},
+	}
+	err := p.Interpolate(nil, false, InterpolateStrict())
+	if !errors.Is(err, ErrVariableNotSet) {
+		t.Fatalf("p.Interpolate() error = %v, want %v", err, ErrVariableNotSet)
+	}
+	if want := "$THIRD: not set"; !strings.Contains(err.Error(), want) {
+		t.Errorf("p.Interpolate() error = %q, want it to contain %q", err, want)
+	}
+}
+
+func TestSkipInterpolation(t *testing.T) {
+	t.Parallel()
+
+	input := `env:
+  NAME: world
+steps:
+  - label: Hello ${NAME}
+    command: echo $$HOME ${NAME} ${UNSET?}
+    if: build.env("X") == "${NAME}"
+    env:
+      KEEP: ${NAME}
+      GREETING: hello ${NAME}
+    plugins:
+      - docker#v5.0.0:
+          image: ${NAME}
+  - group: Group ${NAME}
+    steps:
+      - command: echo ${NAME}
+        label: ${NAME}
+  - trigger: deploy-${NAME}
+    build:
+      message: ${NAME} ${UNSET?}
+      commit: ${NAME}
+  - wait
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	opts := []InterpolateOption{SkipInterpolation("command", "if", "env.KEEP", "plugins", "build.message")}
+	if err := p.Interpolate(nil, false, opts...); err != nil {
+		t.Fatalf("p.Interpolate(nil, false, opts...) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Env: ordered.MapFromItems(ordered.TupleSS{Key: "NAME", Value: "world"}),
+		Steps: Steps{
+			&CommandStep{
+				Label:   "Hello world",
+				Command: "echo $$HOME ${NAME} ${UNSET?}",
+				Env: map[string]string{
+					"KEEP":     "${NAME}",
+					"GREETING": "hello world",
+				},
+				Plugins: Plugins{{
+					Source: "github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0",
+					Config: map[string]any{"image": "${NAME}"},
+				}},
+				RemainingFields: map[string]any{"if": `build.env("X") == "${NAME}"`},
+			},
+			&GroupStep{
+				Group: ptr("Group world"),
+				Steps: Steps{
+					&CommandStep{Command: "echo ${NAME}", Label: "world"},
+				},
+			},
+			&TriggerStep{
+				Trigger: "deploy-world",
+				Build: &TriggerBuild{
+					Message: "${NAME} ${UNSET?}",
+					Commit:  "world",
+				},
+			},
+			&WaitStep{Scalar: "wait"},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("interpolated pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRecordSubstitutions(t *testing.T) {
+	t.Parallel()
+
+	input := `env:
+  REGION: ${DEFAULT_REGION}
+steps:
+  - command: deploy --region ${REGION} --token ${TOKEN} ${TOKEN}
+    label: ${MISSING:-Deploy}
+  - group: Tests
+    steps:
+      - command: make test
+        env:
+          ${PREFIX}_DEBUG: "true"
+  - wait
+agents:
+  queue: ${QUEUE}
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	runtimeEnv := env.New(env.FromMap(map[string]string{
+		"DEFAULT_REGION": "ap-southeast-2",
+		"TOKEN":          "hunter2",
+		"PREFIX":         "APP",
+		"QUEUE":          "",
+	}))
+
+	var got []Substitution
+	if err := p.Interpolate(runtimeEnv, false, RecordSubstitutions(&got)); err != nil {
+		t.Fatalf("p.Interpolate(runtimeEnv, false, RecordSubstitutions(&got)) error = %v", err)
+	}
+
+	want := []Substitution{
+		{Path: "env.REGION", Variable: "DEFAULT_REGION", MaskedValue: maskValue("ap-southeast-2")},
+		{Path: "steps[0].command", Variable: "REGION", MaskedValue: maskValue("ap-southeast-2")},
+		{Path: "steps[0].command", Variable: "TOKEN", MaskedValue: maskValue("hunter2")},
+		{Path: "steps[1].steps[0].env.APP_DEBUG", Variable: "PREFIX", MaskedValue: maskValue("APP")},
+		{Path: "agents.queue", Variable: "QUEUE"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("substitutions diff (-got +want):\n%s", diff)
+	}
+
+	if want := "sha256:f52fbd32b2b3b86f"; maskValue("hunter2") != want {
+		t.Errorf("maskValue(%q) = %q, want %q", "hunter2", maskValue("hunter2"), want)
+	}
+	for _, s := range got {
+		if strings.Contains(s.MaskedValue, "hunter2") {
+			t.Errorf("Substitution %+v contains the unmasked value", s)
+		}
+	}
+}
+
+func TestWithValueRedactor(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "DEPLOY_TOKEN", Value: "${VAULT_TOKEN}"},
+		),
+		Steps: Steps{
+			&CommandStep{
+				Command: "deploy --token ${DEPLOY_TOKEN} --password ${PASSWORD} --region ${REGION}",
+				Env:     map[string]string{"AGAIN": "${VAULT_TOKEN}", "EMPTY": "${EMPTY_TOKEN}"},
+			},
+			&CommandStep{Command: "echo ${UNSET_TOKEN:-default}"},
+		},
+	}
+	runtimeEnv := env.New(env.FromMap(map[string]string{
+		"VAULT_TOKEN": "s3cr3t",
+		"PASSWORD":    "swordfish",
+		"REGION":      "ap-southeast-2",
+		"EMPTY_TOKEN": "",
+	}))
+
+	var got []string
+	opt := WithValueRedactor([]string{"*_TOKEN", "PASSWORD"}, &got)
+	if err := p.Interpolate(runtimeEnv, false, opt); err != nil {
+		t.Fatalf("p.Interpolate(runtimeEnv, false, WithValueRedactor(...)) error = %v", err)
+	}
+	if diff := cmp.Diff(got, []string{"s3cr3t", "swordfish"}); diff != "" {
+		t.Errorf("secret values diff (-got +want):\n%s", diff)
+	}
+
+	var unused []string
+	if err := p.Interpolate(runtimeEnv, false, WithValueRedactor([]string{"[bad"}, &unused)); err == nil {
+		t.Errorf("p.Interpolate(runtimeEnv, false, WithValueRedactor([\"[bad\"], ...)) error = nil, want an error")
+	}
+}
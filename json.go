@@ -12,6 +12,16 @@ import (
 // inlineFriendlyMarshalJSON marshals the given object to JSON, but with special handling given to fields tagged with ",inline".
 // This is needed because yaml.v3 has "inline" but encoding/json has no concept of it.
 func inlineFriendlyMarshalJSON(q any) ([]byte, error) {
+	fields, err := inlineFriendlyFields(q)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// inlineFriendlyFields returns the fields of the given object as they would be
+// marshaled by inlineFriendlyMarshalJSON, with inline fields merged in.
+func inlineFriendlyFields(q any) (map[string]any, error) {
 	fieldNames, err := reflections.Fields(q)
 	if err != nil {
 		return nil, fmt.Errorf("could not get fields of %T: %w", q, err)
@@ -69,7 +79,7 @@ func inlineFriendlyMarshalJSON(q any) ([]byte, error) {
 		allFields[k] = v
 	}
 
-	return json.Marshal(allFields)
+	return allFields, nil
 }
 
 // stolen from encoding/json
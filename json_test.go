@@ -1,6 +1,12 @@
 package pipeline
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+)
 
 type strukt struct {
 	Foo string         `yaml:"foo"`
@@ -78,3 +84,34 @@ func TestInlineFriendlyMarshalJSON_FailsWhenInlineFieldsIsntAMap(t *testing.T) {
 		t.Errorf("inlineFriendlyMarshalJSON() error = %v, want %v", err, wantError)
 	}
 }
+
+func TestPipelineMarshalJSON_Large(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "ZED", Value: "first"},
+			ordered.TupleSS{Key: "ALPHA", Value: "<second>"},
+		),
+		RemainingFields: map[string]any{"agents": map[string]any{"queue": "default"}},
+	}
+	for i := 0; i <= streamJSONSteps; i++ {
+		p.Steps = append(p.Steps,
+			&CommandStep{Key: fmt.Sprintf("step-%d", i), Command: "make test"},
+			&WaitStep{},
+			&GroupStep{Group: ptr("group"), Steps: Steps{&CommandStep{Command: "true"}}},
+		)
+	}
+
+	got, err := p.MarshalJSON()
+	if err != nil {
+		t.Fatalf("p.MarshalJSON() error = %v", err)
+	}
+	want, err := inlineFriendlyMarshalJSON(p)
+	if err != nil {
+		t.Fatalf("inlineFriendlyMarshalJSON(p) error = %v", err)
+	}
+	if diff := cmp.Diff(string(got), string(want)); diff != "" {
+		t.Errorf("p.MarshalJSON() diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,103 @@
+package jwkutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// NotAfterKey is the name of the JWK parameter recording the time after which
+// a key is retired and should no longer be trusted. Its value is a NumericDate
+// (seconds since the Unix epoch), as used for the "exp" claim in JWTs.
+const NotAfterKey = "exp"
+
+// SetNotAfter marks the key as retired after t.
+func SetNotAfter(key jwk.Key, t time.Time) error {
+	if err := key.Set(NotAfterKey, t.Unix()); err != nil {
+		return fmt.Errorf("failed to set %s: %w", NotAfterKey, err)
+	}
+	return nil
+}
+
+// NotAfter returns the time after which the key is retired, and reports
+// whether the key has one. A key with a malformed value (one that isn't a
+// NumericDate) is treated as retired since the zero time, so that it is never
+// trusted: a value that can't be understood fails closed.
+func NotAfter(key jwk.Key) (time.Time, bool) {
+	v, ok := key.Get(NotAfterKey)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case float64:
+		return floatTime(v), true
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return time.Unix(n, 0), true
+		}
+		if f, err := v.Float64(); err == nil {
+			return floatTime(f), true
+		}
+		return time.Time{}, true
+	default:
+		return time.Time{}, true
+	}
+}
+
+// floatTime returns the time for a NumericDate with a fractional part.
+func floatTime(v float64) time.Time {
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// IsExpired reports whether the key has a retirement time that is before now
+// (which a key with a malformed retirement time always has; see NotAfter).
+func IsExpired(key jwk.Key, now time.Time) bool {
+	t, ok := NotAfter(key)
+	return ok && now.After(t)
+}
+
+// Unexpired returns a new set containing the keys in set that have not expired
+// as of now.
+func Unexpired(set jwk.Set, now time.Time) (jwk.Set, error) {
+	out := jwk.NewSet()
+	for i := 0; i < set.Len(); i++ {
+		key, ok := set.Key(i)
+		if !ok || IsExpired(key, now) {
+			continue
+		}
+		if err := out.AddKey(key); err != nil {
+			return nil, fmt.Errorf("failed to add key to set: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// PruneExpired removes keys that have expired as of now from set, and returns
+// the number of keys removed.
+func PruneExpired(set jwk.Set, now time.Time) (int, error) {
+	var expired []jwk.Key
+	for i := 0; i < set.Len(); i++ {
+		key, ok := set.Key(i)
+		if ok && IsExpired(key, now) {
+			expired = append(expired, key)
+		}
+	}
+
+	for _, key := range expired {
+		if err := set.RemoveKey(key); err != nil {
+			return 0, fmt.Errorf("failed to remove key ID %q from set: %w", key.KeyID(), err)
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,91 @@
+package jwkutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+func TestPruneExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	set := jwk.NewSet()
+	for _, k := range []struct {
+		id       string
+		notAfter time.Time
+	}{
+		{id: "retired", notAfter: now.Add(-time.Hour)},
+		{id: "current", notAfter: now.Add(time.Hour)},
+		{id: "forever"},
+	} {
+		priv, _, err := NewKeyPair(k.id, jwa.EdDSA)
+		if err != nil {
+			t.Fatalf("NewKeyPair(%q, EdDSA) error = %v", k.id, err)
+		}
+		key, _ := priv.Key(0)
+		if !k.notAfter.IsZero() {
+			if err := SetNotAfter(key, k.notAfter); err != nil {
+				t.Fatalf("SetNotAfter(key, %v) error = %v", k.notAfter, err)
+			}
+		}
+		if err := set.AddKey(key); err != nil {
+			t.Fatalf("set.AddKey(key) error = %v", err)
+		}
+	}
+
+	// Round-trip through JSON, since that's how key sets are usually loaded.
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("json.Marshal(set) error = %v", err)
+	}
+	set, err = jwk.Parse(b)
+	if err != nil {
+		t.Fatalf("jwk.Parse(b) error = %v", err)
+	}
+
+	key, _ := set.LookupKeyID("current")
+	if got, ok := NotAfter(key); !ok || !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("NotAfter(current) = %v, %t, want %v, true", got, ok, now.Add(time.Hour))
+	}
+
+	n, err := PruneExpired(set, now)
+	if err != nil {
+		t.Fatalf("PruneExpired(set, %v) error = %v", now, err)
+	}
+	if n != 1 {
+		t.Errorf("PruneExpired(set, %v) = %d, want 1", now, n)
+	}
+	if _, ok := set.LookupKeyID("retired"); ok {
+		t.Errorf("set.LookupKeyID(retired) found a key after pruning")
+	}
+	if set.Len() != 2 {
+		t.Errorf("set.Len() = %d after pruning, want 2", set.Len())
+	}
+}
+
+func TestNotAfterMalformed(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, v := range []any{"next tuesday", json.Number("soon"), true, map[string]any{"at": 1}} {
+		priv, _, err := NewKeyPair("malformed", jwa.EdDSA)
+		if err != nil {
+			t.Fatalf("NewKeyPair(malformed, EdDSA) error = %v", err)
+		}
+		key, _ := priv.Key(0)
+		if err := key.Set(NotAfterKey, v); err != nil {
+			t.Fatalf("key.Set(%q, %v) error = %v", NotAfterKey, v, err)
+		}
+		if _, ok := NotAfter(key); !ok {
+			t.Errorf("NotAfter(key with %s = %v) = _, false, want true", NotAfterKey, v)
+		}
+		if !IsExpired(key, now) {
+			t.Errorf("IsExpired(key with %s = %v, %v) = false, want true", NotAfterKey, v, now)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package jwkutil
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// DefaultJWKSMaxAge is the Cache-Control max-age used by NewJWKSHandler when
+// none is specified.
+const DefaultJWKSMaxAge = 5 * time.Minute
+
+// JWKSHandler is an http.Handler that serves the public keys of a JSON Web Key
+// Set. Private key material is never served: private keys are reduced to their
+// public keys, and symmetric keys are omitted entirely.
+//
+// The key set can be replaced while the handler is serving with SetKeys.
+type JWKSHandler struct {
+	maxAge time.Duration
+
+	mu   sync.RWMutex
+	body []byte
+	etag string
+}
+
+// NewJWKSHandler returns a handler serving the public keys of set. Responses
+// are marked as cacheable for maxAge (DefaultJWKSMaxAge if maxAge is zero).
+func NewJWKSHandler(set jwk.Set, maxAge time.Duration) (*JWKSHandler, error) {
+	if maxAge == 0 {
+		maxAge = DefaultJWKSMaxAge
+	}
+	h := &JWKSHandler{maxAge: maxAge}
+	if err := h.SetKeys(set); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// SetKeys replaces the key set being served.
+func (h *JWKSHandler) SetKeys(set jwk.Set) error {
+	pub, err := PublicSet(set)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(pub)
+	if err != nil {
+		return fmt.Errorf("marshaling public key set: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.body = body
+	h.etag = fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	return nil
+}
+
+// ServeHTTP serves the public key set in response to GET and HEAD requests.
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	body, etag := h.body, h.etag
+	h.mu.RUnlock()
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+
+	if match := r.Header.Get("If-None-Match"); match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(body)
+	}
+}
+
+// PublicSet returns a new key set containing the public keys from set.
+// Symmetric keys have no public form, so they are omitted.
+func PublicSet(set jwk.Set) (jwk.Set, error) {
+	pub := jwk.NewSet()
+	for i := 0; i < set.Len(); i++ {
+		key, ok := set.Key(i)
+		if !ok {
+			continue
+		}
+		if key.KeyType() == jwa.OctetSeq {
+			continue
+		}
+
+		pk, err := jwk.PublicKeyOf(key)
+		if err != nil {
+			return nil, fmt.Errorf("obtaining public key for key ID %q: %w", key.KeyID(), err)
+		}
+		if err := pub.AddKey(pk); err != nil {
+			return nil, fmt.Errorf("failed to add public key to set: %w", err)
+		}
+	}
+	return pub, nil
+}
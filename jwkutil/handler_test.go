@@ -0,0 +1,72 @@
+package jwkutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	t.Parallel()
+
+	priv, _, err := NewKeyPair("rsa", jwa.PS512)
+	if err != nil {
+		t.Fatalf("NewKeyPair(rsa, PS512) error = %v", err)
+	}
+	sym, _, err := NewSymmetricKeyPairFromString("sym", "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("NewSymmetricKeyPairFromString(sym, alpacas, HS256) error = %v", err)
+	}
+	symKey, _ := sym.Key(0)
+	if err := priv.AddKey(symKey); err != nil {
+		t.Fatalf("priv.AddKey(symKey) error = %v", err)
+	}
+
+	h, err := NewJWKSHandler(priv, 0)
+	if err != nil {
+		t.Fatalf("NewJWKSHandler(priv, 0) error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := rec.Header().Get("Cache-Control"), "public, max-age=300"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+
+	got, err := jwk.Parse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("jwk.Parse(body) error = %v", err)
+	}
+	if got.Len() != 1 {
+		t.Fatalf("served set has %d keys, want 1", got.Len())
+	}
+	key, _ := got.Key(0)
+	if key.KeyID() != "rsa" {
+		t.Errorf("served key ID = %q, want %q", key.KeyID(), "rsa")
+	}
+	if _, ok := key.Get("d"); ok {
+		t.Errorf("served key contains private material")
+	}
+
+	// A conditional request with the same ETag is not modified.
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional GET status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,258 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/policy"
+)
+
+// Errors wrapped by the violations of the rules in this package.
+var (
+	ErrCurlPipeShell    = errors.New("downloads a script and pipes it to a shell")
+	ErrDockerPrivileged = errors.New("runs a privileged docker container")
+	ErrUnpinnedPlugin   = errors.New("third-party plugin is not pinned to a version")
+	ErrSecretInEnv      = errors.New("env var appears to contain a secret")
+	ErrUnsignedStep     = errors.New("step is not signed")
+)
+
+// curlPipeShell matches downloading with curl or wget and piping the result
+// to a shell (possibly via sudo).
+var curlPipeShell = regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+(-\S+\s+)*)?(ba|da|k|z)?sh\b`)
+
+// CurlPipeShell returns a rule (named "curl_pipe_shell") that command steps
+// don't download scripts and run them without checking them, as in
+// `curl -sSL https://example.com/install.sh | bash`. Violations wrap
+// ErrCurlPipeShell.
+func CurlPipeShell() policy.Rule {
+	return policy.StepRule("curl_pipe_shell", func(s pipeline.Step) error {
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok {
+			return nil
+		}
+		for _, cmd := range c.Commands() {
+			if curlPipeShell.MatchString(cmd) {
+				return fmt.Errorf("%w: %q", ErrCurlPipeShell, cmd)
+			}
+		}
+		return nil
+	})
+}
+
+// dockerPrivileged matches running a privileged container from a command.
+var dockerPrivileged = regexp.MustCompile(`\bdocker\b.*\s--privileged\b`)
+
+// DockerPrivileged returns a rule (named "docker_privileged") that command
+// steps don't run privileged containers, either with the docker or
+// docker-compose plugins (privileged: true in the plugin config), or with
+// `docker run --privileged` in the command. Violations wrap
+// ErrDockerPrivileged.
+func DockerPrivileged() policy.Rule {
+	return privilegedRule{}
+}
+
+type privilegedRule struct{}
+
+func (privilegedRule) Name() string { return "docker_privileged" }
+
+func (r privilegedRule) Check(p *pipeline.Pipeline) []*policy.Violation {
+	var vs []*policy.Violation
+	for sp, s := range p.AllSteps() {
+		if u, ok := s.(*pipeline.UnknownStep); ok {
+			vs = append(vs, unknownStep(r.Name(), sp, u))
+			continue
+		}
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok || c == nil {
+			continue
+		}
+		for _, cmd := range c.Commands() {
+			if dockerPrivileged.MatchString(cmd) {
+				vs = append(vs, &policy.Violation{
+					Rule: r.Name(),
+					Path: sp.String(),
+					Step: c,
+					Err:  fmt.Errorf("%w: %q", ErrDockerPrivileged, cmd),
+				})
+				break
+			}
+		}
+		for i, pl := range c.Plugins {
+			if pl == nil || !(pl.Matches("docker") || pl.Matches("docker-compose")) {
+				continue
+			}
+			if configValue(pl.Config, "privileged") != true {
+				continue
+			}
+			vs = append(vs, &policy.Violation{
+				Rule:   r.Name(),
+				Path:   fmt.Sprintf("%s.plugins[%d]", sp, i),
+				Step:   c,
+				Plugin: pl,
+				Err:    fmt.Errorf("%s: %w", pl.Source, ErrDockerPrivileged),
+			})
+		}
+	}
+	return vs
+}
+
+// unknownStep returns the violation of a rule for a step that couldn't be
+// parsed, and so couldn't be checked (see policy.ErrUnknownStep).
+func unknownStep(rule string, sp pipeline.StepPath, u *pipeline.UnknownStep) *policy.Violation {
+	return &policy.Violation{
+		Rule: rule,
+		Path: sp.String(),
+		Step: u,
+		Err:  policy.ErrUnknownStep,
+	}
+}
+
+// configValue returns the value of an item in a plugin config, or nil.
+func configValue(config any, key string) any {
+	switch config := config.(type) {
+	case map[string]any:
+		return config[key]
+	case interface{ Get(string) (any, bool) }:
+		v, _ := config.Get(key)
+		return v
+	default:
+		return nil
+	}
+}
+
+// UnpinnedPlugins returns a rule (named "unpinned_plugin") that third-party
+// plugins are pinned to a version, so that a change to the plugin's
+// repository can't change what the pipeline runs. Plugins maintained by
+// Buildkite, plugins within the repository (with a path as their source),
+// and plugins matching one of the trusted patterns are exempt. Patterns are
+// matched against the full source of each plugin without its version, using
+// path.Match, so "my-org/*" trusts every plugin of the my-org organisation.
+// Violations wrap ErrUnpinnedPlugin.
+func UnpinnedPlugins(trusted ...string) policy.Rule {
+	return unpinnedRule{trusted: trusted}
+}
+
+type unpinnedRule struct {
+	trusted []string
+}
+
+func (unpinnedRule) Name() string { return "unpinned_plugin" }
+
+func (r unpinnedRule) Check(p *pipeline.Pipeline) []*policy.Violation {
+	var vs []*policy.Violation
+	for sp, s := range p.AllSteps() {
+		if u, ok := s.(*pipeline.UnknownStep); ok {
+			vs = append(vs, unknownStep(r.Name(), sp, u))
+			continue
+		}
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok || c == nil {
+			continue
+		}
+		for i, pl := range c.Plugins {
+			if pl == nil || pl.Version() != "" || !thirdParty(pl, r.trusted) {
+				continue
+			}
+			vs = append(vs, &policy.Violation{
+				Rule:   r.Name(),
+				Path:   fmt.Sprintf("%s.plugins[%d]", sp, i),
+				Step:   c,
+				Plugin: pl,
+				Err:    fmt.Errorf("%s: %w", pl.Source, ErrUnpinnedPlugin),
+			})
+		}
+	}
+	return vs
+}
+
+var (
+	// secretName matches the names of env vars that usually hold secrets.
+	secretName = regexp.MustCompile(`(?i)(^|_)(TOKEN|SECRET|PASSWORD|PASSWD|PASSPHRASE|API_?KEY|ACCESS_KEY|PRIVATE_KEY|CREDENTIALS?)(_|$)`)
+
+	// secretValue matches values that look like well-known kinds of secret.
+	secretValue = regexp.MustCompile(`^(AKIA[0-9A-Z]{16}|gh[oprsu]_[A-Za-z0-9]{36,}|github_pat_\w{22,}|xox[abpr]-[0-9A-Za-z-]{10,}|glpat-[0-9A-Za-z_-]{20,})$|-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+)
+
+// SecretsInEnv returns a rule (named "secret_in_env") that the env blocks of
+// the pipeline and its command steps don't contain secrets, which would be
+// visible to anyone who can see the pipeline. An env var is reported if its
+// value looks like a well-known kind of secret (such as an AWS access key ID
+// or a GitHub token), or if its name suggests a secret (such as API_TOKEN)
+// and its value is written literally rather than interpolated from another
+// variable. Values are not included in violations. Violations wrap
+// ErrSecretInEnv.
+func SecretsInEnv() policy.Rule {
+	return secretsRule{}
+}
+
+type secretsRule struct{}
+
+func (secretsRule) Name() string { return "secret_in_env" }
+
+func (r secretsRule) Check(p *pipeline.Pipeline) []*policy.Violation {
+	var vs []*policy.Violation
+	if p.Env != nil {
+		for name, value := range p.Env.All() {
+			if looksSecret(name, value) {
+				vs = append(vs, &policy.Violation{
+					Rule: r.Name(),
+					Path: "env." + name,
+					Err:  fmt.Errorf("%w: %s", ErrSecretInEnv, name),
+				})
+			}
+		}
+	}
+	for sp, s := range p.AllSteps() {
+		if u, ok := s.(*pipeline.UnknownStep); ok {
+			vs = append(vs, unknownStep(r.Name(), sp, u))
+			continue
+		}
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok || c == nil {
+			continue
+		}
+		names := make([]string, 0, len(c.Env))
+		for name := range c.Env {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if looksSecret(name, c.Env[name]) {
+				vs = append(vs, &policy.Violation{
+					Rule: r.Name(),
+					Path: fmt.Sprintf("%s.env.%s", sp, name),
+					Step: c,
+					Err:  fmt.Errorf("%w: %s", ErrSecretInEnv, name),
+				})
+			}
+		}
+	}
+	return vs
+}
+
+// looksSecret reports whether an env var appears to contain a secret.
+func looksSecret(name, value string) bool {
+	if secretValue.MatchString(value) {
+		return true
+	}
+	// Values that refer to other variables (such as "$API_TOKEN") are
+	// presumably set securely elsewhere.
+	return secretName.MatchString(name) && value != "" && !strings.Contains(value, "$")
+}
+
+// UnsignedSteps returns a rule (named "unsigned_step") that every command step
+// is signed (see the signature package), for pipelines uploaded with signing
+// enabled: an unsigned step in such a pipeline would be rejected by agents
+// that verify signatures. Violations wrap ErrUnsignedStep.
+func UnsignedSteps() policy.Rule {
+	return policy.StepRule("unsigned_step", func(s pipeline.Step) error {
+		if c, ok := s.(*pipeline.CommandStep); ok && c.Signature == nil {
+			return ErrUnsignedStep
+		}
+		return nil
+	})
+}
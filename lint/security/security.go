@@ -0,0 +1,94 @@
+// Package security is a curated set of lint rules for hardening pipelines.
+// The rules are policy rules (see the policy package), so they can be
+// combined with an organisation's own. Teams adopting hardened pipelines can
+// check a pipeline against all of them with one call:
+//
+//	for _, v := range security.Check(p, security.WithSignedPipelines()) {
+//		log.Print(v)
+//	}
+package security
+
+import (
+	"path"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/policy"
+)
+
+// Option configures the ruleset returned by Rules.
+type Option func(*config)
+
+type config struct {
+	signed         bool
+	trustedPlugins []string
+}
+
+// WithSignedPipelines enables the rule that every command step is signed (see
+// UnsignedSteps), for pipelines that are uploaded with signing enabled.
+func WithSignedPipelines() Option {
+	return func(cfg *config) {
+		cfg.signed = true
+	}
+}
+
+// WithTrustedPlugins exempts plugins from the rule that third-party plugins
+// are pinned (see UnpinnedPlugins). Patterns are matched as in
+// UnpinnedPlugins.
+func WithTrustedPlugins(patterns ...string) Option {
+	return func(cfg *config) {
+		cfg.trustedPlugins = append(cfg.trustedPlugins, patterns...)
+	}
+}
+
+// Rules returns the security ruleset: CurlPipeShell, DockerPrivileged,
+// UnpinnedPlugins, SecretsInEnv, and (WithSignedPipelines) UnsignedSteps.
+func Rules(opts ...Option) policy.Policy {
+	cfg := new(config)
+	for _, o := range opts {
+		o(cfg)
+	}
+	rules := policy.Policy{
+		CurlPipeShell(),
+		DockerPrivileged(),
+		UnpinnedPlugins(cfg.trustedPlugins...),
+		SecretsInEnv(),
+	}
+	if cfg.signed {
+		rules = append(rules, UnsignedSteps())
+	}
+	return rules
+}
+
+// Check checks the pipeline against the security ruleset (see Rules), and
+// returns the violations. Steps that couldn't be parsed (see
+// pipeline.UnknownStep) can't be checked, but may still be run, so every rule
+// reports them, with violations wrapping policy.ErrUnknownStep.
+func Check(p *pipeline.Pipeline, opts ...Option) []*policy.Violation {
+	return Rules(opts...).Check(p)
+}
+
+// officialPluginPrefix is the prefix of the full sources of plugins
+// maintained by Buildkite.
+const officialPluginPrefix = "github.com/buildkite-plugins/"
+
+// thirdParty reports whether the plugin is fetched from somewhere other than
+// Buildkite's plugins, and isn't trusted.
+func thirdParty(pl *pipeline.Plugin, trusted []string) bool {
+	src, _, _ := strings.Cut(pl.FullSource(), "#")
+	if strings.HasPrefix(src, officialPluginPrefix) {
+		return false
+	}
+	// Plugins in the repository (such as ./.buildkite/plugins/thing) are
+	// checked out with it, so aren't fetched.
+	if strings.HasPrefix(src, ".") || strings.HasPrefix(src, "/") {
+		return false
+	}
+	for _, pat := range trusted {
+		full, _, _ := strings.Cut(pipeline.DefaultPluginSourceRules().FullSource(pat), "#")
+		if ok, _ := path.Match(full, src); ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,361 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// This file implements MessagePack marshaling of pipelines and steps, in the
+// same way as cbor.go. Extension types are rejected when unmarshaling.
+
+var (
+	_ = []interface {
+		MarshalMsgpack() ([]byte, error)
+		UnmarshalMsgpack([]byte) error
+	}{
+		(*Pipeline)(nil),
+		(*CommandStep)(nil),
+		(*GroupStep)(nil),
+		(*TriggerStep)(nil),
+		(*WaitStep)(nil),
+		(*InputStep)(nil),
+	}
+)
+
+// MarshalMsgpack marshals the pipeline to MessagePack.
+func (p *Pipeline) MarshalMsgpack() ([]byte, error) { return marshalMsgpack(p) }
+
+// UnmarshalMsgpack unmarshals the pipeline from MessagePack. Warnings are
+// passed through the err return, as for Parse.
+func (p *Pipeline) UnmarshalMsgpack(b []byte) error { return unmarshalMsgpack(b, p) }
+
+// MarshalMsgpack marshals the step to MessagePack.
+func (c *CommandStep) MarshalMsgpack() ([]byte, error) { return marshalMsgpack(c) }
+
+// UnmarshalMsgpack unmarshals the step from MessagePack.
+func (c *CommandStep) UnmarshalMsgpack(b []byte) error { return unmarshalMsgpack(b, c) }
+
+// MarshalMsgpack marshals the step to MessagePack.
+func (g *GroupStep) MarshalMsgpack() ([]byte, error) { return marshalMsgpack(g) }
+
+// UnmarshalMsgpack unmarshals the step from MessagePack.
+func (g *GroupStep) UnmarshalMsgpack(b []byte) error { return unmarshalMsgpack(b, g) }
+
+// MarshalMsgpack marshals the step to MessagePack.
+func (t *TriggerStep) MarshalMsgpack() ([]byte, error) { return marshalMsgpack(t) }
+
+// UnmarshalMsgpack unmarshals the step from MessagePack.
+func (t *TriggerStep) UnmarshalMsgpack(b []byte) error { return unmarshalMsgpack(b, t) }
+
+// MarshalMsgpack marshals the step to MessagePack.
+func (s *WaitStep) MarshalMsgpack() ([]byte, error) { return marshalMsgpack(s) }
+
+// UnmarshalMsgpack unmarshals the step from MessagePack.
+func (s *WaitStep) UnmarshalMsgpack(b []byte) error { return unmarshalMsgpack(b, s) }
+
+// MarshalMsgpack marshals the step to MessagePack.
+func (s *InputStep) MarshalMsgpack() ([]byte, error) { return marshalMsgpack(s) }
+
+// UnmarshalMsgpack unmarshals the step from MessagePack.
+func (s *InputStep) UnmarshalMsgpack(b []byte) error { return unmarshalMsgpack(b, s) }
+
+func marshalMsgpack(x any) ([]byte, error) {
+	v, err := toGeneric(x)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling MessagePack: %w", err)
+	}
+	b, err := appendMsgpack(nil, v)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling MessagePack: %w", err)
+	}
+	return b, nil
+}
+
+func unmarshalMsgpack(b []byte, dst any) error {
+	d := &msgpackDecoder{b: b}
+	v, err := d.value()
+	if err != nil {
+		return fmt.Errorf("unmarshaling MessagePack: %w", err)
+	}
+	if len(d.b) > 0 {
+		return errors.New("unmarshaling MessagePack: trailing data")
+	}
+	return fromGeneric(v, dst)
+}
+
+// appendMsgpackLen appends the header of a string, array, or map of length n.
+// fix is the "fix" format byte, fixMax the largest length it can hold, and
+// f16 the 16-bit format byte (the 32-bit format always follows it).
+func appendMsgpackLen(b []byte, n int, fix byte, fixMax int, f16 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, f16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, f16+1), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	if len(s) < 32 {
+		return append(append(b, 0xa0|byte(len(s))), s...)
+	}
+	if len(s) <= math.MaxUint8 {
+		return append(append(b, 0xd9, byte(len(s))), s...)
+	}
+	return append(appendMsgpackLen(b, len(s), 0, -1, 0xda), s...)
+}
+
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+
+	case int:
+		switch {
+		case v >= 0 && v <= math.MaxInt8:
+			return append(b, byte(v)), nil
+		case v < 0 && v >= -32:
+			return append(b, byte(int8(v))), nil
+		case v >= math.MinInt8 && v <= math.MaxInt8:
+			return append(b, 0xd0, byte(int8(v))), nil
+		case v >= math.MinInt16 && v <= math.MaxInt16:
+			return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(v))), nil
+		case v >= math.MinInt32 && v <= math.MaxInt32:
+			return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(v))), nil
+		default:
+			return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v)), nil
+		}
+
+	case uint64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v), nil
+
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v)), nil
+
+	case string:
+		return appendMsgpackString(b, v), nil
+
+	case []any:
+		b = appendMsgpackLen(b, len(v), 0x90, 15, 0xdc)
+		for _, e := range v {
+			var err error
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+
+	case *ordered.MapSA:
+		b = appendMsgpackLen(b, v.Len(), 0x80, 15, 0xde)
+		for k, e := range v.All() {
+			b = appendMsgpackString(b, k)
+			var err error
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// msgpackDecoder decodes MessagePack values from the front of b.
+type msgpackDecoder struct {
+	b     []byte
+	depth int // of arrays and maps
+}
+
+var errMsgpackTruncated = errors.New("truncated data")
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	if len(d.b) < size {
+		return 0, errMsgpackTruncated
+	}
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	return n, nil
+}
+
+// length reads a length of size bytes, and checks it is plausible for the
+// remaining data.
+func (d *msgpackDecoder) length(size int) (int, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.b)) {
+		return 0, errMsgpackTruncated
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	if n > len(d.b) {
+		return nil, errMsgpackTruncated
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s, nil
+}
+
+// nest records decoding a nested array or map, and returns an error if they
+// are nested too deeply.
+func (d *msgpackDecoder) nest() error {
+	if d.depth >= maxNestingDepth {
+		return ErrNestingTooDeep
+	}
+	d.depth++
+	return nil
+}
+
+func (d *msgpackDecoder) array(n int) (any, error) {
+	if err := d.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+	a := make([]any, 0, min(n, len(d.b)))
+	for i := 0; i < n; i++ {
+		e, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, e)
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) mapping(n int) (any, error) {
+	if err := d.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+	m := ordered.NewMap[string, any](min(n, len(d.b)))
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key has type %T, want string", k)
+		}
+		e, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		m.Set(ks, e)
+	}
+	return m, nil
+}
+
+func (d *msgpackDecoder) value() (any, error) {
+	if len(d.b) == 0 {
+		return nil, errMsgpackTruncated
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+
+	switch {
+	case c <= 0x7f: // positive fixint
+		return int(c), nil
+	case c >= 0xe0: // negative fixint
+		return int(int8(c)), nil
+	case c&0xe0 == 0xa0: // fixstr
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90: // fixarray
+		return d.array(int(c & 0x0f))
+	case c&0xf0 == 0x80: // fixmap
+		return d.mapping(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb: // bin 8/16/32, str 8/16/32
+		size := 1 << ((c - 0xc4) % 3)
+		if c >= 0xd9 {
+			size = 1 << (c - 0xd9)
+		}
+		n, err := d.length(size)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+
+	case 0xca: // float 32
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb: // float 64
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int(n), nil
+
+	case 0xd0: // int 8
+		n, err := d.uint(1)
+		return int(int8(n)), err
+	case 0xd1: // int 16
+		n, err := d.uint(2)
+		return int(int16(n)), err
+	case 0xd2: // int 32
+		n, err := d.uint(4)
+		return int(int32(n)), err
+	case 0xd3: // int 64
+		n, err := d.uint(8)
+		return int(int64(n)), err
+
+	case 0xdc, 0xdd: // array 16/32
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(d.b)) {
+			return nil, errMsgpackTruncated
+		}
+		return d.array(int(n))
+
+	case 0xde, 0xdf: // map 16/32
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(d.b)) {
+			return nil, errMsgpackTruncated
+		}
+		return d.mapping(int(n))
+
+	default:
+		return nil, fmt.Errorf("unsupported format 0x%02x", c)
+	}
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	want, err := Parse(strings.NewReader(binaryTestPipeline))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	b, err := want.MarshalMsgpack()
+	if err != nil {
+		t.Fatalf("want.MarshalMsgpack() error = %v", err)
+	}
+	got := new(Pipeline)
+	if err := got.UnmarshalMsgpack(b); err != nil {
+		t.Fatalf("got.UnmarshalMsgpack(b) error = %v", err)
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("unmarshaled pipeline diff (-got +want):\n%s", diff)
+	}
+
+	// Each step type should also round-trip on its own.
+	for _, step := range want.Steps {
+		m, ok := step.(interface {
+			MarshalMsgpack() ([]byte, error)
+			UnmarshalMsgpack([]byte) error
+		})
+		if !ok {
+			t.Fatalf("step of type %T does not implement Msgpack marshaling", step)
+		}
+		b, err := m.MarshalMsgpack()
+		if err != nil {
+			t.Fatalf("%T.MarshalMsgpack() error = %v", step, err)
+		}
+		got := reflect.New(reflect.TypeOf(step).Elem()).Interface()
+		if err := got.(interface{ UnmarshalMsgpack([]byte) error }).UnmarshalMsgpack(b); err != nil {
+			t.Fatalf("%T.UnmarshalMsgpack(b) error = %v", got, err)
+		}
+		if diff := cmp.Diff(got, step, cmp.Comparer(ordered.EqualSS), cmp.Comparer(ordered.EqualSA), allowUnexported); diff != "" {
+			t.Errorf("unmarshaled %T diff (-got +want):\n%s", step, diff)
+		}
+	}
+}
+
+func TestMsgpackPreservesOrder(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "ZEBRA", Value: "stripes"},
+			ordered.TupleSS{Key: "ANIMAL", Value: "llama"},
+		),
+	}
+	b, err := p.MarshalMsgpack()
+	if err != nil {
+		t.Fatalf("p.MarshalMsgpack() error = %v", err)
+	}
+	if z, a := bytes.Index(b, []byte("ZEBRA")), bytes.Index(b, []byte("ANIMAL")); z < 0 || a < z {
+		t.Errorf("p.MarshalMsgpack() = %x, want ZEBRA before ANIMAL", b)
+	}
+}
+
+func TestUnmarshalMsgpackBadInput(t *testing.T) {
+	t.Parallel()
+
+	b, err := (&Pipeline{Steps: Steps{&CommandStep{Command: "make"}}}).MarshalMsgpack()
+	if err != nil {
+		t.Fatalf("p.MarshalMsgpack() error = %v", err)
+	}
+
+	tests := map[string][]byte{
+		"empty":           nil,
+		"truncated":       b[:len(b)-1],
+		"trailing data":   append(bytes.Clone(b), 0xc0),
+		"extension type":  {0xd4, 0x01, 0x00},
+		"integer map key": {0x81, 0x01, 0x01},
+		"huge array":      {0xdd, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, input := range tests {
+		if err := new(Pipeline).UnmarshalMsgpack(input); err == nil {
+			t.Errorf("UnmarshalMsgpack(%s) error = %v, want non-nil error", name, err)
+		}
+	}
+}
+
+func TestUnmarshalMsgpackDeeplyNested(t *testing.T) {
+	t.Parallel()
+
+	// Untrusted input mustn't be able to overflow the stack.
+	tests := map[string][]byte{
+		"arrays": bytes.Repeat([]byte{0x91}, 1_000_000),            // [[[...
+		"maps":   bytes.Repeat([]byte{0x81, 0xa1, 'k'}, 1_000_000), // {k: {k: ...
+	}
+	for name, input := range tests {
+		if err := new(Pipeline).UnmarshalMsgpack(input); !errors.Is(err, ErrNestingTooDeep) {
+			t.Errorf("UnmarshalMsgpack(%s) error = %v, want %v", name, err, ErrNestingTooDeep)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+		selfInterpolater
+	} = (*Notify)(nil)
+
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+		selfInterpolater
+	} = (*Notification)(nil)
+
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+	} = (*SlackNotification)(nil)
+
+	_ interface {
+		json.Marshaler
+		ordered.Unmarshaler
+	} = (*GitHubCommitStatusNotification)(nil)
+)
+
+var errUnsupportedNotifyType = fmt.Errorf("unsupported type for notify")
+
+// knownNotificationKinds are the kinds of notification Buildkite supports.
+var knownNotificationKinds = fieldSet(
+	"basecamp_campfire", "email", "github_check", "github_commit_status",
+	"pagerduty_change_event", "slack", "webhook",
+)
+
+// stepNotificationKinds are the kinds of notification that command and group
+// steps support.
+var stepNotificationKinds = fieldSet(
+	"basecamp_campfire", "github_check", "github_commit_status", "slack",
+)
+
+// Notify is the list of notifications of a pipeline, command step, or group
+// step:
+//
+//	notify:
+//	  - email: dev@example.com
+//	    if: build.state == "failed"
+//	  - slack: "#builds"
+//	  - slack:
+//	      channels: ["#builds", "@someone"]
+//	      message: Build finished
+//	  - webhook: https://example.com/hook
+//	  - pagerduty_change_event: 0123456789abcdef
+//	  - github_commit_status:
+//	      context: my-pipeline
+//
+// Steps support only some kinds of notification (see Validate).
+//
+// Notifications that can't be unmarshaled (such as an email written as a list)
+// are kept as they were written, with a warning, rather than failing to parse
+// the pipeline or step. They have no kind, so don't pass validation.
+type Notify []*Notification
+
+// marshalForm returns the value to marshal in place of n.
+func (n Notify) marshalForm() any {
+	if len(n) == 1 && n[0] != nil && n[0].unlisted {
+		return n[0].raw
+	}
+	return []*Notification(n)
+}
+
+// MarshalJSON marshals the list of notifications, or if notify wasn't written
+// as a list, the value as it was written.
+func (n Notify) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.marshalForm())
+}
+
+// MarshalYAML returns the list of notifications, or if notify wasn't written
+// as a list, the value as it was written.
+func (n Notify) MarshalYAML() (any, error) {
+	return n.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals a list of notifications. Anything else is kept
+// as it is, with a warning.
+func (n *Notify) UnmarshalOrdered(o any) error {
+	return n.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (n *Notify) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case nil:
+		*n = nil
+
+	case []any:
+		ns := make([]*Notification, 0, len(v))
+		err := ordered.Unmarshal(v, &ns, opts...)
+		*n = ns
+		return err
+
+	default:
+		*n = Notify{{raw: v, unlisted: true}}
+		return warning.Newf("%w: %T, want a list; keeping it as it is", errUnsupportedNotifyType, v)
+	}
+	return nil
+}
+
+func (n Notify) interpolate(tf stringTransformer) error {
+	return interpolateSlice(tf, n)
+}
+
+// Notification is one item of a notify list. Normally exactly one of the
+// notification kinds is set. Kinds that aren't modelled (such as
+// basecamp_campfire and github_check) are kept in RemainingFields.
+type Notification struct {
+	Email                string                          `yaml:"email,omitempty"`
+	Slack                *SlackNotification              `yaml:"slack,omitempty"`
+	Webhook              string                          `yaml:"webhook,omitempty"`
+	PagerDutyChangeEvent string                          `yaml:"pagerduty_change_event,omitempty"`
+	GitHubCommitStatus   *GitHubCommitStatusNotification `yaml:"github_commit_status,omitempty"`
+
+	// If is a conditional expression that must be true for the notification
+	// to be sent.
+	If string `yaml:"if,omitempty"`
+
+	// Scalar is the notification if it was written as a bare string (such as
+	// "github_check"), rather than a mapping.
+	Scalar string `yaml:"-"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+
+	// raw is the notification as it was written, if it couldn't be
+	// unmarshaled. It is marshaled back unchanged.
+	raw any
+
+	// unlisted records that raw is the whole of a notify that wasn't written
+	// as a list.
+	unlisted bool
+}
+
+// wrappedNotification is Notification without its marshaling methods.
+type wrappedNotification Notification
+
+// MarshalJSON marshals the notification as a bare string or a mapping,
+// according to how it was written.
+func (n *Notification) MarshalJSON() ([]byte, error) {
+	if n.raw != nil {
+		return json.Marshal(n.raw)
+	}
+	if n.Scalar != "" {
+		return json.Marshal(n.Scalar)
+	}
+	return inlineFriendlyMarshalJSON((*wrappedNotification)(n))
+}
+
+// MarshalYAML returns the notification as a bare string or a mapping,
+// according to how it was written.
+func (n *Notification) MarshalYAML() (any, error) {
+	if n.raw != nil {
+		return n.raw, nil
+	}
+	if n.Scalar != "" {
+		return n.Scalar, nil
+	}
+	return (*wrappedNotification)(n), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - string: a bare notification, kept in Scalar
+// - ordered.Map: a notification
+//
+// Anything else, or a mapping that can't be unmarshaled, is kept as it is,
+// with a warning.
+func (n *Notification) UnmarshalOrdered(o any) error {
+	return n.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (n *Notification) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case string:
+		*n = Notification{Scalar: v}
+
+	case *ordered.MapSA:
+		err := ordered.Unmarshal(v, (*wrappedNotification)(n), opts...)
+		if err == nil || warning.Is(err) || errors.Is(err, ordered.ErrNotCoerced) {
+			return err
+		}
+		*n = Notification{raw: v}
+		if !errors.Is(err, errUnsupportedNotifyType) {
+			err = fmt.Errorf("%w: %w", errUnsupportedNotifyType, err)
+		}
+		return warning.Wrapf(err, "keeping notification as it is")
+
+	default:
+		*n = Notification{raw: v}
+		return warning.Newf("%w: list contains %T; keeping it as it is", errUnsupportedNotifyType, v)
+	}
+	return nil
+}
+
+// Kinds returns the names of the kinds of notification that are set, such as
+// "email" or "slack", in the order they are listed in Notification (followed
+// by known kinds in RemainingFields, sorted).
+func (n *Notification) Kinds() []string {
+	if n.Scalar != "" {
+		if knownNotificationKinds[n.Scalar] {
+			return []string{n.Scalar}
+		}
+		return nil
+	}
+	var kinds []string
+	for _, k := range []struct {
+		name string
+		set  bool
+	}{
+		{"email", n.Email != ""},
+		{"slack", n.Slack != nil},
+		{"webhook", n.Webhook != ""},
+		{"pagerduty_change_event", n.PagerDutyChangeEvent != ""},
+		{"github_commit_status", n.GitHubCommitStatus != nil},
+	} {
+		if k.set {
+			kinds = append(kinds, k.name)
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(n.RemainingFields)) {
+		if knownNotificationKinds[k] {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
+}
+
+func (n *Notification) interpolate(tf stringTransformer) error {
+	if n == nil {
+		return nil
+	}
+	if n.raw != nil {
+		raw, err := interpolateAny(tf, n.raw)
+		if err != nil {
+			return err
+		}
+		n.raw = raw
+		return nil
+	}
+	for _, s := range []*string{&n.Email, &n.Webhook, &n.PagerDutyChangeEvent, &n.If} {
+		if err := interpolateString(tf, s); err != nil {
+			return err
+		}
+	}
+	if s := n.Slack; s != nil {
+		if err := interpolateSlice(tf, s.Channels); err != nil {
+			return err
+		}
+		if err := interpolateString(tf, &s.Message); err != nil {
+			return err
+		}
+		if err := interpolateMap(tf, s.RemainingFields); err != nil {
+			return err
+		}
+	}
+	if g := n.GitHubCommitStatus; g != nil {
+		if err := interpolateString(tf, &g.Context); err != nil {
+			return err
+		}
+		if err := interpolateMap(tf, g.RemainingFields); err != nil {
+			return err
+		}
+	}
+	return interpolateMap(tf, n.RemainingFields)
+}
+
+// SlackNotification is the slack item of a notification. It can be written as
+// a single channel (such as "#builds" or "workspace#builds") or a mapping.
+type SlackNotification struct {
+	Channels []string `yaml:"channels,omitempty"`
+	Message  string   `yaml:"message,omitempty"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+
+	// scalar records that a single channel was written as a string, so that
+	// it marshals back the same way (if nothing else has been set since).
+	scalar bool
+}
+
+// wrappedSlackNotification is SlackNotification without its marshaling
+// methods.
+type wrappedSlackNotification SlackNotification
+
+// isScalar reports whether s should be marshaled as a string.
+func (s *SlackNotification) isScalar() bool {
+	return s.scalar && len(s.Channels) == 1 && s.Message == "" && len(s.RemainingFields) == 0
+}
+
+// MarshalJSON marshals the item as a string or a mapping, according to how it
+// was written.
+func (s *SlackNotification) MarshalJSON() ([]byte, error) {
+	if s.isScalar() {
+		return json.Marshal(s.Channels[0])
+	}
+	return inlineFriendlyMarshalJSON((*wrappedSlackNotification)(s))
+}
+
+// MarshalYAML returns the item as a string or a mapping, according to how it
+// was written.
+func (s *SlackNotification) MarshalYAML() (any, error) {
+	if s.isScalar() {
+		return s.Channels[0], nil
+	}
+	return (*wrappedSlackNotification)(s), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - string: a single channel
+// - ordered.Map: channels, a message, etc
+func (s *SlackNotification) UnmarshalOrdered(o any) error {
+	return s.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (s *SlackNotification) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case string:
+		*s = SlackNotification{Channels: []string{v}, scalar: true}
+
+	case *ordered.MapSA:
+		return ordered.Unmarshal(v, (*wrappedSlackNotification)(s), opts...)
+
+	default:
+		return fmt.Errorf("%w: slack has type %T", errUnsupportedNotifyType, v)
+	}
+	return nil
+}
+
+// GitHubCommitStatusNotification is the github_commit_status item of a
+// notification.
+type GitHubCommitStatusNotification struct {
+	Context string `yaml:"context,omitempty"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// MarshalJSON marshals the item to JSON. Special handling is needed because
+// yaml.v3 has "inline" but encoding/json has no concept of it.
+func (g *GitHubCommitStatusNotification) MarshalJSON() ([]byte, error) {
+	return inlineFriendlyMarshalJSON(g)
+}
+
+// UnmarshalOrdered unmarshals the item from an ordered map.
+func (g *GitHubCommitStatusNotification) UnmarshalOrdered(o any) error {
+	return g.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (g *GitHubCommitStatusNotification) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	if _, ok := o.(*ordered.MapSA); !ok {
+		return fmt.Errorf("%w: github_commit_status has type %T", errUnsupportedNotifyType, o)
+	}
+	type wrappedStatus GitHubCommitStatusNotification
+	return ordered.Unmarshal(o, (*wrappedStatus)(g), opts...)
+}
+
+// validate checks that each notification is of exactly one kind, and (if
+// allowed is not nil) that the kind is one of allowed.
+func (n Notify) validate(allowed map[string]bool) error {
+	for i, item := range n {
+		if item == nil {
+			return fmt.Errorf("notification %d is empty", i)
+		}
+		kinds := item.Kinds()
+		switch len(kinds) {
+		case 0:
+			return fmt.Errorf("notification %d has no known kind", i)
+		case 1:
+			// ok
+		default:
+			return fmt.Errorf("notification %d has more than one kind: %v", i, kinds)
+		}
+		if allowed != nil && !allowed[kinds[0]] {
+			return fmt.Errorf("notification %d: %s notifications are not supported here", i, kinds[0])
+		}
+	}
+	return nil
+}
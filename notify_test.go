@@ -0,0 +1,251 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParserParsesNotify(t *testing.T) {
+	t.Parallel()
+
+	input := strings.NewReader(`---
+notify:
+  - email: dev@example.com
+    if: build.state == "failed"
+  - slack: "#builds"
+  - slack:
+      channels: ["#builds", "@someone"]
+      message: Build finished
+  - webhook: https://example.com/hook
+  - pagerduty_change_event: abc123
+  - github_commit_status:
+      context: my-pipeline
+  - basecamp_campfire: https://example.com/campfire
+  - github_check
+steps:
+  - command: make
+    notify:
+      - slack: "#builds"
+        if: build.branch == "main"
+  - group: Tests
+    notify:
+      - github_commit_status:
+          context: tests
+    steps:
+      - command: make test
+`)
+	got, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Notify: Notify{
+			{Email: "dev@example.com", If: `build.state == "failed"`},
+			{Slack: &SlackNotification{Channels: []string{"#builds"}, scalar: true}},
+			{Slack: &SlackNotification{Channels: []string{"#builds", "@someone"}, Message: "Build finished"}},
+			{Webhook: "https://example.com/hook"},
+			{PagerDutyChangeEvent: "abc123"},
+			{GitHubCommitStatus: &GitHubCommitStatusNotification{Context: "my-pipeline"}},
+			{RemainingFields: map[string]any{"basecamp_campfire": "https://example.com/campfire"}},
+			{Scalar: "github_check"},
+		},
+		Steps: Steps{
+			&CommandStep{
+				Command: "make",
+				Notify: Notify{
+					{Slack: &SlackNotification{Channels: []string{"#builds"}, scalar: true}, If: `build.branch == "main"`},
+				},
+			},
+			&GroupStep{
+				Group: nil,
+				Notify: Notify{
+					{GitHubCommitStatus: &GitHubCommitStatusNotification{Context: "tests"}},
+				},
+				Steps: Steps{&CommandStep{Command: "make test"}},
+			},
+		},
+	}
+	want.Steps[1].(*GroupStep).Group = ptr("Tests")
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+
+	if err := got.Validate(); err != nil {
+		t.Errorf("got.Validate() = %v, want nil", err)
+	}
+	if u := got.UnknownFields(); len(u) != 0 {
+		t.Errorf("got.UnknownFields() = %v, want none", u)
+	}
+
+	gotJSON, err := json.Marshal(got.Notify)
+	if err != nil {
+		t.Fatalf("json.Marshal(got.Notify) error = %v", err)
+	}
+	wantJSON := `[{"email":"dev@example.com","if":"build.state == \"failed\""},{"slack":"#builds"},{"slack":{"channels":["#builds","@someone"],"message":"Build finished"}},{"webhook":"https://example.com/hook"},{"pagerduty_change_event":"abc123"},{"github_commit_status":{"context":"my-pipeline"}},{"basecamp_campfire":"https://example.com/campfire"},"github_check"]`
+	if diff := cmp.Diff(string(gotJSON), wantJSON); diff != "" {
+		t.Errorf("json.Marshal(got.Notify) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestNotifyEditSlack(t *testing.T) {
+	t.Parallel()
+
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(`[{slack: "#builds"}]`), &n); err != nil {
+		t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+	}
+	var notify Notify
+	if err := ordered.Unmarshal(&n, &notify); err != nil {
+		t.Fatalf("ordered.Unmarshal(input, &notify) error = %v", err)
+	}
+
+	// Adding a channel to a single-channel slack notification switches it to
+	// the mapping form.
+	notify[0].Slack.Channels = append(notify[0].Slack.Channels, "#deploys")
+	got, err := json.Marshal(notify)
+	if err != nil {
+		t.Fatalf("json.Marshal(notify) error = %v", err)
+	}
+	want := `[{"slack":{"channels":["#builds","#deploys"]}}]`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("json.Marshal(notify) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestNotifyUnmarshalOrdered_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []string{
+		"email: dev@example.com",
+		"[1]",
+		"- slack: [a, b]",
+		"- github_commit_status: yes",
+	}
+
+	for _, input := range cases {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			var notify Notify
+			err := ordered.Unmarshal(&n, &notify)
+			if !warning.Is(err) || !errors.Is(err, errUnsupportedNotifyType) {
+				t.Errorf("ordered.Unmarshal(input, &notify) error = %v, want a warning wrapping %v", err, errUnsupportedNotifyType)
+			}
+			if got := strings.Count(err.Error(), errUnsupportedNotifyType.Error()); got != 1 {
+				t.Errorf("ordered.Unmarshal(input, &notify) error = %q, mentions %q %d times, want once", err, errUnsupportedNotifyType, got)
+			}
+		})
+	}
+}
+
+func TestParserKeepsUnsupportedNotify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			name: "pipeline notify mapping",
+			input: `notify: {email: a@b}
+steps:
+  - command: make
+`,
+			want: `{"notify":{"email":"a@b"},"steps":[{"command":"make"}]}`,
+		},
+		{
+			name: "pipeline email list",
+			input: `notify: [{email: [a, b]}, {slack: "#builds"}]
+steps:
+  - command: make
+`,
+			want: `{"notify":[{"email":["a","b"]},{"slack":"#builds"}],"steps":[{"command":"make"}]}`,
+		},
+		{
+			name: "step github_commit_status bool",
+			input: `steps:
+  - command: make
+    notify:
+      - github_commit_status: true
+`,
+			want: `{"steps":[{"command":"make","notify":[{"github_commit_status":true}]}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if !warning.Is(err) || !errors.Is(err, errUnsupportedNotifyType) {
+				t.Fatalf("Parse(input) error = %v, want a warning wrapping %v", err, errUnsupportedNotifyType)
+			}
+			if _, ok := p.Steps[0].(*CommandStep); !ok {
+				t.Errorf("p.Steps[0] = %T, want *CommandStep", p.Steps[0])
+			}
+
+			gotJSON, err := json.Marshal(p)
+			if err != nil {
+				t.Fatalf("json.Marshal(p) error = %v", err)
+			}
+			if diff := cmp.Diff(string(gotJSON), test.want); diff != "" {
+				t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+			}
+			if _, err := yaml.Marshal(p); err != nil {
+				t.Errorf("yaml.Marshal(p) error = %v", err)
+			}
+			if err := p.Validate(); !errors.Is(err, ErrInvalidNotify) {
+				t.Errorf("p.Validate() = %v, want %v", err, ErrInvalidNotify)
+			}
+		})
+	}
+}
+
+func TestNotifyInterpolation(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+notify:
+  - email: $EMAIL
+steps:
+  - command: make
+    notify:
+      - slack:
+          channels: ["$CHANNEL"]
+          message: Built $BRANCH
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	e := env.New(env.FromMap(map[string]string{
+		"EMAIL":   "dev@example.com",
+		"CHANNEL": "#builds",
+		"BRANCH":  "main",
+	}))
+	if err := p.Interpolate(e, false); err != nil {
+		t.Fatalf("p.Interpolate(env, false) error = %v", err)
+	}
+
+	if got, want := p.Notify[0].Email, "dev@example.com"; got != want {
+		t.Errorf("p.Notify[0].Email = %q, want %q", got, want)
+	}
+	slack := p.Steps[0].(*CommandStep).Notify[0].Slack
+	if diff := cmp.Diff(slack.Channels, []string{"#builds"}); diff != "" {
+		t.Errorf("slack.Channels diff (-got +want):\n%s", diff)
+	}
+	if got, want := slack.Message, "Built main"; got != want {
+		t.Errorf("slack.Message = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package ordered
+
+import "fmt"
+
+// CoercionPolicy controls how Unmarshal converts values that aren't strings
+// into strings, when unmarshaling into *string or *[]string. YAML users often
+// write values such as `label: 2025` or `branch: true`, which are decoded as
+// numbers and bools rather than strings.
+type CoercionPolicy int
+
+const (
+	// CoerceScalars converts numbers and bools into strings (with fmt.Sprint),
+	// as well as mappings, which are usually strings beginning with "{" that
+	// weren't quoted (see Unmarshal). This is the default.
+	CoerceScalars CoercionPolicy = iota
+
+	// CoerceStrict converts nothing: only strings can be unmarshaled into
+	// strings. Anything else causes an error wrapping ErrIncompatibleTypes
+	// (and, for values that CoerceScalars would convert, ErrNotCoerced).
+	CoerceStrict
+
+	// CoerceAll converts anything into strings, including sequences, which
+	// are written in YAML flow style, such as "[a, b]".
+	CoerceAll
+)
+
+// UnmarshalOption is a functional option for Unmarshal.
+type UnmarshalOption func(*unmarshalConfig)
+
+// unmarshalConfig holds the configuration built from UnmarshalOptions.
+type unmarshalConfig struct {
+	coercion CoercionPolicy
+
+	// source is the YAML text that src was decoded from, if known.
+	source []byte
+
+	// opts are the options the config was built from, for passing on to
+	// OptionsUnmarshalers.
+	opts []UnmarshalOption
+}
+
+// WithCoercion is an UnmarshalOption that sets the policy for converting
+// values into strings.
+func WithCoercion(policy CoercionPolicy) UnmarshalOption {
+	return func(cfg *unmarshalConfig) {
+		cfg.coercion = policy
+	}
+}
+
+// WithSource is an UnmarshalOption that provides the YAML text that src was
+// decoded from. With it, a mapping written in flow style that is converted
+// into a string becomes the text it was written as, quotes and spacing
+// included, rather than a string rebuilt from its decoded contents.
+func WithSource(source []byte) UnmarshalOption {
+	return func(cfg *unmarshalConfig) {
+		cfg.source = source
+	}
+}
+
+// OptionsUnmarshaler can be implemented by Unmarshalers that unmarshal their
+// contents with Unmarshal, to receive the options to pass on to it.
+type OptionsUnmarshaler interface {
+	// UnmarshalOrderedWith is UnmarshalOrdered, with the options that
+	// Unmarshal was called with.
+	UnmarshalOrderedWith(src any, opts ...UnmarshalOption) error
+}
+
+// isStringTarget reports whether dst is *string or *[]string, which are the
+// targets that values can be coerced into.
+func isStringTarget(dst any) bool {
+	switch dst.(type) {
+	case *string, *[]string:
+		return true
+	default:
+		return false
+	}
+}
+
+// notCoerced returns the error for a value that CoerceStrict doesn't convert
+// into a string.
+func notCoerced(src, dst any) error {
+	return fmt.Errorf("%w: %w: cannot unmarshal %T into %T", ErrIncompatibleTypes, ErrNotCoerced, src, dst)
+}
+
+// coerce converts src into a string, if dst is *string or *[]string, and
+// reports whether it did. The caller decides whether the policy allows it.
+func (cfg *unmarshalConfig) coerce(src, dst any) bool {
+	switch tdst := dst.(type) {
+	case *string:
+		*tdst = cfg.flowString(src)
+		return true
+
+	case *[]string:
+		*tdst = append(*tdst, cfg.flowString(src))
+		return true
+
+	default:
+		return false
+	}
+}
@@ -0,0 +1,144 @@
+package ordered
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnmarshalWithCoercion(t *testing.T) {
+	t.Parallel()
+
+	type target struct {
+		Label    string
+		Branches []string
+	}
+
+	tests := []struct {
+		desc    string
+		policy  CoercionPolicy
+		src     *MapSA
+		want    target
+		wantErr error
+	}{
+		{
+			desc:   "scalars: number and bool",
+			policy: CoerceScalars,
+			src: MapFromItems(
+				TupleSA{Key: "label", Value: 2025},
+				TupleSA{Key: "branches", Value: []any{true, 1.5, "main"}},
+			),
+			want: target{Label: "2025", Branches: []string{"true", "1.5", "main"}},
+		},
+		{
+			desc:    "scalars: mapping into string",
+			policy:  CoerceScalars,
+			src:     MapFromItems(TupleSA{Key: "label", Value: MapFromItems(TupleSA{Key: "fast", Value: nil})}),
+			want:    target{Label: "{fast}"},
+			wantErr: ErrMappingIntoString,
+		},
+		{
+			desc:    "scalars: sequence into string",
+			policy:  CoerceScalars,
+			src:     MapFromItems(TupleSA{Key: "label", Value: []any{"a", "b"}}),
+			wantErr: ErrIncompatibleTypes,
+		},
+		{
+			desc:    "scalars: mapping into []string",
+			policy:  CoerceScalars,
+			src:     MapFromItems(TupleSA{Key: "branches", Value: MapFromItems(TupleSA{Key: "a", Value: "b"})}),
+			wantErr: ErrIncompatibleTypes,
+		},
+		{
+			desc:   "strict: strings",
+			policy: CoerceStrict,
+			src: MapFromItems(
+				TupleSA{Key: "label", Value: "2025"},
+				TupleSA{Key: "branches", Value: "main"},
+			),
+			want: target{Label: "2025", Branches: []string{"main"}},
+		},
+		{
+			desc:    "strict: number",
+			policy:  CoerceStrict,
+			src:     MapFromItems(TupleSA{Key: "label", Value: 2025}),
+			wantErr: ErrNotCoerced,
+		},
+		{
+			desc:    "strict: bool in sequence",
+			policy:  CoerceStrict,
+			src:     MapFromItems(TupleSA{Key: "branches", Value: []any{"main", true}}),
+			wantErr: ErrNotCoerced,
+		},
+		{
+			desc:    "strict: mapping",
+			policy:  CoerceStrict,
+			src:     MapFromItems(TupleSA{Key: "label", Value: MapFromItems(TupleSA{Key: "fast", Value: nil})}),
+			wantErr: ErrNotCoerced,
+		},
+		{
+			desc:   "all",
+			policy: CoerceAll,
+			src: MapFromItems(
+				TupleSA{Key: "label", Value: []any{"a", MapFromItems(TupleSA{Key: "b", Value: 1})}},
+				TupleSA{Key: "branches", Value: MapFromItems(TupleSA{Key: "main", Value: nil})},
+			),
+			want: target{Label: "[a, {b: 1}]", Branches: []string{"{main}"}},
+		},
+		{
+			desc:   "all: sequence of strings",
+			policy: CoerceAll,
+			src:    MapFromItems(TupleSA{Key: "branches", Value: []any{"main", 1, []any{"a"}}}),
+			want:   target{Branches: []string{"main", "1", "[a]"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got target
+			err := Unmarshal(test.src, &got, WithCoercion(test.policy))
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Unmarshal(%v, &got, WithCoercion(%v)) error = %v, want %v", test.src, test.policy, err, test.wantErr)
+			}
+			if err != nil && !warning.Is(err) {
+				return
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("Unmarshal(%v, &got, WithCoercion(%v)) diff (-got +want):\n%s", test.src, test.policy, diff)
+			}
+		})
+	}
+}
+
+// coercionRecorder is an OptionsUnmarshaler that passes on its options.
+type coercionRecorder struct {
+	Inner struct{ Label string }
+}
+
+func (r *coercionRecorder) UnmarshalOrdered(src any) error {
+	return r.UnmarshalOrderedWith(src)
+}
+
+func (r *coercionRecorder) UnmarshalOrderedWith(src any, opts ...UnmarshalOption) error {
+	return Unmarshal(src, &r.Inner, opts...)
+}
+
+func TestUnmarshalWithCoercionPassedOn(t *testing.T) {
+	t.Parallel()
+
+	src := MapFromItems(TupleSA{Key: "nested", Value: MapFromItems(TupleSA{Key: "label", Value: 2025})})
+	var dst struct{ Nested coercionRecorder }
+	if err := Unmarshal(src, &dst, WithCoercion(CoerceStrict)); !errors.Is(err, ErrIncompatibleTypes) {
+		t.Errorf("Unmarshal(%v, &dst, WithCoercion(CoerceStrict)) error = %v, want %v", src, err, ErrIncompatibleTypes)
+	}
+	if err := Unmarshal(src, &dst); err != nil {
+		t.Errorf("Unmarshal(%v, &dst) error = %v", src, err)
+	}
+	if got, want := dst.Nested.Inner.Label, "2025"; got != want {
+		t.Errorf("dst.Nested.Inner.Label = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package ordered
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Encoder writes JSON values to an output stream. Unlike json.Marshal, which
+// builds the entire output in memory, Encoder writes ordered maps, other
+// maps with string keys, and slices one item at a time, so large structures
+// made from these are never held in memory as a whole. Other values
+// (including those that implement json.Marshaler) are marshaled with
+// json.Marshal and written out.
+//
+// The output is the same as json.Marshal's, including the order of ordered
+// map items.
+type Encoder struct {
+	w encoderWriter
+
+	// bw is the buffer wrapping the output stream, if it needed one.
+	bw *bufio.Writer
+}
+
+// encoderWriter is the interface Encoder writes to. *bytes.Buffer and
+// *bufio.Writer implement it.
+type encoderWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	// A bytes.Buffer never fails to write, and is already a buffer.
+	if b, ok := w.(*bytes.Buffer); ok {
+		return &Encoder{w: b}
+	}
+	bw := bufio.NewWriter(w)
+	return &Encoder{w: bw, bw: bw}
+}
+
+// Encode writes the JSON encoding of v to the stream. Unlike json.Encoder,
+// no newline is written after the value.
+func (e *Encoder) Encode(v any) error {
+	if err := e.encode(v); err != nil {
+		return err
+	}
+	if e.bw == nil {
+		return nil
+	}
+	return e.bw.Flush()
+}
+
+// jsonStreamer is implemented by *Map, whose type parameters can't be
+// matched in a type switch.
+type jsonStreamer interface {
+	encodeJSON(*Encoder) error
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// encode writes v. Errors writing to the underlying writer are held by the
+// bufio.Writer (if there is one) until Encode flushes it.
+func (e *Encoder) encode(v any) error {
+	switch v := v.(type) {
+	case nil:
+		e.w.WriteString("null")
+		return nil
+
+	case jsonStreamer:
+		return v.encodeJSON(e)
+
+	case json.Marshaler:
+		return e.marshal(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8:
+		// ([]byte is encoded as base64, so leave that to json.Marshal.)
+		if rv.IsNil() {
+			e.w.WriteString("null")
+			return nil
+		}
+		// Slice elements are addressable, so json.Marshal would use
+		// MarshalJSON methods with pointer receivers on them.
+		addr := rv.Type().Elem().Kind() != reflect.Pointer &&
+			reflect.PointerTo(rv.Type().Elem()).Implements(marshalerType)
+		e.w.WriteByte('[')
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			ev := rv.Index(i)
+			if addr {
+				ev = ev.Addr()
+			}
+			if err := e.encode(ev.Interface()); err != nil {
+				return err
+			}
+		}
+		e.w.WriteByte(']')
+		return nil
+
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		if rv.IsNil() {
+			e.w.WriteString("null")
+			return nil
+		}
+		// Like json.Marshal, write keys in sorted order.
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		e.w.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			if err := e.marshal(k); err != nil {
+				return err
+			}
+			e.w.WriteByte(':')
+			kv := reflect.ValueOf(k).Convert(rv.Type().Key())
+			if err := e.encode(rv.MapIndex(kv).Interface()); err != nil {
+				return err
+			}
+		}
+		e.w.WriteByte('}')
+		return nil
+
+	default:
+		return e.marshal(v)
+	}
+}
+
+// marshal writes v using json.Marshal.
+func (e *Encoder) marshal(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.w.Write(b)
+	return nil
+}
+
+// encodeJSON writes the map in order, as for MarshalJSON.
+func (m *Map[K, V]) encodeJSON(e *Encoder) error {
+	if m == nil {
+		// json.Marshal writes nil pointers as null without calling
+		// MarshalJSON.
+		e.w.WriteString("null")
+		return nil
+	}
+	e.w.WriteByte('{')
+	first := true
+	for k, v := range m.All() {
+		if !first {
+			e.w.WriteByte(',')
+		}
+		first = false
+		if err := e.marshal(k); err != nil {
+			return err
+		}
+		e.w.WriteByte(':')
+		if err := e.encode(v); err != nil {
+			return err
+		}
+	}
+	e.w.WriteByte('}')
+	return nil
+}
@@ -0,0 +1,101 @@
+package ordered
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type pointerMarshaler struct{ n int }
+
+func (p *pointerMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int{"pointer": p.n})
+}
+
+type failingMarshaler struct{}
+
+var errFailingMarshaler = errors.New("failed")
+
+func (failingMarshaler) MarshalJSON() ([]byte, error) { return nil, errFailingMarshaler }
+
+func TestEncoder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc  string
+		input any
+	}{
+		{
+			desc:  "Nil",
+			input: nil,
+		},
+		{
+			desc:  "Nil map",
+			input: (*MapSA)(nil),
+		},
+		{
+			desc: "Nested maps",
+			input: MapFromItems(
+				TupleSA{
+					Key: "llama",
+					Value: MapFromItems(
+						TupleSS{Key: "Kuzco", Value: "Emperor"},
+						TupleSS{Key: "Geronimo", Value: "<Incredible>"},
+					),
+				},
+				TupleSA{Key: "alpaca", Value: []any{"drama", 1, 2.5, true, nil}},
+				TupleSA{Key: "empty", Value: NewMap[string, any](0)},
+			),
+		},
+		{
+			desc: "Plain maps and slices",
+			input: map[string]any{
+				"zebra":    []string{"a", "b"},
+				"aardvark": map[string]any{"y": 1, "x": []any{}},
+				"bytes":    []byte("hello"),
+				"nil":      []any(nil),
+				"nilmap":   map[string]string(nil),
+			},
+		},
+		{
+			desc:  "Pointer receiver marshalers in slices",
+			input: []pointerMarshaler{{n: 1}, {n: 2}},
+		},
+		{
+			desc:  "Structs",
+			input: []any{struct{ A, B int }{A: 1, B: 2}, &struct{ C string }{C: "&"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			want, err := json.Marshal(test.input)
+			if err != nil {
+				t.Fatalf("json.Marshal(%v) error = %v", test.input, err)
+			}
+
+			var got bytes.Buffer
+			if err := NewEncoder(&got).Encode(test.input); err != nil {
+				t.Fatalf("NewEncoder(&got).Encode(%v) error = %v", test.input, err)
+			}
+			if diff := cmp.Diff(got.String(), string(want)); diff != "" {
+				t.Errorf("encoded JSON diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEncoderError(t *testing.T) {
+	t.Parallel()
+
+	input := MapFromItems(TupleSA{Key: "bad", Value: []any{failingMarshaler{}}})
+	err := NewEncoder(new(bytes.Buffer)).Encode(input)
+	if !errors.Is(err, errFailingMarshaler) {
+		t.Errorf("NewEncoder(&b).Encode(input) error = %v, want %v", err, errFailingMarshaler)
+	}
+}
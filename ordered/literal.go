@@ -0,0 +1,120 @@
+package ordered
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// These helpers build ordered structures from Go and YAML literals. They are
+// intended for tests, where writing out long chains of TupleSA gets tedious,
+// and they panic on bad input rather than returning errors.
+
+// MustMapSA returns a *MapSA containing the items of m. The keys named in
+// keyOrder come first, in that order, followed by the rest of the keys in
+// sorted order. Values that are map[string]any (including those within
+// []any) are converted to *MapSA recursively, with their keys in sorted order;
+// to control their order, use MustMapSA for them too. MustMapSA panics if
+// keyOrder contains a key that is not in m, or contains a key more than once.
+func MustMapSA(m map[string]any, keyOrder ...string) *MapSA {
+	out := NewMap[string, any](len(m))
+	for _, k := range keyOrder {
+		v, ok := m[k]
+		if !ok {
+			panic(fmt.Sprintf("ordered.MustMapSA: key %q in keyOrder is not in the map", k))
+		}
+		if out.Contains(k) {
+			panic(fmt.Sprintf("ordered.MustMapSA: key %q appears in keyOrder more than once", k))
+		}
+		out.Set(k, literalValue(v))
+	}
+
+	rest := make([]string, 0, len(m)-out.Len())
+	for k := range m {
+		if !out.Contains(k) {
+			rest = append(rest, k)
+		}
+	}
+	slices.Sort(rest)
+	for _, k := range rest {
+		out.Set(k, literalValue(m[k]))
+	}
+	return out
+}
+
+// literalValue converts map[string]any within v to *MapSA.
+func literalValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return MustMapSA(v)
+
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = literalValue(e)
+		}
+		return out
+
+	default:
+		return v
+	}
+}
+
+// MustDecodeYAMLString decodes a YAML document into a generic value, as
+// DecodeYAML does (so mappings become *MapSA, in order). Common leading
+// indentation is removed from each line first, so that src can be an indented
+// raw string literal. MustDecodeYAMLString panics if src is not valid YAML.
+func MustDecodeYAMLString(src string) any {
+	n := new(yaml.Node)
+	if err := yaml.Unmarshal([]byte(dedent(src)), n); err != nil {
+		panic(fmt.Sprintf("ordered.MustDecodeYAMLString: %v", err))
+	}
+	v, err := DecodeYAML(n)
+	if err != nil {
+		panic(fmt.Sprintf("ordered.MustDecodeYAMLString: %v", err))
+	}
+	return v
+}
+
+// MustMapSAFromYAML is MustDecodeYAMLString for documents that are mappings.
+// It panics if the document is not a mapping.
+func MustMapSAFromYAML(src string) *MapSA {
+	v := MustDecodeYAMLString(src)
+	m, ok := v.(*MapSA)
+	if !ok {
+		panic(fmt.Sprintf("ordered.MustMapSAFromYAML: document decoded to %T, not a mapping", v))
+	}
+	return m
+}
+
+// dedent removes the longest common leading whitespace from the non-blank
+// lines of s, and empties the blank lines.
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	prefix := ""
+	first := true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		switch {
+		case first:
+			prefix, first = indent, false
+		default:
+			for !strings.HasPrefix(indent, prefix) {
+				prefix = prefix[:len(prefix)-1]
+			}
+		}
+	}
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = strings.TrimPrefix(l, prefix)
+	}
+	return strings.Join(lines, "\n")
+}
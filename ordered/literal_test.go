@@ -0,0 +1,98 @@
+package ordered
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMustMapSA(t *testing.T) {
+	t.Parallel()
+
+	got := MustMapSA(map[string]any{
+		"steps": []any{map[string]any{"label": "Test", "command": "make"}},
+		"env":   MustMapSA(map[string]any{"B": "2", "A": "1"}, "B"),
+		"agents": map[string]any{
+			"queue": "default",
+		},
+	}, "env", "steps")
+
+	want := MapFromItems(
+		TupleSA{Key: "env", Value: MapFromItems(
+			TupleSA{Key: "B", Value: "2"},
+			TupleSA{Key: "A", Value: "1"},
+		)},
+		TupleSA{Key: "steps", Value: []any{MapFromItems(
+			TupleSA{Key: "command", Value: "make"},
+			TupleSA{Key: "label", Value: "Test"},
+		)}},
+		TupleSA{Key: "agents", Value: MapFromItems(
+			TupleSA{Key: "queue", Value: "default"},
+		)},
+	)
+	if diff := cmp.Diff(got, want, cmp.Comparer(Equal[string, any])); diff != "" {
+		t.Errorf("MustMapSA(...) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestMustMapSAPanics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc     string
+		keyOrder []string
+	}{
+		{desc: "missing key", keyOrder: []string{"nope"}},
+		{desc: "repeated key", keyOrder: []string{"a", "a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			defer func() {
+				if recover() == nil {
+					t.Errorf("MustMapSA(m, %q...) did not panic", test.keyOrder)
+				}
+			}()
+			MustMapSA(map[string]any{"a": 1}, test.keyOrder...)
+		})
+	}
+}
+
+func TestMustDecodeYAMLString(t *testing.T) {
+	t.Parallel()
+
+	got := MustMapSAFromYAML(`
+		steps:
+		  - command: make
+		    label: Test
+		env:
+		  ZED: last
+		  ALPHA: first
+	`)
+	want := MapFromItems(
+		TupleSA{Key: "steps", Value: []any{MapFromItems(
+			TupleSA{Key: "command", Value: "make"},
+			TupleSA{Key: "label", Value: "Test"},
+		)}},
+		TupleSA{Key: "env", Value: MapFromItems(
+			TupleSA{Key: "ZED", Value: "last"},
+			TupleSA{Key: "ALPHA", Value: "first"},
+		)},
+	)
+	if diff := cmp.Diff(got, want, cmp.Comparer(Equal[string, any])); diff != "" {
+		t.Errorf("MustMapSAFromYAML(...) diff (-got +want):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(MustDecodeYAMLString("[1, two]"), []any{1, "two"}); diff != "" {
+		t.Errorf("MustDecodeYAMLString(%q) diff (-got +want):\n%s", "[1, two]", diff)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustMapSAFromYAML(%q) did not panic", "- a")
+		}
+	}()
+	MustMapSAFromYAML("- a")
+}
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"iter"
+	"reflect"
 
 	"github.com/google/go-cmp/cmp"
 	"gopkg.in/yaml.v3"
@@ -21,9 +23,21 @@ var _ interface {
 // Map is an order-preserving map with string keys. It is intended for working
 // with YAML in an order-preserving way (off-spec, strictly speaking) and JSON
 // (more of the same).
+//
+// A Map is safe for concurrent use by multiple goroutines provided none of
+// them modify it. The methods that only read the map (such as Get, All,
+// Clone, and MarshalJSON) never modify it, but methods that modify it (such
+// as Set, Delete, and the Unmarshal methods) need exclusive access. To share
+// a map between goroutines that modify it, give each its own copy with Clone,
+// or wrap the map with Sync.
 type Map[K comparable, V any] struct {
 	items []Tuple[K, V]
 	index map[K]int
+
+	// flow is the position of the map in the YAML it was decoded from, if
+	// it was written in flow style (such as "{a: b}"), so that it can be
+	// turned back into the text it was written as (see WithSource).
+	flow *sourcePos
 }
 
 // MapSS is a convenience alias to reduce keyboard wear.
@@ -177,10 +191,9 @@ func (m *Map[K, V]) ToMap() map[K]V {
 		return nil
 	}
 	um := make(map[K]V, len(m.index))
-	m.Range(func(k K, v V) error {
+	for k, v := range m.All() {
 		um[k] = v
-		return nil
-	})
+	}
 	return um
 }
 
@@ -192,10 +205,9 @@ func ToMapRecursive(src any) any {
 	switch tsrc := src.(type) {
 	case *Map[string, any]:
 		um := make(map[string]any, len(tsrc.index))
-		tsrc.Range(func(k string, v any) error {
+		for k, v := range tsrc.All() {
 			um[k] = ToMapRecursive(v)
-			return nil
-		})
+		}
 		return um
 
 	case []any:
@@ -279,59 +291,124 @@ func (m *Map[K, V]) Range(f func(k K, v V) error) error {
 	return nil
 }
 
+// All returns an iterator over the items of the map (in order). As with
+// Range, items added while iterating are not visited.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if m.IsZero() {
+			return
+		}
+		for _, p := range m.items {
+			if p.deleted {
+				continue
+			}
+			if !yield(p.Key, p.Value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the map (in order).
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range m.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over the values of the map (in order).
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range m.All() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
 // MarshalJSON marshals the ordered map to JSON. It preserves the map order in
-// the output.
+// the output. Nested ordered maps, and slices and maps containing them, are
+// written directly into the output by an Encoder, rather than being marshaled
+// separately and copied in.
 func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
 	// NB: writes to b don't error, but JSON encoding could error.
 	var b bytes.Buffer
-	b.WriteRune('{')
-	first := true
-	err := m.Range(func(k K, v V) error {
-		if !first {
-			// Separating comma.
-			b.WriteRune(',')
-		}
-		first = false
-		bk, err := json.Marshal(k)
-		if err != nil {
-			return err
-		}
-		b.Write(bk)
-		b.WriteRune(':')
-		bv, err := json.Marshal(v)
-		if err != nil {
-			return err
-		}
-		b.Write(bv)
-		return nil
-	})
-	if err != nil {
+	if err := NewEncoder(&b).Encode(m); err != nil {
 		return nil, err
 	}
-	b.WriteRune('}')
 	return b.Bytes(), nil
 }
 
 // MarshalYAML returns a *yaml.Node encoding this map (in order), or an error
 // if any of the items could not be encoded into a *yaml.Node.
 func (m *Map[K, V]) MarshalYAML() (any, error) {
+	return m.yamlNode()
+}
+
+// yamlNode builds a *yaml.Node encoding this map directly, rather than via
+// (*yaml.Node).Encode, which would re-encode nested maps once per level.
+func (m *Map[K, V]) yamlNode() (*yaml.Node, error) {
 	n := &yaml.Node{
 		Kind: yaml.MappingNode,
 		Tag:  "!!map",
 	}
-	err := m.Range(func(k K, v V) error {
-		nk, nv := new(yaml.Node), new(yaml.Node)
-		if err := nk.Encode(k); err != nil {
-			return err
+	for k, v := range m.All() {
+		nk, err := yamlNode(k)
+		if err != nil {
+			return nil, err
 		}
-		if err := nv.Encode(v); err != nil {
-			return err
+		nv, err := yamlNode(v)
+		if err != nil {
+			return nil, err
 		}
 		n.Content = append(n.Content, nk, nv)
-		return nil
-	})
+	}
+	return n, nil
+}
+
+// yamlNoder is implemented by *Map, whose type parameters can't be matched
+// in a type switch.
+type yamlNoder interface {
+	yamlNode() (*yaml.Node, error)
+}
 
-	if err != nil {
+// yamlNode encodes v into a *yaml.Node. Encoding with (*yaml.Node).Encode
+// involves emitting the value as YAML text and parsing it again, so nested
+// ordered maps and []any are built directly instead, to avoid repeating that
+// at every level of nesting. The result is the same.
+func yamlNode(v any) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case []any:
+		n := &yaml.Node{
+			Kind: yaml.SequenceNode,
+			Tag:  "!!seq",
+		}
+		for _, e := range v {
+			ne, err := yamlNode(e)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, ne)
+		}
+		return n, nil
+
+	case yamlNoder:
+		// A nil *Map is encoded as null, as for other nil pointers.
+		if !reflect.ValueOf(v).IsNil() {
+			return v.yamlNode()
+		}
+	}
+
+	n := new(yaml.Node)
+	if err := n.Encode(v); err != nil {
 		return nil, err
 	}
 	return n, nil
@@ -401,23 +478,22 @@ func (m *Map[K, V]) UnmarshalYAML(n *yaml.Node) error {
 // assertable to V.
 func AssertValues[V any](m *MapSA) (*Map[string, V], error) {
 	msv := NewMap[string, V](m.Len())
-	return msv, m.Range(func(k string, v any) error {
+	for k, v := range m.All() {
 		t, ok := v.(V)
 		if !ok {
-			return fmt.Errorf("value for key %q (type %T) is not assertable to %T", k, v, t)
+			return msv, fmt.Errorf("value for key %q (type %T) is not assertable to %T", k, v, t)
 		}
 		msv.Set(k, t)
-		return nil
-	})
+	}
+	return msv, nil
 }
 
 // TransformValues converts a map with V1 values into a map with V2 values by
 // running each value through a function.
 func TransformValues[K comparable, V1, V2 any](m *Map[K, V1], f func(V1) V2) *Map[K, V2] {
 	m2 := NewMap[K, V2](m.Len())
-	m.Range(func(k K, v V1) error {
+	for k, v := range m.All() {
 		m2.Set(k, f(v))
-		return nil
-	})
+	}
 	return m2
 }
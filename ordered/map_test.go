@@ -2,6 +2,7 @@ package ordered
 
 import (
 	"encoding/json"
+	"slices"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -287,6 +288,62 @@ func TestMapDelete(t *testing.T) {
 	}
 }
 
+func TestMapIterators(t *testing.T) {
+	t.Parallel()
+
+	m := MapFromItems(
+		TupleSS{Key: "llama", Value: "Kuzco"},
+		TupleSS{Key: "alpaca", Value: "drama"},
+		TupleSS{Key: "vicuña", Value: "wool"},
+	)
+	m.Delete("alpaca")
+	m.Set("guanaco", "wild")
+
+	var gotAll []TupleSS
+	for k, v := range m.All() {
+		gotAll = append(gotAll, TupleSS{Key: k, Value: v})
+	}
+	wantAll := []TupleSS{
+		{Key: "llama", Value: "Kuzco"},
+		{Key: "vicuña", Value: "wool"},
+		{Key: "guanaco", Value: "wild"},
+	}
+	if diff := cmp.Diff(gotAll, wantAll, cmp.AllowUnexported(TupleSS{})); diff != "" {
+		t.Errorf("m.All() diff (-got +want):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(slices.Collect(m.Keys()), []string{"llama", "vicuña", "guanaco"}); diff != "" {
+		t.Errorf("m.Keys() diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(slices.Collect(m.Values()), []string{"Kuzco", "wool", "wild"}); diff != "" {
+		t.Errorf("m.Values() diff (-got +want):\n%s", diff)
+	}
+
+	// Stopping early.
+	var first []string
+	for k := range m.Keys() {
+		first = append(first, k)
+		break
+	}
+	if diff := cmp.Diff(first, []string{"llama"}); diff != "" {
+		t.Errorf("first of m.Keys() diff (-got +want):\n%s", diff)
+	}
+
+	// Adding items while iterating doesn't visit them.
+	var visited []string
+	for k := range m.Keys() {
+		visited = append(visited, k)
+		m.Set(k+"-copy", "")
+	}
+	if diff := cmp.Diff(visited, []string{"llama", "vicuña", "guanaco"}); diff != "" {
+		t.Errorf("m.Keys() while adding diff (-got +want):\n%s", diff)
+	}
+
+	for k, v := range (*MapSS)(nil).All() {
+		t.Errorf("(*MapSS)(nil).All() yielded %q, %q, want nothing", k, v)
+	}
+}
+
 func TestMarshalJSON(t *testing.T) {
 	t.Parallel()
 
@@ -335,6 +392,23 @@ func TestMarshalJSON(t *testing.T) {
 			),
 			want: `{"llama":{"Kuzco":"Emperor","Geronimo":"Incredible"},"alpaca":"drama"}`,
 		},
+		{
+			desc: "Maps within sequences",
+			input: MapFromItems(
+				TupleSA{Key: "steps", Value: []any{
+					MapFromItems(
+						TupleSA{Key: "command", Value: "echo <hello> & goodbye"},
+						TupleSA{Key: "parallelism", Value: 2},
+						TupleSA{Key: "soft_fail", Value: true},
+						TupleSA{Key: "env", Value: (*MapSA)(nil)},
+					),
+					"wait",
+					nil,
+					[]any{1.5, "true"},
+				}},
+			),
+			want: `{"steps":[{"command":"echo \u003chello\u003e \u0026 goodbye","parallelism":2,"soft_fail":true,"env":null},"wait",null,[1.5,"true"]]}`,
+		},
 	}
 
 	for _, test := range tests {
@@ -439,6 +513,38 @@ func TestMarshalYAML(t *testing.T) {
     Kuzco: Emperor
     Geronimo: Incredible
 alpaca: drama
+`,
+		},
+		{
+			desc: "Maps within sequences",
+			input: MapFromItems(
+				TupleSA{Key: "steps", Value: []any{
+					MapFromItems(
+						TupleSA{Key: "command", Value: "echo hello\necho goodbye\n"},
+						TupleSA{Key: "label", Value: "a: b"},
+						TupleSA{Key: "parallelism", Value: 2},
+						TupleSA{Key: "soft_fail", Value: "true"},
+						TupleSA{Key: "env", Value: (*MapSA)(nil)},
+					),
+					"wait",
+					nil,
+					[]any{1.5, "1"},
+					[]any{},
+				}},
+			),
+			want: `steps:
+    - command: |
+        echo hello
+        echo goodbye
+      label: 'a: b'
+      parallelism: 2
+      soft_fail: "true"
+      env: null
+    - wait
+    - null
+    - - 1.5
+      - "1"
+    - []
 `,
 		},
 	}
@@ -0,0 +1,134 @@
+package ordered
+
+import (
+	"encoding/json"
+	"iter"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var _ interface {
+	json.Marshaler
+	yaml.Marshaler
+} = (*SyncMap[string, any])(nil)
+
+// Clone returns a shallow copy of the map: modifying the copy doesn't modify
+// m, but values are copied as they are (so, for example, a nested *Map is
+// shared).
+func (m *Map[K, V]) Clone() *Map[K, V] {
+	if m == nil {
+		return nil
+	}
+	out := NewMap[K, V](len(m.index))
+	for k, v := range m.All() {
+		out.Set(k, v)
+	}
+	return out
+}
+
+// SyncMap wraps a Map with a lock, so that it is safe for concurrent use by
+// multiple goroutines that modify it. The zero value is an empty map ready to
+// use.
+type SyncMap[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  *Map[K, V]
+}
+
+// Sync returns a SyncMap wrapping m. m shouldn't be used directly afterwards,
+// since the lock can't protect it from that.
+func (m *Map[K, V]) Sync() *SyncMap[K, V] {
+	return &SyncMap[K, V]{m: m}
+}
+
+// Len returns the number of items in the map.
+func (s *SyncMap[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m.Len()
+}
+
+// Get retrieves the value associated with a key, and reports whether it was
+// present.
+func (s *SyncMap[K, V]) Get(k K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m.Get(k)
+}
+
+// Contains reports if the map contains the key.
+func (s *SyncMap[K, V]) Contains(k K) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m.Contains(k)
+}
+
+// Set sets the value for the given key. If the key exists, it remains in its
+// existing spot, otherwise it is added to the end of the map.
+func (s *SyncMap[K, V]) Set(k K, v V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = NewMap[K, V](1)
+	}
+	s.m.Set(k, v)
+}
+
+// Replace replaces an old key in the same spot with a new key and value (see
+// Map.Replace).
+func (s *SyncMap[K, V]) Replace(old, new K, v V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = NewMap[K, V](1)
+	}
+	s.m.Replace(old, new, v)
+}
+
+// Delete deletes a key from the map. It does nothing if the key is not in the
+// map.
+func (s *SyncMap[K, V]) Delete(k K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		return
+	}
+	s.m.Delete(k)
+}
+
+// Snapshot returns a copy of the map (see Map.Clone) as it is now, which the
+// caller can read or modify without locking.
+func (s *SyncMap[K, V]) Snapshot() *Map[K, V] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.m == nil {
+		return NewMap[K, V](0)
+	}
+	return s.m.Clone()
+}
+
+// All returns an iterator over a snapshot of the items in the map, in order.
+// The lock is not held while iterating.
+func (s *SyncMap[K, V]) All() iter.Seq2[K, V] {
+	return s.Snapshot().All()
+}
+
+// MarshalJSON marshals the map to JSON (see Map.MarshalJSON).
+func (s *SyncMap[K, V]) MarshalJSON() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.m == nil {
+		return []byte("{}"), nil
+	}
+	return s.m.MarshalJSON()
+}
+
+// MarshalYAML returns a *yaml.Node encoding the map (see Map.MarshalYAML).
+func (s *SyncMap[K, V]) MarshalYAML() (any, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.m == nil {
+		return NewMap[K, V](0).MarshalYAML()
+	}
+	return s.m.MarshalYAML()
+}
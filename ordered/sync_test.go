@@ -0,0 +1,152 @@
+package ordered
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+// The concurrency tests in this file are most useful under the race detector
+// (go test -race).
+
+func TestMapConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	m := MustMapSAFromYAML(`
+		a: 1
+		b: [x, y]
+		c:
+		  d: e
+	`)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := m.Get("a"); !ok {
+				t.Error(`m.Get("a") ok = false, want true`)
+			}
+			if got, want := slices.Collect(m.Keys()), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+				t.Errorf("slices.Collect(m.Keys()) = %q, want %q", got, want)
+			}
+			if _, err := json.Marshal(m); err != nil {
+				t.Errorf("json.Marshal(m) error = %v", err)
+			}
+			if _, err := yaml.Marshal(m); err != nil {
+				t.Errorf("yaml.Marshal(m) error = %v", err)
+			}
+			// Modifying a clone doesn't touch m.
+			c := m.Clone()
+			c.Set("z", 26)
+			c.Delete("a")
+		}()
+	}
+	wg.Wait()
+
+	if diff := cmp.Diff(slices.Collect(m.Keys()), []string{"a", "b", "c"}); diff != "" {
+		t.Errorf("m.Keys() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestMapClone(t *testing.T) {
+	t.Parallel()
+
+	m := MapFromItems(
+		TupleSS{Key: "llama", Value: "Kuzco"},
+		TupleSS{Key: "alpaca", Value: "Geronimo"},
+		TupleSS{Key: "camel", Value: "Humphrey"},
+	)
+	m.Delete("alpaca")
+
+	c := m.Clone()
+	c.Set("llama", "Kronk")
+	c.Set("alpaca", "Pacha")
+
+	if diff := cmp.Diff(m, MapFromItems(
+		TupleSS{Key: "llama", Value: "Kuzco"},
+		TupleSS{Key: "camel", Value: "Humphrey"},
+	), cmp.Comparer(Equal[string, string])); diff != "" {
+		t.Errorf("original after modifying clone diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(c, MapFromItems(
+		TupleSS{Key: "llama", Value: "Kronk"},
+		TupleSS{Key: "camel", Value: "Humphrey"},
+		TupleSS{Key: "alpaca", Value: "Pacha"},
+	), cmp.Comparer(Equal[string, string])); diff != "" {
+		t.Errorf("clone diff (-got +want):\n%s", diff)
+	}
+
+	if got := (*MapSS)(nil).Clone(); got != nil {
+		t.Errorf("(*MapSS)(nil).Clone() = %v, want nil", got)
+	}
+}
+
+func TestSyncMapConcurrentWrites(t *testing.T) {
+	t.Parallel()
+
+	s := new(SyncMap[string, int])
+	const n = 100
+
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range n {
+				k := fmt.Sprintf("%d-%d", g, i)
+				s.Set(k, i)
+				if _, ok := s.Get(k); !ok {
+					t.Errorf("s.Get(%q) ok = false, want true", k)
+				}
+				if i%2 == 1 {
+					s.Delete(k)
+				}
+				for range s.All() {
+				}
+				if _, err := json.Marshal(s); err != nil {
+					t.Errorf("json.Marshal(s) error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := s.Len(), 4*n/2; got != want {
+		t.Errorf("s.Len() = %d, want %d", got, want)
+	}
+}
+
+func TestSyncMapMarshal(t *testing.T) {
+	t.Parallel()
+
+	s := MapFromItems(TupleSA{Key: "llama", Value: "Kuzco"}).Sync()
+	s.Replace("llama", "alpaca", "Geronimo")
+	s.Set("camel", "Humphrey")
+
+	gotJSON, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("json.Marshal(s) error = %v", err)
+	}
+	if diff := cmp.Diff(string(gotJSON), `{"alpaca":"Geronimo","camel":"Humphrey"}`); diff != "" {
+		t.Errorf("json.Marshal(s) diff (-got +want):\n%s", diff)
+	}
+
+	gotYAML, err := yaml.Marshal(s)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(s) error = %v", err)
+	}
+	if diff := cmp.Diff(string(gotYAML), "alpaca: Geronimo\ncamel: Humphrey\n"); diff != "" {
+		t.Errorf("yaml.Marshal(s) diff (-got +want):\n%s", diff)
+	}
+
+	var zero SyncMap[string, any]
+	if got, err := json.Marshal(&zero); err != nil || string(got) != "{}" {
+		t.Errorf("json.Marshal(&zero) = %s, %v, want {}, nil", got, err)
+	}
+}
@@ -0,0 +1,204 @@
+package ordered
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidByteSize is returned (wrapped) when a byte size can't be parsed.
+var ErrInvalidByteSize = errors.New("invalid byte size")
+
+// Duration is a time.Duration that is written as a duration string, such as
+// "10m" or "1h30m" (see time.ParseDuration). It can be unmarshaled with
+// Unmarshal, JSON, or YAML, and marshals back to the string it was unmarshaled
+// from, so that documents round-trip unaltered.
+type Duration struct {
+	time.Duration
+
+	// text is the string the duration was parsed from, if any.
+	text string
+}
+
+// ParseDuration parses a duration string into a Duration.
+func ParseDuration(s string) (Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return Duration{}, err
+	}
+	return Duration{Duration: d, text: s}, nil
+}
+
+// String returns the string the duration was parsed from, or if it wasn't
+// parsed, the time.Duration formatting of it.
+func (d Duration) String() string {
+	if d.text != "" {
+		return d.text
+	}
+	return d.Duration.String()
+}
+
+// IsZero reports if the duration is zero and wasn't parsed from a string, for
+// omitempty.
+func (d Duration) IsZero() bool { return d.Duration == 0 && d.text == "" }
+
+// MarshalText returns the duration string.
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText parses a duration string.
+func (d *Duration) UnmarshalText(b []byte) error {
+	pd, err := ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = pd
+	return nil
+}
+
+// UnmarshalOrdered unmarshals a duration string. nil unmarshals as zero.
+func (d *Duration) UnmarshalOrdered(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*d = Duration{}
+		return nil
+
+	case string:
+		return d.UnmarshalText([]byte(src))
+
+	default:
+		return fmt.Errorf("%w: cannot unmarshal %T into %T", ErrIncompatibleTypes, src, d)
+	}
+}
+
+// ByteSize is a number of bytes that is written either as an integer, or as a
+// size string with a unit suffix, such as "512k", "25g", or "1.5GiB". Units
+// are case-insensitive powers of 1024: k, m, g, t, and p, each optionally
+// followed by "b" or "ib". A trailing "b" alone means bytes. It can be
+// unmarshaled with Unmarshal, JSON, or YAML, and marshals back to the form it
+// was unmarshaled from, so that documents round-trip unaltered.
+type ByteSize struct {
+	Bytes int64
+
+	// text is the size string the size was parsed from, if any.
+	text string
+}
+
+// byteSizeUnits maps unit prefixes to their multipliers.
+var byteSizeUnits = map[string]float64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+	"p": 1 << 50,
+}
+
+// ParseByteSize parses a size string into a ByteSize.
+func ParseByteSize(s string) (ByteSize, error) {
+	num := strings.TrimSpace(s)
+	unit := strings.TrimLeft(num, "0123456789.")
+	num = num[:len(num)-len(unit)]
+
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	unit = strings.TrimSuffix(unit, "b")
+	unit = strings.TrimSuffix(unit, "i")
+	mult, ok := byteSizeUnits[unit]
+	if !ok || unit == "" && strings.HasSuffix(strings.ToLower(s), "ib") {
+		return ByteSize{}, fmt.Errorf("%w %q: unknown unit", ErrInvalidByteSize, s)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return ByteSize{}, fmt.Errorf("%w %q", ErrInvalidByteSize, s)
+	}
+	b := math.Round(n * mult)
+	if b >= math.MaxInt64 {
+		return ByteSize{}, fmt.Errorf("%w %q: too large", ErrInvalidByteSize, s)
+	}
+	return ByteSize{Bytes: int64(b), text: s}, nil
+}
+
+// String returns the size string the size was parsed from, or if it wasn't
+// parsed from a string, the number of bytes.
+func (b ByteSize) String() string {
+	if b.text != "" {
+		return b.text
+	}
+	return strconv.FormatInt(b.Bytes, 10)
+}
+
+// IsZero reports if the size is zero and wasn't parsed from a string, for
+// omitempty.
+func (b ByteSize) IsZero() bool { return b.Bytes == 0 && b.text == "" }
+
+// MarshalJSON returns the size as a JSON string if it was parsed from a
+// string, or a JSON number otherwise.
+func (b ByteSize) MarshalJSON() ([]byte, error) {
+	if b.text != "" {
+		return json.Marshal(b.text)
+	}
+	return json.Marshal(b.Bytes)
+}
+
+// UnmarshalJSON unmarshals a size string or a number of bytes.
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return b.UnmarshalOrdered(s)
+	}
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("%w %s", ErrInvalidByteSize, data)
+	}
+	*b = ByteSize{Bytes: n}
+	return nil
+}
+
+// MarshalYAML returns the size string if it was parsed from a string, or the
+// number of bytes otherwise.
+func (b ByteSize) MarshalYAML() (any, error) {
+	if b.text != "" {
+		return b.text, nil
+	}
+	return b.Bytes, nil
+}
+
+// UnmarshalYAML unmarshals a size string or a number of bytes.
+func (b *ByteSize) UnmarshalYAML(n *yaml.Node) error {
+	var src any
+	if err := n.Decode(&src); err != nil {
+		return err
+	}
+	return b.UnmarshalOrdered(src)
+}
+
+// UnmarshalOrdered unmarshals a size string or a number of bytes. nil
+// unmarshals as zero.
+func (b *ByteSize) UnmarshalOrdered(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*b = ByteSize{}
+		return nil
+
+	case int:
+		*b = ByteSize{Bytes: int64(src)}
+		return nil
+
+	case string:
+		pb, err := ParseByteSize(src)
+		if err != nil {
+			return err
+		}
+		*b = pb
+		return nil
+
+	default:
+		return fmt.Errorf("%w: cannot unmarshal %T into %T", ErrIncompatibleTypes, src, b)
+	}
+}
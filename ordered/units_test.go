@@ -0,0 +1,166 @@
+package ordered
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{input: "0", want: 0},
+		{input: "1024", want: 1024},
+		{input: "100b", want: 100},
+		{input: "512k", want: 512 << 10},
+		{input: "512KB", want: 512 << 10},
+		{input: "25g", want: 25 << 30},
+		{input: "25 G", want: 25 << 30},
+		{input: "1.5GiB", want: 3 << 29},
+		{input: "2t", want: 2 << 40},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseByteSize(test.input)
+			if err != nil {
+				t.Fatalf("ParseByteSize(%q) error = %v", test.input, err)
+			}
+			if got.Bytes != test.want {
+				t.Errorf("ParseByteSize(%q).Bytes = %d, want %d", test.input, got.Bytes, test.want)
+			}
+			if got.String() != test.input {
+				t.Errorf("ParseByteSize(%q).String() = %q, want %q", test.input, got.String(), test.input)
+			}
+		})
+	}
+}
+
+func TestParseByteSizeErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"", "g", "25x", "25ib", "25gbb", "-1k", "1e3", "99999999p"} {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+			if _, err := ParseByteSize(input); !errors.Is(err, ErrInvalidByteSize) {
+				t.Errorf("ParseByteSize(%q) error = %v, want %v", input, err, ErrInvalidByteSize)
+			}
+		})
+	}
+}
+
+type unitsTarget struct {
+	Timeout    Duration      `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Size       ByteSize      `yaml:"size,omitempty" json:"size,omitempty"`
+	MaxSize    ByteSize      `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	PlainDelay time.Duration `yaml:"plain_delay,omitempty" json:"-"`
+}
+
+func TestUnmarshalUnits(t *testing.T) {
+	t.Parallel()
+
+	src := MapFromItems(
+		TupleSA{Key: "timeout", Value: "1h30m"},
+		TupleSA{Key: "size", Value: "25g"},
+		TupleSA{Key: "max_size", Value: 4096},
+		TupleSA{Key: "plain_delay", Value: "10m"},
+	)
+	var got unitsTarget
+	if err := Unmarshal(src, &got); err != nil {
+		t.Fatalf("Unmarshal(%v, &got) error = %v", src, err)
+	}
+
+	if got, want := got.Timeout.Duration, 90*time.Minute; got != want {
+		t.Errorf("got.Timeout.Duration = %v, want %v", got, want)
+	}
+	if got, want := got.Size.Bytes, int64(25<<30); got != want {
+		t.Errorf("got.Size.Bytes = %d, want %d", got, want)
+	}
+	if got, want := got.MaxSize.Bytes, int64(4096); got != want {
+		t.Errorf("got.MaxSize.Bytes = %d, want %d", got, want)
+	}
+	if got, want := got.PlainDelay, 10*time.Minute; got != want {
+		t.Errorf("got.PlainDelay = %v, want %v", got, want)
+	}
+
+	// Marshaling gives back the original representations.
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("json.Marshal(got) error = %v", err)
+	}
+	const wantJSON = `{"timeout":"1h30m","size":"25g","max_size":4096}`
+	if diff := cmp.Diff(string(gotJSON), wantJSON); diff != "" {
+		t.Errorf("json.Marshal(got) diff (-got +want):\n%s", diff)
+	}
+
+	gotYAML, err := yaml.Marshal(got)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(got) error = %v", err)
+	}
+	const wantYAML = "timeout: 1h30m\nsize: 25g\nmax_size: 4096\nplain_delay: 10m0s\n"
+	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
+		t.Errorf("yaml.Marshal(got) diff (-got +want):\n%s", diff)
+	}
+
+	// And they can be unmarshaled again.
+	var fromJSON unitsTarget
+	if err := json.Unmarshal(gotJSON, &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal(%s) error = %v", gotJSON, err)
+	}
+	var fromYAML unitsTarget
+	if err := yaml.Unmarshal(gotYAML, &fromYAML); err != nil {
+		t.Fatalf("yaml.Unmarshal(%s) error = %v", gotYAML, err)
+	}
+	got.PlainDelay = 0 // not marshaled to JSON
+	for _, rt := range []unitsTarget{fromJSON, fromYAML} {
+		rt.PlainDelay = 0
+		if diff := cmp.Diff(rt, got, cmp.AllowUnexported(Duration{}, ByteSize{})); diff != "" {
+			t.Errorf("round-tripped diff (-got +want):\n%s", diff)
+		}
+	}
+}
+
+func TestUnmarshalUnitsErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc    string
+		src     *MapSA
+		wantErr error
+	}{
+		{
+			desc:    "invalid byte size",
+			src:     MapFromItems(TupleSA{Key: "size", Value: "lots"}),
+			wantErr: ErrInvalidByteSize,
+		},
+		{
+			desc:    "duration from number",
+			src:     MapFromItems(TupleSA{Key: "timeout", Value: 10}),
+			wantErr: ErrIncompatibleTypes,
+		},
+		{
+			desc:    "byte size from bool",
+			src:     MapFromItems(TupleSA{Key: "size", Value: true}),
+			wantErr: ErrIncompatibleTypes,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			var got unitsTarget
+			if err := Unmarshal(test.src, &got); !errors.Is(err, test.wantErr) {
+				t.Errorf("Unmarshal(%v, &got) error = %v, want %v", test.src, err, test.wantErr)
+			}
+		})
+	}
+}
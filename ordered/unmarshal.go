@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/buildkite/go-pipeline/warning"
 
@@ -20,6 +21,8 @@ var (
 	ErrIncompatibleTypes    = errors.New("incompatible types")
 	ErrUnsupportedSrc       = errors.New("cannot unmarshal from src")
 	ErrMultipleInlineFields = errors.New(`multiple fields tagged with yaml:",inline"`)
+	ErrMappingIntoString    = errors.New("mapping unmarshaled as a string")
+	ErrNotCoerced           = errors.New("value not converted into a string, since coercion is strict")
 )
 
 // Unmarshaler is an interface that types can use to override the default
@@ -47,8 +50,9 @@ type Unmarshaler interface {
 //   - If dst is a pointer to a pointer, Unmarshal recursively calls Unmarshal
 //     on the inner pointer, creating a new value of the type being pointed to
 //     as needed.
-//   - If dst implements Unmarshaler, Unmarshal returns
-//     dst.UnmarshalOrdered(src).
+//   - If dst implements OptionsUnmarshaler, Unmarshal returns
+//     dst.UnmarshalOrderedWith(src, opts...). Otherwise, if dst implements
+//     Unmarshaler, Unmarshal returns dst.UnmarshalOrdered(src).
 //   - If dst is *any, Unmarshal copies src directly into *dst.
 //
 // Otherwise, it acts a lot like yaml.Unmarshal, except that the type S of src
@@ -65,13 +69,32 @@ type Unmarshaler interface {
 //     If the field name or yaml tag key doesn't match, Unmarshal looks through
 //     the aliases list to see if any are present, and uses the value for the
 //     first.
+//     If D is *string, src is instead converted back into a
+//     string resembling YAML flow style, such as "{a: b, c}" (as might happen
+//     when a string beginning with "{" isn't quoted), unless the coercion
+//     policy is CoerceStrict (see WithCoercion). With WithSource, the string
+//     is the text the mapping was written as. Under CoerceScalars, this
+//     produces a warning wrapping ErrMappingIntoString.
 //   - S = []any (also recursively containing values with types from this list),
 //     which is recursively unmarshaled elementwise; D is *[]any or
 //     *[]somethingElse.
 //   - S ∊ {string, float64, int, bool}; D must be *S (value copied directly),
 //     *[]S or *[]any (value appended), *string (value formatted through
-//     fmt.Sprint) or *[]string (formatted value appended).
-func Unmarshal(src, dst any) error {
+//     fmt.Sprint) or *[]string (formatted value appended). Formatting values
+//     that aren't strings can be disabled with WithCoercion(CoerceStrict), in
+//     which case the error also wraps ErrNotCoerced.
+//   - S = string and D = *time.Duration; src is parsed with
+//     time.ParseDuration. (Use Duration to marshal the original string back.)
+func Unmarshal(src, dst any, opts ...UnmarshalOption) error {
+	cfg := &unmarshalConfig{opts: opts}
+	for _, o := range opts {
+		o(cfg)
+	}
+	return cfg.unmarshal(src, dst)
+}
+
+// unmarshal implements Unmarshal.
+func (cfg *unmarshalConfig) unmarshal(src, dst any) error {
 	if dst == nil {
 		// This is interface nil (not typed nil, which has to be tested after
 		// figuring out the types).
@@ -99,6 +122,9 @@ func Unmarshal(src, dst any) error {
 		src = o
 	}
 
+	if um, ok := dst.(OptionsUnmarshaler); ok {
+		return um.UnmarshalOrderedWith(src, cfg.opts...)
+	}
 	if um, ok := dst.(Unmarshaler); ok {
 		return um.UnmarshalOrdered(src)
 	}
@@ -138,7 +164,7 @@ func Unmarshal(src, dst any) error {
 			}
 
 			// Handle double pointers by recursing on the inner layer.
-			return Unmarshal(src, edst.Interface())
+			return cfg.unmarshal(src, edst.Interface())
 		}
 	}
 
@@ -149,9 +175,36 @@ func Unmarshal(src, dst any) error {
 
 	switch tsrc := src.(type) {
 	case *Map[string, any]:
-		return tsrc.decodeInto(dst)
+		// A map where a string was wanted is usually a value that was meant
+		// to be a string, but began with "{" and wasn't quoted, such as
+		// `label: {fast, quiet}`. Turn it back into a string, unless strict.
+		if tsrc != nil {
+			switch cfg.coercion {
+			case CoerceScalars:
+				if tdst, ok := dst.(*string); ok {
+					*tdst = cfg.flowString(tsrc)
+					return warning.Newf("%w: %s (quote it if it is meant to be a string)", ErrMappingIntoString, *tdst)
+				}
+
+			case CoerceStrict:
+				if _, ok := dst.(*string); ok {
+					return notCoerced(tsrc, dst)
+				}
+
+			case CoerceAll:
+				if cfg.coerce(tsrc, dst) {
+					return nil
+				}
+			}
+		}
+		return tsrc.decodeInto(cfg, dst)
 
 	case []any:
+		// A sequence into *[]string is unmarshaled elementwise, below.
+		if tdst, ok := dst.(*string); ok && cfg.coercion == CoerceAll {
+			*tdst = cfg.flowString(tsrc)
+			return nil
+		}
 		switch tdst := dst.(type) {
 		case *[]any:
 			*tdst = append(*tdst, tsrc...)
@@ -174,7 +227,7 @@ func Unmarshal(src, dst any) error {
 			var warns []error
 			for i, a := range tsrc {
 				x := reflect.New(etype) // x := new(E) (type *E)
-				err := Unmarshal(a, x.Interface())
+				err := cfg.unmarshal(a, x.Interface())
 				if w := warning.As(err); w != nil {
 					warns = append(warns, w.Wrapf("while unmarshaling item at index %d of %d", i, len(tsrc)))
 				} else if err != nil {
@@ -187,16 +240,24 @@ func Unmarshal(src, dst any) error {
 		}
 
 	case string:
-		return unmarshalScalar(tsrc, dst)
+		if tdst, ok := dst.(*time.Duration); ok {
+			d, err := time.ParseDuration(tsrc)
+			if err != nil {
+				return err
+			}
+			*tdst = d
+			return nil
+		}
+		return unmarshalScalar(cfg, tsrc, dst)
 
 	case float64:
-		return unmarshalScalar(tsrc, dst)
+		return unmarshalScalar(cfg, tsrc, dst)
 
 	case int:
-		return unmarshalScalar(tsrc, dst)
+		return unmarshalScalar(cfg, tsrc, dst)
 
 	case bool:
-		return unmarshalScalar(tsrc, dst)
+		return unmarshalScalar(cfg, tsrc, dst)
 
 	default:
 		return fmt.Errorf("%w %T", ErrUnsupportedSrc, src)
@@ -205,7 +266,67 @@ func Unmarshal(src, dst any) error {
 	return nil
 }
 
-func unmarshalScalar[S any](src S, dst any) error {
+// flowString converts a value decoded from YAML back into a string: for a
+// mapping written in flow style, the text it was written as (if the source
+// is known), and otherwise as for the flowString function.
+func (cfg *unmarshalConfig) flowString(v any) string {
+	if m, ok := v.(*Map[string, any]); ok && m.flow != nil && cfg.source != nil {
+		if text, ok := flowText(cfg.source, *m.flow, m); ok {
+			return text
+		}
+	}
+	return flowString(v)
+}
+
+// flowString converts a value decoded from YAML back into a string resembling
+// the YAML flow style source it could have come from, such as "{a: b, c}" or
+// "[1, 2]". Strings are written without quotes, and keys without values (null)
+// are written alone, so that values that were intended to be strings come out
+// close to how they were written (though spacing and quotes are lost).
+func flowString(v any) string {
+	var b strings.Builder
+	writeFlow(&b, v)
+	return b.String()
+}
+
+// writeFlow writes v in the form described by flowString.
+func writeFlow(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case *Map[string, any]:
+		b.WriteByte('{')
+		first := true
+		for k, e := range v.All() {
+			if !first {
+				b.WriteString(", ")
+			}
+			first = false
+			b.WriteString(k)
+			if e != nil {
+				b.WriteString(": ")
+				writeFlow(b, e)
+			}
+		}
+		b.WriteByte('}')
+
+	case []any:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeFlow(b, e)
+		}
+		b.WriteByte(']')
+
+	case nil:
+		b.WriteString("null")
+
+	default:
+		fmt.Fprint(b, v)
+	}
+}
+
+func unmarshalScalar[S any](cfg *unmarshalConfig, src S, dst any) error {
 	switch tdst := dst.(type) {
 	case *S:
 		*tdst = src
@@ -216,13 +337,14 @@ func unmarshalScalar[S any](src S, dst any) error {
 	case *[]any:
 		*tdst = append(*tdst, src)
 
-	case *string:
-		*tdst = fmt.Sprint(src)
-
-	case *[]string:
-		*tdst = append(*tdst, fmt.Sprint(src))
-
 	default:
+		if cfg.coercion == CoerceStrict {
+			if isStringTarget(dst) {
+				return notCoerced(src, dst)
+			}
+		} else if cfg.coerce(src, dst) {
+			return nil
+		}
 		return fmt.Errorf("%w: cannot unmarshal %T into %T", ErrIncompatibleTypes, src, dst)
 	}
 	return nil
@@ -238,7 +360,7 @@ func unmarshalScalar[S any](src S, dst any) error {
 //   - If a field has a yaml:",inline" tag, it copies any leftover values into
 //     that field, which must have type map[string]any or any. (Structs are not
 //     supported for inline.)
-func (m *Map[K, V]) decodeInto(target any) error {
+func (m *Map[K, V]) decodeInto(cfg *unmarshalConfig, target any) error {
 	tm, ok := any(m).(*Map[string, any])
 	if !ok {
 		return fmt.Errorf("%w: cannot unmarshal from %T, want K=string, V=any", ErrIncompatibleTypes, m)
@@ -304,9 +426,9 @@ func (m *Map[K, V]) decodeInto(target any) error {
 
 		valueType := mapType.Elem()
 		var warns []error
-		if err := tm.Range(func(k string, v any) error {
+		for k, v := range tm.All() {
 			nv := reflect.New(valueType)
-			err := Unmarshal(v, nv.Interface())
+			err := cfg.unmarshal(v, nv.Interface())
 			if w := warning.As(err); w != nil {
 				warns = append(warns, w.Wrapf("while unmarshaling value for key %q", k))
 			} else if err != nil {
@@ -314,9 +436,6 @@ func (m *Map[K, V]) decodeInto(target any) error {
 			}
 
 			targetValue.SetMapIndex(reflect.ValueOf(k), nv.Elem())
-			return nil
-		}); err != nil {
-			return err
 		}
 		return warning.Wrap(warns...)
 
@@ -391,7 +510,7 @@ func (m *Map[K, V]) decodeInto(target any) error {
 		// Now load value into the field recursively.
 		// Get a pointer to the field. This works because target is a pointer.
 		ptrToField := targetValue.FieldByIndex(field.Index).Addr()
-		err := Unmarshal(value, ptrToField.Interface())
+		err := cfg.unmarshal(value, ptrToField.Interface())
 		if w := warning.As(err); w != nil {
 			warns = append(warns, w.Wrapf("while unmarshaling the value for key %q into struct field %q", key, field.Name))
 		} else if err != nil {
@@ -410,34 +529,40 @@ func (m *Map[K, V]) decodeInto(target any) error {
 	// Copy all values that weren't non-inline fields into a temporary map.
 	// This is just to avoid mutating tm.
 	temp := NewMap[string, any](tm.Len())
-	tm.Range(func(k string, v any) error {
+	for k, v := range tm.All() {
 		if _, outline := outlineKeys[k]; outline {
-			return nil
+			continue
 		}
 		temp.Set(k, v)
-		return nil
-	})
+	}
 
 	// If the inline map contains nothing, then don't bother setting it.
 	if temp.Len() == 0 {
 		return warning.Wrap(warns...)
 	}
 
-	err := Unmarshal(temp, inlinePtr.Interface())
+	err := cfg.unmarshal(temp, inlinePtr.Interface())
 	if w := warning.As(err); w != nil {
 		warns = append(warns, w.Wrapf("while unmarshaling the remaining input into an inline field of type %T", inlinePtr.Interface()))
-		return warning.Wrap(warns...)
+	} else if err != nil {
+		return err
 	}
-	return err
+	return warning.Wrap(warns...)
 }
 
-// Compile-time check that *Map[string,any] is an Unmarshaler
-var _ Unmarshaler = (*MapSA)(nil)
+// Compile-time check that *Map[string,any] is an OptionsUnmarshaler
+var _ OptionsUnmarshaler = (*MapSA)(nil)
 
 // UnmarshalOrdered unmarshals a value into this map.
 // K must be string, src must be *Map[string, any], and each value in src must
 // be unmarshallable into *V.
 func (m *Map[K, V]) UnmarshalOrdered(src any) error {
+	return m.UnmarshalOrderedWith(src)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for unmarshaling
+// the values.
+func (m *Map[K, V]) UnmarshalOrderedWith(src any, opts ...UnmarshalOption) error {
 	if m == nil {
 		return ErrIntoNil
 	}
@@ -453,18 +578,15 @@ func (m *Map[K, V]) UnmarshalOrdered(src any) error {
 	}
 
 	var warns []error
-	if err := tsrc.Range(func(k string, v any) error {
+	for k, v := range tsrc.All() {
 		var dv V
-		err := Unmarshal(v, &dv)
+		err := Unmarshal(v, &dv, opts...)
 		if w := warning.As(err); w != nil {
 			warns = append(warns, w.Wrapf("while unmarshaling the value for key %q", k))
 		} else if err != nil {
 			return fmt.Errorf("unmarshaling value for key %q: %w", k, err)
 		}
 		tm.Set(k, dv)
-		return nil
-	}); err != nil {
-		return err
 	}
 	return warning.Wrap(warns...)
 }
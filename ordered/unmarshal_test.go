@@ -678,6 +678,95 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestUnmarshalMapIntoString(t *testing.T) {
+	t.Parallel()
+
+	src := MapFromItems(
+		TupleSA{Key: "fast", Value: nil},
+		TupleSA{Key: "llama", Value: "Kuzco"},
+		TupleSA{Key: "nested", Value: []any{1, true, nil, MapFromItems(TupleSA{Key: "x", Value: 1.5})}},
+	)
+	var got string
+	err := Unmarshal(src, &got)
+	if !warning.Is(err) || !errors.Is(err, ErrMappingIntoString) {
+		t.Fatalf("Unmarshal(src, &got) error = %v, want a warning wrapping %v", err, ErrMappingIntoString)
+	}
+	if want := "{fast, llama: Kuzco, nested: [1, true, null, {x: 1.5}]}"; got != want {
+		t.Errorf("Unmarshal(src, &got) got = %q, want %q", got, want)
+	}
+}
+
+func TestUnmarshalMapIntoStringWithSource(t *testing.T) {
+	t.Parallel()
+
+	type target struct {
+		Label string
+		Env   map[string]string
+	}
+
+	tests := []struct {
+		desc, source string
+		want         target
+	}{
+		{
+			desc:   "quotes and spacing",
+			source: "label: {fast,  quiet}\nenv:\n  GREETING: {\"YOURE_A_WINNER\":\"BONUS_JSON\"}\n",
+			want: target{
+				Label: "{fast,  quiet}",
+				Env:   map[string]string{"GREETING": `{"YOURE_A_WINNER":"BONUS_JSON"}`},
+			},
+		},
+		{
+			desc:   "brackets and comments within",
+			source: "label: {a: '}', b: \"{\\\"\", c: [1, {d: e}], # }\n  f: it's}\n",
+			want:   target{Label: "{a: '}', b: \"{\\\"\", c: [1, {d: e}], # }\n  f: it's}"},
+		},
+		{
+			desc:   "multibyte characters before",
+			source: "env: {\"ü\": {x: \"ÿ\"}}\n",
+			want:   target{Env: map[string]string{"ü": `{x: "ÿ"}`}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(test.source), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(source) error = %v", err)
+			}
+			var got target
+			err := Unmarshal(&n, &got, WithSource([]byte(test.source)))
+			if !warning.Is(err) || !errors.Is(err, ErrMappingIntoString) {
+				t.Fatalf("Unmarshal(source, &got, WithSource(source)) error = %v, want a warning wrapping %v", err, ErrMappingIntoString)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("Unmarshal(source, &got, WithSource(source)) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMapIntoStringWithOtherSource(t *testing.T) {
+	t.Parallel()
+
+	// If the source doesn't contain the mapping where it was decoded from,
+	// it is rebuilt from its contents.
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(`label: {a: "b"}`), &n); err != nil {
+		t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+	}
+	var got struct{ Label string }
+	err := Unmarshal(&n, &got, WithSource([]byte(`label: {a: "c"}`)))
+	if !errors.Is(err, ErrMappingIntoString) {
+		t.Fatalf("Unmarshal(input, &got, WithSource(other)) error = %v, want %v", err, ErrMappingIntoString)
+	}
+	if want := "{a: b}"; got.Label != want {
+		t.Errorf("got.Label = %q, want %q", got.Label, want)
+	}
+}
+
 func TestUnmarshalIntoNilErrors(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
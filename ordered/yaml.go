@@ -1,7 +1,10 @@
 package ordered
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
 )
@@ -84,6 +87,9 @@ func decodeYAML(seen map[*yaml.Node]bool, n *yaml.Node) (any, error) {
 		if err != nil {
 			return nil, err
 		}
+		if n.Style&yaml.FlowStyle != 0 {
+			m.flow = &sourcePos{line: n.Line, column: n.Column}
+		}
 		return m, nil
 
 	case yaml.AliasNode:
@@ -268,3 +274,113 @@ func canonicalMapKey(n *yaml.Node) (string, error) {
 		return "", fmt.Errorf("line %d, col %d: cannot use node kind %x as a map key", n.Line, n.Column, n.Kind)
 	}
 }
+
+// sourcePos is a position in YAML source text. Lines and columns are numbered
+// from 1, and columns count characters.
+type sourcePos struct {
+	line, column int
+}
+
+// flowText returns the text of the flow style mapping m, which was decoded
+// from the YAML at pos in source. It reports false if the text there isn't a
+// mapping with the same contents as m (such as when m came from a different
+// document, or has since been modified).
+func flowText(source []byte, pos sourcePos, m *Map[string, any]) (string, bool) {
+	start, ok := sourceOffset(source, pos)
+	if !ok || source[start] != '{' {
+		return "", false
+	}
+	end, ok := flowEnd(source, start)
+	if !ok {
+		return "", false
+	}
+	text := source[start:end]
+
+	var n yaml.Node
+	if err := yaml.Unmarshal(text, &n); err != nil {
+		return "", false
+	}
+	v, err := DecodeYAML(&n)
+	if err != nil {
+		return "", false
+	}
+	dm, ok := v.(*Map[string, any])
+	if !ok || !Equal(m, dm) {
+		return "", false
+	}
+	return string(text), true
+}
+
+// sourceOffset returns the byte offset of pos within source.
+func sourceOffset(source []byte, pos sourcePos) (int, bool) {
+	off := 0
+	for line := 1; line < pos.line; line++ {
+		i := bytes.IndexByte(source[off:], '\n')
+		if i < 0 {
+			return 0, false
+		}
+		off += i + 1
+	}
+	for col := 1; col < pos.column; col++ {
+		if off >= len(source) || source[off] == '\n' {
+			return 0, false
+		}
+		_, size := utf8.DecodeRune(source[off:])
+		off += size
+	}
+	return off, off < len(source)
+}
+
+// flowEnd returns the offset just after the end of the flow collection
+// beginning at source[start]. It skips over quoted scalars and comments, so
+// that brackets within them don't count.
+func flowEnd(source []byte, start int) (int, bool) {
+	depth := 0
+	// prev is the last character that wasn't whitespace. A quote only begins
+	// a quoted scalar at the start of a value.
+	prev := byte(0)
+	for i := start; i < len(source); i++ {
+		c := source[i]
+		switch c {
+		case '{', '[':
+			depth++
+
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+
+		case '"', '\'':
+			if !strings.ContainsRune("{[,:?", rune(prev)) {
+				break
+			}
+			for i++; i < len(source); i++ {
+				if source[i] == '\\' && c == '"' {
+					i++
+					continue
+				}
+				if source[i] == c {
+					// A single quote is escaped by doubling it.
+					if c == '\'' && i+1 < len(source) && source[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+
+		case '#':
+			if i > 0 && (source[i-1] == ' ' || source[i-1] == '\t' || source[i-1] == '\n') {
+				for i < len(source) && source[i] != '\n' {
+					i++
+				}
+				continue
+			}
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			prev = c
+		}
+	}
+	return 0, false
+}
@@ -1,17 +1,56 @@
 package pipeline
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"strings"
 
 	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
 	"gopkg.in/yaml.v3"
 )
 
 // Options are functional options for creating a new Env.
 type Options func(*Pipeline)
 
+// ParseOption is a functional option for Parse.
+type ParseOption func(*parseConfig)
+
+// parseConfig holds the configuration built from ParseOptions.
+type parseConfig struct {
+	tagHandlers map[string]TagHandler
+
+	// Limits on the number of steps; zero or less means no limit.
+	maxSteps         int
+	maxGroupChildren int
+
+	// memoryBudget limits the memory footprint of the pipeline, in bytes;
+	// zero or less means no limit.
+	memoryBudget int64
+
+	// strictFields rejects pipelines containing unknown fields.
+	strictFields bool
+
+	// jobsAlias accepts `jobs:` in place of `steps:`.
+	jobsAlias bool
+
+	// maxInputBytes limits the size of the input; zero or less means no
+	// limit.
+	maxInputBytes int64
+
+	// coercion is the policy for converting values into strings.
+	coercion ordered.CoercionPolicy
+
+	// beforeParse funcs are called before each document is parsed, before
+	// any tags are resolved.
+	beforeParse []func()
+
+	// afterParse funcs are called with the resolved document and the parsed
+	// pipeline, provided parsing didn't fail outright.
+	afterParse []func(*yaml.Node, *Pipeline)
+}
+
 // Parse parses a pipeline. It does not apply interpolation.
 // Warnings are passed through the err return:
 //
@@ -24,12 +63,104 @@ type Options func(*Pipeline)
 //	    return err
 //	}
 //	// Use p
-func Parse(src io.Reader) (*Pipeline, error) {
+func Parse(src io.Reader, opts ...ParseOption) (*Pipeline, error) {
+	cfg := new(parseConfig)
+	for _, o := range opts {
+		o(cfg)
+	}
+	return cfg.parse(src)
+}
+
+// parse parses a pipeline from src.
+func (cfg *parseConfig) parse(src io.Reader) (*Pipeline, error) {
+	// The source is kept so that values can be turned back into the text
+	// they were written as (see ordered.WithSource).
+	data, err := cfg.readInput(src)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decodeText(data); err != nil {
+		return nil, err
+	}
+	return cfg.parseDecoded(bytes.NewReader(data), data)
+}
+
+// parseDecoded parses a pipeline from src, which reads UTF-8 text (see
+// decodeText). source is the text src reads, if it is in memory, and
+// otherwise nil.
+func (cfg *parseConfig) parseDecoded(src io.Reader, source []byte) (*Pipeline, error) {
 	// First get yaml.v3 to give us a raw document (*yaml.Node).
 	n := new(yaml.Node)
 	if err := yaml.NewDecoder(src).Decode(n); err != nil {
 		return nil, formatYAMLError(err)
 	}
+	return cfg.parseNode(n, source)
+}
+
+// ParseWithWarnings parses a pipeline like Parse, but returns warnings
+// separately from errors: err is non-nil only if the pipeline could not be
+// parsed, in which case p is nil. Each element of warns is a warning about
+// part of the pipeline that could not be fully parsed:
+//
+//	p, warns, err := ParseWithWarnings(src)
+//	if err != nil {
+//		return err
+//	}
+//	for _, w := range warns {
+//		log.Printf("*Warning* - pipeline is not fully parsed: %v", w)
+//	}
+//	// Use p
+func ParseWithWarnings(src io.Reader, opts ...ParseOption) (p *Pipeline, warns []error, err error) {
+	p, err = Parse(src, opts...)
+	w := warning.As(err)
+	if w == nil {
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, nil, nil
+	}
+	return p, splitWarning(w), nil
+}
+
+// splitWarning splits a warning into the warnings it wraps, if it is only a
+// container for them (it has no message or position of its own).
+func splitWarning(w *warning.Warning) []error {
+	if _, hasPos := w.Position(); w.Message() != "" || hasPos {
+		return []error{w}
+	}
+	var warns []error
+	for _, err := range w.Unwrap() {
+		if err != nil {
+			warns = append(warns, err)
+		}
+	}
+	return warns
+}
+
+// parseNode parses a pipeline from a raw document. source is the text the
+// document was decoded from, if known.
+func (cfg *parseConfig) parseNode(n *yaml.Node, source []byte) (*Pipeline, error) {
+	for _, f := range cfg.beforeParse {
+		f()
+	}
+
+	// Resolve any custom tags before the document is interpreted as a
+	// pipeline, so that the resolved values take part in step typing.
+	if err := cfg.resolveTags(n); err != nil {
+		return nil, err
+	}
+
+	// Rename aliases of steps (if enabled) before anything looks for steps.
+	aliasWarn := cfg.resolveStepsAlias(n)
+
+	// Check limits (which may have been exceeded through includes) before
+	// doing the expensive work of decoding steps.
+	if err := cfg.checkLimits(n); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkDocumentMemory(n); err != nil {
+		return nil, err
+	}
 
 	// Instead of unmarshalling into structs, which is easy-ish to use but
 	// doesn't work with some non YAML 1.2 features (merges), decode the
@@ -37,9 +168,42 @@ func Parse(src io.Reader) (*Pipeline, error) {
 	// This resolves aliases and merges and gives a more convenient form to work
 	// with when handling different structural representations of the same
 	// configuration. Then decode _that_ into a pipeline.
+	// Matrix values become strings anyway, so keep them as they were written
+	// (unless values aren't to be turned into strings at all).
+	restore := func() {}
+	if cfg.coercion != ordered.CoerceStrict {
+		restore = preserveMatrixValues(n)
+	}
 	p := new(Pipeline)
+	err := ordered.Unmarshal(n, p, ordered.WithCoercion(cfg.coercion), ordered.WithSource(source))
+	restore()
+	if err != nil && !warning.Is(err) {
+		return p, err
+	}
+
+	if merr := cfg.checkPipelineMemory(p); merr != nil {
+		return nil, merr
+	}
 
-	return p, ordered.Unmarshal(n, p)
+	// Warnings about steps are more useful with the step's position.
+	addStepPositions(err, n)
+
+	if serr := cfg.checkStrictFields(p); serr != nil {
+		return nil, serr
+	}
+
+	for _, f := range cfg.afterParse {
+		f(n, p)
+	}
+
+	if aliasWarn != nil {
+		warns := []error{aliasWarn}
+		if err != nil {
+			warns = append(warns, err)
+		}
+		err = warning.Wrap(warns...)
+	}
+	return p, err
 }
 
 func formatYAMLError(err error) error {
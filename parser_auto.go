@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInputTooLarge is returned (wrapped) by Parse and ParseAuto when the input
+// is larger than the limit set by WithMaxInputBytes.
+var ErrInputTooLarge = errors.New("pipeline input is too large")
+
+// DefaultMaxInputBytes is the limit on the size of the input that ParseAuto
+// applies, unless another is set with WithMaxInputBytes.
+const DefaultMaxInputBytes = 16 << 20
+
+// WithMaxInputBytes is a ParseOption that limits the size of the input to n
+// bytes. Parsing fails with an error wrapping ErrInputTooLarge if the input is
+// bigger, without reading more than n+1 bytes of it. Zero or less means no
+// limit. Parse has no limit by default, and ParseAuto has a limit of
+// DefaultMaxInputBytes.
+func WithMaxInputBytes(n int64) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxInputBytes = n
+	}
+}
+
+// InputFormat describes the format of a pipeline, as detected by ParseAuto.
+type InputFormat struct {
+	// JSON is true if the pipeline is JSON, rather than YAML. (Since JSON is a
+	// subset of YAML, both are parsed the same way.)
+	JSON bool
+
+	// StepList is true if the pipeline is a bare list of steps, rather than a
+	// mapping containing steps (and possibly env, agents, etc).
+	StepList bool
+}
+
+// String returns a description of the format, such as "yaml" or
+// "json step list".
+func (f InputFormat) String() string {
+	s := "yaml"
+	if f.JSON {
+		s = "json"
+	}
+	if f.StepList {
+		s += " step list"
+	}
+	return s
+}
+
+// ParseAuto parses a pipeline like Parse, for inputs (such as stdin) that may
+// come from a variety of generators. It detects whether the pipeline is JSON
+// or YAML, and whether it is a mapping or a bare list of steps, and reports
+// the format it detected. The input is limited to DefaultMaxInputBytes, unless
+// another limit is set with WithMaxInputBytes. The format is reported even if
+// parsing fails, provided the input could be read.
+func ParseAuto(src io.Reader, opts ...ParseOption) (*Pipeline, InputFormat, error) {
+	cfg := &parseConfig{maxInputBytes: DefaultMaxInputBytes}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	data, err := cfg.readInput(src)
+	if err != nil {
+		return nil, InputFormat{}, err
+	}
+	if data, err = decodeText(data); err != nil {
+		return nil, InputFormat{}, err
+	}
+	format := InputFormat{JSON: isJSON(data)}
+
+	n := new(yaml.Node)
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(n); err != nil {
+		return nil, format, formatYAMLError(err)
+	}
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		format.StepList = resolveAlias(n.Content[0]).Kind == yaml.SequenceNode
+	}
+
+	p, err := cfg.parseNode(n, data)
+	return p, format, err
+}
+
+// readInput reads all of src, subject to the input size limit.
+func (cfg *parseConfig) readInput(src io.Reader) ([]byte, error) {
+	if cfg.maxInputBytes <= 0 {
+		return io.ReadAll(src)
+	}
+	data, err := io.ReadAll(io.LimitReader(src, cfg.maxInputBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > cfg.maxInputBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrInputTooLarge, cfg.maxInputBytes)
+	}
+	return data, nil
+}
+
+// isJSON reports whether data (decoded by decodeText) is a JSON document.
+func isJSON(data []byte) bool {
+	return json.Valid(data)
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAuto(t *testing.T) {
+	t.Parallel()
+
+	want := &Pipeline{
+		Steps: Steps{
+			&CommandStep{Command: "make"},
+			&WaitStep{Scalar: "wait"},
+		},
+	}
+
+	tests := []struct {
+		desc       string
+		input      string
+		wantFormat InputFormat
+	}{
+		{
+			desc:       "yaml",
+			input:      "steps:\n  - command: make\n  - wait\n",
+			wantFormat: InputFormat{},
+		},
+		{
+			desc:       "yaml step list",
+			input:      "---\n- command: make\n- wait\n",
+			wantFormat: InputFormat{StepList: true},
+		},
+		{
+			desc:       "json",
+			input:      `{"steps": [{"command": "make"}, "wait"]}`,
+			wantFormat: InputFormat{JSON: true},
+		},
+		{
+			desc:       "json step list with byte order mark",
+			input:      "\ufeff\n  [{\"command\": \"make\"}, \"wait\"]\n",
+			wantFormat: InputFormat{JSON: true, StepList: true},
+		},
+		{
+			desc:       "yaml flow mapping",
+			input:      "{steps: [{command: make}, wait]}",
+			wantFormat: InputFormat{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, format, err := ParseAuto(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("ParseAuto(input) error = %v", err)
+			}
+			if format != test.wantFormat {
+				t.Errorf("ParseAuto(input) format = %v, want %v", format, test.wantFormat)
+			}
+			if diff := diffPipeline(got, want); diff != "" {
+				t.Errorf("ParseAuto(input) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInputFormatString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format InputFormat
+		want   string
+	}{
+		{InputFormat{}, "yaml"},
+		{InputFormat{JSON: true}, "json"},
+		{InputFormat{StepList: true}, "yaml step list"},
+		{InputFormat{JSON: true, StepList: true}, "json step list"},
+	}
+	for _, test := range tests {
+		if got := test.format.String(); got != test.want {
+			t.Errorf("%#v.String() = %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestParseAuto_MaxInputBytes(t *testing.T) {
+	t.Parallel()
+
+	const input = "steps:\n  - command: make\n"
+
+	if _, _, err := ParseAuto(strings.NewReader(input), WithMaxInputBytes(int64(len(input)))); err != nil {
+		t.Errorf("ParseAuto(input, WithMaxInputBytes(len(input))) error = %v", err)
+	}
+	if _, _, err := ParseAuto(strings.NewReader(input), WithMaxInputBytes(10)); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("ParseAuto(input, WithMaxInputBytes(10)) error = %v, want %v", err, ErrInputTooLarge)
+	}
+	if _, err := Parse(strings.NewReader(input), WithMaxInputBytes(10)); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("Parse(input, WithMaxInputBytes(10)) error = %v, want %v", err, ErrInputTooLarge)
+	}
+
+	big := strings.NewReader("steps:\n  - command: " + strings.Repeat("x", DefaultMaxInputBytes) + "\n")
+	if _, _, err := ParseAuto(big); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("ParseAuto(big) error = %v, want %v", err, ErrInputTooLarge)
+	}
+	big.Seek(0, 0)
+	if _, _, err := ParseAuto(big, WithMaxInputBytes(0)); err != nil {
+		t.Errorf("ParseAuto(big, WithMaxInputBytes(0)) error = %v", err)
+	}
+}
+
+func TestParseAuto_Error(t *testing.T) {
+	t.Parallel()
+
+	_, format, err := ParseAuto(strings.NewReader(`{"steps": 47}`))
+	if err == nil {
+		t.Fatalf("ParseAuto(input) error = nil, want non-nil")
+	}
+	if diff := cmp.Diff(format, InputFormat{JSON: true}); diff != "" {
+		t.Errorf("ParseAuto(input) format diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+// WithJobsAlias is a ParseOption that accepts `jobs:` as an alias for `steps:`
+// at the top level of the pipeline, to ease migrating configurations from
+// other CI systems that are otherwise structurally compatible. Parse returns a
+// warning when the alias is used. If the pipeline has `steps:` as well, `jobs:`
+// is not treated as an alias.
+func WithJobsAlias() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.jobsAlias = true
+	}
+}
+
+// WithCoercion is a ParseOption that sets the policy for converting values
+// that aren't strings, such as `label: 2025` or `branch: true`, into strings
+// (see ordered.CoercionPolicy). By default, numbers, bools, and mappings that
+// were probably meant to be strings are converted. With ordered.CoerceStrict,
+// such values are errors, as for other values of the wrong type (so steps
+// containing them fall back to UnknownStep, with a warning). Matrix values and
+// cache paths are always converted, since they are commonly numbers.
+func WithCoercion(policy ordered.CoercionPolicy) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.coercion = policy
+	}
+}
+
+// resolveStepsAlias renames the top-level `jobs:` key in the raw document n to
+// `steps:`, if enabled with WithJobsAlias. It returns a warning if it did.
+func (cfg *parseConfig) resolveStepsAlias(n *yaml.Node) *warning.Warning {
+	if !cfg.jobsAlias {
+		return nil
+	}
+	n = resolveAlias(n)
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) == 1 {
+		n = resolveAlias(n.Content[0])
+	}
+	if n == nil || n.Kind != yaml.MappingNode || mappingValue(n, "steps") != nil {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if k.Value != "jobs" {
+			continue
+		}
+		k.Value = "steps"
+		return warning.New(`"jobs" is not a pipeline field; treating it as "steps"`).
+			At(warning.Position{Line: k.Line, Column: k.Column})
+	}
+	return nil
+}
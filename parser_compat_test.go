@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+)
+
+func TestParseJobsAlias(t *testing.T) {
+	t.Parallel()
+
+	input := `env:
+  FOO: bar
+jobs:
+  - command: make
+`
+	p, err := Parse(strings.NewReader(input), WithJobsAlias())
+	w := warning.As(err)
+	if w == nil {
+		t.Fatalf("Parse(input, WithJobsAlias()) error = %v, want a warning", err)
+	}
+	if want := `treating it as "steps" at line 3, column 1`; !strings.Contains(err.Error(), want) {
+		t.Errorf("Parse(input, WithJobsAlias()) error = %q, want it to contain %q", err, want)
+	}
+
+	want := &Pipeline{
+		Env:   p.Env,
+		Steps: Steps{&CommandStep{Command: "make"}},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestParseJobsAliasNotUsed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc  string
+		input string
+		opts  []ParseOption
+		want  *Pipeline
+	}{
+		{
+			desc:  "option not given",
+			input: "jobs:\n  - command: make\n",
+			want: &Pipeline{
+				Steps:           Steps{},
+				RemainingFields: map[string]any{"jobs": []any{ordered.MapFromItems(ordered.TupleSA{Key: "command", Value: "make"})}},
+			},
+		},
+		{
+			desc:  "steps present",
+			input: "steps:\n  - command: make\njobs: [test]\n",
+			opts:  []ParseOption{WithJobsAlias()},
+			want: &Pipeline{
+				Steps:           Steps{&CommandStep{Command: "make"}},
+				RemainingFields: map[string]any{"jobs": []any{"test"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input), test.opts...)
+			if err != nil && !strings.Contains(err.Error(), "no steps") {
+				t.Fatalf("Parse(input, opts...) error = %v", err)
+			}
+			if diff := diffPipeline(p, test.want); diff != "" {
+				t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseWithCoercion(t *testing.T) {
+	t.Parallel()
+
+	const input = `steps:
+  - label: 2025
+    command: make
+    matrix: [1, 2]
+  - trigger: other
+    build:
+      branch: true
+      message: [a, b]
+`
+	tests := []struct {
+		desc     string
+		policy   ordered.CoercionPolicy
+		want     Steps
+		wantWarn bool
+	}{
+		{
+			desc:   "scalars",
+			policy: ordered.CoerceScalars,
+			want: Steps{
+				&CommandStep{Label: "2025", Command: "make", Matrix: &Matrix{Setup: MatrixSetup{"": {"1", "2"}}}},
+				&UnknownStep{Contents: ordered.MustMapSA(map[string]any{
+					"trigger": "other",
+					"build": map[string]any{
+						"branch":  true,
+						"message": []any{"a", "b"},
+					},
+				}, "trigger", "build")},
+			},
+			wantWarn: true,
+		},
+		{
+			desc:   "strict",
+			policy: ordered.CoerceStrict,
+			want: Steps{
+				&UnknownStep{Contents: ordered.MustMapSA(map[string]any{
+					"label":   2025,
+					"command": "make",
+					"matrix":  []any{1, 2},
+				}, "label", "command", "matrix")},
+				&UnknownStep{Contents: ordered.MustMapSA(map[string]any{
+					"trigger": "other",
+					"build": map[string]any{
+						"branch":  true,
+						"message": []any{"a", "b"},
+					},
+				}, "trigger", "build")},
+			},
+			wantWarn: true,
+		},
+		{
+			desc:   "all",
+			policy: ordered.CoerceAll,
+			want: Steps{
+				&CommandStep{Label: "2025", Command: "make", Matrix: &Matrix{Setup: MatrixSetup{"": {"1", "2"}}}},
+				&TriggerStep{Trigger: "other", Build: &TriggerBuild{Branch: "true", Message: "[a, b]"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, warns, err := ParseWithWarnings(strings.NewReader(input), WithCoercion(test.policy))
+			if err != nil {
+				t.Fatalf("ParseWithWarnings(input, WithCoercion(%v)) error = %v", test.policy, err)
+			}
+			if gotWarn := len(warns) > 0; gotWarn != test.wantWarn {
+				t.Errorf("ParseWithWarnings(input, WithCoercion(%v)) warnings = %v, want warnings: %t", test.policy, warns, test.wantWarn)
+			}
+			if diff := diffPipeline(got, &Pipeline{Steps: test.want}); diff != "" {
+				t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseWithStrictCoercionInNestedFields(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{
+			desc:  "retry",
+			input: "steps:\n  - command: make\n    retry:\n      manual:\n        reason: 7\n",
+		},
+		{
+			desc:  "automatic retry",
+			input: "steps:\n  - command: make\n    retry:\n      automatic:\n        signal: 9\n",
+		},
+		{
+			desc:  "notify",
+			input: "steps:\n  - command: make\n    notify:\n      - email: 7\n",
+		},
+		{
+			desc:  "slack",
+			input: "steps:\n  - command: make\n    notify:\n      - slack:\n          message: 7\n",
+		},
+		{
+			desc:  "artifact_paths",
+			input: "steps:\n  - command: make\n    artifact_paths: [out, 7]\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			if _, ok := got.Steps[0].(*CommandStep); !ok {
+				t.Errorf("Parse(%q) step = %T, want *CommandStep", test.input, got.Steps[0])
+			}
+
+			got, err = Parse(strings.NewReader(test.input), WithCoercion(ordered.CoerceStrict))
+			if !warning.Is(err) || !errors.Is(err, ordered.ErrNotCoerced) {
+				t.Errorf("Parse(%q, WithCoercion(CoerceStrict)) error = %v, want a warning wrapping %v", test.input, err, ordered.ErrNotCoerced)
+			}
+			if _, ok := got.Steps[0].(*UnknownStep); !ok {
+				t.Errorf("Parse(%q, WithCoercion(CoerceStrict)) step = %T, want *UnknownStep", test.input, got.Steps[0])
+			}
+		})
+	}
+}
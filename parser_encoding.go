@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedEncoding is returned (wrapped) by Parse (and the other parsing
+// functions) when the input is in a text encoding they can't read.
+var ErrUnsupportedEncoding = errors.New("unsupported text encoding")
+
+var utf8BOM = []byte("\ufeff")
+
+// decodeTextReader returns a reader of src as UTF-8 (see decodeText). Input
+// that is already UTF-8 is streamed, rather than read in full.
+func decodeTextReader(src io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(src)
+	// A short input is fine: Peek returns what there is.
+	head, _ := br.Peek(4)
+	if detectEncoding(head) == encodingUTF8 {
+		if bytes.HasPrefix(head, utf8BOM) {
+			br.Discard(len(utf8BOM))
+		}
+		return br, nil
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	data, err = decodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// decodeText converts pipeline input to UTF-8 without a byte order mark.
+// Editors (particularly on Windows) often write files with a byte order mark,
+// or in UTF-16, which would otherwise cause confusing YAML errors on the first
+// line. As in the YAML spec, UTF-16 is detected from a byte order mark, or
+// from the first character being ASCII.
+func decodeText(data []byte) ([]byte, error) {
+	var order binary.ByteOrder
+	switch detectEncoding(data) {
+	case encodingUTF8:
+		return bytes.TrimPrefix(data, utf8BOM), nil
+	case encodingUTF16LE:
+		order = binary.LittleEndian
+	case encodingUTF16BE:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: UTF-32 (save the file as UTF-8)", ErrUnsupportedEncoding)
+	}
+
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("%w: UTF-16 input has an odd number of bytes", ErrUnsupportedEncoding)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	out := make([]byte, 0, len(data))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	return bytes.TrimPrefix(out, utf8BOM), nil
+}
+
+// textEncoding is an encoding detected by detectEncoding.
+type textEncoding int
+
+const (
+	encodingUTF8 textEncoding = iota
+	encodingUTF16LE
+	encodingUTF16BE
+	encodingUTF32
+)
+
+// detectEncoding detects the encoding of text from its first few bytes, as
+// described in the YAML spec (section 5.2).
+func detectEncoding(head []byte) textEncoding {
+	switch {
+	case bytes.HasPrefix(head, []byte{0, 0, 0xfe, 0xff}),
+		bytes.HasPrefix(head, []byte{0xff, 0xfe, 0, 0}),
+		len(head) >= 4 && head[0] == 0 && head[1] == 0 && head[2] == 0 && head[3] != 0,
+		len(head) >= 4 && head[0] != 0 && head[1] == 0 && head[2] == 0 && head[3] == 0:
+		return encodingUTF32
+
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}),
+		len(head) >= 2 && head[0] == 0 && head[1] != 0:
+		return encodingUTF16BE
+
+	case bytes.HasPrefix(head, []byte{0xff, 0xfe}),
+		len(head) >= 2 && head[0] != 0 && head[1] == 0:
+		return encodingUTF16LE
+
+	default:
+		return encodingUTF8
+	}
+}
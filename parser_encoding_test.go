@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16, with or without a byte order mark.
+func encodeUTF16(s string, order binary.ByteOrder, bom bool) []byte {
+	var units []uint16
+	if bom {
+		units = append(units, 0xfeff)
+	}
+	units = append(units, utf16.Encode([]rune(s))...)
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+func TestParseEncodings(t *testing.T) {
+	t.Parallel()
+
+	const src = "steps:\n  - command: echo héllo 👋\n"
+	tests := []struct {
+		desc  string
+		input []byte
+	}{
+		{desc: "UTF-8", input: []byte(src)},
+		{desc: "UTF-8 with BOM", input: append([]byte("\ufeff"), src...)},
+		{desc: "UTF-16LE with BOM", input: encodeUTF16(src, binary.LittleEndian, true)},
+		{desc: "UTF-16BE with BOM", input: encodeUTF16(src, binary.BigEndian, true)},
+		{desc: "UTF-16LE", input: encodeUTF16(src, binary.LittleEndian, false)},
+		{desc: "UTF-16BE", input: encodeUTF16(src, binary.BigEndian, false)},
+	}
+
+	want := &Pipeline{Steps: Steps{&CommandStep{Command: "echo héllo 👋"}}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if diff := diffPipeline(got, want); diff != "" {
+				t.Errorf("Parse() diff (-got +want):\n%s", diff)
+			}
+
+			got, err = Parse(bytes.NewReader(test.input), WithMaxInputBytes(1024))
+			if err != nil {
+				t.Fatalf("Parse(WithMaxInputBytes) error = %v", err)
+			}
+			if diff := diffPipeline(got, want); diff != "" {
+				t.Errorf("Parse(WithMaxInputBytes) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseAutoUTF16JSON(t *testing.T) {
+	t.Parallel()
+
+	input := encodeUTF16(`{"steps": [{"command": "make"}]}`, binary.LittleEndian, true)
+	_, format, err := ParseAuto(bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseAuto() error = %v", err)
+	}
+	if !format.JSON {
+		t.Errorf("ParseAuto() format = %v, want json", format)
+	}
+}
+
+func TestParseUnsupportedEncodings(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string][]byte{
+		"UTF-32BE":          {0, 0, 0xfe, 0xff, 0, 0, 0, 's'},
+		"UTF-32LE":          {'s', 0, 0, 0, 't', 0, 0, 0},
+		"odd-length UTF-16": append(encodeUTF16("steps: []", binary.LittleEndian, true), 0),
+	}
+	for desc, input := range tests {
+		_, err := Parse(bytes.NewReader(input))
+		if !errors.Is(err, ErrUnsupportedEncoding) {
+			t.Errorf("Parse(%s) error = %v, want %v", desc, err, ErrUnsupportedEncoding)
+		}
+	}
+
+	// Empty and very short inputs are not mistaken for other encodings.
+	for _, input := range []string{"", "~", "[]"} {
+		if _, err := Parse(strings.NewReader(input)); errors.Is(err, ErrUnsupportedEncoding) {
+			t.Errorf("Parse(%q) error = %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ParseReaderAt parses a pipeline like Parse, from the first size bytes of r.
+// It is intended for large pipelines in files (or other random-access
+// storage): the input is read a buffer at a time as it is parsed, rather than
+// all at once, even with a limit set by WithMaxInputBytes, since the limit is
+// checked against size before parsing starts. Since the input isn't kept, a
+// mapping written in flow style where a string is expected is turned back
+// into a string from its contents, rather than the text it was written as
+// (see ordered.WithSource). Input in UTF-16 is read in full to be converted.
+func ParseReaderAt(r io.ReaderAt, size int64, opts ...ParseOption) (*Pipeline, error) {
+	cfg := new(parseConfig)
+	for _, o := range opts {
+		o(cfg)
+	}
+	if cfg.maxInputBytes > 0 && size > cfg.maxInputBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrInputTooLarge, cfg.maxInputBytes)
+	}
+
+	// A mapped file is already in memory, so it can be kept as the source
+	// without a copy (unless it needs converting from UTF-16).
+	if b, ok := r.(bytesReaderAt); ok && int64(len(b)) >= size {
+		data, err := decodeText(b[:size])
+		if err != nil {
+			return nil, err
+		}
+		return cfg.parseDecoded(bytes.NewReader(data), data)
+	}
+	src, err := decodeTextReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	return cfg.parseDecoded(src, nil)
+}
+
+// ParseFile parses the pipeline in the named file like Parse. Where the
+// operating system supports it, the file is memory-mapped rather than read,
+// so that very large pipelines are parsed without a copy of the file on the
+// heap (and the mapped text is the source for flow-style mappings, as with
+// Parse); otherwise (or if mapping fails) it is parsed with ParseReaderAt. The
+// parsed pipeline doesn't refer to the mapped memory, which is unmapped
+// before ParseFile returns. As with any memory-mapped file, the file must not
+// be truncated while it is being parsed.
+func ParseFile(name string, opts ...ParseOption) (*Pipeline, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+
+	data, unmap, err := mmapFile(f, size)
+	if err != nil {
+		// Mapping isn't supported, or failed (the file may be empty, or
+		// something other than a regular file).
+		return ParseReaderAt(f, size, opts...)
+	}
+	defer unmap()
+	return ParseReaderAt(bytesReaderAt(data), int64(len(data)), opts...)
+}
+
+// bytesReaderAt is an io.ReaderAt reading from a byte slice, without the
+// state of a bytes.Reader.
+type bytesReaderAt []byte
+
+func (b bytesReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
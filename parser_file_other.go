@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package pipeline
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile reports that memory-mapping files isn't supported.
+func mmapFile(*os.File, int64) ([]byte, func(), error) {
+	return nil, nil, errors.New("memory-mapping files is not supported")
+}
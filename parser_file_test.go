@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseReaderAt(t *testing.T) {
+	t.Parallel()
+
+	const input = "steps:\n  - command: hello\n  - wait\n"
+	got, err := ParseReaderAt(strings.NewReader(input+"ignored: after size\n"), int64(len(input)), WithMaxInputBytes(int64(len(input))))
+	if err != nil {
+		t.Fatalf("ParseReaderAt(input) error = %v", err)
+	}
+	want := &Pipeline{
+		Steps: Steps{
+			&CommandStep{Command: "hello"},
+			&WaitStep{Scalar: "wait"},
+		},
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("ParseReaderAt(input) diff (-got +want):\n%s", diff)
+	}
+
+	if _, err := ParseReaderAt(strings.NewReader(input), int64(len(input)), WithMaxInputBytes(10)); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("ParseReaderAt(input, WithMaxInputBytes(10)) error = %v, want %v", err, ErrInputTooLarge)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tests := []struct {
+		desc    string
+		content string
+		want    *Pipeline
+	}{
+		{
+			desc:    "yaml",
+			content: "steps:\n  - command: hello\n",
+			want:    &Pipeline{Steps: Steps{&CommandStep{Command: "hello"}}},
+		},
+		{
+			desc:    "utf-16",
+			content: "\xff\xfes\x00t\x00e\x00p\x00s\x00:\x00 \x00[\x00w\x00a\x00i\x00t\x00]\x00",
+			want:    &Pipeline{Steps: Steps{&WaitStep{Scalar: "wait"}}},
+		},
+		{
+			desc:    "empty",
+			content: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			name := filepath.Join(dir, test.desc+".yml")
+			if err := os.WriteFile(name, []byte(test.content), 0o600); err != nil {
+				t.Fatalf("os.WriteFile(%q) error = %v", name, err)
+			}
+			got, err := ParseFile(name)
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("ParseFile(%q) = %v, want an error", name, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFile(%q) error = %v", name, err)
+			}
+			if diff := diffPipeline(got, test.want); diff != "" {
+				t.Errorf("ParseFile(%q) diff (-got +want):\n%s", name, diff)
+			}
+		})
+	}
+
+	if _, err := ParseFile(filepath.Join(dir, "missing.yml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ParseFile(missing) error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+// benchPipelineBytes is the size of the pipelines generated for benchmarks
+// of parsing large files. Parsing one takes a while, and a few GB of memory.
+const benchPipelineBytes = 100 << 20
+
+// writeBenchPipeline writes a pipeline of at least benchPipelineBytes to a
+// file in a temporary directory, and returns its name.
+func writeBenchPipeline(b *testing.B) string {
+	b.Helper()
+	name := filepath.Join(b.TempDir(), "pipeline.yml")
+	f, err := os.Create(name)
+	if err != nil {
+		b.Fatalf("os.Create(%q) error = %v", name, err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "steps:")
+	n := 0
+	for i := 0; n < benchPipelineBytes; i++ {
+		m, _ := fmt.Fprintf(w, "  - label: Step %[1]d\n    key: step-%[1]d\n    command: make test SHARD=%[1]d\n    env:\n      SHARD: \"%[1]d\"\n", i)
+		n += m
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatalf("writing %q: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatalf("f.Close() error = %v", err)
+	}
+	b.SetBytes(int64(n))
+	return name
+}
+
+func BenchmarkParseFile(b *testing.B) {
+	name := writeBenchPipeline(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFile(name); err != nil {
+			b.Fatalf("ParseFile(%q) error = %v", name, err)
+		}
+	}
+}
+
+func BenchmarkParseReadFile(b *testing.B) {
+	name := writeBenchPipeline(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatalf("os.ReadFile(%q) error = %v", name, err)
+		}
+		if _, err := Parse(bytes.NewReader(data)); err != nil {
+			b.Fatalf("Parse(data) error = %v", err)
+		}
+	}
+}
+
+// TestParseFileAllocations checks that parsing a large file doesn't copy it
+// onto the heap. It measures allocations across the whole program, so it
+// must not run in parallel with other tests.
+func TestParseFileAllocations(t *testing.T) {
+	const padding = 16 << 20
+
+	name := filepath.Join(t.TempDir(), "pipeline.yml")
+	content := "steps: [{command: hello}]\n" + strings.Repeat("\n", padding)
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatalf("os.WriteFile(%q) error = %v", name, err)
+	}
+
+	parseReaderAt := func(name string) (*Pipeline, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseReaderAt(f, int64(len(content)))
+	}
+
+	for desc, parse := range map[string]func(string) (*Pipeline, error){
+		"ParseFile":     func(name string) (*Pipeline, error) { return ParseFile(name) },
+		"ParseReaderAt": parseReaderAt,
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if _, err := parse(name); err != nil {
+			t.Fatalf("%s(%q) error = %v", desc, name, err)
+		}
+		runtime.ReadMemStats(&after)
+
+		if got, limit := after.TotalAlloc-before.TotalAlloc, uint64(padding/8); got > limit {
+			t.Errorf("%s(%q) allocated %d bytes, want at most %d (the file is %d bytes)", desc, name, got, limit, len(content))
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeTag is the YAML tag handled by an IncludeResolver.
+const IncludeTag = "!include"
+
+// DefaultMaxIncludeDepth is the include depth limit used by
+// NewIncludeResolver.
+const DefaultMaxIncludeDepth = 10
+
+// DefaultMaxIncludes is the limit on the total number of includes resolved
+// while parsing a pipeline used by NewIncludeResolver.
+const DefaultMaxIncludes = 100
+
+// Errors that can be returned while resolving includes (typically wrapped -
+// use errors.Is).
+var (
+	ErrIncludeCycle    = errors.New("include cycle")
+	ErrIncludeTooDeep  = errors.New("includes nested too deeply")
+	ErrIncludeNotFound = errors.New("included file not found")
+	ErrTooManyIncludes = errors.New("too many includes")
+)
+
+// IncludeFetcher fetches the contents of included files. Names passed to Fetch
+// are slash-separated, cleaned, and relative to the root of the fetcher.
+type IncludeFetcher interface {
+	Fetch(name string) ([]byte, error)
+}
+
+// IncludeFetcherFunc adapts a function into an IncludeFetcher.
+type IncludeFetcherFunc func(name string) ([]byte, error)
+
+// Fetch calls f(name).
+func (f IncludeFetcherFunc) Fetch(name string) ([]byte, error) { return f(name) }
+
+// FSFetcher returns an IncludeFetcher that reads files from fsys.
+func FSFetcher(fsys fs.FS) IncludeFetcher {
+	return IncludeFetcherFunc(func(name string) ([]byte, error) {
+		b, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %q", ErrIncludeNotFound, name)
+		}
+		return b, err
+	})
+}
+
+// IncludeResolver resolves `!include path/to/file.yml` references within a
+// pipeline. Paths in the top-level document are relative to the root of the
+// fetcher, and paths within included files are relative to the directory
+// containing the including file.
+//
+// The resolver records which file each step came from; use Source after
+// parsing to look it up (sources are forgotten when the next parse starts).
+// A resolver can be used for multiple calls to Parse,
+// but not concurrently.
+type IncludeResolver struct {
+	// Fetcher fetches included files.
+	Fetcher IncludeFetcher
+
+	// MaxDepth limits how deeply includes can be nested. Zero or less means
+	// no limit (cycles are still detected).
+	MaxDepth int
+
+	// MaxIncludes limits the total number of includes resolved while
+	// parsing a pipeline, counting each time a file is included. This stops
+	// files that include each other many times over from fanning out into a
+	// huge document. Zero or less means no limit.
+	MaxIncludes int
+
+	// includes counts the includes resolved so far in the current parse.
+	includes int
+
+	// nodeSources maps resolved include nodes to the file they came from.
+	nodeSources map[*yaml.Node]string
+
+	// stepSources maps steps to the included file they came from.
+	stepSources map[Step]string
+}
+
+// NewIncludeResolver returns a resolver using fetcher, with a MaxDepth of
+// DefaultMaxIncludeDepth and MaxIncludes of DefaultMaxIncludes.
+func NewIncludeResolver(fetcher IncludeFetcher) *IncludeResolver {
+	return &IncludeResolver{
+		Fetcher:     fetcher,
+		MaxDepth:    DefaultMaxIncludeDepth,
+		MaxIncludes: DefaultMaxIncludes,
+	}
+}
+
+// WithIncludes is a ParseOption that resolves `!include` tags using r.
+func WithIncludes(r *IncludeResolver) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.beforeParse = append(cfg.beforeParse, r.reset)
+		WithTagHandler(IncludeTag, func(n *yaml.Node) (any, error) {
+			return r.include(n, "", nil)
+		})(cfg)
+		cfg.afterParse = append(cfg.afterParse, r.recordSteps)
+	}
+}
+
+// Source reports the included file that a step came from. Steps that were
+// written directly in the top-level document have no source.
+func (r *IncludeResolver) Source(s Step) (string, bool) {
+	src, ok := r.stepSources[s]
+	return src, ok
+}
+
+// reset forgets the state of any previous parse.
+func (r *IncludeResolver) reset() {
+	r.includes = 0
+	r.nodeSources = nil
+	r.stepSources = nil
+}
+
+// include fetches and decodes the file named by the value of n, which was
+// found within the file from (the empty string for the top-level document).
+// Includes within the fetched file are resolved recursively. stack contains
+// the chain of files currently being included, for cycle detection.
+func (r *IncludeResolver) include(n *yaml.Node, from string, stack []string) (*yaml.Node, error) {
+	if n.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%s must be followed by a file path", IncludeTag)
+	}
+
+	name := strings.TrimPrefix(n.Value, "/")
+	if !strings.HasPrefix(n.Value, "/") {
+		name = path.Join(path.Dir(from), name)
+	}
+	name = path.Clean(name)
+
+	for _, s := range stack {
+		if s == name {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrIncludeCycle, strings.Join(stack, " -> "), name)
+		}
+	}
+	stack = append(stack, name)
+	if r.MaxDepth > 0 && len(stack) > r.MaxDepth {
+		return nil, fmt.Errorf("%w: %s (limit %d)", ErrIncludeTooDeep, strings.Join(stack, " -> "), r.MaxDepth)
+	}
+	r.includes++
+	if r.MaxIncludes > 0 && r.includes > r.MaxIncludes {
+		return nil, fmt.Errorf("%w: including %q (limit %d)", ErrTooManyIncludes, name, r.MaxIncludes)
+	}
+
+	src, err := r.Fetcher.Fetch(name)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %q: %w", name, err)
+	}
+	if src, err = decodeText(src); err != nil {
+		return nil, fmt.Errorf("decoding %q: %w", name, err)
+	}
+
+	doc := new(yaml.Node)
+	if err := yaml.NewDecoder(bytes.NewReader(src)).Decode(doc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("parsing %q: %w", name, formatYAMLError(err))
+	}
+
+	// An included file is a single value, not a whole document.
+	root := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 {
+		root = doc.Content[0]
+	}
+
+	if err := r.resolveWithin(root, name, stack); err != nil {
+		return nil, err
+	}
+
+	if r.nodeSources == nil {
+		r.nodeSources = make(map[*yaml.Node]string)
+	}
+	// n is about to be overwritten with the contents of root, so record the
+	// source against n.
+	r.nodeSources[n] = name
+	return root, nil
+}
+
+// resolveWithin replaces `!include` nodes found within n, which came from the
+// file from.
+func (r *IncludeResolver) resolveWithin(n *yaml.Node, from string, stack []string) error {
+	if n.Tag == IncludeTag {
+		rn, err := r.include(n, from, stack)
+		if err != nil {
+			return fmt.Errorf("%s: line %d, col %d: %w", from, n.Line, n.Column, err)
+		}
+		rn.Line, rn.Column = n.Line, n.Column
+		*n = *rn
+		return nil
+	}
+	for _, c := range n.Content {
+		if err := r.resolveWithin(c, from, stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSteps pairs the steps in p with the nodes in doc that they were
+// decoded from, recording the source file of any that were included.
+func (r *IncludeResolver) recordSteps(doc *yaml.Node, p *Pipeline) {
+	if len(r.nodeSources) == 0 {
+		return
+	}
+	if r.stepSources == nil {
+		r.stepSources = make(map[Step]string)
+	}
+
+	src := r.nodeSources[doc]
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 {
+		doc = doc.Content[0]
+		if s, ok := r.nodeSources[doc]; ok {
+			src = s
+		}
+	}
+	if doc.Kind == yaml.MappingNode {
+		doc, src = r.mappingValue(doc, "steps", src)
+	}
+	r.recordStepSeq(doc, p.Steps, src)
+}
+
+// recordStepSeq records the sources of steps decoded from the sequence n.
+func (r *IncludeResolver) recordStepSeq(n *yaml.Node, steps Steps, src string) {
+	n, src = r.deref(n, src)
+	if n == nil || n.Kind != yaml.SequenceNode || len(n.Content) != len(steps) {
+		return
+	}
+	for i, c := range n.Content {
+		c, csrc := r.deref(c, src)
+		if csrc != "" {
+			r.stepSources[steps[i]] = csrc
+		}
+		if g, ok := steps[i].(*GroupStep); ok && c.Kind == yaml.MappingNode {
+			sn, ssrc := r.mappingValue(c, "steps", csrc)
+			r.recordStepSeq(sn, g.Steps, ssrc)
+		}
+	}
+}
+
+// mappingValue finds the value for key in the mapping n.
+func (r *IncludeResolver) mappingValue(n *yaml.Node, key, src string) (*yaml.Node, string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return r.deref(n.Content[i+1], src)
+		}
+	}
+	return nil, src
+}
+
+// deref follows aliases, and updates the source if n was included.
+func (r *IncludeResolver) deref(n *yaml.Node, src string) (*yaml.Node, string) {
+	for n != nil {
+		if s, ok := r.nodeSources[n]; ok {
+			src = s
+		}
+		if n.Kind != yaml.AliasNode {
+			break
+		}
+		n = n.Alias
+	}
+	return n, src
+}
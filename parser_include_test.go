@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParserIncludes(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"steps/lint.yml": {Data: []byte("command: make lint\n")},
+		"steps/test.yml": {Data: []byte("group: Tests\nsteps:\n  - command: make test\n  - !include unit.yml\n")},
+		"steps/unit.yml": {Data: []byte("command: make unit\n")},
+	}
+
+	const input = `---
+steps:
+  - command: echo top
+  - !include steps/lint.yml
+  - !include steps/test.yml
+`
+	r := NewIncludeResolver(FSFetcher(fsys))
+	got, err := Parse(strings.NewReader(input), WithIncludes(r))
+	if err != nil {
+		t.Fatalf("Parse(input, WithIncludes(r)) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Steps: Steps{
+			&CommandStep{Command: "echo top"},
+			&CommandStep{Command: "make lint"},
+			&GroupStep{
+				Group: ptr("Tests"),
+				Steps: Steps{
+					&CommandStep{Command: "make test"},
+					&CommandStep{Command: "make unit"},
+				},
+			},
+		},
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Fatalf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+
+	group := got.Steps[2].(*GroupStep)
+	sources := []struct {
+		step Step
+		want string
+	}{
+		{step: got.Steps[0], want: ""},
+		{step: got.Steps[1], want: "steps/lint.yml"},
+		{step: group, want: "steps/test.yml"},
+		{step: group.Steps[0], want: "steps/test.yml"},
+		{step: group.Steps[1], want: "steps/unit.yml"},
+	}
+	for i, s := range sources {
+		src, _ := r.Source(s.step)
+		if diff := cmp.Diff(src, s.want); diff != "" {
+			t.Errorf("r.Source(step %d) diff (-got +want):\n%s", i, diff)
+		}
+	}
+
+	// Parsing again with the same resolver forgets the earlier sources.
+	if _, err := Parse(strings.NewReader("steps: [{command: echo again}]\n"), WithIncludes(r)); err != nil {
+		t.Fatalf("Parse(again, WithIncludes(r)) error = %v", err)
+	}
+	for i, s := range sources {
+		if src, ok := r.Source(s.step); ok {
+			t.Errorf("after parsing again, r.Source(step %d) = (%q, true), want (\"\", false)", i, src)
+		}
+	}
+}
+
+func TestParserIncludeErrors(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"a.yml":     {Data: []byte("- !include b.yml\n")},
+		"b.yml":     {Data: []byte("- !include a.yml\n")},
+		"deep.yml":  {Data: []byte("- !include deep2.yml\n")},
+		"deep2.yml": {Data: []byte("- !include deep3.yml\n")},
+		"deep3.yml": {Data: []byte("command: deep\n")},
+		// Each level includes the next one ten times over.
+		"fan1.yml": {Data: []byte(strings.Repeat("- !include fan2.yml\n", 10))},
+		"fan2.yml": {Data: []byte(strings.Repeat("- !include fan3.yml\n", 10))},
+		"fan3.yml": {Data: []byte(strings.Repeat("- command: fan\n", 10))},
+	}
+
+	tests := []struct {
+		desc        string
+		input       string
+		maxDepth    int
+		maxIncludes int
+		wantErr     error
+	}{
+		{
+			desc:     "cycle",
+			input:    "steps: !include a.yml\n",
+			maxDepth: DefaultMaxIncludeDepth,
+			wantErr:  ErrIncludeCycle,
+		},
+		{
+			desc:     "too deep",
+			input:    "steps: !include deep.yml\n",
+			maxDepth: 2,
+			wantErr:  ErrIncludeTooDeep,
+		},
+		{
+			desc:     "missing file",
+			input:    "steps:\n  - !include nope.yml\n",
+			maxDepth: DefaultMaxIncludeDepth,
+			wantErr:  ErrIncludeNotFound,
+		},
+		{
+			desc:        "too many",
+			input:       "steps: !include fan1.yml\n",
+			maxDepth:    DefaultMaxIncludeDepth,
+			maxIncludes: DefaultMaxIncludes,
+			wantErr:     ErrTooManyIncludes,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewIncludeResolver(FSFetcher(fsys))
+			r.MaxDepth = test.maxDepth
+			r.MaxIncludes = test.maxIncludes
+			_, err := Parse(strings.NewReader(test.input), WithIncludes(r))
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Parse(%q, WithIncludes(r)) error = %v, want %v", test.input, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Errors returned (wrapped) by Parse when limits set by WithMaxSteps,
+// WithMaxGroupChildren, or WithMemoryBudget are exceeded.
+var (
+	ErrTooManySteps         = errors.New("pipeline has too many steps")
+	ErrTooManyGroupChildren = errors.New("group step has too many steps")
+	ErrMemoryBudgetExceeded = errors.New("pipeline exceeds the memory budget")
+)
+
+// WithMaxSteps is a ParseOption that limits the total number of steps in the
+// pipeline (including steps within groups) to n. Parse fails with an error
+// wrapping ErrTooManySteps if there are more, before the steps are decoded.
+// Zero or less means no limit.
+func WithMaxSteps(n int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxSteps = n
+	}
+}
+
+// WithMaxGroupChildren is a ParseOption that limits the number of steps in
+// each group step to n. Parse fails with an error wrapping
+// ErrTooManyGroupChildren if any group has more, before the steps are decoded.
+// Zero or less means no limit.
+func WithMaxGroupChildren(n int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxGroupChildren = n
+	}
+}
+
+// WithMemoryBudget is a ParseOption that limits the memory used by the parsed
+// pipeline (as measured by Pipeline.MemoryFootprint) to n bytes. Parse fails
+// with an error wrapping ErrMemoryBudgetExceeded if the pipeline is bigger.
+// The raw document is checked before the steps are decoded, so that documents
+// that are obviously too big (for example, due to aliases that expand
+// enormously) are rejected early. Zero or less means no limit.
+func WithMemoryBudget(n int64) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.memoryBudget = n
+	}
+}
+
+// checkLimits counts the steps in the raw document n, and reports an error if
+// there are too many.
+func (cfg *parseConfig) checkLimits(n *yaml.Node) error {
+	if cfg.maxSteps <= 0 && cfg.maxGroupChildren <= 0 {
+		return nil
+	}
+	c := &stepCounter{cfg: cfg, active: make(map[*yaml.Node]bool)}
+	return c.countSteps(stepsSequence(n), "steps")
+}
+
+// stepCounter counts steps within a raw document.
+type stepCounter struct {
+	cfg   *parseConfig
+	count int
+
+	// active contains the sequences currently being counted, so that cycles
+	// made with aliases don't recurse forever.
+	active map[*yaml.Node]bool
+}
+
+// countSteps adds the steps in the sequence seq (and any groups within it) to
+// the count, stopping as soon as a limit is exceeded.
+func (c *stepCounter) countSteps(seq *yaml.Node, path string) error {
+	seq = resolveAlias(seq)
+	if seq == nil || seq.Kind != yaml.SequenceNode || c.active[seq] {
+		return nil
+	}
+	c.active[seq] = true
+	defer delete(c.active, seq)
+
+	cfg := c.cfg
+	for i, s := range seq.Content {
+		c.count++
+		if cfg.maxSteps > 0 && c.count > cfg.maxSteps {
+			return fmt.Errorf("%w: the limit is %d", ErrTooManySteps, cfg.maxSteps)
+		}
+
+		s = resolveAlias(s)
+		if s.Kind != yaml.MappingNode || mappingValue(s, "group") == nil {
+			continue
+		}
+		children := resolveAlias(mappingValue(s, "steps"))
+		if children == nil || children.Kind != yaml.SequenceNode {
+			continue
+		}
+		stepPath := fmt.Sprintf("%s[%d]", path, i)
+		if cfg.maxGroupChildren > 0 && len(children.Content) > cfg.maxGroupChildren {
+			return fmt.Errorf("%s: %w: %d steps, the limit is %d", stepPath, ErrTooManyGroupChildren, len(children.Content), cfg.maxGroupChildren)
+		}
+		if err := c.countSteps(children, stepPath+".steps"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveAlias follows alias nodes to the node they refer to.
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// scalarFootprint is a lower bound on the memory used by each decoded scalar,
+// other than its contents: the string header, or the interface holding it.
+const scalarFootprint = 16
+
+// checkDocumentMemory estimates the memory needed to decode the raw document
+// n, with aliases expanded, and reports an error if it is certain to exceed
+// the memory budget. The estimate is a lower bound, so that pipelines within
+// the budget are never rejected here.
+func (cfg *parseConfig) checkDocumentMemory(n *yaml.Node) error {
+	if cfg.memoryBudget <= 0 {
+		return nil
+	}
+	var size int64
+	active := make(map[*yaml.Node]bool)
+	var walk func(*yaml.Node) bool
+	walk = func(n *yaml.Node) bool {
+		n = resolveAlias(n)
+		if n == nil || active[n] {
+			return true
+		}
+		if n.Kind == yaml.ScalarNode {
+			size += scalarFootprint + int64(len(n.Value))
+			return size <= cfg.memoryBudget
+		}
+		active[n] = true
+		defer delete(active, n)
+		for _, c := range n.Content {
+			if !walk(c) {
+				return false
+			}
+		}
+		return true
+	}
+	if !walk(n) {
+		return fmt.Errorf("%w: the document needs more than %d bytes", ErrMemoryBudgetExceeded, cfg.memoryBudget)
+	}
+	return nil
+}
+
+// checkPipelineMemory reports an error if the parsed pipeline exceeds the
+// memory budget.
+func (cfg *parseConfig) checkPipelineMemory(p *Pipeline) error {
+	if cfg.memoryBudget <= 0 {
+		return nil
+	}
+	if size := p.MemoryFootprint(); size > cfg.memoryBudget {
+		return fmt.Errorf("%w: the pipeline uses about %d bytes, the limit is %d", ErrMemoryBudgetExceeded, size, cfg.memoryBudget)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseLimits(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - command: make
+  - wait
+  - group: Tests
+    steps:
+      - command: make test
+      - command: make lint
+      - &check
+        command: make check
+  - *check
+`
+	tests := []struct {
+		desc    string
+		opts    []ParseOption
+		wantErr error
+	}{
+		{
+			desc: "no limits",
+		},
+		{
+			desc: "within limits",
+			opts: []ParseOption{WithMaxSteps(7), WithMaxGroupChildren(3)},
+		},
+		{
+			desc:    "too many steps",
+			opts:    []ParseOption{WithMaxSteps(6)},
+			wantErr: ErrTooManySteps,
+		},
+		{
+			desc:    "too many group children",
+			opts:    []ParseOption{WithMaxGroupChildren(2)},
+			wantErr: ErrTooManyGroupChildren,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(strings.NewReader(input), test.opts...)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Parse(input, opts...) error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseLimitsLegacySequence(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+- command: make
+- wait
+- command: make test
+`
+	if _, err := Parse(strings.NewReader(input), WithMaxSteps(2)); !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("Parse(input, WithMaxSteps(2)) error = %v, want %v", err, ErrTooManySteps)
+	}
+}
+
+func TestParseMemoryBudget(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+env:
+  GREETING: hello
+steps:
+  - command: make
+  - group: Tests
+    steps:
+      - command: make test
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	footprint := p.MemoryFootprint()
+
+	tests := []struct {
+		desc    string
+		budget  int64
+		wantErr error
+	}{
+		{
+			desc: "no budget",
+		},
+		{
+			desc:   "within budget",
+			budget: footprint,
+		},
+		{
+			desc:    "pipeline over budget",
+			budget:  footprint - 1,
+			wantErr: ErrMemoryBudgetExceeded,
+		},
+		{
+			desc:    "document over budget",
+			budget:  10,
+			wantErr: ErrMemoryBudgetExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(strings.NewReader(input), WithMemoryBudget(test.budget))
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Parse(input, WithMemoryBudget(%d)) error = %v, want %v", test.budget, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseMemoryBudgetAliasExpansion(t *testing.T) {
+	t.Parallel()
+
+	// Each level doubles the expanded size, to about 2^20 scalars.
+	var b strings.Builder
+	b.WriteString("a0: &a0 [x, x]\n")
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&b, "a%d: &a%d [*a%d, *a%d]\n", i, i, i-1, i-1)
+	}
+	b.WriteString("steps:\n  - command: make\n")
+
+	_, err := Parse(strings.NewReader(b.String()), WithMemoryBudget(1<<20))
+	if !errors.Is(err, ErrMemoryBudgetExceeded) {
+		t.Errorf("Parse(input, WithMemoryBudget(1<<20)) error = %v, want %v", err, ErrMemoryBudgetExceeded)
+	}
+}
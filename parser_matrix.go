@@ -0,0 +1,101 @@
+package pipeline
+
+import "gopkg.in/yaml.v3"
+
+// preserveMatrixValues retags the plain (unquoted) numbers and booleans among
+// the matrix values of the steps in the raw document n as strings, so that
+// they decode as they were written: 3.10 as "3.10" rather than "3.1", and 010
+// as "010" rather than "8". Matrix values are always strings, so this only
+// changes their spelling, which matters when they are substituted into image
+// tags and the like. Only the values in setups and adjustment "with" items are
+// retagged. Anchored values (which may be used elsewhere) are left alone.
+//
+// It returns a function that restores the original tags, so that the raw
+// document can be left unchanged once it has been decoded.
+func preserveMatrixValues(n *yaml.Node) (restore func()) {
+	var retagged []*yaml.Node
+	retag := func(n *yaml.Node) {
+		if n == nil || n.Kind != yaml.ScalarNode || n.Style != 0 || n.Anchor != "" {
+			return
+		}
+		switch n.Tag {
+		case "!!int", "!!float", "!!bool":
+			retagged = append(retagged, n)
+		}
+	}
+	// retagValues retags a dimension's values (a sequence), a single value, or
+	// the values of each dimension in a mapping.
+	var retagValues func(n *yaml.Node, depth int)
+	retagValues = func(n *yaml.Node, depth int) {
+		n = resolveAlias(n)
+		if n == nil {
+			return
+		}
+		switch n.Kind {
+		case yaml.ScalarNode:
+			retag(n)
+		case yaml.SequenceNode:
+			for _, c := range n.Content {
+				retag(resolveAlias(c))
+			}
+		case yaml.MappingNode:
+			if depth > 0 {
+				return
+			}
+			for i := 1; i < len(n.Content); i += 2 {
+				retagValues(n.Content[i], depth+1)
+			}
+		}
+	}
+
+	active := make(map[*yaml.Node]bool)
+	var walk func(seq *yaml.Node)
+	walk = func(seq *yaml.Node) {
+		seq = resolveAlias(seq)
+		if seq == nil || seq.Kind != yaml.SequenceNode || active[seq] {
+			return
+		}
+		active[seq] = true
+		defer delete(active, seq)
+
+		for _, s := range seq.Content {
+			s = resolveAlias(s)
+			if s == nil || s.Kind != yaml.MappingNode {
+				continue
+			}
+			if mappingValue(s, "group") != nil {
+				walk(mappingValue(s, "steps"))
+				continue
+			}
+			m := resolveAlias(mappingValue(s, "matrix"))
+			if m == nil {
+				continue
+			}
+			switch m.Kind {
+			case yaml.SequenceNode:
+				retagValues(m, 0)
+			case yaml.MappingNode:
+				retagValues(mappingValue(m, "setup"), 0)
+				adjs := resolveAlias(mappingValue(m, "adjustments"))
+				if adjs == nil || adjs.Kind != yaml.SequenceNode {
+					continue
+				}
+				for _, adj := range adjs.Content {
+					retagValues(mappingValue(resolveAlias(adj), "with"), 0)
+				}
+			}
+		}
+	}
+	walk(stepsSequence(n))
+
+	orig := make([]string, len(retagged))
+	for i, r := range retagged {
+		orig[i] = r.Tag
+		r.Tag = "!!str"
+	}
+	return func() {
+		for i := len(retagged) - 1; i >= 0; i-- {
+			retagged[i].Tag = orig[i]
+		}
+	}
+}
@@ -121,10 +121,8 @@ steps:
 									Skip: true,
 								},
 								{
-									With: MatrixAdjustmentWith{"": "42"},
-									RemainingFields: map[string]any{
-										"soft_fail": true,
-									},
+									With:     MatrixAdjustmentWith{"": "42"},
+									SoftFail: &SoftFail{All: true},
 								},
 								{
 									With: MatrixAdjustmentWith{"": "banana"},
@@ -277,9 +275,7 @@ steps:
 										"arch": "ppc",
 										"os":   "8",
 									},
-									RemainingFields: map[string]any{
-										"soft_fail": true,
-									},
+									SoftFail: &SoftFail{All: true},
 								},
 							},
 						},
@@ -383,9 +379,7 @@ steps:
 										"arch": "s390x",
 										"os":   "zos",
 									},
-									RemainingFields: map[string]any{
-										"soft_fail": true,
-									},
+									SoftFail: &SoftFail{All: true},
 								},
 							},
 						},
@@ -488,3 +482,76 @@ steps:
 		})
 	}
 }
+
+func TestParser_MatrixValuesAsWritten(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - command: docker run python:{{matrix.python}} --workers {{matrix.workers}}
+    plugins:
+      - docker#v5.10.0:
+          version: 3.10
+    matrix:
+      setup:
+        python: [3.10, "3.11", 3.9]
+        workers: [010, 0x1F, True]
+      adjustments:
+        - with: {python: 3.20, workers: 1.0}
+  - group: Tests
+    steps:
+      - command: test {{matrix}}
+        matrix: [1.10, 2.0]
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Steps: Steps{
+			&CommandStep{
+				Command: "docker run python:{{matrix.python}} --workers {{matrix.workers}}",
+				Plugins: Plugins{
+					{Source: "docker#v5.10.0", Config: map[string]any{"version": 3.1}},
+				},
+				Matrix: &Matrix{
+					Setup: MatrixSetup{
+						"python":  {"3.10", "3.11", "3.9"},
+						"workers": {"010", "0x1F", "True"},
+					},
+					Adjustments: MatrixAdjustments{
+						{With: MatrixAdjustmentWith{"python": "3.20", "workers": "1.0"}},
+					},
+				},
+			},
+			&GroupStep{
+				Group: ptr("Tests"),
+				Steps: Steps{
+					&CommandStep{
+						Command: "test {{matrix}}",
+						Matrix:  &Matrix{Setup: MatrixSetup{"": {"1.10", "2.0"}}},
+					},
+				},
+			},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+
+	exps, err := p.Steps[0].(*CommandStep).ExpandMatrix()
+	if err != nil {
+		t.Fatalf("ExpandMatrix() error = %v", err)
+	}
+	var gotCommands []string
+	for _, e := range exps {
+		gotCommands = append(gotCommands, e.Step.Command)
+	}
+	if diff := cmp.Diff(gotCommands[len(gotCommands)-1], "docker run python:3.20 --workers 1.0"); diff != "" {
+		t.Errorf("expanded adjustment command diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(gotCommands[0], "docker run python:3.10 --workers 010"); diff != "" {
+		t.Errorf("first expanded command diff (-got +want):\n%s", diff)
+	}
+}
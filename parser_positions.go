@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+// stepWarningFormat is the message of the warning wrapping the warnings for
+// each step (see Steps.UnmarshalOrdered). Parse uses it to find the warnings
+// that relate to steps, so that their positions can be added.
+const stepWarningFormat = "while unmarshaling step %d of %d"
+
+// stepsSequence returns the sequence of steps within the raw document n, which
+// is either a pipeline mapping or a sequence of steps.
+func stepsSequence(n *yaml.Node) *yaml.Node {
+	n = resolveAlias(n)
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) == 1 {
+		n = resolveAlias(n.Content[0])
+	}
+	if n != nil && n.Kind == yaml.MappingNode {
+		n = mappingValue(n, "steps")
+	}
+	return resolveAlias(n)
+}
+
+// addStepPositions finds the warnings within err that relate to steps, and
+// sets their positions to those of the steps within the raw document n.
+func addStepPositions(err error, n *yaml.Node) {
+	if warning.Is(err) {
+		positionSteps(err, stepsSequence(n))
+	}
+}
+
+// positionSteps sets the positions of the step warnings within err, where seq
+// is the sequence of steps that the warnings relate to.
+func positionSteps(err error, seq *yaml.Node) {
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return
+	}
+
+	var i, n int
+	if w := warning.As(err); w != nil {
+		if _, err := fmt.Sscanf(w.Message(), stepWarningFormat, &i, &n); err == nil && n == len(seq.Content) && i >= 1 && i <= n {
+			step := resolveAlias(seq.Content[i-1])
+			w.At(warning.Position{Line: step.Line, Column: step.Column})
+
+			// Any step warnings within this one relate to the steps of a
+			// group.
+			seq = resolveAlias(mappingValue(step, "steps"))
+		}
+	}
+
+	// Warnings can also be found within ordinary errors (for example, when a
+	// group step falls back to being an UnknownStep).
+	switch err := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, e := range err.Unwrap() {
+			positionSteps(e, seq)
+		}
+	case interface{ Unwrap() error }:
+		positionSteps(err.Unwrap(), seq)
+	}
+}
@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseWarningPositions(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - command: make
+  - wiat
+  - group: Tests
+    steps:
+      - command: make test
+      - type: teleport
+        to: mars
+`
+	_, err := Parse(strings.NewReader(input))
+	w := warning.As(err)
+	if w == nil {
+		t.Fatalf("Parse(input) error = %v, want a warning", err)
+	}
+
+	// Collect the positions of all the warnings in the tree. (The group step
+	// falls back to being an UnknownStep, so its warnings are wrapped within
+	// an ordinary error.)
+	var got []string
+	var collect func(error)
+	collect = func(err error) {
+		if w := warning.As(err); w != nil {
+			if pos, ok := w.Position(); ok {
+				got = append(got, w.Message()+" at "+pos.String())
+			}
+		}
+		switch err := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range err.Unwrap() {
+				collect(e)
+			}
+		case interface{ Unwrap() error }:
+			collect(err.Unwrap())
+		}
+	}
+	collect(w)
+
+	want := []string{
+		"while unmarshaling step 2 of 3 at line 4, column 5",
+		"while unmarshaling step 3 of 3 at line 5, column 5",
+		"while unmarshaling step 2 of 2 at line 8, column 9",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("warning positions diff (-got +want):\n%s", diff)
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "step 2 of 3 at line 4, column 5") {
+		t.Errorf("Parse(input) error = %q, want it to contain the position of step 2", msg)
+	}
+}
@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUnknownFields is returned (wrapped) by Parse when WithStrictFields is
+// given and the pipeline contains fields the library doesn't understand.
+var ErrUnknownFields = errors.New("pipeline contains unknown fields")
+
+// WithStrictFields is a ParseOption that makes Parse fail, with an error
+// wrapping ErrUnknownFields, if the pipeline contains any fields reported by
+// Pipeline.UnknownFields. This catches typos such as "comand" at parse time,
+// rather than when the pipeline runs.
+func WithStrictFields() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.strictFields = true
+	}
+}
+
+// ParseStrict is Parse with the WithStrictFields option.
+func ParseStrict(src io.Reader, opts ...ParseOption) (*Pipeline, error) {
+	return Parse(src, append(opts, WithStrictFields())...)
+}
+
+// checkStrictFields reports an error if strict fields are enabled and p
+// contains unknown fields.
+func (cfg *parseConfig) checkStrictFields(p *Pipeline) error {
+	if !cfg.strictFields {
+		return nil
+	}
+	unknown := p.UnknownFields()
+	if len(unknown) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownFields, strings.Join(unknown, ", "))
+}
@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseStrict(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc    string
+		input   string
+		wantErr string
+	}{
+		{
+			desc: "known fields",
+			input: `---
+agents:
+  queue: default
+steps:
+  - command: make
+    retry:
+      automatic: true
+  - wait
+  - group: Tests
+    steps:
+      - command: make test
+`,
+		},
+		{
+			desc: "typo in command step field",
+			input: `---
+steps:
+  - command: make
+    lable: Build
+`,
+			wantErr: "steps[0].lable",
+		},
+		{
+			desc: "typos in nested and top-level fields",
+			input: `---
+colour: blue
+steps:
+  - group: Tests
+    steps:
+      - command: make test
+        retyr: 2
+`,
+			wantErr: "colour, steps[0].steps[0].retyr",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			// Parse without the option should be lenient.
+			if _, err := Parse(strings.NewReader(test.input)); err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+
+			_, err := ParseStrict(strings.NewReader(test.input))
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("ParseStrict(input) error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUnknownFields) || !strings.HasSuffix(err.Error(), test.wantErr) {
+				t.Errorf("ParseStrict(input) error = %v, want %v ending in %q", err, ErrUnknownFields, test.wantErr)
+			}
+		})
+	}
+}
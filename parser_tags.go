@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TagHandler resolves a node carrying a custom YAML tag (such as
+// `!vault secret/path`) into a value. The returned value is encoded back into
+// the document in place of the tagged node, so it can be anything that
+// yaml.v3 can encode: a string, a map, a slice, a *yaml.Node, and so on.
+// Custom tags within the returned value are resolved in turn.
+type TagHandler func(n *yaml.Node) (any, error)
+
+// WithTagHandler registers a handler for a custom YAML tag. The tag should
+// include the leading `!`, for example `WithTagHandler("!vault", h)`.
+// Tagged nodes are resolved before step types are determined, so handlers
+// can produce whole steps as well as individual values.
+func WithTagHandler(tag string, h TagHandler) ParseOption {
+	return func(cfg *parseConfig) {
+		if cfg.tagHandlers == nil {
+			cfg.tagHandlers = make(map[string]TagHandler)
+		}
+		cfg.tagHandlers[tag] = h
+	}
+}
+
+// resolveTags walks the document, replacing each node with a registered custom
+// tag with the value produced by its handler. Nodes are replaced in-place, so
+// aliases to a tagged node observe the resolved value.
+func (cfg *parseConfig) resolveTags(n *yaml.Node) error {
+	if n == nil || len(cfg.tagHandlers) == 0 {
+		return nil
+	}
+
+	if h, ok := cfg.tagHandlers[n.Tag]; ok {
+		v, err := h(n)
+		if err != nil {
+			return fmt.Errorf("line %d, col %d: resolving tag %s: %w", n.Line, n.Column, n.Tag, err)
+		}
+		// Nodes are used as-is; anything else is encoded into a new node.
+		rn, ok := v.(*yaml.Node)
+		if !ok {
+			rn = new(yaml.Node)
+			if err := rn.Encode(v); err != nil {
+				return fmt.Errorf("line %d, col %d: encoding result of tag %s: %w", n.Line, n.Column, n.Tag, err)
+			}
+		}
+		// Keep the original position for the benefit of later error messages.
+		rn.Line, rn.Column = n.Line, n.Column
+		*n = *rn
+	}
+
+	// Aliases are not followed here - the anchored node is visited where it
+	// is defined.
+	for _, c := range n.Content {
+		if err := cfg.resolveTags(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParserCustomTagHandlers(t *testing.T) {
+	t.Parallel()
+
+	const input = `---
+env:
+  TOKEN: !vault secret/token
+steps:
+  - !shared lint
+  - command: echo hi
+`
+	secrets := map[string]string{"secret/token": "hunter2"}
+	shared := map[string]any{
+		"lint": map[string]any{"command": "make lint", "label": "Lint"},
+	}
+
+	vault := func(n *yaml.Node) (any, error) {
+		return secrets[n.Value], nil
+	}
+	sharedStep := func(n *yaml.Node) (any, error) {
+		return shared[n.Value], nil
+	}
+
+	got, err := Parse(strings.NewReader(input),
+		WithTagHandler("!vault", vault),
+		WithTagHandler("!shared", sharedStep),
+	)
+	if err != nil {
+		t.Fatalf("Parse(input, WithTagHandler(...)...) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Env: ordered.MapFromItems(ordered.TupleSS{Key: "TOKEN", Value: "hunter2"}),
+		Steps: Steps{
+			&CommandStep{Command: "make lint", Label: "Lint"},
+			&CommandStep{Command: "echo hi"},
+		},
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestParserCustomTagHandlerError(t *testing.T) {
+	t.Parallel()
+
+	errBoom := errors.New("boom")
+	_, err := Parse(
+		strings.NewReader("steps:\n  - command: !fail nope\n"),
+		WithTagHandler("!fail", func(*yaml.Node) (any, error) { return nil, errBoom }),
+	)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Parse(input, WithTagHandler(!fail, ...)) error = %v, want %v", err, errBoom)
+	}
+}
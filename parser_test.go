@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,8 +18,16 @@ import (
 
 func ptr[T any](x T) *T { return &x }
 
+// allowUnexported lets cmp compare the types that record the form they were
+// written in with unexported fields.
+var allowUnexported = cmp.AllowUnexported(Agents{}, ArtifactPaths{}, AutomaticRetry{}, ExitStatus{}, GroupStep{}, Int{}, ManualRetry{}, Notification{}, Retry{}, SoftFail{}, SoftFailRule{}, SlackNotification{}, TriggerStep{})
+
 func diffPipeline(got *Pipeline, want *Pipeline) string {
-	return cmp.Diff(got, want, cmp.Comparer(ordered.EqualSS), cmp.Comparer(ordered.EqualSA))
+	return cmp.Diff(got, want,
+		cmp.Comparer(ordered.EqualSS),
+		cmp.Comparer(ordered.EqualSA),
+		allowUnexported,
+	)
 }
 
 func TestParserParsesYAML(t *testing.T) {
@@ -251,10 +260,8 @@ steps:
 			&CommandStep{
 				Label:   ":docker: building image",
 				Command: "docker build .",
+				Agents:  NewAgents(map[string]string{"queue": "default"}),
 				RemainingFields: map[string]any{
-					"agents": ordered.MapFromItems(
-						ordered.TupleSA{Key: "queue", Value: "default"},
-					),
 					"type":              "script",
 					"agent_query_rules": []any{"queue=default"},
 				},
@@ -309,10 +316,10 @@ steps:
 	wantYAML := `steps:
     - label: ':docker: building image'
       command: docker build .
-      agent_query_rules:
-        - queue=default
       agents:
         queue: default
+      agent_query_rules:
+        - queue=default
       type: script
 base_step:
     type: script
@@ -469,10 +476,8 @@ steps:
 			&CommandStep{
 				Label:   ":docker: building image",
 				Command: "docker build .",
+				Agents:  NewAgents(map[string]string{"queue": "default"}),
 				RemainingFields: map[string]any{
-					"agents": ordered.MapFromItems(
-						ordered.TupleSA{Key: "queue", Value: "default"},
-					),
 					"type":              "script",
 					"agent_query_rules": []any{"queue=default"},
 				},
@@ -566,16 +571,16 @@ steps:
 	want := &Pipeline{
 		Steps: Steps{
 			&InputStep{
-				Contents: map[string]any{
-					"key":   "hello there",
-					"label": "🤖",
-					"type":  "block",
+				Key:   "hello there",
+				Label: "🤖",
+				RemainingFields: map[string]any{
+					"type": "block",
 				},
 			},
 			&WaitStep{
-				Contents: map[string]any{
-					"continue_on_failure": true,
-					"type":                "wait",
+				ContinueOnFailure: true,
+				RemainingFields: map[string]any{
+					"type": "wait",
 				},
 			},
 		},
@@ -678,11 +683,12 @@ steps:
 				Steps: Steps{
 					&CommandStep{Command: "hello friend"},
 					&WaitStep{Scalar: "wait"},
-					&InputStep{Contents: map[string]any{"block": "goodbye"}},
+					&InputStep{RemainingFields: map[string]any{"block": "goodbye"}},
 				},
 			},
 			&GroupStep{
-				Steps: Steps{},
+				Steps:     Steps{},
+				stepsForm: GroupStepsNull,
 			},
 			&GroupStep{
 				Key:   "group-friend",
@@ -997,6 +1003,9 @@ steps:
   - command: echo hello
     env:
         GREETING: {"YOURE_A_WINNER":"BONUS_JSON"}
+  - command: echo goodbye
+    env:
+        GREETING: ["YOURE_A_WINNER", "BONUS_JSON"]
 `)
 	got, err := Parse(input)
 	if !warning.Is(err) {
@@ -1008,6 +1017,7 @@ steps:
 		ErrUnknownStepType,
 		ErrStepTypeInference,
 		ErrUnknownStepType,
+		ordered.ErrMappingIntoString,
 		ordered.ErrIncompatibleTypes,
 	}
 	errorComparer := cmp.Comparer(func(x, y error) bool {
@@ -1033,13 +1043,17 @@ steps:
 					ordered.TupleSA{Key: "type", Value: "mystery"},
 				),
 			},
+			// The mapping is kept as the text that was written, since it
+			// is probably a string that wasn't quoted.
+			&CommandStep{
+				Command: "echo hello",
+				Env:     map[string]string{"GREETING": `{"YOURE_A_WINNER":"BONUS_JSON"}`},
+			},
 			&UnknownStep{
 				Contents: ordered.MapFromItems(
-					ordered.TupleSA{Key: "command", Value: "echo hello"},
+					ordered.TupleSA{Key: "command", Value: "echo goodbye"},
 					ordered.TupleSA{Key: "env", Value: ordered.MapFromItems(
-						ordered.TupleSA{Key: "GREETING", Value: ordered.MapFromItems(
-							ordered.TupleSA{Key: "YOURE_A_WINNER", Value: "BONUS_JSON"},
-						)},
+						ordered.TupleSA{Key: "GREETING", Value: []any{"YOURE_A_WINNER", "BONUS_JSON"}},
 					)},
 				),
 			},
@@ -1066,9 +1080,16 @@ steps:
     {
       "command": "echo hello",
       "env": {
-        "GREETING": {
-          "YOURE_A_WINNER": "BONUS_JSON"
-        }
+        "GREETING": "{\"YOURE_A_WINNER\":\"BONUS_JSON\"}"
+      }
+    },
+    {
+      "command": "echo goodbye",
+      "env": {
+        "GREETING": [
+          "YOURE_A_WINNER",
+          "BONUS_JSON"
+        ]
       }
     }
   ]
@@ -1087,15 +1108,68 @@ steps:
     - llama: Kuzco
     - type: mystery
     - command: echo hello
+      env:
+        GREETING: '{"YOURE_A_WINNER":"BONUS_JSON"}'
+    - command: echo goodbye
       env:
         GREETING:
-            YOURE_A_WINNER: BONUS_JSON
+            - YOURE_A_WINNER
+            - BONUS_JSON
 `
 	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
 		t.Errorf("marshalled YAML diff (-got +want):\n%s", diff)
 	}
 }
 
+func TestParserRemarshalsMapsIntoStrings(t *testing.T) {
+	t.Parallel()
+
+	input := strings.NewReader(`---
+steps:
+  - label: {fast,  quiet}
+    command: echo hello
+    env:
+      GREETING: {"YOURE_A_WINNER":"BONUS_JSON", "nested": [1, {two: 2}]}
+    matrix: [{a:  "b"}, c]
+    retry:
+      manual:
+        reason: {why:  "flaky"}
+  - wait: ~
+    if: {build.branch == "main"}
+`)
+	got, err := Parse(input)
+	if !warning.Is(err) || !errors.Is(err, ordered.ErrMappingIntoString) {
+		t.Fatalf("Parse(input) error = %v, want a warning wrapping %v", err, ordered.ErrMappingIntoString)
+	}
+	if got := strings.Count(err.Error(), ordered.ErrMappingIntoString.Error()); got != 5 {
+		t.Errorf("Parse(input) error = %v, mentions %q %d times, want 5", err, ordered.ErrMappingIntoString, got)
+	}
+
+	// The strings are the text that was written.
+	want := &Pipeline{
+		Steps: Steps{
+			&CommandStep{
+				Label:   "{fast,  quiet}",
+				Command: "echo hello",
+				Env: map[string]string{
+					"GREETING": `{"YOURE_A_WINNER":"BONUS_JSON", "nested": [1, {two: 2}]}`,
+				},
+				Matrix: &Matrix{Setup: MatrixSetup{"": {`{a:  "b"}`, "c"}}},
+				Retry: &Retry{
+					Manual: &ManualRetry{Reason: `{why:  "flaky"}`},
+				},
+			},
+			&WaitStep{
+				If:              `{build.branch == "main"}`,
+				RemainingFields: map[string]any{"wait": nil},
+			},
+		},
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
 func TestParserEmitsWarningWithTopLevelStepSequence(t *testing.T) {
 	input := strings.NewReader(`---
   - catawumpus
@@ -1205,10 +1279,8 @@ func TestParserPreservesBools(t *testing.T) {
 	want := &Pipeline{
 		Steps: Steps{
 			&TriggerStep{
-				Contents: map[string]any{
-					"trigger": "hello",
-					"async":   true,
-				},
+				Trigger: "hello",
+				Async:   true,
 			},
 		},
 	}
@@ -1238,8 +1310,8 @@ func TestParserPreservesBools(t *testing.T) {
 	}
 
 	wantYAML := `steps:
-    - async: true
-      trigger: hello
+    - trigger: hello
+      async: true
 `
 	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
 		t.Errorf("marshalled YAML diff (-got +want):\n%s", diff)
@@ -1256,10 +1328,8 @@ func TestParserPreservesInts(t *testing.T) {
 	want := &Pipeline{
 		Steps: Steps{
 			&CommandStep{
-				Command: "hello",
-				RemainingFields: map[string]any{
-					"parallelism": 10,
-				},
+				Command:     "hello",
+				Parallelism: NewInt(10),
 			},
 		},
 	}
@@ -1306,7 +1376,7 @@ func TestParserPreservesNull(t *testing.T) {
 
 	want := &Pipeline{
 		Steps: Steps{
-			&WaitStep{Contents: map[string]any{"wait": nil, "if": "foo"}},
+			&WaitStep{If: "foo", RemainingFields: map[string]any{"wait": nil}},
 		},
 	}
 	if diff := diffPipeline(got, want); diff != "" {
@@ -1353,9 +1423,9 @@ func TestParserPreservesFloats(t *testing.T) {
 	want := &Pipeline{
 		Steps: Steps{
 			&TriggerStep{
-				Contents: map[string]any{
-					"trigger": "hello",
-					"llamas":  3.142,
+				Trigger: "hello",
+				RemainingFields: map[string]any{
+					"llamas": 3.142,
 				},
 			},
 		},
@@ -1386,8 +1456,8 @@ func TestParserPreservesFloats(t *testing.T) {
 	}
 
 	wantYAML := `steps:
-    - llamas: 3.142
-      trigger: hello
+    - trigger: hello
+      llamas: 3.142
 `
 	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
 		t.Errorf("marshalled YAML diff (-got +want):\n%s", diff)
@@ -1487,9 +1557,9 @@ func TestParserHandlesDates(t *testing.T) {
 	want := &Pipeline{
 		Steps: Steps{
 			&TriggerStep{
-				Contents: map[string]any{
-					"trigger": "hello",
-					"llamas":  llamatime,
+				Trigger: "hello",
+				RemainingFields: map[string]any{
+					"llamas": llamatime,
 				},
 			},
 		},
@@ -1520,8 +1590,8 @@ func TestParserHandlesDates(t *testing.T) {
 	}
 
 	wantYAML := `steps:
-    - llamas: 2002-08-15T17:18:23.18-06:00
-      trigger: hello
+    - trigger: hello
+      llamas: 2002-08-15T17:18:23.18-06:00
 `
 	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
 		t.Errorf("marshalled YAML diff (-got +want):\n%s", diff)
@@ -1702,11 +1772,7 @@ steps:
 						},
 					},
 				},
-				RemainingFields: map[string]any{
-					"agents": ordered.MapFromItems(
-						ordered.TupleSA{Key: "queue", Value: "xxx"},
-					),
-				},
+				Agents: NewAgents(map[string]string{"queue": "xxx"}),
 			},
 		},
 	}
@@ -1909,9 +1975,9 @@ steps:
 	want := &Pipeline{
 		Steps: Steps{
 			&WaitStep{
-				Contents: map[string]any{
+				If: "build.env(\"ACCOUNT\") =~ /^(foo|bar)$/",
+				RemainingFields: map[string]any{
 					"wait": nil,
-					"if":   "build.env(\"ACCOUNT\") =~ /^(foo|bar)$/",
 				},
 			},
 		},
@@ -2156,3 +2222,124 @@ steps:
 		})
 	}
 }
+
+func TestParseWithWarnings(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		input     string
+		opts      []ParseOption
+		wantSteps Steps
+		wantWarns []error
+	}{
+		{
+			desc:      "no warnings",
+			input:     "steps:\n  - wait\n",
+			wantSteps: Steps{&WaitStep{Scalar: "wait"}},
+		},
+		{
+			desc:      "unknown step type",
+			input:     "steps:\n  - catawumpus\n",
+			wantSteps: Steps{&UnknownStep{Contents: "catawumpus"}},
+			wantWarns: []error{ErrUnknownStepType},
+		},
+		{
+			desc:      "jobs alias and unknown step type",
+			input:     "jobs:\n  - catawumpus\n",
+			opts:      []ParseOption{WithJobsAlias()},
+			wantSteps: Steps{&UnknownStep{Contents: "catawumpus"}},
+			wantWarns: []error{
+				errors.New(`"jobs" is not a pipeline field; treating it as "steps" at line 1, column 1`),
+				ErrUnknownStepType,
+			},
+		},
+	}
+
+	errorComparer := cmp.Comparer(func(x, y error) bool {
+		return errors.Is(x, y) || errors.Is(y, x) || x.Error() == y.Error()
+	})
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, warns, err := ParseWithWarnings(strings.NewReader(test.input), test.opts...)
+			if err != nil {
+				t.Fatalf("ParseWithWarnings(%q) error = %v", test.input, err)
+			}
+			if diff := cmp.Diff(warns, test.wantWarns, errorComparer); diff != "" {
+				t.Errorf("ParseWithWarnings(%q) warnings diff (-got +want):\n%s", test.input, diff)
+			}
+			if diff := diffPipeline(got, &Pipeline{Steps: test.wantSteps}); diff != "" {
+				t.Errorf("ParseWithWarnings(%q) pipeline diff (-got +want):\n%s", test.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseWithWarnings_Error(t *testing.T) {
+	t.Parallel()
+
+	got, warns, err := ParseWithWarnings(strings.NewReader("steps: [\n"))
+	if err == nil || warning.Is(err) {
+		t.Fatalf("ParseWithWarnings(invalid YAML) error = %v, want a non-warning error", err)
+	}
+	if got != nil || warns != nil {
+		t.Errorf("ParseWithWarnings(invalid YAML) = %v, %v, want nil pipeline and warnings", got, warns)
+	}
+}
+
+// TestPipelineConcurrentReads checks that a parsed pipeline can be read by
+// multiple goroutines at once. It is most useful under the race detector
+// (go test -race).
+func TestPipelineConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+env:
+  TOKEN: xyz
+steps:
+  - command: echo hello
+    agents:
+      queue: fast
+    plugins:
+      - docker#v5.0.0:
+          image: alpine
+    matrix: [a, b]
+  - wait
+  - group: group
+    steps:
+      - trigger: other
+        build:
+          env:
+            FOO: bar
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := json.Marshal(p); err != nil {
+				t.Errorf("json.Marshal(p) error = %v", err)
+			}
+			if _, err := yaml.Marshal(p); err != nil {
+				t.Errorf("yaml.Marshal(p) error = %v", err)
+			}
+			if err := p.Validate(); err != nil {
+				t.Errorf("p.Validate() = %v", err)
+			}
+			if _, err := p.Redacted([]string{"TOKEN"}); err != nil {
+				t.Errorf("p.Redacted([TOKEN]) error = %v", err)
+			}
+			p.UnknownFields()
+			p.StepsByQueue()
+			p.MemoryFootprint()
+		}()
+	}
+	wg.Wait()
+}
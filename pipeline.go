@@ -1,35 +1,57 @@
 package pipeline
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/buildkite/go-pipeline/internal/env"
 	"github.com/buildkite/go-pipeline/ordered"
 	"github.com/buildkite/go-pipeline/warning"
-	"github.com/buildkite/interpolate"
 )
 
 // Pipeline models a pipeline.
 //
 // Standard caveats apply - see the package comment.
 type Pipeline struct {
-	Steps Steps          `yaml:"steps"`
-	Env   *ordered.MapSS `yaml:"env,omitempty"`
+	Steps  Steps          `yaml:"steps"`
+	Env    *ordered.MapSS `yaml:"env,omitempty"`
+	Notify Notify         `yaml:"notify,omitempty"`
 
 	// RemainingFields stores any other top-level mapping items so they at least
 	// survive an unmarshal-marshal round-trip.
 	RemainingFields map[string]any `yaml:",inline"`
 }
 
+// streamJSONSteps is the number of steps above which Pipeline.MarshalJSON
+// writes the steps one at a time with ordered.Encoder, rather than having
+// json.Marshal build (and then copy) the JSON for all of them at once.
+const streamJSONSteps = 256
+
 // MarshalJSON marshals a pipeline to JSON. Special handling is needed because
 // yaml.v3 has "inline" but encoding/json has no concept of it.
 func (p *Pipeline) MarshalJSON() ([]byte, error) {
-	return inlineFriendlyMarshalJSON(p)
+	if len(p.Steps) <= streamJSONSteps {
+		return inlineFriendlyMarshalJSON(p)
+	}
+	fields, err := inlineFriendlyFields(p)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := ordered.NewEncoder(&b).Encode(fields); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
 }
 
 // UnmarshalOrdered unmarshals the pipeline from either []any (a legacy
 // sequence of steps) or *ordered.MapSA (a modern pipeline configuration).
 func (p *Pipeline) UnmarshalOrdered(o any) error {
+	return p.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (p *Pipeline) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
 	var warns []error
 
 	switch o := o.(type) {
@@ -38,7 +60,7 @@ func (p *Pipeline) UnmarshalOrdered(o any) error {
 		// Wrap in a secret type to avoid infinite recursion between this method
 		// and ordered.Unmarshal.
 		type wrappedPipeline Pipeline
-		err := ordered.Unmarshal(o, (*wrappedPipeline)(p))
+		err := ordered.Unmarshal(o, (*wrappedPipeline)(p), opts...)
 		if w := warning.As(err); w != nil {
 			warns = append(warns, w)
 		} else if err != nil {
@@ -47,7 +69,7 @@ func (p *Pipeline) UnmarshalOrdered(o any) error {
 
 	case []any:
 		// A pipeline can be a sequence of steps.
-		err := ordered.Unmarshal(o, &p.Steps)
+		err := ordered.Unmarshal(o, &p.Steps, opts...)
 		if w := warning.As(err); w != nil {
 			warns = append(warns, w)
 		} else if err != nil {
@@ -84,43 +106,151 @@ type InterpolationEnv interface {
 // we will substitute with the pipeline env IF the pipeline env is defined first.
 // Setting the preferRuntimeEnv option to true instead prefers the runtime environment to pipeline
 // environment variables when both are defined.
-func (p *Pipeline) Interpolate(interpolationEnv InterpolationEnv, preferRuntimeEnv bool) error {
+//
+// Env var keys are interpolated like values, unless DisallowEnvKeyInterpolation
+// is passed. Step fields selected with SkipInterpolation are left alone. If
+// InterpolateStrict is passed, referencing an unset variable is an error.
+// RecordSubstitutions reports the variables that were substituted, and
+// WithValueRedactor reports the values of secret ones. If
+// InterpolationErrorsAsWarnings is passed, strings that fail to interpolate
+// are left alone and the problems are returned as a warning.
+func (p *Pipeline) Interpolate(interpolationEnv InterpolationEnv, preferRuntimeEnv bool, opts ...InterpolateOption) error {
 	if interpolationEnv == nil {
 		interpolationEnv = env.New()
 	}
 
+	var cfg interpolateConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	tf := envInterpolator{
+		env:       interpolationEnv,
+		noEnvKeys: cfg.disallowEnvKeyInterpolation,
+		strict:    cfg.strict,
+	}
+	if cfg.report != nil {
+		tf.subs = &substitutionRecorder{report: cfg.report}
+	}
+	if cfg.secrets != nil {
+		if err := cfg.checkSecretNames(); err != nil {
+			return err
+		}
+		tf.secrets = &secretRecorder{
+			names:  cfg.secretNames,
+			values: cfg.secrets,
+			seen:   make(map[string]bool),
+		}
+	}
+	if !cfg.errorsAsWarnings {
+		return p.interpolate(&cfg, tf, interpolationEnv, preferRuntimeEnv, func(err error, stepIndex int, within any, _ string) error {
+			if err != nil {
+				locateInterpolationError(err, stepIndex, within)
+			}
+			return err
+		})
+	}
+
+	// Collect problems as they occur, and group them by where they happened.
+	var collected, warns []error
+	tf.warns = &collected
+	err := p.interpolate(&cfg, tf, interpolationEnv, preferRuntimeEnv, func(err error, stepIndex int, within any, part string) error {
+		if err != nil {
+			return err
+		}
+		if len(collected) > 0 {
+			for _, err := range collected {
+				locateInterpolationError(err, stepIndex, within)
+			}
+			warns = append(warns, warning.New("while interpolating "+part, collected...))
+			collected = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return warning.Wrap(warns...)
+}
+
+// InterpolateWithPipelineEnvOnly interpolates the pipeline using only the
+// variables defined in the pipeline's own env block. The process environment
+// (or any other runtime environment) is never consulted, so host variables
+// cannot leak into the pipeline. Variable names are case-sensitive on every
+// platform.
+func (p *Pipeline) InterpolateWithPipelineEnvOnly(opts ...InterpolateOption) error {
+	return p.Interpolate(env.New(env.CaseSensitive(true)), false, opts...)
+}
+
+// interpolationHandler is called after each part of the pipeline is
+// interpolated, with the error interpolating it (if any), where the part is
+// (see InterpolationError), and a description of it. Interpolation stops if it
+// returns an error.
+type interpolationHandler func(err error, stepIndex int, within any, part string) error
+
+// interpolate is the implementation of Interpolate. handle decides what
+// becomes of errors.
+func (p *Pipeline) interpolate(cfg *interpolateConfig, tf envInterpolator, interpolationEnv InterpolationEnv, preferRuntimeEnv bool, handle interpolationHandler) error {
 	// Preprocess any env that are defined in the top level block and place them
 	// into env for later interpolation into the rest of the pipeline.
-	if err := p.interpolateEnvBlock(interpolationEnv, preferRuntimeEnv); err != nil {
+	err := p.interpolateEnvBlock(tf, interpolationEnv, preferRuntimeEnv)
+	if err = handle(err, -1, p.envWithin(), "env"); err != nil {
 		return err
 	}
-
-	tf := envInterpolator{env: interpolationEnv}
+	tf.subs.flush("", p.envWithin())
 
 	// Recursively go through the rest of the pipeline and perform environment
 	// variable interpolation on strings. Interpolation is performed in-place.
-	if err := interpolateSlice(tf, p.Steps); err != nil {
+	for i, s := range p.Steps {
+		s, err := cfg.interpolateStep(tf, s)
+		if err = handle(err, i, s, fmt.Sprintf("step %d", i)); err != nil {
+			return err
+		}
+		p.Steps[i] = s
+		tf.subs.flush(fmt.Sprintf("steps[%d]", i), s)
+	}
+
+	err = p.Notify.interpolate(tf)
+	if err = handle(err, -1, p.notifyWithin(), "notify"); err != nil {
+		return err
+	}
+	tf.subs.flush("", p.notifyWithin())
+
+	err = interpolateMap(tf, p.RemainingFields)
+	if err = handle(err, -1, p.RemainingFields, "other fields"); err != nil {
 		return err
 	}
+	tf.subs.flush("", p.RemainingFields)
+	return nil
+}
 
-	return interpolateMap(tf, p.RemainingFields)
+// envWithin returns the pipeline env block within a map, for locating
+// interpolation errors in it.
+func (p *Pipeline) envWithin() map[string]any {
+	return map[string]any{"env": p.Env}
 }
 
-// interpolateEnvBlock runs interpolate.Interpolate on each pair in p.Env,
-// interpolating with the variables defined in interpolationEnv, and then adding the
-// results back into p.Env. Since each environment variable in p.Env can
-// be interpolated into later environment variables, we also add the results
-// to interpolationEnv, making the input ordering of p.Env potentially important.
-func (p *Pipeline) interpolateEnvBlock(interpolationEnv InterpolationEnv, preferRuntimeEnv bool) error {
-	return p.Env.Range(func(k, v string) error {
+// notifyWithin returns the pipeline notify block within a map, for locating
+// interpolation errors in it.
+func (p *Pipeline) notifyWithin() map[string]any {
+	return map[string]any{"notify": p.Notify}
+}
+
+// interpolateEnvBlock interpolates each pair in p.Env with tf (which uses the
+// variables defined in interpolationEnv), and then adds the results back into p.Env.
+// Since each environment variable in p.Env can be interpolated into later
+// environment variables, we also add the results to interpolationEnv,
+// making the input ordering of p.Env potentially important.
+func (p *Pipeline) interpolateEnvBlock(tf envInterpolator, interpolationEnv InterpolationEnv, preferRuntimeEnv bool) error {
+	for k, v := range p.Env.All() {
 		// We interpolate both keys and values.
-		intk, err := interpolate.Interpolate(interpolationEnv, k)
+		intk, err := tf.transformEnvKey(k)
 		if err != nil {
 			return err
 		}
 
 		// v is always a string in this case.
-		intv, err := interpolate.Interpolate(interpolationEnv, v)
+		intv, err := tf.Transform(v)
 		if err != nil {
 			return err
 		}
@@ -131,7 +261,6 @@ func (p *Pipeline) interpolateEnvBlock(interpolationEnv InterpolationEnv, prefer
 		if _, exists := interpolationEnv.Get(intk); !(preferRuntimeEnv && exists) {
 			interpolationEnv.Set(intk, intv)
 		}
-
-		return nil
-	})
+	}
+	return nil
 }
@@ -0,0 +1,310 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+// This file implements a compact binary encoding of parsed pipelines, for
+// services that cache them. Decoding it skips YAML parsing entirely: the
+// encoding holds the generic form of the pipeline (the *ordered.MapSA, []any,
+// and scalars that Parse produces from YAML), which is unmarshaled directly.
+
+// binaryMagic and binaryVersion begin every encoded pipeline. The version is
+// incremented whenever the encoding changes incompatibly.
+const (
+	binaryMagic   = "BKPL"
+	binaryVersion = 1
+)
+
+// ErrBinaryVersion is returned (wrapped) by Decode when the data was encoded
+// by an incompatible version of the library. Callers caching encoded
+// pipelines should treat it as a cache miss.
+var ErrBinaryVersion = errors.New("unsupported binary pipeline version")
+
+// ErrNestingTooDeep is returned (wrapped) when decoding data that nests
+// sequences and mappings more than maxNestingDepth deep.
+var ErrNestingTooDeep = errors.New("nesting too deep")
+
+// maxNestingDepth limits how deeply sequences and mappings can be nested in
+// encoded data, as yaml.v3 does for YAML, so that decoding malicious data
+// returns an error rather than overflowing the stack.
+const maxNestingDepth = 10000
+
+// Tags for each kind of value in the encoding.
+const (
+	binNil byte = iota
+	binFalse
+	binTrue
+	binInt
+	binUint
+	binFloat
+	binString
+	binSeq
+	binMap
+)
+
+// Encode writes a compact binary encoding of the pipeline to w, which Decode
+// can read. The pipeline is normalised the same way as marshaling it to YAML
+// and parsing it again.
+func Encode(w io.Writer, p *Pipeline) error {
+	v, err := toGeneric(p)
+	if err != nil {
+		return fmt.Errorf("encoding pipeline: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(binaryMagic)
+	bw.WriteByte(binaryVersion)
+	if err := encodeBinaryValue(bw, v); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Decode reads a pipeline written by Encode. Like Parse, it does not apply
+// interpolation, and warnings are passed through the err return.
+func Decode(r io.Reader) (*Pipeline, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(binaryMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if string(header[:len(binaryMagic)]) != binaryMagic {
+		return nil, errors.New("not a binary pipeline")
+	}
+	if v := header[len(binaryMagic)]; v != binaryVersion {
+		return nil, fmt.Errorf("%w %d, want %d", ErrBinaryVersion, v, binaryVersion)
+	}
+
+	v, err := decodeBinaryValue(br, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Pipeline)
+	err = ordered.Unmarshal(v, p)
+	if err != nil && !warning.Is(err) {
+		return nil, err
+	}
+	return p, err
+}
+
+// toGeneric converts a pipeline or step into the generic form that Parse
+// produces from YAML (*ordered.MapSA, []any, and scalars).
+func toGeneric(x any) (any, error) {
+	n := new(yaml.Node)
+	if err := n.Encode(x); err != nil {
+		return nil, err
+	}
+	return ordered.DecodeYAML(n)
+}
+
+// fromGeneric unmarshals the generic form v into dst, which is a pipeline or
+// step. Steps written as a scalar (such as "wait") are handled too.
+func fromGeneric(v any, dst any) error {
+	s, ok := v.(string)
+	if !ok {
+		return ordered.Unmarshal(v, dst)
+	}
+	step, err := NewScalarStep(s)
+	if err != nil {
+		return err
+	}
+	switch dst := dst.(type) {
+	case *WaitStep:
+		if w, ok := step.(*WaitStep); ok {
+			*dst = *w
+			return nil
+		}
+
+	case *InputStep:
+		if in, ok := step.(*InputStep); ok {
+			*dst = *in
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot unmarshal %q into %T", s, dst)
+}
+
+func encodeBinaryValue(w *bufio.Writer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		return w.WriteByte(binNil)
+
+	case bool:
+		if v {
+			return w.WriteByte(binTrue)
+		}
+		return w.WriteByte(binFalse)
+
+	case int:
+		w.WriteByte(binInt)
+		_, err := w.Write(binary.AppendVarint(nil, int64(v)))
+		return err
+
+	case uint64:
+		w.WriteByte(binUint)
+		_, err := w.Write(binary.AppendUvarint(nil, v))
+		return err
+
+	case float64:
+		w.WriteByte(binFloat)
+		_, err := w.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+		return err
+
+	case string:
+		w.WriteByte(binString)
+		return writeBinaryString(w, v)
+
+	case []any:
+		w.WriteByte(binSeq)
+		w.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		for _, e := range v {
+			if err := encodeBinaryValue(w, e); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ordered.MapSA:
+		w.WriteByte(binMap)
+		w.Write(binary.AppendUvarint(nil, uint64(v.Len())))
+		for k, e := range v.All() {
+			if err := writeBinaryString(w, k); err != nil {
+				return err
+			}
+			if err := encodeBinaryValue(w, e); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("encoding pipeline: unsupported type %T", v)
+	}
+}
+
+func writeBinaryString(w *bufio.Writer, s string) error {
+	w.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	_, err := w.WriteString(s)
+	return err
+}
+
+func decodeBinaryValue(r *bufio.Reader, depth int) (any, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("decoding pipeline: %w", err)
+	}
+	if (tag == binSeq || tag == binMap) && depth >= maxNestingDepth {
+		return nil, fmt.Errorf("decoding pipeline: %w", ErrNestingTooDeep)
+	}
+	switch tag {
+	case binNil:
+		return nil, nil
+
+	case binFalse:
+		return false, nil
+
+	case binTrue:
+		return true, nil
+
+	case binInt:
+		i, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("decoding pipeline: %w", err)
+		}
+		return int(i), nil
+
+	case binUint:
+		u, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("decoding pipeline: %w", err)
+		}
+		return u, nil
+
+	case binFloat:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, fmt.Errorf("decoding pipeline: %w", err)
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), nil
+
+	case binString:
+		return readBinaryString(r)
+
+	case binSeq:
+		n, err := readBinaryLen(r)
+		if err != nil {
+			return nil, err
+		}
+		s := make([]any, 0, min(n, maxBinaryPrealloc))
+		for i := 0; i < n; i++ {
+			e, err := decodeBinaryValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, e)
+		}
+		return s, nil
+
+	case binMap:
+		n, err := readBinaryLen(r)
+		if err != nil {
+			return nil, err
+		}
+		m := ordered.NewMap[string, any](min(n, maxBinaryPrealloc))
+		for i := 0; i < n; i++ {
+			k, err := readBinaryString(r)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeBinaryValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(k, e)
+		}
+		return m, nil
+
+	default:
+		return nil, fmt.Errorf("decoding pipeline: unknown tag %d", tag)
+	}
+}
+
+// maxBinaryPrealloc limits how much is allocated up front based on lengths
+// read from the data, so that corrupt data can't cause huge allocations.
+const maxBinaryPrealloc = 1024
+
+func readBinaryLen(r *bufio.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, fmt.Errorf("decoding pipeline: %w", err)
+	}
+	if n > math.MaxInt32 {
+		return 0, fmt.Errorf("decoding pipeline: implausible length %d", n)
+	}
+	return int(n), nil
+}
+
+func readBinaryString(r *bufio.Reader) (string, error) {
+	n, err := readBinaryLen(r)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.Grow(min(n, maxBinaryPrealloc))
+	if _, err := io.CopyN(&sb, r, int64(n)); err != nil {
+		return "", fmt.Errorf("decoding pipeline: %w", err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const binaryTestPipeline = `---
+env:
+  ZEBRA: stripes
+  ANIMAL: llama
+agents:
+  queue: default
+steps:
+  - label: ":docker: Build"
+    key: build
+    commands:
+      - make
+      - make install
+    plugins:
+      # Encode normalises plugin sources, so use the full form here.
+      - github.com/buildkite-plugins/docker-buildkite-plugin#v1.2.3:
+          image: alpine
+          ratio: 0.5
+    retry:
+      automatic:
+        limit: 2
+    matrix:
+      setup:
+        os: [linux, windows]
+  - wait: ~
+    continue_on_failure: true
+  - group: Tests
+    steps:
+      - command: make test
+        soft_fail: true
+  - block: Deploy?
+    fields:
+      - text: Reason
+        key: reason
+  - trigger: deploy
+    build:
+      message: Deploying
+`
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	want, err := Parse(strings.NewReader(binaryTestPipeline))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, want); err != nil {
+		t.Fatalf("Encode(&buf, want) error = %v", err)
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode(&buf) error = %v", err)
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("decoded pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestDecodeBadInput(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, &Pipeline{Steps: Steps{&CommandStep{Command: "make"}}}); err != nil {
+		t.Fatalf("Encode(&buf, p) error = %v", err)
+	}
+	data := buf.Bytes()
+
+	wrongVersion := bytes.Clone(data)
+	wrongVersion[len(binaryMagic)]++
+	if _, err := Decode(bytes.NewReader(wrongVersion)); !errors.Is(err, ErrBinaryVersion) {
+		t.Errorf("Decode(wrongVersion) error = %v, want %v", err, ErrBinaryVersion)
+	}
+
+	if _, err := Decode(strings.NewReader("steps: []")); err == nil {
+		t.Errorf("Decode(yaml) error = nil, want an error")
+	}
+
+	if _, err := Decode(bytes.NewReader(data[:len(data)-2])); err == nil {
+		t.Errorf("Decode(truncated) error = nil, want an error")
+	}
+
+	// Sequences of one sequence, nested far too deeply.
+	deep := []byte(binaryMagic + string(rune(binaryVersion)))
+	for range 1_000_000 {
+		deep = append(deep, binSeq, 1)
+	}
+	if _, err := Decode(bytes.NewReader(deep)); !errors.Is(err, ErrNestingTooDeep) {
+		t.Errorf("Decode(deep) error = %v, want %v", err, ErrNestingTooDeep)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(strings.NewReader(binaryTestPipeline)); err != nil {
+			b.Fatalf("Parse(input) error = %v", err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	p, err := Parse(strings.NewReader(binaryTestPipeline))
+	if err != nil {
+		b.Fatalf("Parse(input) error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, p); err != nil {
+		b.Fatalf("Encode(&buf, p) error = %v", err)
+	}
+	data := buf.Bytes()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(bytes.NewReader(data)); err != nil {
+			b.Fatalf("Decode(data) error = %v", err)
+		}
+	}
+}
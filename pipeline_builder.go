@@ -0,0 +1,107 @@
+package pipeline
+
+import "github.com/buildkite/go-pipeline/ordered"
+
+// Builder builds a pipeline in Go, for tools that generate pipelines rather
+// than parse them. Each method adds to the pipeline and returns the builder,
+// so calls can be chained:
+//
+//	p, err := pipeline.New().
+//		SetEnv("GO_VERSION", "1.23").
+//		AddCommandStep(&pipeline.CommandStep{Key: "test", Command: "go test ./..."}).
+//		AddWaitStep().
+//		AddGroup("Deploy",
+//			&pipeline.CommandStep{Label: "Staging", Command: "deploy staging"},
+//			&pipeline.CommandStep{Label: "Production", Command: "deploy prod"},
+//		).
+//		Build()
+//
+// Steps are added as they are given (not copied), and are checked by Build.
+type Builder struct {
+	p *Pipeline
+}
+
+// New returns a Builder for an empty pipeline.
+func New() *Builder {
+	return &Builder{p: &Pipeline{Steps: Steps{}}}
+}
+
+// SetEnv sets a pipeline-level environment variable. Variables are kept in
+// the order they are first set.
+func (b *Builder) SetEnv(name, value string) *Builder {
+	if b.p.Env == nil {
+		b.p.Env = ordered.NewMap[string, string](1)
+	}
+	b.p.Env.Set(name, value)
+	return b
+}
+
+// AddNotification adds a pipeline-level notification.
+func (b *Builder) AddNotification(n *Notification) *Builder {
+	b.p.Notify = append(b.p.Notify, n)
+	return b
+}
+
+// AddStep adds a step of any type.
+func (b *Builder) AddStep(s Step) *Builder {
+	b.p.Steps = append(b.p.Steps, s)
+	return b
+}
+
+// AddCommandStep adds a command step.
+func (b *Builder) AddCommandStep(s *CommandStep) *Builder {
+	if s == nil {
+		// Don't hide the nil in a non-nil Step.
+		return b.AddStep(nil)
+	}
+	return b.AddStep(s)
+}
+
+// AddTriggerStep adds a trigger step.
+func (b *Builder) AddTriggerStep(s *TriggerStep) *Builder {
+	if s == nil {
+		// Don't hide the nil in a non-nil Step.
+		return b.AddStep(nil)
+	}
+	return b.AddStep(s)
+}
+
+// AddWaitStep adds a wait step, written as "wait".
+func (b *Builder) AddWaitStep() *Builder {
+	return b.AddStep(&WaitStep{Scalar: "wait"})
+}
+
+// AddBlockStep adds a block step with the label, written as "block: label".
+// To set other fields, use AddStep with an InputStep (see InputStep.SetKind).
+func (b *Builder) AddBlockStep(label string) *Builder {
+	return b.AddStep(&InputStep{RemainingFields: map[string]any{"block": label}})
+}
+
+// AddGroup adds a group step with the label (or no label, if it is empty)
+// containing the steps. To set other fields, use AddStep with a GroupStep.
+func (b *Builder) AddGroup(label string, steps ...Step) *Builder {
+	g := &GroupStep{Steps: append(Steps{}, steps...)}
+	if label != "" {
+		g.SetLabel(label)
+	}
+	return b.AddStep(g)
+}
+
+// Build checks the pipeline (see Validate) and returns it. Group steps added
+// with a nil Steps are given an empty one, since a group must always have a
+// list of steps. If the pipeline has problems, the error is a
+// ValidationErrors and the pipeline is nil. If it only has warnings, both the
+// pipeline and a warning (see the warning package) are returned.
+// The builder should not be used after calling Build.
+func (b *Builder) Build() (*Pipeline, error) {
+	for _, s := range b.p.Steps {
+		if g, ok := s.(*GroupStep); ok && g != nil && g.Steps == nil {
+			g.Steps = Steps{}
+		}
+	}
+	err := b.p.Validate()
+	if _, ok := err.(ValidationErrors); ok {
+		return nil, err
+	}
+	return b.p, err
+}
@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	p, err := New().
+		SetEnv("GO_VERSION", "1.23").
+		SetEnv("CGO_ENABLED", "0").
+		AddCommandStep(&CommandStep{Key: "test", Command: "go test ./..."}).
+		AddWaitStep().
+		AddBlockStep("Deploy?").
+		AddGroup("Deploy",
+			&CommandStep{Label: "Staging", Command: "deploy staging"},
+			&TriggerStep{Trigger: "deploy-prod"},
+		).
+		AddNotification(&Notification{Email: "dev@example.com"}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	got, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p) error = %v", err)
+	}
+	want := `steps:
+    - key: test
+      command: go test ./...
+    - wait
+    - block: Deploy?
+    - group: Deploy
+      steps:
+        - label: Staging
+          command: deploy staging
+        - trigger: deploy-prod
+env:
+    GO_VERSION: "1.23"
+    CGO_ENABLED: "0"
+notify:
+    - email: dev@example.com
+`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("yaml.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestBuilderNilGroupSteps(t *testing.T) {
+	t.Parallel()
+
+	g := &GroupStep{Key: "empty"}
+	_, err := New().AddStep(g).Build()
+	if !errors.Is(err, ErrEmptyGroup) {
+		t.Errorf("Build() error = %v, want %v", err, ErrEmptyGroup)
+	}
+	if g.Steps == nil {
+		t.Errorf("g.Steps = nil, want non-nil")
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc     string
+		builder  *Builder
+		wantPath string
+		wantErr  error
+	}{
+		{
+			desc:     "nil step",
+			builder:  New().AddCommandStep(&CommandStep{Command: "make"}).AddCommandStep(nil),
+			wantPath: "steps[1]",
+			wantErr:  ErrNilStep,
+		},
+		{
+			desc:     "empty group",
+			builder:  New().AddGroup("Empty"),
+			wantPath: "steps[0]",
+			wantErr:  ErrEmptyGroup,
+		},
+		{
+			desc:     "nested group",
+			builder:  New().AddGroup("Outer", &CommandStep{Command: "make"}, &GroupStep{Steps: Steps{&WaitStep{Scalar: "wait"}}}),
+			wantPath: "steps[0].steps[1]",
+			wantErr:  ErrNestedGroup,
+		},
+		{
+			desc:     "input step without kind",
+			builder:  New().AddStep(&InputStep{Label: "Deploy?"}),
+			wantPath: "steps[0]",
+			wantErr:  ErrInputStepKind,
+		},
+		{
+			desc: "duplicate key",
+			builder: New().
+				AddCommandStep(&CommandStep{Key: "build", Command: "make"}).
+				AddGroup("More", &CommandStep{Key: "build", Command: "make again"}),
+			wantPath: "steps[1].steps[0]",
+			wantErr:  ErrDuplicateKey,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := test.builder.Build()
+			if p != nil {
+				t.Errorf("Build() pipeline = %v, want nil", p)
+			}
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("Build() error = %v, want ValidationErrors", err)
+			}
+			if got := verrs[0].Path; got != test.wantPath {
+				t.Errorf("verrs[0].Path = %q, want %q", got, test.wantPath)
+			}
+			if !errors.Is(verrs[0], test.wantErr) {
+				t.Errorf("verrs[0] = %v, want %v", verrs[0], test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuilderWarnings(t *testing.T) {
+	t.Parallel()
+
+	p, err := New().
+		AddStep(&InputStep{BlockedState: "failed", RemainingFields: map[string]any{"input": "Details"}}).
+		Build()
+	if p == nil {
+		t.Errorf("Build() pipeline = nil, want non-nil")
+	}
+	if !warning.Is(err) || !errors.Is(err, ErrBlockedStateOnInputStep) {
+		t.Errorf("Build() error = %v, want a warning wrapping %v", err, ErrBlockedStateOnInputStep)
+	}
+}
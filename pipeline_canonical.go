@@ -0,0 +1,141 @@
+package pipeline
+
+// Canonicalize rewrites equivalent spellings within the pipeline into a single
+// canonical form, so that two pipelines that mean the same thing marshal
+// identically. This is useful for caching, deduplication, and diffing.
+//
+// Some spellings are already unified by parsing (name and label, command and
+// commands, id and key). Canonicalize also:
+//   - expands plugin sources into full form (see Plugin.FullSource),
+//   - writes values that can be a scalar or a list as lists: artifact_paths,
+//     depends_on, exit statuses (other than "*"), automatic retry rules,
+//     and Slack channels,
+//   - writes values that can be a scalar or a mapping as mappings: manual
+//     retry settings, and soft_fail rules,
+//   - writes agent tags as a mapping of strings, unless some tag has no value,
+//   - writes wait steps as "wait" where possible.
+//
+// Values that are written as strings to be interpolated (such as
+// soft_fail: "${SOFT_FAIL}") are unchanged, as are the labels of groups
+// without one (see CanonicaliseGroupLabels). Signatures are unchanged, so
+// signing fields that are canonicalised may invalidate them.
+func (p *Pipeline) Canonicalize() {
+	p.Notify.canonicalize()
+	p.Steps.canonicalize()
+}
+
+func (s Steps) canonicalize() {
+	for _, step := range s {
+		switch step := step.(type) {
+		case *CommandStep:
+			step.canonicalize()
+
+		case *GroupStep:
+			step.Notify.canonicalize()
+			canonicalizeDependsOn(step.RemainingFields)
+			step.Steps.canonicalize()
+
+		case *WaitStep:
+			// A wait step that can be written as a scalar (such as `wait: ~`
+			// or "waiter") marshals as "wait" once it is empty.
+			if step.SetForm(StepFormScalar) == nil {
+				step.Scalar = ""
+			}
+			canonicalizeDependsOn(step.RemainingFields)
+
+		case *InputStep:
+			canonicalizeDependsOn(step.RemainingFields)
+
+		case *TriggerStep:
+			canonicalizeDependsOn(step.RemainingFields)
+		}
+	}
+}
+
+func (c *CommandStep) canonicalize() {
+	if c == nil {
+		return
+	}
+	for _, p := range c.Plugins {
+		if p != nil {
+			p.Source = p.FullSource()
+		}
+	}
+	if c.ArtifactPaths != nil {
+		c.ArtifactPaths.scalar = false
+	}
+	c.Agents.canonicalize()
+	if c.Retry != nil {
+		if a := c.Retry.Automatic; a != nil {
+			a.single = false
+			for _, r := range a.Rules {
+				if r != nil {
+					r.ExitStatus.canonicalize()
+				}
+			}
+		}
+		if m := c.Retry.Manual; m != nil {
+			m.scalar = false
+		}
+	}
+	c.SoftFail.canonicalize()
+	if c.Matrix != nil {
+		for _, a := range c.Matrix.Adjustments {
+			if a != nil {
+				a.SoftFail.canonicalize()
+			}
+		}
+	}
+	c.Notify.canonicalize()
+	canonicalizeDependsOn(c.RemainingFields)
+}
+
+func (a *Agents) canonicalize() {
+	if a == nil {
+		return
+	}
+	for _, v := range a.tags.All() {
+		if v == nil {
+			// A tag without a value can only be written in list form.
+			return
+		}
+	}
+	a.ListForm = false
+	for k, v := range a.tags.All() {
+		a.tags.Set(k, agentTagString(v))
+	}
+}
+
+func (s *SoftFail) canonicalize() {
+	if s == nil {
+		return
+	}
+	for _, r := range s.Rules {
+		if r != nil {
+			r.bare = false
+			r.ExitStatus.canonicalize()
+		}
+	}
+}
+
+func (e *ExitStatus) canonicalize() {
+	if e != nil && !e.Any {
+		e.list = true
+	}
+}
+
+func (n Notify) canonicalize() {
+	for _, x := range n {
+		if x != nil && x.Slack != nil {
+			x.Slack.scalar = false
+		}
+	}
+}
+
+// canonicalizeDependsOn rewrites a depends_on written as a single key into a
+// list.
+func canonicalizeDependsOn(rem map[string]any) {
+	if key, ok := rem["depends_on"].(string); ok {
+		rem["depends_on"] = []any{key}
+	}
+}
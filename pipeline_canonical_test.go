@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Parallel()
+
+	// Two spellings of the same pipeline.
+	const short = `---
+notify:
+  - slack: "#builds"
+steps:
+  - name: Test
+    commands:
+      - make deps
+      - make test
+    plugins:
+      - docker#v5.0.0:
+          image: golang
+    artifact_paths: coverage.out
+    agents:
+      - queue=default
+      - cpu=2
+    retry:
+      automatic:
+        exit_status: -1
+      manual: false
+    soft_fail:
+      - 1
+    depends_on: lint
+  - waiter
+  - wait: ~
+  - wait: ~
+    key: barrier
+  - group: Deploy
+    depends_on: barrier
+    steps:
+      - trigger: deploy
+`
+	const long = `---
+notify:
+  - slack:
+      channels: ["#builds"]
+steps:
+  - label: Test
+    command: "make deps\nmake test"
+    plugins:
+      - github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0:
+          image: golang
+    artifact_paths: [coverage.out]
+    agents:
+      queue: default
+      cpu: "2"
+    retry:
+      automatic:
+        - exit_status: [-1]
+      manual:
+        allowed: false
+    soft_fail:
+      - exit_status: [1]
+    depends_on: [lint]
+  - wait
+  - wait
+  - key: barrier
+    wait: null
+  - group: Deploy
+    depends_on: [barrier]
+    steps:
+      - trigger: deploy
+`
+
+	canonical := func(src string) string {
+		t.Helper()
+		p, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		p.Canonicalize()
+		out, err := yaml.Marshal(p)
+		if err != nil {
+			t.Fatalf("yaml.Marshal(p) error = %v", err)
+		}
+		return string(out)
+	}
+
+	got := canonical(short)
+	want := `steps:
+    - label: Test
+      command: |-
+        make deps
+        make test
+      plugins:
+        - github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0:
+            image: golang
+      retry:
+        automatic:
+            - exit_status:
+                - -1
+        manual:
+            allowed: false
+      agents:
+        queue: default
+        cpu: "2"
+      soft_fail:
+        - exit_status:
+            - 1
+      artifact_paths:
+        - coverage.out
+      depends_on:
+        - lint
+    - wait
+    - wait
+    - key: barrier
+      wait: null
+    - group: Deploy
+      steps:
+        - trigger: deploy
+      depends_on:
+        - barrier
+notify:
+    - slack:
+        channels:
+            - '#builds'
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("canonical(short) diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(canonical(long), got); diff != "" {
+		t.Errorf("canonical(long) diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,405 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// This file compares pipelines and steps at the semantic level: each is
+// converted to its generic form (as for Encode) and flattened into fields
+// such as "plugins[0].docker#v1.2.3.image", which are compared one by one.
+// Formatting, comments, field order, and aliases (such as "id" for "key") make
+// no difference. Steps are matched up by key where they have one, so that
+// inserting or removing a step doesn't make all the following steps differ.
+
+// Change is a field that differs between two pipelines or steps. Values are
+// rendered as JSON. Old is empty if the field was added, and New is empty if
+// it was removed.
+type Change struct {
+	// Path is the path to the field, such as "steps[2].command". Within steps
+	// that moved, the index is the step's index in the new pipeline (or the
+	// old pipeline, if the step was removed).
+	Path string
+	Old  string
+	New  string
+}
+
+// Diff returns the fields that differ between pipelines a and b.
+func Diff(a, b *Pipeline) ([]Change, error) {
+	hunks, err := diffPipelines(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return hunkChanges(hunks), nil
+}
+
+// DiffSteps returns the fields that differ between steps a and b. Paths are
+// relative to the step.
+func DiffSteps(a, b Step) ([]Change, error) {
+	hunks, err := diffStepPair(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return hunkChanges(hunks), nil
+}
+
+// WriteUnifiedDiff writes the differences between pipelines a and b to w as a
+// unified diff, for people to read (for example, in a pull request comment or
+// an audit log). aName and bName label the two pipelines. There is one hunk
+// for the pipeline's own fields, and one for each step that differs, which
+// includes the step's unchanged fields as context. Nothing is written if the
+// pipelines don't differ.
+func WriteUnifiedDiff(w io.Writer, aName, bName string, a, b *Pipeline) error {
+	hunks, err := diffPipelines(a, b)
+	if err != nil {
+		return err
+	}
+	return writeHunks(w, aName, bName, hunks)
+}
+
+// WriteUnifiedStepDiff is like WriteUnifiedDiff, but for two steps.
+func WriteUnifiedStepDiff(w io.Writer, aName, bName string, a, b Step) error {
+	hunks, err := diffStepPair(a, b)
+	if err != nil {
+		return err
+	}
+	return writeHunks(w, aName, bName, hunks)
+}
+
+// diffLine is a line of a hunk. op is one of ' ', '-', or '+'.
+type diffLine struct {
+	op    byte
+	path  string
+	value string
+}
+
+// diffHunk is a group of lines about one step, or the pipeline itself.
+type diffHunk struct {
+	header string
+	// prefix is prepended to the paths of lines to make them absolute.
+	prefix string
+	lines  []diffLine
+}
+
+func diffPipelines(a, b *Pipeline) ([]diffHunk, error) {
+	ga, err := pipelineGeneric(a)
+	if err != nil {
+		return nil, err
+	}
+	gb, err := pipelineGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var hunks []diffHunk
+	if lines := diffFields(flattenFields(ga, "steps"), flattenFields(gb, "steps")); lines != nil {
+		hunks = append(hunks, diffHunk{header: "pipeline", lines: lines})
+	}
+	return append(hunks, diffStepLists("steps", stepsGeneric(ga), stepsGeneric(gb))...), nil
+}
+
+func diffStepPair(a, b Step) ([]diffHunk, error) {
+	ga, err := toGeneric(a)
+	if err != nil {
+		return nil, err
+	}
+	gb, err := toGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+	return diffSteps("", "step", ga, gb), nil
+}
+
+// pipelineGeneric returns the generic form of p, with the steps in generic
+// form under "steps".
+func pipelineGeneric(p *Pipeline) (*ordered.MapSA, error) {
+	if p == nil {
+		return ordered.NewMap[string, any](0), nil
+	}
+	g, err := toGeneric(p)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := g.(*ordered.MapSA)
+	if !ok {
+		return nil, fmt.Errorf("pipeline has generic form %T, want a mapping", g)
+	}
+	return m, nil
+}
+
+// stepsGeneric returns the "steps" of a pipeline or group step in generic
+// form.
+func stepsGeneric(m *ordered.MapSA) []any {
+	steps, _ := m.Get("steps")
+	sl, _ := steps.([]any)
+	return sl
+}
+
+// diffStepLists compares two lists of steps at path, matching them up by
+// identity (see stepIdentity).
+func diffStepLists(path string, a, b []any) []diffHunk {
+	ida := make([]string, len(a))
+	for i, s := range a {
+		ida[i] = stepIdentity(s)
+	}
+	idb := make([]string, len(b))
+	for i, s := range b {
+		idb[i] = stepIdentity(s)
+	}
+
+	var hunks []diffHunk
+	i, j := 0, 0
+	// flush handles the unmatched steps a[i:ei] and b[j:ej]. They are paired
+	// up in order, as steps that were modified, and any left over were
+	// removed or added.
+	flush := func(ei, ej int) {
+		for i < ei || j < ej {
+			switch {
+			case i < ei && j < ej:
+				hunks = append(hunks, diffMovedSteps(path, i, j, a[i], b[j])...)
+				i++
+				j++
+			case i < ei:
+				hunks = append(hunks, diffHunk{
+					header: fmt.Sprintf("-%s[%d]", path, i),
+					prefix: fmt.Sprintf("%s[%d]", path, i),
+					lines:  diffFields(flattenFields(a[i]), nil),
+				})
+				i++
+			default:
+				hunks = append(hunks, diffHunk{
+					header: fmt.Sprintf("+%s[%d]", path, j),
+					prefix: fmt.Sprintf("%s[%d]", path, j),
+					lines:  diffFields(nil, flattenFields(b[j])),
+				})
+				j++
+			}
+		}
+	}
+	for _, m := range lcs(ida, idb) {
+		flush(m[0], m[1])
+		hunks = append(hunks, diffMovedSteps(path, i, j, a[i], b[j])...)
+		i++
+		j++
+	}
+	flush(len(a), len(b))
+	return hunks
+}
+
+// diffMovedSteps compares step a (at index i of the old list) with step b (at
+// index j of the new list).
+func diffMovedSteps(path string, i, j int, a, b any) []diffHunk {
+	header := fmt.Sprintf("%s[%d]", path, j)
+	if i != j {
+		header = fmt.Sprintf("-%s[%d] +%s[%d]", path, i, path, j)
+	}
+	return diffSteps(fmt.Sprintf("%s[%d]", path, j), header, a, b)
+}
+
+// diffSteps compares two steps in generic form. The nested steps of group
+// steps are compared separately.
+func diffSteps(prefix, header string, a, b any) []diffHunk {
+	var hunks []diffHunk
+	if lines := diffFields(flattenFields(a, "steps"), flattenFields(b, "steps")); lines != nil {
+		hunks = append(hunks, diffHunk{header: header, prefix: prefix, lines: lines})
+	}
+	ma, _ := a.(*ordered.MapSA)
+	mb, _ := b.(*ordered.MapSA)
+	if ma == nil || mb == nil {
+		return hunks
+	}
+	return append(hunks, diffStepLists(joinPath(prefix, "steps"), stepsGeneric(ma), stepsGeneric(mb))...)
+}
+
+// stepIdentity returns a string identifying a step in generic form: its key,
+// if it has one, or otherwise its entire contents.
+func stepIdentity(s any) string {
+	if m, ok := s.(*ordered.MapSA); ok {
+		if key, ok := m.Get("key"); ok {
+			return fmt.Sprintf("key:%v", key)
+		}
+	}
+	var b strings.Builder
+	for _, f := range flattenFields(s) {
+		fmt.Fprintf(&b, "%s=%s\n", f.path, f.value)
+	}
+	return b.String()
+}
+
+// flattenFields flattens a value in generic form into leaf fields, sorted by
+// path. Top-level keys in skip are left out.
+func flattenFields(v any, skip ...string) []diffLine {
+	var out []diffLine
+	if m, ok := v.(*ordered.MapSA); ok && len(skip) > 0 {
+		filtered := ordered.NewMap[string, any](m.Len())
+		for k, v := range m.All() {
+			if !slices.Contains(skip, k) {
+				filtered.Set(k, v)
+			}
+		}
+		v = filtered
+	}
+	flatten(v, "", &out)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out
+}
+
+func flatten(v any, path string, out *[]diffLine) {
+	switch v := v.(type) {
+	case *ordered.MapSA:
+		if v.Len() == 0 {
+			if path != "" {
+				*out = append(*out, diffLine{path: path, value: "{}"})
+			}
+			return
+		}
+		for k, e := range v.All() {
+			flatten(e, joinPath(path, k), out)
+		}
+
+	case []any:
+		if len(v) == 0 {
+			*out = append(*out, diffLine{path: path, value: "[]"})
+			return
+		}
+		for i, e := range v {
+			flatten(e, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte(fmt.Sprint(v))
+		}
+		*out = append(*out, diffLine{path: path, value: string(b)})
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// diffFields compares two sorted lists of fields, returning lines for all the
+// fields, or nil if they don't differ.
+func diffFields(a, b []diffLine) []diffLine {
+	var out []diffLine
+	changed := false
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].path < b[j].path):
+			out = append(out, diffLine{op: '-', path: a[i].path, value: a[i].value})
+			changed = true
+			i++
+
+		case i == len(a) || b[j].path < a[i].path:
+			out = append(out, diffLine{op: '+', path: b[j].path, value: b[j].value})
+			changed = true
+			j++
+
+		case a[i].value == b[j].value:
+			out = append(out, diffLine{op: ' ', path: a[i].path, value: a[i].value})
+			i++
+			j++
+
+		default:
+			out = append(out,
+				diffLine{op: '-', path: a[i].path, value: a[i].value},
+				diffLine{op: '+', path: b[j].path, value: b[j].value},
+			)
+			changed = true
+			i++
+			j++
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return out
+}
+
+// lcs returns the index pairs of a longest common subsequence of a and b.
+func lcs(a, b []string) [][2]int {
+	// table[i][j] is the length of the LCS of a[i:] and b[j:].
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	var out [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, [2]int{i, j})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
+
+// hunkChanges converts hunks into a list of changes.
+func hunkChanges(hunks []diffHunk) []Change {
+	var out []Change
+	for _, h := range hunks {
+		for _, l := range h.lines {
+			path := joinPath(h.prefix, l.path)
+			switch l.op {
+			case '-':
+				out = append(out, Change{Path: path, Old: l.value})
+			case '+':
+				// A '+' line directly after a '-' line for the same field is
+				// the new value of that field.
+				if n := len(out); n > 0 && out[n-1].Path == path && out[n-1].New == "" && out[n-1].Old != "" {
+					out[n-1].New = l.value
+					continue
+				}
+				out = append(out, Change{Path: path, New: l.value})
+			}
+		}
+	}
+	return out
+}
+
+func writeHunks(w io.Writer, aName, bName string, hunks []diffHunk) error {
+	if len(hunks) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", aName, bName)
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ %s @@\n", h.header)
+		for _, l := range h.lines {
+			if l.path == "" {
+				// A step written as a scalar, such as "wait".
+				fmt.Fprintf(&b, "%c%s\n", l.op, l.value)
+				continue
+			}
+			fmt.Fprintf(&b, "%c%s: %s\n", l.op, l.path, l.value)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	before := `env:
+  FOO: bar
+steps:
+  - key: build
+    label: Build
+    command: make
+  - wait
+  - label: Test
+    command: make test
+  - key: deploy
+    command: deploy
+`
+	after := `env:
+  FOO: baz
+steps:
+  - key: lint
+    command: make lint
+  - id: build
+    name: Build
+    command: make all
+  - wait
+  - label: Test
+    command: make test
+`
+	a, err := Parse(strings.NewReader(before))
+	if err != nil {
+		t.Fatalf("Parse(before) error = %v", err)
+	}
+	b, err := Parse(strings.NewReader(after))
+	if err != nil {
+		t.Fatalf("Parse(after) error = %v", err)
+	}
+
+	var got strings.Builder
+	if err := WriteUnifiedDiff(&got, "before.yml", "after.yml", a, b); err != nil {
+		t.Fatalf("WriteUnifiedDiff(&got, before.yml, after.yml, a, b) error = %v", err)
+	}
+	want := `--- before.yml
++++ after.yml
+@@ pipeline @@
+-env.FOO: "bar"
++env.FOO: "baz"
+@@ +steps[0] @@
++command: "make lint"
++key: "lint"
+@@ -steps[0] +steps[1] @@
+-command: "make"
++command: "make all"
+ key: "build"
+ label: "Build"
+@@ -steps[3] @@
+-command: "deploy"
+-key: "deploy"
+`
+	if diff := cmp.Diff(got.String(), want); diff != "" {
+		t.Errorf("WriteUnifiedDiff output diff (-got +want):\n%s", diff)
+	}
+
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff(a, b) error = %v", err)
+	}
+	wantChanges := []Change{
+		{Path: "env.FOO", Old: `"bar"`, New: `"baz"`},
+		{Path: "steps[0].command", New: `"make lint"`},
+		{Path: "steps[0].key", New: `"lint"`},
+		{Path: "steps[1].command", Old: `"make"`, New: `"make all"`},
+		{Path: "steps[3].command", Old: `"deploy"`},
+		{Path: "steps[3].key", Old: `"deploy"`},
+	}
+	if diff := cmp.Diff(changes, wantChanges); diff != "" {
+		t.Errorf("Diff(a, b) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestWriteUnifiedStepDiff(t *testing.T) {
+	t.Parallel()
+
+	a := &GroupStep{
+		Group: ptr("Tests"),
+		Steps: Steps{
+			&CommandStep{Command: "make test"},
+			&WaitStep{Scalar: "wait"},
+		},
+	}
+	b := &GroupStep{
+		Group: ptr("Tests"),
+		Steps: Steps{
+			&CommandStep{Command: "make test", Env: map[string]string{"CI": "true"}},
+		},
+	}
+
+	var got strings.Builder
+	if err := WriteUnifiedStepDiff(&got, "a", "b", a, b); err != nil {
+		t.Fatalf("WriteUnifiedStepDiff(&got, a, b, a, b) error = %v", err)
+	}
+	want := `--- a
++++ b
+@@ steps[0] @@
+ command: "make test"
++env.CI: "true"
+@@ -steps[1] @@
+-"wait"
+`
+	if diff := cmp.Diff(got.String(), want); diff != "" {
+		t.Errorf("WriteUnifiedStepDiff output diff (-got +want):\n%s", diff)
+	}
+
+	var none strings.Builder
+	if err := WriteUnifiedStepDiff(&none, "a", "b", a, a); err != nil {
+		t.Fatalf("WriteUnifiedStepDiff(&none, a, a, a, a) error = %v", err)
+	}
+	if none.Len() != 0 {
+		t.Errorf("WriteUnifiedStepDiff of identical steps = %q, want empty", none.String())
+	}
+}
@@ -0,0 +1,247 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a parsed pipeline together with the YAML document it was parsed
+// from. Writing a Document preserves the comments, key order, and layout of
+// the original document (but not blank lines), except where the pipeline has
+// been changed. This is useful for tools that rewrite a pipeline.yml (for
+// example, adding a signature or bumping a plugin version) without destroying
+// user formatting.
+type Document struct {
+	// Pipeline is the parsed pipeline. Changes made to it are reflected when
+	// the document is written.
+	Pipeline *Pipeline
+
+	// root is the root node of the original document.
+	root *yaml.Node
+
+	// base is the pipeline as originally parsed, re-encoded. Comparing it to
+	// the re-encoded current pipeline shows what has changed.
+	base *yaml.Node
+}
+
+// ParseDocument parses a pipeline like Parse, but also keeps the original
+// document. Any custom tags (such as `!include`) are resolved in the retained
+// document, so they will be replaced with their contents when it is written.
+func ParseDocument(src io.Reader, opts ...ParseOption) (*Document, error) {
+	cfg := new(parseConfig)
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	data, err := cfg.readInput(src)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decodeText(data); err != nil {
+		return nil, err
+	}
+	n := new(yaml.Node)
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(n); err != nil {
+		return nil, formatYAMLError(err)
+	}
+	p, err := cfg.parseNode(n, data)
+	if p == nil {
+		return nil, err
+	}
+
+	base, encErr := encodePipelineNode(p)
+	if encErr != nil {
+		return nil, encErr
+	}
+	return &Document{Pipeline: p, root: n, base: base}, err
+}
+
+// MarshalYAML returns the content of the original document, updated to match
+// the pipeline. Comments before the first item of the document are only
+// written by WriteTo.
+func (d *Document) MarshalYAML() (any, error) {
+	if err := d.update(); err != nil {
+		return nil, err
+	}
+	if d.root.Kind == yaml.DocumentNode && len(d.root.Content) == 1 {
+		return d.root.Content[0], nil
+	}
+	return d.root, nil
+}
+
+// WriteTo writes the document, updated to match the pipeline, to w as YAML.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if err := d.update(); err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return 0, err
+	}
+	if err := enc.Close(); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// update patches the original document to match the pipeline.
+func (d *Document) update() error {
+	want, err := encodePipelineNode(d.Pipeline)
+	if err != nil {
+		return err
+	}
+
+	orig := d.root
+	if orig.Kind == yaml.DocumentNode && len(orig.Content) == 1 {
+		orig = orig.Content[0]
+	}
+
+	// A pipeline written as a bare sequence of steps stays that way, provided
+	// nothing besides the steps has been added.
+	if orig.Kind == yaml.SequenceNode && want.Kind == yaml.MappingNode && len(want.Content) == 2 {
+		patchNode(orig, mappingValue(d.base, "steps"), mappingValue(want, "steps"))
+	} else {
+		patchNode(orig, d.base, want)
+	}
+
+	// Subsequent changes are relative to what has now been written.
+	d.base = want
+	return nil
+}
+
+// encodePipelineNode encodes the pipeline into a node.
+func encodePipelineNode(p *Pipeline) (*yaml.Node, error) {
+	n := new(yaml.Node)
+	if err := n.Encode(p); err != nil {
+		return nil, fmt.Errorf("encoding pipeline: %w", err)
+	}
+	return n, nil
+}
+
+// mappingValue returns the value for key in the mapping n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// patchNode updates orig (part of the original document) so that it
+// represents want. base is what orig looked like after being parsed and
+// re-encoded. Where base and want are equal, orig is left untouched, keeping
+// its comments and layout.
+func patchNode(orig, base, want *yaml.Node) {
+	if nodesEqual(base, want) {
+		return
+	}
+	if base != nil && orig.Kind == base.Kind && base.Kind == want.Kind {
+		switch orig.Kind {
+		case yaml.MappingNode:
+			if patchMapping(orig, base, want) {
+				return
+			}
+
+		case yaml.SequenceNode:
+			if len(orig.Content) == len(base.Content) {
+				patchSequence(orig, base, want)
+				return
+			}
+		}
+	}
+	replaceNode(orig, want)
+}
+
+// patchMapping patches the items of a mapping. It returns false if orig can't
+// be lined up with base (for example, because orig used a key alias such as
+// "id", or a merge key), in which case orig is unchanged.
+func patchMapping(orig, base, want *yaml.Node) bool {
+	if len(orig.Content) != len(base.Content) {
+		return false
+	}
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		if mappingValue(base, orig.Content[i].Value) == nil {
+			return false
+		}
+	}
+
+	// Remove items that are no longer wanted, and patch the rest.
+	content := orig.Content[:0]
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		k, v := orig.Content[i], orig.Content[i+1]
+		wv := mappingValue(want, k.Value)
+		if wv == nil {
+			continue
+		}
+		patchNode(v, mappingValue(base, k.Value), wv)
+		content = append(content, k, v)
+	}
+
+	// Add new items at the end.
+	for i := 0; i+1 < len(want.Content); i += 2 {
+		if mappingValue(base, want.Content[i].Value) == nil {
+			content = append(content, want.Content[i], want.Content[i+1])
+		}
+	}
+	orig.Content = content
+	return true
+}
+
+// patchSequence patches the items of a sequence pairwise, then adds or
+// removes items at the end.
+func patchSequence(orig, base, want *yaml.Node) {
+	n := min(len(orig.Content), len(want.Content))
+	for i := 0; i < n; i++ {
+		patchNode(orig.Content[i], base.Content[i], want.Content[i])
+	}
+	orig.Content = append(orig.Content[:n], want.Content[n:]...)
+}
+
+// replaceNode replaces orig with want, but keeps the comments of orig, and
+// the quoting style of orig if both are strings.
+func replaceNode(orig, want *yaml.Node) {
+	head, line, foot := orig.HeadComment, orig.LineComment, orig.FootComment
+	style := orig.Style
+	wasStr := orig.Kind == yaml.ScalarNode && orig.ShortTag() == "!!str"
+
+	*orig = *want
+
+	if orig.HeadComment == "" {
+		orig.HeadComment = head
+	}
+	if orig.LineComment == "" {
+		orig.LineComment = line
+	}
+	if orig.FootComment == "" {
+		orig.FootComment = foot
+	}
+	if wasStr && orig.Kind == yaml.ScalarNode && orig.ShortTag() == "!!str" {
+		orig.Style = style
+	}
+}
+
+// nodesEqual reports whether two nodes have the same content, ignoring
+// comments and style.
+func nodesEqual(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Kind != b.Kind || a.ShortTag() != b.ShortTag() || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !nodesEqual(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
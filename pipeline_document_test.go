@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDocumentWriteTo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc   string
+		input  string
+		change func(*Pipeline)
+		want   string
+	}{
+		{
+			desc: "unchanged",
+			input: `# The main pipeline
+env:
+  FOO: bar # trailing comment
+steps:
+  # Build it
+  - label: ":hammer: Build"
+    commands:
+      - make
+      - make install
+    plugins:
+      - docker#v1.2.3:
+          image: alpine
+  - wait
+`,
+			change: func(*Pipeline) {},
+			want: `# The main pipeline
+env:
+  FOO: bar # trailing comment
+steps:
+  # Build it
+  - label: ":hammer: Build"
+    commands:
+      - make
+      - make install
+    plugins:
+      - docker#v1.2.3:
+          image: alpine
+  - wait
+`,
+		},
+		{
+			desc: "changed scalar keeps comments and quoting",
+			input: `steps:
+  # Build it
+  - label: "Build" # the label
+    command: make
+  - wait
+`,
+			change: func(p *Pipeline) {
+				p.Steps[0].(*CommandStep).Label = "Build all"
+			},
+			want: `steps:
+  # Build it
+  - label: "Build all" # the label
+    command: make
+  - wait
+`,
+		},
+		{
+			desc: "added field goes at the end",
+			input: `steps:
+  # Build it
+  - command: make # do it
+    label: Build
+`,
+			change: func(p *Pipeline) {
+				p.Steps[0].(*CommandStep).Key = "build"
+			},
+			want: `steps:
+  # Build it
+  - command: make # do it
+    label: Build
+    key: build
+`,
+		},
+		{
+			desc: "removed step",
+			input: `steps:
+  - command: make # first
+  - command: make test # second
+`,
+			change: func(p *Pipeline) {
+				p.Steps = p.Steps[:1]
+			},
+			want: `steps:
+  - command: make # first
+`,
+		},
+		{
+			desc: "bare sequence of steps",
+			input: `# Just steps
+- command: make
+- wait # pause
+- command: make test
+`,
+			change: func(p *Pipeline) {
+				p.Steps[2].(*CommandStep).Command = "make check"
+			},
+			want: `# Just steps
+- command: make
+- wait # pause
+- command: make check
+`,
+		},
+		{
+			desc: "key alias replaces the step mapping",
+			input: `steps:
+  # Build it
+  - id: build
+    command: make
+`,
+			change: func(p *Pipeline) {
+				p.Steps[0].(*CommandStep).Command = "make all"
+			},
+			want: `steps:
+  # Build it
+  - key: build
+    command: make all
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := ParseDocument(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("ParseDocument(input) error = %v", err)
+			}
+			test.change(doc.Pipeline)
+
+			var got strings.Builder
+			if _, err := doc.WriteTo(&got); err != nil {
+				t.Fatalf("doc.WriteTo(&got) error = %v", err)
+			}
+			if diff := cmp.Diff(got.String(), test.want); diff != "" {
+				t.Errorf("doc.WriteTo output diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDocumentWriteToTwice(t *testing.T) {
+	t.Parallel()
+
+	input := `steps:
+  - command: make # build
+`
+	doc, err := ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument(input) error = %v", err)
+	}
+
+	cmd := doc.Pipeline.Steps[0].(*CommandStep)
+	cmd.Command = "make all"
+	if _, err := doc.WriteTo(new(strings.Builder)); err != nil {
+		t.Fatalf("doc.WriteTo() error = %v", err)
+	}
+	cmd.Label = "Build"
+
+	var got strings.Builder
+	if _, err := doc.WriteTo(&got); err != nil {
+		t.Fatalf("doc.WriteTo(&got) error = %v", err)
+	}
+	want := `steps:
+  - command: make all # build
+    label: Build
+`
+	if diff := cmp.Diff(got.String(), want); diff != "" {
+		t.Errorf("doc.WriteTo output diff (-got +want):\n%s", diff)
+	}
+}
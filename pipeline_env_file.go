@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// DefaultEnvFile is the conventional location of the env defaults file,
+// relative to the root of the repository.
+const DefaultEnvFile = ".buildkite/env"
+
+// ErrEnvFileSyntax is returned (wrapped) by ApplyEnvDefaults when a line of
+// the env file can't be parsed.
+var ErrEnvFileSyntax = errors.New("invalid env file line")
+
+// EnvDefault records a variable read from an env defaults file, and whether it
+// was applied to the pipeline.
+type EnvDefault struct {
+	// Name and Value are the variable and its value.
+	Name, Value string
+
+	// File and Line are where the variable was set (Line is 1-based).
+	File string
+	Line int
+
+	// Applied reports whether the default was added to the pipeline env. It
+	// is false if the pipeline env already sets the variable, or if a later
+	// line in the file sets it again.
+	Applied bool
+}
+
+// ApplyEnvDefaults reads default values for pipeline env variables from the
+// file with the name in fsys (DefaultEnvFile if name is empty), and adds them
+// to p.Env. This lets a repository keep non-secret defaults next to its
+// pipeline. Env files must not contain secrets: the defaults become part of
+// the pipeline.
+//
+// Variables set in p.Env take precedence over those in the file. Defaults are
+// added before the pipeline's own variables, so that those can refer to them
+// when the pipeline is interpolated. If the file doesn't exist, p is left
+// unchanged and no error is returned.
+//
+// The file has one NAME=value per line. Blank lines and lines starting with #
+// are ignored, as is an "export " prefix. Values may be single-quoted (taken
+// literally) or double-quoted (where \n, \", \\ and \$ are unescaped).
+// Otherwise, surrounding whitespace is trimmed. If a variable is set on more
+// than one line, the last one wins.
+//
+// It returns a record of every variable in the file, in order, noting which
+// were applied.
+func (p *Pipeline) ApplyEnvDefaults(fsys fs.FS, name string) ([]EnvDefault, error) {
+	if name == "" {
+		name = DefaultEnvFile
+	}
+	src, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading env file: %w", err)
+	}
+
+	defaults, err := parseEnvFile(src, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// last maps each name to the index of the last default setting it.
+	last := make(map[string]int, len(defaults))
+	for i, d := range defaults {
+		last[d.Name] = i
+	}
+
+	env := ordered.NewMap[string, string](len(defaults) + p.Env.Len())
+	for i := range defaults {
+		d := &defaults[i]
+		if last[d.Name] != i || p.Env.Contains(d.Name) {
+			continue
+		}
+		d.Applied = true
+		env.Set(d.Name, d.Value)
+	}
+	if env.Len() == 0 {
+		return defaults, nil
+	}
+	for k, v := range p.Env.All() {
+		env.Set(k, v)
+	}
+	p.Env = env
+	return defaults, nil
+}
+
+// parseEnvFile parses the contents of an env file.
+func parseEnvFile(src []byte, name string) ([]EnvDefault, error) {
+	var defaults []EnvDefault
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		k, v, ok := strings.Cut(text, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !validEnvName(k) {
+			return nil, fmt.Errorf("%s:%d: %w: want NAME=value", name, line, ErrEnvFileSyntax)
+		}
+		v, err := parseEnvValue(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w: %w", name, line, ErrEnvFileSyntax, err)
+		}
+		defaults = append(defaults, EnvDefault{
+			Name:  k,
+			Value: v,
+			File:  name,
+			Line:  line,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading env file: %w", err)
+	}
+	return defaults, nil
+}
+
+// parseEnvValue unquotes a (trimmed) value from an env file.
+func parseEnvValue(v string) (string, error) {
+	if v == "" || (v[0] != '"' && v[0] != '\'') {
+		return v, nil
+	}
+	q := v[0]
+	if len(v) < 2 || v[len(v)-1] != q {
+		return "", errors.New("unterminated quoted value")
+	}
+	v = v[1 : len(v)-1]
+	if q == '\'' {
+		return v, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c != '\\' || i == len(v)-1 {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch v[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case '"', '\\', '$':
+			sb.WriteByte(v[i])
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(v[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// validEnvName reports whether s is a valid environment variable name for an
+// env file: letters, digits, and underscores, not starting with a digit.
+func validEnvName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyEnvDefaults(t *testing.T) {
+	t.Parallel()
+
+	const envFile = `# Defaults for the pipeline
+GO_VERSION=1.22
+export REGISTRY = registry.example.com
+
+GREETING="hello\n\"world\""
+LITERAL='$NOT_INTERPOLATED\n'
+REGISTRY=mirror.example.com
+`
+	fsys := fstest.MapFS{DefaultEnvFile: &fstest.MapFile{Data: []byte(envFile)}}
+
+	p, err := Parse(strings.NewReader(`---
+env:
+  GO_VERSION: "1.23"
+  IMAGE: "$REGISTRY/golang:$GO_VERSION"
+steps:
+  - command: make
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got, err := p.ApplyEnvDefaults(fsys, "")
+	if err != nil {
+		t.Fatalf("p.ApplyEnvDefaults(fsys, %q) error = %v", "", err)
+	}
+	want := []EnvDefault{
+		{Name: "GO_VERSION", Value: "1.22", File: DefaultEnvFile, Line: 2},
+		{Name: "REGISTRY", Value: "registry.example.com", File: DefaultEnvFile, Line: 3},
+		{Name: "GREETING", Value: "hello\n\"world\"", File: DefaultEnvFile, Line: 5, Applied: true},
+		{Name: "LITERAL", Value: `$NOT_INTERPOLATED\n`, File: DefaultEnvFile, Line: 6, Applied: true},
+		{Name: "REGISTRY", Value: "mirror.example.com", File: DefaultEnvFile, Line: 7, Applied: true},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("p.ApplyEnvDefaults(fsys, %q) diff (-got +want):\n%s", "", diff)
+	}
+
+	gotYAML, err := yaml.Marshal(p.Env)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p.Env) error = %v", err)
+	}
+	wantYAML := `GREETING: |-
+    hello
+    "world"
+LITERAL: $NOT_INTERPOLATED\n
+REGISTRY: mirror.example.com
+GO_VERSION: "1.23"
+IMAGE: $REGISTRY/golang:$GO_VERSION
+`
+	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
+		t.Errorf("yaml.Marshal(p.Env) diff (-got +want):\n%s", diff)
+	}
+
+	if err := p.InterpolateWithPipelineEnvOnly(); err != nil {
+		t.Fatalf("p.InterpolateWithPipelineEnvOnly() error = %v", err)
+	}
+	if got, want := p.Env.ToMap()["IMAGE"], "mirror.example.com/golang:1.23"; got != want {
+		t.Errorf("after interpolation, p.Env[IMAGE] = %q, want %q", got, want)
+	}
+}
+
+func TestApplyEnvDefaultsMissingFile(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{Steps: Steps{&WaitStep{Scalar: "wait"}}}
+	got, err := p.ApplyEnvDefaults(fstest.MapFS{}, "")
+	if err != nil {
+		t.Fatalf("p.ApplyEnvDefaults(empty, %q) error = %v", "", err)
+	}
+	if got != nil {
+		t.Errorf("p.ApplyEnvDefaults(empty, %q) = %v, want nil", "", got)
+	}
+	if p.Env != nil {
+		t.Errorf("p.Env = %v, want nil", p.Env)
+	}
+}
+
+func TestApplyEnvDefaultsErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc, file, wantMsg string
+	}{
+		{
+			desc:    "no equals",
+			file:    "FOO=bar\nBAZ\n",
+			wantMsg: "ci/env:2: invalid env file line: want NAME=value",
+		},
+		{
+			desc:    "bad name",
+			file:    "1FOO=bar\n",
+			wantMsg: "ci/env:1: invalid env file line: want NAME=value",
+		},
+		{
+			desc:    "unterminated quote",
+			file:    "\n\nFOO=\"bar\n",
+			wantMsg: "ci/env:3: invalid env file line: unterminated quoted value",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := fstest.MapFS{"ci/env": &fstest.MapFile{Data: []byte(test.file)}}
+			p := new(Pipeline)
+			_, err := p.ApplyEnvDefaults(fsys, "ci/env")
+			if !errors.Is(err, ErrEnvFileSyntax) {
+				t.Fatalf("p.ApplyEnvDefaults(fsys, %q) error = %v, want %v", "ci/env", err, ErrEnvFileSyntax)
+			}
+			if got := err.Error(); got != test.wantMsg {
+				t.Errorf("p.ApplyEnvDefaults(fsys, %q) error = %q, want %q", "ci/env", got, test.wantMsg)
+			}
+			if p.Env != nil {
+				t.Errorf("p.Env = %v, want nil", p.Env)
+			}
+		})
+	}
+}
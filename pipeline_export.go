@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// This file contains helpers for splitting a pipeline up so that each
+// top-level step can be reviewed on its own, and for putting it back together.
+
+// ExportManifestName is the name of the manifest file written by
+// WriteStepFiles.
+const ExportManifestName = "pipeline.yml"
+
+// WriteStepDocuments writes the pipeline to w as a stream of YAML documents.
+// The first document contains everything except the steps (env and any other
+// top-level fields), and each top-level step follows in its own document, in
+// order. Use ParseStepDocuments to read the stream back.
+func (p *Pipeline) WriteStepDocuments(w io.Writer) error {
+	header, err := p.headerNode()
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return fmt.Errorf("encoding pipeline header: %w", err)
+	}
+	for i, s := range p.Steps {
+		if err := enc.Encode(s); err != nil {
+			return fmt.Errorf("encoding step %d: %w", i, err)
+		}
+	}
+	return enc.Close()
+}
+
+// ParseStepDocuments reads a stream written by WriteStepDocuments, and parses
+// it as a single pipeline. Options and warnings are as for Parse.
+func ParseStepDocuments(src io.Reader, opts ...ParseOption) (*Pipeline, error) {
+	cfg := new(parseConfig)
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	src, err := decodeTextReader(src)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(src)
+	header := new(yaml.Node)
+	if err := dec.Decode(header); err != nil {
+		return nil, formatYAMLError(err)
+	}
+	root, err := documentMapping(header)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline header: %w", err)
+	}
+
+	steps := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for {
+		doc := new(yaml.Node)
+		err := dec.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, formatYAMLError(err)
+		}
+		if len(doc.Content) != 1 {
+			return nil, fmt.Errorf("step document %d is empty", len(steps.Content)+1)
+		}
+		steps.Content = append(steps.Content, doc.Content[0])
+	}
+
+	setMappingValue(root, "steps", steps)
+	return cfg.parseNode(header, nil)
+}
+
+// WriteStepFiles writes the pipeline as a set of files, by calling write with
+// each file's name and contents. Each top-level step is written to its own
+// file under "steps/", and a manifest named ExportManifestName lists them in
+// order using `!include` (alongside env and any other top-level fields).
+// The manifest can be parsed back into the original pipeline with Parse and
+// WithIncludes, using a fetcher that reads the written files.
+func (p *Pipeline) WriteStepFiles(write func(name string, data []byte) error) error {
+	manifest, err := p.headerNode()
+	if err != nil {
+		return err
+	}
+
+	includes := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for i, s := range p.Steps {
+		name := stepFileName(i, s)
+
+		b, err := yaml.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("encoding step %d: %w", i, err)
+		}
+		if err := write(name, b); err != nil {
+			return fmt.Errorf("writing %q: %w", name, err)
+		}
+
+		includes.Content = append(includes.Content, &yaml.Node{
+			Kind:  yaml.ScalarNode,
+			Tag:   IncludeTag,
+			Value: name,
+		})
+	}
+	setMappingValue(manifest.Content[0], "steps", includes)
+
+	b, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := write(ExportManifestName, b); err != nil {
+		return fmt.Errorf("writing %q: %w", ExportManifestName, err)
+	}
+	return nil
+}
+
+// headerNode returns a document containing everything in the pipeline except
+// the steps.
+func (p *Pipeline) headerNode() (*yaml.Node, error) {
+	var root yaml.Node
+	header := *p
+	header.Steps = nil
+	if err := root.Encode(&header); err != nil {
+		return nil, fmt.Errorf("encoding pipeline header: %w", err)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "steps" {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			break
+		}
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&root}}, nil
+}
+
+// documentMapping returns the mapping at the top of doc.
+func documentMapping(doc *yaml.Node) (*yaml.Node, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, errors.New("not a YAML document")
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d, col %d: want a mapping", root.Line, root.Column)
+	}
+	return root, nil
+}
+
+// setMappingValue sets the value for key in the mapping n, adding it at the
+// start if it isn't already present.
+func setMappingValue(n *yaml.Node, key string, val *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = val
+			return
+		}
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	n.Content = append([]*yaml.Node{keyNode, val}, n.Content...)
+}
+
+// stepFileName returns the name of the file for the i-th step, which includes
+// the step key (if any) to make it easier to find.
+func stepFileName(i int, s Step) string {
+	name := fmt.Sprintf("steps/%03d", i+1)
+	if key := fileNamePart(StepKey(s)); key != "" {
+		name += "-" + key
+	}
+	return name + ".yml"
+}
+
+// fileNamePart replaces the characters of s that might not be safe in a file
+// name with "-".
+func fileNamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const exportTestPipeline = `---
+env:
+  FOO: bar
+notify:
+  - email: dev@example.com
+steps:
+  - key: build
+    command: make
+  - wait
+  - label: Deploy
+    key: deploy/prod
+    command: make deploy
+    depends_on: build
+`
+
+func TestWriteStepDocuments(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(exportTestPipeline))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteStepDocuments(&buf); err != nil {
+		t.Fatalf("p.WriteStepDocuments(&buf) error = %v", err)
+	}
+
+	want := `env:
+    FOO: bar
+notify:
+    - email: dev@example.com
+---
+key: build
+command: make
+---
+wait
+---
+key: deploy/prod
+label: Deploy
+command: make deploy
+depends_on: build
+`
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("p.WriteStepDocuments(&buf) output diff (-got +want):\n%s", diff)
+	}
+
+	got, err := ParseStepDocuments(&buf)
+	if err != nil {
+		t.Fatalf("ParseStepDocuments(&buf) error = %v", err)
+	}
+	if diff := diffPipeline(got, p); diff != "" {
+		t.Errorf("ParseStepDocuments(&buf) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestWriteStepFiles(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(exportTestPipeline))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	files := make(fstest.MapFS)
+	err = p.WriteStepFiles(func(name string, data []byte) error {
+		files[name] = &fstest.MapFile{Data: data}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("p.WriteStepFiles(...) error = %v", err)
+	}
+
+	wantManifest := `steps:
+    - !include steps/001-build.yml
+    - !include steps/002.yml
+    - !include steps/003-deploy-prod.yml
+env:
+    FOO: bar
+notify:
+    - email: dev@example.com
+`
+	if diff := cmp.Diff(string(files[ExportManifestName].Data), wantManifest); diff != "" {
+		t.Errorf("manifest diff (-got +want):\n%s", diff)
+	}
+
+	r := NewIncludeResolver(FSFetcher(files))
+	got, err := Parse(bytes.NewReader(files[ExportManifestName].Data), WithIncludes(r))
+	if err != nil {
+		t.Fatalf("Parse(manifest, WithIncludes(r)) error = %v", err)
+	}
+	if diff := diffPipeline(got, p); diff != "" {
+		t.Errorf("Parse(manifest, WithIncludes(r)) diff (-got +want):\n%s", diff)
+	}
+}
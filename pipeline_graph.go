@@ -0,0 +1,367 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Graph is a diagram of the structure of a pipeline: its steps, the groups
+// containing them, and the order they run in. It can be rendered as Graphviz
+// DOT (see DOT) or Mermaid (see Mermaid), for embedding in documentation.
+type Graph struct {
+	// Nodes contains a node for every step (including steps within groups),
+	// in pipeline order.
+	Nodes []*GraphNode
+
+	// Edges are the orderings between steps: each edge's To step waits for
+	// its From step. Edges are in the order of their To steps.
+	Edges []*GraphEdge
+}
+
+// GraphNode is a step within a Graph.
+type GraphNode struct {
+	// ID identifies the node in rendered diagrams, such as "n3".
+	ID string
+
+	// Step is the step this node represents.
+	Step Step
+
+	// Type is the type of the step (named as for Profile.StepTypes, or
+	// "unknown").
+	Type string
+
+	// Label is the text shown for the step: its label, or if it has none,
+	// its key, or a description of it (such as "wait").
+	Label string
+
+	// Parent is the node for the group step containing this step, if any,
+	// and Children are the nodes for the steps within this step, if it is a
+	// group.
+	Parent   *GraphNode
+	Children []*GraphNode
+}
+
+// GraphEdge is an ordering between two steps of a Graph.
+type GraphEdge struct {
+	From, To *GraphNode
+
+	// Barrier is true for orderings implied by the position of a wait step
+	// or block step: it waits for the steps before it, and the steps after
+	// it (that don't have explicit dependencies) wait for it. Otherwise the
+	// ordering comes from the To step's depends_on.
+	Barrier bool
+
+	// AllowFailure is true if the To step runs even if the From step fails,
+	// because of allow_failure in depends_on, or continue_on_failure on a
+	// wait step.
+	AllowFailure bool
+}
+
+// Graph returns the diagram of the pipeline. Explicit dependencies
+// (depends_on) are found as for DependencyGraph, so Graph returns an error in
+// the same cases; dependencies on keys that don't exist are left out of the
+// diagram. Steps are ordered by wait and block steps within the sequence of
+// steps they are in (the top-level steps, or the steps within a group), as in
+// Buildkite: steps with explicit dependencies don't wait for the wait and
+// block steps before them.
+func (p *Pipeline) Graph() (*Graph, error) {
+	sg, err := DependencyGraph(p.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{Nodes: make([]*GraphNode, len(sg.Nodes))}
+	byStepNode := make(map[*StepNode]*GraphNode, len(sg.Nodes))
+	for i, sn := range sg.Nodes {
+		typ := profileStepType(sn.Step)
+		if typ == "" {
+			typ = "unknown"
+		}
+		n := &GraphNode{
+			ID:    fmt.Sprintf("n%d", i),
+			Step:  sn.Step,
+			Type:  typ,
+			Label: graphLabel(sn.Step),
+		}
+		if sn.Parent != nil {
+			n.Parent = byStepNode[sn.Parent]
+			n.Parent.Children = append(n.Parent.Children, n)
+		}
+		g.Nodes[i] = n
+		byStepNode[sn] = n
+	}
+
+	// Barriers divide each sequence of steps, so the sequences are
+	// considered in turn.
+	var top []*GraphNode
+	for _, n := range g.Nodes {
+		if n.Parent == nil {
+			top = append(top, n)
+		}
+	}
+	barriers := make(map[*GraphNode][]*GraphEdge)
+	addBarrierEdges(barriers, top)
+	for _, n := range g.Nodes {
+		if n.Type == StepTypeGroup {
+			addBarrierEdges(barriers, n.Children)
+		}
+	}
+
+	for i, sn := range sg.Nodes {
+		n := g.Nodes[i]
+		allowFailure := make(map[string]bool)
+		// The dependencies were already checked by DependencyGraph.
+		deps, _ := StepDependencies(sn.Step)
+		for _, d := range deps {
+			allowFailure[d.Key] = allowFailure[d.Key] || d.AllowFailure
+		}
+		seen := make(map[*GraphNode]bool)
+		for _, dn := range sn.DependsOn {
+			from := byStepNode[dn]
+			if seen[from] {
+				continue
+			}
+			seen[from] = true
+			g.Edges = append(g.Edges, &GraphEdge{From: from, To: n, AllowFailure: allowFailure[dn.Key]})
+		}
+		for _, e := range barriers[n] {
+			if !seen[e.From] {
+				seen[e.From] = true
+				g.Edges = append(g.Edges, e)
+			}
+		}
+	}
+	return g, nil
+}
+
+// addBarrierEdges adds the edges implied by the wait and block steps within a
+// sequence of steps to barriers, by To node.
+func addBarrierEdges(barriers map[*GraphNode][]*GraphEdge, seq []*GraphNode) {
+	var barrier *GraphNode
+	var since []*GraphNode // the steps since the last barrier
+	for _, n := range seq {
+		if isBarrier(n.Step) {
+			// The barrier waits for everything since the last one, or
+			// the last one itself if there was nothing in between.
+			from := since
+			if len(from) == 0 && barrier != nil {
+				from = []*GraphNode{barrier}
+			}
+			for _, f := range from {
+				barriers[n] = append(barriers[n], &GraphEdge{From: f, To: n, Barrier: true})
+			}
+			barrier, since = n, nil
+			continue
+		}
+		if barrier != nil && !hasDependencies(n.Step) {
+			barriers[n] = append(barriers[n], &GraphEdge{
+				From:         barrier,
+				To:           n,
+				Barrier:      true,
+				AllowFailure: continuesOnFailure(barrier.Step),
+			})
+		}
+		since = append(since, n)
+	}
+}
+
+// isBarrier reports whether the steps after s in the same sequence wait for
+// it.
+func isBarrier(s Step) bool {
+	switch s := s.(type) {
+	case *WaitStep:
+		return true
+	case *InputStep:
+		return s.Blocks()
+	default:
+		return false
+	}
+}
+
+// hasDependencies reports whether s has a non-empty depends_on.
+func hasDependencies(s Step) bool {
+	deps, err := StepDependencies(s)
+	return err == nil && len(deps) > 0
+}
+
+// continuesOnFailure reports whether s is a wait step with
+// continue_on_failure.
+func continuesOnFailure(s Step) bool {
+	w, ok := s.(*WaitStep)
+	return ok && w.ContinueOnFailure
+}
+
+// graphLabel returns the text shown for a step in a Graph.
+func graphLabel(s Step) string {
+	var label string
+	switch s := s.(type) {
+	case *CommandStep:
+		label = s.Label
+		if label == "" && s.Key == "" {
+			if cmds := s.Commands(); len(cmds) > 0 {
+				label = cmds[0]
+			}
+		}
+	case *WaitStep:
+		return "wait"
+	case *InputStep:
+		kind := s.Kind()
+		if kind == "" {
+			kind = InputStepBlock
+		}
+		label = s.Label
+		if label == "" {
+			if v, ok := s.RemainingFields[string(kind)].(string); ok {
+				label = v
+			}
+		}
+		if label == "" && s.Key == "" {
+			label = string(kind)
+		}
+	case *TriggerStep:
+		label = s.Label
+		if label == "" && s.Key == "" {
+			label = "trigger " + s.Trigger
+		}
+	case *GroupStep:
+		label = s.Label()
+	case *UnknownStep:
+		return "unknown step"
+	}
+	if label == "" {
+		label = StepKey(s)
+	}
+	return label
+}
+
+// DOT renders the graph in the Graphviz DOT language. Groups are drawn as
+// clusters, and orderings implied by wait and block steps are dashed.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph pipeline {\n")
+	b.WriteString("\tcompound=true;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, n := range g.Nodes {
+		if n.Parent == nil {
+			g.writeDOTNode(&b, n, "\t")
+		}
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		from, to := e.From.ID, e.To.ID
+		if e.From.Type == StepTypeGroup {
+			attrs = append(attrs, "ltail=cluster_"+from)
+		}
+		if e.To.Type == StepTypeGroup {
+			attrs = append(attrs, "lhead=cluster_"+to)
+		}
+		if e.Barrier {
+			attrs = append(attrs, "style=dashed")
+		}
+		if e.AllowFailure {
+			attrs = append(attrs, `label="allow failure"`)
+		}
+		fmt.Fprintf(&b, "\t%s -> %s", from, to)
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeDOTNode writes a node (or for a group, a cluster) in DOT.
+func (g *Graph) writeDOTNode(b *strings.Builder, n *GraphNode, indent string) {
+	if n.Type == StepTypeGroup {
+		fmt.Fprintf(b, "%ssubgraph cluster_%s {\n", indent, n.ID)
+		fmt.Fprintf(b, "%s\tlabel=%s;\n", indent, dotQuote(n.Label))
+		// Edges to and from the group are drawn to its border, via an
+		// invisible node within it.
+		fmt.Fprintf(b, "%s\t%s [shape=point, style=invis];\n", indent, n.ID)
+		for _, c := range n.Children {
+			g.writeDOTNode(b, c, indent+"\t")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+		return
+	}
+	attrs := []string{"label=" + dotQuote(n.Label)}
+	switch n.Type {
+	case StepTypeWait:
+		attrs = append(attrs, "shape=circle")
+	case StepTypeBlock:
+		attrs = append(attrs, "shape=diamond")
+	case StepTypeInput:
+		attrs = append(attrs, "shape=parallelogram")
+	case StepTypeTrigger:
+		attrs = append(attrs, "shape=cds")
+	case "unknown":
+		attrs = append(attrs, "style=dashed")
+	}
+	fmt.Fprintf(b, "%s%s [%s];\n", indent, n.ID, strings.Join(attrs, ", "))
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Groups are drawn as
+// subgraphs, and orderings implied by wait and block steps are dotted.
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for _, n := range g.Nodes {
+		if n.Parent == nil {
+			g.writeMermaidNode(&b, n, "    ")
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		switch {
+		case e.Barrier && e.AllowFailure:
+			arrow = "-. allow failure .->"
+		case e.Barrier:
+			arrow = "-.->"
+		case e.AllowFailure:
+			arrow = "-- allow failure -->"
+		}
+		fmt.Fprintf(&b, "    %s %s %s\n", e.From.ID, arrow, e.To.ID)
+	}
+	return b.String()
+}
+
+// writeMermaidNode writes a node (or for a group, a subgraph) in Mermaid.
+func (g *Graph) writeMermaidNode(b *strings.Builder, n *GraphNode, indent string) {
+	label := mermaidQuote(n.Label)
+	if n.Type == StepTypeGroup {
+		fmt.Fprintf(b, "%ssubgraph %s [%s]\n", indent, n.ID, label)
+		for _, c := range n.Children {
+			g.writeMermaidNode(b, c, indent+"    ")
+		}
+		fmt.Fprintf(b, "%send\n", indent)
+		return
+	}
+	var shape string
+	switch n.Type {
+	case StepTypeWait:
+		shape = "((" + label + "))"
+	case StepTypeBlock:
+		shape = "{" + label + "}"
+	case StepTypeInput:
+		shape = "[/" + label + "/]"
+	case StepTypeTrigger:
+		shape = ">" + label + "]"
+	default:
+		shape = "[" + label + "]"
+	}
+	fmt.Fprintf(b, "%s%s%s\n", indent, n.ID, shape)
+}
+
+// mermaidQuote quotes s as a Mermaid label. Quotes within it are written as
+// entities, since Mermaid has no escapes.
+func mermaidQuote(s string) string {
+	r := strings.NewReplacer(`"`, "#quot;", "\r", "", "\n", "<br>")
+	return `"` + r.Replace(s) + `"`
+}
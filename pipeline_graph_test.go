@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testGraphPipeline = `---
+steps:
+  - key: test
+    label: Test "all"
+    command: make test
+  - command: make lint
+  - wait:
+    continue_on_failure: true
+  - key: build
+    command: make build
+  - group: Deploy
+    key: deploy
+    steps:
+      - key: staging
+        command: make staging
+      - block: Ship it?
+      - command: make prod
+  - key: notify
+    command: ./notify
+    depends_on:
+      - step: deploy
+        allow_failure: true
+  - trigger: downstream
+`
+
+func TestPipelineGraph(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(testGraphPipeline))
+	if err != nil {
+		t.Fatalf("Parse(testGraphPipeline) error = %v", err)
+	}
+	g, err := p.Graph()
+	if err != nil {
+		t.Fatalf("p.Graph() error = %v", err)
+	}
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, fmt.Sprintf("%s -> %s barrier=%t allow_failure=%t", e.From.Label, e.To.Label, e.Barrier, e.AllowFailure))
+	}
+	wantEdges := []string{
+		`Test "all" -> wait barrier=true allow_failure=false`,
+		"make lint -> wait barrier=true allow_failure=false",
+		"wait -> build barrier=true allow_failure=true",
+		"wait -> Deploy barrier=true allow_failure=true",
+		"staging -> Ship it? barrier=true allow_failure=false",
+		"Ship it? -> make prod barrier=true allow_failure=false",
+		"Deploy -> notify barrier=false allow_failure=true",
+		"wait -> trigger downstream barrier=true allow_failure=true",
+	}
+	if diff := cmp.Diff(edges, wantEdges); diff != "" {
+		t.Errorf("g.Edges diff (-got +want):\n%s", diff)
+	}
+
+	wantDOT := `digraph pipeline {
+	compound=true;
+	node [shape=box];
+	n0 [label="Test \"all\""];
+	n1 [label="make lint"];
+	n2 [label="wait", shape=circle];
+	n3 [label="build"];
+	subgraph cluster_n4 {
+		label="Deploy";
+		n4 [shape=point, style=invis];
+		n5 [label="staging"];
+		n6 [label="Ship it?", shape=diamond];
+		n7 [label="make prod"];
+	}
+	n8 [label="notify"];
+	n9 [label="trigger downstream", shape=cds];
+	n0 -> n2 [style=dashed];
+	n1 -> n2 [style=dashed];
+	n2 -> n3 [style=dashed, label="allow failure"];
+	n2 -> n4 [lhead=cluster_n4, style=dashed, label="allow failure"];
+	n5 -> n6 [style=dashed];
+	n6 -> n7 [style=dashed];
+	n4 -> n8 [ltail=cluster_n4, label="allow failure"];
+	n2 -> n9 [style=dashed, label="allow failure"];
+}
+`
+	if diff := cmp.Diff(g.DOT(), wantDOT); diff != "" {
+		t.Errorf("g.DOT() diff (-got +want):\n%s", diff)
+	}
+
+	wantMermaid := `flowchart TD
+    n0["Test #quot;all#quot;"]
+    n1["make lint"]
+    n2(("wait"))
+    n3["build"]
+    subgraph n4 ["Deploy"]
+        n5["staging"]
+        n6{"Ship it?"}
+        n7["make prod"]
+    end
+    n8["notify"]
+    n9>"trigger downstream"]
+    n0 -.-> n2
+    n1 -.-> n2
+    n2 -. allow failure .-> n3
+    n2 -. allow failure .-> n4
+    n5 -.-> n6
+    n6 -.-> n7
+    n4 -- allow failure --> n8
+    n2 -. allow failure .-> n9
+`
+	if diff := cmp.Diff(g.Mermaid(), wantMermaid); diff != "" {
+		t.Errorf("g.Mermaid() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPipelineGraph_Nodes(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(testGraphPipeline))
+	if err != nil {
+		t.Fatalf("Parse(testGraphPipeline) error = %v", err)
+	}
+	g, err := p.Graph()
+	if err != nil {
+		t.Fatalf("p.Graph() error = %v", err)
+	}
+
+	var got []string
+	for _, n := range g.Nodes {
+		parent := ""
+		if n.Parent != nil {
+			parent = n.Parent.ID
+		}
+		got = append(got, fmt.Sprintf("%s %s %q parent=%q children=%d", n.ID, n.Type, n.Label, parent, len(n.Children)))
+	}
+	want := []string{
+		`n0 command "Test \"all\"" parent="" children=0`,
+		`n1 command "make lint" parent="" children=0`,
+		`n2 wait "wait" parent="" children=0`,
+		`n3 command "build" parent="" children=0`,
+		`n4 group "Deploy" parent="" children=3`,
+		`n5 command "staging" parent="n4" children=0`,
+		`n6 block "Ship it?" parent="n4" children=0`,
+		`n7 command "make prod" parent="n4" children=0`,
+		`n8 command "notify" parent="" children=0`,
+		`n9 trigger "trigger downstream" parent="" children=0`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("g.Nodes diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPipelineGraph_InputStepIsNotABarrier(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+steps:
+  - command: one
+  - input: Details
+  - command: two
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	g, err := p.Graph()
+	if err != nil {
+		t.Fatalf("p.Graph() error = %v", err)
+	}
+	if len(g.Edges) != 0 {
+		t.Errorf("len(g.Edges) = %d, want 0", len(g.Edges))
+	}
+}
+
+func TestPipelineGraph_DuplicateKey(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{Steps: Steps{
+		&CommandStep{Key: "a", Command: "one"},
+		&CommandStep{Key: "a", Command: "two"},
+	}}
+	if _, err := p.Graph(); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("p.Graph() error = %v, want %v", err, ErrDuplicateKey)
+	}
+}
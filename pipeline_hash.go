@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/buildkite/go-pipeline/internal/canonical"
+)
+
+// HashPrefix prefixes the hashes returned by Pipeline.Hash and Step.Hash.
+const HashPrefix = "sha256:"
+
+// Hash returns a digest of the pipeline, for fingerprinting pipelines (for
+// caching or change detection) without signing them. It is HashPrefix
+// followed by the hex-encoded SHA-256 digest of the pipeline marshaled as
+// canonical JSON (JCS, RFC 8785, as used for signing), so it doesn't depend
+// on the order of mapping keys, and is the same across processes and
+// versions of Go.
+//
+// Everything that is marshaled contributes to the hash, including any
+// signatures and the order of env variables. Equivalent spellings (such as a
+// single string or a list of one string) hash differently; use Canonicalize
+// first if they should hash the same.
+func (p *Pipeline) Hash() (string, error) {
+	return contentHash(p)
+}
+
+// Hash returns a digest of the step (see Pipeline.Hash).
+func (c *CommandStep) Hash() (string, error) { return contentHash(c) }
+
+// Hash returns a digest of the step (see Pipeline.Hash).
+func (g *GroupStep) Hash() (string, error) { return contentHash(g) }
+
+// Hash returns a digest of the step (see Pipeline.Hash).
+func (s *InputStep) Hash() (string, error) { return contentHash(s) }
+
+// Hash returns a digest of the step (see Pipeline.Hash).
+func (t *TriggerStep) Hash() (string, error) { return contentHash(t) }
+
+// Hash returns a digest of the step (see Pipeline.Hash).
+func (s *WaitStep) Hash() (string, error) { return contentHash(s) }
+
+// Hash returns a digest of the step (see Pipeline.Hash).
+func (u *UnknownStep) Hash() (string, error) { return contentHash(u) }
+
+// contentHash hashes the canonical JSON encoding of v.
+func contentHash(v any) (string, error) {
+	b, err := canonical.JSON(v)
+	if err != nil {
+		return "", fmt.Errorf("hashing %T: %w", v, err)
+	}
+	sum := sha256.Sum256(b)
+	return HashPrefix + hex.EncodeToString(sum[:]), nil
+}
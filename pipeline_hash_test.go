@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	parse := func(src string) *Pipeline {
+		t.Helper()
+		p, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		return p
+	}
+	hash := func(h interface{ Hash() (string, error) }) string {
+		t.Helper()
+		got, err := h.Hash()
+		if err != nil {
+			t.Fatalf("Hash() error = %v", err)
+		}
+		return got
+	}
+
+	a := parse(`---
+steps:
+  - key: test
+    command: make test
+    env:
+      A: "1"
+      B: "2"
+  - wait
+`)
+	// The same pipeline, with mapping keys in a different order.
+	b := parse(`---
+steps:
+  - env:
+      B: "2"
+      A: "1"
+    command: make test
+    key: test
+  - wait
+`)
+	c := parse(`---
+steps:
+  - key: test
+    command: make test
+    env:
+      A: "1"
+      B: "3"
+  - wait
+`)
+
+	const want = "sha256:"
+	ha, hb, hc := hash(a), hash(b), hash(c)
+	if !strings.HasPrefix(ha, want) || len(ha) != len(want)+64 {
+		t.Errorf("a.Hash() = %q, want %q followed by 64 hex digits", ha, want)
+	}
+	if ha != hb {
+		t.Errorf("a.Hash() = %q, b.Hash() = %q, want equal", ha, hb)
+	}
+	if ha == hc {
+		t.Errorf("a.Hash() = c.Hash() = %q, want different", ha)
+	}
+	if sa, sb := hash(a.Steps[0]), hash(b.Steps[0]); sa != sb {
+		t.Errorf("a.Steps[0].Hash() = %q, b.Steps[0].Hash() = %q, want equal", sa, sb)
+	}
+	if sa, sc := hash(a.Steps[0]), hash(c.Steps[0]); sa == sc {
+		t.Errorf("a.Steps[0].Hash() = c.Steps[0].Hash() = %q, want different", sa)
+	}
+
+	// The hash of a wait step is the hash of the JSON string "wait".
+	if got, want := hash(a.Steps[1]), "sha256:f3010736707aae1a39dfde0a213d373f3b4342ab9e48d52dd049725e4bfa5fe2"; got != want {
+		t.Errorf("a.Steps[1].Hash() = %q, want %q", got, want)
+	}
+}
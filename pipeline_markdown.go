@@ -0,0 +1,280 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// WriteMarkdown writes a summary of the pipeline as GitHub-flavoured Markdown,
+// suitable for posting as a comment on a pull request that changes it. The
+// summary has:
+//   - the counts of things in the pipeline (see Stats),
+//   - a table of the steps (including those within groups), with their keys,
+//     labels, queues, dependencies, plugins, and conditions,
+//   - the command steps targeting each agent queue,
+//   - the steps using each plugin, and
+//   - the fields the library doesn't understand (see UnknownFields), which
+//     are kept as they are but not otherwise described.
+//
+// Steps of unknown types are counted and listed in the table, with the type
+// "unknown". Output is the same for the same pipeline.
+func (p *Pipeline) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	st := p.Stats()
+
+	fmt.Fprintf(bw, "**%s**", plural(st.Steps, "step"))
+	if st.Steps > 0 {
+		var types []string
+		for _, t := range append(slices.Clone(profileStepTypes), "unknown") {
+			if n := st.StepsByType[t]; n > 0 {
+				types = append(types, fmt.Sprintf("%d %s", n, t))
+			}
+		}
+		fmt.Fprintf(bw, " (%s)", strings.Join(types, ", "))
+	}
+	fmt.Fprintf(bw, ", %d keyed, %s, %s, %s, %s.\n",
+		st.KeyedSteps,
+		plural(st.Dependencies, "dependency"),
+		plural(st.Plugins, "plugin"),
+		plural(st.MatrixSteps, "matrix step"),
+		plural(st.EnvVars, "pipeline env var"),
+	)
+
+	if st.Steps > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "### Steps")
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "| Step | Type | Key | Label | Queue | Depends on | Plugins | Conditions |")
+		fmt.Fprintln(bw, "| --- | --- | --- | --- | --- | --- | --- | --- |")
+		for sp, s := range p.AllSteps() {
+			if s == nil {
+				continue
+			}
+			fmt.Fprintln(bw, "| "+strings.Join(p.markdownStepRow(sp, s), " | ")+" |")
+		}
+	}
+
+	if queues := p.StepsByQueue(); len(queues) > 0 {
+		paths := p.commandStepPaths()
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "### Queues")
+		fmt.Fprintln(bw)
+		for _, q := range slices.Sorted(maps.Keys(queues)) {
+			name := "_default_"
+			if q != "" {
+				name = mdCode(q)
+			}
+			var steps []string
+			for _, c := range queues[q] {
+				steps = append(steps, mdCode(paths[c]))
+			}
+			fmt.Fprintf(bw, "- %s: %s\n", name, strings.Join(steps, ", "))
+		}
+	}
+
+	plugins := make(map[string][]string)
+	for sp, s := range p.AllSteps() {
+		if c, ok := s.(*CommandStep); ok && c != nil {
+			for _, pl := range c.Plugins {
+				if pl != nil {
+					src := pl.ShortSource()
+					plugins[src] = append(plugins[src], mdCode(sp.String()))
+				}
+			}
+		}
+	}
+	if len(plugins) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "### Plugins")
+		fmt.Fprintln(bw)
+		for _, src := range slices.Sorted(maps.Keys(plugins)) {
+			fmt.Fprintf(bw, "- %s: %s\n", mdCode(src), strings.Join(plugins[src], ", "))
+		}
+	}
+
+	if unknown := p.UnknownFields(); len(unknown) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "### Unknown fields")
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "These fields are not understood, so aren't described above:")
+		fmt.Fprintln(bw)
+		for _, f := range unknown {
+			fmt.Fprintf(bw, "- %s\n", mdCode(f))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// markdownStepRow returns the cells of the row for a step in the table
+// written by WriteMarkdown.
+func (p *Pipeline) markdownStepRow(sp StepPath, s Step) []string {
+	typ := profileStepType(s)
+	if typ == "" {
+		typ = "unknown"
+	}
+	var label, queue string
+	var plugins []string
+	switch s := s.(type) {
+	case *CommandStep:
+		label = s.Label
+		queue = "_default_"
+		if q := s.Placement(p).Queue; q != "" {
+			queue = mdCode(q)
+		}
+		for _, pl := range s.Plugins {
+			if pl != nil {
+				plugins = append(plugins, mdCode(pl.ShortSource()))
+			}
+		}
+		if !s.Matrix.IsEmpty() {
+			typ += " (matrix)"
+		}
+	case *InputStep:
+		label = s.Label
+		// The label can also be the value of the block or input attribute.
+		for _, attr := range []string{"block", "input", "manual"} {
+			if v, ok := s.RemainingFields[attr].(string); ok && label == "" {
+				label = v
+				break
+			}
+		}
+	case *TriggerStep:
+		label = s.Label
+		typ += " → " + mdCode(s.Trigger)
+	case *GroupStep:
+		label = s.Label()
+	}
+
+	var deps []string
+	if ds, err := StepDependencies(s); err != nil {
+		deps = append(deps, "_invalid_")
+	} else {
+		for _, d := range ds {
+			dep := mdCode(d.Key)
+			if d.AllowFailure {
+				dep += " (allow failure)"
+			}
+			deps = append(deps, dep)
+		}
+	}
+
+	var conds []string
+	for _, c := range stepConditions(s) {
+		conds = append(conds, mdCode(c))
+	}
+
+	var key string
+	if k := StepKey(s); k != "" {
+		key = mdCode(k)
+	}
+	return []string{
+		mdCode(sp.String()),
+		typ,
+		key,
+		mdText(label),
+		queue,
+		strings.Join(deps, ", "),
+		strings.Join(plugins, ", "),
+		strings.Join(conds, "<br>"),
+	}
+}
+
+// commandStepPaths returns the paths of the command steps in the pipeline.
+func (p *Pipeline) commandStepPaths() map[*CommandStep]string {
+	paths := make(map[*CommandStep]string)
+	for sp, s := range p.AllSteps() {
+		if c, ok := s.(*CommandStep); ok && c != nil {
+			paths[c] = sp.String()
+		}
+	}
+	return paths
+}
+
+// stepConditions returns the attributes of the step that decide whether it
+// runs, as "name: value", in the order Buildkite checks them.
+func stepConditions(s Step) []string {
+	var remaining map[string]any
+	var conds []string
+	switch s := s.(type) {
+	case *CommandStep:
+		remaining = s.RemainingFields
+	case *GroupStep:
+		remaining = s.RemainingFields
+	case *TriggerStep:
+		remaining = s.RemainingFields
+		if s.Skip != nil && s.Skip != false && s.Skip != "" {
+			conds = append(conds, fmt.Sprintf("skip: %v", s.Skip))
+		}
+		if s.Branches != "" {
+			conds = append(conds, "branches: "+s.Branches)
+		}
+	case *WaitStep:
+		remaining = s.RemainingFields
+		if s.If != "" {
+			conds = append(conds, "if: "+s.If)
+		}
+	case *InputStep:
+		remaining = s.RemainingFields
+		if s.If != "" {
+			conds = append(conds, "if: "+s.If)
+		}
+	}
+	for _, name := range []string{"skip", "branches", "if", "if_changed"} {
+		v, ok := remaining[name]
+		if !ok || v == nil || v == false || v == "" {
+			continue
+		}
+		switch v := v.(type) {
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			conds = append(conds, name+": "+strings.Join(items, " "))
+		case []string:
+			conds = append(conds, name+": "+strings.Join(v, " "))
+		default:
+			conds = append(conds, fmt.Sprintf("%s: %v", name, v))
+		}
+	}
+	return conds
+}
+
+// mdText escapes s for a Markdown table cell.
+func mdText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	r := strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;", ">", "&gt;", "[", `\[`, "]", `\]`)
+	return r.Replace(s)
+}
+
+// mdCode formats s as inline code within a Markdown table cell.
+func mdCode(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, "|", `\|`)
+	if !strings.Contains(s, "`") {
+		return "`" + s + "`"
+	}
+	// A code span can contain backticks if it is delimited by a longer run
+	// of them, and padded with spaces.
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fence + " " + s + " " + fence
+}
+
+// plural returns "n thing" or "n things".
+func plural(n int, thing string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, thing)
+	}
+	if strings.HasSuffix(thing, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(thing, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
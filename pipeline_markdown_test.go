@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	t.Parallel()
+
+	const src = `---
+env:
+  GO_VERSION: "1.23"
+agents:
+  queue: linux
+steps:
+  - key: test
+    label: ":go: Test | lint"
+    command: go test ./...
+    plugins:
+      - docker#v5.12.0:
+          image: golang
+    matrix: [amd64, arm64]
+  - key: windows
+    command: go test ./...
+    agents:
+      queue: windows
+    branches: main release/*
+  - wait
+  - group: Deploy
+    key: deploy
+    depends_on:
+      - test
+      - step: windows
+        allow_failure: true
+    if: build.branch == "main"
+    steps:
+      - block: Ship it?
+        key: ship
+      - trigger: deploy-prod
+        label: Production
+        colour: blue
+  - robot: beep
+`
+	// The robot step can't be parsed, so there is a warning about it.
+	p, err := Parse(strings.NewReader(src))
+	if !warning.Is(err) {
+		t.Fatalf("Parse(src) error = %v, want a warning", err)
+	}
+
+	var sb strings.Builder
+	if err := p.WriteMarkdown(&sb); err != nil {
+		t.Fatalf("p.WriteMarkdown(&sb) error = %v", err)
+	}
+	want := "**7 steps** (2 command, 1 wait, 1 block, 1 trigger, 1 group, 1 unknown), 4 keyed, 2 dependencies, 1 plugin, 1 matrix step, 1 pipeline env var.\n" +
+		"\n" +
+		"### Steps\n" +
+		"\n" +
+		"| Step | Type | Key | Label | Queue | Depends on | Plugins | Conditions |\n" +
+		"| --- | --- | --- | --- | --- | --- | --- | --- |\n" +
+		"| `steps[0]` | command (matrix) | `test` | :go: Test \\| lint | `linux` |  | `docker#v5.12.0` |  |\n" +
+		"| `steps[1]` | command | `windows` |  | `windows` |  |  | `branches: main release/*` |\n" +
+		"| `steps[2]` | wait |  |  |  |  |  |  |\n" +
+		"| `steps[3]` | group | `deploy` | Deploy |  | `test`, `windows` (allow failure) |  | `if: build.branch == \"main\"` |\n" +
+		"| `steps[3].steps[0]` | block | `ship` | Ship it? |  |  |  |  |\n" +
+		"| `steps[3].steps[1]` | trigger → `deploy-prod` |  | Production |  |  |  |  |\n" +
+		"| `steps[4]` | unknown |  |  |  |  |  |  |\n" +
+		"\n" +
+		"### Queues\n" +
+		"\n" +
+		"- `linux`: `steps[0]`\n" +
+		"- `windows`: `steps[1]`\n" +
+		"\n" +
+		"### Plugins\n" +
+		"\n" +
+		"- `docker#v5.12.0`: `steps[0]`\n" +
+		"\n" +
+		"### Unknown fields\n" +
+		"\n" +
+		"These fields are not understood, so aren't described above:\n" +
+		"\n" +
+		"- `steps[3].steps[1].colour`\n"
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("p.WriteMarkdown(&sb) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestWriteMarkdown_Empty(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	if err := (&Pipeline{}).WriteMarkdown(&sb); err != nil {
+		t.Fatalf("p.WriteMarkdown(&sb) error = %v", err)
+	}
+	want := "**0 steps**, 0 keyed, 0 dependencies, 0 plugins, 0 matrix steps, 0 pipeline env vars.\n"
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("p.WriteMarkdown(&sb) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestMDCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in, want string
+	}{
+		{"key", "`key`"},
+		{"a | b", "`a \\| b`"},
+		{"echo `date`", "`` echo `date` ``"},
+		{"two\nlines", "`two lines`"},
+	}
+	for _, test := range tests {
+		if got := mdCode(test.in); got != test.want {
+			t.Errorf("mdCode(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
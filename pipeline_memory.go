@@ -0,0 +1,115 @@
+package pipeline
+
+import "reflect"
+
+// mapEntryOverhead approximates the memory used by a Go map per entry, in
+// addition to the key and value (hash table slots, tophash, and overflow
+// buckets).
+const mapEntryOverhead = 16
+
+// MemoryFootprint returns the approximate number of bytes of memory used by
+// the pipeline: its structs, strings, slices, maps, and everything they refer
+// to. Values shared through pointers are only counted once, but strings are
+// counted every time they appear. The result is an estimate (it doesn't
+// account for allocator size classes or exact map layout), but it is
+// deterministic: the same pipeline gives the same result on the same
+// platform.
+func (p *Pipeline) MemoryFootprint() int64 {
+	if p == nil {
+		return 0
+	}
+	m := memoryMeter{seen: make(map[memoryKey]bool)}
+	return m.pointer(reflect.ValueOf(p))
+}
+
+// memoryMeter measures the memory referred to by values.
+type memoryMeter struct {
+	// seen contains the pointees already counted.
+	seen map[memoryKey]bool
+}
+
+// memoryKey identifies a pointee. The type is needed because a struct and its
+// first field have the same address.
+type memoryKey struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// pointer returns the size of the value pointed to by v and everything it
+// refers to, unless it has been counted already.
+func (m memoryMeter) pointer(v reflect.Value) int64 {
+	if v.IsNil() {
+		return 0
+	}
+	k := memoryKey{addr: v.Pointer(), typ: v.Type()}
+	if m.seen[k] {
+		return 0
+	}
+	m.seen[k] = true
+	e := v.Elem()
+	return int64(e.Type().Size()) + m.indirect(e)
+}
+
+// indirect returns the size of the memory that v refers to, not including
+// the size of v itself (which is counted as part of whatever contains it).
+func (m memoryMeter) indirect(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Pointer:
+		return m.pointer(v)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		if e.Kind() == reflect.Pointer {
+			return m.pointer(e)
+		}
+		// Non-pointer values are boxed.
+		return int64(e.Type().Size()) + m.indirect(e)
+
+	case reflect.String:
+		return int64(v.Len())
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0
+		}
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += m.indirect(v.Index(i))
+		}
+		return n
+
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += m.indirect(v.Index(i))
+		}
+		return n
+
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+		t := v.Type()
+		n := int64(v.Len()) * (int64(t.Key().Size()) + int64(t.Elem().Size()) + mapEntryOverhead)
+		iter := v.MapRange()
+		for iter.Next() {
+			n += m.indirect(iter.Key()) + m.indirect(iter.Value())
+		}
+		return n
+
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += m.indirect(v.Field(i))
+		}
+		return n
+
+	default:
+		// Numbers, bools, and so on have no indirect memory. Funcs and
+		// channels aren't part of pipelines.
+		return 0
+	}
+}
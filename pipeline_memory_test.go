@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+func TestMemoryFootprint(t *testing.T) {
+	t.Parallel()
+
+	small := &Pipeline{Steps: Steps{&CommandStep{Command: "make"}}}
+	bigger := &Pipeline{
+		Steps: Steps{&CommandStep{Command: "make test && make lint && make check"}},
+		Env:   ordered.MapFromItems(ordered.TupleSS{Key: "GREETING", Value: "hello"}),
+	}
+	if s, b := small.MemoryFootprint(), bigger.MemoryFootprint(); s <= 0 || s >= b {
+		t.Errorf("small.MemoryFootprint(), bigger.MemoryFootprint() = %d, %d, want 0 < small < bigger", s, b)
+	}
+
+	if got, want := small.MemoryFootprint(), small.MemoryFootprint(); got != want {
+		t.Errorf("small.MemoryFootprint() = %d, then %d, want the same result", got, want)
+	}
+
+	// The same step twice takes only the space of another interface value.
+	step := &CommandStep{Command: "make"}
+	once := &Pipeline{Steps: Steps{step}}
+	twice := &Pipeline{Steps: Steps{step, step}}
+	if got, want := twice.MemoryFootprint()-once.MemoryFootprint(), int64(reflect.TypeOf(Steps{}).Elem().Size()); got != want {
+		t.Errorf("twice.MemoryFootprint() - once.MemoryFootprint() = %d, want %d", got, want)
+	}
+
+	if got := (*Pipeline)(nil).MemoryFootprint(); got != 0 {
+		t.Errorf("(*Pipeline)(nil).MemoryFootprint() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// ErrMergeStepTypeMismatch is returned (wrapped) by Merge when a step in the
+// overlay has the same key as a step of a different type in the base.
+var ErrMergeStepTypeMismatch = errors.New("steps with the same key have different types")
+
+// MergeStrategy chooses how Merge combines steps from the overlay with steps in
+// the base that have the same key.
+type MergeStrategy int
+
+const (
+	// MergeStepFields merges the fields of the overlay step into the base
+	// step, in place. Fields of the overlay step replace those of the base
+	// step, except that mappings (such as env and agents) are merged key by
+	// key, and the steps within group steps are merged in the same way as the
+	// pipeline's steps. The merged step's signature is removed, since it no
+	// longer covers the step.
+	MergeStepFields MergeStrategy = iota
+
+	// ReplaceSteps replaces the base step with the overlay step, in place.
+	ReplaceSteps
+
+	// AppendSteps ignores keys, and appends every overlay step. (Steps with
+	// the same key will then fail Validate.)
+	AppendSteps
+)
+
+// Merge returns a new pipeline made by overlaying overlay on base, for
+// maintaining a shared base pipeline that other pipelines build upon:
+//   - env variables from both are kept, with those in overlay taking
+//     precedence (and those only in overlay coming after those in base),
+//   - notifications from both are kept, those in overlay coming after those
+//     in base,
+//   - steps in overlay with the same key as a step in base (including steps
+//     within groups) are combined with it according to strategy, and the
+//     others are appended,
+//   - other top-level fields in overlay replace those in base.
+//
+// Neither base nor overlay is modified. Merging happens on the generic form of
+// each pipeline (as for Diff), so both are fully parsed pipelines; YAML
+// anchors and aliases have already been resolved.
+func Merge(base, overlay *Pipeline, strategy MergeStrategy) (*Pipeline, error) {
+	out, err := pipelineGeneric(base)
+	if err != nil {
+		return nil, fmt.Errorf("converting base pipeline: %w", err)
+	}
+	over, err := pipelineGeneric(overlay)
+	if err != nil {
+		return nil, fmt.Errorf("converting overlay pipeline: %w", err)
+	}
+
+	for k, v := range over.All() {
+		old, has := out.Get(k)
+		switch {
+		case !has:
+			out.Set(k, v)
+
+		case k == "steps":
+			steps, err := mergeStepLists(stepsGeneric(out), stepsGeneric(over), strategy)
+			if err != nil {
+				return nil, err
+			}
+			out.Set(k, steps)
+
+		case k == "env":
+			out.Set(k, mergeGeneric(old, v))
+
+		case k == "notify":
+			oldList, _ := old.([]any)
+			newList, _ := v.([]any)
+			out.Set(k, append(oldList, newList...))
+
+		default:
+			out.Set(k, v)
+		}
+	}
+
+	p := new(Pipeline)
+	if err := fromGeneric(out, p); err != nil {
+		return nil, fmt.Errorf("converting merged pipeline: %w", err)
+	}
+	return p, nil
+}
+
+// mergeStepLists merges the overlay steps into the base steps (both in generic
+// form) according to strategy. The base list (and the steps within it) may be
+// modified.
+func mergeStepLists(base, overlay []any, strategy MergeStrategy) ([]any, error) {
+	// Steps are replaced in place before any are appended, so that appending
+	// can't move the base list out from under findStep.
+	var appended []any
+	for _, s := range overlay {
+		m, ok := s.(*ordered.MapSA)
+		if !ok || strategy == AppendSteps {
+			appended = append(appended, s)
+			continue
+		}
+		key, ok := m.Get("key")
+		if !ok {
+			appended = append(appended, s)
+			continue
+		}
+		list, i, ok := findStep(base, fmt.Sprint(key))
+		if !ok {
+			appended = append(appended, s)
+			continue
+		}
+		merged, err := mergeStep(list[i], m, strategy)
+		if err != nil {
+			return nil, fmt.Errorf("merging step with key %q: %w", key, err)
+		}
+		list[i] = merged
+	}
+	return append(base, appended...), nil
+}
+
+// findStep finds the first step (in generic form) with the key in list, or
+// within the group steps in list, and returns the list containing it and its
+// index within that list.
+func findStep(list []any, key string) ([]any, int, bool) {
+	for i, s := range list {
+		m, ok := s.(*ordered.MapSA)
+		if !ok {
+			continue
+		}
+		if k, ok := m.Get("key"); ok && fmt.Sprint(k) == key {
+			return list, i, true
+		}
+		if l, j, ok := findStep(stepsGeneric(m), key); ok {
+			return l, j, true
+		}
+	}
+	return nil, 0, false
+}
+
+// mergeStep combines the overlay step with the base step (both in generic
+// form) according to strategy.
+func mergeStep(base any, overlay *ordered.MapSA, strategy MergeStrategy) (any, error) {
+	baseStep, err := unmarshalStep(base)
+	if err != nil {
+		return nil, err
+	}
+	overStep, err := unmarshalStep(overlay)
+	if err != nil {
+		return nil, err
+	}
+	if bt, ot := fmt.Sprintf("%T", baseStep), fmt.Sprintf("%T", overStep); bt != ot {
+		return nil, fmt.Errorf("%w: %s and %s", ErrMergeStepTypeMismatch, bt, ot)
+	}
+	if strategy == ReplaceSteps {
+		return overlay, nil
+	}
+
+	out := base.(*ordered.MapSA)
+	for k, v := range overlay.All() {
+		old, has := out.Get(k)
+		switch {
+		case !has:
+			out.Set(k, v)
+
+		case k == "steps":
+			oldList, _ := old.([]any)
+			newList, _ := v.([]any)
+			steps, err := mergeStepLists(oldList, newList, strategy)
+			if err != nil {
+				return nil, err
+			}
+			out.Set(k, steps)
+
+		default:
+			out.Set(k, mergeGeneric(old, v))
+		}
+	}
+	out.Delete("signature")
+	return out, nil
+}
+
+// mergeGeneric merges two values in generic form: mappings are merged key by
+// key (recursively), and otherwise overlay replaces base.
+func mergeGeneric(base, overlay any) any {
+	bm, ok := base.(*ordered.MapSA)
+	if !ok {
+		return overlay
+	}
+	om, ok := overlay.(*ordered.MapSA)
+	if !ok {
+		return overlay
+	}
+	for k, v := range om.All() {
+		if old, has := bm.Get(k); has {
+			v = mergeGeneric(old, v)
+		}
+		bm.Set(k, v)
+	}
+	return bm
+}
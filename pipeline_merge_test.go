@@ -0,0 +1,205 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	const base = `---
+env:
+  GO_VERSION: "1.22"
+  CGO_ENABLED: "0"
+notify:
+  - email: dev@example.com
+steps:
+  - key: test
+    command: go test ./...
+    env:
+      RACE: "1"
+    agents:
+      queue: default
+  - wait
+  - group: Deploy
+    key: deploy
+    steps:
+      - key: staging
+        command: deploy staging
+        signature:
+          algorithm: HS256
+          signed_fields: [command]
+          value: abc
+`
+	const overlay = `---
+env:
+  GO_VERSION: "1.23"
+  EXTRA: "yes"
+notify:
+  - slack: "#builds"
+steps:
+  - key: test
+    command: go test -race ./...
+    env:
+      COVER: "1"
+  - key: staging
+    command: deploy staging --dry-run
+  - key: lint
+    command: golangci-lint run
+`
+
+	tests := []struct {
+		desc     string
+		strategy MergeStrategy
+		want     string
+	}{
+		{
+			desc:     "merge step fields",
+			strategy: MergeStepFields,
+			want: `steps:
+    - key: test
+      command: go test -race ./...
+      env:
+        COVER: "1"
+        RACE: "1"
+      agents:
+        queue: default
+    - wait
+    - key: deploy
+      group: Deploy
+      steps:
+        - key: staging
+          command: deploy staging --dry-run
+    - key: lint
+      command: golangci-lint run
+env:
+    GO_VERSION: "1.23"
+    CGO_ENABLED: "0"
+    EXTRA: "yes"
+notify:
+    - email: dev@example.com
+    - slack: '#builds'
+`,
+		},
+		{
+			desc:     "replace steps",
+			strategy: ReplaceSteps,
+			want: `steps:
+    - key: test
+      command: go test -race ./...
+      env:
+        COVER: "1"
+    - wait
+    - key: deploy
+      group: Deploy
+      steps:
+        - key: staging
+          command: deploy staging --dry-run
+    - key: lint
+      command: golangci-lint run
+env:
+    GO_VERSION: "1.23"
+    CGO_ENABLED: "0"
+    EXTRA: "yes"
+notify:
+    - email: dev@example.com
+    - slack: '#builds'
+`,
+		},
+		{
+			desc:     "append steps",
+			strategy: AppendSteps,
+			want: `steps:
+    - key: test
+      command: go test ./...
+      env:
+        RACE: "1"
+      agents:
+        queue: default
+    - wait
+    - key: deploy
+      group: Deploy
+      steps:
+        - key: staging
+          command: deploy staging
+          signature:
+            algorithm: HS256
+            signed_fields:
+                - command
+            value: abc
+    - key: test
+      command: go test -race ./...
+      env:
+        COVER: "1"
+    - key: staging
+      command: deploy staging --dry-run
+    - key: lint
+      command: golangci-lint run
+env:
+    GO_VERSION: "1.23"
+    CGO_ENABLED: "0"
+    EXTRA: "yes"
+notify:
+    - email: dev@example.com
+    - slack: '#builds'
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := Parse(strings.NewReader(base))
+			if err != nil {
+				t.Fatalf("Parse(base) error = %v", err)
+			}
+			o, err := Parse(strings.NewReader(overlay))
+			if err != nil {
+				t.Fatalf("Parse(overlay) error = %v", err)
+			}
+			before, err := yaml.Marshal(b)
+			if err != nil {
+				t.Fatalf("yaml.Marshal(base) error = %v", err)
+			}
+
+			p, err := Merge(b, o, test.strategy)
+			if err != nil {
+				t.Fatalf("Merge(base, overlay, %v) error = %v", test.strategy, err)
+			}
+			got, err := yaml.Marshal(p)
+			if err != nil {
+				t.Fatalf("yaml.Marshal(merged) error = %v", err)
+			}
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("merged pipeline diff (-got +want):\n%s", diff)
+			}
+
+			after, err := yaml.Marshal(b)
+			if err != nil {
+				t.Fatalf("yaml.Marshal(base) error = %v", err)
+			}
+			if diff := cmp.Diff(string(after), string(before)); diff != "" {
+				t.Errorf("base pipeline changed by Merge (-after +before):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergeStepTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	base := &Pipeline{Steps: Steps{&CommandStep{Key: "deploy", Command: "deploy"}}}
+	overlay := &Pipeline{Steps: Steps{&TriggerStep{Key: "deploy", Trigger: "deploy-pipeline"}}}
+
+	for _, strategy := range []MergeStrategy{MergeStepFields, ReplaceSteps} {
+		if _, err := Merge(base, overlay, strategy); !errors.Is(err, ErrMergeStepTypeMismatch) {
+			t.Errorf("Merge(base, overlay, %v) error = %v, want %v", strategy, err, ErrMergeStepTypeMismatch)
+		}
+	}
+}
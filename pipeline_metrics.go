@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MetricsPrefix prefixes the names of the metrics written by WriteMetrics.
+const MetricsPrefix = "buildkite_pipeline_"
+
+// validLabelName matches valid Prometheus label names.
+var validLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// WriteMetrics writes the pipeline's Stats, and the problems found by
+// Validate, as gauges in the Prometheus text exposition format (suitable for
+// the node exporter's textfile collector). Every metric has the given labels
+// (such as the repository the pipeline came from), as well as its own:
+//
+//	buildkite_pipeline_steps{type="command"} 12
+//	buildkite_pipeline_validation_problems{severity="error",code="duplicate_key"} 1
+//	buildkite_pipeline_valid 0
+//
+// Output is sorted, so it is the same for the same pipeline.
+func (p *Pipeline) WriteMetrics(w io.Writer, labels map[string]string) error {
+	for name := range labels {
+		switch {
+		case !validLabelName.MatchString(name):
+			return fmt.Errorf("invalid metric label name %q", name)
+		case name == "type", name == "severity", name == "code":
+			return fmt.Errorf("metric label name %q is used by WriteMetrics", name)
+		}
+	}
+	st := p.Stats()
+	v := p.validate()
+
+	mw := metricsWriter{w: bufio.NewWriter(w), labels: labels}
+	mw.family("steps", "Number of steps (including those within groups), by type.")
+	for _, t := range slices.Sorted(maps.Keys(st.StepsByType)) {
+		mw.sample("steps", st.StepsByType[t], "type", t)
+	}
+	mw.gauge("keyed_steps", "Number of steps with a key.", st.KeyedSteps)
+	mw.gauge("dependencies", "Number of depends_on items.", st.Dependencies)
+	mw.gauge("plugins", "Number of plugins used by command steps.", st.Plugins)
+	mw.gauge("matrix_steps", "Number of command steps with a matrix.", st.MatrixSteps)
+	mw.gauge("env_vars", "Number of pipeline-level env variables.", st.EnvVars)
+
+	mw.family("validation_problems", "Number of problems found by validation, by severity and code.")
+	for _, sev := range []struct {
+		name string
+		errs ValidationErrors
+	}{{"error", v.errs}, {"warning", v.warns}} {
+		counts := make(map[string]int)
+		for _, e := range sev.errs {
+			code := e.Code()
+			if code == "" {
+				code = "unknown"
+			}
+			counts[code]++
+		}
+		for _, code := range slices.Sorted(maps.Keys(counts)) {
+			mw.sample("validation_problems", counts[code], "severity", sev.name, "code", code)
+		}
+	}
+	valid := 0
+	if len(v.errs) == 0 {
+		valid = 1
+	}
+	mw.gauge("valid", "Whether the pipeline passed validation (1) or not (0).", valid)
+	return mw.flush()
+}
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	w      *bufio.Writer
+	labels map[string]string
+}
+
+// family writes the HELP and TYPE lines of a gauge.
+func (mw *metricsWriter) family(name, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s%s %s\n", MetricsPrefix, name, help)
+	fmt.Fprintf(mw.w, "# TYPE %s%s gauge\n", MetricsPrefix, name)
+}
+
+// gauge writes a gauge with a single sample.
+func (mw *metricsWriter) gauge(name, help string, value int) {
+	mw.family(name, help)
+	mw.sample(name, value)
+}
+
+// sample writes a sample, with the writer's labels followed by extra label
+// name-value pairs.
+func (mw *metricsWriter) sample(name string, value int, extra ...string) {
+	var pairs []string
+	for _, k := range slices.Sorted(maps.Keys(mw.labels)) {
+		pairs = append(pairs, k+`="`+escapeLabelValue(mw.labels[k])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabelValue(extra[i+1])+`"`)
+	}
+	fmt.Fprintf(mw.w, "%s%s", MetricsPrefix, name)
+	if len(pairs) > 0 {
+		fmt.Fprintf(mw.w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(mw.w, " %d\n", value)
+}
+
+func (mw *metricsWriter) flush() error {
+	return mw.w.Flush()
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text format.
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPipelineStats(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+env:
+  A: "1"
+steps:
+  - key: build
+    command: make
+    plugins:
+      - docker#v5.0.0: ~
+  - wait
+  - group: Test
+    key: test
+    depends_on: build
+    steps:
+      - command: make test
+        depends_on: [build, test-setup]
+        matrix: [a, b]
+      - block: OK?
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got := p.Stats()
+	want := Stats{
+		Steps:        5,
+		StepsByType:  map[string]int{"command": 2, "wait": 1, "group": 1, "block": 1},
+		KeyedSteps:   2,
+		Dependencies: 3,
+		Plugins:      1,
+		MatrixSteps:  1,
+		EnvVars:      1,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("p.Stats() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPipelineWriteMetrics(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+steps:
+  - key: build
+    command: make
+  - key: build
+    command: make again
+    depends_on: missing
+  - input: Details
+    blocked_state: failed
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var sb strings.Builder
+	if err := p.WriteMetrics(&sb, map[string]string{"repo": `git@example.com:"org"/repo.git`}); err != nil {
+		t.Fatalf("p.WriteMetrics() error = %v", err)
+	}
+	const repo = `repo="git@example.com:\"org\"/repo.git"`
+	want := strings.ReplaceAll(`# HELP buildkite_pipeline_steps Number of steps (including those within groups), by type.
+# TYPE buildkite_pipeline_steps gauge
+buildkite_pipeline_steps{REPO,type="command"} 2
+buildkite_pipeline_steps{REPO,type="input"} 1
+# HELP buildkite_pipeline_keyed_steps Number of steps with a key.
+# TYPE buildkite_pipeline_keyed_steps gauge
+buildkite_pipeline_keyed_steps{REPO} 2
+# HELP buildkite_pipeline_dependencies Number of depends_on items.
+# TYPE buildkite_pipeline_dependencies gauge
+buildkite_pipeline_dependencies{REPO} 1
+# HELP buildkite_pipeline_plugins Number of plugins used by command steps.
+# TYPE buildkite_pipeline_plugins gauge
+buildkite_pipeline_plugins{REPO} 0
+# HELP buildkite_pipeline_matrix_steps Number of command steps with a matrix.
+# TYPE buildkite_pipeline_matrix_steps gauge
+buildkite_pipeline_matrix_steps{REPO} 0
+# HELP buildkite_pipeline_env_vars Number of pipeline-level env variables.
+# TYPE buildkite_pipeline_env_vars gauge
+buildkite_pipeline_env_vars{REPO} 0
+# HELP buildkite_pipeline_validation_problems Number of problems found by validation, by severity and code.
+# TYPE buildkite_pipeline_validation_problems gauge
+buildkite_pipeline_validation_problems{REPO,severity="error",code="duplicate_key"} 1
+buildkite_pipeline_validation_problems{REPO,severity="error",code="unknown_dependency"} 1
+buildkite_pipeline_validation_problems{REPO,severity="warning",code="blocked_state_on_input_step"} 1
+# HELP buildkite_pipeline_valid Whether the pipeline passed validation (1) or not (0).
+# TYPE buildkite_pipeline_valid gauge
+buildkite_pipeline_valid{REPO} 0
+`, "REPO", repo)
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("p.WriteMetrics() diff (-got +want):\n%s", diff)
+	}
+
+	for _, name := range []string{"bad-name", "code"} {
+		if err := p.WriteMetrics(&sb, map[string]string{name: "x"}); err == nil {
+			t.Errorf("p.WriteMetrics(labels with %q) error = nil, want an error", name)
+		}
+	}
+}
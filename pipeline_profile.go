@@ -0,0 +1,291 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"gopkg.in/yaml.v3"
+)
+
+// Errors that can be reported by Profile.Validate, in addition to those
+// reported by Validate (wrapped in a ValidationError - use errors.Is).
+var (
+	ErrStepTypeNotAllowed = errors.New("step type is not allowed")
+	ErrPluginNotAllowed   = errors.New("plugin is not allowed")
+)
+
+// ErrInvalidProfile is returned (wrapped) by LoadProfile when the profile
+// can't be used.
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// Step types, as named in Profile.StepTypes.
+const (
+	StepTypeCommand = "command"
+	StepTypeWait    = "wait"
+	StepTypeBlock   = "block"
+	StepTypeInput   = "input"
+	StepTypeTrigger = "trigger"
+	StepTypeGroup   = "group"
+)
+
+var profileStepTypes = []string{StepTypeCommand, StepTypeWait, StepTypeBlock, StepTypeInput, StepTypeTrigger, StepTypeGroup}
+
+// Interpolation modes, as named in Profile.Interpolation.
+const (
+	// InterpolationDefault interpolates as Interpolate does with no options.
+	InterpolationDefault = "default"
+
+	// InterpolationStrict fails on references to unset variables (see
+	// InterpolateStrict).
+	InterpolationStrict = "strict"
+
+	// InterpolationWarn reports interpolation errors as warnings (see
+	// InterpolationErrorsAsWarnings).
+	InterpolationWarn = "warn"
+)
+
+// Profile bundles the settings for parsing, interpolating, and validating
+// pipelines, so that an organisation can pin one policy for every tool that
+// uses this package. Profiles are usually loaded from a file with
+// LoadProfile:
+//
+//	strict_fields: true
+//	coercion: strict
+//	max_steps: 500
+//	step_types: [command, wait, block, group]
+//	plugins:
+//	  allow: ["github.com/buildkite-plugins/*", "github.com/my-org/*"]
+//	  deny: ["github.com/buildkite-plugins/docker-compose-buildkite-plugin"]
+//	interpolation: strict
+//	validation:
+//	  ignore: [blocked_state_on_input_step]
+//	  warnings_as_errors: true
+//
+// The zero Profile applies no extra policy.
+type Profile struct {
+	// StrictFields rejects pipelines with unknown fields (see
+	// WithStrictFields).
+	StrictFields bool `yaml:"strict_fields,omitempty" json:"strict_fields,omitempty"`
+
+	// Coercion is the policy for converting values to strings: "scalars"
+	// (the default), "strict", or "all" (see WithCoercion).
+	Coercion string `yaml:"coercion,omitempty" json:"coercion,omitempty"`
+
+	// MaxSteps and MaxGroupChildren limit the number of steps (see
+	// WithMaxSteps and WithMaxGroupChildren). Zero means no limit.
+	MaxSteps         int `yaml:"max_steps,omitempty" json:"max_steps,omitempty"`
+	MaxGroupChildren int `yaml:"max_group_children,omitempty" json:"max_group_children,omitempty"`
+
+	// StepTypes are the types of step allowed (see the StepType
+	// constants). Empty means all types are allowed.
+	StepTypes []string `yaml:"step_types,omitempty" json:"step_types,omitempty"`
+
+	// Plugins restricts which plugins can be used.
+	Plugins PluginPolicy `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+
+	// Interpolation is the interpolation mode (see the Interpolation
+	// constants). Empty means InterpolationDefault.
+	Interpolation string `yaml:"interpolation,omitempty" json:"interpolation,omitempty"`
+
+	// DisallowEnvKeyInterpolation stops env variable names from being
+	// interpolated (see DisallowEnvKeyInterpolation).
+	DisallowEnvKeyInterpolation bool `yaml:"disallow_env_key_interpolation,omitempty" json:"disallow_env_key_interpolation,omitempty"`
+
+	// Validation adjusts which problems Profile.Validate reports.
+	Validation ValidationRules `yaml:"validation,omitempty" json:"validation,omitempty"`
+}
+
+// PluginPolicy restricts which plugins can be used. Patterns are matched
+// against the full source of each plugin (see Plugin.FullSource) without its
+// version, using path.Match, so "github.com/my-org/*" allows every plugin in
+// the my-org organisation.
+type PluginPolicy struct {
+	// Allow lists the plugins allowed. Empty means all plugins are allowed
+	// (unless denied).
+	Allow []string `yaml:"allow,omitempty" json:"allow,omitempty"`
+
+	// Deny lists plugins that are not allowed, even if they are in Allow.
+	Deny []string `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// ValidationRules adjusts which problems Profile.Validate reports.
+type ValidationRules struct {
+	// Ignore lists the codes (see ValidationError.Code) of problems that are
+	// not reported.
+	Ignore []string `yaml:"ignore,omitempty" json:"ignore,omitempty"`
+
+	// WarningsAsErrors reports warnings as errors.
+	WarningsAsErrors bool `yaml:"warnings_as_errors,omitempty" json:"warnings_as_errors,omitempty"`
+}
+
+// LoadProfile reads a profile in YAML (or JSON) from src, and checks it.
+// Unknown fields are an error, so that a misspelled setting doesn't silently
+// weaken the policy.
+func LoadProfile(src io.Reader) (*Profile, error) {
+	dec := yaml.NewDecoder(src)
+	dec.KnownFields(true)
+	pr := new(Profile)
+	if err := dec.Decode(pr); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	if err := pr.check(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	return pr, nil
+}
+
+// check reports the first problem with the profile's settings.
+func (pr *Profile) check() error {
+	if _, err := pr.coercionPolicy(); err != nil {
+		return err
+	}
+	if pr.MaxSteps < 0 || pr.MaxGroupChildren < 0 {
+		return errors.New("step limits must not be negative")
+	}
+	for _, t := range pr.StepTypes {
+		if !slices.Contains(profileStepTypes, t) {
+			return fmt.Errorf("unknown step type %q, want one of %v", t, profileStepTypes)
+		}
+	}
+	for _, pat := range slices.Concat(pr.Plugins.Allow, pr.Plugins.Deny) {
+		if _, err := path.Match(pat, ""); err != nil {
+			return fmt.Errorf("plugin pattern %q: %w", pat, err)
+		}
+	}
+	switch pr.Interpolation {
+	case "", InterpolationDefault, InterpolationStrict, InterpolationWarn:
+	default:
+		return fmt.Errorf("unknown interpolation mode %q", pr.Interpolation)
+	}
+	for _, code := range pr.Validation.Ignore {
+		if !isValidationCode(code) {
+			return fmt.Errorf("unknown validation code %q", code)
+		}
+	}
+	return nil
+}
+
+// coercionPolicy returns the policy named by Coercion.
+func (pr *Profile) coercionPolicy() (ordered.CoercionPolicy, error) {
+	switch pr.Coercion {
+	case "", "scalars":
+		return ordered.CoerceScalars, nil
+	case "strict":
+		return ordered.CoerceStrict, nil
+	case "all":
+		return ordered.CoerceAll, nil
+	default:
+		return 0, fmt.Errorf("unknown coercion policy %q", pr.Coercion)
+	}
+}
+
+// ParseOptions returns the options for Parse that apply the profile.
+func (pr *Profile) ParseOptions() []ParseOption {
+	var opts []ParseOption
+	if pr.StrictFields {
+		opts = append(opts, WithStrictFields())
+	}
+	if c, err := pr.coercionPolicy(); err == nil && c != ordered.CoerceScalars {
+		opts = append(opts, WithCoercion(c))
+	}
+	if pr.MaxSteps > 0 {
+		opts = append(opts, WithMaxSteps(pr.MaxSteps))
+	}
+	if pr.MaxGroupChildren > 0 {
+		opts = append(opts, WithMaxGroupChildren(pr.MaxGroupChildren))
+	}
+	return opts
+}
+
+// InterpolateOptions returns the options for Interpolate that apply the
+// profile.
+func (pr *Profile) InterpolateOptions() []InterpolateOption {
+	var opts []InterpolateOption
+	switch pr.Interpolation {
+	case InterpolationStrict:
+		opts = append(opts, InterpolateStrict())
+	case InterpolationWarn:
+		opts = append(opts, InterpolationErrorsAsWarnings())
+	}
+	if pr.DisallowEnvKeyInterpolation {
+		opts = append(opts, DisallowEnvKeyInterpolation())
+	}
+	return opts
+}
+
+// Validate checks the pipeline as Validate does, and also checks that it
+// only uses the step types and plugins the profile allows (reporting
+// ErrStepTypeNotAllowed and ErrPluginNotAllowed). Problems are then adjusted
+// according to the profile's Validation rules. The result is reported as for
+// Validate.
+func (pr *Profile) Validate(p *Pipeline) error {
+	v := p.validate()
+	for path, s := range p.AllSteps() {
+		if s == nil {
+			continue
+		}
+		if t := profileStepType(s); len(pr.StepTypes) > 0 && t != "" && !slices.Contains(pr.StepTypes, t) {
+			v.errorf(path.String(), ErrStepTypeNotAllowed, "%s steps are not allowed", t)
+		}
+		if c, ok := s.(*CommandStep); ok {
+			for i, pl := range c.Plugins {
+				if pl != nil && !pr.Plugins.allows(pl) {
+					v.errorf(fmt.Sprintf("%s.plugins[%d]", path, i), ErrPluginNotAllowed, "%s", pl.Source)
+				}
+			}
+		}
+	}
+
+	ignored := func(e *ValidationError) bool {
+		return slices.Contains(pr.Validation.Ignore, e.Code())
+	}
+	v.errs = slices.DeleteFunc(v.errs, ignored)
+	v.warns = slices.DeleteFunc(v.warns, ignored)
+	if pr.Validation.WarningsAsErrors {
+		v.errs = append(v.errs, v.warns...)
+		v.warns = nil
+	}
+	return v.result()
+}
+
+// allows reports whether the policy allows the plugin.
+func (pp *PluginPolicy) allows(pl *Plugin) bool {
+	src, _, _ := strings.Cut(pl.FullSource(), "#")
+	matches := func(pats []string) bool {
+		return slices.ContainsFunc(pats, func(pat string) bool {
+			ok, _ := path.Match(pat, src)
+			return ok
+		})
+	}
+	if matches(pp.Deny) {
+		return false
+	}
+	return len(pp.Allow) == 0 || matches(pp.Allow)
+}
+
+// profileStepType returns the type of the step, as named in
+// Profile.StepTypes, or "" for unknown steps.
+func profileStepType(s Step) string {
+	switch s := s.(type) {
+	case *CommandStep:
+		return StepTypeCommand
+	case *WaitStep:
+		return StepTypeWait
+	case *InputStep:
+		if s.Kind() == InputStepInput {
+			return StepTypeInput
+		}
+		return StepTypeBlock
+	case *TriggerStep:
+		return StepTypeTrigger
+	case *GroupStep:
+		return StepTypeGroup
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadProfile(t *testing.T) {
+	t.Parallel()
+
+	const src = `
+strict_fields: true
+coercion: strict
+max_steps: 10
+step_types: [command, wait, group]
+plugins:
+  allow: ["github.com/buildkite-plugins/*"]
+  deny: ["github.com/buildkite-plugins/docker-compose-buildkite-plugin"]
+interpolation: strict
+validation:
+  ignore: [unknown_dependency]
+  warnings_as_errors: true
+`
+	got, err := LoadProfile(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	want := &Profile{
+		StrictFields:  true,
+		Coercion:      "strict",
+		MaxSteps:      10,
+		StepTypes:     []string{"command", "wait", "group"},
+		Interpolation: "strict",
+		Plugins: PluginPolicy{
+			Allow: []string{"github.com/buildkite-plugins/*"},
+			Deny:  []string{"github.com/buildkite-plugins/docker-compose-buildkite-plugin"},
+		},
+		Validation: ValidationRules{
+			Ignore:           []string{"unknown_dependency"},
+			WarningsAsErrors: true,
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("LoadProfile() diff (-got +want):\n%s", diff)
+	}
+	if got, want := len(got.ParseOptions()), 3; got != want {
+		t.Errorf("len(ParseOptions()) = %d, want %d", got, want)
+	}
+	if got, want := len(got.InterpolateOptions()), 1; got != want {
+		t.Errorf("len(InterpolateOptions()) = %d, want %d", got, want)
+	}
+
+	// JSON works too.
+	if _, err := LoadProfile(strings.NewReader(`{"step_types": ["trigger"], "coercion": "all"}`)); err != nil {
+		t.Errorf("LoadProfile(JSON) error = %v", err)
+	}
+}
+
+func TestLoadProfileErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		"strict_feilds: true",
+		"coercion: sometimes",
+		"max_steps: -1",
+		"step_types: [command, teleport]",
+		"plugins: {allow: ['[']}",
+		"interpolation: lazy",
+		"validation: {ignore: [everything]}",
+	}
+	for _, src := range tests {
+		if _, err := LoadProfile(strings.NewReader(src)); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("LoadProfile(%q) error = %v, want %v", src, err, ErrInvalidProfile)
+		}
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+steps:
+  - command: make
+    plugins:
+      - docker#v5.0.0: {image: golang}
+      - docker-compose#v4.0.0: {run: app}
+      - github.com/my-org/deploy-buildkite-plugin#v1.0.0: ~
+  - trigger: deploy
+    depends_on: missing
+  - group: More
+    steps:
+      - input: Details
+        blocked_state: failed
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	pr := &Profile{
+		StepTypes: []string{StepTypeCommand, StepTypeGroup, StepTypeInput},
+		Plugins: PluginPolicy{
+			Allow: []string{"github.com/buildkite-plugins/*"},
+			Deny:  []string{"github.com/buildkite-plugins/docker-compose-buildkite-plugin"},
+		},
+		Validation: ValidationRules{Ignore: []string{"unknown_dependency"}},
+	}
+
+	err = pr.Validate(p)
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("pr.Validate(p) error = %v, want ValidationErrors", err)
+	}
+	type problem struct{ Path, Code string }
+	var got []problem
+	for _, e := range verrs {
+		got = append(got, problem{e.Path, e.Code()})
+	}
+	want := []problem{
+		{"steps[0].plugins[1]", "plugin_not_allowed"},
+		{"steps[0].plugins[2]", "plugin_not_allowed"},
+		{"steps[1]", "step_type_not_allowed"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("pr.Validate(p) problems diff (-got +want):\n%s", diff)
+	}
+
+	// Without the disallowed parts, only the warning remains...
+	p.Steps = Steps{p.Steps[2]}
+	pr.Plugins = PluginPolicy{}
+	err = pr.Validate(p)
+	if !warning.Is(err) || !errors.Is(err, ErrBlockedStateOnInputStep) {
+		t.Errorf("pr.Validate(p) error = %v, want a warning wrapping %v", err, ErrBlockedStateOnInputStep)
+	}
+
+	// ...unless warnings are errors.
+	pr.Validation.WarningsAsErrors = true
+	err = pr.Validate(p)
+	if !errors.As(err, &verrs) || !errors.Is(err, ErrBlockedStateOnInputStep) {
+		t.Errorf("pr.Validate(p) error = %v, want ValidationErrors wrapping %v", err, ErrBlockedStateOnInputStep)
+	}
+}
@@ -0,0 +1,30 @@
+package pipeline
+
+// StepsByQueue groups the command steps in the pipeline (including those
+// within group steps) by the agent queue they target (see
+// CommandStep.Placement). Steps that don't target any queue are grouped under
+// the empty string (they will run on the default queue).
+//
+// Matrix steps are counted once, regardless of how many jobs they expand
+// into.
+func (p *Pipeline) StepsByQueue() map[string][]*CommandStep {
+	out := make(map[string][]*CommandStep)
+	p.Steps.walkCommandSteps(func(c *CommandStep) {
+		queue := c.Placement(p).Queue
+		out[queue] = append(out[queue], c)
+	})
+	return out
+}
+
+// walkCommandSteps calls f with each command step, recursing into group steps.
+func (s Steps) walkCommandSteps(f func(*CommandStep)) {
+	for _, step := range s {
+		switch step := step.(type) {
+		case *CommandStep:
+			f(step)
+
+		case *GroupStep:
+			step.Steps.walkCommandSteps(f)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPipelineStepsByQueue(t *testing.T) {
+	t.Parallel()
+
+	const input = `---
+agents:
+  queue: default-queue
+steps:
+  - command: one
+  - command: two
+    agents:
+      queue: fast
+  - wait
+  - group: group
+    steps:
+      - command: three
+        agents:
+          - "queue=fast"
+      - command: four
+        agents:
+          os: linux
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	got := make(map[string][]string)
+	for queue, steps := range p.StepsByQueue() {
+		for _, s := range steps {
+			got[queue] = append(got[queue], s.Command)
+		}
+	}
+
+	want := map[string][]string{
+		"default-queue": {"one", "four"},
+		"fast":          {"two", "three"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("p.StepsByQueue() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPipelineStepsByQueue_NoQueue(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{
+		Steps: Steps{
+			&CommandStep{Command: "one"},
+			&WaitStep{Scalar: "wait"},
+			&CommandStep{Command: "two"},
+		},
+	}
+
+	got := p.StepsByQueue()
+	if len(got) != 1 || len(got[""]) != 2 {
+		t.Errorf("p.StepsByQueue() = %v, want 2 steps under the empty queue", got)
+	}
+}
@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+)
+
+// RedactedValue replaces the values of secret env vars in pipelines returned
+// by Redacted.
+const RedactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the pipeline with the values of secret env vars
+// replaced by RedactedValue, so that it can be logged or printed without
+// leaking them. secretNames contains the names of the secret env vars, which
+// may be patterns (as for path.Match, such as "*_TOKEN"). Env vars are
+// redacted wherever they are found: the pipeline env block, step env blocks
+// (including trigger step build env), and env blocks within plugin configs.
+// The original pipeline is not altered.
+func (p *Pipeline) Redacted(secretNames []string) (*Pipeline, error) {
+	for _, name := range secretNames {
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("secret name %q: %w", name, err)
+		}
+	}
+
+	g, err := toGeneric(p)
+	if err != nil {
+		return nil, fmt.Errorf("redacting pipeline: %w", err)
+	}
+	redactEnvs(g, secretNames)
+
+	out := new(Pipeline)
+	if err := fromGeneric(g, out); err != nil && !warning.Is(err) {
+		return nil, fmt.Errorf("redacting pipeline: %w", err)
+	}
+	return out, nil
+}
+
+// redactEnvs redacts the secret values of every env block within v (the
+// generic form of a pipeline), in-place.
+func redactEnvs(v any, secretNames []string) {
+	switch v := v.(type) {
+	case *ordered.MapSA:
+		for k, e := range v.All() {
+			if k == "env" {
+				redactEnv(e, secretNames)
+			} else {
+				redactEnvs(e, secretNames)
+			}
+		}
+
+	case []any:
+		for _, e := range v {
+			redactEnvs(e, secretNames)
+		}
+	}
+}
+
+// redactEnv redacts the secret values in an env block, which could be a
+// mapping or a sequence of "KEY=value" strings.
+func redactEnv(env any, secretNames []string) {
+	switch env := env.(type) {
+	case *ordered.MapSA:
+		for k := range env.Keys() {
+			if isSecretName(k, secretNames) {
+				env.Set(k, RedactedValue)
+			}
+		}
+
+	case []any:
+		for i, e := range env {
+			s, ok := e.(string)
+			if !ok {
+				continue
+			}
+			if k, _, ok := strings.Cut(s, "="); ok && isSecretName(k, secretNames) {
+				env[i] = k + "=" + RedactedValue
+			}
+		}
+	}
+}
+
+// isSecretName reports if name matches any of secretNames (which have been
+// checked to be valid patterns).
+func isSecretName(name string, secretNames []string) bool {
+	for _, pattern := range secretNames {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+func TestRedacted(t *testing.T) {
+	t.Parallel()
+
+	input := `env:
+  API_TOKEN: hunter2
+  REGION: ap-southeast-2
+steps:
+  - command: deploy
+    env:
+      DEPLOY_TOKEN: abc123
+      PASSWORD: swordfish
+      DEBUG: "true"
+    plugins:
+      - docker#v5.0.0:
+          image: alpine
+          env:
+            - PASSWORD=swordfish
+            - LANG=C
+  - group: Tests
+    steps:
+      - command: test
+        env:
+          API_TOKEN: xyz
+  - trigger: other
+    build:
+      env:
+        PASSWORD: swordfish
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	orig, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	got, err := p.Redacted([]string{"*_TOKEN", "PASSWORD"})
+	if err != nil {
+		t.Fatalf("p.Redacted(...) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Env: ordered.MapFromItems(
+			ordered.TupleSS{Key: "API_TOKEN", Value: RedactedValue},
+			ordered.TupleSS{Key: "REGION", Value: "ap-southeast-2"},
+		),
+		Steps: Steps{
+			&CommandStep{
+				Command: "deploy",
+				Env: map[string]string{
+					"DEPLOY_TOKEN": RedactedValue,
+					"PASSWORD":     RedactedValue,
+					"DEBUG":        "true",
+				},
+				Plugins: Plugins{{
+					Source: "github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0",
+					Config: map[string]any{
+						"image": "alpine",
+						"env":   []any{"PASSWORD=" + RedactedValue, "LANG=C"},
+					},
+				}},
+			},
+			&GroupStep{
+				Group: ptr("Tests"),
+				Steps: Steps{
+					&CommandStep{
+						Command: "test",
+						Env:     map[string]string{"API_TOKEN": RedactedValue},
+					},
+				},
+			},
+			&TriggerStep{
+				Trigger: "other",
+				Build:   &TriggerBuild{Env: map[string]string{"PASSWORD": RedactedValue}},
+			},
+		},
+	}
+	if diff := diffPipeline(got, want); diff != "" {
+		t.Errorf("p.Redacted(...) diff (-got +want):\n%s", diff)
+	}
+	if diff := diffPipeline(p, orig); diff != "" {
+		t.Errorf("pipeline after p.Redacted(...) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRedactedBadPattern(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{Steps: Steps{&CommandStep{Command: "make"}}}
+	if _, err := p.Redacted([]string{"[TOKEN"}); err == nil {
+		t.Errorf("p.Redacted([\"[TOKEN\"]) error = nil, want an error")
+	}
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Conventional names for the stages of processing a pipeline, for use with
+// Snapshot. Any other name can be used as well.
+const (
+	StageParsed         = "parsed"
+	StageInterpolated   = "interpolated"
+	StageMatrixExpanded = "matrix-expanded"
+	StageSigned         = "signed"
+)
+
+// Snapshot is the YAML of a pipeline at a named stage of processing.
+type Snapshot struct {
+	// Stage names the point at which the snapshot was taken.
+	Stage string
+
+	// YAML is the pipeline, marshaled at that point.
+	YAML []byte
+}
+
+// Snapshot marshals the pipeline as it is now, for later comparison with
+// snapshots taken at other stages. Since the YAML is marshaled immediately,
+// later changes to p don't affect the snapshot.
+func (p *Pipeline) Snapshot(stage string) (*Snapshot, error) {
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("snapshotting pipeline at stage %q: %w", stage, err)
+	}
+	return &Snapshot{Stage: stage, YAML: b}, nil
+}
+
+// SnapshotBundle collects snapshots of a pipeline as it is processed, so that
+// they can be written out together when investigating what was uploaded.
+//
+//	var bundle pipeline.SnapshotBundle
+//	bundle.Add(pipeline.StageParsed, p)
+//	p.Interpolate(env, false)
+//	bundle.Add(pipeline.StageInterpolated, p)
+//	...
+//	bundle.WriteFiles(write)
+type SnapshotBundle struct {
+	Snapshots []*Snapshot
+}
+
+// Add takes a snapshot of p (see Pipeline.Snapshot) and adds it to the
+// bundle.
+func (b *SnapshotBundle) Add(stage string, p *Pipeline) error {
+	s, err := p.Snapshot(stage)
+	if err != nil {
+		return err
+	}
+	b.Snapshots = append(b.Snapshots, s)
+	return nil
+}
+
+// Get returns the last snapshot taken at the stage, or nil if there isn't
+// one.
+func (b *SnapshotBundle) Get(stage string) *Snapshot {
+	for i := len(b.Snapshots) - 1; i >= 0; i-- {
+		if s := b.Snapshots[i]; s.Stage == stage {
+			return s
+		}
+	}
+	return nil
+}
+
+// WriteFiles writes each snapshot as a file, by calling write with each
+// file's name and contents. Files are named after the position and stage of
+// each snapshot (such as "01-parsed.yml"), so that they sort in the order
+// they were taken.
+func (b *SnapshotBundle) WriteFiles(write func(name string, data []byte) error) error {
+	for i, s := range b.Snapshots {
+		name := fmt.Sprintf("%02d", i+1)
+		if stage := fileNamePart(s.Stage); stage != "" {
+			name += "-" + stage
+		}
+		name += ".yml"
+		if err := write(name, s.YAML); err != nil {
+			return fmt.Errorf("writing %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the snapshots to w as a stream of YAML documents, each
+// preceded by a comment naming its stage.
+func (b *SnapshotBundle) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, s := range b.Snapshots {
+		stage := strings.ReplaceAll(s.Stage, "\n", " ")
+		n, err := fmt.Fprintf(w, "---\n# stage: %s\n%s", stage, s.YAML)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSnapshotBundle(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+steps:
+  - command: echo $GREETING
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var bundle SnapshotBundle
+	if err := bundle.Add(StageParsed, p); err != nil {
+		t.Fatalf("bundle.Add(%q, p) error = %v", StageParsed, err)
+	}
+	if err := p.Interpolate(env.New(env.FromMap(map[string]string{"GREETING": "hi"})), false); err != nil {
+		t.Fatalf("p.Interpolate() error = %v", err)
+	}
+	if err := bundle.Add(StageInterpolated, p); err != nil {
+		t.Fatalf("bundle.Add(%q, p) error = %v", StageInterpolated, err)
+	}
+	p.Steps = append(p.Steps, &WaitStep{})
+
+	if got, want := string(bundle.Get(StageParsed).YAML), "steps:\n    - command: echo $GREETING\n"; got != want {
+		t.Errorf("bundle.Get(%q).YAML = %q, want %q", StageParsed, got, want)
+	}
+	if got := bundle.Get(StageSigned); got != nil {
+		t.Errorf("bundle.Get(%q) = %v, want nil", StageSigned, got)
+	}
+
+	files := make(map[string]string)
+	err = bundle.WriteFiles(func(name string, data []byte) error {
+		files[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("bundle.WriteFiles() error = %v", err)
+	}
+	wantFiles := map[string]string{
+		"01-parsed.yml":       "steps:\n    - command: echo $GREETING\n",
+		"02-interpolated.yml": "steps:\n    - command: echo hi\n",
+	}
+	if diff := cmp.Diff(files, wantFiles); diff != "" {
+		t.Errorf("bundle.WriteFiles() files diff (-got +want):\n%s", diff)
+	}
+
+	var sb strings.Builder
+	if _, err := bundle.WriteTo(&sb); err != nil {
+		t.Fatalf("bundle.WriteTo() error = %v", err)
+	}
+	want := `---
+# stage: parsed
+steps:
+    - command: echo $GREETING
+---
+# stage: interpolated
+steps:
+    - command: echo hi
+`
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("bundle.WriteTo() diff (-got +want):\n%s", diff)
+	}
+}
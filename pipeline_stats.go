@@ -0,0 +1,61 @@
+package pipeline
+
+// Stats are counts of things in a pipeline, for building dashboards of
+// pipeline quality across many pipelines (see Pipeline.WriteMetrics).
+type Stats struct {
+	// Steps is the number of steps, including group steps and the steps
+	// within them.
+	Steps int
+
+	// StepsByType counts the steps of each type (named as for
+	// Profile.StepTypes, or "unknown").
+	StepsByType map[string]int
+
+	// KeyedSteps is the number of steps with a key.
+	KeyedSteps int
+
+	// Dependencies is the number of depends_on items, across all steps.
+	// Malformed depends_on values are not counted.
+	Dependencies int
+
+	// Plugins is the number of plugins used, across all command steps.
+	Plugins int
+
+	// MatrixSteps is the number of command steps with a matrix.
+	MatrixSteps int
+
+	// EnvVars is the number of pipeline-level env variables.
+	EnvVars int
+}
+
+// Stats counts the things in the pipeline.
+func (p *Pipeline) Stats() Stats {
+	st := Stats{
+		StepsByType: make(map[string]int),
+		EnvVars:     p.Env.Len(),
+	}
+	for _, s := range p.AllSteps() {
+		if s == nil {
+			continue
+		}
+		st.Steps++
+		t := profileStepType(s)
+		if t == "" {
+			t = "unknown"
+		}
+		st.StepsByType[t]++
+		if StepKey(s) != "" {
+			st.KeyedSteps++
+		}
+		if deps, err := StepDependencies(s); err == nil {
+			st.Dependencies += len(deps)
+		}
+		if c, ok := s.(*CommandStep); ok {
+			st.Plugins += len(c.Plugins)
+			if !c.Matrix.IsEmpty() {
+				st.MatrixSteps++
+			}
+		}
+	}
+	return st
+}
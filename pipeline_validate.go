@@ -0,0 +1,323 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+)
+
+var (
+	_ slog.LogValuer = (*ValidationError)(nil)
+	_ slog.LogValuer = ValidationErrors(nil)
+)
+
+// Errors that can be reported by Validate (wrapped in a ValidationError - use
+// errors.Is).
+var (
+	ErrDuplicateKey      = errors.New("duplicate step key")
+	ErrUnknownDependency = errors.New("depends_on refers to an unknown step key")
+	ErrInvalidDependency = errors.New("invalid depends_on")
+	ErrEmptyGroup        = errors.New("group step contains no steps")
+	ErrInvalidRetry      = errors.New("invalid retry")
+	ErrInvalidNotify     = errors.New("invalid notify")
+	ErrNilStep           = errors.New("step is nil")
+	ErrNestedGroup       = errors.New("group steps cannot contain group steps")
+	ErrInputStepKind     = errors.New("block or input step has no kind")
+
+	// ErrDependencyFailureConflict is reported as a warning, since the
+	// pipeline is accepted, but probably doesn't do what was intended.
+	ErrDependencyFailureConflict = errors.New("allow_dependency_failure overrides allow_failure: false in depends_on")
+
+	// ErrBlockedStateOnInputStep is reported as a warning, since input steps
+	// don't block the build, so blocked_state has no effect on them.
+	ErrBlockedStateOnInputStep = errors.New("blocked_state has no effect on input steps")
+)
+
+// validationCodes are the codes of the errors that can be reported by
+// Validate (see ValidationError.Code).
+var validationCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrDuplicateKey, "duplicate_key"},
+	{ErrUnknownDependency, "unknown_dependency"},
+	{ErrInvalidDependency, "invalid_dependency"},
+	{ErrEmptyGroup, "empty_group"},
+	{ErrInvalidRetry, "invalid_retry"},
+	{ErrInvalidNotify, "invalid_notify"},
+	{ErrNilStep, "nil_step"},
+	{ErrNestedGroup, "nested_group"},
+	{ErrInputStepKind, "input_step_kind"},
+	{ErrDependencyFailureConflict, "dependency_failure_conflict"},
+	{ErrBlockedStateOnInputStep, "blocked_state_on_input_step"},
+	{ErrMisindentedPluginConfig, "misindented_plugin_config"},
+	{ErrNestedInputStepFields, "nested_input_step_fields"},
+	{ErrStepTypeNotAllowed, "step_type_not_allowed"},
+	{ErrPluginNotAllowed, "plugin_not_allowed"},
+}
+
+// isValidationCode reports whether code is the code of one of the errors in
+// validationCodes.
+func isValidationCode(code string) bool {
+	for _, c := range validationCodes {
+		if c.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError is a problem found with a particular step (or other part of
+// the pipeline).
+type ValidationError struct {
+	// Path locates the step within the pipeline, e.g. "steps[2].steps[0]", or
+	// is the name of the pipeline-level field with the problem, e.g. "notify".
+	Path string
+
+	// Err describes the problem.
+	Err error
+
+	// Fix, if not empty, is a corrected YAML snippet (of the step, or the
+	// part of it that has the problem) that tools can offer to replace the
+	// original with.
+	Fix string
+}
+
+func (e *ValidationError) Error() string { return fmt.Sprintf("%s: %v", e.Path, e.Err) }
+
+// Unwrap returns e.Err.
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// Code returns a short, stable name for the kind of problem, such as
+// "duplicate_key" for ErrDuplicateKey, or "" if it isn't one of the errors
+// Validate (or Profile.Validate) reports.
+func (e *ValidationError) Code() string {
+	for _, c := range validationCodes {
+		if errors.Is(e.Err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// LogValue returns the problem as a group of attributes for log/slog: its path,
+// code, message, and fix (if it has one).
+func (e *ValidationError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("path", e.Path),
+		slog.String("code", e.Code()),
+		slog.String("message", e.Err.Error()),
+	}
+	if e.Fix != "" {
+		attrs = append(attrs, slog.String("fix", e.Fix))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// ValidationErrors is a collection of problems found by Validate.
+type ValidationErrors []*ValidationError
+
+// Error lists each of the errors on its own line.
+func (es ValidationErrors) Error() string {
+	lines := make([]string, 0, len(es))
+	for _, e := range es {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LogValue returns the errors as a group of attributes for log/slog, keyed by
+// their index.
+func (es ValidationErrors) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(es))
+	for i, e := range es {
+		attrs = append(attrs, slog.Any(strconv.Itoa(i), e))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Unwrap returns all the errors.
+func (es ValidationErrors) Unwrap() []error {
+	errs := make([]error, 0, len(es))
+	for _, e := range es {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// Validate checks the semantics of the pipeline beyond what is needed to parse
+// it:
+//   - step keys must be unique,
+//   - depends_on must be well-formed, and refer to keys of steps in the pipeline,
+//   - steps must not be nil,
+//   - group steps must contain at least one step, and no group steps,
+//   - block and input steps must say which kind of step they are (see
+//     InputStep.Kind),
+//   - retry blocks on command steps must be well-formed,
+//   - each notification must be of exactly one kind, and steps may only have
+//     the kinds of notification that steps support,
+//   - fields of block and input steps must not be nested under the block or
+//     input item.
+//
+// Plugin config that appears not to be indented under its plugin is reported
+// as a warning (see below). Problems caused by these common mistakes have a
+// Fix.
+//
+// If any problems are found, the returned error is a ValidationErrors.
+// Otherwise, if there are things that are allowed but likely to be mistakes
+// (such as allow_dependency_failure: true on a step that also has a depends_on
+// item with allow_failure: false), the returned error is a warning (see the
+// warning package) wrapping a ValidationError for each.
+// Passing Validate does not guarantee the pipeline will be accepted by the
+// pipeline upload API - see the package comment.
+func (p *Pipeline) Validate() error {
+	return p.validate().result()
+}
+
+// validate checks the pipeline, and returns the validator holding the
+// problems found.
+func (p *Pipeline) validate() *validator {
+	v := &validator{keys: make(map[string]string)}
+
+	// Keys are global across the pipeline (including within groups), so
+	// collect them all first.
+	v.collectKeys("steps", p.Steps)
+	if err := p.Notify.validate(nil); err != nil {
+		v.errorf("notify", ErrInvalidNotify, "%v", err)
+	}
+	v.checkSteps("steps", p.Steps)
+	return v
+}
+
+// result returns the problems found as an error, as described for Validate.
+func (v *validator) result() error {
+	if len(v.errs) == 0 {
+		warns := make([]error, 0, len(v.warns))
+		for _, w := range v.warns {
+			warns = append(warns, w)
+		}
+		return warning.Wrap(warns...)
+	}
+	return v.errs
+}
+
+// validator accumulates validation errors.
+type validator struct {
+	// keys maps each step key to the path of the first step with that key.
+	keys  map[string]string
+	errs  ValidationErrors
+	warns ValidationErrors
+}
+
+// errorf records an error, and returns it so that a Fix can be added.
+func (v *validator) errorf(path string, err error, f string, x ...any) *ValidationError {
+	e := &ValidationError{
+		Path: path,
+		Err:  fmt.Errorf("%w: %s", err, fmt.Sprintf(f, x...)),
+	}
+	v.errs = append(v.errs, e)
+	return e
+}
+
+// warnf records a warning, and returns it so that a Fix can be added.
+func (v *validator) warnf(path string, err error, f string, x ...any) *ValidationError {
+	e := &ValidationError{
+		Path: path,
+		Err:  fmt.Errorf("%w: %s", err, fmt.Sprintf(f, x...)),
+	}
+	v.warns = append(v.warns, e)
+	return e
+}
+
+func (v *validator) collectKeys(prefix string, steps Steps) {
+	for i, s := range steps {
+		path := fmt.Sprintf("%s[%d]", prefix, i)
+		if key := StepKey(s); key != "" {
+			if first, dupe := v.keys[key]; dupe {
+				v.errorf(path, ErrDuplicateKey, "%q was already used by %s", key, first)
+			} else {
+				v.keys[key] = path
+			}
+		}
+		if g, ok := s.(*GroupStep); ok {
+			v.collectKeys(path+".steps", g.Steps)
+		}
+	}
+}
+
+func (v *validator) checkSteps(prefix string, steps Steps) {
+	for i, s := range steps {
+		path := fmt.Sprintf("%s[%d]", prefix, i)
+		if s == nil {
+			v.errorf(path, ErrNilStep, "remove it")
+			continue
+		}
+
+		deps, err := StepDependencies(s)
+		if err != nil {
+			v.errorf(path, ErrInvalidDependency, "%v", err)
+		}
+		for _, d := range deps {
+			if _, ok := v.keys[d.Key]; !ok {
+				v.errorf(path, ErrUnknownDependency, "%q", d.Key)
+			}
+		}
+		if StepAllowsDependencyFailure(s) {
+			for _, k := range disallowedFailureKeys(stepDependsOn(s)) {
+				v.warnf(path, ErrDependencyFailureConflict, "the step will run even if %q fails", k)
+			}
+		}
+
+		switch s := s.(type) {
+		case *CommandStep:
+			if err := s.Retry.validate(); err != nil {
+				v.errorf(path, ErrInvalidRetry, "%v", err)
+			}
+			if err := s.Notify.validate(stepNotificationKinds); err != nil {
+				v.errorf(path, ErrInvalidNotify, "%v", err)
+			}
+			v.checkPluginIndentation(path, s.Plugins)
+
+		case *InputStep:
+			if s.Kind() == "" {
+				v.errorf(path, ErrInputStepKind, "add a block or input item")
+			}
+			v.checkNestedInputStep(path, s)
+			if s.BlockedState != "" && !s.Blocks() {
+				v.warnf(path, ErrBlockedStateOnInputStep, "use a block step to set the blocked state")
+			}
+
+		case *GroupStep:
+			if len(s.Steps) == 0 {
+				v.errorf(path, ErrEmptyGroup, "group %q", s.Label())
+			}
+			for j, sub := range s.Steps {
+				if _, ok := sub.(*GroupStep); ok {
+					v.errorf(fmt.Sprintf("%s.steps[%d]", path, j), ErrNestedGroup, "within group %q", s.Label())
+				}
+			}
+			if err := s.Notify.validate(stepNotificationKinds); err != nil {
+				v.errorf(path, ErrInvalidNotify, "%v", err)
+			}
+			v.checkSteps(path+".steps", s.Steps)
+		}
+	}
+}
+
+// asMap returns the contents of either *ordered.MapSA or map[string]any as
+// map[string]any.
+func asMap(x any) (map[string]any, bool) {
+	switch x := x.(type) {
+	case *ordered.MapSA:
+		return x.ToMap(), true
+	case map[string]any:
+		return x, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"gopkg.in/yaml.v3"
+)
+
+// Errors for common authoring mistakes that can be reported by Validate
+// (wrapped in a ValidationError with a Fix - use errors.Is).
+var (
+	// ErrMisindentedPluginConfig is reported as a warning, since it is
+	// detected heuristically: a plugin without config is followed by
+	// "plugins" that look like config items, which is what happens when the
+	// config isn't indented under the plugin.
+	ErrMisindentedPluginConfig = errors.New("plugin config is not indented under the plugin")
+
+	ErrNestedInputStepFields = errors.New("step fields are nested under the block or input item")
+)
+
+// checkPluginIndentation reports plugin config that has been written at the
+// same level as the plugin, like this:
+//
+//	plugins:
+//	  - docker#v5.10.0:
+//	    image: golang
+//
+// which parses as two plugins ("docker#v5.10.0" with no config, and "image"
+// with config "golang").
+func (v *validator) checkPluginIndentation(path string, plugins Plugins) {
+	var (
+		fixed   []any
+		found   bool
+		current *ordered.MapSA // config being gathered for the last plugin
+	)
+	for _, p := range plugins {
+		if current != nil && looksLikePluginConfigItem(p) {
+			current.Set(p.Source, p.Config)
+			found = true
+			continue
+		}
+		current = nil
+		if p.Config == nil {
+			current = ordered.NewMap[string, any](0)
+			fixed = append(fixed, ordered.MapFromItems(ordered.TupleSA{Key: p.Source, Value: current}))
+			continue
+		}
+		fixed = append(fixed, ordered.MapFromItems(ordered.TupleSA{Key: p.Source, Value: p.Config}))
+	}
+	if !found {
+		return
+	}
+
+	// Plugins that were followed by no config items have no config.
+	for _, f := range fixed {
+		m := f.(*ordered.MapSA)
+		for k, c := range m.All() {
+			if c, ok := c.(*ordered.MapSA); ok && c.Len() == 0 {
+				m.Set(k, nil)
+			}
+		}
+	}
+
+	fix := ordered.MapFromItems(ordered.TupleSA{Key: "plugins", Value: fixed})
+	v.warnf(path, ErrMisindentedPluginConfig, "indent the config further than the plugin name").Fix = yamlSnippet(fix)
+}
+
+// looksLikePluginConfigItem reports whether a plugin is probably a config item
+// of the previous plugin: it has a scalar or list config, and its name has
+// no version or path (as config keys don't).
+func looksLikePluginConfigItem(p *Plugin) bool {
+	if strings.ContainsAny(p.Source, "#/") {
+		return false
+	}
+	switch p.Config.(type) {
+	case nil, map[string]any:
+		return false
+	default:
+		return true
+	}
+}
+
+// checkNestedInputStep reports fields of a block or input step that have been
+// written within the block (or input) item, like this:
+//
+//	steps:
+//	  - block:
+//	      prompt: Release?
+//	      fields: [...]
+//
+// rather than alongside it.
+func (v *validator) checkNestedInputStep(path string, s *InputStep) {
+	for _, typ := range []string{"block", "input"} {
+		nested, ok := s.RemainingFields[typ].(*ordered.MapSA)
+		if !ok {
+			continue
+		}
+
+		g, err := toGeneric(s)
+		if err != nil {
+			return
+		}
+		step, ok := g.(*ordered.MapSA)
+		if !ok {
+			return
+		}
+
+		// The label goes in the block or input item, and everything else
+		// alongside it.
+		label := s.Label
+		fixed := ordered.NewMap[string, any](step.Len() + nested.Len())
+		fixed.Set(typ, nil)
+		for k, val := range nested.All() {
+			switch k {
+			case "label", "name":
+				if l, ok := val.(string); ok {
+					label = l
+				}
+				continue
+			}
+			fixed.Set(k, val)
+		}
+		for k, val := range step.All() {
+			switch k {
+			case typ:
+				continue
+			case "label", "name":
+				if label == "" {
+					label, _ = val.(string)
+				}
+				continue
+			}
+			fixed.Set(k, val)
+		}
+		if label == "" {
+			label = strings.ToUpper(typ[:1]) + typ[1:]
+		}
+		fixed.Set(typ, label)
+
+		v.errorf(path, ErrNestedInputStepFields, "move the items under %s to be alongside it", typ).Fix = yamlSnippet([]any{fixed})
+		return
+	}
+}
+
+// yamlSnippet marshals x as YAML, for use as a Fix.
+func yamlSnippet(x any) string {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(x); err != nil {
+		return ""
+	}
+	if err := enc.Close(); err != nil {
+		return ""
+	}
+	return buf.String()
+}
@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPipelineValidateFixes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc        string
+		input       string
+		wantWarning bool
+		wantPath    string
+		wantErr     error
+		wantFix     string
+	}{
+		{
+			desc: "misindented plugin config",
+			input: `---
+steps:
+  - command: make test
+    plugins:
+      - docker#v5.10.0:
+        image: golang:1.23
+        propagate-environment: true
+        volumes: [/cache]
+      - test-collector#v1.0.0:
+          files: junit.xml
+`,
+			wantWarning: true,
+			wantPath:    "steps[0]",
+			wantErr:     ErrMisindentedPluginConfig,
+			wantFix: `plugins:
+  - docker#v5.10.0:
+      image: golang:1.23
+      propagate-environment: true
+      volumes:
+        - /cache
+  - test-collector#v1.0.0:
+      files: junit.xml
+`,
+		},
+		{
+			desc: "block fields nested under block",
+			input: `---
+steps:
+  - block:
+      label: Release?
+      prompt: Ship it?
+      fields:
+        - text: Version
+          key: version
+    key: release
+`,
+			wantPath: "steps[0]",
+			wantErr:  ErrNestedInputStepFields,
+			wantFix: `- block: Release?
+  prompt: Ship it?
+  fields:
+    - text: Version
+      key: version
+  key: release
+`,
+		},
+		{
+			desc: "input fields nested under input",
+			input: `---
+steps:
+  - input:
+      fields:
+        - select: Region
+          key: region
+          options: [us, eu]
+`,
+			wantPath: "steps[0]",
+			wantErr:  ErrNestedInputStepFields,
+			wantFix: `- input: Input
+  fields:
+    - select: Region
+      key: region
+      options:
+        - us
+        - eu
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+
+			err = p.Validate()
+			if got := warning.Is(err); got != test.wantWarning {
+				t.Errorf("warning.Is(p.Validate()) = %t, want %t (error = %v)", got, test.wantWarning, err)
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("p.Validate() = %v, want it to wrap a ValidationError", err)
+			}
+			if got := verr.Path; got != test.wantPath {
+				t.Errorf("verr.Path = %q, want %q", got, test.wantPath)
+			}
+			if !errors.Is(verr, test.wantErr) {
+				t.Errorf("verr = %v, want %v", verr, test.wantErr)
+			}
+			if diff := cmp.Diff(verr.Fix, test.wantFix); diff != "" {
+				t.Errorf("verr.Fix diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPipelineValidateFixes_NoFalsePositives(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - command: make test
+    plugins:
+      - docker-login
+      - docker#v5.10.0:
+          image: golang:1.23
+      - ./local-plugin:
+          debug: true
+  - block: Release?
+    prompt: Ship it?
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("p.Validate() = %v, want nil", err)
+	}
+}
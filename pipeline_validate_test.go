@@ -0,0 +1,267 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		input     string
+		wantPaths []string
+		wantErrs  []error
+	}{
+		{
+			desc: "valid",
+			input: `---
+steps:
+  - key: build
+    command: make
+    retry:
+      automatic:
+        - exit_status: -1
+          limit: 2
+        - exit_status: "*"
+      manual:
+        allowed: false
+  - wait: ~
+    depends_on: build
+  - group: Tests
+    key: tests
+    depends_on:
+      - step: build
+        allow_failure: true
+    steps:
+      - command: make test
+        depends_on: [build]
+`,
+		},
+		{
+			desc: "duplicate keys",
+			input: `---
+steps:
+  - key: build
+    command: make
+  - group: Group
+    steps:
+      - id: build
+        command: make again
+`,
+			wantPaths: []string{"steps[1].steps[0]"},
+			wantErrs:  []error{ErrDuplicateKey},
+		},
+		{
+			desc: "unknown and invalid dependencies",
+			input: `---
+steps:
+  - command: make
+    depends_on: nope
+  - wait: ~
+    depends_on: 47
+`,
+			wantPaths: []string{"steps[0]", "steps[1]"},
+			wantErrs:  []error{ErrUnknownDependency, ErrInvalidDependency},
+		},
+		{
+			desc: "empty group",
+			input: `---
+steps:
+  - group: Empty
+    steps: []
+`,
+			wantPaths: []string{"steps[0]"},
+			wantErrs:  []error{ErrEmptyGroup},
+		},
+		{
+			desc: "invalid retry",
+			input: `---
+steps:
+  - command: make
+    retry:
+      automatic:
+        limit: 11
+  - command: make
+    retry:
+      sometimes: true
+`,
+			wantPaths: []string{"steps[0]", "steps[1]"},
+			wantErrs:  []error{ErrInvalidRetry, ErrInvalidRetry},
+		},
+		{
+			desc: "invalid notify",
+			input: `---
+notify:
+  - email: dev@example.com
+    webhook: https://example.com/hook
+steps:
+  - command: make
+    notify:
+      - email: dev@example.com
+  - group: Tests
+    notify:
+      - smoke_signal: true
+    steps:
+      - command: make test
+        notify:
+          - slack: "#builds"
+`,
+			wantPaths: []string{"notify", "steps[0]", "steps[1]"},
+			wantErrs:  []error{ErrInvalidNotify, ErrInvalidNotify, ErrInvalidNotify},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+
+			err = p.Validate()
+			if len(test.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("p.Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("p.Validate() = %v, want ValidationErrors", err)
+			}
+
+			var gotPaths []string
+			for _, e := range verrs {
+				gotPaths = append(gotPaths, e.Path)
+			}
+			if diff := cmp.Diff(gotPaths, test.wantPaths); diff != "" {
+				t.Errorf("validation error paths diff (-got +want):\n%s", diff)
+			}
+			for i, want := range test.wantErrs {
+				if i < len(verrs) && !errors.Is(verrs[i], want) {
+					t.Errorf("validation error %d = %v, want %v", i, verrs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineValidateDependencyFailureConflict(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - key: build
+    command: make
+  - key: lint
+    command: make lint
+  - command: make report
+    allow_dependency_failure: true
+    depends_on:
+      - build
+      - step: lint
+        allow_failure: false
+  - trigger: deploy
+    depends_on:
+      - step: build
+        allow_failure: false
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	if !p.Steps[2].(*CommandStep).AllowDependencyFailure {
+		t.Errorf("p.Steps[2].AllowDependencyFailure = false, want true")
+	}
+
+	err = p.Validate()
+	if !warning.Is(err) {
+		t.Fatalf("p.Validate() = %v, want a warning", err)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("p.Validate() = %v, want it to wrap a ValidationError", err)
+	}
+	if got, want := verr.Path, "steps[2]"; got != want {
+		t.Errorf("verr.Path = %q, want %q", got, want)
+	}
+	if !errors.Is(verr, ErrDependencyFailureConflict) {
+		t.Errorf("verr = %v, want %v", verr, ErrDependencyFailureConflict)
+	}
+}
+
+func TestPipelineValidateLogValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc: "errors",
+			input: `---
+steps:
+  - command: make
+    key: build
+  - command: make test
+    key: build
+    depends_on: deploy
+`,
+			want: `{"level":"WARN","msg":"invalid pipeline","problems":{` +
+				`"0":{"path":"steps[1]","code":"duplicate_key","message":"duplicate step key: \"build\" was already used by steps[0]"},` +
+				`"1":{"path":"steps[1]","code":"unknown_dependency","message":"depends_on refers to an unknown step key: \"deploy\""}}}` + "\n",
+		},
+		{
+			desc: "warnings",
+			input: `---
+steps:
+  - input: Details
+    blocked_state: failed
+`,
+			want: `{"level":"WARN","msg":"invalid pipeline","problems":{"errors":{` +
+				`"0":{"path":"steps[0]","code":"blocked_state_on_input_step","message":"blocked_state has no effect on input steps: use a block step to set the blocked state"}}}}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+			err = p.Validate()
+			if err == nil {
+				t.Fatalf("p.Validate() = nil, want an error")
+			}
+
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if len(groups) == 0 && a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+			logger.Warn("invalid pipeline", "problems", err)
+
+			if diff := cmp.Diff(buf.String(), test.want); diff != "" {
+				t.Errorf("logged record diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
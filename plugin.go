@@ -2,9 +2,6 @@ package pipeline
 
 import (
 	"encoding/json"
-	"net/url"
-	"path"
-	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -61,52 +58,16 @@ func (p *Plugin) MarshalYAML() (any, error) {
 
 // FullSource attempts to canonicalise Source. If it fails, it returns Source
 // unaltered. Otherwise, it resolves sources in a manner described at
-// https://buildkite.com/docs/plugins/using#plugin-sources.
+// https://buildkite.com/docs/plugins/using#plugin-sources (see
+// DefaultPluginSourceRules).
 func (p *Plugin) FullSource() string {
-	if p.Source == "" {
-		return ""
-	}
-
-	// Looks like an absolute or relative file path.
-	if strings.HasPrefix(p.Source, "/") || strings.HasPrefix(p.Source, ".") || strings.HasPrefix(p.Source, `\`) {
-		return p.Source
-	}
-
-	u, err := url.Parse(p.Source)
-	if err != nil {
-		return p.Source
-	}
-
-	// They wrote something like ssh://..., https://..., or C:\...
-	// in which case they _mean it_.
-	if u.Scheme != "" || u.Opaque != "" {
-		return p.Source
-	}
-
-	// thing      => thing-buildkite-plugin
-	// thing#main => thing-buildkite-plugin#main
-	lastSegment := func(n, f string) string {
-		n += "-buildkite-plugin"
-		if f == "" {
-			return n
-		}
-		return n + "#" + f
-	}
-
-	paths := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
-	switch len(paths) {
-	case 1:
-		// trimmed path contained no slash
-		return path.Join("github.com", "buildkite-plugins", lastSegment(paths[0], u.Fragment))
-
-	case 2:
-		// trimmed path contained one slash
-		return path.Join("github.com", paths[0], lastSegment(paths[1], u.Fragment))
+	return defaultPluginSourceRules.FullSource(p.Source)
+}
 
-	default:
-		// trimmed path contained more than one slash - apply no smarts
-		return p.Source
-	}
+// ShortSource returns Source in the shortest form that FullSource expands to
+// the same full source, for display (see PluginSourceRules.ShortSource).
+func (p *Plugin) ShortSource() string {
+	return defaultPluginSourceRules.ShortSource(p.Source)
 }
 
 func (p *Plugin) interpolate(tf stringTransformer) error {
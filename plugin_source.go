@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// PluginSourceRules are the rules for expanding shorthand plugin sources (such
+// as "docker#v5.10.0" or "my-org/thing") into full sources (such as
+// "github.com/buildkite-plugins/docker-buildkite-plugin#v5.10.0"). See
+// https://buildkite.com/docs/plugins/using#plugin-sources.
+type PluginSourceRules struct {
+	// Host is the host of shorthand sources, such as "github.com".
+	Host string
+
+	// DefaultOrg is the organisation of shorthand sources that don't name
+	// one, such as "buildkite-plugins".
+	DefaultOrg string
+
+	// Suffix is appended to the repository name of shorthand sources, such as
+	// "-buildkite-plugin".
+	Suffix string
+}
+
+// defaultPluginSourceRules are the rules Buildkite applies.
+var defaultPluginSourceRules = PluginSourceRules{
+	Host:       "github.com",
+	DefaultOrg: "buildkite-plugins",
+	Suffix:     "-buildkite-plugin",
+}
+
+// DefaultPluginSourceRules returns the rules Buildkite applies to plugin
+// sources, which are used by Plugin.FullSource and Plugin.ShortSource.
+func DefaultPluginSourceRules() PluginSourceRules {
+	return defaultPluginSourceRules
+}
+
+// FullSource attempts to expand a plugin source according to the rules. If
+// the source isn't shorthand (for example, it is a file path, a URL, or
+// already full), it is returned unaltered:
+//
+//	thing            => github.com/buildkite-plugins/thing-buildkite-plugin
+//	thing#main       => github.com/buildkite-plugins/thing-buildkite-plugin#main
+//	my-org/thing     => github.com/my-org/thing-buildkite-plugin
+//	./plugins/thing  => ./plugins/thing
+func (r PluginSourceRules) FullSource(source string) string {
+	if source == "" {
+		return ""
+	}
+
+	// Looks like an absolute or relative file path.
+	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, `\`) {
+		return source
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return source
+	}
+
+	// They wrote something like ssh://..., https://..., or C:\...
+	// in which case they _mean it_.
+	if u.Scheme != "" || u.Opaque != "" {
+		return source
+	}
+
+	// thing      => thing-buildkite-plugin
+	// thing#main => thing-buildkite-plugin#main
+	lastSegment := func(n, f string) string {
+		n += r.Suffix
+		if f == "" {
+			return n
+		}
+		return n + "#" + f
+	}
+
+	paths := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	switch len(paths) {
+	case 1:
+		// trimmed path contained no slash
+		return path.Join(r.Host, r.DefaultOrg, lastSegment(paths[0], u.Fragment))
+
+	case 2:
+		// trimmed path contained one slash
+		return path.Join(r.Host, paths[0], lastSegment(paths[1], u.Fragment))
+
+	default:
+		// trimmed path contained more than one slash - apply no smarts
+		return source
+	}
+}
+
+// ShortSource is the inverse of FullSource: it returns the shortest form of a
+// plugin source that FullSource expands to the same full source. Sources that
+// can't be shortened (such as file paths, URLs, and sources on other hosts)
+// are returned unaltered:
+//
+//	github.com/buildkite-plugins/thing-buildkite-plugin#main => thing#main
+//	github.com/my-org/thing-buildkite-plugin                 => my-org/thing
+//	github.com/my-org/thing                                  => github.com/my-org/thing
+func (r PluginSourceRules) ShortSource(source string) string {
+	full := r.FullSource(source)
+
+	name, version, _ := strings.Cut(full, "#")
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != r.Host {
+		return source
+	}
+	org, repo := parts[1], parts[2]
+	repo, ok := strings.CutSuffix(repo, r.Suffix)
+	if !ok || repo == "" || org == "" {
+		return source
+	}
+
+	short := org + "/" + repo
+	if org == r.DefaultOrg {
+		short = repo
+	}
+	if version != "" {
+		short += "#" + version
+	}
+
+	// Only use the short form if it really is equivalent.
+	if r.FullSource(short) != full {
+		return source
+	}
+	return short
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import "testing"
+
+func TestPluginShortSource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		source, want string
+	}{
+		{
+			source: "github.com/buildkite-plugins/thing-buildkite-plugin",
+			want:   "thing",
+		},
+		{
+			source: "github.com/buildkite-plugins/thing-buildkite-plugin#v1.2.3",
+			want:   "thing#v1.2.3",
+		},
+		{
+			source: "github.com/my-org/thing-buildkite-plugin#main",
+			want:   "my-org/thing#main",
+		},
+		{
+			source: "thing#main",
+			want:   "thing#main",
+		},
+		{
+			source: "my-org/thing",
+			want:   "my-org/thing",
+		},
+		{
+			source: "github.com/my-org/thing",
+			want:   "github.com/my-org/thing",
+		},
+		{
+			source: "gitlab.com/my-org/thing-buildkite-plugin",
+			want:   "gitlab.com/my-org/thing-buildkite-plugin",
+		},
+		{
+			source: "github.com/my-org/-buildkite-plugin",
+			want:   "github.com/my-org/-buildkite-plugin",
+		},
+		{
+			source: "./.buildkite/plugins/thing",
+			want:   "./.buildkite/plugins/thing",
+		},
+		{
+			source: "https://github.com/buildkite-plugins/thing-buildkite-plugin",
+			want:   "https://github.com/buildkite-plugins/thing-buildkite-plugin",
+		},
+		{
+			source: "git@github.com:buildkite/private-buildkite-plugin.git",
+			want:   "git@github.com:buildkite/private-buildkite-plugin.git",
+		},
+	}
+
+	for _, test := range tests {
+		p := Plugin{Source: test.source}
+		got := p.ShortSource()
+		if got != test.want {
+			t.Errorf("%#v.ShortSource() = %q, want %q", p, got, test.want)
+		}
+
+		// The short form must be equivalent to the original.
+		short := Plugin{Source: got}
+		if got, want := short.FullSource(), p.FullSource(); got != want {
+			t.Errorf("FullSource of short form %q = %q, want %q", short.Source, got, want)
+		}
+	}
+}
+
+func TestPluginSourceRules_Custom(t *testing.T) {
+	t.Parallel()
+
+	rules := PluginSourceRules{
+		Host:       "git.example.com",
+		DefaultOrg: "plugins",
+		Suffix:     "-plugin",
+	}
+	if got, want := rules.FullSource("thing#v1"), "git.example.com/plugins/thing-plugin#v1"; got != want {
+		t.Errorf("rules.FullSource(thing#v1) = %q, want %q", got, want)
+	}
+	if got, want := rules.ShortSource("git.example.com/team/thing-plugin"), "team/thing"; got != want {
+		t.Errorf("rules.ShortSource(git.example.com/team/thing-plugin) = %q, want %q", got, want)
+	}
+
+	// Changing a copy of the defaults doesn't change the defaults.
+	def := DefaultPluginSourceRules()
+	def.Host = "example.com"
+	if got, want := (&Plugin{Source: "thing"}).FullSource(), "github.com/buildkite-plugins/thing-buildkite-plugin"; got != want {
+		t.Errorf("Plugin.FullSource() = %q, want %q", got, want)
+	}
+}
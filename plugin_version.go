@@ -0,0 +1,66 @@
+package pipeline
+
+import "strings"
+
+// Version returns the version the plugin is pinned to (the part of Source
+// after "#"), or "" if it isn't pinned.
+func (p *Plugin) Version() string {
+	_, version, _ := strings.Cut(p.Source, "#")
+	return version
+}
+
+// SetVersion pins the plugin to the version, keeping the rest of Source as it
+// was written (so "docker#v5.0.0" becomes "docker#v5.9.0"). An empty version
+// removes the pin.
+func (p *Plugin) SetVersion(version string) {
+	name, _, _ := strings.Cut(p.Source, "#")
+	if version != "" {
+		name += "#" + version
+	}
+	p.Source = name
+}
+
+// Matches reports whether the plugin is the one named by name, which can be
+// written in any form that FullSource expands to the same plugin: "docker",
+// "buildkite-plugins/docker", and
+// "github.com/buildkite-plugins/docker-buildkite-plugin" all match a plugin
+// with the source "docker#v5.0.0". If name includes a version (such as
+// "docker#v5.0.0"), only plugins pinned to that version match.
+func (p *Plugin) Matches(name string) bool {
+	want, wantVersion, pinned := strings.Cut(defaultPluginSourceRules.FullSource(name), "#")
+	got, gotVersion, _ := strings.Cut(p.FullSource(), "#")
+	return got == want && (!pinned || gotVersion == wantVersion)
+}
+
+// Find returns the plugins that match name (see Plugin.Matches), in order.
+func (ps Plugins) Find(name string) []*Plugin {
+	var out []*Plugin
+	for _, p := range ps {
+		if p != nil && p.Matches(name) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// SetVersion pins each plugin that matches name (see Plugin.Matches) to the
+// version (see Plugin.SetVersion), and returns how many there were. The
+// config and order of the plugins are unchanged.
+func (ps Plugins) SetVersion(name, version string) int {
+	found := ps.Find(name)
+	for _, p := range found {
+		p.SetVersion(version)
+	}
+	return len(found)
+}
+
+// SetPluginVersion pins each plugin that matches name in the command steps of
+// the pipeline (including those within group steps) to the version (see
+// Plugins.SetVersion), and returns how many there were.
+func (p *Pipeline) SetPluginVersion(name, version string) int {
+	n := 0
+	p.Steps.walkCommandSteps(func(c *CommandStep) {
+		n += c.Plugins.SetVersion(name, version)
+	})
+	return n
+}
@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPluginMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		source, name string
+		want         bool
+	}{
+		{source: "docker#v5.0.0", name: "docker", want: true},
+		{source: "docker#v5.0.0", name: "buildkite-plugins/docker", want: true},
+		{source: "docker#v5.0.0", name: "github.com/buildkite-plugins/docker-buildkite-plugin", want: true},
+		{source: "docker#v5.0.0", name: "docker#v5.0.0", want: true},
+		{source: "docker#v5.0.0", name: "docker#v4.0.0", want: false},
+		{source: "docker", name: "docker#v5.0.0", want: false},
+		{source: "docker-compose#v4.0.0", name: "docker", want: false},
+		{source: "my-org/docker#v1", name: "docker", want: false},
+		{source: "github.com/my-org/docker-buildkite-plugin#v1", name: "my-org/docker", want: true},
+		{source: "./plugins/local", name: "./plugins/local", want: true},
+	}
+	for _, test := range tests {
+		p := &Plugin{Source: test.source}
+		if got := p.Matches(test.name); got != test.want {
+			t.Errorf("(&Plugin{Source: %q}).Matches(%q) = %t, want %t", test.source, test.name, got, test.want)
+		}
+	}
+}
+
+func TestPluginSetVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		source, version, want string
+	}{
+		{source: "docker#v5.0.0", version: "v5.9.0", want: "docker#v5.9.0"},
+		{source: "docker", version: "v5.9.0", want: "docker#v5.9.0"},
+		{source: "github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0", version: "v5.9.0", want: "github.com/buildkite-plugins/docker-buildkite-plugin#v5.9.0"},
+		{source: "docker#v5.0.0", version: "", want: "docker"},
+	}
+	for _, test := range tests {
+		p := &Plugin{Source: test.source}
+		p.SetVersion(test.version)
+		if p.Source != test.want {
+			t.Errorf("after SetVersion(%q), Source = %q, want %q", test.version, p.Source, test.want)
+		}
+		if got := p.Version(); got != test.version {
+			t.Errorf("after SetVersion(%q), Version() = %q, want %q", test.version, got, test.version)
+		}
+	}
+}
+
+func TestPipelineSetPluginVersion(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+steps:
+  - command: make
+    plugins:
+      - docker#v5.0.0:
+          image: golang
+      - docker-compose#v4.0.0:
+          run: app
+  - group: More
+    steps:
+      - command: make more
+        plugins:
+          - github.com/buildkite-plugins/docker-buildkite-plugin#v5.1.0: ~
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got, want := p.SetPluginVersion("docker", "v5.9.0"), 2; got != want {
+		t.Errorf("p.SetPluginVersion(docker, v5.9.0) = %d, want %d", got, want)
+	}
+	if got, want := p.SetPluginVersion("teleport", "v1"), 0; got != want {
+		t.Errorf("p.SetPluginVersion(teleport, v1) = %d, want %d", got, want)
+	}
+
+	got, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p) error = %v", err)
+	}
+	want := `steps:
+    - command: make
+      plugins:
+        - github.com/buildkite-plugins/docker-buildkite-plugin#v5.9.0:
+            image: golang
+        - github.com/buildkite-plugins/docker-compose-buildkite-plugin#v4.0.0:
+            run: app
+    - group: More
+      steps:
+        - command: make more
+          plugins:
+            - github.com/buildkite-plugins/docker-buildkite-plugin#v5.9.0: null
+`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("yaml.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+}
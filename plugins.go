@@ -24,11 +24,18 @@ type Plugins []*Plugin
 // But some people (even us) write plugins into one big mapping and rely on
 // order preservation.
 func (p *Plugins) UnmarshalOrdered(o any) error {
+	return p.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+// Plugin configuration is kept as it is written, so no options currently
+// apply.
+func (p *Plugins) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
 	// Whether processing one big map, or a sequence of small maps, the central
 	// part remains the same.
 	// Parse each "key: value" as "name: config", then append in order.
 	unmarshalMap := func(m *ordered.MapSA) error {
-		return m.Range(func(k string, v any) error {
+		for k, v := range m.All() {
 			// ToMapRecursive demolishes any ordering within the plugin config.
 			// This is needed because the backend likes to reorder the keys,
 			// and for signing we need the JSON form to be stable.
@@ -37,8 +44,8 @@ func (p *Plugins) UnmarshalOrdered(o any) error {
 				Config: ordered.ToMapRecursive(v),
 			}
 			*p = append(*p, plugin)
-			return nil
-		})
+		}
+		return nil
 	}
 
 	switch o := o.(type) {
@@ -0,0 +1,16 @@
+// Package policy checks pipelines against organisational policies, such as
+// which plugins may be used, or that every command step has a timeout.
+//
+// A policy is a set of rules (see Rule), combined with Policy. Checking a
+// parsed pipeline against it returns structured violations, locating the
+// step (and plugin) that breaks each rule:
+//
+//	pol := policy.Policy{
+//		policy.RequireQueue(),
+//		policy.RequireTimeout(60),
+//		policy.ForbidCommands(regexp.MustCompile(`curl .* \| *(ba)?sh`)),
+//	}
+//	for _, v := range pol.Check(p) {
+//		fmt.Println(v)
+//	}
+package policy
@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// PluginRule matches plugins by source and (optionally) version.
+type PluginRule struct {
+	// Source is a pattern matched against the full source of each plugin
+	// (see pipeline.Plugin.FullSource) without its version, using path.Match.
+	// Shorthand is expanded first, so "docker" and
+	// "github.com/buildkite-plugins/docker-buildkite-plugin" are the same
+	// rule, and "my-org/*" matches every plugin in the my-org organisation.
+	Source string `yaml:"source" json:"source"`
+
+	// Version, if set, constrains the versions the rule matches. It is a
+	// comma-separated list of constraints that must all hold: comparisons
+	// with semantic versions (such as ">= v5.0.0, < v6"), or glob patterns
+	// (such as "v5.*"). Unpinned plugins and versions that aren't semantic
+	// versions (such as branch names) only match globs.
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+}
+
+// String returns the rule as it might be written, such as "docker >= v5".
+func (r PluginRule) String() string {
+	if r.Version == "" {
+		return r.Source
+	}
+	return r.Source + " " + r.Version
+}
+
+// PluginPolicy restricts which plugins a pipeline can use.
+//
+//	allow:
+//	  - source: docker
+//	    version: ">= v5.0.0"
+//	  - source: my-org/*
+//	deny:
+//	  - source: my-org/legacy
+//	require_pinned: true
+type PluginPolicy struct {
+	// Allow lists the plugins that may be used. If it is empty, all plugins
+	// may be used (unless denied). Otherwise, each plugin must match at least
+	// one rule.
+	Allow []PluginRule `yaml:"allow,omitempty" json:"allow,omitempty"`
+
+	// Deny lists plugins that may not be used, even if they are allowed.
+	Deny []PluginRule `yaml:"deny,omitempty" json:"deny,omitempty"`
+
+	// RequirePinned requires every plugin to be pinned to a version.
+	RequirePinned bool `yaml:"require_pinned,omitempty" json:"require_pinned,omitempty"`
+}
+
+// ErrInvalidPolicy is returned (wrapped) when a policy can't be used.
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// LoadPluginPolicy reads a plugin policy in YAML (or JSON) from src, and
+// checks it (see PluginPolicy.Validate). Unknown fields are an error.
+func LoadPluginPolicy(src io.Reader) (*PluginPolicy, error) {
+	dec := yaml.NewDecoder(src)
+	dec.KnownFields(true)
+	pp := new(PluginPolicy)
+	if err := dec.Decode(pp); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if err := pp.Validate(); err != nil {
+		return nil, err
+	}
+	return pp, nil
+}
+
+// Validate checks that the rules of the policy are well-formed. Malformed
+// rules never match.
+func (pp *PluginPolicy) Validate() error {
+	for _, r := range append(append([]PluginRule(nil), pp.Allow...), pp.Deny...) {
+		if r.Source == "" {
+			return fmt.Errorf("%w: rule %q has no source", ErrInvalidPolicy, r)
+		}
+		if _, err := path.Match(r.Source, ""); err != nil {
+			return fmt.Errorf("%w: rule %q: %v", ErrInvalidPolicy, r, err)
+		}
+		if r.Version == "" {
+			continue
+		}
+		if _, err := parseConstraints(r.Version); err != nil {
+			return fmt.Errorf("%w: rule %q: %v", ErrInvalidPolicy, r, err)
+		}
+	}
+	return nil
+}
+
+// Reasons a plugin can violate a PluginPolicy.
+var (
+	ErrPluginDenied     = errors.New("plugin is denied")
+	ErrPluginNotAllowed = errors.New("plugin is not allowed")
+	ErrPluginNotPinned  = errors.New("plugin is not pinned to a version")
+)
+
+// Name returns "plugins".
+func (pp *PluginPolicy) Name() string { return "plugins" }
+
+// Check checks every plugin in the command steps of the pipeline (including
+// those within group steps) against the policy, and returns the violations in
+// pipeline order. A plugin can have more than one violation (for example, it
+// can be both denied and unpinned). Each violation wraps one of
+// ErrPluginDenied, ErrPluginNotAllowed, or ErrPluginNotPinned.
+//
+// Steps that couldn't be parsed (see pipeline.UnknownStep) are violations
+// wrapping ErrUnknownStep, since Buildkite may still run them; any plugins
+// that can be found in them are checked as well.
+func (pp *PluginPolicy) Check(p *pipeline.Pipeline) []*Violation {
+	var vs []*Violation
+	for sp, s := range p.AllSteps() {
+		var plugins pipeline.Plugins
+		switch s := s.(type) {
+		case *pipeline.CommandStep:
+			if s == nil {
+				continue
+			}
+			plugins = s.Plugins
+
+		case *pipeline.UnknownStep:
+			vs = append(vs, &Violation{
+				Rule: pp.Name(),
+				Path: sp.String(),
+				Step: s,
+				Err:  ErrUnknownStep,
+			})
+			plugins = unknownStepPlugins(s)
+
+		default:
+			continue
+		}
+		for i, pl := range plugins {
+			if pl == nil {
+				continue
+			}
+			for _, err := range pp.checkPlugin(pl) {
+				vs = append(vs, &Violation{
+					Rule:   pp.Name(),
+					Path:   fmt.Sprintf("%s.plugins[%d]", sp, i),
+					Step:   s,
+					Plugin: pl,
+					Err:    fmt.Errorf("%s: %w", pl.Source, err),
+				})
+			}
+		}
+	}
+	return vs
+}
+
+// unknownStepPlugins returns the plugins of a step that couldn't be parsed,
+// if its plugins can be.
+func unknownStepPlugins(u *pipeline.UnknownStep) pipeline.Plugins {
+	contents, ok := u.Contents.(interface{ Get(string) (any, bool) })
+	if !ok {
+		return nil
+	}
+	src, ok := contents.Get("plugins")
+	if !ok {
+		return nil
+	}
+	var plugins pipeline.Plugins
+	if err := plugins.UnmarshalOrdered(src); err != nil {
+		return nil
+	}
+	return plugins
+}
+
+// checkPlugin returns the reasons the plugin violates the policy.
+func (pp *PluginPolicy) checkPlugin(pl *pipeline.Plugin) []error {
+	var errs []error
+	if r := firstMatch(pp.Deny, pl); r != nil {
+		errs = append(errs, fmt.Errorf("%w by rule %q", ErrPluginDenied, r))
+	} else if len(pp.Allow) > 0 && firstMatch(pp.Allow, pl) == nil {
+		errs = append(errs, ErrPluginNotAllowed)
+	}
+	if pp.RequirePinned && pl.Version() == "" {
+		errs = append(errs, ErrPluginNotPinned)
+	}
+	return errs
+}
+
+// firstMatch returns the first rule matching the plugin, or nil.
+func firstMatch(rules []PluginRule, pl *pipeline.Plugin) *PluginRule {
+	src, version, _ := strings.Cut(pl.FullSource(), "#")
+	for i, r := range rules {
+		pat, _, _ := strings.Cut(pipeline.DefaultPluginSourceRules().FullSource(r.Source), "#")
+		if ok, _ := path.Match(pat, src); !ok {
+			continue
+		}
+		if r.Version != "" {
+			cs, err := parseConstraints(r.Version)
+			if err != nil {
+				continue
+			}
+			if !satisfiesAll(cs, version) {
+				continue
+			}
+		}
+		return &rules[i]
+	}
+	return nil
+}
+
+// satisfiesAll reports whether the version satisfies every constraint.
+func satisfiesAll(cs []constraint, version string) bool {
+	for _, c := range cs {
+		if !c.satisfiedBy(version) {
+			return false
+		}
+	}
+	return true
+}
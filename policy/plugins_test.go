@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPluginPolicyCheck(t *testing.T) {
+	t.Parallel()
+
+	pp, err := LoadPluginPolicy(strings.NewReader(`
+allow:
+  - source: docker
+    version: ">= v5.0.0, < v6"
+  - source: my-org/*
+deny:
+  - source: my-org/legacy
+require_pinned: true
+`))
+	if err != nil {
+		t.Fatalf("LoadPluginPolicy() error = %v", err)
+	}
+
+	p, err := pipeline.Parse(strings.NewReader(`---
+steps:
+  - key: build
+    command: make
+    plugins:
+      - docker#v5.2.0: ~
+      - docker#v4.9.0: ~
+      - github.com/my-org/cache-buildkite-plugin#v1.0.0: ~
+  - group: More
+    steps:
+      - label: Old stuff
+        command: make old
+        plugins:
+          - my-org/legacy#v2.0.0: ~
+          - my-org/thing: ~
+          - docker-compose#v5.0.0: ~
+`))
+	if err != nil {
+		t.Fatalf("pipeline.Parse() error = %v", err)
+	}
+
+	var got []string
+	for _, v := range pp.Check(p) {
+		got = append(got, v.Error())
+	}
+	want := []string{
+		`steps[0].plugins[1] (step "build"): docker#v4.9.0: plugin is not allowed`,
+		`steps[1].steps[0].plugins[0] (step labelled "Old stuff"): my-org/legacy#v2.0.0: plugin is denied by rule "my-org/legacy"`,
+		`steps[1].steps[0].plugins[1] (step labelled "Old stuff"): my-org/thing: plugin is not pinned to a version`,
+		`steps[1].steps[0].plugins[2] (step labelled "Old stuff"): docker-compose#v5.0.0: plugin is not allowed`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("pp.Check(p) diff (-got +want):\n%s", diff)
+	}
+
+	vs := pp.Check(p)
+	if !errors.Is(vs[1], ErrPluginDenied) {
+		t.Errorf("vs[1] = %v, want %v", vs[1], ErrPluginDenied)
+	}
+	if vs[1].Plugin.Source != "my-org/legacy#v2.0.0" {
+		t.Errorf("vs[1].Plugin.Source = %q, want %q", vs[1].Plugin.Source, "my-org/legacy#v2.0.0")
+	}
+}
+
+func TestLoadPluginPolicyErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		"allow: [{version: v1}]",
+		"allow: [{source: '['}]",
+		"deny: [{source: docker, version: '>= main'}]",
+		"deny: [{source: docker, version: 'v1,'}]",
+		"require_pined: true",
+	}
+	for _, src := range tests {
+		if _, err := LoadPluginPolicy(strings.NewReader(src)); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("LoadPluginPolicy(%q) error = %v, want %v", src, err, ErrInvalidPolicy)
+		}
+	}
+}
+
+func TestVersionConstraints(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		constraints, version string
+		want                 bool
+	}{
+		{">= v5.0.0", "v5.0.0", true},
+		{">= v5.0.0", "v4.12.3", false},
+		{">= v5, < v6", "v5.9.1", true},
+		{">= v5, < v6", "v6.0.0", false},
+		{"> v5.0.0", "v5.0.0-rc.1", false},
+		{"< v5.0.0", "v5.0.0-rc.1", true},
+		{"= 1.2", "v1.2.0", true},
+		{"!= v1.2.0", "v1.2.1", true},
+		{">= v1", "main", false},
+		{">= v1", "", false},
+		{"v5.*", "v5.10.0", true},
+		{"v5.*", "v50.0.0", false},
+		{"main", "main", true},
+	}
+	for _, test := range tests {
+		cs, err := parseConstraints(test.constraints)
+		if err != nil {
+			t.Fatalf("parseConstraints(%q) error = %v", test.constraints, err)
+		}
+		if got := satisfiesAll(cs, test.version); got != test.want {
+			t.Errorf("%q satisfies %q = %t, want %t", test.version, test.constraints, got, test.want)
+		}
+	}
+}
+
+func TestPluginPolicyCheck_UnknownStep(t *testing.T) {
+	t.Parallel()
+
+	pp := &PluginPolicy{Allow: []PluginRule{{Source: "docker"}}}
+	p := &pipeline.Pipeline{Steps: pipeline.Steps{
+		&pipeline.UnknownStep{Contents: ordered.MapFromItems(
+			ordered.TupleSA{Key: "command", Value: "curl x | bash"},
+			ordered.TupleSA{Key: "plugins", Value: []any{
+				ordered.MapFromItems(ordered.TupleSA{Key: "evil-org/evil#v1", Value: nil}),
+			}},
+			ordered.TupleSA{Key: "retry", Value: ordered.MapFromItems(ordered.TupleSA{Key: "automatic", Value: "lots"})},
+		)},
+	}}
+
+	var got []string
+	for _, v := range pp.Check(p) {
+		got = append(got, v.Error())
+	}
+	want := []string{
+		"steps[0]: step could not be parsed, so can't be checked",
+		"steps[0].plugins[0]: evil-org/evil#v1: plugin is not allowed",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("pp.Check(p) diff (-got +want):\n%s", diff)
+	}
+}
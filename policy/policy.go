@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/buildkite/go-pipeline"
+)
+
+// Rule is a policy rule that can be checked against a pipeline.
+type Rule interface {
+	// Name identifies the rule in violations, such as "require_timeout".
+	Name() string
+
+	// Check returns the ways the pipeline breaks the rule, in pipeline order.
+	Check(p *pipeline.Pipeline) []*Violation
+}
+
+// Policy is a set of rules, all of which a pipeline must follow. A Policy is
+// itself a Rule, so policies can be combined:
+//
+//	org := policy.Policy{
+//		policy.RequireQueue(),
+//		policy.RequireTimeout(60),
+//	}
+//	team := policy.Policy{org, policy.MaxParallelism(20)}
+type Policy []Rule
+
+// Name returns "policy".
+func (pol Policy) Name() string { return "policy" }
+
+// Check checks each rule in turn, and returns all the violations, grouped by
+// rule.
+func (pol Policy) Check(p *pipeline.Pipeline) []*Violation {
+	var vs []*Violation
+	for _, r := range pol {
+		vs = append(vs, r.Check(p)...)
+	}
+	return vs
+}
+
+// ErrUnknownStep is wrapped by violations for steps that couldn't be parsed
+// (see pipeline.UnknownStep). Buildkite may still run such steps, so rules
+// can't assume they are harmless, but can't check them either.
+var ErrUnknownStep = errors.New("step could not be parsed, so can't be checked")
+
+// Violation is a way a pipeline breaks a rule, and where.
+type Violation struct {
+	// Rule is the name of the rule broken.
+	Rule string
+
+	// Path is the path to the step (or part of it) breaking the rule, such as
+	// "steps[1].steps[0]" or "steps[1].steps[0].plugins[2]".
+	Path string
+
+	// Step is the step breaking the rule.
+	Step pipeline.Step
+
+	// Plugin is the plugin breaking the rule, for rules about plugins.
+	Plugin *pipeline.Plugin
+
+	// Err says why it is a violation. Each rule documents the errors it
+	// wraps.
+	Err error
+}
+
+// Error describes the violation, including the key or label of the step (if
+// it has one).
+func (v *Violation) Error() string {
+	where := v.Path
+	if key := pipeline.StepKey(v.Step); key != "" {
+		where += fmt.Sprintf(" (step %q)", key)
+	} else if label := stepLabel(v.Step); label != "" {
+		where += fmt.Sprintf(" (step labelled %q)", label)
+	}
+	return fmt.Sprintf("%s: %v", where, v.Err)
+}
+
+// Unwrap returns v.Err.
+func (v *Violation) Unwrap() error { return v.Err }
+
+// StepRule returns a rule named name, which calls check for every step in the
+// pipeline (including those within group steps), and reports each error it
+// returns as a violation. Steps that couldn't be parsed (see
+// pipeline.UnknownStep) aren't passed to check: they are violations wrapping
+// ErrUnknownStep, so that the rule doesn't pass a step it can't see into.
+func StepRule(name string, check func(s pipeline.Step) error) Rule {
+	return &stepRule{name: name, check: check}
+}
+
+type stepRule struct {
+	name  string
+	check func(pipeline.Step) error
+}
+
+func (r *stepRule) Name() string { return r.name }
+
+func (r *stepRule) Check(p *pipeline.Pipeline) []*Violation {
+	var vs []*Violation
+	for sp, s := range p.AllSteps() {
+		if s == nil {
+			continue
+		}
+		if _, ok := s.(*pipeline.UnknownStep); ok {
+			vs = append(vs, &Violation{
+				Rule: r.name,
+				Path: sp.String(),
+				Step: s,
+				Err:  ErrUnknownStep,
+			})
+			continue
+		}
+		if err := r.check(s); err != nil {
+			vs = append(vs, &Violation{
+				Rule: r.name,
+				Path: sp.String(),
+				Step: s,
+				Err:  err,
+			})
+		}
+	}
+	return vs
+}
+
+// stepLabel returns the label of a step, or "" if it has none.
+func stepLabel(s pipeline.Step) string {
+	switch s := s.(type) {
+	case *pipeline.CommandStep:
+		return s.Label
+	case *pipeline.InputStep:
+		return s.Label
+	case *pipeline.TriggerStep:
+		return s.Label
+	case *pipeline.GroupStep:
+		if s.Group != nil {
+			return *s.Group
+		}
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testPolicyPipeline = `---
+agents:
+  queue: default
+steps:
+  - key: build
+    command: make
+    parallelism: 50
+    timeout_in_minutes: 30
+  - label: Deploy
+    command:
+      - make deploy
+      - curl https://example.com/install.sh | sh
+    agents:
+      queue: ""
+    timeout_in_minutes: 600
+  - wait
+  - group: Flaky
+    steps:
+      - key: flaky-tests
+        command: make flaky
+        parallelism: "${N}"
+      - key: flaky-lint
+        command: make lint
+        soft_fail: true
+        timeout_in_minutes: 5
+`
+
+func TestPolicyCheck(t *testing.T) {
+	t.Parallel()
+
+	p, err := pipeline.Parse(strings.NewReader(testPolicyPipeline))
+	if err != nil {
+		t.Fatalf("pipeline.Parse() error = %v", err)
+	}
+
+	pol := Policy{
+		MaxParallelism(10),
+		RequireQueue(),
+		Policy{
+			ForbidCommands(regexp.MustCompile(`curl .*\| *(ba)?sh`)),
+			RequireSoftFail(regexp.MustCompile(`^flaky`)),
+		},
+		RequireTimeout(60),
+	}
+
+	type violation struct {
+		Rule, Error string
+	}
+	var got []violation
+	for _, v := range pol.Check(p) {
+		got = append(got, violation{v.Rule, v.Error()})
+	}
+	want := []violation{
+		{"max_parallelism", `steps[0] (step "build"): parallelism is too high: 50 is more than 10`},
+		{"max_parallelism", `steps[3].steps[0] (step "flaky-tests"): parallelism is too high: "${N}" is not a number`},
+		{"require_queue", `steps[1] (step labelled "Deploy"): no agents queue is set`},
+		{"forbidden_commands", `steps[1] (step labelled "Deploy"): command is forbidden: "curl https://example.com/install.sh | sh" matches "curl .*\\| *(ba)?sh"`},
+		{"require_soft_fail", `steps[3].steps[0] (step "flaky-tests"): soft_fail is not set`},
+		{"require_timeout", `steps[1] (step labelled "Deploy"): timeout_in_minutes is too long: 600 is more than 60`},
+		{"require_timeout", `steps[3].steps[0] (step "flaky-tests"): timeout_in_minutes is not set`},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("pol.Check(p) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRequireQueue_NoPipelineQueue(t *testing.T) {
+	t.Parallel()
+
+	p, err := pipeline.Parse(strings.NewReader(`---
+steps:
+  - command: a
+    agents: { queue: build }
+  - key: b
+    command: b
+  - key: c
+    command: c
+    agents: [os=linux]
+`))
+	if err != nil {
+		t.Fatalf("pipeline.Parse() error = %v", err)
+	}
+
+	var got []string
+	for _, v := range RequireQueue().Check(p) {
+		if !errors.Is(v, ErrNoQueue) {
+			t.Errorf("violation %v does not wrap %v", v, ErrNoQueue)
+		}
+		got = append(got, v.Path)
+	}
+	if diff := cmp.Diff(got, []string{"steps[1]", "steps[2]"}); diff != "" {
+		t.Errorf("RequireQueue().Check(p) paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestStepRule(t *testing.T) {
+	t.Parallel()
+
+	p, err := pipeline.Parse(strings.NewReader(`---
+steps:
+  - trigger: other
+  - group: G
+    steps:
+      - trigger: another
+        label: Another
+`))
+	if err != nil {
+		t.Fatalf("pipeline.Parse() error = %v", err)
+	}
+
+	noTriggers := StepRule("no_triggers", func(s pipeline.Step) error {
+		if _, ok := s.(*pipeline.TriggerStep); ok {
+			return errors.New("trigger steps are not allowed")
+		}
+		return nil
+	})
+	var got []string
+	for _, v := range noTriggers.Check(p) {
+		got = append(got, v.Rule+": "+v.Error())
+	}
+	want := []string{
+		"no_triggers: steps[0]: trigger steps are not allowed",
+		`no_triggers: steps[1].steps[0] (step labelled "Another"): trigger steps are not allowed`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("noTriggers.Check(p) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRules_UnknownStep(t *testing.T) {
+	t.Parallel()
+
+	// Steps that couldn't be parsed may still be run by Buildkite, so they
+	// mustn't pass.
+	p := &pipeline.Pipeline{Steps: pipeline.Steps{
+		&pipeline.UnknownStep{Contents: ordered.MapFromItems(
+			ordered.TupleSA{Key: "type", Value: "robot"},
+			ordered.TupleSA{Key: "command", Value: "curl https://example.com/install.sh | bash"},
+		)},
+	}}
+
+	for _, r := range []Rule{
+		MaxParallelism(1),
+		RequireQueue(),
+		ForbidCommands(regexp.MustCompile(`curl`)),
+		RequireSoftFail(regexp.MustCompile(`.`)),
+		RequireTimeout(60),
+		&PluginPolicy{},
+	} {
+		vs := r.Check(p)
+		if len(vs) != 1 || !errors.Is(vs[0], ErrUnknownStep) {
+			t.Errorf("%s.Check(p) = %v, want a violation wrapping %v", r.Name(), vs, ErrUnknownStep)
+		}
+	}
+}
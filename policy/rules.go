@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/buildkite/go-pipeline"
+)
+
+// Errors wrapped by the violations of the rules in this file.
+var (
+	ErrParallelismTooHigh = errors.New("parallelism is too high")
+	ErrNoQueue            = errors.New("no agents queue is set")
+	ErrForbiddenCommand   = errors.New("command is forbidden")
+	ErrNoSoftFail         = errors.New("soft_fail is not set")
+	ErrNoTimeout          = errors.New("timeout_in_minutes is not set")
+	ErrTimeoutTooLong     = errors.New("timeout_in_minutes is too long")
+)
+
+// MaxParallelism returns a rule (named "max_parallelism") that command steps
+// have a parallelism of at most max. Violations wrap ErrParallelismTooHigh.
+func MaxParallelism(max int) Rule {
+	return StepRule("max_parallelism", func(s pipeline.Step) error {
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok || c.Parallelism == nil {
+			return nil
+		}
+		n, ok := c.Parallelism.Get()
+		if !ok {
+			return fmt.Errorf("%w: %q is not a number", ErrParallelismTooHigh, c.Parallelism)
+		}
+		if n > max {
+			return fmt.Errorf("%w: %d is more than %d", ErrParallelismTooHigh, n, max)
+		}
+		return nil
+	})
+}
+
+// RequireQueue returns a rule (named "require_queue") that command steps run
+// on a specific queue: either the step or the pipeline (in its top-level
+// agents) must set agents.queue. Violations wrap ErrNoQueue.
+func RequireQueue() Rule {
+	return requireQueue{}
+}
+
+type requireQueue struct{}
+
+func (requireQueue) Name() string { return "require_queue" }
+
+func (r requireQueue) Check(p *pipeline.Pipeline) []*Violation {
+	// Steps without a queue of their own use the pipeline's.
+	inherited := false
+	if v, has := p.RemainingFields["agents"]; has {
+		a := new(pipeline.Agents)
+		inherited = a.UnmarshalOrdered(v) == nil && hasQueue(a)
+	}
+	return StepRule(r.Name(), func(s pipeline.Step) error {
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok || hasQueue(c.Agents) {
+			return nil
+		}
+		if _, set := c.Agents.Get("queue"); inherited && !set {
+			return nil
+		}
+		return ErrNoQueue
+	}).Check(p)
+}
+
+// hasQueue reports whether the agents set a non-empty queue.
+func hasQueue(a *pipeline.Agents) bool {
+	q, _ := a.Get("queue")
+	return q != ""
+}
+
+// ForbidCommands returns a rule (named "forbidden_commands") that no command in
+// a command step matches re. Each command of a step (see
+// pipeline.CommandStep.Commands) is matched separately, and only the first
+// match in each step is reported. Violations wrap ErrForbiddenCommand.
+func ForbidCommands(re *regexp.Regexp) Rule {
+	return StepRule("forbidden_commands", func(s pipeline.Step) error {
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok {
+			return nil
+		}
+		for _, cmd := range c.Commands() {
+			if re.MatchString(cmd) {
+				return fmt.Errorf("%w: %q matches %q", ErrForbiddenCommand, cmd, re)
+			}
+		}
+		return nil
+	})
+}
+
+// RequireSoftFail returns a rule (named "require_soft_fail") that command
+// steps whose key or label matches re set soft_fail (to true, or to some exit
+// statuses). Violations wrap ErrNoSoftFail.
+func RequireSoftFail(re *regexp.Regexp) Rule {
+	return StepRule("require_soft_fail", func(s pipeline.Step) error {
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok || !(re.MatchString(c.Key) || re.MatchString(c.Label)) {
+			return nil
+		}
+		if c.SoftFail == nil || !c.SoftFail.All && len(c.SoftFail.Rules) == 0 {
+			return ErrNoSoftFail
+		}
+		return nil
+	})
+}
+
+// RequireTimeout returns a rule (named "require_timeout") that command steps
+// set timeout_in_minutes, to at most max minutes if max is positive.
+// Violations wrap ErrNoTimeout or ErrTimeoutTooLong.
+func RequireTimeout(max int) Rule {
+	return StepRule("require_timeout", func(s pipeline.Step) error {
+		c, ok := s.(*pipeline.CommandStep)
+		if !ok {
+			return nil
+		}
+		if c.TimeoutInMinutes == nil {
+			return ErrNoTimeout
+		}
+		n, ok := c.TimeoutInMinutes.Get()
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: %q is not a number", ErrNoTimeout, c.TimeoutInMinutes)
+		case n <= 0:
+			// Zero (or less) means no timeout.
+			return fmt.Errorf("%w: %d is not a timeout", ErrNoTimeout, n)
+		case max > 0 && n > max:
+			return fmt.Errorf("%w: %d is more than %d", ErrTimeoutTooLong, n, max)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// constraint is one comparison in a version constraint.
+type constraint struct {
+	op      string // "=", "!=", "<", "<=", ">", ">=", or "glob"
+	version string
+}
+
+// parseConstraints parses a comma-separated list of version constraints, all
+// of which must be satisfied. Each is a comparison with a semantic version
+// (such as ">= v5.0.0" or "< 6"), or else a glob pattern (such as "v5.*" or
+// "v5.2.1").
+func parseConstraints(s string) ([]constraint, error) {
+	var cs []constraint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, errors.New("empty version constraint")
+		}
+		c := constraint{op: "glob", version: part}
+		for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if v, ok := strings.CutPrefix(part, op); ok {
+				c = constraint{op: op, version: strings.TrimSpace(v)}
+				break
+			}
+		}
+		if c.op == "glob" {
+			if _, err := path.Match(c.version, ""); err != nil {
+				return nil, fmt.Errorf("version pattern %q: %w", c.version, err)
+			}
+		} else if _, ok := parseSemver(c.version); !ok {
+			return nil, fmt.Errorf("%q is not a semantic version", c.version)
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// satisfiedBy reports whether the version satisfies the constraint. Versions
+// that aren't semantic versions (such as branch names) only satisfy globs.
+func (c constraint) satisfiedBy(version string) bool {
+	if c.op == "glob" {
+		ok, _ := path.Match(c.version, version)
+		return ok
+	}
+	got, ok := parseSemver(version)
+	if !ok {
+		return false
+	}
+	want, _ := parseSemver(c.version)
+	cmp := got.compare(want)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// semver is a parsed semantic version. Missing minor and patch numbers are 0.
+type semver struct {
+	nums [3]int
+	pre  string
+}
+
+// parseSemver parses versions such as "v5", "5.2", "v5.2.1", and
+// "v5.2.1-beta.1". Build metadata ("+...") is ignored.
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, v.pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p[0] == '+' {
+			return v, false
+		}
+		v.nums[i] = n
+	}
+	return v, true
+}
+
+// compare returns -1, 0, or 1 as v is less than, equal to, or greater than w.
+// Pre-releases are less than the release, and are compared as strings.
+func (v semver) compare(w semver) int {
+	for i := range v.nums {
+		switch {
+		case v.nums[i] < w.nums[i]:
+			return -1
+		case v.nums[i] > w.nums[i]:
+			return 1
+		}
+	}
+	switch {
+	case v.pre == w.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case w.pre == "":
+		return -1
+	}
+	return strings.Compare(v.pre, w.pre)
+}
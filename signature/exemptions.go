@@ -0,0 +1,199 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// ExemptionsField is the top-level pipeline attribute that holds a signed
+// exemptions record (see SignExemptions).
+const ExemptionsField = "signature_exemptions"
+
+var (
+	// ErrExemptionsNotSigned is the error for an exemptions record without a
+	// signature.
+	ErrExemptionsNotSigned = errors.New("signature exemptions are not signed")
+
+	_ SignedFielder = (*ExemptionsWithInvariants)(nil)
+)
+
+// Exemptions is a record of the steps in a pipeline that are exempt from
+// signing, such as steps whose contents are only known when the build runs.
+// The record is itself signed, so that adding exemptions to a pipeline is
+// tamper-evident: an exempt step may be unsigned, but only if it was exempted
+// by someone holding the signing key. The signature also covers the
+// signatures of the other steps, so the record can't be copied into a
+// different pipeline.
+type Exemptions struct {
+	// Keys are the keys of the exempt command and trigger steps.
+	Keys []string `json:"keys" yaml:"keys"`
+
+	// Signature covers the keys, the signatures of the steps that aren't
+	// exempt, and the repository URL.
+	Signature *pipeline.Signature `json:"signature,omitempty" yaml:"signature,omitempty"`
+}
+
+// Exempt reports whether the step with the given key is exempt. Steps without
+// a key are never exempt.
+func (e *Exemptions) Exempt(key string) bool {
+	return e != nil && key != "" && slices.Contains(e.Keys, key)
+}
+
+// ExemptionsWithInvariants is an Exemptions record with PipelineInvariants,
+// and the steps of the pipeline it belongs to.
+type ExemptionsWithInvariants struct {
+	Exemptions
+	Steps         pipeline.Steps
+	RepositoryURL string
+}
+
+// SignedFields returns the default fields for signing.
+func (e *ExemptionsWithInvariants) SignedFields() (map[string]any, error) {
+	return e.ValuesForFields([]string{"exempt_keys", "step_signatures", "repository_url"})
+}
+
+// ValuesForFields returns the contents of fields to sign.
+func (e *ExemptionsWithInvariants) ValuesForFields(fields []string) (map[string]any, error) {
+	// Make a set of required fields. As fields is processed, mark them off by
+	// deleting them.
+	required := map[string]struct{}{
+		"exempt_keys":     {},
+		"step_signatures": {},
+		"repository_url":  {},
+	}
+
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		delete(required, f)
+
+		switch f {
+		case "exempt_keys":
+			// The order the keys are listed in doesn't matter.
+			keys := slices.Clone(e.Keys)
+			slices.Sort(keys)
+			out["exempt_keys"] = slices.Compact(keys)
+
+		case "step_signatures":
+			out["step_signatures"] = e.stepSignatures(e.Steps, make([]string, 0, len(e.Steps)))
+
+		case "repository_url":
+			out["repository_url"] = e.RepositoryURL
+
+		default:
+			// All env:: values come from outside the record.
+			if strings.HasPrefix(f, EnvNamespacePrefix) {
+				break
+			}
+
+			return nil, fmt.Errorf("unknown or unsupported field for signing %q", f)
+		}
+	}
+
+	if len(required) > 0 {
+		missing := make([]string, 0, len(required))
+		for k := range required {
+			missing = append(missing, k)
+		}
+		return nil, fmt.Errorf("one or more required fields are not present: %v", missing)
+	}
+	return out, nil
+}
+
+// stepSignatures appends the signature values of the steps within steps
+// (recursing into group steps) to sigs, leaving out the exempt steps. As for
+// group steps, steps that can't be signed are represented by the empty
+// string.
+func (e *ExemptionsWithInvariants) stepSignatures(steps pipeline.Steps, sigs []string) []string {
+	for _, s := range steps {
+		if key, _ := stepKeyAndLabel(s); e.Exempt(key) {
+			continue
+		}
+		sigs = append(sigs, stepSignatureValue(s))
+		if g, ok := s.(*pipeline.GroupStep); ok {
+			sigs = e.stepSignatures(g.Steps, sigs)
+		}
+	}
+	return sigs
+}
+
+// SignExemptions signs a record exempting the steps with the given keys from
+// signing, and adds it to the pipeline (replacing any existing record) as
+// the ExemptionsField attribute. The steps themselves are not changed: use
+// WithStepFilter to leave them unsigned when signing the other steps. The
+// other steps must be signed first, since the record covers their
+// signatures; re-signing them invalidates the record. The repository URL is
+// signed as SignSteps signs it, so in its canonical form only with the
+// WithCanonicalRepositoryURL option.
+//
+// VerifyPipelineParallel only honours the record if it is given the
+// WithSignedExemptions option.
+func SignExemptions(ctx context.Context, p *pipeline.Pipeline, key *SigningKey, keys []string, repoURL string, opts ...Option) error {
+	if len(keys) == 0 {
+		return errors.New("no steps to exempt")
+	}
+	if slices.Contains(keys, "") {
+		return errors.New("cannot exempt a step without a key")
+	}
+	ex := &Exemptions{Keys: slices.Clone(keys)}
+	sig, err := Sign(ctx, key, &ExemptionsWithInvariants{
+		Exemptions:    *ex,
+		Steps:         p.Steps,
+		RepositoryURL: configureOptions(opts...).signedRepositoryURL(repoURL),
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("signing exemptions: %w", err)
+	}
+	ex.Signature = sig
+
+	if p.RemainingFields == nil {
+		p.RemainingFields = make(map[string]any)
+	}
+	p.RemainingFields[ExemptionsField] = ex
+	return nil
+}
+
+// PipelineExemptions returns the exemptions record of the pipeline, without
+// verifying it, or nil if it has none.
+func PipelineExemptions(p *pipeline.Pipeline) (*Exemptions, error) {
+	switch v := p.RemainingFields[ExemptionsField].(type) {
+	case nil:
+		return nil, nil
+	case *Exemptions:
+		return v, nil
+	default:
+		ex := new(Exemptions)
+		if err := ordered.Unmarshal(v, ex); err != nil {
+			return nil, fmt.Errorf("unmarshaling %s: %w", ExemptionsField, err)
+		}
+		return ex, nil
+	}
+}
+
+// VerifyExemptions verifies the signature of the pipeline's exemptions
+// record, and returns the record. It returns nil and no error if the
+// pipeline has no record. The repository URL is verified as Verify verifies
+// it, so the options accepting other forms of it apply.
+func VerifyExemptions(ctx context.Context, p *pipeline.Pipeline, keySet *VerificationKeySet, repoURL string, opts ...Option) (*Exemptions, error) {
+	ex, err := PipelineExemptions(p)
+	if err != nil || ex == nil {
+		return nil, err
+	}
+	if ex.Signature == nil {
+		return nil, ErrExemptionsNotSigned
+	}
+	sf := &ExemptionsWithInvariants{
+		Exemptions:    *ex,
+		Steps:         p.Steps,
+		RepositoryURL: repoURL,
+	}
+	if err := Verify(ctx, ex.Signature, keySet, sf, opts...); err != nil {
+		return nil, fmt.Errorf("verifying %s: %w", ExemptionsField, err)
+	}
+	return ex, nil
+}
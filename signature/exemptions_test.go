@@ -0,0 +1,288 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"gopkg.in/yaml.v3"
+)
+
+func TestVerifyPipelineParallelExemptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	// newPipeline returns a pipeline with the dynamic step exempted rather
+	// than signed, after a round trip through YAML. The step with the key
+	// unsigned (if any) is left unsigned without being exempted. tamper is
+	// applied before the round trip.
+	newPipeline := func(t *testing.T, unsigned string, tamper func(*pipeline.Pipeline)) *pipeline.Pipeline {
+		t.Helper()
+		p := &pipeline.Pipeline{Steps: pipeline.Steps{
+			&pipeline.CommandStep{Key: "build", Command: "make"},
+			&pipeline.GroupStep{Key: "deploy", Steps: pipeline.Steps{
+				&pipeline.CommandStep{Key: "dynamic", Command: "${DEPLOY_COMMAND}"},
+			}},
+			&pipeline.TriggerStep{Key: "trigger", Trigger: "downstream"},
+		}}
+		notDynamic, err := MatchStepKey("dynamic")
+		if err != nil {
+			t.Fatalf("MatchStepKey(dynamic) error = %v", err)
+		}
+		filter := WithStepFilter(func(s pipeline.Step) bool {
+			key, _ := stepKeyAndLabel(s)
+			return !notDynamic(s) && key != unsigned
+		})
+		if err := SignSteps(ctx, p.Steps, signingKey(t, key), fakeRepositoryURL, filter); err != nil {
+			t.Fatalf("SignSteps(ctx, steps, key, %q, filter) error = %v", fakeRepositoryURL, err)
+		}
+		if err := SignExemptions(ctx, p, signingKey(t, key), []string{"dynamic"}, fakeRepositoryURL); err != nil {
+			t.Fatalf("SignExemptions(ctx, p, key, [dynamic], %q) error = %v", fakeRepositoryURL, err)
+		}
+		if tamper != nil {
+			tamper(p)
+		}
+
+		b, err := yaml.Marshal(p)
+		if err != nil {
+			t.Fatalf("yaml.Marshal(p) error = %v", err)
+		}
+		got, err := pipeline.Parse(strings.NewReader(string(b)))
+		if err != nil {
+			t.Fatalf("pipeline.Parse(%q) error = %v", b, err)
+		}
+		return got
+	}
+
+	// other is the exemptions record of a different pipeline, exempting a
+	// step with the same key.
+	other := &pipeline.Pipeline{Steps: pipeline.Steps{
+		&pipeline.CommandStep{Key: "build", Command: "make evil"},
+		&pipeline.CommandStep{Key: "dynamic", Command: "${DEPLOY_COMMAND}"},
+	}}
+	if err := SignSteps(ctx, other.Steps[:1], signingKey(t, key), fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, other.Steps[:1], key, %q) error = %v", fakeRepositoryURL, err)
+	}
+	if err := SignExemptions(ctx, other, signingKey(t, key), []string{"dynamic"}, fakeRepositoryURL); err != nil {
+		t.Fatalf("SignExemptions(ctx, other, key, [dynamic], %q) error = %v", fakeRepositoryURL, err)
+	}
+
+	tests := []struct {
+		name        string
+		unsigned    string
+		tamper      func(*pipeline.Pipeline)
+		noExemption bool
+		wantErr     error
+		wantFailed  []string
+		wantExempt  []string
+		wantAborted bool
+	}{
+		{
+			name:       "exempt",
+			wantExempt: []string{"steps[1].steps[0]"},
+		},
+		{
+			name:        "exemptions not honoured",
+			noExemption: true,
+			wantErr:     ErrStepNotSigned,
+			wantFailed:  []string{"steps[1].steps[0]"},
+		},
+		{
+			name:       "unsigned step not exempt",
+			unsigned:   "build",
+			wantErr:    ErrStepNotSigned,
+			wantFailed: []string{"steps[0]"},
+			wantExempt: []string{"steps[1].steps[0]"},
+		},
+		{
+			name: "signed exempt step is still verified",
+			tamper: func(p *pipeline.Pipeline) {
+				d := p.Steps[1].(*pipeline.GroupStep).Steps[0].(*pipeline.CommandStep)
+				d.Signature = p.Steps[0].(*pipeline.CommandStep).Signature
+			},
+			wantFailed: []string{"steps[1].steps[0]"},
+		},
+		{
+			name: "tampered exemptions",
+			tamper: func(p *pipeline.Pipeline) {
+				ex := p.RemainingFields[ExemptionsField].(*Exemptions)
+				ex.Keys = append(ex.Keys, "build")
+			},
+			wantAborted: true,
+		},
+		{
+			name: "exemptions from another pipeline",
+			tamper: func(p *pipeline.Pipeline) {
+				p.RemainingFields[ExemptionsField] = other.RemainingFields[ExemptionsField]
+			},
+			wantAborted: true,
+		},
+		{
+			name: "step re-signed after exemptions",
+			tamper: func(p *pipeline.Pipeline) {
+				p.Steps[0] = other.Steps[0]
+			},
+			wantAborted: true,
+		},
+		{
+			name: "step unsigned after exemptions",
+			tamper: func(p *pipeline.Pipeline) {
+				p.Steps[0].(*pipeline.CommandStep).Signature = nil
+			},
+			wantAborted: true,
+		},
+		{
+			name: "unsigned exemptions",
+			tamper: func(p *pipeline.Pipeline) {
+				p.RemainingFields[ExemptionsField].(*Exemptions).Signature = nil
+			},
+			wantErr:     ErrExemptionsNotSigned,
+			wantAborted: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := newPipeline(t, test.unsigned, test.tamper)
+			var opts []Option
+			if !test.noExemption {
+				opts = append(opts, WithSignedExemptions(true))
+			}
+			res, err := VerifyPipelineParallel(ctx, p, verificationKeySet(t, verifier), CollectAllFailures, 2, fakeRepositoryURL, opts...)
+
+			wantAnyErr := test.wantErr != nil || len(test.wantFailed) > 0 || test.wantAborted
+			if (err != nil) != wantAnyErr {
+				t.Errorf("VerifyPipelineParallel(...) error = %v, want error %t", err, wantAnyErr)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("VerifyPipelineParallel(...) error = %v, want %v", err, test.wantErr)
+			}
+
+			if res.Aborted != test.wantAborted {
+				t.Errorf("res.Aborted = %t, want %t", res.Aborted, test.wantAborted)
+			}
+
+			var gotFailed, gotExempt []string
+			for _, r := range res.Steps {
+				if r.Err != nil {
+					gotFailed = append(gotFailed, r.Path)
+				}
+				if r.Exempt {
+					gotExempt = append(gotExempt, r.Path)
+				}
+			}
+			if diff := cmp.Diff(gotFailed, test.wantFailed); diff != "" {
+				t.Errorf("failed steps diff (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(gotExempt, test.wantExempt); diff != "" {
+				t.Errorf("exempt steps diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSignExemptionsErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, _, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	for _, keys := range [][]string{nil, {"build", ""}} {
+		p := &pipeline.Pipeline{}
+		if err := SignExemptions(ctx, p, signingKey(t, key), keys, fakeRepositoryURL); err == nil {
+			t.Errorf("SignExemptions(ctx, p, key, %q, %q) error = nil, want an error", keys, fakeRepositoryURL)
+		}
+		if _, has := p.RemainingFields[ExemptionsField]; has {
+			t.Errorf("SignExemptions(ctx, p, key, %q, %q) added a record despite failing", keys, fakeRepositoryURL)
+		}
+	}
+}
+
+func TestExemptionsRepositoryURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	const (
+		sshURL   = "git@github.com:buildkite/llamas.git"
+		httpsURL = "https://github.com/buildkite/llamas"
+	)
+
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	tests := []struct {
+		desc              string
+		signOpts          []Option
+		verifyURL         string
+		verifyOpts        []Option
+		wantVerifyFailure bool
+	}{
+		{
+			desc:      "as given",
+			verifyURL: sshURL,
+		},
+		{
+			desc:              "as given, other form",
+			verifyURL:         httpsURL,
+			wantVerifyFailure: true,
+		},
+		{
+			desc:       "canonical",
+			signOpts:   []Option{WithCanonicalRepositoryURL(true)},
+			verifyURL:  httpsURL,
+			verifyOpts: []Option{WithCanonicalRepositoryURL(true)},
+		},
+		{
+			desc:              "canonical, not accepted by verifier",
+			signOpts:          []Option{WithCanonicalRepositoryURL(true)},
+			verifyURL:         httpsURL,
+			wantVerifyFailure: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p := &pipeline.Pipeline{Steps: pipeline.Steps{
+				&pipeline.CommandStep{Key: "dynamic", Command: "${DEPLOY_COMMAND}"},
+			}}
+			if err := SignExemptions(ctx, p, signingKey(t, key), []string{"dynamic"}, sshURL, test.signOpts...); err != nil {
+				t.Fatalf("SignExemptions(ctx, p, key, [dynamic], %q, signOpts...) error = %v", sshURL, err)
+			}
+			_, err := VerifyExemptions(ctx, p, verificationKeySet(t, verifier), test.verifyURL, test.verifyOpts...)
+			if gotFailure := err != nil; gotFailure != test.wantVerifyFailure {
+				t.Errorf("VerifyExemptions(ctx, p, verifier, %q, verifyOpts...) error = %v, want failure = %t", test.verifyURL, err, test.wantVerifyFailure)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+)
+
+// ErrUnsupportedKeyType is returned (wrapped) when a key of a type that
+// cannot be used for signing or verification is provided.
+var ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+// SigningKey is a key that Sign can use to create signatures. Create one with
+// NewSigningKey, NewSigningKeyFromSigner, or NewSigningKeyFromPEM.
+type SigningKey struct {
+	alg jwa.KeyAlgorithm
+
+	// key is either a jwk.Key or a crypto.Signer, suitable for jws.WithKey.
+	key any
+
+	// thumbprint is the SHA-256 thumbprint of the public key, for logging.
+	thumbprint []byte
+}
+
+// NewSigningKey returns a SigningKey for a JSON Web Key. The key must have an
+// algorithm.
+func NewSigningKey(key jwk.Key) (*SigningKey, error) {
+	if key == nil {
+		return nil, errors.New("nil signing key")
+	}
+	if key.Algorithm().String() == "" {
+		return nil, jwkutil.ErrKeyMissingAlg
+	}
+
+	pk, err := key.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate public key: %w", err)
+	}
+
+	fingerprint, err := pk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("calculating key thumbprint: %w", err)
+	}
+
+	return &SigningKey{
+		alg:        key.Algorithm(),
+		key:        key,
+		thumbprint: fingerprint,
+	}, nil
+}
+
+// NewSigningKeyFromSigner returns a SigningKey for a crypto.Signer (for
+// example, a key held in a KMS or HSM), which signs using alg.
+func NewSigningKeyFromSigner(signer crypto.Signer, alg jwa.SignatureAlgorithm) (*SigningKey, error) {
+	if signer == nil {
+		return nil, errors.New("nil signing key")
+	}
+	if err := checkKeyAlgorithm(signer.Public(), alg); err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := publicKeyThumbprint(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		alg:        alg,
+		key:        signer,
+		thumbprint: fingerprint,
+	}, nil
+}
+
+// NewSigningKeyFromPEM returns a SigningKey for a PEM-encoded private key
+// (PKCS #8, SEC 1 EC, or PKCS #1 RSA), which signs using alg.
+func NewSigningKeyFromPEM(b []byte, alg jwa.SignatureAlgorithm) (*SigningKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var priv any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			// Some tools write SEC 1 keys with a "PRIVATE KEY" header.
+			if ecPriv, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+				priv, err = ecPriv, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: private key of type %T cannot sign", ErrUnsupportedKeyType, priv)
+	}
+	return NewSigningKeyFromSigner(signer, alg)
+}
+
+// Algorithm returns the algorithm the key signs with.
+func (k *SigningKey) Algorithm() jwa.KeyAlgorithm { return k.alg }
+
+// verificationKeySet returns a VerificationKeySet for the public key of k, so
+// that signatures made with k can be checked.
+func (k *SigningKey) verificationKeySet() (*VerificationKeySet, error) {
+	switch key := k.key.(type) {
+	case jwk.Key:
+		return NewVerificationKeySetFromKey(key)
+	case crypto.Signer:
+		alg, ok := k.alg.(jwa.SignatureAlgorithm)
+		if !ok {
+			return nil, fmt.Errorf("%w: algorithm %q cannot sign", ErrUnsupportedKeyType, k.alg)
+		}
+		return NewVerificationKeySetFromPublicKey(key.Public(), alg)
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, k.key)
+	}
+}
+
+// VerificationKeySet is a set of keys that Verify can use to verify
+// signatures. Create one with NewVerificationKeySet,
+// NewVerificationKeySetFromKey, NewVerificationKeySetFromPublicKey, or
+// NewVerificationKeySetFromPEM.
+type VerificationKeySet struct {
+	// Exactly one of set or (alg, pub) is used.
+	set jwk.Set
+
+	alg        jwa.SignatureAlgorithm
+	pub        crypto.PublicKey
+	thumbprint []byte
+}
+
+// NewVerificationKeySet returns a VerificationKeySet for a JSON Web Key Set.
+// Keys within the set that have been retired (see jwkutil.NotAfter) are not
+// trusted.
+func NewVerificationKeySet(set jwk.Set) (*VerificationKeySet, error) {
+	if set == nil {
+		return nil, errors.New("nil verification key set")
+	}
+	return &VerificationKeySet{set: set}, nil
+}
+
+// NewVerificationKeySetFromKey returns a VerificationKeySet containing a single
+// JSON Web Key. If the key is a private key, only its public key is used.
+func NewVerificationKeySetFromKey(key jwk.Key) (*VerificationKeySet, error) {
+	if key == nil {
+		return nil, errors.New("nil verification key")
+	}
+	pk, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate public key: %w", err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(pk); err != nil {
+		return nil, fmt.Errorf("failed to add key to set: %w", err)
+	}
+	return NewVerificationKeySet(set)
+}
+
+// NewVerificationKeySetFromPublicKey returns a VerificationKeySet for a single
+// public key (such as *ecdsa.PublicKey), which verifies using alg.
+func NewVerificationKeySetFromPublicKey(pub crypto.PublicKey, alg jwa.SignatureAlgorithm) (*VerificationKeySet, error) {
+	if pub == nil {
+		return nil, errors.New("nil verification key")
+	}
+	if err := checkKeyAlgorithm(pub, alg); err != nil {
+		return nil, err
+	}
+	fingerprint, err := publicKeyThumbprint(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationKeySet{
+		alg:        alg,
+		pub:        pub,
+		thumbprint: fingerprint,
+	}, nil
+}
+
+// NewVerificationKeySetFromPEM returns a VerificationKeySet for a PEM-encoded
+// PKIX public key, which verifies using alg.
+func NewVerificationKeySetFromPEM(b []byte, alg jwa.SignatureAlgorithm) (*VerificationKeySet, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	return NewVerificationKeySetFromPublicKey(pub, alg)
+}
+
+// verifyOption logs the thumbprints of the keys in use, and returns an option
+// for jws.Verify that verifies with them. Keys that have been retired as of
+// now are excluded. It also returns a digest of the thumbprints, which
+// changes whenever the set of keys in use does.
+func (ks *VerificationKeySet) verifyOption(ctx context.Context, now time.Time, logger *slog.Logger) (jws.VerifyOption, []byte, error) {
+	if ks.set == nil {
+		logAt(ctx, logger, slog.LevelDebug, msgThumbprint, "thumbprint", fmt.Sprintf("%x", ks.thumbprint))
+		digest := sha256.Sum256(append([]byte(ks.alg.String()+"\x00"), ks.thumbprint...))
+		return jws.WithKey(ks.alg, ks.pub), digest[:], nil
+	}
+
+	unexpired, err := jwkutil.Unexpired(ks.set, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("filtering expired keys: %w", err)
+	}
+	if unexpired.Len() == 0 && ks.set.Len() > 0 {
+		return nil, nil, errors.New("all verification keys have been retired")
+	}
+	if unexpired.Len() < ks.set.Len() {
+		logRetiredKeys(ctx, logger, ks.set, now)
+	}
+
+	h := sha256.New()
+	for it := unexpired.Keys(ctx); it.Next(ctx); {
+		publicKey := it.Pair().Value.(jwk.Key)
+		fingerprint, err := publicKey.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, nil, fmt.Errorf("calculating key thumbprint: %w", err)
+		}
+
+		logAt(ctx, logger, slog.LevelDebug, msgThumbprint, "thumbprint", fmt.Sprintf("%x", fingerprint))
+		fmt.Fprintf(h, "%s\x00%s\x00%x\n", publicKey.KeyID(), publicKey.Algorithm(), fingerprint)
+	}
+
+	return jws.WithKeySet(unexpired), h.Sum(nil), nil
+}
+
+// checkKeyAlgorithm checks that pub is a type of public key that can be used
+// with alg.
+func checkKeyAlgorithm(pub crypto.PublicKey, alg jwa.SignatureAlgorithm) error {
+	var ok bool
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = slices.Contains([]jwa.SignatureAlgorithm{jwa.ES256, jwa.ES384, jwa.ES512}, alg)
+	case *rsa.PublicKey:
+		ok = slices.Contains([]jwa.SignatureAlgorithm{jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512}, alg)
+	case ed25519.PublicKey:
+		ok = alg == jwa.EdDSA
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedKeyType, pub)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %T cannot be used with algorithm %q", ErrUnsupportedKeyType, pub, alg)
+	}
+	return nil
+}
+
+// publicKeyThumbprint returns the SHA-256 hash of the PKIX encoding of pub.
+func publicKeyThumbprint(pub crypto.PublicKey) ([]byte, error) {
+	data, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
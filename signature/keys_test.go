@@ -0,0 +1,109 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+func TestSignVerifyPEM(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	dir := path.Join("fixtures", "crypto_signer", "P256")
+	privPEM, err := os.ReadFile(path.Join(dir, "private.pem"))
+	if err != nil {
+		t.Fatalf("os.ReadFile(private.pem) error = %v", err)
+	}
+	pubPEM, err := os.ReadFile(path.Join(dir, "public.pem"))
+	if err != nil {
+		t.Fatalf("os.ReadFile(public.pem) error = %v", err)
+	}
+
+	signer, err := NewSigningKeyFromPEM(privPEM, jwa.ES256)
+	if err != nil {
+		t.Fatalf("NewSigningKeyFromPEM(privPEM, ES256) error = %v", err)
+	}
+	verifier, err := NewVerificationKeySetFromPEM(pubPEM, jwa.ES256)
+	if err != nil {
+		t.Fatalf("NewVerificationKeySetFromPEM(pubPEM, ES256) error = %v", err)
+	}
+
+	step := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: fakeRepositoryURL,
+	}
+
+	sig, err := Sign(ctx, signer, step)
+	if err != nil {
+		t.Fatalf("Sign(ctx, signer, %v) error = %v", step, err)
+	}
+	if err := Verify(ctx, sig, verifier, step); err != nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v) = %v", sig, step, err)
+	}
+}
+
+func TestNewKeyErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewSigningKey(nil); err == nil {
+		t.Errorf("NewSigningKey(nil) error = %v, want non-nil error", err)
+	}
+	if _, err := NewSigningKeyFromPEM([]byte("not a pem"), jwa.ES256); err == nil {
+		t.Errorf("NewSigningKeyFromPEM(junk, ES256) error = %v, want non-nil error", err)
+	}
+	if _, err := NewVerificationKeySet(nil); err == nil {
+		t.Errorf("NewVerificationKeySet(nil) error = %v, want non-nil error", err)
+	}
+	if _, err := NewVerificationKeySetFromPEM([]byte("not a pem"), jwa.ES256); err == nil {
+		t.Errorf("NewVerificationKeySetFromPEM(junk, ES256) error = %v, want non-nil error", err)
+	}
+}
+
+// unsupportedSigner is a crypto.Signer with a public key type that can't be
+// used for signing pipelines.
+type unsupportedSigner struct{}
+
+func (unsupportedSigner) Public() crypto.PublicKey { return "definitely not a key" }
+
+func (unsupportedSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("unsupportedSigner cannot sign")
+}
+
+func TestUnsupportedKeyTypes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	if _, err := NewSigningKeyFromSigner(unsupportedSigner{}, jwa.ES256); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("NewSigningKeyFromSigner(unsupportedSigner{}, ES256) error = %v, want %v", err, ErrUnsupportedKeyType)
+	}
+	if _, err := NewVerificationKeySetFromPublicKey("definitely not a key", jwa.ES256); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("NewVerificationKeySetFromPublicKey(string, ES256) error = %v, want %v", err, ErrUnsupportedKeyType)
+	}
+
+	// An EC key can't be used with an RSA algorithm.
+	privPEM, err := os.ReadFile(path.Join("fixtures", "crypto_signer", "P256", "private.pem"))
+	if err != nil {
+		t.Fatalf("os.ReadFile(private.pem) error = %v", err)
+	}
+	if _, err := NewSigningKeyFromPEM(privPEM, jwa.PS512); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("NewSigningKeyFromPEM(privPEM, PS512) error = %v, want %v", err, ErrUnsupportedKeyType)
+	}
+
+	// nil keys are errors, not panics.
+	step := &CommandStepWithInvariants{CommandStep: pipeline.CommandStep{Command: "llamas"}}
+	if _, err := Sign(ctx, nil, step); err == nil {
+		t.Errorf("Sign(ctx, nil, %v) error = %v, want non-nil error", step, err)
+	}
+	sig := &pipeline.Signature{Algorithm: "ES256", SignedFields: []string{"command"}, Value: "llamas"}
+	if err := Verify(ctx, sig, nil, step); err == nil {
+		t.Errorf("Verify(ctx, %v, nil, %v) error = %v, want non-nil error", sig, step, err)
+	}
+}
@@ -0,0 +1,138 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// Logger is a printf-style logger, which can be given to WithLogger. Every
+// message is passed to Debug, whatever its level.
+//
+// Deprecated: Use WithSlogLogger, which preserves the level and attributes of
+// each message.
+type Logger interface{ Debug(f string, v ...any) }
+
+type slogLoggerOption struct{ logger *slog.Logger }
+
+func (o slogLoggerOption) apply(opts *options) { opts.logger = o.logger }
+
+// WithLogger sets a printf-style logger for Sign and Verify. Messages are
+// formatted as they were before Logger was deprecated, or for newer messages,
+// as a line of text including the level (see LoggerHandler).
+//
+// Deprecated: Use WithSlogLogger.
+func WithLogger(logger Logger) Option {
+	if logger == nil {
+		return slogLoggerOption{nil}
+	}
+	return slogLoggerOption{slog.New(LoggerHandler(logger))}
+}
+
+// WithSlogLogger sets the logger for Sign and Verify. Key thumbprints, and
+// payloads (see WithDebugSigning), are logged at debug level. Ignoring retired
+// keys is logged at warn level, and verifying a signature made with another
+// form of the repository URL (its canonical form, with
+// WithCanonicalRepositoryURL, or an equivalent URL given to
+// WithEquivalentRepositoryURLs) at info level.
+func WithSlogLogger(logger *slog.Logger) Option { return slogLoggerOption{logger} }
+
+// Messages logged by Sign and Verify that Logger has always been given.
+const (
+	msgThumbprint = "Public Key Thumbprint (sha256)"
+	msgSignedStep = "Signed Step"
+)
+
+// legacyFormats are the formats the messages were passed to Logger with
+// before it was deprecated. The values of the attributes of the record are the
+// arguments.
+var legacyFormats = map[string]string{
+	msgThumbprint: msgThumbprint + ": %s",
+	msgSignedStep: msgSignedStep + ": %s checksum: %s",
+}
+
+// LoggerHandler returns a slog.Handler that passes each record to the Debug
+// method of logger. It adapts loggers written for the Logger interface.
+// Messages that Sign and Verify logged before Logger was deprecated (such as
+// "Public Key Thumbprint (sha256): ...") are formatted as they were then, so
+// that their lines are unchanged. Other records are formatted as a line of
+// text, as slog.TextHandler does but without the time.
+func LoggerHandler(logger Logger) slog.Handler {
+	return loggerHandler{
+		Handler: slog.NewTextHandler(loggerWriter{logger}, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+		logger: logger,
+	}
+}
+
+// loggerHandler formats records with a legacy format itself, and passes the
+// rest to the embedded text handler.
+type loggerHandler struct {
+	slog.Handler
+	logger Logger
+}
+
+func (h loggerHandler) Handle(ctx context.Context, r slog.Record) error {
+	format, ok := legacyFormats[r.Message]
+	if !ok {
+		return h.Handler.Handle(ctx, r)
+	}
+	args := make([]any, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		args = append(args, a.Value.Any())
+		return true
+	})
+	h.logger.Debug(format, args...)
+	return nil
+}
+
+func (h loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return loggerHandler{Handler: h.Handler.WithAttrs(attrs), logger: h.logger}
+}
+
+func (h loggerHandler) WithGroup(name string) slog.Handler {
+	return loggerHandler{Handler: h.Handler.WithGroup(name), logger: h.logger}
+}
+
+// loggerWriter writes each line written to it (slog.TextHandler writes one per
+// record) to a Logger.
+type loggerWriter struct{ logger Logger }
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.logger.Debug("%s", bytes.TrimSuffix(p, []byte("\n")))
+	return len(p), nil
+}
+
+// logAt logs a message with logger, which may be nil.
+func logAt(ctx context.Context, logger *slog.Logger, level slog.Level, msg string, args ...any) {
+	if logger != nil {
+		logger.Log(ctx, level, msg, args...)
+	}
+}
+
+// logRetiredKeys logs a warning for each key in set that has been retired as
+// of now, and so is being ignored.
+func logRetiredKeys(ctx context.Context, logger *slog.Logger, set jwk.Set, now time.Time) {
+	if logger == nil {
+		return
+	}
+	for it := set.Keys(ctx); it.Next(ctx); {
+		key := it.Pair().Value.(jwk.Key)
+		if !jwkutil.IsExpired(key, now) {
+			continue
+		}
+		notAfter, _ := jwkutil.NotAfter(key)
+		logger.WarnContext(ctx, "Ignoring retired key", "key_id", key.KeyID(), "not_after", notAfter)
+	}
+}
@@ -0,0 +1,138 @@
+package signature
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// recordingHandler is a slog.Handler that records the level and message of
+// each record.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Level.String()+" "+r.Message)
+	return nil
+}
+
+func TestSlogLoggerLevels(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	const (
+		sshURL   = "git@github.com:buildkite/llamas.git"
+		httpsURL = "https://github.com/buildkite/llamas.git"
+	)
+
+	signer, verifier, err := jwkutil.NewKeyPair("current", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(current, EdDSA) error = %v", err)
+	}
+	_, oldVerifier, err := jwkutil.NewKeyPair("old", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(old, EdDSA) error = %v", err)
+	}
+
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+	oldPub, _ := oldVerifier.Key(0)
+	retireAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := jwkutil.SetNotAfter(oldPub, retireAt); err != nil {
+		t.Fatalf("jwkutil.SetNotAfter(oldPub, %v) error = %v", retireAt, err)
+	}
+	pub, _ := verifier.Key(0)
+	set := jwk.NewSet()
+	for _, k := range []jwk.Key{pub, oldPub} {
+		if err := set.AddKey(k); err != nil {
+			t.Fatalf("set.AddKey(%v) error = %v", k.KeyID(), err)
+		}
+	}
+
+	signStep := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: sshURL,
+	}
+	sig, err := Sign(ctx, signingKey(t, key), signStep)
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, %v) error = %v", signStep, err)
+	}
+
+	h := &recordingHandler{}
+	verifyStep := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: httpsURL,
+	}
+	opts := []Option{
+		WithSlogLogger(slog.New(h)),
+		WithEquivalentRepositoryURLs(httpsURL, sshURL),
+		WithVerificationTime(retireAt.Add(time.Minute)),
+	}
+	if err := Verify(ctx, sig, verificationKeySet(t, set), verifyStep, opts...); err != nil {
+		t.Fatalf("Verify(ctx, %v, set, %v, opts...) = %v", sig, verifyStep, err)
+	}
+
+	want := []string{
+		"WARN Ignoring retired key",
+		"DEBUG Public Key Thumbprint (sha256)",
+		"INFO Verified signature made with another form of the repository URL",
+	}
+	if diff := cmp.Diff(h.records, want); diff != "" {
+		t.Errorf("logged records diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestLoggerHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc string
+		log  func(*slog.Logger)
+		want string
+	}{
+		{
+			desc: "new message",
+			log:  func(l *slog.Logger) { l.Warn("Ignoring retired key", "key_id", "old") },
+			want: `level=WARN msg="Ignoring retired key" key_id=old`,
+		},
+		{
+			desc: "thumbprint",
+			log:  func(l *slog.Logger) { l.Debug(msgThumbprint, "thumbprint", "c0ffee") },
+			want: "Public Key Thumbprint (sha256): c0ffee",
+		},
+		{
+			desc: "signed step",
+			log:  func(l *slog.Logger) { l.Debug(msgSignedStep, "payload", `{"command":"llamas"}`, "checksum", "c0ffee") },
+			want: `Signed Step: {"command":"llamas"} checksum: c0ffee`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			l := &fakeLogger{}
+			test.log(slog.New(LoggerHandler(l)))
+			if got := l.buf.String(); got != test.want {
+				t.Errorf("l.buf.String() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
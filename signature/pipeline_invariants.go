@@ -2,12 +2,19 @@ package signature
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/buildkite/go-pipeline"
 )
 
-var _ SignedFielder = (*CommandStepWithInvariants)(nil)
+var (
+	_ SignedFielder = (*CommandStepWithInvariants)(nil)
+	_ SignedFielder = (*TriggerStepWithInvariants)(nil)
+	_ SignedFielder = (*GroupStepWithInvariants)(nil)
+
+	_ ProfileFielder = (*CommandStepWithInvariants)(nil)
+)
 
 // CommandStepWithInvariants is a CommandStep with PipelineInvariants.
 type CommandStepWithInvariants struct {
@@ -58,6 +65,126 @@ func (c *CommandStepWithInvariants) ValuesForFields(fields []string) (map[string
 		case "repository_url":
 			out["repository_url"] = c.RepositoryURL
 
+		case "cache":
+			out["cache"] = c.Cache
+
+		default:
+			// All env:: values come from outside the step.
+			if strings.HasPrefix(f, EnvNamespacePrefix) {
+				break
+			}
+
+			// The other fields of ProfileStrict are signed as null if absent.
+			if slices.Contains(StrictCommandFields, f) {
+				out[f] = c.strictField(f)
+				break
+			}
+
+			return nil, fmt.Errorf("unknown or unsupported field for signing %q", f)
+		}
+	}
+
+	if len(required) > 0 {
+		missing := make([]string, 0, len(required))
+		for k := range required {
+			missing = append(missing, k)
+		}
+		return nil, fmt.Errorf("one or more required fields are not present: %v", missing)
+	}
+	return out, nil
+}
+
+// strictField returns the value of one of the StrictCommandFields (other than
+// cache), or nil if it is not set. Fields that are modelled as struct fields
+// are read from RemainingFields if the struct field is not set, since steps
+// built without unmarshaling may still have them there.
+func (c *CommandStepWithInvariants) strictField(f string) any {
+	var v any
+	switch f {
+	case "agents":
+		v = nilIfNil(c.Agents)
+	case "artifact_paths":
+		v = nilIfNil(c.ArtifactPaths)
+	case "concurrency":
+		v = nilIfNil(c.Concurrency)
+	case "concurrency_group":
+		if c.ConcurrencyGroup != "" {
+			v = c.ConcurrencyGroup
+		}
+	case "parallelism":
+		v = nilIfNil(c.Parallelism)
+	case "retry":
+		v = nilIfNil(c.Retry)
+	case "soft_fail":
+		v = nilIfNil(c.SoftFail)
+	case "timeout_in_minutes":
+		v = nilIfNil(c.TimeoutInMinutes)
+	}
+	if v == nil {
+		return c.RemainingFields[f]
+	}
+	return v
+}
+
+// nilIfNil returns p, or untyped nil if p is a nil pointer.
+func nilIfNil[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return p
+}
+
+// ProfileFields returns the extra fields to sign under profile.
+func (c *CommandStepWithInvariants) ProfileFields(profile Profile) []string {
+	switch profile {
+	case ProfileStrict:
+		return StrictCommandFields
+	case ProfileArtifacts:
+		return ArtifactCommandFields
+	default:
+		return nil
+	}
+}
+
+// TriggerStepWithInvariants is a TriggerStep with PipelineInvariants.
+type TriggerStepWithInvariants struct {
+	pipeline.TriggerStep
+	RepositoryURL string
+}
+
+// SignedFields returns the default fields for signing.
+func (t *TriggerStepWithInvariants) SignedFields() (map[string]any, error) {
+	return map[string]any{
+		"trigger":        t.Trigger,
+		"build":          CanonicalTriggerBuild(t.Build),
+		"repository_url": t.RepositoryURL,
+	}, nil
+}
+
+// ValuesForFields returns the contents of fields to sign.
+func (t *TriggerStepWithInvariants) ValuesForFields(fields []string) (map[string]any, error) {
+	// Make a set of required fields. As fields is processed, mark them off by
+	// deleting them.
+	required := map[string]struct{}{
+		"trigger":        {},
+		"build":          {},
+		"repository_url": {},
+	}
+
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		delete(required, f)
+
+		switch f {
+		case "trigger":
+			out["trigger"] = t.Trigger
+
+		case "build":
+			out["build"] = CanonicalTriggerBuild(t.Build)
+
+		case "repository_url":
+			out["repository_url"] = t.RepositoryURL
+
 		default:
 			// All env:: values come from outside the step.
 			if strings.HasPrefix(f, EnvNamespacePrefix) {
@@ -77,3 +204,126 @@ func (c *CommandStepWithInvariants) ValuesForFields(fields []string) (map[string
 	}
 	return out, nil
 }
+
+// CanonicalTriggerBuild returns the build attributes of a trigger step in a
+// canonical form for signing: a map containing only the attributes that are
+// set (including any in RemainingFields), or nil if none are set.
+func CanonicalTriggerBuild(b *pipeline.TriggerBuild) map[string]any {
+	if b == nil {
+		return nil
+	}
+	out := make(map[string]any, len(b.RemainingFields)+5)
+	for k, v := range b.RemainingFields {
+		out[k] = v
+	}
+	for k, v := range map[string]string{
+		"message": b.Message,
+		"commit":  b.Commit,
+		"branch":  b.Branch,
+	} {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	if len(b.Env) > 0 {
+		out["env"] = b.Env
+	}
+	if len(b.MetaData) > 0 {
+		out["meta_data"] = b.MetaData
+	}
+	return EmptyToNilMap(out)
+}
+
+// GroupStepWithInvariants is a GroupStep with PipelineInvariants. Its
+// signature covers the group's key, label, and dependencies, and the
+// signatures of the steps within it (in order), so the steps within the group
+// should be signed first.
+type GroupStepWithInvariants struct {
+	pipeline.GroupStep
+	RepositoryURL string
+}
+
+// SignedFields returns the default fields for signing.
+func (g *GroupStepWithInvariants) SignedFields() (map[string]any, error) {
+	return g.ValuesForFields([]string{"key", "group", "depends_on", "step_signatures", "repository_url"})
+}
+
+// ValuesForFields returns the contents of fields to sign.
+func (g *GroupStepWithInvariants) ValuesForFields(fields []string) (map[string]any, error) {
+	// Make a set of required fields. As fields is processed, mark them off by
+	// deleting them.
+	required := map[string]struct{}{
+		"key":             {},
+		"group":           {},
+		"depends_on":      {},
+		"step_signatures": {},
+		"repository_url":  {},
+	}
+
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		delete(required, f)
+
+		switch f {
+		case "key":
+			out["key"] = g.Key
+
+		case "group":
+			out["group"] = g.Label()
+
+		case "depends_on":
+			deps, err := pipeline.StepDependencies(&g.GroupStep)
+			if err != nil {
+				return nil, err
+			}
+			out["depends_on"] = EmptyToNilSlice(deps)
+
+		case "step_signatures":
+			// Steps that can't be signed are represented by the empty string,
+			// so that inserting or removing them changes the signature too.
+			sigs := make([]string, 0, len(g.Steps))
+			for _, s := range g.Steps {
+				sigs = append(sigs, stepSignatureValue(s))
+			}
+			out["step_signatures"] = sigs
+
+		case "repository_url":
+			out["repository_url"] = g.RepositoryURL
+
+		default:
+			// All env:: values come from outside the step.
+			if strings.HasPrefix(f, EnvNamespacePrefix) {
+				break
+			}
+
+			return nil, fmt.Errorf("unknown or unsupported field for signing %q", f)
+		}
+	}
+
+	if len(required) > 0 {
+		missing := make([]string, 0, len(required))
+		for k := range required {
+			missing = append(missing, k)
+		}
+		return nil, fmt.Errorf("one or more required fields are not present: %v", missing)
+	}
+	return out, nil
+}
+
+// stepSignatureValue returns the value of the signature of a step, or the
+// empty string if it has none.
+func stepSignatureValue(s pipeline.Step) string {
+	var sig *pipeline.Signature
+	switch s := s.(type) {
+	case *pipeline.CommandStep:
+		sig = s.Signature
+	case *pipeline.TriggerStep:
+		sig = s.Signature
+	case *pipeline.GroupStep:
+		sig = s.Signature
+	}
+	if sig == nil {
+		return ""
+	}
+	return sig.Value
+}
@@ -0,0 +1,117 @@
+package signature
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrUnknownProfile is returned (wrapped) by Sign and Verify when the profile
+// set with WithProfile isn't one of the profiles below.
+var ErrUnknownProfile = errors.New("unknown signing profile")
+
+// Profile names a set of fields that Sign covers, beyond the defaults of each
+// SignedFielder. A profile is chosen with WithProfile.
+type Profile string
+
+const (
+	// ProfileCompat signs only the default fields of each step (for command
+	// steps: command, env, plugins, matrix, and repository_url). Signatures
+	// made with it can be verified by any version of this library. This is the
+	// default.
+	ProfileCompat Profile = "compat"
+
+	// ProfileStrict additionally signs the fields of command steps that affect
+	// how (and where) the command is executed, such as retry,
+	// timeout_in_minutes, agents, and soft_fail (see StrictCommandFields), so
+	// that they can't be changed without invalidating the signature.
+	ProfileStrict Profile = "strict"
+
+	// ProfileArtifacts additionally signs only the fields of command steps
+	// that determine what is uploaded and restored around the job
+	// (artifact_paths and cache - see ArtifactCommandFields), so that artifact
+	// and cache destinations can't be tampered with. It is a subset of
+	// ProfileStrict, for pipelines that need other fields (such as agents) to
+	// remain changeable.
+	ProfileArtifacts Profile = "artifacts"
+)
+
+// StrictCommandFields are the command step fields that ProfileStrict signs, in
+// addition to the defaults. The fields are signed whether or not they are set
+// on the step (unset fields are signed as null), so that adding them is
+// tamper-evident too.
+var StrictCommandFields = []string{
+	"agents",
+	"artifact_paths",
+	"cache",
+	"concurrency",
+	"concurrency_group",
+	"image",
+	"parallelism",
+	"retry",
+	"secrets",
+	"soft_fail",
+	"timeout_in_minutes",
+}
+
+// ArtifactCommandFields are the command step fields that ProfileArtifacts
+// signs, in addition to the defaults. Like StrictCommandFields, they are
+// signed whether or not they are set on the step.
+var ArtifactCommandFields = []string{
+	"artifact_paths",
+	"cache",
+}
+
+// ProfileFielder is implemented by SignedFielders with fields that are signed
+// under some profiles but not by default.
+type ProfileFielder interface {
+	// ProfileFields returns the names of the fields to sign under profile, in
+	// addition to those returned by SignedFields.
+	ProfileFields(profile Profile) []string
+}
+
+// WithProfile sets the signing profile. Sign signs the extra fields of the
+// profile, and Verify rejects signatures that do not cover them. Only
+// SignedFielders that implement ProfileFielder are affected. Sign and Verify
+// return an error wrapping ErrUnknownProfile for a profile other than those
+// above, rather than falling back to ProfileCompat.
+func WithProfile(profile Profile) Option { return profileOption{profile} }
+
+type profileOption struct{ profile Profile }
+
+func (o profileOption) apply(opts *options) { opts.profile = o.profile }
+
+// validate returns an error if the profile is unknown. The empty profile is
+// ProfileCompat.
+func (p Profile) validate() error {
+	switch p {
+	case "", ProfileCompat, ProfileStrict, ProfileArtifacts:
+		return nil
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownProfile, string(p))
+	}
+}
+
+// profileFields returns the extra fields that profile requires of sf, or nil
+// if there are none.
+func profileFields(sf SignedFielder, profile Profile) []string {
+	if profile == "" || profile == ProfileCompat {
+		return nil
+	}
+	pf, ok := sf.(ProfileFielder)
+	if !ok {
+		return nil
+	}
+	return pf.ProfileFields(profile)
+}
+
+// checkProfile checks that the signed fields cover those required by the
+// profile.
+func checkProfile(sf SignedFielder, profile Profile, signed []string) error {
+	for _, f := range profileFields(sf, profile) {
+		if !slices.Contains(signed, f) {
+			return fmt.Errorf("signature does not cover field %q required by profile %q", f, profile)
+		}
+	}
+	return nil
+}
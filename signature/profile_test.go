@@ -0,0 +1,290 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+func TestSignVerifyProfileStrict(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewKeyPair(keyID, jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(%q, EdDSA) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+	keySet := verificationKeySet(t, verifier)
+
+	newStep := func() *CommandStepWithInvariants {
+		return &CommandStepWithInvariants{
+			CommandStep: pipeline.CommandStep{
+				Command: "make deploy",
+				RemainingFields: map[string]any{
+					"retry": ordered.MapFromItems(
+						ordered.TupleSA{Key: "automatic", Value: true},
+					),
+					"timeout_in_minutes": 10,
+					"agents":             []any{"queue=deploy"},
+				},
+			},
+			RepositoryURL: fakeRepositoryURL,
+		}
+	}
+
+	compatSig, err := Sign(ctx, signingKey(t, key), newStep())
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step) error = %v", err)
+	}
+	strictSig, err := Sign(ctx, signingKey(t, key), newStep(), WithProfile(ProfileStrict))
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step, WithProfile(ProfileStrict)) error = %v", err)
+	}
+	for _, f := range StrictCommandFields {
+		if !slices.Contains(strictSig.SignedFields, f) {
+			t.Errorf("strictSig.SignedFields = %v, missing %q", strictSig.SignedFields, f)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		sig     *pipeline.Signature
+		modify  func(*CommandStepWithInvariants)
+		opts    []Option
+		wantErr string
+	}{
+		{
+			name: "strict signature, strict verify",
+			sig:  strictSig,
+			opts: []Option{WithProfile(ProfileStrict)},
+		},
+		{
+			name: "strict signature, compat verify",
+			sig:  strictSig,
+		},
+		{
+			name:    "compat signature, strict verify",
+			sig:     compatSig,
+			opts:    []Option{WithProfile(ProfileStrict)},
+			wantErr: `required by profile "strict"`,
+		},
+		{
+			name: "compat signature, tampered timeout",
+			sig:  compatSig,
+			modify: func(s *CommandStepWithInvariants) {
+				s.RemainingFields["timeout_in_minutes"] = 1000
+			},
+		},
+		{
+			name: "strict signature, tampered timeout",
+			sig:  strictSig,
+			modify: func(s *CommandStepWithInvariants) {
+				s.RemainingFields["timeout_in_minutes"] = 1000
+			},
+			opts:    []Option{WithProfile(ProfileStrict)},
+			wantErr: "could not verify",
+		},
+		{
+			name: "strict signature, added soft_fail",
+			sig:  strictSig,
+			modify: func(s *CommandStepWithInvariants) {
+				s.RemainingFields["soft_fail"] = true
+			},
+			wantErr: "could not verify",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			step := newStep()
+			if test.modify != nil {
+				test.modify(step)
+			}
+			err := Verify(ctx, test.sig, keySet, step, test.opts...)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify(ctx, sig, keySet, step, opts...) error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Verify(ctx, sig, keySet, step, opts...) error = %v, want error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignVerifyProfileArtifacts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewKeyPair(keyID, jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(%q, EdDSA) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+	keySet := verificationKeySet(t, verifier)
+
+	newStep := func() *CommandStepWithInvariants {
+		step := &CommandStepWithInvariants{RepositoryURL: fakeRepositoryURL}
+		err := step.CommandStep.UnmarshalJSON([]byte(`{
+			"command": "make dist",
+			"artifact_paths": ["dist/**/*"],
+			"cache": {"paths": ["node_modules"], "size": "20g"},
+			"agents": {"queue": "build"}
+		}`))
+		if err != nil {
+			t.Fatalf("CommandStep.UnmarshalJSON(input) error = %v", err)
+		}
+		return step
+	}
+
+	artifactsSig, err := Sign(ctx, signingKey(t, key), newStep(), WithProfile(ProfileArtifacts))
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step, WithProfile(ProfileArtifacts)) error = %v", err)
+	}
+	for _, f := range ArtifactCommandFields {
+		if !slices.Contains(artifactsSig.SignedFields, f) {
+			t.Errorf("artifactsSig.SignedFields = %v, missing %q", artifactsSig.SignedFields, f)
+		}
+	}
+	if slices.Contains(artifactsSig.SignedFields, "agents") {
+		t.Errorf("artifactsSig.SignedFields = %v, want it not to contain %q", artifactsSig.SignedFields, "agents")
+	}
+	compatSig, err := Sign(ctx, signingKey(t, key), newStep())
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step) error = %v", err)
+	}
+	strictSig, err := Sign(ctx, signingKey(t, key), newStep(), WithProfile(ProfileStrict))
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step, WithProfile(ProfileStrict)) error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		sig     *pipeline.Signature
+		modify  func(*CommandStepWithInvariants)
+		opts    []Option
+		wantErr string
+	}{
+		{
+			name: "artifacts signature, unmodified",
+			sig:  artifactsSig,
+			opts: []Option{WithProfile(ProfileArtifacts)},
+		},
+		{
+			name: "artifacts signature, agents changed",
+			sig:  artifactsSig,
+			modify: func(s *CommandStepWithInvariants) {
+				s.Agents.Set("queue", "elsewhere")
+			},
+			opts: []Option{WithProfile(ProfileArtifacts)},
+		},
+		{
+			name: "artifacts signature, artifact_paths changed",
+			sig:  artifactsSig,
+			modify: func(s *CommandStepWithInvariants) {
+				s.ArtifactPaths.Paths = append(s.ArtifactPaths.Paths, "/etc/passwd")
+			},
+			wantErr: "could not verify",
+		},
+		{
+			name: "artifacts signature, cache removed",
+			sig:  artifactsSig,
+			modify: func(s *CommandStepWithInvariants) {
+				s.Cache = nil
+			},
+			wantErr: "could not verify",
+		},
+		{
+			name:    "compat signature, artifacts profile required",
+			sig:     compatSig,
+			opts:    []Option{WithProfile(ProfileArtifacts)},
+			wantErr: `does not cover field "artifact_paths"`,
+		},
+		{
+			name: "strict signature satisfies artifacts profile",
+			sig:  strictSig,
+			opts: []Option{WithProfile(ProfileArtifacts)},
+		},
+		{
+			name:    "artifacts signature doesn't satisfy strict profile",
+			sig:     artifactsSig,
+			opts:    []Option{WithProfile(ProfileStrict)},
+			wantErr: "does not cover field",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			step := newStep()
+			if test.modify != nil {
+				test.modify(step)
+			}
+			err := Verify(ctx, test.sig, keySet, step, test.opts...)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify(ctx, sig, keySet, step, opts...) error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Verify(ctx, sig, keySet, step, opts...) error = %v, want error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignVerifyUnknownProfile(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewKeyPair(keyID, jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(%q, EdDSA) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	step := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "make deploy"},
+		RepositoryURL: fakeRepositoryURL,
+	}
+	sig, err := Sign(ctx, signingKey(t, key), step)
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step) error = %v", err)
+	}
+
+	// Profile names are case-sensitive, so this isn't ProfileStrict.
+	unknown := WithProfile(Profile("Strict"))
+	if _, err := Sign(ctx, signingKey(t, key), step, unknown); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Sign(ctx, key, step, WithProfile(Strict)) error = %v, want %v", err, ErrUnknownProfile)
+	}
+	if _, err := SignWithKeySet(ctx, signer, step, unknown); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("SignWithKeySet(ctx, signer, step, WithProfile(Strict)) error = %v, want %v", err, ErrUnknownProfile)
+	}
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), step, unknown); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Verify(ctx, sig, verifier, step, WithProfile(Strict)) error = %v, want %v", err, ErrUnknownProfile)
+	}
+}
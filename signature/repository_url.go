@@ -0,0 +1,78 @@
+package signature
+
+import (
+	"net/url"
+	"strings"
+)
+
+// CanonicalRepositoryURL normalises the various ways of writing a Git
+// repository URL into a single form, so that the same repository produces the
+// same invariant value whether it was cloned over SSH, HTTPS, or the git
+// protocol. For example, all of these:
+//
+//	git@github.com:buildkite/agent.git
+//	ssh://git@github.com/buildkite/agent.git
+//	https://github.com/buildkite/agent
+//	git://github.com/buildkite/agent.git
+//
+// canonicalise to github.com/buildkite/agent. User info, a trailing ".git",
+// and trailing slashes are removed, and the host is lowercased. Ports are
+// kept (as in git.example.com:2222/org/repo), since a server on another port
+// can serve different repositories, unless they are the default port of the
+// scheme.
+// Strings that don't look like a remote repository URL (such as local paths)
+// are returned with only surrounding whitespace removed.
+func CanonicalRepositoryURL(s string) string {
+	s = strings.TrimSpace(s)
+
+	var host, path string
+	switch {
+	case strings.Contains(s, "://"):
+		u, err := url.Parse(s)
+		if err != nil {
+			return s
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "ssh", "git", "http", "https", "git+ssh", "ssh+git":
+		default:
+			return s
+		}
+		host, path = u.Hostname(), u.Path
+		if port := u.Port(); port != "" && port != defaultPorts[strings.ToLower(u.Scheme)] {
+			host += ":" + port
+		}
+
+	default:
+		// scp-like syntax: [user@]host:path
+		h, p, ok := strings.Cut(s, ":")
+		if !ok || len(h) < 2 || strings.ContainsAny(h, `/\`) {
+			return s
+		}
+		if _, after, ok := strings.Cut(h, "@"); ok {
+			h = after
+		}
+		host, path = h, p
+	}
+
+	if host == "" {
+		return s
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	host = strings.ToLower(host)
+	if path == "" {
+		return host
+	}
+	return host + "/" + path
+}
+
+// defaultPorts are the default ports of the schemes of repository URLs.
+var defaultPorts = map[string]string{
+	"ssh":     "22",
+	"git+ssh": "22",
+	"ssh+git": "22",
+	"git":     "9418",
+	"http":    "80",
+	"https":   "443",
+}
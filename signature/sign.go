@@ -2,16 +2,19 @@ package signature
 
 import (
 	"context"
-	"crypto"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/buildkite/go-pipeline"
-	"github.com/gowebpki/jcs"
+	"github.com/buildkite/go-pipeline/internal/canonical"
+	"github.com/buildkite/go-pipeline/jwkutil"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jws"
@@ -40,12 +43,21 @@ type SignedFielder interface {
 	ValuesForFields([]string) (map[string]any, error)
 }
 
-type Logger interface{ Debug(f string, v ...any) }
-
 type options struct {
-	env          map[string]string
-	logger       Logger
-	debugSigning bool
+	env            map[string]string
+	logger         *slog.Logger
+	debugSigning   bool
+	repositoryURLs []string
+	verifyTime     time.Time
+	signGroups     bool
+	requireGroups  bool
+	verifyPolicies []VerifyPolicy
+	stepFilters    []StepFilter
+	skipSigned     bool
+	verifyCache    VerifyCache
+	profile        Profile
+	exemptions     bool
+	canonicalRepo  bool
 }
 
 type Option interface {
@@ -53,17 +65,136 @@ type Option interface {
 }
 
 type envOption struct{ env map[string]string }
-type loggerOption struct{ logger Logger }
 type debugSigningOption struct{ debugSigning bool }
-
-func (o envOption) apply(opts *options)          { opts.env = o.env }
-func (o loggerOption) apply(opts *options)       { opts.logger = o.logger }
-func (o debugSigningOption) apply(opts *options) { opts.debugSigning = o.debugSigning }
+type repositoryURLsOption struct{ urls []string }
+type verifyTimeOption struct{ t time.Time }
+type signGroupsOption struct{ signGroups bool }
+type requireSignedGroupsOption struct{ require bool }
+type verifyPolicyOption struct{ policy VerifyPolicy }
+type stepFilterOption struct{ filter StepFilter }
+type skipSignedOption struct{ skipSigned bool }
+type verifyCacheOption struct{ cache VerifyCache }
+type signedExemptionsOption struct{ exemptions bool }
+type canonicalRepositoryURLOption struct{ canonical bool }
+
+func (o envOption) apply(opts *options)            { opts.env = o.env }
+func (o debugSigningOption) apply(opts *options)   { opts.debugSigning = o.debugSigning }
+func (o repositoryURLsOption) apply(opts *options) { opts.repositoryURLs = o.urls }
+func (o verifyTimeOption) apply(opts *options)     { opts.verifyTime = o.t }
+func (o signGroupsOption) apply(opts *options)     { opts.signGroups = o.signGroups }
+func (o requireSignedGroupsOption) apply(opts *options) {
+	opts.requireGroups = o.require
+}
+func (o verifyPolicyOption) apply(opts *options) {
+	opts.verifyPolicies = append(opts.verifyPolicies, o.policy)
+}
+func (o stepFilterOption) apply(opts *options) {
+	opts.stepFilters = append(opts.stepFilters, o.filter)
+}
+func (o skipSignedOption) apply(opts *options)  { opts.skipSigned = o.skipSigned }
+func (o verifyCacheOption) apply(opts *options) { opts.verifyCache = o.cache }
+func (o signedExemptionsOption) apply(opts *options) {
+	opts.exemptions = o.exemptions
+}
+func (o canonicalRepositoryURLOption) apply(opts *options) {
+	opts.canonicalRepo = o.canonical
+}
 
 func WithEnv(env map[string]string) Option      { return envOption{env} }
-func WithLogger(logger Logger) Option           { return loggerOption{logger} }
 func WithDebugSigning(debugSigning bool) Option { return debugSigningOption{debugSigning} }
 
+// WithEquivalentRepositoryURLs declares a set of repository URLs that refer to
+// the same repository (for example, the SSH and HTTPS forms of a mirrored
+// repository). When Verify is checking a signature covering a repository URL
+// that is in the set, a signature made with any URL in the set is accepted.
+// Sign ignores this option.
+func WithEquivalentRepositoryURLs(urls ...string) Option { return repositoryURLsOption{urls} }
+
+// WithCanonicalRepositoryURL makes SignSteps sign the repository URL in its
+// canonical form (see CanonicalRepositoryURL) rather than as given, and makes
+// Verify also accept signatures covering the canonical form of the repository
+// URL it is given, so that signatures verify whichever form of the URL the
+// agent checked the repository out with. The canonical form treats URLs that
+// differ in scheme, user info, and default ports as the same repository, so
+// both signing and verifying must opt in, and this is off by default.
+// Sign ignores this option.
+func WithCanonicalRepositoryURL(canonical bool) Option {
+	return canonicalRepositoryURLOption{canonical}
+}
+
+// WithVerificationTime sets the time used by Verify to decide which keys have
+// been retired (see jwkutil.NotAfter). The default is the current time.
+// Sign ignores this option.
+func WithVerificationTime(t time.Time) Option { return verifyTimeOption{t} }
+
+// WithSignedGroups makes SignSteps also sign group steps (see
+// GroupStepWithInvariants), so that renaming or reordering groups, or moving
+// steps between them, is tamper-evident. Sign and Verify ignore this option.
+func WithSignedGroups(signGroups bool) Option { return signGroupsOption{signGroups} }
+
+// WithRequireSignedGroups makes VerifyPipelineParallel fail group steps
+// without a signature, rather than leaving them unverified. Use it for
+// pipelines signed with WithSignedGroups, so that a group's signature can't be
+// removed to hide changes to the group. Sign, Verify, and SignSteps ignore
+// this option.
+func WithRequireSignedGroups(require bool) Option { return requireSignedGroupsOption{require} }
+
+// WithStepFilter makes SignSteps only sign the command and trigger steps for
+// which filter returns true. It can be given multiple times; a step is signed
+// only if all filters return true. Sign and Verify ignore this option.
+func WithStepFilter(filter StepFilter) Option { return stepFilterOption{filter} }
+
+// WithSkipSigned makes SignSteps leave command and trigger steps that already
+// have a valid signature unchanged, so that only new or modified steps in a
+// pipeline are signed. Existing signatures are checked with the public key of
+// the signing key (or keys), and steps whose signatures no longer verify are
+// signed again. Sign and Verify ignore this option.
+func WithSkipSigned(skipSigned bool) Option { return skipSignedOption{skipSigned} }
+
+// WithSignedExemptions makes VerifyPipelineParallel honour the pipeline's
+// exemptions record (see SignExemptions): once the record's signature is
+// verified, unsigned command and trigger steps with exempt keys pass
+// verification. Steps that are signed are verified as usual, even if exempt.
+// Sign, Verify, and SignSteps ignore this option.
+func WithSignedExemptions(exemptions bool) Option { return signedExemptionsOption{exemptions} }
+
+// VerifyPolicy is a function that Verify calls to enforce extra constraints
+// on a signature. fields contains the values covered by the signature
+// (including env:: values), and must not be modified. Returning an error
+// causes verification to fail.
+type VerifyPolicy func(sig *pipeline.Signature, fields map[string]any) error
+
+// WithVerifyPolicy adds a policy that Verify checks before verifying the
+// signature itself. It can be given multiple times; all policies must pass.
+// Sign ignores this option.
+func WithVerifyPolicy(policy VerifyPolicy) Option { return verifyPolicyOption{policy} }
+
+// AllowAlgorithms returns a VerifyPolicy that rejects signatures made with
+// algorithms other than those listed.
+func AllowAlgorithms(algs ...jwa.SignatureAlgorithm) VerifyPolicy {
+	return func(sig *pipeline.Signature, _ map[string]any) error {
+		for _, alg := range algs {
+			if sig.Algorithm == alg.String() {
+				return nil
+			}
+		}
+		return fmt.Errorf("signature algorithm %q is not allowed", sig.Algorithm)
+	}
+}
+
+// RequireSignedFields returns a VerifyPolicy that rejects signatures that do
+// not cover all the given fields.
+func RequireSignedFields(fields ...string) VerifyPolicy {
+	return func(_ *pipeline.Signature, signed map[string]any) error {
+		for _, f := range fields {
+			if _, ok := signed[f]; !ok {
+				return fmt.Errorf("signature does not cover required field %q", f)
+			}
+		}
+		return nil
+	}
+}
+
 func configureOptions(opts ...Option) options {
 	options := options{
 		env: make(map[string]string),
@@ -74,22 +205,141 @@ func configureOptions(opts ...Option) options {
 	return options
 }
 
-type Key interface {
-	Algorithm() jwa.KeyAlgorithm
+// Sign computes a new signature for an environment (env) combined with an
+// object containing values (sf) using a given key. The public key thumbprint
+// is logged.
+func Sign(ctx context.Context, key *SigningKey, sf SignedFielder, opts ...Option) (*pipeline.Signature, error) {
+	options := configureOptions(opts...)
+
+	if key == nil {
+		return nil, errors.New("no signing key")
+	}
+
+	fields, payload, err := signingPayload(ctx, key.alg.String(), sf, options)
+	if err != nil {
+		return nil, err
+	}
+
+	logAt(ctx, options.logger, slog.LevelDebug, msgThumbprint, "thumbprint", fmt.Sprintf("%x", key.thumbprint))
+
+	sig, err := jws.Sign(nil,
+		jws.WithKey(key.alg, key.key),
+		jws.WithDetachedPayload(payload),
+		jws.WithCompact(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeline.Signature{
+		Algorithm:    key.alg.String(),
+		SignedFields: fields,
+		Value:        string(sig),
+	}, nil
 }
 
-// Sign computes a new signature for an environment (env) combined with an
-// object containing values (sf) using a given key. The key can be a jwk.Key
-// or a crypto.Signer. If it is a jwk.Key, the public key thumbprint is logged.
-func Sign(_ context.Context, key Key, sf SignedFielder, opts ...Option) (*pipeline.Signature, error) {
+// SignWithKeySet is like Sign, but signs with every key in keys that has not
+// been retired (see jwkutil.NotAfter). The signature value is a JWS in JSON
+// serialisation, with one signature per key, which Verify accepts if any of
+// them can be verified. This keeps pipelines verifiable during a key rotation,
+// when agents may only hold either the old or the new public key.
+// All the keys must use the same algorithm.
+func SignWithKeySet(ctx context.Context, keys jwk.Set, sf SignedFielder, opts ...Option) (*pipeline.Signature, error) {
 	options := configureOptions(opts...)
 
-	values, err := sf.SignedFields()
+	if keys == nil || keys.Len() == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	now := time.Now()
+	unexpired, err := jwkutil.Unexpired(keys, now)
+	if err != nil {
+		return nil, fmt.Errorf("filtering expired keys: %w", err)
+	}
+	if unexpired.Len() < keys.Len() {
+		logRetiredKeys(ctx, options.logger, keys, now)
+	}
+	if unexpired.Len() == 0 {
+		return nil, errors.New("all signing keys have been retired")
+	}
+
+	var alg jwa.KeyAlgorithm
+	signOpts := make([]jws.SignOption, 0, unexpired.Len()+2)
+	for it := unexpired.Keys(ctx); it.Next(ctx); {
+		key, err := NewSigningKey(it.Pair().Value.(jwk.Key))
+		if err != nil {
+			return nil, err
+		}
+		if alg == nil {
+			alg = key.alg
+		} else if key.alg.String() != alg.String() {
+			return nil, fmt.Errorf("signing keys use different algorithms (%q and %q)", alg, key.alg)
+		}
+
+		logAt(ctx, options.logger, slog.LevelDebug, msgThumbprint, "thumbprint", fmt.Sprintf("%x", key.thumbprint))
+		signOpts = append(signOpts, jws.WithKey(key.alg, key.key))
+	}
+
+	fields, payload, err := signingPayload(ctx, alg.String(), sf, options)
 	if err != nil {
 		return nil, err
 	}
+
+	signOpts = append(signOpts, jws.WithJSON())
+	sig, err := jws.Sign(payload, signOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// jws doesn't support detached payloads in JSON serialisation, so remove
+	// the payload afterwards. Verify supplies it again.
+	sig, err = detachJSONPayload(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeline.Signature{
+		Algorithm:    alg.String(),
+		SignedFields: fields,
+		Value:        string(sig),
+	}, nil
+}
+
+// detachJSONPayload removes the payload from a JWS in JSON serialisation.
+func detachJSONPayload(sig []byte) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(sig, &m); err != nil {
+		return nil, fmt.Errorf("unmarshaling JWS: %w", err)
+	}
+	delete(m, "payload")
+	return json.Marshal(m)
+}
+
+// signingPayload obtains the fields to sign from sf, combines them with the
+// env, and returns the sorted field names and the canonical payload.
+func signingPayload(ctx context.Context, alg string, sf SignedFielder, options options) ([]string, []byte, error) {
+	if err := options.profile.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	values, err := sf.SignedFields()
+	if err != nil {
+		return nil, nil, err
+	}
 	if len(values) == 0 {
-		return nil, errors.New("no fields to sign")
+		return nil, nil, errors.New("no fields to sign")
+	}
+
+	// Fetch the values of any extra fields required by the profile.
+	if extra := profileFields(sf, options.profile); len(extra) > 0 {
+		fields := slices.Clone(extra)
+		for f := range values {
+			if !slices.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+		if values, err = sf.ValuesForFields(fields); err != nil {
+			return nil, nil, fmt.Errorf("obtaining values for profile %q: %w", options.profile, err)
+		}
 	}
 
 	// Step env overrides pipeline and build env:
@@ -114,65 +364,39 @@ func Sign(_ context.Context, key Key, sf SignedFielder, opts ...Option) (*pipeli
 	}
 	sort.Strings(fields)
 
-	payload, err := canonicalPayload(key.Algorithm().String(), values)
+	payload, err := canonicalPayload(alg, values)
 	if err != nil {
-		return nil, err
-	}
-
-	switch key := key.(type) {
-	case jwk.Key:
-		pk, err := key.PublicKey()
-		if err != nil {
-			return nil, fmt.Errorf("unable to generate public key: %w", err)
-		}
-
-		fingerprint, err := pk.Thumbprint(crypto.SHA256)
-		if err != nil {
-			return nil, fmt.Errorf("calculating key thumbprint: %w", err)
-		}
-
-		debug(options.logger, "Public Key Thumbprint (sha256): %x", fingerprint)
-	case crypto.Signer:
-		data, err := x509.MarshalPKIXPublicKey(key.Public())
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal public key: %w", err)
-		}
-
-		debug(options.logger, "Public Key Thumbprint (sha256): %x", sha256.Sum256(data))
-	default:
-		panic(fmt.Sprintf("unsupported key type: %T", key)) // should never happen
+		return nil, nil, err
 	}
 
 	if options.debugSigning {
-		debug(options.logger, "Signed Step: %s checksum: %x", payload, sha256.Sum256(payload))
+		logAt(ctx, options.logger, slog.LevelDebug, msgSignedStep, "payload", string(payload), "checksum", fmt.Sprintf("%x", sha256.Sum256(payload)))
 	}
-
-	sig, err := jws.Sign(nil,
-		jws.WithKey(key.Algorithm(), key),
-		jws.WithDetachedPayload(payload),
-		jws.WithCompact(),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &pipeline.Signature{
-		Algorithm:    key.Algorithm().String(),
-		SignedFields: fields,
-		Value:        string(sig),
-	}, nil
+	return fields, payload, nil
 }
 
 // Verify verifies an existing signature against environment (env) combined with
-// the keyset. The keySet can be a jwk.Set or a crypto.Signer. If it is a jwk.Set,
-// the public key thumbprints are logged.
-func Verify(ctx context.Context, s *pipeline.Signature, keySet any, sf SignedFielder, opts ...Option) error {
+// the keyset. The public key thumbprints are logged, and keys that have been
+// retired (see jwkutil.NotAfter) are not trusted. A signature made with
+// SignWithKeySet is accepted if any one of its signatures can be verified.
+func Verify(ctx context.Context, s *pipeline.Signature, keySet *VerificationKeySet, sf SignedFielder, opts ...Option) error {
 	options := configureOptions(opts...)
 
+	if keySet == nil {
+		return errors.New("no verification keys")
+	}
+
 	if len(s.SignedFields) == 0 {
 		return errors.New("signature covers no fields")
 	}
 
+	if err := options.profile.validate(); err != nil {
+		return err
+	}
+	if err := checkProfile(sf, options.profile, s.SignedFields); err != nil {
+		return err
+	}
+
 	// Ask the object for values for all fields.
 	values, err := sf.ValuesForFields(s.SignedFields)
 	if err != nil {
@@ -201,48 +425,127 @@ func Verify(ctx context.Context, s *pipeline.Signature, keySet any, sf SignedFie
 		return fmt.Errorf("obtaining required keys: %w", err)
 	}
 
-	payload, err := canonicalPayload(s.Algorithm, required)
+	for _, policy := range options.verifyPolicies {
+		if err := policy(s, required); err != nil {
+			return fmt.Errorf("verify policy: %w", err)
+		}
+	}
+
+	now := options.verifyTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	keyOpt, keysDigest, err := keySet.verifyOption(ctx, now, options.logger)
 	if err != nil {
 		return err
 	}
 
-	if options.debugSigning {
-		debug(options.logger, "Signed Step: %s checksum: %x", payload, sha256.Sum256(payload))
-	}
-
-	var keyOpt jws.VerifyOption
-	switch keySet := keySet.(type) {
-	case jwk.Set:
-		for it := keySet.Keys(ctx); it.Next(ctx); {
-			pair := it.Pair()
-			publicKey := pair.Value.(jwk.Key)
-			fingerprint, err := publicKey.Thumbprint(crypto.SHA256)
-			if err != nil {
-				return fmt.Errorf("calculating key thumbprint: %w", err)
-			}
+	// The signature could have been made with the canonical form of the
+	// repository URL (if allowed), or any repository URL equivalent to the
+	// one we have. Try ours first.
+	sigValues, err := compactSignatures(s.Value)
+	if err != nil {
+		return err
+	}
 
-			debug(options.logger, "Public Key Thumbprint (sha256): %x", fingerprint)
+	var firstErr error
+	for i, repoURL := range repositoryURLCandidates(required, options.repositoryURLs, options.canonicalRepo) {
+		if repoURL != "" {
+			required["repository_url"] = repoURL
 		}
 
-		keyOpt = jws.WithKeySet(keySet)
-	case crypto.Signer:
-		data, err := x509.MarshalPKIXPublicKey(keySet.Public())
+		payload, err := canonicalPayload(s.Algorithm, required)
 		if err != nil {
-			return fmt.Errorf("failed to marshal public key: %w", err)
+			return err
+		}
+
+		if options.debugSigning {
+			logAt(ctx, options.logger, slog.LevelDebug, msgSignedStep, "payload", string(payload), "checksum", fmt.Sprintf("%x", sha256.Sum256(payload)))
 		}
 
-		debug(options.logger, "Public Key Thumbprint (sha256): %x", sha256.Sum256(data))
+		var cacheKey string
+		if options.verifyCache != nil {
+			cacheKey = verifyCacheKey(keysDigest, s, payload)
+			if options.verifyCache.Contains(cacheKey) {
+				return nil
+			}
+		}
 
-		keyOpt = jws.WithKey(jwa.ES256, keySet)
-	default:
-		panic(fmt.Sprintf("unsupported key type: %T", keySet)) // should never happen
+		for _, sigValue := range sigValues {
+			_, err = jws.Verify([]byte(sigValue),
+				keyOpt,
+				jws.WithDetachedPayload(payload),
+			)
+			if err == nil {
+				if options.verifyCache != nil {
+					options.verifyCache.Add(cacheKey)
+				}
+				if i > 0 {
+					logAt(ctx, options.logger, slog.LevelInfo, "Verified signature made with another form of the repository URL", "repository_url", repoURL)
+				}
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
+	return firstErr
+}
 
-	_, err = jws.Verify([]byte(s.Value),
-		keyOpt,
-		jws.WithDetachedPayload(payload),
-	)
-	return err
+// compactSignatures splits a signature value into JWSes in compact
+// serialisation. A value from SignWithKeySet (in JSON serialisation) contains
+// one for each key; any other value is returned as it is.
+func compactSignatures(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "{") {
+		return []string{value}, nil
+	}
+	var msg struct {
+		Signatures []struct {
+			Protected string `json:"protected"`
+			Signature string `json:"signature"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal([]byte(value), &msg); err != nil {
+		return nil, fmt.Errorf("unmarshaling JWS: %w", err)
+	}
+	if len(msg.Signatures) == 0 {
+		return nil, errors.New("JWS contains no signatures")
+	}
+	out := make([]string, 0, len(msg.Signatures))
+	for _, sig := range msg.Signatures {
+		// The payload is detached, so it is omitted from the middle.
+		out = append(out, sig.Protected+".."+sig.Signature)
+	}
+	return out, nil
+}
+
+// repositoryURLCandidates returns the repository URLs to try when verifying.
+// If the values don't include a repository URL, the only candidate is the
+// empty string (meaning "use the values as they are"). Otherwise the
+// candidates are the repository URL as given, its canonical form (see
+// CanonicalRepositoryURL) if canonical is true, and, if it is one of the
+// equivalent URLs, the other equivalent URLs.
+func repositoryURLCandidates(values map[string]any, equivalent []string, canonical bool) []string {
+	repoURL, ok := values["repository_url"].(string)
+	if !ok {
+		return []string{""}
+	}
+	candidates := []string{repoURL}
+	add := func(u string) {
+		if !slices.Contains(candidates, u) {
+			candidates = append(candidates, u)
+		}
+	}
+	if canonical {
+		add(CanonicalRepositoryURL(repoURL))
+	}
+	if slices.Contains(equivalent, repoURL) {
+		for _, u := range equivalent {
+			add(u)
+		}
+	}
+	return candidates
 }
 
 // EmptyToNilMap returns a nil map if m is empty, otherwise it returns m.
@@ -295,21 +598,13 @@ func EmptyToNilPtr[V any, P pointerEmptyable[V]](p P) P {
 // canonicalPayload returns a unique sequence of bytes representing the given
 // algorithm and values using JCS (RFC 8785).
 func canonicalPayload(alg string, values map[string]any) ([]byte, error) {
-	rawPayload, err := json.Marshal(struct {
+	return canonical.JSON(struct {
 		Algorithm string         `json:"alg"`
 		Values    map[string]any `json:"values"`
 	}{
 		Algorithm: alg,
 		Values:    values,
 	})
-	if err != nil {
-		return nil, fmt.Errorf("marshaling JSON: %w", err)
-	}
-	payload, err := jcs.Transform(rawPayload)
-	if err != nil {
-		return nil, fmt.Errorf("canonicalising JSON: %w", err)
-	}
-	return payload, nil
 }
 
 // requireKeys returns a copy of a map containing only keys from a []string.
@@ -325,9 +620,3 @@ func requireKeys[K comparable, V any, M ~map[K]V](in M, keys []K) (M, error) {
 	}
 	return out, nil
 }
-
-func debug(logger Logger, f string, v ...any) {
-	if logger != nil {
-		logger.Debug(f, v...)
-	}
-}
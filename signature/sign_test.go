@@ -15,6 +15,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/buildkite/go-pipeline"
 	"github.com/buildkite/go-pipeline/jwkutil"
@@ -27,6 +28,28 @@ const (
 	fakeRepositoryURL = "fake-repo"
 )
 
+// signingKey wraps a jwk.Key in a SigningKey.
+func signingKey(t *testing.T, key jwk.Key) *SigningKey {
+	t.Helper()
+
+	sk, err := NewSigningKey(key)
+	if err != nil {
+		t.Fatalf("NewSigningKey(%v) error = %v", key, err)
+	}
+	return sk
+}
+
+// verificationKeySet wraps a jwk.Set in a VerificationKeySet.
+func verificationKeySet(t *testing.T, set jwk.Set) *VerificationKeySet {
+	t.Helper()
+
+	ks, err := NewVerificationKeySet(set)
+	if err != nil {
+		t.Fatalf("NewVerificationKeySet(%v) error = %v", set, err)
+	}
+	return ks
+}
+
 func TestSignVerify(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -106,7 +129,7 @@ func TestSignVerify(t *testing.T) {
 				t.Fatalf("jwkutil.LoadKey(%v, %v) error = %v", privPath, keyName, err)
 			}
 
-			sig, err := Sign(ctx, sKey, stepWithInvariants, WithEnv(signEnv))
+			sig, err := Sign(ctx, signingKey(t, sKey), stepWithInvariants, WithEnv(signEnv))
 			if err != nil {
 				t.Fatalf("Sign(ctx, sKey, %v, WithEnv(%v)) error = %v", stepWithInvariants, signEnv, err)
 			}
@@ -115,6 +138,10 @@ func TestSignVerify(t *testing.T) {
 				t.Errorf("Signature.Algorithm = %v, want %v", sig.Algorithm, tc.alg)
 			}
 
+			if err := sig.ValidateFormat(); err != nil {
+				t.Errorf("Signature.ValidateFormat() = %v, want nil", err)
+			}
+
 			if slices.Contains([]jwa.SignatureAlgorithm{jwa.EdDSA, jwa.HS512}, tc.alg) {
 				// These algorithms are deterministic across keys, so we can check the signature value
 				if sig.Value != tc.expectedSignature {
@@ -132,7 +159,7 @@ func TestSignVerify(t *testing.T) {
 				t.Fatalf("verifier.AddKey(%v) error = %v", vKey, err)
 			}
 
-			if err := Verify(ctx, sig, verifier, stepWithInvariants, WithEnv(verifyEnv)); err != nil {
+			if err := Verify(ctx, sig, verificationKeySet(t, verifier), stepWithInvariants, WithEnv(verifyEnv)); err != nil {
 				t.Errorf("Verify(ctx, %v, verifier, %v, WithEnv(%v)) = %v", sig, stepWithInvariants, verifyEnv, err)
 			}
 		})
@@ -152,10 +179,6 @@ func (m testECDSASigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerO
 	return ecdsa.SignASN1(rand, m.privateKey.(*ecdsa.PrivateKey), digest)
 }
 
-func (m testECDSASigner) Algorithm() jwa.KeyAlgorithm {
-	return jwa.ES256
-}
-
 func TestSignVerifyCryptoSigner(t *testing.T) {
 
 	t.Parallel()
@@ -249,7 +272,12 @@ func TestSignVerifyCryptoSigner(t *testing.T) {
 				publickKey: publicKey,
 			}
 
-			sig, err := Sign(ctx, sKey, stepWithInvariants, WithEnv(signEnv))
+			signer, err := NewSigningKeyFromSigner(sKey, tc.alg)
+			if err != nil {
+				t.Fatalf("NewSigningKeyFromSigner(sKey, %v) error = %v", tc.alg, err)
+			}
+
+			sig, err := Sign(ctx, signer, stepWithInvariants, WithEnv(signEnv))
 			if err != nil {
 				t.Fatalf("Sign(ctx, sKey, %v, WithEnv(%v)) error = %v", stepWithInvariants, signEnv, err)
 			}
@@ -258,7 +286,12 @@ func TestSignVerifyCryptoSigner(t *testing.T) {
 				t.Errorf("Signature.Algorithm = %v, want %v", sig.Algorithm, tc.alg)
 			}
 
-			if err := Verify(ctx, sig, sKey, stepWithInvariants, WithEnv(verifyEnv)); err != nil {
+			verifier, err := NewVerificationKeySetFromPublicKey(publicKey, tc.alg)
+			if err != nil {
+				t.Fatalf("NewVerificationKeySetFromPublicKey(publicKey, %v) error = %v", tc.alg, err)
+			}
+
+			if err := Verify(ctx, sig, verifier, stepWithInvariants, WithEnv(verifyEnv)); err != nil {
 				t.Errorf("Verify(ctx, %v, verifier, %v, WithEnv(%v)) = %v", sig, stepWithInvariants, verifyEnv, err)
 			}
 
@@ -322,7 +355,7 @@ func TestSignConcatenatedFields(t *testing.T) {
 	}
 
 	for _, m := range maps {
-		sig, err := Sign(ctx, key, m)
+		sig, err := Sign(ctx, signingKey(t, key), m)
 		if err != nil {
 			t.Fatalf("Sign(ctx, key, %v) error = %v", m, err)
 		}
@@ -364,7 +397,7 @@ func TestUnknownAlgorithm(t *testing.T) {
 		},
 	}
 
-	if _, err := Sign(ctx, key, step); err == nil {
+	if _, err := Sign(ctx, signingKey(t, key), step); err == nil {
 		t.Errorf("Sign(ctx, key, %v) = %v, want non-nil error", step, err)
 	}
 }
@@ -387,7 +420,7 @@ func TestVerifyBadSignature(t *testing.T) {
 		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, %q, %q) error = %v", keyID, keyStr, keyAlg, err)
 	}
 
-	if err := Verify(ctx, sig, verifier, cs); err == nil {
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), cs); err == nil {
 		t.Errorf("Verify(ctx, sig, verifier, %v) = %v, want non-nil error", cs, err)
 	}
 }
@@ -413,8 +446,8 @@ func TestSignUnknownStep(t *testing.T) {
 		t.Fatalf("signer.Key(0) = _, false, want true")
 	}
 
-	if err := SignSteps(ctx, steps, key, ""); !errors.Is(err, errSigningRefusedUnknownStepType) {
-		t.Errorf(`SignSteps(ctx, %v, key, "") = %v, want %v`, steps, err, errSigningRefusedUnknownStepType)
+	if err := SignSteps(ctx, steps, signingKey(t, key), ""); !errors.Is(err, errSigningRefusedUnknownStepType) {
+		t.Errorf(`SignSteps(ctx, %v, signingKey(t, key), "") = %v, want %v`, steps, err, errSigningRefusedUnknownStepType)
 	}
 }
 
@@ -504,12 +537,12 @@ func TestSignVerifyEnv(t *testing.T) {
 				RepositoryURL: tc.repositoryURL,
 			}
 
-			sig, err := Sign(ctx, key, stepWithInvariants, WithEnv(tc.pipelineEnv))
+			sig, err := Sign(ctx, signingKey(t, key), stepWithInvariants, WithEnv(tc.pipelineEnv))
 			if err != nil {
 				t.Fatalf("Sign(ctx, key, %v, WithEnv(%v)) error = %v", stepWithInvariants, tc.pipelineEnv, err)
 			}
 
-			if err := Verify(ctx, sig, verifier, stepWithInvariants, WithEnv(tc.verifyEnv)); err != nil {
+			if err := Verify(ctx, sig, verificationKeySet(t, verifier), stepWithInvariants, WithEnv(tc.verifyEnv)); err != nil {
 				t.Errorf("Verify(ctx, %v, verifier, %v, WithEnv(%v)) = %v", sig, stepWithInvariants, tc.verifyEnv, err)
 			}
 		})
@@ -628,18 +661,360 @@ func TestSignVerify_NilVsEmpty(t *testing.T) {
 				RepositoryURL: fakeRepositoryURL,
 			}
 
-			sig, err := Sign(ctx, key, toSign)
+			sig, err := Sign(ctx, signingKey(t, key), toSign)
 			if err != nil {
 				t.Fatalf("Sign(ctx, key, %v) error = %v", toSign, err)
 			}
 
-			if err := Verify(ctx, sig, verifier, toVerify); err != nil {
+			if err := Verify(ctx, sig, verificationKeySet(t, verifier), toVerify); err != nil {
 				t.Errorf("Verify(ctx, %v, verifier, %v) = %v", sig, toVerify, err)
 			}
 		})
 	}
 }
 
+func TestSignVerifyTriggerStep(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	keyStr, keyAlg := "alpacas", jwa.HS256
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, keyStr, keyAlg)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, %q, %q) error = %v", keyID, keyStr, keyAlg, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	step := &pipeline.TriggerStep{
+		Trigger: "deploy",
+		Build: &pipeline.TriggerBuild{
+			Message: "Deploying",
+			Env:     map[string]string{"ENVIRONMENT": "production"},
+		},
+	}
+	steps := pipeline.Steps{
+		&pipeline.GroupStep{Steps: pipeline.Steps{step}},
+	}
+	if err := SignSteps(ctx, steps, signingKey(t, key), fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, %v, key, %q) error = %v", steps, fakeRepositoryURL, err)
+	}
+	if step.Signature == nil {
+		t.Fatalf("step.Signature = nil, want a signature")
+	}
+
+	cases := []struct {
+		name    string
+		step    pipeline.TriggerStep
+		wantErr bool
+	}{
+		{
+			name: "unchanged",
+			step: *step,
+		},
+		{
+			name: "empty build attributes are equivalent",
+			step: pipeline.TriggerStep{
+				Trigger: "deploy",
+				Build: &pipeline.TriggerBuild{
+					Message:  "Deploying",
+					Env:      map[string]string{"ENVIRONMENT": "production"},
+					MetaData: map[string]string{},
+				},
+			},
+		},
+		{
+			name:    "different pipeline",
+			step:    pipeline.TriggerStep{Trigger: "evil", Build: step.Build},
+			wantErr: true,
+		},
+		{
+			name: "different build env",
+			step: pipeline.TriggerStep{
+				Trigger: "deploy",
+				Build: &pipeline.TriggerBuild{
+					Message: "Deploying",
+					Env:     map[string]string{"ENVIRONMENT": "production", "EVIL": "1"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no build attributes",
+			step:    pipeline.TriggerStep{Trigger: "deploy"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			toVerify := &TriggerStepWithInvariants{
+				TriggerStep:   tc.step,
+				RepositoryURL: fakeRepositoryURL,
+			}
+			err := Verify(ctx, step.Signature, verificationKeySet(t, verifier), toVerify)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Verify(ctx, %v, verifier, %v) = %v, want error = %t", step.Signature, toVerify, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignVerifyGroupStep(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	keyStr, keyAlg := "alpacas", jwa.HS256
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, keyStr, keyAlg)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, %q, %q) error = %v", keyID, keyStr, keyAlg, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	newGroup := func() *pipeline.GroupStep {
+		label := "Tests"
+		return &pipeline.GroupStep{
+			Key:   "tests",
+			Group: &label,
+			Steps: pipeline.Steps{
+				&pipeline.CommandStep{Command: "make test"},
+				&pipeline.WaitStep{},
+				&pipeline.CommandStep{Command: "make lint"},
+			},
+			RemainingFields: map[string]any{"depends_on": "build"},
+		}
+	}
+
+	unsigned := newGroup()
+	if err := SignSteps(ctx, pipeline.Steps{unsigned}, signingKey(t, key), fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q) error = %v", fakeRepositoryURL, err)
+	}
+	if unsigned.Signature != nil {
+		t.Errorf("without WithSignedGroups, group.Signature = %v, want nil", unsigned.Signature)
+	}
+
+	group := newGroup()
+	if err := SignSteps(ctx, pipeline.Steps{group}, signingKey(t, key), fakeRepositoryURL, WithSignedGroups(true)); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q, WithSignedGroups(true)) error = %v", fakeRepositoryURL, err)
+	}
+	if group.Signature == nil {
+		t.Fatalf("group.Signature = nil, want a signature")
+	}
+
+	relabelled := "Totally the tests"
+	cases := []struct {
+		name    string
+		modify  func(*pipeline.GroupStep)
+		wantErr bool
+	}{
+		{
+			name:   "unchanged",
+			modify: func(*pipeline.GroupStep) {},
+		},
+		{
+			name:    "relabelled",
+			modify:  func(g *pipeline.GroupStep) { g.Group = &relabelled },
+			wantErr: true,
+		},
+		{
+			name:    "different dependencies",
+			modify:  func(g *pipeline.GroupStep) { g.RemainingFields["depends_on"] = "other" },
+			wantErr: true,
+		},
+		{
+			name:    "reordered steps",
+			modify:  func(g *pipeline.GroupStep) { g.Steps[0], g.Steps[2] = g.Steps[2], g.Steps[0] },
+			wantErr: true,
+		},
+		{
+			name:    "removed step",
+			modify:  func(g *pipeline.GroupStep) { g.Steps = g.Steps[1:] },
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := *group
+			g.Steps = slices.Clone(group.Steps)
+			g.RemainingFields = map[string]any{"depends_on": "build"}
+			tc.modify(&g)
+
+			toVerify := &GroupStepWithInvariants{
+				GroupStep:     g,
+				RepositoryURL: fakeRepositoryURL,
+			}
+			err := Verify(ctx, group.Signature, verificationKeySet(t, verifier), toVerify)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Verify(ctx, %v, verifier, %v) = %v, want error = %t", group.Signature, toVerify, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	keyStr, keyAlg := "alpacas", jwa.HS256
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, keyStr, keyAlg)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, %q, %q) error = %v", keyID, keyStr, keyAlg, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	step := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: fakeRepositoryURL,
+	}
+	sig, err := Sign(ctx, signingKey(t, key), step)
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, %v) error = %v", step, err)
+	}
+
+	errPolicy := errors.New("computer says no")
+	cases := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name: "no policies",
+		},
+		{
+			name: "allowed algorithm",
+			opts: []Option{WithVerifyPolicy(AllowAlgorithms(jwa.EdDSA, jwa.HS256))},
+		},
+		{
+			name:    "disallowed algorithm",
+			opts:    []Option{WithVerifyPolicy(AllowAlgorithms(jwa.EdDSA))},
+			wantErr: true,
+		},
+		{
+			name: "required fields signed",
+			opts: []Option{WithVerifyPolicy(RequireSignedFields("command", "repository_url"))},
+		},
+		{
+			name:    "required field not signed",
+			opts:    []Option{WithVerifyPolicy(RequireSignedFields("env::DEPLOY"))},
+			wantErr: true,
+		},
+		{
+			name: "custom policy rejects",
+			opts: []Option{
+				WithVerifyPolicy(AllowAlgorithms(jwa.HS256)),
+				WithVerifyPolicy(func(*pipeline.Signature, map[string]any) error { return errPolicy }),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Verify(ctx, sig, verificationKeySet(t, verifier), step, tc.opts...)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Verify(ctx, %v, verifier, %v, opts...) = %v, want error = %t", sig, step, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignWithKeySet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	oldSigner, oldVerifier, err := jwkutil.NewKeyPair("old", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(old, EdDSA) error = %v", err)
+	}
+	newSigner, newVerifier, err := jwkutil.NewKeyPair("new", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(new, EdDSA) error = %v", err)
+	}
+	_, otherVerifier, err := jwkutil.NewKeyPair("other", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(other, EdDSA) error = %v", err)
+	}
+
+	signers := jwk.NewSet()
+	for _, set := range []jwk.Set{oldSigner, newSigner} {
+		key, ok := set.Key(0)
+		if !ok {
+			t.Fatalf("set.Key(0) = _, false, want true")
+		}
+		if err := signers.AddKey(key); err != nil {
+			t.Fatalf("signers.AddKey(%v) error = %v", key, err)
+		}
+	}
+
+	step := &pipeline.CommandStep{Command: "llamas"}
+	if err := SignStepsWithKeySet(ctx, pipeline.Steps{step}, signers, fakeRepositoryURL); err != nil {
+		t.Fatalf("SignStepsWithKeySet(ctx, steps, signers, %q) error = %v", fakeRepositoryURL, err)
+	}
+	if got, want := step.Signature.Algorithm, jwa.EdDSA.String(); got != want {
+		t.Errorf("step.Signature.Algorithm = %q, want %q", got, want)
+	}
+
+	toVerify := &CommandStepWithInvariants{
+		CommandStep:   *step,
+		RepositoryURL: fakeRepositoryURL,
+	}
+	cases := []struct {
+		name     string
+		verifier jwk.Set
+		wantErr  bool
+	}{
+		{name: "old key", verifier: oldVerifier},
+		{name: "new key", verifier: newVerifier},
+		{name: "unrelated key", verifier: otherVerifier, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Verify(ctx, step.Signature, verificationKeySet(t, tc.verifier), toVerify)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Verify(ctx, %v, verifier, %v) = %v, want error = %t", step.Signature, toVerify, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignWithKeySetMixedAlgorithms(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signers := jwk.NewSet()
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.EdDSA, jwa.ES512} {
+		set, _, err := jwkutil.NewKeyPair(alg.String(), alg)
+		if err != nil {
+			t.Fatalf("jwkutil.NewKeyPair(%q, %q) error = %v", alg, alg, err)
+		}
+		key, _ := set.Key(0)
+		if err := signers.AddKey(key); err != nil {
+			t.Fatalf("signers.AddKey(%v) error = %v", key, err)
+		}
+	}
+
+	step := &CommandStepWithInvariants{CommandStep: pipeline.CommandStep{Command: "llamas"}}
+	if _, err := SignWithKeySet(ctx, signers, step); err == nil {
+		t.Errorf("SignWithKeySet(ctx, signers, %v) error = nil, want an error", step)
+	}
+}
+
 func TestSignatureStability(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -685,12 +1060,12 @@ func TestSignatureStability(t *testing.T) {
 		t.Fatalf("signer.Key(0) = _, false, want true")
 	}
 
-	sig, err := Sign(ctx, key, stepWithInvariants, WithEnv(env))
+	sig, err := Sign(ctx, signingKey(t, key), stepWithInvariants, WithEnv(env))
 	if err != nil {
 		t.Fatalf("Sign(ctx, key, %v, WithEnv(%v)) error = %v", stepWithInvariants, env, err)
 	}
 
-	if err := Verify(ctx, sig, verifier, stepWithInvariants, WithEnv(env)); err != nil {
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), stepWithInvariants, WithEnv(env)); err != nil {
 		t.Errorf("Verify(ctx, %v, verifier, %v, WithEnv(%v)) = %v", sig, stepWithInvariants, env, err)
 	}
 }
@@ -745,13 +1120,13 @@ func TestDebugSigning(t *testing.T) {
 
 	// Test that step payload is not logged when debugSigning is false
 	logger := &fakeLogger{}
-	_, err = Sign(ctx, sKey, stepWithInvariants, WithEnv(signEnv), WithDebugSigning(false), WithLogger(logger))
+	_, err = Sign(ctx, signingKey(t, sKey), stepWithInvariants, WithEnv(signEnv), WithDebugSigning(false), WithLogger(logger))
 	if err != nil {
 		t.Fatalf("Sign(ctx, sKey, %v, WithEnv(%v), WithDebugSigning(false), WithLogger(logger)) error = %v", stepWithInvariants, signEnv, err)
 	}
 
 	logged := logger.buf.String()
-	if want := "Public Key Thumbprint (sha256)"; !strings.Contains(logged, want) {
+	if want := "Public Key Thumbprint (sha256): "; !strings.Contains(logged, want) {
 		t.Errorf("logger.buf.String() = %q, missing %q", logged, want)
 	}
 	if want := "Signed Step"; strings.Contains(logged, want) {
@@ -760,16 +1135,16 @@ func TestDebugSigning(t *testing.T) {
 
 	// Test that step payload is logged when debugSigning is true
 	logger = &fakeLogger{}
-	_, err = Sign(ctx, sKey, stepWithInvariants, WithEnv(signEnv), WithDebugSigning(true), WithLogger(logger))
+	_, err = Sign(ctx, signingKey(t, sKey), stepWithInvariants, WithEnv(signEnv), WithDebugSigning(true), WithLogger(logger))
 	if err != nil {
 		t.Fatalf("Sign(ctx, sKey, %v, WithEnv(%v), WithDebugSigning(true), WithLogger(logger)) error = %v", stepWithInvariants, signEnv, err)
 	}
 
 	logged = logger.buf.String()
-	if want := "Public Key Thumbprint (sha256)"; !strings.Contains(logged, want) {
+	if want := "Public Key Thumbprint (sha256): "; !strings.Contains(logged, want) {
 		t.Errorf("logger.buf.String() = %q, missing %q", logged, want)
 	}
-	if want := "Signed Step"; !strings.Contains(logged, want) {
+	if want := "Signed Step: "; !strings.Contains(logged, want) {
 		t.Errorf("logger.buf.String() = %q, missing %q", logged, want)
 	}
 }
@@ -781,3 +1156,125 @@ type fakeLogger struct {
 func (l *fakeLogger) Debug(f string, v ...any) {
 	fmt.Fprintf(&l.buf, f, v...)
 }
+
+func TestVerifyEquivalentRepositoryURLs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	const (
+		sshURL   = "git@github.com:buildkite/llamas.git"
+		httpsURL = "https://github.com/buildkite/llamas.git"
+		otherURL = "https://github.com/buildkite/alpacas.git"
+	)
+
+	keyStr, keyAlg := "alpacas", jwa.HS256
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, keyStr, keyAlg)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, %q, %q) error = %v", keyID, keyStr, keyAlg, err)
+	}
+
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	signStep := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: sshURL,
+	}
+	sig, err := Sign(ctx, signingKey(t, key), signStep)
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, %v) error = %v", signStep, err)
+	}
+
+	verifyStep := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: httpsURL,
+	}
+
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), verifyStep); err == nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v) = %v, want non-nil error", sig, verifyStep, err)
+	}
+
+	opt := WithEquivalentRepositoryURLs(httpsURL, sshURL)
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), verifyStep, opt); err != nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v, WithEquivalentRepositoryURLs(%q, %q)) = %v", sig, verifyStep, httpsURL, sshURL, err)
+	}
+
+	// URLs outside the set are not made equivalent.
+	otherStep := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: otherURL,
+	}
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), otherStep, opt); err == nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v, WithEquivalentRepositoryURLs(%q, %q)) = %v, want non-nil error", sig, otherStep, httpsURL, sshURL, err)
+	}
+}
+
+func TestVerifyRetiredKey(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewKeyPair(keyID, jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(%q, EdDSA) error = %v", keyID, err)
+	}
+
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	step := &CommandStepWithInvariants{CommandStep: pipeline.CommandStep{Command: "llamas"}}
+	sig, err := Sign(ctx, signingKey(t, key), step)
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, %v) error = %v", step, err)
+	}
+
+	retireAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	pub, _ := verifier.Key(0)
+	if err := jwkutil.SetNotAfter(pub, retireAt); err != nil {
+		t.Fatalf("jwkutil.SetNotAfter(pub, %v) error = %v", retireAt, err)
+	}
+
+	before := WithVerificationTime(retireAt.Add(-time.Minute))
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), step, before); err != nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v, before retirement) = %v", sig, step, err)
+	}
+
+	after := WithVerificationTime(retireAt.Add(time.Minute))
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), step, after); err == nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v, after retirement) = %v, want non-nil error", sig, step, err)
+	}
+}
+
+func TestVerifyMalformedRetirement(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewKeyPair(keyID, jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(%q, EdDSA) error = %v", keyID, err)
+	}
+
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	step := &CommandStepWithInvariants{CommandStep: pipeline.CommandStep{Command: "llamas"}}
+	sig, err := Sign(ctx, signingKey(t, key), step)
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, %v) error = %v", step, err)
+	}
+
+	// A retirement time that can't be understood mustn't leave the key
+	// trusted.
+	pub, _ := verifier.Key(0)
+	if err := pub.Set(jwkutil.NotAfterKey, "the end of the quarter"); err != nil {
+		t.Fatalf("pub.Set(%q, malformed) error = %v", jwkutil.NotAfterKey, err)
+	}
+	if err := Verify(ctx, sig, verificationKeySet(t, verifier), step); err == nil {
+		t.Errorf("Verify(ctx, %v, verifier, %v) with a malformed retirement time = %v, want non-nil error", sig, step, err)
+	}
+}
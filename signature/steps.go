@@ -4,15 +4,135 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path"
+	"regexp"
 
 	"github.com/buildkite/go-pipeline"
+	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
 var errSigningRefusedUnknownStepType = errors.New("refusing to sign pipeline containing a step of unknown type, because the pipeline could be incorrectly parsed - please contact support")
 
-// SignSteps adds signatures to each command step (and recursively to any command steps that are within group steps).
+// SignSteps adds signatures to each command and trigger step (and recursively to any that are within group steps).
+// If the WithSignedGroups option is given, group steps are also signed.
+// The WithStepFilter and WithSkipSigned options limit which command and
+// trigger steps are signed.
 // The steps are mutated directly, so an error part-way through may leave some steps un-signed.
-func SignSteps(ctx context.Context, s pipeline.Steps, key Key, repoURL string, opts ...Option) error {
+// The repository URL is signed as given, unless the WithCanonicalRepositoryURL
+// option is given.
+func SignSteps(ctx context.Context, s pipeline.Steps, key *SigningKey, repoURL string, opts ...Option) error {
+	sign := func(sf SignedFielder) (*pipeline.Signature, error) {
+		return Sign(ctx, key, sf, opts...)
+	}
+	o := configureOptions(opts...)
+	var keySet *VerificationKeySet
+	if o.skipSigned {
+		ks, err := key.verificationKeySet()
+		if err != nil {
+			return err
+		}
+		keySet = ks
+	}
+	verify := func(sig *pipeline.Signature, sf SignedFielder) error {
+		return Verify(ctx, sig, keySet, sf, opts...)
+	}
+	_, err := signSteps(s, o.signedRepositoryURL(repoURL), sign, verify, o)
+	return err
+}
+
+// SignStepsWithKeySet is like SignSteps, but signs each step with every key in
+// keys (see SignWithKeySet).
+func SignStepsWithKeySet(ctx context.Context, s pipeline.Steps, keys jwk.Set, repoURL string, opts ...Option) error {
+	sign := func(sf SignedFielder) (*pipeline.Signature, error) {
+		return SignWithKeySet(ctx, keys, sf, opts...)
+	}
+	o := configureOptions(opts...)
+	var keySet *VerificationKeySet
+	if o.skipSigned {
+		pub, err := jwk.PublicSetOf(keys)
+		if err != nil {
+			return fmt.Errorf("unable to generate public keys: %w", err)
+		}
+		if keySet, err = NewVerificationKeySet(pub); err != nil {
+			return err
+		}
+	}
+	verify := func(sig *pipeline.Signature, sf SignedFielder) error {
+		return Verify(ctx, sig, keySet, sf, opts...)
+	}
+	_, err := signSteps(s, o.signedRepositoryURL(repoURL), sign, verify, o)
+	return err
+}
+
+// signedRepositoryURL returns the form of the repository URL that SignSteps
+// signs.
+func (o options) signedRepositoryURL(repoURL string) string {
+	if o.canonicalRepo {
+		return CanonicalRepositoryURL(repoURL)
+	}
+	return repoURL
+}
+
+// StepFilter reports whether SignSteps should sign a step.
+type StepFilter func(pipeline.Step) bool
+
+// MatchStepKey returns a StepFilter that matches steps whose key matches the
+// glob pattern (see path.Match). Steps without a key never match.
+func MatchStepKey(pattern string) (StepFilter, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+	}
+	return func(s pipeline.Step) bool {
+		key, _ := stepKeyAndLabel(s)
+		if key == "" {
+			return false
+		}
+		ok, _ := path.Match(pattern, key)
+		return ok
+	}, nil
+}
+
+// MatchStepLabel returns a StepFilter that matches steps whose label matches
+// the regular expression.
+func MatchStepLabel(re *regexp.Regexp) StepFilter {
+	return func(s pipeline.Step) bool {
+		_, label := stepKeyAndLabel(s)
+		return re.MatchString(label)
+	}
+}
+
+// stepKeyAndLabel returns the key and label of a command or trigger step.
+func stepKeyAndLabel(s pipeline.Step) (key, label string) {
+	switch s := s.(type) {
+	case *pipeline.CommandStep:
+		return s.Key, s.Label
+	case *pipeline.TriggerStep:
+		return s.Key, s.Label
+	}
+	return "", ""
+}
+
+// shouldSign reports whether signSteps should sign a command or trigger step
+// that currently has signature sig, and whose signed fields are sf. When
+// skipping signed steps, a signature is only kept if it still verifies, so
+// that steps changed since they were signed are signed again.
+func (o *options) shouldSign(step pipeline.Step, sig *pipeline.Signature, sf SignedFielder, verify verifyFunc) bool {
+	for _, f := range o.stepFilters {
+		if !f(step) {
+			return false
+		}
+	}
+	return !o.skipSigned || sig == nil || verify(sig, sf) != nil
+}
+
+// verifyFunc verifies an existing signature against the signed fields sf.
+type verifyFunc func(sig *pipeline.Signature, sf SignedFielder) error
+
+// signSteps implements SignSteps and SignStepsWithKeySet. It reports whether
+// any step signature was changed. verify is used to check existing signatures
+// when skipping signed steps.
+func signSteps(s pipeline.Steps, repoURL string, sign func(SignedFielder) (*pipeline.Signature, error), verify verifyFunc, opts options) (bool, error) {
+	changed := false
 	for _, step := range s {
 		switch step := step.(type) {
 		case *pipeline.CommandStep:
@@ -20,26 +140,70 @@ func SignSteps(ctx context.Context, s pipeline.Steps, key Key, repoURL string, o
 				CommandStep:   *step,
 				RepositoryURL: repoURL,
 			}
+			if !opts.shouldSign(step, step.Signature, stepWithInvariants, verify) {
+				break
+			}
 
-			sig, err := Sign(ctx, key, stepWithInvariants, opts...)
+			sig, err := sign(stepWithInvariants)
 			if err != nil {
-				return fmt.Errorf("signing step with command %q: %w", step.Command, err)
+				return changed, fmt.Errorf("signing step with command %q: %w", step.Command, err)
 			}
 			step.Signature = sig
+			changed = true
+
+		case *pipeline.TriggerStep:
+			stepWithInvariants := &TriggerStepWithInvariants{
+				TriggerStep:   *step,
+				RepositoryURL: repoURL,
+			}
+			if !opts.shouldSign(step, step.Signature, stepWithInvariants, verify) {
+				break
+			}
+
+			sig, err := sign(stepWithInvariants)
+			if err != nil {
+				return changed, fmt.Errorf("signing trigger step for pipeline %q: %w", step.Trigger, err)
+			}
+			step.Signature = sig
+			changed = true
 
 		case *pipeline.GroupStep:
-			if err := SignSteps(ctx, step.Steps, key, repoURL, opts...); err != nil {
-				return fmt.Errorf("signing group step: %w", err)
+			nestedChanged, err := signSteps(step.Steps, repoURL, sign, verify, opts)
+			changed = changed || nestedChanged
+			if err != nil {
+				return changed, fmt.Errorf("signing group step: %w", err)
+			}
+			if !opts.signGroups {
+				break
+			}
+			// The nested steps must be signed first, since the group signature
+			// covers theirs.
+			stepWithInvariants := &GroupStepWithInvariants{
+				GroupStep:     *step,
+				RepositoryURL: repoURL,
 			}
 
+			// A signed group only needs re-signing when skipping signed steps
+			// if a nested signature changed, or the group itself did.
+			if opts.skipSigned && step.Signature != nil && !nestedChanged && verify(step.Signature, stepWithInvariants) == nil {
+				break
+			}
+
+			sig, err := sign(stepWithInvariants)
+			if err != nil {
+				return changed, fmt.Errorf("signing group step with key %q: %w", step.Key, err)
+			}
+			step.Signature = sig
+			changed = true
+
 		case *pipeline.UnknownStep:
 			// Presence of an unknown step means we're missing some semantic
 			// information about the pipeline. We could be not signing something
 			// that needs signing. Rather than deferring the problem (so that
 			// signature verification fails when an agent runs jobs) we return
 			// an error now.
-			return errSigningRefusedUnknownStepType
+			return changed, errSigningRefusedUnknownStepType
 		}
 	}
-	return nil
+	return changed, nil
 }
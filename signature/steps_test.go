@@ -0,0 +1,232 @@
+package signature
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+func TestSignStepsSelective(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, _, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	byKey, err := MatchStepKey("deploy-*")
+	if err != nil {
+		t.Fatalf("MatchStepKey(deploy-*) error = %v", err)
+	}
+
+	// old is the signature already on the "signed" step.
+	signed := &pipeline.CommandStep{Key: "signed", Command: "true"}
+	if err := SignSteps(ctx, pipeline.Steps{signed}, signingKey(t, key), fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, [signed], key, %q) error = %v", fakeRepositoryURL, err)
+	}
+	old := signed.Signature
+
+	tests := []struct {
+		name string
+		opts []Option
+		// want lists the keys of steps expected to have new signatures.
+		want []string
+	}{
+		{
+			name: "all steps",
+			want: []string{"build", "deploy-staging", "deploy-prod", "signed", "trigger"},
+		},
+		{
+			name: "key glob",
+			opts: []Option{WithStepFilter(byKey)},
+			want: []string{"deploy-staging", "deploy-prod"},
+		},
+		{
+			name: "label pattern",
+			opts: []Option{WithStepFilter(MatchStepLabel(regexp.MustCompile(`(?i)prod`)))},
+			want: []string{"deploy-prod"},
+		},
+		{
+			name: "custom func",
+			opts: []Option{WithStepFilter(func(s pipeline.Step) bool {
+				_, ok := s.(*pipeline.TriggerStep)
+				return ok
+			})},
+			want: []string{"trigger"},
+		},
+		{
+			name: "skip signed",
+			opts: []Option{WithSkipSigned(true)},
+			want: []string{"build", "deploy-staging", "deploy-prod", "trigger"},
+		},
+		{
+			name: "filters and skip signed combine",
+			opts: []Option{WithStepFilter(byKey), WithSkipSigned(true), WithStepFilter(MatchStepLabel(regexp.MustCompile(`Staging`)))},
+			want: []string{"deploy-staging"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			steps := pipeline.Steps{
+				&pipeline.CommandStep{Key: "build", Command: "make"},
+				&pipeline.GroupStep{Steps: pipeline.Steps{
+					&pipeline.CommandStep{Key: "deploy-staging", Label: "Staging", Command: "deploy staging"},
+					&pipeline.CommandStep{Key: "deploy-prod", Label: "Production", Command: "deploy prod"},
+				}},
+				&pipeline.CommandStep{Key: "signed", Command: "true", Signature: old},
+				&pipeline.TriggerStep{Key: "trigger", Trigger: "downstream"},
+			}
+			if err := SignSteps(ctx, steps, signingKey(t, key), fakeRepositoryURL, test.opts...); err != nil {
+				t.Fatalf("SignSteps(ctx, steps, key, %q, opts...) error = %v", fakeRepositoryURL, err)
+			}
+
+			got := []string{}
+			var collect func(pipeline.Steps)
+			collect = func(steps pipeline.Steps) {
+				for _, s := range steps {
+					switch s := s.(type) {
+					case *pipeline.CommandStep:
+						if s.Signature != nil && s.Signature != old {
+							got = append(got, s.Key)
+						}
+					case *pipeline.TriggerStep:
+						if s.Signature != nil {
+							got = append(got, s.Key)
+						}
+					case *pipeline.GroupStep:
+						collect(s.Steps)
+					}
+				}
+			}
+			collect(steps)
+
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("newly signed steps diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSignStepsSkipSignedStale(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, _, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+	sk := signingKey(t, key)
+
+	unchanged := &pipeline.CommandStep{Key: "unchanged", Command: "make"}
+	changed := &pipeline.CommandStep{Key: "changed", Command: "make test"}
+	trigger := &pipeline.TriggerStep{Key: "trigger", Trigger: "downstream"}
+	steps := pipeline.Steps{unchanged, changed, trigger}
+	if err := SignSteps(ctx, steps, sk, fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q) error = %v", fakeRepositoryURL, err)
+	}
+	first := []*pipeline.Signature{unchanged.Signature, changed.Signature, trigger.Signature}
+
+	// Steps changed after signing have stale signatures, which are replaced.
+	changed.Command = "make evil"
+	trigger.Trigger = "elsewhere"
+	if err := SignSteps(ctx, steps, sk, fakeRepositoryURL, WithSkipSigned(true)); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q, WithSkipSigned(true)) error = %v", fakeRepositoryURL, err)
+	}
+	if unchanged.Signature != first[0] {
+		t.Errorf("unchanged.Signature = %v, want unchanged %v", unchanged.Signature, first[0])
+	}
+	if changed.Signature == first[1] {
+		t.Errorf("changed.Signature was not re-signed")
+	}
+	if trigger.Signature == first[2] {
+		t.Errorf("trigger.Signature was not re-signed")
+	}
+
+	_, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	if _, err := VerifyPipelineParallel(ctx, &pipeline.Pipeline{Steps: steps}, verificationKeySet(t, verifier), CollectAllFailures, 1, fakeRepositoryURL); err != nil {
+		t.Errorf("VerifyPipelineParallel(...) error = %v", err)
+	}
+}
+
+func TestSignStepsSkipSignedGroups(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, _, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+	sk := signingKey(t, key)
+
+	group := &pipeline.GroupStep{Key: "tests", Steps: pipeline.Steps{
+		&pipeline.CommandStep{Command: "make test"},
+	}}
+	opts := []Option{WithSignedGroups(true), WithSkipSigned(true)}
+	if err := SignSteps(ctx, pipeline.Steps{group}, sk, fakeRepositoryURL, opts...); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q, opts...) error = %v", fakeRepositoryURL, err)
+	}
+	first := group.Signature
+	if first == nil {
+		t.Fatalf("group.Signature = nil, want a signature")
+	}
+
+	// Nothing changed, so the group should keep its signature.
+	if err := SignSteps(ctx, pipeline.Steps{group}, sk, fakeRepositoryURL, opts...); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q, opts...) error = %v", fakeRepositoryURL, err)
+	}
+	if group.Signature != first {
+		t.Errorf("after re-signing unchanged group, group.Signature = %v, want unchanged %v", group.Signature, first)
+	}
+
+	// Adding an unsigned step to the group should cause it to be re-signed.
+	group.Steps = append(group.Steps, &pipeline.CommandStep{Command: "make lint"})
+	if err := SignSteps(ctx, pipeline.Steps{group}, sk, fakeRepositoryURL, opts...); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q, opts...) error = %v", fakeRepositoryURL, err)
+	}
+	if group.Signature == first {
+		t.Errorf("after adding a step, group.Signature was not re-signed")
+	}
+
+	// Changing the group itself should also cause it to be re-signed.
+	second := group.Signature
+	group.Key = "renamed"
+	if err := SignSteps(ctx, pipeline.Steps{group}, sk, fakeRepositoryURL, opts...); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q, opts...) error = %v", fakeRepositoryURL, err)
+	}
+	if group.Signature == second {
+		t.Errorf("after changing the key, group.Signature was not re-signed")
+	}
+}
+
+func TestMatchStepKeyInvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	if _, err := MatchStepKey("[deploy"); err == nil {
+		t.Errorf("MatchStepKey([deploy) error = %v, want non-nil error", err)
+	}
+}
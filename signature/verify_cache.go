@@ -0,0 +1,85 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/buildkite/go-pipeline"
+)
+
+// VerifyCache records signatures that Verify has successfully verified, so
+// that verifying the same signature again (for example, when a job is
+// retried) can skip the cryptographic verification. Keys are opaque strings
+// derived from the signature value, the canonical payload (which includes any
+// env:: values), and the verification keys in use, so a cached result is only
+// reused if none of those have changed. Implementations must be safe for
+// concurrent use.
+type VerifyCache interface {
+	// Contains reports whether key has been added to the cache.
+	Contains(key string) bool
+
+	// Add adds key to the cache.
+	Add(key string)
+}
+
+// WithVerifyCache makes Verify consult cache before verifying a signature,
+// and add successfully verified signatures to it. Verify policies (see
+// WithVerifyPolicy) are always checked. Sign ignores this option.
+func WithVerifyCache(cache VerifyCache) Option { return verifyCacheOption{cache} }
+
+// verifyCacheKey returns the cache key for verifying sig over payload with the
+// keys summarised by keysDigest.
+func verifyCacheKey(keysDigest []byte, sig *pipeline.Signature, payload []byte) string {
+	h := sha256.New()
+	h.Write(keysDigest)
+	for _, s := range []string{sig.Algorithm, sig.Value} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryVerifyCache is a VerifyCache held in memory, which holds up to a fixed
+// number of keys. When full, the oldest key is evicted.
+type MemoryVerifyCache struct {
+	mu    sync.Mutex
+	max   int
+	keys  map[string]struct{}
+	order []string
+}
+
+// NewMemoryVerifyCache returns a MemoryVerifyCache holding up to max keys.
+func NewMemoryVerifyCache(max int) *MemoryVerifyCache {
+	return &MemoryVerifyCache{
+		max:  max,
+		keys: make(map[string]struct{}),
+	}
+}
+
+// Contains reports whether key is in the cache.
+func (c *MemoryVerifyCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.keys[key]
+	return ok
+}
+
+// Add adds key to the cache, evicting the oldest key if the cache is full.
+func (c *MemoryVerifyCache) Add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max <= 0 {
+		return
+	}
+	if _, ok := c.keys[key]; ok {
+		return
+	}
+	if len(c.order) >= c.max {
+		delete(c.keys, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.keys[key] = struct{}{}
+	c.order = append(c.order, key)
+}
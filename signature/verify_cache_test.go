@@ -0,0 +1,92 @@
+package signature
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+// countingCache is a VerifyCache that counts cache hits.
+type countingCache struct {
+	*MemoryVerifyCache
+	hits int
+}
+
+func (c *countingCache) Contains(key string) bool {
+	ok := c.MemoryVerifyCache.Contains(key)
+	if ok {
+		c.hits++
+	}
+	return ok
+}
+
+func TestVerifyCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewKeyPair(keyID, jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(%q, EdDSA) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+	_, otherVerifier, err := jwkutil.NewKeyPair("other", jwa.EdDSA)
+	if err != nil {
+		t.Fatalf("jwkutil.NewKeyPair(other, EdDSA) error = %v", err)
+	}
+
+	step := &CommandStepWithInvariants{
+		CommandStep:   pipeline.CommandStep{Command: "llamas"},
+		RepositoryURL: fakeRepositoryURL,
+	}
+	env := map[string]string{"CONTEXT": "cats"}
+	sig, err := Sign(ctx, signingKey(t, key), step, WithEnv(env))
+	if err != nil {
+		t.Fatalf("Sign(ctx, key, step) error = %v", err)
+	}
+
+	cache := &countingCache{MemoryVerifyCache: NewMemoryVerifyCache(10)}
+	keySet := verificationKeySet(t, verifier)
+	for i := 0; i < 3; i++ {
+		if err := Verify(ctx, sig, keySet, step, WithEnv(env), WithVerifyCache(cache)); err != nil {
+			t.Fatalf("Verify(ctx, sig, keySet, step, WithVerifyCache(cache)) error = %v", err)
+		}
+	}
+	if got, want := cache.hits, 2; got != want {
+		t.Errorf("after verifying 3 times, cache hits = %d, want %d", got, want)
+	}
+
+	tampered := *step
+	tampered.Command = "alpacas"
+	if err := Verify(ctx, sig, keySet, &tampered, WithEnv(env), WithVerifyCache(cache)); err == nil {
+		t.Errorf("Verify(ctx, sig, keySet, tampered, WithVerifyCache(cache)) error = %v, want non-nil error", err)
+	}
+
+	otherKeySet := verificationKeySet(t, otherVerifier)
+	if err := Verify(ctx, sig, otherKeySet, step, WithEnv(env), WithVerifyCache(cache)); err == nil {
+		t.Errorf("Verify(ctx, sig, otherKeySet, step, WithVerifyCache(cache)) error = %v, want non-nil error", err)
+	}
+	if got, want := cache.hits, 2; got != want {
+		t.Errorf("after verifying changed inputs, cache hits = %d, want %d", got, want)
+	}
+}
+
+func TestMemoryVerifyCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	c := NewMemoryVerifyCache(2)
+	c.Add("a")
+	c.Add("b")
+	c.Add("a")
+	c.Add("c")
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		if got := c.Contains(key); got != want {
+			t.Errorf("c.Contains(%q) = %t, want %t", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/buildkite/go-pipeline"
+)
+
+var (
+	// ErrStepNotSigned is the error for a command or trigger step without a
+	// signature (or a group step, with WithRequireSignedGroups).
+	ErrStepNotSigned = errors.New("step is not signed")
+
+	errVerifyRefusedUnknownStepType = errors.New("refusing to verify a step of unknown type, because the pipeline could be incorrectly parsed")
+)
+
+// FailurePolicy determines what VerifyPipelineParallel does once a step fails
+// verification.
+type FailurePolicy int
+
+const (
+	// CollectAllFailures verifies every step, and reports every failure.
+	CollectAllFailures FailurePolicy = iota
+
+	// AbortOnFirstFailure stops verifying steps once any step fails. Steps
+	// that were not verified as a result are marked as skipped.
+	AbortOnFirstFailure
+)
+
+// StepVerifyResult is the result of verifying one step of a pipeline.
+type StepVerifyResult struct {
+	// Path locates the step within the pipeline, such as "steps[2].steps[0]".
+	Path string
+
+	// Step is the step that was verified.
+	Step pipeline.Step
+
+	// Err is the reason the step failed verification, or nil if it passed
+	// (or was skipped).
+	Err error
+
+	// Skipped is true if the step wasn't verified, because verification was
+	// aborted (or the context was cancelled) first.
+	Skipped bool
+
+	// Exempt is true if the step is unsigned, but passed verification because
+	// it is exempt (see WithSignedExemptions).
+	Exempt bool
+}
+
+// PipelineVerifyResult is the result of VerifyPipelineParallel.
+type PipelineVerifyResult struct {
+	// Steps has a result for each step that needs verifying, in the order the
+	// steps appear in the pipeline. The steps within a group come before the
+	// group itself.
+	Steps []StepVerifyResult
+
+	// Aborted is true if verification stopped early, either because of the
+	// AbortOnFirstFailure policy or because the context was cancelled.
+	Aborted bool
+}
+
+// Failures returns the results of the steps that failed verification.
+func (r *PipelineVerifyResult) Failures() []StepVerifyResult {
+	var failures []StepVerifyResult
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			failures = append(failures, s)
+		}
+	}
+	return failures
+}
+
+// Err returns the failures as a single error, or nil if there are none.
+func (r *PipelineVerifyResult) Err() error {
+	var errs []error
+	for _, s := range r.Failures() {
+		errs = append(errs, fmt.Errorf("%s: %w", s.Path, s.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyPipelineParallel verifies the signature of each command and trigger
+// step in the pipeline (including those within group steps), and of each group
+// step that has a signature (or every group step, with the
+// WithRequireSignedGroups option), using up to concurrency goroutines (or
+// GOMAXPROCS, if concurrency is less than 1). Command and trigger steps without
+// a signature, and steps of unknown type, fail verification. Signatures
+// covering the repository URL as given are accepted, as are those covering its
+// canonical form (see CanonicalRepositoryURL) with the
+// WithCanonicalRepositoryURL option, or an equivalent URL given to
+// WithEquivalentRepositoryURLs. opts are passed to Verify, so any logger or
+// VerifyCache given must be safe for concurrent use. With the
+// WithSignedExemptions option, unsigned steps exempted by the pipeline's
+// exemptions record pass verification, once the record's signature has been
+// verified.
+//
+// The result is always non-nil. The error is non-nil if any step failed, if
+// the exemptions record failed verification (in which case no steps are
+// verified), or if ctx was cancelled before every step was verified.
+func VerifyPipelineParallel(ctx context.Context, p *pipeline.Pipeline, keySet *VerificationKeySet, policy FailurePolicy, concurrency int, repoURL string, opts ...Option) (*PipelineVerifyResult, error) {
+	result := &PipelineVerifyResult{}
+
+	var exemptions *Exemptions
+	if configureOptions(opts...).exemptions {
+		ex, err := VerifyExemptions(ctx, p, keySet, repoURL, opts...)
+		if err != nil {
+			result.Aborted = true
+			return result, err
+		}
+		exemptions = ex
+	}
+
+	requireGroups := configureOptions(opts...).requireGroups
+	sfs := collectVerifiable(&result.Steps, "steps", p.Steps, repoURL, requireGroups)
+
+	if concurrency < 1 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		aborted bool
+		sem     = make(chan struct{}, concurrency)
+	)
+	for i := range result.Steps {
+		if r := &result.Steps[i]; exempt(r.Step, exemptions) {
+			r.Exempt = true
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(r *StepVerifyResult, sf SignedFielder) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if ctx.Err() != nil {
+				r.Skipped = true
+				return
+			}
+			r.Err = verifyStep(ctx, r.Step, sf, keySet, opts)
+			if r.Err != nil && policy == AbortOnFirstFailure {
+				mu.Lock()
+				aborted = true
+				mu.Unlock()
+				cancel()
+			}
+		}(&result.Steps[i], sfs[i])
+	}
+	wg.Wait()
+
+	result.Aborted = aborted
+	err := result.Err()
+	if cerr := context.Cause(ctx); cerr != nil && !aborted {
+		result.Aborted = true
+		err = errors.Join(err, cerr)
+	}
+	return result, err
+}
+
+// collectVerifiable appends a result for each step within steps that needs
+// verifying to results (recursing into group steps), and returns the
+// corresponding SignedFielders, in the same order. Steps of unknown type have
+// a nil SignedFielder. Unsigned group steps are only collected if
+// requireGroups is true.
+func collectVerifiable(results *[]StepVerifyResult, prefix string, steps pipeline.Steps, repoURL string, requireGroups bool) []SignedFielder {
+	var sfs []SignedFielder
+	for i, step := range steps {
+		path := fmt.Sprintf("%s[%d]", prefix, i)
+
+		var sf SignedFielder
+		switch step := step.(type) {
+		case *pipeline.CommandStep:
+			sf = &CommandStepWithInvariants{CommandStep: *step, RepositoryURL: repoURL}
+
+		case *pipeline.TriggerStep:
+			sf = &TriggerStepWithInvariants{TriggerStep: *step, RepositoryURL: repoURL}
+
+		case *pipeline.GroupStep:
+			sfs = append(sfs, collectVerifiable(results, path+".steps", step.Steps, repoURL, requireGroups)...)
+			if step.Signature == nil && !requireGroups {
+				continue
+			}
+			sf = &GroupStepWithInvariants{GroupStep: *step, RepositoryURL: repoURL}
+
+		case *pipeline.UnknownStep:
+			// Leave sf nil, so that verifyStep fails it.
+
+		default:
+			continue
+		}
+
+		*results = append(*results, StepVerifyResult{Path: path, Step: step})
+		sfs = append(sfs, sf)
+	}
+	return sfs
+}
+
+// verifyStep verifies the signature of one step collected by
+// collectVerifiable.
+func verifyStep(ctx context.Context, step pipeline.Step, sf SignedFielder, keySet *VerificationKeySet, opts []Option) error {
+	if sf == nil {
+		return errVerifyRefusedUnknownStepType
+	}
+	var sig *pipeline.Signature
+	switch step := step.(type) {
+	case *pipeline.CommandStep:
+		sig = step.Signature
+	case *pipeline.TriggerStep:
+		sig = step.Signature
+	case *pipeline.GroupStep:
+		sig = step.Signature
+	}
+	if sig == nil {
+		return ErrStepNotSigned
+	}
+	return Verify(ctx, sig, keySet, sf, opts...)
+}
+
+// exempt reports whether a step is an unsigned command or trigger step that
+// is exempt from signing.
+func exempt(step pipeline.Step, ex *Exemptions) bool {
+	if ex == nil || stepSignatureValue(step) != "" {
+		return false
+	}
+	key, _ := stepKeyAndLabel(step)
+	return ex.Exempt(key)
+}
@@ -0,0 +1,227 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/buildkite/go-pipeline"
+	"github.com/buildkite/go-pipeline/jwkutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+func TestVerifyPipelineParallel(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	// newPipeline returns a signed pipeline. tamper is applied after signing.
+	newPipeline := func(t *testing.T, tamper func(pipeline.Steps)) *pipeline.Pipeline {
+		t.Helper()
+		steps := pipeline.Steps{
+			&pipeline.CommandStep{Key: "build", Command: "make"},
+			&pipeline.GroupStep{Key: "deploy", Steps: pipeline.Steps{
+				&pipeline.CommandStep{Key: "staging", Command: "deploy staging"},
+				&pipeline.CommandStep{Key: "prod", Command: "deploy prod"},
+			}},
+			&pipeline.WaitStep{},
+			&pipeline.TriggerStep{Key: "trigger", Trigger: "downstream"},
+		}
+		if err := SignSteps(ctx, steps, signingKey(t, key), fakeRepositoryURL, WithSignedGroups(true)); err != nil {
+			t.Fatalf("SignSteps(ctx, steps, key, %q, WithSignedGroups(true)) error = %v", fakeRepositoryURL, err)
+		}
+		if tamper != nil {
+			tamper(steps)
+		}
+		return &pipeline.Pipeline{Steps: steps}
+	}
+
+	tests := []struct {
+		name        string
+		tamper      func(pipeline.Steps)
+		opts        []Option
+		policy      FailurePolicy
+		concurrency int
+		// wantFailed lists the paths of steps expected to fail.
+		wantFailed []string
+	}{
+		{
+			name:        "all valid",
+			concurrency: 4,
+		},
+		{
+			name:        "all valid, default concurrency",
+			concurrency: 0,
+		},
+		{
+			name: "tampered steps, collect all",
+			tamper: func(s pipeline.Steps) {
+				s[0].(*pipeline.CommandStep).Command = "make evil"
+				s[3].(*pipeline.TriggerStep).Trigger = "elsewhere"
+			},
+			concurrency: 2,
+			wantFailed:  []string{"steps[0]", "steps[3]"},
+		},
+		{
+			name: "unsigned nested step",
+			tamper: func(s pipeline.Steps) {
+				s[1].(*pipeline.GroupStep).Steps[1].(*pipeline.CommandStep).Signature = nil
+			},
+			concurrency: 3,
+			// The group signature covers the signatures of the steps within
+			// it, so it fails too.
+			wantFailed: []string{"steps[1].steps[1]", "steps[1]"},
+		},
+		{
+			name: "unsigned group",
+			tamper: func(s pipeline.Steps) {
+				s[1].(*pipeline.GroupStep).Signature = nil
+			},
+			concurrency: 2,
+		},
+		{
+			name: "unsigned group, signed groups required",
+			tamper: func(s pipeline.Steps) {
+				s[1].(*pipeline.GroupStep).Signature = nil
+			},
+			opts:        []Option{WithRequireSignedGroups(true)},
+			concurrency: 2,
+			wantFailed:  []string{"steps[1]"},
+		},
+		{
+			name: "unknown step",
+			tamper: func(s pipeline.Steps) {
+				s[2] = &pipeline.UnknownStep{Contents: map[string]any{"llama": "alpaca"}}
+			},
+			concurrency: 2,
+			wantFailed:  []string{"steps[2]"},
+		},
+		{
+			name: "abort on first failure",
+			tamper: func(s pipeline.Steps) {
+				s[0].(*pipeline.CommandStep).Command = "make evil"
+				s[3].(*pipeline.TriggerStep).Trigger = "elsewhere"
+			},
+			policy:      AbortOnFirstFailure,
+			concurrency: 1,
+			wantFailed:  []string{"steps[0]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := newPipeline(t, test.tamper)
+			res, err := VerifyPipelineParallel(ctx, p, verificationKeySet(t, verifier), test.policy, test.concurrency, fakeRepositoryURL, test.opts...)
+			if (err != nil) != (len(test.wantFailed) > 0) {
+				t.Errorf("VerifyPipelineParallel(...) error = %v, want failures %v", err, test.wantFailed)
+			}
+
+			var gotFailed []string
+			for _, f := range res.Failures() {
+				gotFailed = append(gotFailed, f.Path)
+			}
+			if diff := cmp.Diff(gotFailed, test.wantFailed); diff != "" {
+				t.Errorf("failed steps diff (-got +want):\n%s", diff)
+			}
+			if got, want := res.Aborted, test.policy == AbortOnFirstFailure && len(test.wantFailed) > 0; got != want {
+				t.Errorf("res.Aborted = %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyPipelineParallelResults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	steps := pipeline.Steps{
+		&pipeline.CommandStep{Key: "build", Command: "make"},
+		&pipeline.GroupStep{Steps: pipeline.Steps{
+			&pipeline.CommandStep{Key: "test", Command: "make test"},
+		}},
+	}
+	if err := SignSteps(ctx, steps, signingKey(t, key), fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q) error = %v", fakeRepositoryURL, err)
+	}
+	steps = append(steps, &pipeline.CommandStep{Key: "unsigned", Command: "true"})
+
+	res, err := VerifyPipelineParallel(ctx, &pipeline.Pipeline{Steps: steps}, verificationKeySet(t, verifier), CollectAllFailures, 2, fakeRepositoryURL)
+	if !errors.Is(err, ErrStepNotSigned) {
+		t.Errorf("VerifyPipelineParallel(...) error = %v, want %v", err, ErrStepNotSigned)
+	}
+
+	// The unsigned group isn't verified.
+	type result struct {
+		Path string
+		Key  string
+		Err  error
+	}
+	var got []result
+	for _, r := range res.Steps {
+		got = append(got, result{Path: r.Path, Key: pipeline.StepKey(r.Step), Err: r.Err})
+	}
+	want := []result{
+		{Path: "steps[0]", Key: "build"},
+		{Path: "steps[1].steps[0]", Key: "test"},
+		{Path: "steps[2]", Key: "unsigned", Err: ErrStepNotSigned},
+	}
+	if diff := cmp.Diff(got, want, cmp.Comparer(func(a, b error) bool { return errors.Is(a, b) })); diff != "" {
+		t.Errorf("res.Steps diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestVerifyPipelineParallelCancelled(t *testing.T) {
+	t.Parallel()
+
+	signer, verifier, err := jwkutil.NewSymmetricKeyPairFromString(keyID, "alpacas", jwa.HS256)
+	if err != nil {
+		t.Fatalf("jwkutil.NewSymmetricKeyPairFromString(%q, alpacas, HS256) error = %v", keyID, err)
+	}
+	key, ok := signer.Key(0)
+	if !ok {
+		t.Fatalf("signer.Key(0) = _, false, want true")
+	}
+
+	steps := pipeline.Steps{
+		&pipeline.CommandStep{Command: "make"},
+		&pipeline.CommandStep{Command: "make test"},
+	}
+	if err := SignSteps(context.Background(), steps, signingKey(t, key), fakeRepositoryURL); err != nil {
+		t.Fatalf("SignSteps(ctx, steps, key, %q) error = %v", fakeRepositoryURL, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := VerifyPipelineParallel(ctx, &pipeline.Pipeline{Steps: steps}, verificationKeySet(t, verifier), CollectAllFailures, 1, fakeRepositoryURL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyPipelineParallel(cancelled ctx, ...) error = %v, want %v", err, context.Canceled)
+	}
+	if !res.Aborted {
+		t.Errorf("res.Aborted = false, want true")
+	}
+	for _, r := range res.Steps {
+		if !r.Skipped {
+			t.Errorf("%s: Skipped = false, want true", r.Path)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMalformedSignature is returned (wrapped) when the value of a signature
+// isn't a well-formed JWS.
+var ErrMalformedSignature = errors.New("malformed signature")
+
+// SignatureHeader is the protected header of a JWS: the parameters covered by
+// the signature, such as the algorithm and the ID of the key used.
+type SignatureHeader struct {
+	// Algorithm is the alg parameter, such as "EdDSA" or "HS256".
+	Algorithm string
+
+	// KeyID is the kid parameter, if the header has one.
+	KeyID string
+
+	// Params holds all the parameters of the header, including alg and kid,
+	// as decoded from JSON.
+	Params map[string]any
+}
+
+// IsCompact reports whether the value of the signature is a JWS in compact
+// serialisation with a detached payload ("header..signature"), as made by
+// signing with a single key. Signatures made with several keys at once are
+// in JSON serialisation instead.
+func (s *Signature) IsCompact() bool {
+	header, payload, sig, ok := splitCompact(s.Value)
+	return ok && payload == "" && isBase64URL(header) && isBase64URL(sig)
+}
+
+// ProtectedHeaders decodes and returns the protected header of each signature
+// in the value: one for a compact JWS, or one per key for a JWS in JSON
+// serialisation.
+//
+// The headers are decoded without verifying the signature, so they are only
+// suitable for display (for example, showing which key a step claims to be
+// signed with) until the signature has been verified with the signature
+// package.
+func (s *Signature) ProtectedHeaders() ([]*SignatureHeader, error) {
+	var encoded []string
+	if strings.HasPrefix(s.Value, "{") {
+		var msg struct {
+			Signatures []struct {
+				Protected string `json:"protected"`
+			} `json:"signatures"`
+		}
+		if err := json.Unmarshal([]byte(s.Value), &msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+		}
+		if len(msg.Signatures) == 0 {
+			return nil, fmt.Errorf("%w: JWS contains no signatures", ErrMalformedSignature)
+		}
+		for _, sig := range msg.Signatures {
+			encoded = append(encoded, sig.Protected)
+		}
+	} else {
+		header, _, _, ok := splitCompact(s.Value)
+		if !ok {
+			return nil, fmt.Errorf("%w: want a JWS in compact or JSON serialisation", ErrMalformedSignature)
+		}
+		encoded = []string{header}
+	}
+
+	headers := make([]*SignatureHeader, 0, len(encoded))
+	for i, e := range encoded {
+		h, err := decodeSignatureHeader(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: header %d: %v", ErrMalformedSignature, i, err)
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+// ProtectedHeader returns the first of the protected headers of the
+// signature (see ProtectedHeaders), which is the only one unless the
+// signature was made with several keys.
+func (s *Signature) ProtectedHeader() (*SignatureHeader, error) {
+	headers, err := s.ProtectedHeaders()
+	if err != nil {
+		return nil, err
+	}
+	return headers[0], nil
+}
+
+// ValidateFormat checks that the signature is well-formed, without verifying
+// it: that it names an algorithm and signed fields, that its value is a JWS
+// with a detached payload (in compact or JSON serialisation), and that the
+// algorithm of each protected header is the algorithm of the signature.
+// Errors wrap ErrMalformedSignature.
+func (s *Signature) ValidateFormat() error {
+	if s.Algorithm == "" {
+		return fmt.Errorf("%w: no algorithm", ErrMalformedSignature)
+	}
+	if len(s.SignedFields) == 0 {
+		return fmt.Errorf("%w: no signed fields", ErrMalformedSignature)
+	}
+	if !strings.HasPrefix(s.Value, "{") && !s.IsCompact() {
+		return fmt.Errorf("%w: want a JWS with a detached payload", ErrMalformedSignature)
+	}
+	headers, err := s.ProtectedHeaders()
+	if err != nil {
+		return err
+	}
+	for i, h := range headers {
+		if h.Algorithm != s.Algorithm {
+			return fmt.Errorf("%w: header %d has algorithm %q, want %q", ErrMalformedSignature, i, h.Algorithm, s.Algorithm)
+		}
+	}
+	return nil
+}
+
+// splitCompact splits a JWS in compact serialisation into its parts.
+func splitCompact(v string) (header, payload, sig string, ok bool) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// isBase64URL reports whether s is unpadded base64url, as used by JWS.
+func isBase64URL(s string) bool {
+	_, err := base64.RawURLEncoding.DecodeString(s)
+	return err == nil
+}
+
+// decodeSignatureHeader decodes a base64url-encoded protected header.
+func decodeSignatureHeader(encoded string) (*SignatureHeader, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	h := &SignatureHeader{}
+	if err := json.Unmarshal(b, &h.Params); err != nil {
+		return nil, err
+	}
+	if h.Params == nil {
+		return nil, errors.New("header is not a JSON object")
+	}
+	alg, ok := h.Params["alg"].(string)
+	if !ok || alg == "" {
+		return nil, errors.New("header has no alg")
+	}
+	h.Algorithm = alg
+	if kid, ok := h.Params["kid"]; ok {
+		if h.KeyID, ok = kid.(string); !ok {
+			return nil, fmt.Errorf("kid is %T, want a string", kid)
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func b64(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+func TestSignatureProtectedHeaders(t *testing.T) {
+	t.Parallel()
+
+	compact := b64(`{"alg":"EdDSA","kid":"key-1"}`) + ".." + b64("sig")
+	jsonForm := `{"signatures":[` +
+		`{"protected":"` + b64(`{"alg":"HS256","kid":"a"}`) + `","signature":"` + b64("x") + `"},` +
+		`{"protected":"` + b64(`{"alg":"HS256"}`) + `","signature":"` + b64("y") + `"}]}`
+
+	tests := []struct {
+		desc        string
+		sig         *Signature
+		wantCompact bool
+		want        []*SignatureHeader
+	}{
+		{
+			desc:        "compact",
+			sig:         &Signature{Algorithm: "EdDSA", SignedFields: []string{"command"}, Value: compact},
+			wantCompact: true,
+			want: []*SignatureHeader{{
+				Algorithm: "EdDSA",
+				KeyID:     "key-1",
+				Params:    map[string]any{"alg": "EdDSA", "kid": "key-1"},
+			}},
+		},
+		{
+			desc:        "JSON serialisation",
+			sig:         &Signature{Algorithm: "HS256", SignedFields: []string{"command"}, Value: jsonForm},
+			wantCompact: false,
+			want: []*SignatureHeader{
+				{Algorithm: "HS256", KeyID: "a", Params: map[string]any{"alg": "HS256", "kid": "a"}},
+				{Algorithm: "HS256", Params: map[string]any{"alg": "HS256"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.sig.IsCompact(); got != test.wantCompact {
+				t.Errorf("sig.IsCompact() = %t, want %t", got, test.wantCompact)
+			}
+			got, err := test.sig.ProtectedHeaders()
+			if err != nil {
+				t.Fatalf("sig.ProtectedHeaders() error = %v", err)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("sig.ProtectedHeaders() diff (-got +want):\n%s", diff)
+			}
+			first, err := test.sig.ProtectedHeader()
+			if err != nil {
+				t.Fatalf("sig.ProtectedHeader() error = %v", err)
+			}
+			if diff := cmp.Diff(first, test.want[0]); diff != "" {
+				t.Errorf("sig.ProtectedHeader() diff (-got +want):\n%s", diff)
+			}
+			if err := test.sig.ValidateFormat(); err != nil {
+				t.Errorf("sig.ValidateFormat() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestSignatureValidateFormat_Malformed(t *testing.T) {
+	t.Parallel()
+
+	good := b64(`{"alg":"EdDSA"}`) + ".." + b64("sig")
+
+	tests := []struct {
+		desc string
+		sig  *Signature
+	}{
+		{
+			desc: "no algorithm",
+			sig:  &Signature{SignedFields: []string{"command"}, Value: good},
+		},
+		{
+			desc: "no signed fields",
+			sig:  &Signature{Algorithm: "EdDSA", Value: good},
+		},
+		{
+			desc: "not a JWS",
+			sig:  &Signature{Algorithm: "EdDSA", SignedFields: []string{"command"}, Value: "llama"},
+		},
+		{
+			desc: "attached payload",
+			sig:  &Signature{Algorithm: "EdDSA", SignedFields: []string{"command"}, Value: b64(`{"alg":"EdDSA"}`) + "." + b64("payload") + "." + b64("sig")},
+		},
+		{
+			desc: "header isn't base64url",
+			sig:  &Signature{Algorithm: "EdDSA", SignedFields: []string{"command"}, Value: "!!!.." + b64("sig")},
+		},
+		{
+			desc: "header has no alg",
+			sig:  &Signature{Algorithm: "EdDSA", SignedFields: []string{"command"}, Value: b64(`{"kid":"a"}`) + ".." + b64("sig")},
+		},
+		{
+			desc: "algorithm mismatch",
+			sig:  &Signature{Algorithm: "HS256", SignedFields: []string{"command"}, Value: good},
+		},
+		{
+			desc: "JSON with no signatures",
+			sig:  &Signature{Algorithm: "EdDSA", SignedFields: []string{"command"}, Value: `{"signatures":[]}`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := test.sig.ValidateFormat(); !errors.Is(err, ErrMalformedSignature) {
+				t.Errorf("sig.ValidateFormat() = %v, want %v", err, ErrMalformedSignature)
+			}
+		})
+	}
+}
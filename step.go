@@ -9,5 +9,8 @@ package pipeline
 type Step interface {
 	stepTag() // allow only the step types below
 
+	// Hash returns a digest of the step (see Pipeline.Hash).
+	Hash() (string, error)
+
 	selfInterpolater
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
 	"gopkg.in/yaml.v3"
 )
 
@@ -30,6 +31,8 @@ type CommandStep struct {
 	Key   string `yaml:"key,omitempty" aliases:"id,identifier"`
 	Label string `yaml:"label,omitempty" aliases:"name"`
 
+	AllowDependencyFailure bool `yaml:"allow_dependency_failure,omitempty"`
+
 	// Fields that are meaningful specifically for command steps
 	Command   string            `yaml:"command"`
 	Plugins   Plugins           `yaml:"plugins,omitempty"`
@@ -37,6 +40,16 @@ type CommandStep struct {
 	Signature *Signature        `yaml:"signature,omitempty"`
 	Matrix    *Matrix           `yaml:"matrix,omitempty"`
 	Cache     *Cache            `yaml:"cache,omitempty"`
+	Retry     *Retry            `yaml:"retry,omitempty"`
+	Agents    *Agents           `yaml:"agents,omitempty"`
+	SoftFail  *SoftFail         `yaml:"soft_fail,omitempty"`
+	Notify    Notify            `yaml:"notify,omitempty"`
+
+	ArtifactPaths    *ArtifactPaths `yaml:"artifact_paths,omitempty"`
+	TimeoutInMinutes *Int           `yaml:"timeout_in_minutes,omitempty"`
+	Parallelism      *Int           `yaml:"parallelism,omitempty"`
+	Concurrency      *Int           `yaml:"concurrency,omitempty"`
+	ConcurrencyGroup string         `yaml:"concurrency_group,omitempty"`
 
 	// RemainingFields stores any other top-level mapping items so they at least
 	// survive an unmarshal-marshal round-trip.
@@ -62,6 +75,11 @@ func (c *CommandStep) UnmarshalJSON(b []byte) error {
 
 // UnmarshalOrdered unmarshals a command step from an ordered map.
 func (c *CommandStep) UnmarshalOrdered(src any) error {
+	return c.UnmarshalOrderedWith(src)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (c *CommandStep) UnmarshalOrderedWith(src any, opts ...ordered.UnmarshalOption) error {
 	type wrappedCommand CommandStep
 	// Unmarshal into this secret type, then process special fields specially.
 	fullCommand := new(struct {
@@ -71,7 +89,9 @@ func (c *CommandStep) UnmarshalOrdered(src any) error {
 		Rem *wrappedCommand `yaml:",inline"`
 	})
 	fullCommand.Rem = (*wrappedCommand)(c)
-	if err := ordered.Unmarshal(src, fullCommand); err != nil {
+	err := ordered.Unmarshal(src, fullCommand, opts...)
+	w := warning.As(err)
+	if err != nil && w == nil {
 		return fmt.Errorf("unmarshalling CommandStep: %w", err)
 	}
 
@@ -81,6 +101,9 @@ func (c *CommandStep) UnmarshalOrdered(src any) error {
 	// in a consistent way in order to hash all of them
 	// consistently.
 	c.Command = strings.Join(fullCommand.Commands, "\n")
+	if w != nil {
+		return w
+	}
 	return nil
 }
 
@@ -97,6 +120,83 @@ func (c *CommandStep) InterpolateMatrixPermutation(mp MatrixPermutation) error {
 	return c.interpolate(newMatrixInterpolator(mp))
 }
 
+// MatrixExpansion is one of the concrete steps produced by
+// CommandStep.ExpandMatrix.
+type MatrixExpansion struct {
+	// Permutation is the choice of matrix values for this step.
+	Permutation MatrixPermutation
+
+	// Step is a copy of the original step, with the permutation interpolated
+	// into it and the matrix removed.
+	Step *CommandStep
+}
+
+// ExpandMatrix produces a concrete step for each permutation of the step's
+// matrix (see Matrix.Permutations), with {{matrix}} tokens replaced in the
+// command, label, env values, plugins, agents, retry settings, and remaining
+// fields. Adjustments are honoured: skipped permutations are omitted, and
+// soft_fail on an adjustment replaces that of the step. The original step is
+// not modified. The expanded steps are in the canonical form used for upload
+// (for example, plugin sources are in full form). The expanded steps have no
+// signature, since the signature of the original step (which covers its
+// matrix) doesn't verify for them.
+//
+// If the step has no matrix, ExpandMatrix returns a single copy of the step
+// (including any signature) with a nil permutation.
+func (c *CommandStep) ExpandMatrix() ([]*MatrixExpansion, error) {
+	if c.Matrix.IsEmpty() {
+		step, err := c.clone()
+		if err != nil {
+			return nil, err
+		}
+		return []*MatrixExpansion{{Step: step}}, nil
+	}
+
+	combos, err := c.Matrix.combinations()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*MatrixExpansion, 0, len(combos))
+	for _, combo := range combos {
+		step, err := c.clone()
+		if err != nil {
+			return nil, err
+		}
+		step.Matrix = nil
+		step.Signature = nil
+		for _, adj := range combo.adjustments {
+			if adj.SoftFail != nil {
+				step.SoftFail = adj.SoftFail.clone()
+			}
+		}
+		if err := step.interpolate(newMatrixInterpolator(combo.perm)); err != nil {
+			return nil, fmt.Errorf("interpolating matrix permutation %v: %w", combo.perm, err)
+		}
+		out = append(out, &MatrixExpansion{
+			Permutation: combo.perm,
+			Step:        step,
+		})
+	}
+	return out, nil
+}
+
+// clone returns a deep copy of the step, made by round-tripping it through
+// JSON. The copy is in the same canonical form the step would be uploaded in
+// (e.g. plugin sources are in full form).
+func (c *CommandStep) clone() (*CommandStep, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("copying step: %w", err)
+	}
+	cp := new(CommandStep)
+	// Any warnings were already reported when the step was unmarshaled.
+	if err := cp.UnmarshalJSON(b); err != nil && !warning.Is(err) {
+		return nil, fmt.Errorf("copying step: %w", err)
+	}
+	return cp, nil
+}
+
 func (c *CommandStep) interpolate(tf stringTransformer) error {
 	// Fields that are interpolated with env vars and matrix tokens:
 	// command, plugins
@@ -110,14 +210,14 @@ func (c *CommandStep) interpolate(tf stringTransformer) error {
 		return fmt.Errorf("interpolating plugins: %w", err)
 	}
 
-	switch tf.(type) {
+	switch tf := tf.(type) {
 	case envInterpolator:
 		// Env interpolation applies to nearly everything:
 		// key, depends_on, env (keys and values), matrix
 		if err := interpolateString(tf, &c.Key); err != nil {
 			return fmt.Errorf("interpolating key: %w", err)
 		}
-		if err := interpolateMap(tf, c.Env); err != nil {
+		if err := interpolateEnvMap(tf, c.Env); err != nil {
 			return fmt.Errorf("interpolating env: %w", err)
 		}
 		if err := c.Matrix.interpolate(tf); err != nil {
@@ -132,6 +232,34 @@ func (c *CommandStep) interpolate(tf stringTransformer) error {
 		}
 	}
 
+	if err := c.ArtifactPaths.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating artifact_paths: %w", err)
+	}
+	if err := c.TimeoutInMinutes.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating timeout_in_minutes: %w", err)
+	}
+	if err := c.Parallelism.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating parallelism: %w", err)
+	}
+	if err := c.Concurrency.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating concurrency: %w", err)
+	}
+	if err := interpolateString(tf, &c.ConcurrencyGroup); err != nil {
+		return fmt.Errorf("interpolating concurrency_group: %w", err)
+	}
+	if err := c.Agents.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating agents: %w", err)
+	}
+	if err := c.Notify.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating notify: %w", err)
+	}
+	if err := c.SoftFail.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating soft_fail: %w", err)
+	}
+	if err := c.Retry.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating retry: %w", err)
+	}
+
 	// NB: Do not interpolate Signature.
 
 	if err := interpolateMap(tf, c.RemainingFields); err != nil {
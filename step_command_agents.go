@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var _ interface {
+	json.Marshaler
+	yaml.Marshaler
+	ordered.Unmarshaler
+} = (*Agents)(nil)
+
+var errUnsupportedAgentsType = fmt.Errorf("unsupported type for agents")
+
+// Agents are the agent tags that a step's jobs target, such as queue=deploy or
+// os=linux. They can be written either as a mapping:
+//
+//	agents:
+//	  queue: deploy
+//	  os: linux
+//
+// or as a list of "key=value" strings:
+//
+//	agents:
+//	  - queue=deploy
+//	  - os=linux
+//
+// Either way, the tags are available through the same methods, and they are
+// marshaled back in the form they were written in. The zero value is an empty
+// set of tags, written as a mapping.
+//
+// Anything else (such as a single "queue=deploy" string) is kept as it was
+// written, with a warning, rather than failing to parse the step. It has no
+// tags.
+type Agents struct {
+	// ListForm is true if the tags are marshaled as a list of "key=value"
+	// strings, rather than a mapping.
+	ListForm bool
+
+	// tags holds the tags in order. Values are as they were written (so a
+	// mapping can contain non-string values), or nil for list items with no
+	// "=".
+	tags *ordered.MapSA
+
+	// raw is the agents as they were written, if they couldn't be
+	// unmarshaled. It is marshaled back unchanged.
+	raw any
+}
+
+// NewAgents returns agent tags (in mapping form) containing the tags in m,
+// sorted by key.
+func NewAgents(m map[string]string) *Agents {
+	a := &Agents{tags: ordered.NewMap[string, any](len(m))}
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		a.tags.Set(k, m[k])
+	}
+	return a
+}
+
+// Len returns the number of tags.
+func (a *Agents) Len() int {
+	if a == nil {
+		return 0
+	}
+	return a.tags.Len()
+}
+
+// Get returns the value of a tag, and reports whether it is present. Values
+// that are not strings are formatted with fmt.Sprint, and a tag written
+// without a value (such as "- gpu") has the value "".
+func (a *Agents) Get(key string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	v, ok := a.tags.Get(key)
+	if !ok {
+		return "", false
+	}
+	return agentTagString(v), true
+}
+
+// Set sets the value of a tag. If the tag is already present, it remains in
+// the same position, otherwise it is added to the end.
+func (a *Agents) Set(key, value string) {
+	if a.tags == nil {
+		a.tags = ordered.NewMap[string, any](1)
+	}
+	a.tags.Set(key, value)
+}
+
+// Delete removes a tag. It does nothing if the tag is not present.
+func (a *Agents) Delete(key string) {
+	if a == nil || a.tags == nil {
+		return
+	}
+	a.tags.Delete(key)
+}
+
+// All returns an iterator over the tags and their values (as returned by
+// Get), in order.
+func (a *Agents) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if a == nil {
+			return
+		}
+		for k, v := range a.tags.All() {
+			if !yield(k, agentTagString(v)) {
+				return
+			}
+		}
+	}
+}
+
+// ToMap returns the tags as a map.
+func (a *Agents) ToMap() map[string]string {
+	out := make(map[string]string, a.Len())
+	for k, v := range a.All() {
+		out[k] = v
+	}
+	return out
+}
+
+// ToList returns the tags as a list of "key=value" strings. Tags written
+// without a value are listed as the key alone.
+func (a *Agents) ToList() []string {
+	if a == nil {
+		return []string{}
+	}
+	out := make([]string, 0, a.tags.Len())
+	for k, v := range a.tags.All() {
+		if v == nil {
+			out = append(out, k)
+			continue
+		}
+		out = append(out, k+"="+agentTagString(v))
+	}
+	return out
+}
+
+// agentTagString formats a tag value.
+func agentTagString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// marshalForm returns the value to marshal in place of a.
+func (a *Agents) marshalForm() any {
+	if a.raw != nil {
+		return a.raw
+	}
+	if a.ListForm {
+		return a.ToList()
+	}
+	if a.tags == nil {
+		return ordered.NewMap[string, any](0)
+	}
+	return a.tags
+}
+
+// MarshalJSON marshals the tags as a list or a mapping, according to
+// ListForm.
+func (a *Agents) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.marshalForm())
+}
+
+// MarshalYAML returns the tags as a list or a mapping, according to ListForm.
+func (a *Agents) MarshalYAML() (any, error) {
+	return a.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - ordered.Map: a mapping of tags to values
+// - []any: a list of "key=value" strings
+//
+// Anything else is kept as it is, with a warning.
+func (a *Agents) UnmarshalOrdered(o any) error {
+	return a.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+// Tag values are kept as they are written, so no options currently apply.
+func (a *Agents) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	if err := a.unmarshal(o); err != nil {
+		*a = Agents{raw: o}
+		return warning.Wrapf(err, "keeping agents as they are")
+	}
+	return nil
+}
+
+// unmarshal is UnmarshalOrdered, without keeping values that can't be
+// unmarshaled.
+func (a *Agents) unmarshal(o any) error {
+	switch v := o.(type) {
+	case *ordered.MapSA:
+		tags := ordered.NewMap[string, any](v.Len())
+		for k, val := range v.All() {
+			tags.Set(k, val)
+		}
+		*a = Agents{tags: tags}
+
+	case []any:
+		tags := ordered.NewMap[string, any](len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%w: list contains %T, want strings", errUnsupportedAgentsType, item)
+			}
+			key, value, hasValue := strings.Cut(s, "=")
+			if !hasValue {
+				tags.Set(key, nil)
+				continue
+			}
+			tags.Set(key, value)
+		}
+		*a = Agents{ListForm: true, tags: tags}
+
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedAgentsType, v)
+	}
+	return nil
+}
+
+// interpolate interpolates the keys and values of the tags.
+func (a *Agents) interpolate(tf stringTransformer) error {
+	if a == nil {
+		return nil
+	}
+	if a.raw != nil {
+		raw, err := interpolateAny(tf, a.raw)
+		if err != nil {
+			return err
+		}
+		a.raw = raw
+		return nil
+	}
+	if a.tags == nil {
+		return nil
+	}
+	return interpolateOrderedMap(tf, a.tags)
+}
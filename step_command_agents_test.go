@@ -0,0 +1,218 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAgentsUnmarshalOrdered(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		input    string
+		wantMap  map[string]string
+		wantList []string
+		wantJSON string
+	}{
+		{
+			name:     "mapping",
+			input:    "queue: deploy\nos: linux\ngpu: true",
+			wantMap:  map[string]string{"queue": "deploy", "os": "linux", "gpu": "true"},
+			wantList: []string{"queue=deploy", "os=linux", "gpu=true"},
+			wantJSON: `{"queue":"deploy","os":"linux","gpu":true}`,
+		},
+		{
+			name:     "list",
+			input:    "- queue=deploy\n- os=linux\n- gpu\n- expr=a=b",
+			wantMap:  map[string]string{"queue": "deploy", "os": "linux", "gpu": "", "expr": "a=b"},
+			wantList: []string{"queue=deploy", "os=linux", "gpu", "expr=a=b"},
+			wantJSON: `["queue=deploy","os=linux","gpu","expr=a=b"]`,
+		},
+		{
+			name:     "empty list",
+			input:    "[]",
+			wantMap:  map[string]string{},
+			wantList: []string{},
+			wantJSON: `[]`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			agents := new(Agents)
+			if err := ordered.Unmarshal(&n, agents); err != nil {
+				t.Fatalf("ordered.Unmarshal(input, agents) error = %v", err)
+			}
+
+			if diff := cmp.Diff(agents.ToMap(), tc.wantMap); diff != "" {
+				t.Errorf("agents.ToMap() diff (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(agents.ToList(), tc.wantList); diff != "" {
+				t.Errorf("agents.ToList() diff (-got +want):\n%s", diff)
+			}
+
+			gotJSON, err := json.Marshal(agents)
+			if err != nil {
+				t.Fatalf("json.Marshal(agents) error = %v", err)
+			}
+			if diff := cmp.Diff(string(gotJSON), tc.wantJSON); diff != "" {
+				t.Errorf("json.Marshal(agents) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAgentsUnmarshalOrdered_Errors(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"queue=deploy", "[1, 2]", "- [queue, deploy]"} {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			err := ordered.Unmarshal(&n, new(Agents))
+			if !warning.Is(err) || !errors.Is(err, errUnsupportedAgentsType) {
+				t.Errorf("ordered.Unmarshal(input, new(Agents)) error = %v, want a warning wrapping %v", err, errUnsupportedAgentsType)
+			}
+		})
+	}
+}
+
+func TestParserKeepsUnsupportedAgents(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: make {{matrix}}
+    agents: "queue=x"
+    matrix: [a, b]
+`))
+	if !warning.Is(err) || !errors.Is(err, errUnsupportedAgentsType) {
+		t.Fatalf("Parse(input) error = %v, want a warning wrapping %v", err, errUnsupportedAgentsType)
+	}
+	step, ok := p.Steps[0].(*CommandStep)
+	if !ok {
+		t.Fatalf("p.Steps[0] = %T, want *CommandStep", p.Steps[0])
+	}
+	if got := step.Agents.Len(); got != 0 {
+		t.Errorf("step.Agents.Len() = %d, want 0", got)
+	}
+
+	gotJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	want := `{"steps":[{"agents":"queue=x","command":"make {{matrix}}","matrix":["a","b"]}]}`
+	if diff := cmp.Diff(string(gotJSON), want); diff != "" {
+		t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+	if _, err := yaml.Marshal(p); err != nil {
+		t.Errorf("yaml.Marshal(p) error = %v", err)
+	}
+
+	// The expanded steps keep the agents as they were written.
+	expanded, err := step.ExpandMatrix()
+	if err != nil {
+		t.Fatalf("step.ExpandMatrix() error = %v", err)
+	}
+	for _, e := range expanded {
+		got, err := json.Marshal(e.Step.Agents)
+		if err != nil {
+			t.Fatalf("json.Marshal(e.Step.Agents) error = %v", err)
+		}
+		if diff := cmp.Diff(string(got), `"queue=x"`); diff != "" {
+			t.Errorf("json.Marshal(e.Step.Agents) diff (-got +want):\n%s", diff)
+		}
+	}
+}
+
+func TestAgentsEdit(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: one
+    agents:
+      queue: build
+      os: linux
+  - command: two
+    agents:
+      - queue=build
+      - os=linux
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	// Rewriting the queue should work the same way regardless of form, and
+	// each step should keep its form.
+	for _, s := range p.Steps {
+		c := s.(*CommandStep)
+		if q, _ := c.Agents.Get("queue"); q == "build" {
+			c.Agents.Set("queue", "build-v2")
+		}
+		c.Agents.Delete("os")
+		c.Agents.Set("arch", "arm64")
+	}
+
+	got, err := json.Marshal(p.Steps)
+	if err != nil {
+		t.Fatalf("json.Marshal(p.Steps) error = %v", err)
+	}
+	want := `[{"agents":{"queue":"build-v2","arch":"arm64"},"command":"one"},{"agents":["queue=build-v2","arch=arm64"],"command":"two"}]`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("json.Marshal(p.Steps) diff (-got +want):\n%s", diff)
+	}
+
+	// Switching form normalises the output.
+	two := p.Steps[1].(*CommandStep)
+	two.Agents.ListForm = false
+	gotYAML, err := yaml.Marshal(two)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(two) error = %v", err)
+	}
+	wantYAML := "command: two\nagents:\n    queue: build-v2\n    arch: arm64\n"
+	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
+		t.Errorf("yaml.Marshal(two) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestAgentsNil(t *testing.T) {
+	t.Parallel()
+
+	var a *Agents
+	if got := a.Len(); got != 0 {
+		t.Errorf("a.Len() = %d, want 0", got)
+	}
+	if got, ok := a.Get("queue"); ok {
+		t.Errorf("a.Get(queue) = %q, true, want false", got)
+	}
+	if diff := cmp.Diff(a.ToMap(), map[string]string{}); diff != "" {
+		t.Errorf("a.ToMap() diff (-got +want):\n%s", diff)
+	}
+
+	var zero Agents
+	zero.Set("queue", "deploy")
+	got, err := json.Marshal(&zero)
+	if err != nil {
+		t.Fatalf("json.Marshal(&zero) error = %v", err)
+	}
+	if diff := cmp.Diff(string(got), `{"queue":"deploy"}`); diff != "" {
+		t.Errorf("json.Marshal(&zero) diff (-got +want):\n%s", diff)
+	}
+}
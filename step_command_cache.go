@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
 )
 
 var _ interface {
@@ -40,6 +41,11 @@ func (c *Cache) MarshalJSON() ([]byte, error) {
 // - []string: multiple paths
 // - ordered.Map: a map containing paths, among potentially other things
 func (c *Cache) UnmarshalOrdered(o any) error {
+	return c.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (c *Cache) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
 	switch v := o.(type) {
 	case bool:
 		if !v {
@@ -50,15 +56,16 @@ func (c *Cache) UnmarshalOrdered(o any) error {
 
 	case []any:
 		s := make([]string, 0, len(v))
-		if err := ordered.Unmarshal(v, &s); err != nil {
+		err := ordered.Unmarshal(v, &s, alwaysCoerce(opts)...)
+		if err != nil && !warning.Is(err) {
 			return err
 		}
-
 		c.Paths = s
+		return err
 
 	case *ordered.MapSA:
 		type wrappedCache Cache
-		if err := ordered.Unmarshal(o, (*wrappedCache)(c)); err != nil {
+		if err := ordered.Unmarshal(o, (*wrappedCache)(c), alwaysCoerce(opts)...); err != nil {
 			return err
 		}
 
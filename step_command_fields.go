@@ -0,0 +1,205 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = []interface {
+	json.Marshaler
+	yaml.Marshaler
+	ordered.Unmarshaler
+	selfInterpolater
+}{
+	(*Int)(nil),
+	(*ArtifactPaths)(nil),
+}
+
+var (
+	errUnsupportedIntType           = fmt.Errorf("unsupported type for integer")
+	errUnsupportedArtifactPathsType = fmt.Errorf("unsupported type for artifact_paths")
+)
+
+// Int is an integer field of a step, such as timeout_in_minutes. As well as an
+// integer, it can be written as a string, which is typically an environment
+// variable to be interpolated into an integer (such as "${TIMEOUT}"). It
+// marshals in the form it was written in.
+type Int struct {
+	n int
+
+	// text is the string the field was written as, if it was written as a
+	// string.
+	text string
+}
+
+// NewInt returns an Int containing n.
+func NewInt(n int) *Int {
+	return &Int{n: n}
+}
+
+// Get returns the integer, and reports whether there is one: it is false if
+// the field is a string that isn't an integer, such as an uninterpolated
+// "${TIMEOUT}".
+func (i *Int) Get() (int, bool) {
+	if i == nil {
+		return 0, false
+	}
+	if i.text == "" {
+		return i.n, true
+	}
+	n, err := strconv.Atoi(i.text)
+	return n, err == nil
+}
+
+// Set sets the field to the integer n.
+func (i *Int) Set(n int) {
+	*i = Int{n: n}
+}
+
+// String returns the field as it was written.
+func (i *Int) String() string {
+	if i.text != "" {
+		return i.text
+	}
+	return strconv.Itoa(i.n)
+}
+
+// marshalForm returns the value to marshal in place of i.
+func (i *Int) marshalForm() any {
+	if i.text != "" {
+		return i.text
+	}
+	return i.n
+}
+
+// MarshalJSON marshals the field as an integer, or a string if it was written
+// as one.
+func (i *Int) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.marshalForm())
+}
+
+// MarshalYAML returns the field as an integer, or a string if it was written
+// as one.
+func (i *Int) MarshalYAML() (any, error) {
+	return i.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals from either an int or a string.
+func (i *Int) UnmarshalOrdered(o any) error {
+	switch v := o.(type) {
+	case int:
+		*i = Int{n: v}
+
+	case string:
+		*i = Int{text: v}
+
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedIntType, v)
+	}
+	return nil
+}
+
+func (i *Int) interpolate(tf stringTransformer) error {
+	if i == nil {
+		return nil
+	}
+	return interpolateString(tf, &i.text)
+}
+
+// ArtifactPaths are the paths (or globs) of artifacts to upload after a
+// command step runs. They can be written as a single string or a list of
+// strings, and marshal in the form they were written in. Anything else (such
+// as a mapping) is kept as it was written, with a warning, and has no paths.
+type ArtifactPaths struct {
+	Paths []string
+
+	// scalar records that the paths were written as a single string, so that
+	// they marshal back the same way.
+	scalar bool
+
+	// raw is the paths as they were written, if they couldn't be
+	// unmarshaled. It is marshaled back unchanged.
+	raw any
+}
+
+// marshalForm returns the value to marshal in place of a.
+func (a *ArtifactPaths) marshalForm() any {
+	if a.raw != nil {
+		return a.raw
+	}
+	if a.scalar && len(a.Paths) == 1 {
+		return a.Paths[0]
+	}
+	if a.Paths == nil {
+		return []string{}
+	}
+	return a.Paths
+}
+
+// MarshalJSON marshals the paths as a string or a list, according to how
+// they were written.
+func (a *ArtifactPaths) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.marshalForm())
+}
+
+// MarshalYAML returns the paths as a string or a list, according to how they
+// were written.
+func (a *ArtifactPaths) MarshalYAML() (any, error) {
+	return a.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - string: a single path
+// - []any: multiple paths
+//
+// Anything else is kept as it is, with a warning.
+func (a *ArtifactPaths) UnmarshalOrdered(o any) error {
+	return a.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (a *ArtifactPaths) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case string:
+		*a = ArtifactPaths{Paths: []string{v}, scalar: true}
+
+	case []any:
+		paths := make([]string, 0, len(v))
+		err := ordered.Unmarshal(v, &paths, opts...)
+		if errors.Is(err, ordered.ErrNotCoerced) {
+			return err
+		}
+		if err != nil && !warning.Is(err) {
+			*a = ArtifactPaths{raw: v}
+			return warning.Wrapf(fmt.Errorf("%w: %w", errUnsupportedArtifactPathsType, err), "keeping artifact_paths as they are")
+		}
+		*a = ArtifactPaths{Paths: paths}
+		return err
+
+	default:
+		*a = ArtifactPaths{raw: v}
+		return warning.Newf("%w: %T; keeping it as it is", errUnsupportedArtifactPathsType, v)
+	}
+	return nil
+}
+
+func (a *ArtifactPaths) interpolate(tf stringTransformer) error {
+	if a == nil {
+		return nil
+	}
+	if a.raw != nil {
+		raw, err := interpolateAny(tf, a.raw)
+		if err != nil {
+			return err
+		}
+		a.raw = raw
+		return nil
+	}
+	return interpolateSlice(tf, a.Paths)
+}
@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCommandStepTypedFields(t *testing.T) {
+	t.Parallel()
+
+	const input = `---
+steps:
+  - command: one
+    artifact_paths: "logs/**/*;coverage/**/*"
+    timeout_in_minutes: 10
+    parallelism: 4
+    concurrency: 1
+    concurrency_group: deploys
+  - command: two
+    artifact_paths:
+      - logs/**/*
+      - coverage/**/*
+    timeout_in_minutes: ${TIMEOUT}
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Steps: Steps{
+			&CommandStep{
+				Command:          "one",
+				ArtifactPaths:    &ArtifactPaths{Paths: []string{"logs/**/*;coverage/**/*"}, scalar: true},
+				TimeoutInMinutes: NewInt(10),
+				Parallelism:      NewInt(4),
+				Concurrency:      NewInt(1),
+				ConcurrencyGroup: "deploys",
+			},
+			&CommandStep{
+				Command:          "two",
+				ArtifactPaths:    &ArtifactPaths{Paths: []string{"logs/**/*", "coverage/**/*"}},
+				TimeoutInMinutes: &Int{text: "${TIMEOUT}"},
+			},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+
+	// Fields marshal in the form they were written in.
+	gotJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	const wantJSON = `{"steps":[` +
+		`{"artifact_paths":"logs/**/*;coverage/**/*","command":"one","concurrency":1,"concurrency_group":"deploys","parallelism":4,"timeout_in_minutes":10},` +
+		`{"artifact_paths":["logs/**/*","coverage/**/*"],"command":"two","timeout_in_minutes":"${TIMEOUT}"}]}`
+	if diff := cmp.Diff(string(gotJSON), wantJSON); diff != "" {
+		t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+
+	if err := p.Interpolate(env.New(env.FromMap(map[string]string{"TIMEOUT": "30"})), false); err != nil {
+		t.Fatalf("p.Interpolate(env, false) error = %v", err)
+	}
+	timeout, ok := p.Steps[1].(*CommandStep).TimeoutInMinutes.Get()
+	if !ok || timeout != 30 {
+		t.Errorf("TimeoutInMinutes.Get() = %d, %t, want 30, true", timeout, ok)
+	}
+}
+
+func TestIntGet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		i      *Int
+		want   int
+		wantOK bool
+	}{
+		{i: nil, want: 0, wantOK: false},
+		{i: NewInt(7), want: 7, wantOK: true},
+		{i: &Int{text: "12"}, want: 12, wantOK: true},
+		{i: &Int{text: "${N}"}, want: 0, wantOK: false},
+	}
+	for _, test := range tests {
+		got, ok := test.i.Get()
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("(%v).Get() = %d, %t, want %d, %t", test.i, got, ok, test.want, test.wantOK)
+		}
+	}
+
+	i := &Int{text: "${N}"}
+	i.Set(3)
+	b, err := yaml.Marshal(i)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(i) error = %v", err)
+	}
+	if diff := cmp.Diff(string(b), "3\n"); diff != "" {
+		t.Errorf("yaml.Marshal(i) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestTypedFieldsUnmarshalOrdered_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src     any
+		dst     ordered.Unmarshaler
+		wantErr error
+	}{
+		{src: 1.5, dst: new(Int), wantErr: errUnsupportedIntType},
+		{src: []any{1}, dst: new(Int), wantErr: errUnsupportedIntType},
+		{src: 3, dst: new(ArtifactPaths), wantErr: errUnsupportedArtifactPathsType},
+		{src: ordered.NewMap[string, any](0), dst: new(ArtifactPaths), wantErr: errUnsupportedArtifactPathsType},
+	}
+	for _, test := range tests {
+		if err := test.dst.UnmarshalOrdered(test.src); !errors.Is(err, test.wantErr) {
+			t.Errorf("%T.UnmarshalOrdered(%v) error = %v, want %v", test.dst, test.src, err, test.wantErr)
+		}
+	}
+}
+
+func TestParserKeepsUnsupportedArtifactPaths(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: make
+    artifact_paths:
+      logs: "*.log"
+`))
+	if !warning.Is(err) || !errors.Is(err, errUnsupportedArtifactPathsType) {
+		t.Fatalf("Parse(input) error = %v, want a warning wrapping %v", err, errUnsupportedArtifactPathsType)
+	}
+	step, ok := p.Steps[0].(*CommandStep)
+	if !ok {
+		t.Fatalf("p.Steps[0] = %T, want *CommandStep", p.Steps[0])
+	}
+	if len(step.ArtifactPaths.Paths) != 0 {
+		t.Errorf("step.ArtifactPaths.Paths = %q, want none", step.ArtifactPaths.Paths)
+	}
+
+	gotJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	want := `{"steps":[{"artifact_paths":{"logs":"*.log"},"command":"make"}]}`
+	if diff := cmp.Diff(string(gotJSON), want); diff != "" {
+		t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+	if _, err := yaml.Marshal(p); err != nil {
+		t.Errorf("yaml.Marshal(p) error = %v", err)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
 	"gopkg.in/yaml.v3"
 )
 
@@ -58,6 +61,11 @@ func (m *Matrix) IsEmpty() bool {
 
 // UnmarshalOrdererd unmarshals from either []any or *ordered.MapSA.
 func (m *Matrix) UnmarshalOrdered(o any) error {
+	return m.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (m *Matrix) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
 	switch src := o.(type) {
 	case []any:
 		// Single anonymous dimension matrix, no adjustments.
@@ -66,17 +74,19 @@ func (m *Matrix) UnmarshalOrdered(o any) error {
 		//   - apple
 		//   - 47
 		s := make([]string, 0, len(src))
-		if err := ordered.Unmarshal(src, &s); err != nil {
+		err := ordered.Unmarshal(src, &s, alwaysCoerce(opts)...)
+		if err != nil && !warning.Is(err) {
 			return err
 		}
 		m.Setup = MatrixSetup{"": s}
+		return err
 
 	case *ordered.MapSA:
 		// Single anonymous dimension, or multiple named dimensions, with or
 		// without adjustments.
 		// Unmarshal into this secret wrapper type to avoid infinite recursion.
 		type wrappedMatrix Matrix
-		if err := ordered.Unmarshal(o, (*wrappedMatrix)(m)); err != nil {
+		if err := ordered.Unmarshal(o, (*wrappedMatrix)(m), opts...); err != nil {
 			return err
 		}
 
@@ -216,12 +226,94 @@ func (m *Matrix) validatePermutation(p MatrixPermutation) error {
 	return nil
 }
 
+// Permutations returns every permutation of the matrix that would run: the
+// cross product of the setup dimensions (in order of dimension name, then
+// value), followed by the new combinations introduced by adjustments.
+// Permutations skipped by an adjustment are omitted.
+func (m *Matrix) Permutations() ([]MatrixPermutation, error) {
+	combos, err := m.combinations()
+	if err != nil || combos == nil {
+		return nil, err
+	}
+	perms := make([]MatrixPermutation, 0, len(combos))
+	for _, c := range combos {
+		perms = append(perms, c.perm)
+	}
+	return perms, nil
+}
+
+// matrixCombination is a permutation, together with the (non-skipping)
+// adjustments that apply to it.
+type matrixCombination struct {
+	perm        MatrixPermutation
+	adjustments []*MatrixAdjustment
+}
+
+// combinations is the implementation of Permutations.
+func (m *Matrix) combinations() ([]*matrixCombination, error) {
+	if m.IsEmpty() {
+		return nil, nil
+	}
+
+	// Cross product of the setup dimensions.
+	dims := make([]string, 0, len(m.Setup))
+	for dim := range m.Setup {
+		dims = append(dims, dim)
+	}
+	slices.Sort(dims)
+
+	combos := []*matrixCombination{{perm: MatrixPermutation{}}}
+	for _, dim := range dims {
+		next := make([]*matrixCombination, 0, len(combos)*len(m.Setup[dim]))
+		for _, c := range combos {
+			for _, val := range m.Setup[dim] {
+				p := maps.Clone(c.perm)
+				p[dim] = val
+				next = append(next, &matrixCombination{perm: p})
+			}
+		}
+		combos = next
+	}
+
+	// Apply adjustments, which either modify or skip an existing combination,
+	// or add a new one.
+	skipped := make(map[*matrixCombination]bool)
+	for _, adj := range m.Adjustments {
+		if len(adj.With) != len(m.Setup) {
+			return nil, fmt.Errorf("%w: %d != %d", errAdjustmentLengthMismatch, len(adj.With), len(m.Setup))
+		}
+		for dim := range adj.With {
+			if m.Setup[dim] == nil {
+				return nil, fmt.Errorf("%w: %q", errAdjustmentUnknownDimension, dim)
+			}
+		}
+
+		i := slices.IndexFunc(combos, func(c *matrixCombination) bool {
+			return maps.Equal(c.perm, MatrixPermutation(adj.With))
+		})
+		if i < 0 {
+			combos = append(combos, &matrixCombination{perm: MatrixPermutation(maps.Clone(adj.With))})
+			i = len(combos) - 1
+		}
+		if adj.ShouldSkip() {
+			skipped[combos[i]] = true
+			continue
+		}
+		combos[i].adjustments = append(combos[i].adjustments, adj)
+	}
+
+	return slices.DeleteFunc(combos, func(c *matrixCombination) bool {
+		return skipped[c]
+	}), nil
+}
+
 // MatrixPermutation represents a possible permutation of a matrix.
 type MatrixPermutation map[string]string
 
 // MatrixSetup is the main setup of a matrix - one or more dimensions. The cross
 // product of the dimensions in the setup produces the base combinations of
-// matrix values.
+// matrix values. Parse keeps values as they were written, so a version written
+// as 3.10 is "3.10", not "3.1".
 type MatrixSetup map[string][]string
 
 // MarshalJSON returns either a list (if the setup is a single anonymous
@@ -243,6 +335,11 @@ func (ms MatrixSetup) MarshalYAML() (any, error) {
 
 // UnmarshalOrdered unmarshals from either []any or *ordered.MapSA.
 func (ms *MatrixSetup) UnmarshalOrdered(o any) error {
+	return ms.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (ms *MatrixSetup) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
 	if *ms == nil {
 		*ms = make(MatrixSetup)
 	}
@@ -256,15 +353,17 @@ func (ms *MatrixSetup) UnmarshalOrdered(o any) error {
 		//     - apple
 		//     - 47
 		s := make([]string, 0, len(src))
-		if err := ordered.Unmarshal(src, &s); err != nil {
+		err := ordered.Unmarshal(src, &s, alwaysCoerce(opts)...)
+		if err != nil && !warning.Is(err) {
 			return err
 		}
 		(*ms)[""] = s
+		return err
 
 	case *ordered.MapSA:
 		// One or more (named) dimensions.
 		// Unmarshal into the underlying type to avoid infinite recursion.
-		if err := ordered.Unmarshal(src, (*map[string][]string)(ms)); err != nil {
+		if err := ordered.Unmarshal(src, (*map[string][]string)(ms), alwaysCoerce(opts)...); err != nil {
 			return err
 		}
 
@@ -274,16 +373,24 @@ func (ms *MatrixSetup) UnmarshalOrdered(o any) error {
 	return nil
 }
 
+// alwaysCoerce returns opts, but with values that aren't strings converted
+// into strings as for ordered.CoerceScalars (whatever the policy in opts),
+// since matrix values and cache paths are commonly numbers.
+func alwaysCoerce(opts []ordered.UnmarshalOption) []ordered.UnmarshalOption {
+	return append(slices.Clip(opts), ordered.WithCoercion(ordered.CoerceScalars))
+}
+
 // MatrixAdjustments is a set of adjustments.
 type MatrixAdjustments []*MatrixAdjustment
 
 // MatrixAdjustment models an adjustment - a combination of (possibly new)
 // matrix values, and skip/soft fail configuration.
 type MatrixAdjustment struct {
-	With MatrixAdjustmentWith `yaml:"with"`
-	Skip any                  `yaml:"skip,omitempty"`
+	With     MatrixAdjustmentWith `yaml:"with"`
+	Skip     any                  `yaml:"skip,omitempty"`
+	SoftFail *SoftFail            `yaml:"soft_fail,omitempty"`
 
-	RemainingFields map[string]any `yaml:",inline"` // NB: soft_fail is in the remaining fields
+	RemainingFields map[string]any `yaml:",inline"`
 }
 
 func (ma *MatrixAdjustment) ShouldSkip() bool {
@@ -311,6 +418,9 @@ func (ma *MatrixAdjustment) interpolate(tf stringTransformer) error {
 	if err := interpolateMap(tf, ma.With); err != nil {
 		return err
 	}
+	if err := ma.SoftFail.interpolate(tf); err != nil {
+		return err
+	}
 	return interpolateMap(tf, ma.RemainingFields)
 }
 
@@ -357,7 +467,7 @@ func (maw *MatrixAdjustmentWith) UnmarshalOrdered(o any) error {
 	case *ordered.MapSA:
 		// A map of dimension key -> dimension value. (Tuple of dimension value
 		// selections.)
-		return src.Range(func(k string, v any) error {
+		for k, v := range src.All() {
 			switch vt := v.(type) {
 			case bool, int, string:
 				(*maw)[k] = fmt.Sprint(vt)
@@ -365,8 +475,8 @@ func (maw *MatrixAdjustmentWith) UnmarshalOrdered(o any) error {
 			default:
 				return fmt.Errorf("unsupported value type %T in key %q for MatrixAdjustmentsWith", v, k)
 			}
-			return nil
-		})
+		}
+		return nil
 
 	default:
 		return fmt.Errorf("unsupported src type for MatrixAdjustmentsWith: %T", o)
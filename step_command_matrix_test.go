@@ -402,3 +402,71 @@ func TestMatrixPermutation_UnmarshalJSON(t *testing.T) {
 		t.Errorf("unmarshalled MatrixPermutation diff (-got +want):\n%s", diff)
 	}
 }
+
+func TestMatrix_Permutations(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc    string
+		matrix  *Matrix
+		want    []MatrixPermutation
+		wantErr error
+	}{
+		{
+			desc:   "nil",
+			matrix: nil,
+			want:   nil,
+		},
+		{
+			desc: "simple",
+			matrix: &Matrix{
+				Setup: MatrixSetup{"": {"a", "b"}},
+			},
+			want: []MatrixPermutation{{"": "a"}, {"": "b"}},
+		},
+		{
+			desc: "multiple dimensions with adjustments",
+			matrix: &Matrix{
+				Setup: MatrixSetup{
+					"os":   {"linux", "windows"},
+					"arch": {"amd64", "arm64"},
+				},
+				Adjustments: MatrixAdjustments{
+					{With: MatrixAdjustmentWith{"os": "windows", "arch": "arm64"}, Skip: true},
+					{With: MatrixAdjustmentWith{"os": "darwin", "arch": "arm64"}},
+					{With: MatrixAdjustmentWith{"os": "linux", "arch": "amd64"}, SoftFail: &SoftFail{All: true}},
+				},
+			},
+			want: []MatrixPermutation{
+				{"arch": "amd64", "os": "linux"},
+				{"arch": "amd64", "os": "windows"},
+				{"arch": "arm64", "os": "linux"},
+				{"arch": "arm64", "os": "darwin"},
+			},
+		},
+		{
+			desc: "invalid adjustment",
+			matrix: &Matrix{
+				Setup: MatrixSetup{"os": {"linux"}},
+				Adjustments: MatrixAdjustments{
+					{With: MatrixAdjustmentWith{"arch": "arm64"}},
+				},
+			},
+			wantErr: errAdjustmentUnknownDimension,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := test.matrix.Permutations()
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("matrix.Permutations() error = %v, want %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("matrix.Permutations() diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
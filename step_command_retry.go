@@ -0,0 +1,450 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+	} = (*Retry)(nil)
+
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+	} = (*AutomaticRetry)(nil)
+
+	_ interface {
+		json.Marshaler
+		ordered.Unmarshaler
+	} = (*AutomaticRetryRule)(nil)
+
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+	} = (*ExitStatus)(nil)
+
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+	} = (*ManualRetry)(nil)
+)
+
+var (
+	errUnsupportedRetryType      = fmt.Errorf("unsupported type for retry")
+	errUnsupportedExitStatusType = fmt.Errorf("exit_status must be an integer, a list of integers, or \"*\"")
+)
+
+// maxRetryLimit is the largest automatic retry limit the API accepts.
+const maxRetryLimit = 10
+
+// Retry models the retry settings of a command step:
+//
+//	retry:
+//	  automatic: true | { exit_status, limit, signal, signal_reason } | [ ... ]
+//	  manual: true | { allowed, permit_on_passed, reason }
+//
+// Settings that can't be unmarshaled (such as automatic written as a number)
+// are kept as they were written, with a warning, rather than failing to parse
+// the step. They don't pass validation.
+type Retry struct {
+	Automatic *AutomaticRetry `yaml:"automatic,omitempty"`
+	Manual    *ManualRetry    `yaml:"manual,omitempty"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+
+	// raw is the settings as they were written, if they couldn't be
+	// unmarshaled. It is marshaled back unchanged.
+	raw any
+}
+
+// wrappedRetry is Retry without its marshaling methods.
+type wrappedRetry Retry
+
+// MarshalJSON marshals the retry settings to JSON. Special handling is needed
+// because yaml.v3 has "inline" but encoding/json has no concept of it.
+func (r *Retry) MarshalJSON() ([]byte, error) {
+	if r.raw != nil {
+		return json.Marshal(r.raw)
+	}
+	return inlineFriendlyMarshalJSON((*wrappedRetry)(r))
+}
+
+// MarshalYAML returns the retry settings, or if they couldn't be unmarshaled,
+// the value as it was written.
+func (r *Retry) MarshalYAML() (any, error) {
+	if r.raw != nil {
+		return r.raw, nil
+	}
+	return (*wrappedRetry)(r), nil
+}
+
+// UnmarshalOrdered unmarshals retry settings from an ordered map. Anything
+// that can't be unmarshaled is kept as it is, with a warning.
+func (r *Retry) UnmarshalOrdered(o any) error {
+	return r.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (r *Retry) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	var err error
+	if _, ok := o.(*ordered.MapSA); ok {
+		err = ordered.Unmarshal(o, (*wrappedRetry)(r), opts...)
+	} else {
+		err = fmt.Errorf("%T", o)
+	}
+	if err == nil || warning.Is(err) || errors.Is(err, ordered.ErrNotCoerced) {
+		return err
+	}
+	*r = Retry{raw: o}
+	if !errors.Is(err, errUnsupportedRetryType) {
+		err = fmt.Errorf("%w: %w", errUnsupportedRetryType, err)
+	}
+	return warning.Wrapf(err, "keeping retry as it is")
+}
+
+// AutomaticRetry models automatic retries. It can be written as a bool
+// (enabling automatic retries with the default rule, or disabling them), a
+// single rule, or a list of rules.
+type AutomaticRetry struct {
+	// Disabled is true when automatic retries were written as false.
+	Disabled bool
+
+	// Rules are the retry rules. If there are none (and Disabled is false),
+	// automatic retries are enabled with the default rule.
+	Rules []*AutomaticRetryRule
+
+	// single records that a single rule was written without a list, so that
+	// it marshals back the same way.
+	single bool
+}
+
+// NewAutomaticRetry returns automatic retry settings with the given rules.
+// With no rules, automatic retries are enabled with the default rule.
+func NewAutomaticRetry(rules ...*AutomaticRetryRule) *AutomaticRetry {
+	return &AutomaticRetry{Rules: rules}
+}
+
+// marshalForm returns the value to marshal in place of a.
+func (a *AutomaticRetry) marshalForm() any {
+	switch {
+	case a.Disabled:
+		return false
+	case len(a.Rules) == 0:
+		return true
+	case a.single && len(a.Rules) == 1:
+		return a.Rules[0]
+	default:
+		return a.Rules
+	}
+}
+
+// MarshalJSON marshals the settings as a bool, a single rule, or a list of
+// rules, according to how they were written.
+func (a *AutomaticRetry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.marshalForm())
+}
+
+// MarshalYAML returns the settings as a bool, a single rule, or a list of
+// rules, according to how they were written.
+func (a *AutomaticRetry) MarshalYAML() (any, error) {
+	return a.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - bool: enables or disables automatic retries
+// - ordered.Map: a single rule
+// - []any: a list of rules
+func (a *AutomaticRetry) UnmarshalOrdered(o any) error {
+	return a.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (a *AutomaticRetry) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case bool:
+		*a = AutomaticRetry{Disabled: !v}
+
+	case *ordered.MapSA:
+		rule := new(AutomaticRetryRule)
+		err := ordered.Unmarshal(v, rule, opts...)
+		if err != nil && !warning.Is(err) {
+			return err
+		}
+		*a = AutomaticRetry{Rules: []*AutomaticRetryRule{rule}, single: true}
+		return err
+
+	case []any:
+		rules := make([]*AutomaticRetryRule, 0, len(v))
+		err := ordered.Unmarshal(v, &rules, opts...)
+		if err != nil && !warning.Is(err) {
+			return err
+		}
+		*a = AutomaticRetry{Rules: rules}
+		return err
+
+	default:
+		return fmt.Errorf("%w: automatic has type %T", errUnsupportedRetryType, v)
+	}
+	return nil
+}
+
+// AutomaticRetryRule is one rule for retrying a job automatically.
+type AutomaticRetryRule struct {
+	ExitStatus   *ExitStatus `yaml:"exit_status,omitempty"`
+	Limit        *int        `yaml:"limit,omitempty"`
+	Signal       string      `yaml:"signal,omitempty"`
+	SignalReason string      `yaml:"signal_reason,omitempty"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// MarshalJSON marshals the rule to JSON. Special handling is needed because
+// yaml.v3 has "inline" but encoding/json has no concept of it.
+func (r *AutomaticRetryRule) MarshalJSON() ([]byte, error) {
+	return inlineFriendlyMarshalJSON(r)
+}
+
+// UnmarshalOrdered unmarshals a rule from an ordered map.
+func (r *AutomaticRetryRule) UnmarshalOrdered(o any) error {
+	return r.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (r *AutomaticRetryRule) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	if _, ok := o.(*ordered.MapSA); !ok {
+		return fmt.Errorf("%w: rule has type %T", errUnsupportedRetryType, o)
+	}
+	type wrappedRule AutomaticRetryRule
+	if err := ordered.Unmarshal(o, (*wrappedRule)(r), opts...); err != nil {
+		if warning.Is(err) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", errUnsupportedRetryType, err)
+	}
+	return nil
+}
+
+// ExitStatus is the exit_status of an automatic retry rule or a soft_fail
+// rule: a single exit status, a list of them, or "*" (any exit status).
+type ExitStatus struct {
+	// Any is true for "*".
+	Any bool
+
+	// Statuses are the exit statuses the rule applies to.
+	Statuses []int
+
+	// list records that the statuses were written as a list, so that a
+	// single status marshals back the same way.
+	list bool
+}
+
+// marshalForm returns the value to marshal in place of e.
+func (e *ExitStatus) marshalForm() any {
+	switch {
+	case e.Any:
+		return "*"
+	case len(e.Statuses) == 1 && !e.list:
+		return e.Statuses[0]
+	default:
+		return e.Statuses
+	}
+}
+
+// MarshalJSON marshals the exit status as "*", an integer, or a list of
+// integers, according to how it was written.
+func (e *ExitStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.marshalForm())
+}
+
+// MarshalYAML returns the exit status as "*", an integer, or a list of
+// integers, according to how it was written.
+func (e *ExitStatus) MarshalYAML() (any, error) {
+	return e.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - int: a single exit status
+// - string: "*", meaning any exit status
+// - []any: a list of exit statuses
+func (e *ExitStatus) UnmarshalOrdered(o any) error {
+	switch v := o.(type) {
+	case int:
+		*e = ExitStatus{Statuses: []int{v}}
+
+	case string:
+		if v != "*" {
+			return fmt.Errorf("%w: got %q", errUnsupportedExitStatusType, v)
+		}
+		*e = ExitStatus{Any: true}
+
+	case []any:
+		statuses := make([]int, 0, len(v))
+		for _, s := range v {
+			n, ok := s.(int)
+			if !ok {
+				return fmt.Errorf("%w: list contains %T", errUnsupportedExitStatusType, s)
+			}
+			statuses = append(statuses, n)
+		}
+		*e = ExitStatus{Statuses: statuses, list: true}
+
+	default:
+		return fmt.Errorf("%w: got %T", errUnsupportedExitStatusType, v)
+	}
+	return nil
+}
+
+// matches reports whether the exit status is one of e's. A nil ExitStatus
+// matches nothing.
+func (e *ExitStatus) matches(status int) bool {
+	if e == nil {
+		return false
+	}
+	return e.Any || slices.Contains(e.Statuses, status)
+}
+
+// ManualRetry models manual retries. It can be written as a bool (whether
+// manual retries are allowed) or a mapping.
+type ManualRetry struct {
+	Allowed        *bool  `yaml:"allowed,omitempty"`
+	PermitOnPassed *bool  `yaml:"permit_on_passed,omitempty"`
+	Reason         string `yaml:"reason,omitempty"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+
+	// scalar records that the settings were written as a bool, so that they
+	// marshal back the same way (if nothing but Allowed has been set since).
+	scalar bool
+}
+
+// wrappedManualRetry is ManualRetry without its marshaling methods.
+type wrappedManualRetry ManualRetry
+
+// isScalar reports whether m should be marshaled as a bool.
+func (m *ManualRetry) isScalar() bool {
+	return m.scalar && m.Allowed != nil && m.PermitOnPassed == nil && m.Reason == "" && len(m.RemainingFields) == 0
+}
+
+// MarshalJSON marshals the settings as a bool or a mapping, according to how
+// they were written.
+func (m *ManualRetry) MarshalJSON() ([]byte, error) {
+	if m.isScalar() {
+		return json.Marshal(*m.Allowed)
+	}
+	return inlineFriendlyMarshalJSON((*wrappedManualRetry)(m))
+}
+
+// MarshalYAML returns the settings as a bool or a mapping, according to how
+// they were written.
+func (m *ManualRetry) MarshalYAML() (any, error) {
+	if m.isScalar() {
+		return *m.Allowed, nil
+	}
+	return (*wrappedManualRetry)(m), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - bool: whether manual retries are allowed
+// - ordered.Map: the full settings
+func (m *ManualRetry) UnmarshalOrdered(o any) error {
+	return m.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (m *ManualRetry) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case bool:
+		*m = ManualRetry{Allowed: &v, scalar: true}
+
+	case *ordered.MapSA:
+		if err := ordered.Unmarshal(v, (*wrappedManualRetry)(m), opts...); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("%w: manual has type %T", errUnsupportedRetryType, v)
+	}
+	return nil
+}
+
+// validate checks the parts of the retry settings that unmarshaling doesn't:
+// that there are no unknown keys, and that limits are in range.
+func (r *Retry) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.raw != nil {
+		return fmt.Errorf("%w: %T isn't understood", errUnsupportedRetryType, r.raw)
+	}
+	if keys := unknownKeys(r.RemainingFields, knownRetryFields); len(keys) > 0 {
+		return fmt.Errorf("unknown key %q, want automatic or manual", keys[0])
+	}
+	if r.Automatic == nil {
+		return nil
+	}
+	for i, rule := range r.Automatic.Rules {
+		if rule == nil || rule.Limit == nil {
+			continue
+		}
+		if l := *rule.Limit; l < 0 || l > maxRetryLimit {
+			if r.Automatic.single {
+				return fmt.Errorf("automatic: limit %d is out of range [0, %d]", l, maxRetryLimit)
+			}
+			return fmt.Errorf("automatic: rule %d: limit %d is out of range [0, %d]", i, l, maxRetryLimit)
+		}
+	}
+	return nil
+}
+
+// interpolate interpolates the strings within the retry settings.
+func (r *Retry) interpolate(tf stringTransformer) error {
+	if r == nil {
+		return nil
+	}
+	if r.raw != nil {
+		raw, err := interpolateAny(tf, r.raw)
+		if err != nil {
+			return err
+		}
+		r.raw = raw
+		return nil
+	}
+	if r.Automatic != nil {
+		for _, rule := range r.Automatic.Rules {
+			if rule == nil {
+				continue
+			}
+			if err := interpolateString(tf, &rule.Signal); err != nil {
+				return err
+			}
+			if err := interpolateString(tf, &rule.SignalReason); err != nil {
+				return err
+			}
+			if err := interpolateMap(tf, rule.RemainingFields); err != nil {
+				return err
+			}
+		}
+	}
+	if r.Manual != nil {
+		if err := interpolateString(tf, &r.Manual.Reason); err != nil {
+			return err
+		}
+		if err := interpolateMap(tf, r.Manual.RemainingFields); err != nil {
+			return err
+		}
+	}
+	return interpolateMap(tf, r.RemainingFields)
+}
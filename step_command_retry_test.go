@@ -0,0 +1,278 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetryUnmarshalOrdered(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		input string
+		want  *Retry
+	}{
+		{
+			name:  "automatic bool",
+			input: "automatic: true",
+			want:  &Retry{Automatic: &AutomaticRetry{}},
+		},
+		{
+			name:  "automatic disabled, manual bool",
+			input: "automatic: false\nmanual: false",
+			want: &Retry{
+				Automatic: &AutomaticRetry{Disabled: true},
+				Manual:    &ManualRetry{Allowed: ptr(false), scalar: true},
+			},
+		},
+		{
+			name:  "single rule",
+			input: "automatic:\n  exit_status: -1\n  limit: 2",
+			want: &Retry{
+				Automatic: &AutomaticRetry{
+					Rules: []*AutomaticRetryRule{{
+						ExitStatus: &ExitStatus{Statuses: []int{-1}},
+						Limit:      ptr(2),
+					}},
+					single: true,
+				},
+			},
+		},
+		{
+			name: "list of rules",
+			input: `automatic:
+  - exit_status: "*"
+    signal_reason: agent_stop
+  - exit_status: [1, 2]
+    signal: SIGKILL
+    colour: blue
+`,
+			want: &Retry{
+				Automatic: &AutomaticRetry{
+					Rules: []*AutomaticRetryRule{
+						{
+							ExitStatus:   &ExitStatus{Any: true},
+							SignalReason: "agent_stop",
+						},
+						{
+							ExitStatus:      &ExitStatus{Statuses: []int{1, 2}, list: true},
+							Signal:          "SIGKILL",
+							RemainingFields: map[string]any{"colour": "blue"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "manual mapping",
+			input: "manual:\n  allowed: false\n  permit_on_passed: true\n  reason: Deploys are final",
+			want: &Retry{
+				Manual: &ManualRetry{
+					Allowed:        ptr(false),
+					PermitOnPassed: ptr(true),
+					Reason:         "Deploys are final",
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			got := new(Retry)
+			if err := ordered.Unmarshal(&n, got); err != nil {
+				t.Fatalf("ordered.Unmarshal(input, got) error = %v", err)
+			}
+			if diff := cmp.Diff(got, tc.want, allowUnexported); diff != "" {
+				t.Errorf("Retry diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryUnmarshalOrdered_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []string{
+		"true",
+		"automatic: sometimes",
+		"automatic:\n  exit_status: one",
+		"automatic:\n  - exit_status: [1, two]",
+		"automatic: [true]",
+		"manual: [1]",
+	}
+
+	for _, input := range cases {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			err := ordered.Unmarshal(&n, new(Retry))
+			if !warning.Is(err) || !errors.Is(err, errUnsupportedRetryType) {
+				t.Errorf("ordered.Unmarshal(input, new(Retry)) error = %v, want a warning wrapping %v", err, errUnsupportedRetryType)
+			}
+		})
+	}
+}
+
+func TestParserKeepsUnsupportedRetry(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: make
+    retry:
+      automatic: 3
+`))
+	if !warning.Is(err) || !errors.Is(err, errUnsupportedRetryType) {
+		t.Fatalf("Parse(input) error = %v, want a warning wrapping %v", err, errUnsupportedRetryType)
+	}
+	if _, ok := p.Steps[0].(*CommandStep); !ok {
+		t.Fatalf("p.Steps[0] = %T, want *CommandStep", p.Steps[0])
+	}
+
+	gotJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	want := `{"steps":[{"command":"make","retry":{"automatic":3}}]}`
+	if diff := cmp.Diff(string(gotJSON), want); diff != "" {
+		t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+	if _, err := yaml.Marshal(p); err != nil {
+		t.Errorf("yaml.Marshal(p) error = %v", err)
+	}
+	if err := p.Validate(); !errors.Is(err, ErrInvalidRetry) {
+		t.Errorf("p.Validate() = %v, want %v", err, ErrInvalidRetry)
+	}
+}
+
+func TestRetryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	// Retry settings should marshal back into the same form they were written
+	// in, so that signatures made over the raw form still verify.
+	cases := []string{
+		`{"automatic":true}`,
+		`{"automatic":false,"manual":true}`,
+		`{"automatic":{"exit_status":-1,"limit":2}}`,
+		`{"automatic":[{"exit_status":"*","limit":0},{"exit_status":[1,2],"signal":"SIGKILL"}]}`,
+		`{"automatic":[{"exit_status":3}],"manual":{"allowed":false,"reason":"No"}}`,
+		`{"manual":{"allowed":true},"sometimes":true}`,
+	}
+
+	for _, input := range cases {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			step := new(CommandStep)
+			if err := step.UnmarshalJSON([]byte(`{"command":"make","retry":` + input + `}`)); err != nil {
+				t.Fatalf("CommandStep.UnmarshalJSON(input) error = %v", err)
+			}
+			if step.Retry == nil {
+				t.Fatalf("step.Retry = nil, want non-nil")
+			}
+			if _, has := step.RemainingFields["retry"]; has {
+				t.Errorf("step.RemainingFields[retry] present, want it absent")
+			}
+
+			gotJSON, err := json.Marshal(step.Retry)
+			if err != nil {
+				t.Fatalf("json.Marshal(step.Retry) error = %v", err)
+			}
+			if diff := cmp.Diff(string(gotJSON), input); diff != "" {
+				t.Errorf("json.Marshal(step.Retry) diff (-got +want):\n%s", diff)
+			}
+
+			gotYAML, err := yaml.Marshal(step.Retry)
+			if err != nil {
+				t.Fatalf("yaml.Marshal(step.Retry) error = %v", err)
+			}
+			var got, want any
+			if err := yaml.Unmarshal(gotYAML, &got); err != nil {
+				t.Fatalf("yaml.Unmarshal(gotYAML) error = %v", err)
+			}
+			if err := yaml.Unmarshal([]byte(input), &want); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("yaml.Marshal(step.Retry) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryProgrammaticEdits(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: make
+    retry:
+      automatic:
+        exit_status: -1
+        limit: 2
+      manual: false
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	step := p.Steps[0].(*CommandStep)
+
+	*step.Retry.Automatic.Rules[0].Limit = 5
+	step.Retry.Automatic.Rules = append(step.Retry.Automatic.Rules, &AutomaticRetryRule{
+		SignalReason: "agent_stop",
+		Limit:        ptr(3),
+	})
+	step.Retry.Manual.Reason = "Deploys are final"
+
+	got, err := json.Marshal(step.Retry)
+	if err != nil {
+		t.Fatalf("json.Marshal(step.Retry) error = %v", err)
+	}
+	want := `{"automatic":[{"exit_status":-1,"limit":5},{"limit":3,"signal_reason":"agent_stop"}],"manual":{"allowed":false,"reason":"Deploys are final"}}`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("json.Marshal(step.Retry) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRetryInterpolate(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: make
+    retry:
+      automatic:
+        signal_reason: ${REASON}
+      manual:
+        reason: ${MESSAGE}
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	if err := p.Interpolate(env.New(env.FromMap(map[string]string{"REASON": "agent_stop", "MESSAGE": "No"})), false); err != nil {
+		t.Fatalf("p.Interpolate(env, false) error = %v", err)
+	}
+	retry := p.Steps[0].(*CommandStep).Retry
+	if got, want := retry.Automatic.Rules[0].SignalReason, "agent_stop"; got != want {
+		t.Errorf("retry.Automatic.Rules[0].SignalReason = %q, want %q", got, want)
+	}
+	if got, want := retry.Manual.Reason, "No"; got != want {
+		t.Errorf("retry.Manual.Reason = %q, want %q", got, want)
+	}
+}
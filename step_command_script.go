@@ -0,0 +1,273 @@
+package pipeline
+
+import "strings"
+
+// SplitCommands splits a command script (such as CommandStep.Command, where
+// each item of `commands` is on its own line) into the individual shell
+// commands in it, so that tools can insert or wrap commands without breaking
+// multi-line constructs. Lines are kept together when they are joined by:
+//   - a backslash at the end of a line,
+//   - a pipe, && or || at the end of a line,
+//   - a quoted string spanning lines,
+//   - a heredoc (<<EOF, <<-EOF, <<'EOF', etc) and its body, or
+//   - a compound command spanning lines, such as if ... fi, for ... done,
+//     case ... esac, { ... }, or ( ... ).
+//
+// Blank lines and comments are kept (as commands of their own), so
+// JoinCommands(SplitCommands(script)) == script. The script is not otherwise
+// checked, so commands are split on a best effort basis if it is not valid
+// shell.
+func SplitCommands(script string) []string {
+	if script == "" {
+		return nil
+	}
+	var (
+		cmds []string
+		cur  []string
+		sc   shellScanner
+	)
+	for _, line := range strings.Split(script, "\n") {
+		cur = append(cur, line)
+		if sc.scanLine(line) {
+			cmds = append(cmds, strings.Join(cur, "\n"))
+			cur = cur[:0]
+		}
+	}
+	if len(cur) > 0 {
+		cmds = append(cmds, strings.Join(cur, "\n"))
+	}
+	return cmds
+}
+
+// JoinCommands joins commands into a command script, one per line. It is the
+// inverse of SplitCommands.
+func JoinCommands(cmds []string) string {
+	return strings.Join(cmds, "\n")
+}
+
+// Commands returns the shell commands in the step's command (see
+// SplitCommands).
+func (c *CommandStep) Commands() []string {
+	return SplitCommands(c.Command)
+}
+
+// SetCommands sets the step's command to the commands (see JoinCommands).
+func (c *CommandStep) SetCommands(cmds []string) {
+	c.Command = JoinCommands(cmds)
+}
+
+// shellScanner tracks enough shell syntax across lines to tell where commands
+// end.
+type shellScanner struct {
+	quote     byte      // the open quote (' or "), or 0
+	heredocs  []heredoc // heredocs whose bodies are yet to end
+	depth     int       // nesting of compound commands
+	caseDepth int       // nesting of case ... esac
+	continued bool      // the line ended with \, |, && or ||
+}
+
+// heredoc is a heredoc awaiting its delimiter line.
+type heredoc struct {
+	delim     string
+	stripTabs bool // <<- strips leading tabs, including from the delimiter
+}
+
+// reservedWords maps the reserved words (and braces) that open or close
+// compound commands to the change in nesting.
+var reservedWords = map[string]int{
+	"if": 1, "fi": -1,
+	"do": 1, "done": -1,
+	"case": 1, "esac": -1,
+	"{": 1, "}": -1,
+}
+
+// scanLine scans the next line of the script, and reports whether the command
+// (so far) ends with it.
+func (s *shellScanner) scanLine(line string) bool {
+	if len(s.heredocs) > 0 {
+		h := s.heredocs[0]
+		l := line
+		if h.stripTabs {
+			l = strings.TrimLeft(l, "\t")
+		}
+		if l == h.delim {
+			s.heredocs = s.heredocs[1:]
+		}
+		return s.complete()
+	}
+
+	s.continued = false
+	var (
+		word       strings.Builder
+		wordQuoted bool
+		cmdPos     = s.quote == 0 // at the start of a command
+		last       byte           // the last operator outside quotes ('A' for &&)
+	)
+	endWord := func() {
+		w := word.String()
+		word.Reset()
+		if w == "" {
+			return
+		}
+		if cmdPos && !wordQuoted {
+			if d, ok := reservedWords[w]; ok {
+				s.depth += d
+				if w == "case" {
+					s.caseDepth++
+				} else if w == "esac" {
+					s.caseDepth--
+				}
+			}
+		}
+		wordQuoted = false
+		switch w {
+		case "if", "then", "else", "elif", "do", "while", "until", "!", "{", "}":
+			// Still at the start of a command.
+		default:
+			cmdPos = false
+		}
+		last = 0
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch s.quote {
+		case '\'':
+			if c == '\'' {
+				s.quote = 0
+			}
+			continue
+
+		case '"':
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				s.quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\\':
+			if i == len(line)-1 {
+				s.continued = true
+				break
+			}
+			word.WriteByte(line[i+1])
+			i++
+
+		case '\'', '"':
+			s.quote = c
+			wordQuoted = true
+			word.WriteByte('_')
+
+		case ' ', '\t':
+			endWord()
+
+		case '#':
+			if word.Len() > 0 {
+				word.WriteByte(c)
+				break
+			}
+			// A comment: ignore the rest of the line.
+			i = len(line)
+
+		case ';', '&', '|':
+			endWord()
+			cmdPos = true
+			last = c
+			if c == '&' && i > 0 && line[i-1] == '&' {
+				last = 'A' // &&
+			}
+
+		case '(', ')':
+			endWord()
+			if s.caseDepth == 0 {
+				if c == '(' {
+					s.depth++
+				} else {
+					s.depth--
+				}
+			}
+			cmdPos = true
+			last = 0
+
+		case '<':
+			endWord()
+			if strings.HasPrefix(line[i:], "<<<") {
+				// A here-string, not a heredoc.
+				i += 2
+				break
+			}
+			if !strings.HasPrefix(line[i:], "<<") {
+				break
+			}
+			h, n := parseHeredoc(line[i+2:])
+			if h.delim != "" {
+				s.heredocs = append(s.heredocs, h)
+			}
+			i += 1 + n
+
+		default:
+			word.WriteByte(c)
+		}
+	}
+	if s.quote == 0 {
+		endWord()
+		if last == '|' || last == 'A' {
+			s.continued = true
+		}
+	}
+	return s.complete()
+}
+
+// complete reports whether the command is complete.
+func (s *shellScanner) complete() bool {
+	if s.quote != 0 || len(s.heredocs) > 0 || s.continued || s.depth > 0 {
+		return false
+	}
+	// Recover from unbalanced closing words.
+	s.depth, s.caseDepth = 0, 0
+	return true
+}
+
+// parseHeredoc parses the rest of a heredoc operator (after "<<"), and returns
+// it and the number of bytes of rest it used.
+func parseHeredoc(rest string) (heredoc, int) {
+	var h heredoc
+	i := 0
+	if strings.HasPrefix(rest, "-") {
+		h.stripTabs = true
+		i++
+	}
+	for i < len(rest) && (rest[i] == ' ' || rest[i] == '\t') {
+		i++
+	}
+	var delim strings.Builder
+	for ; i < len(rest); i++ {
+		c := rest[i]
+		switch c {
+		case '\'', '"':
+			end := strings.IndexByte(rest[i+1:], c)
+			if end < 0 {
+				delim.WriteString(rest[i+1:])
+				h.delim = delim.String()
+				return h, len(rest)
+			}
+			delim.WriteString(rest[i+1 : i+1+end])
+			i += end + 1
+			continue
+
+		case '\\':
+			continue
+
+		case ' ', '\t', ';', '&', '|', '<', '>', '(', ')':
+			h.delim = delim.String()
+			return h, i
+		}
+		delim.WriteByte(c)
+	}
+	h.delim = delim.String()
+	return h, i
+}
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitCommands(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc   string
+		script string
+		want   []string
+	}{
+		{
+			desc:   "one per line",
+			script: "make deps\nmake test",
+			want:   []string{"make deps", "make test"},
+		},
+		{
+			desc:   "empty",
+			script: "",
+			want:   nil,
+		},
+		{
+			desc:   "blank lines and comments",
+			script: "# setup\nmake deps\n\nmake test # with a comment \\",
+			want:   []string{"# setup", "make deps", "", "make test # with a comment \\"},
+		},
+		{
+			desc:   "backslash continuation",
+			script: "docker run \\\n  --rm \\\n  golang\necho done",
+			want:   []string{"docker run \\\n  --rm \\\n  golang", "echo done"},
+		},
+		{
+			desc:   "escaped backslash at end of line",
+			script: "echo \\\\\necho done",
+			want:   []string{"echo \\\\", "echo done"},
+		},
+		{
+			desc:   "trailing operators",
+			script: "make deps &&\n  make test ||\n  exit 1\ngo list ./... |\n  xargs go vet\nsleep 1 &\necho done",
+			want:   []string{"make deps &&\n  make test ||\n  exit 1", "go list ./... |\n  xargs go vet", "sleep 1 &", "echo done"},
+		},
+		{
+			desc:   "multi-line quotes",
+			script: "echo 'one\ntwo'\necho \"three\n\\\"four\\\"\"\necho five",
+			want:   []string{"echo 'one\ntwo'", "echo \"three\n\\\"four\\\"\"", "echo five"},
+		},
+		{
+			desc:   "heredocs",
+			script: "cat <<EOF > out.txt\nif this\nthen that\nEOF\ncat <<-'END' | wc -l\n\techo $HOME\n\tEND\ncat <<< \"here string\"\necho done",
+			want: []string{
+				"cat <<EOF > out.txt\nif this\nthen that\nEOF",
+				"cat <<-'END' | wc -l\n\techo $HOME\n\tEND",
+				"cat <<< \"here string\"",
+				"echo done",
+			},
+		},
+		{
+			desc:   "two heredocs on one line",
+			script: "paste <(cat <<A\n1\nA\n) <(cat <<\"B\"\n2\nB\n)\necho done",
+			want:   []string{"paste <(cat <<A\n1\nA\n) <(cat <<\"B\"\n2\nB\n)", "echo done"},
+		},
+		{
+			desc:   "if and loops",
+			script: "if [ -f go.mod ]; then\n  for p in a b; do\n    echo $p\n  done\nelse\n  while true; do sleep 1; done\nfi\necho done",
+			want: []string{
+				"if [ -f go.mod ]; then\n  for p in a b; do\n    echo $p\n  done\nelse\n  while true; do sleep 1; done\nfi",
+				"echo done",
+			},
+		},
+		{
+			desc:   "one-line if",
+			script: "if true; then echo yes; fi\necho done",
+			want:   []string{"if true; then echo yes; fi", "echo done"},
+		},
+		{
+			desc:   "case",
+			script: "case \"$OS\" in\n  linux) echo penguin ;;\n  (darwin) echo apple ;;\nesac\necho done",
+			want:   []string{"case \"$OS\" in\n  linux) echo penguin ;;\n  (darwin) echo apple ;;\nesac", "echo done"},
+		},
+		{
+			desc:   "braces, subshells, and functions",
+			script: "greet() {\n  echo hi\n}\n(\n  cd sub && make\n)\n{ echo a; echo b; } > out\necho ${#PATH} $(\n  date\n)",
+			want: []string{
+				"greet() {\n  echo hi\n}",
+				"(\n  cd sub && make\n)",
+				"{ echo a; echo b; } > out",
+				"echo ${#PATH} $(\n  date\n)",
+			},
+		},
+		{
+			desc:   "reserved words as arguments",
+			script: "echo if\necho \"done\"\necho fi",
+			want:   []string{"echo if", "echo \"done\"", "echo fi"},
+		},
+		{
+			desc:   "unterminated",
+			script: "echo 'oops\necho more",
+			want:   []string{"echo 'oops\necho more"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got := SplitCommands(test.script)
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("SplitCommands(%q) diff (-got +want):\n%s", test.script, diff)
+			}
+			if got := JoinCommands(got); got != test.script {
+				t.Errorf("JoinCommands(SplitCommands(%q)) = %q, want the original", test.script, got)
+			}
+		})
+	}
+}
+
+func TestCommandStepCommands(t *testing.T) {
+	t.Parallel()
+
+	c := &CommandStep{Command: "make deps &&\n  make build\nmake test"}
+	var wrapped []string
+	for _, cmd := range c.Commands() {
+		wrapped = append(wrapped, "trace -- "+strings.ReplaceAll(cmd, "\n", " "))
+	}
+	c.SetCommands(append([]string{"source prelude.sh"}, wrapped...))
+
+	want := "source prelude.sh\ntrace -- make deps &&   make build\ntrace -- make test"
+	if c.Command != want {
+		t.Errorf("c.Command = %q, want %q", c.Command, want)
+	}
+}
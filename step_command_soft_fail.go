@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+		selfInterpolater
+	} = (*SoftFail)(nil)
+
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+	} = (*SoftFailRule)(nil)
+)
+
+var errUnsupportedSoftFailType = fmt.Errorf("unsupported type for soft_fail")
+
+// SoftFail models the soft_fail setting of a command step (or a matrix
+// adjustment), which determines which failures of the job don't fail the
+// build. It can be written in any of these forms:
+//
+//	soft_fail: true            # or false, or a string such as "true"
+//	soft_fail: [1, 42]         # a list of exit statuses
+//	soft_fail:
+//	  - exit_status: 1         # a list of rules
+//	  - exit_status: "*"
+//
+// and marshals in the form it was written in.
+type SoftFail struct {
+	// All is true when soft_fail is true: every failure is a soft failure.
+	All bool
+
+	// Rules are the exit statuses that are soft failures, when All is false.
+	// If there are none, failures are not soft failures. A nil Rules marshals
+	// as false, and an empty one as an empty list.
+	Rules []*SoftFailRule
+
+	// text is the string soft_fail was written as, if it was written as a
+	// string (typically an environment variable to be interpolated into
+	// "true" or "false"), so that it marshals back the same way.
+	text string
+}
+
+// NewSoftFail returns a soft_fail setting allowing the given exit statuses,
+// written as a list of rules.
+func NewSoftFail(statuses ...int) *SoftFail {
+	s := new(SoftFail)
+	for _, st := range statuses {
+		s.Rules = append(s.Rules, &SoftFailRule{ExitStatus: &ExitStatus{Statuses: []int{st}}})
+	}
+	return s
+}
+
+// Allows reports whether a job that exits with the exit status is soft failed.
+// Exit status 0 is a pass, so is never a soft failure.
+func (s *SoftFail) Allows(exitStatus int) bool {
+	if s == nil || exitStatus == 0 {
+		return false
+	}
+	if s.All {
+		return true
+	}
+	for _, r := range s.Rules {
+		if r != nil && r.ExitStatus.matches(exitStatus) {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalForm returns the value to marshal in place of s.
+func (s *SoftFail) marshalForm() any {
+	switch {
+	case s.text != "" && s.Rules == nil && s.All == (s.text == "true"):
+		return s.text
+	case s.All || s.Rules == nil:
+		return s.All
+	default:
+		return s.Rules
+	}
+}
+
+// MarshalJSON marshals the setting as a bool, or a list of exit statuses or
+// rules, according to how it was written.
+func (s *SoftFail) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.marshalForm())
+}
+
+// MarshalYAML returns the setting as a bool, or a list of exit statuses or
+// rules, according to how it was written.
+func (s *SoftFail) MarshalYAML() (any, error) {
+	return s.marshalForm(), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - bool: whether every failure is a soft failure
+// - string: "true" (as for bool true), or anything else (as for false)
+// - []any: a list of exit statuses, rules, or a mixture
+func (s *SoftFail) UnmarshalOrdered(o any) error {
+	return s.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (s *SoftFail) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case bool:
+		*s = SoftFail{All: v}
+
+	case string:
+		*s = SoftFail{All: v == "true", text: v}
+
+	case []any:
+		rules := make([]*SoftFailRule, 0, len(v))
+		err := ordered.Unmarshal(v, &rules, opts...)
+		if err != nil && !warning.Is(err) {
+			return err
+		}
+		*s = SoftFail{Rules: rules}
+		return err
+
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedSoftFailType, v)
+	}
+	return nil
+}
+
+func (s *SoftFail) interpolate(tf stringTransformer) error {
+	if s == nil || s.text == "" {
+		return nil
+	}
+	if err := interpolateString(tf, &s.text); err != nil {
+		return err
+	}
+	s.All = s.text == "true"
+	return nil
+}
+
+// clone returns a deep copy of s.
+func (s *SoftFail) clone() *SoftFail {
+	if s == nil {
+		return nil
+	}
+	cp := &SoftFail{All: s.All, text: s.text}
+	for _, r := range s.Rules {
+		if r == nil {
+			cp.Rules = append(cp.Rules, nil)
+			continue
+		}
+		rc := &SoftFailRule{bare: r.bare}
+		if r.ExitStatus != nil {
+			es := *r.ExitStatus
+			es.Statuses = slices.Clone(es.Statuses)
+			rc.ExitStatus = &es
+		}
+		rc.RemainingFields = maps.Clone(r.RemainingFields)
+		cp.Rules = append(cp.Rules, rc)
+	}
+	return cp
+}
+
+// SoftFailRule is one of the exit statuses in a soft_fail list. It can be
+// written as a bare exit status (such as 1 or "*") or a mapping.
+type SoftFailRule struct {
+	ExitStatus *ExitStatus `yaml:"exit_status,omitempty"`
+
+	RemainingFields map[string]any `yaml:",inline"`
+
+	// bare records that the rule was written as a bare exit status, so that
+	// it marshals back the same way (if nothing else has been set since).
+	bare bool
+}
+
+// wrappedSoftFailRule is SoftFailRule without its marshaling methods.
+type wrappedSoftFailRule SoftFailRule
+
+// isBare reports whether r should be marshaled as a bare exit status.
+func (r *SoftFailRule) isBare() bool {
+	return r.bare && r.ExitStatus != nil && len(r.RemainingFields) == 0 &&
+		(r.ExitStatus.Any || len(r.ExitStatus.Statuses) == 1 && !r.ExitStatus.list)
+}
+
+// MarshalJSON marshals the rule as a bare exit status or a mapping, according
+// to how it was written.
+func (r *SoftFailRule) MarshalJSON() ([]byte, error) {
+	if r.isBare() {
+		return json.Marshal(r.ExitStatus)
+	}
+	return inlineFriendlyMarshalJSON((*wrappedSoftFailRule)(r))
+}
+
+// MarshalYAML returns the rule as a bare exit status or a mapping, according
+// to how it was written.
+func (r *SoftFailRule) MarshalYAML() (any, error) {
+	if r.isBare() {
+		return r.ExitStatus, nil
+	}
+	return (*wrappedSoftFailRule)(r), nil
+}
+
+// UnmarshalOrdered unmarshals from the following types:
+// - int: a bare exit status
+// - string: "*", meaning any exit status
+// - ordered.Map: a rule
+func (r *SoftFailRule) UnmarshalOrdered(o any) error {
+	return r.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (r *SoftFailRule) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	switch v := o.(type) {
+	case int, string:
+		es := new(ExitStatus)
+		if err := es.UnmarshalOrdered(v); err != nil {
+			return fmt.Errorf("%w: %w", errUnsupportedSoftFailType, err)
+		}
+		*r = SoftFailRule{ExitStatus: es, bare: true}
+
+	case *ordered.MapSA:
+		if err := ordered.Unmarshal(v, (*wrappedSoftFailRule)(r), opts...); err != nil {
+			if warning.Is(err) {
+				return err
+			}
+			return fmt.Errorf("%w: %w", errUnsupportedSoftFailType, err)
+		}
+
+	default:
+		return fmt.Errorf("%w: list contains %T", errUnsupportedSoftFailType, v)
+	}
+	return nil
+}
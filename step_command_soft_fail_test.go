@@ -0,0 +1,227 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSoftFailAllows(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		input      string
+		allowed    []int
+		notAllowed []int
+	}{
+		{
+			input:      "true",
+			allowed:    []int{1, -1, 255},
+			notAllowed: []int{0},
+		},
+		{
+			input:      "false",
+			notAllowed: []int{0, 1, -1},
+		},
+		{
+			input:      `"true"`,
+			allowed:    []int{1, 42},
+			notAllowed: []int{0},
+		},
+		{
+			input:      `"${SOFT_FAIL}"`,
+			notAllowed: []int{0, 1},
+		},
+		{
+			input:      "[1, 42]",
+			allowed:    []int{1, 42},
+			notAllowed: []int{0, 2, -1},
+		},
+		{
+			input:      "- exit_status: 3\n- exit_status: [4, 5]",
+			allowed:    []int{3, 4, 5},
+			notAllowed: []int{0, 1, 6},
+		},
+		{
+			input:      `- exit_status: "*"`,
+			allowed:    []int{1, -1, 137},
+			notAllowed: []int{0},
+		},
+		{
+			input:      `[2, {exit_status: 3}, "*"]`,
+			allowed:    []int{2, 3, 99},
+			notAllowed: []int{0},
+		},
+		{
+			input:      "[]",
+			notAllowed: []int{0, 1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			sf := new(SoftFail)
+			if err := ordered.Unmarshal(&n, sf); err != nil {
+				t.Fatalf("ordered.Unmarshal(input, sf) error = %v", err)
+			}
+			for _, st := range tc.allowed {
+				if !sf.Allows(st) {
+					t.Errorf("sf.Allows(%d) = false, want true", st)
+				}
+			}
+			for _, st := range tc.notAllowed {
+				if sf.Allows(st) {
+					t.Errorf("sf.Allows(%d) = true, want false", st)
+				}
+			}
+		})
+	}
+}
+
+func TestSoftFailUnmarshalOrdered_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []string{
+		"1",
+		"exit_status: 1",
+		"[true]",
+		"[one]",
+		"- exit_status: one",
+		"- [1, 2]",
+	}
+
+	for _, input := range cases {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			var n yaml.Node
+			if err := yaml.Unmarshal([]byte(input), &n); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			err := ordered.Unmarshal(&n, new(SoftFail))
+			if !errors.Is(err, errUnsupportedSoftFailType) {
+				t.Errorf("ordered.Unmarshal(input, new(SoftFail)) error = %v, want %v", err, errUnsupportedSoftFailType)
+			}
+		})
+	}
+}
+
+func TestSoftFailRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	// soft_fail should marshal back into the same form it was written in, so
+	// that signatures made over the raw form still verify.
+	cases := []string{
+		`true`,
+		`false`,
+		`"true"`,
+		`"${SOFT_FAIL:-false}"`,
+		`[]`,
+		`[1,42]`,
+		`["*"]`,
+		`[{"exit_status":1},{"exit_status":"*"}]`,
+		`[{"exit_status":[1,2]},3]`,
+		`[{"exit_status":1,"sometimes":true}]`,
+	}
+
+	for _, input := range cases {
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			step := new(CommandStep)
+			if err := step.UnmarshalJSON([]byte(`{"command":"make","soft_fail":` + input + `}`)); err != nil {
+				t.Fatalf("CommandStep.UnmarshalJSON(input) error = %v", err)
+			}
+			if step.SoftFail == nil {
+				t.Fatalf("step.SoftFail = nil, want non-nil")
+			}
+			if _, has := step.RemainingFields["soft_fail"]; has {
+				t.Errorf("step.RemainingFields[soft_fail] present, want it absent")
+			}
+
+			gotJSON, err := json.Marshal(step.SoftFail)
+			if err != nil {
+				t.Fatalf("json.Marshal(step.SoftFail) error = %v", err)
+			}
+			if diff := cmp.Diff(string(gotJSON), input); diff != "" {
+				t.Errorf("json.Marshal(step.SoftFail) diff (-got +want):\n%s", diff)
+			}
+
+			gotYAML, err := yaml.Marshal(step.SoftFail)
+			if err != nil {
+				t.Fatalf("yaml.Marshal(step.SoftFail) error = %v", err)
+			}
+			var got, want any
+			if err := yaml.Unmarshal(gotYAML, &got); err != nil {
+				t.Fatalf("yaml.Unmarshal(gotYAML) error = %v", err)
+			}
+			if err := yaml.Unmarshal([]byte(input), &want); err != nil {
+				t.Fatalf("yaml.Unmarshal(input) error = %v", err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("yaml.Marshal(step.SoftFail) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSoftFailInterpolation(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - command: make
+    soft_fail: "${SOFT_FAIL}"
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	if err := p.Interpolate(env.New(env.FromMap(map[string]string{"SOFT_FAIL": "true"})), false); err != nil {
+		t.Fatalf("p.Interpolate(env, false) error = %v", err)
+	}
+
+	sf := p.Steps[0].(*CommandStep).SoftFail
+	if !sf.Allows(1) {
+		t.Errorf("sf.Allows(1) = false, want true")
+	}
+	got, err := json.Marshal(sf)
+	if err != nil {
+		t.Fatalf("json.Marshal(sf) error = %v", err)
+	}
+	if diff := cmp.Diff(string(got), `"true"`); diff != "" {
+		t.Errorf("json.Marshal(sf) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestSoftFailProgrammatic(t *testing.T) {
+	t.Parallel()
+
+	step := &CommandStep{Command: "make", SoftFail: NewSoftFail(1, 2)}
+	if !step.SoftFail.Allows(2) || step.SoftFail.Allows(3) {
+		t.Errorf("NewSoftFail(1, 2) allows the wrong exit statuses")
+	}
+	got, err := json.Marshal(step)
+	if err != nil {
+		t.Fatalf("json.Marshal(step) error = %v", err)
+	}
+	want := `{"command":"make","soft_fail":[{"exit_status":1},{"exit_status":2}]}`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("json.Marshal(step) diff (-got +want):\n%s", diff)
+	}
+
+	var nilSF *SoftFail
+	if nilSF.Allows(1) {
+		t.Errorf("(*SoftFail)(nil).Allows(1) = true, want false")
+	}
+}
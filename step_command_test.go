@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/buildkite/go-pipeline/ordered"
@@ -74,7 +75,7 @@ func TestCommandStepUnmarshalJSON(t *testing.T) {
 		t.Fatalf("CommandStep.UnmarshalJSON(input) = %v", err)
 	}
 
-	if diff := cmp.Diff(got, want, cmp.Comparer(ordered.EqualSA)); diff != "" {
+	if diff := cmp.Diff(got, want, cmp.Comparer(ordered.EqualSA), allowUnexported); diff != "" {
 		t.Errorf("CommandStep diff after UnmarshalJSON (-got +want):\n%s", diff)
 	}
 }
@@ -179,9 +180,85 @@ func TestStepCommandMatrixInterpolate(t *testing.T) {
 			if err := tc.step.interpolate(tf); err != nil {
 				t.Errorf("tc.step.interpolate(matrixInterpolator) error = %v", err)
 			}
-			if diff := cmp.Diff(tc.step, tc.want, cmp.Comparer(ordered.EqualSA)); diff != "" {
+			if diff := cmp.Diff(tc.step, tc.want, cmp.Comparer(ordered.EqualSA), allowUnexported); diff != "" {
 				t.Errorf("CommandStep diff after MatrixInterpolate (-got +want):\n%s", diff)
 			}
 		})
 	}
 }
+
+func TestCommandStepExpandMatrix(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - label: "Test {{matrix.os}}"
+    command: "make test GOOS={{matrix.os}}"
+    env:
+      ARCH: "{{matrix.arch}}"
+    agents:
+      queue: "{{matrix.os}}-builders"
+    plugins:
+      - docker#v5.0.0:
+          image: "golang:{{matrix.arch}}"
+    matrix:
+      setup:
+        os: [linux, windows]
+        arch: [amd64]
+      adjustments:
+        - with: { os: windows, arch: amd64 }
+          soft_fail: true
+        - with: { os: linux, arch: amd64 }
+          skip: "not today"
+        - with: { os: darwin, arch: amd64 }
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	step := p.Steps[0].(*CommandStep)
+	step.Signature = &Signature{Algorithm: "EdDSA", SignedFields: []string{"command", "matrix"}, Value: "sig"}
+
+	got, err := step.ExpandMatrix()
+	if err != nil {
+		t.Fatalf("step.ExpandMatrix() error = %v", err)
+	}
+
+	want := []*MatrixExpansion{
+		{
+			Permutation: MatrixPermutation{"os": "windows", "arch": "amd64"},
+			Step: &CommandStep{
+				Label:   "Test windows",
+				Command: "make test GOOS=windows",
+				Env:     map[string]string{"ARCH": "amd64"},
+				Plugins: Plugins{{
+					Source: "github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0",
+					Config: map[string]any{"image": "golang:amd64"},
+				}},
+				Agents:   NewAgents(map[string]string{"queue": "windows-builders"}),
+				SoftFail: &SoftFail{All: true},
+			},
+		},
+		{
+			Permutation: MatrixPermutation{"os": "darwin", "arch": "amd64"},
+			Step: &CommandStep{
+				Label:   "Test darwin",
+				Command: "make test GOOS=darwin",
+				Env:     map[string]string{"ARCH": "amd64"},
+				Plugins: Plugins{{
+					Source: "github.com/buildkite-plugins/docker-buildkite-plugin#v5.0.0",
+					Config: map[string]any{"image": "golang:amd64"},
+				}},
+				Agents: NewAgents(map[string]string{"queue": "darwin-builders"}),
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want, cmp.Comparer(ordered.EqualSA), allowUnexported); diff != "" {
+		t.Errorf("step.ExpandMatrix() diff (-got +want):\n%s", diff)
+	}
+
+	// The original step should be unchanged.
+	if step.Command != "make test GOOS={{matrix.os}}" || step.Matrix == nil || step.Signature == nil {
+		t.Errorf("step.ExpandMatrix() modified the original step: %+v", step)
+	}
+}
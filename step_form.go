@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNotScalar is returned (wrapped) by SetForm when a step can't be written
+// as a scalar, because it has contents that the scalar would lose.
+var ErrNotScalar = errors.New("step can't be written as a scalar")
+
+// StepForm is the way a wait, block, or input step is written: as a scalar
+// (such as "wait"), or as a mapping (such as "wait: ~" or "block: Deploy?").
+// See the comment in step_scalar.go.
+type StepForm string
+
+// Forms of step.
+const (
+	StepFormScalar StepForm = "scalar"
+	StepFormMap    StepForm = "map"
+)
+
+// Form returns the form the step is written in, which is the form it marshals
+// in. An empty step marshals as "wait", so is a scalar.
+func (s *WaitStep) Form() StepForm {
+	if s.Scalar != "" || s.isEmpty() {
+		return StepFormScalar
+	}
+	return StepFormMap
+}
+
+// SetForm rewrites the step in the form, keeping the name it was written with:
+// "waiter" becomes "waiter: ~", and "wait: ~" becomes "wait". A step can
+// only be written as a scalar if it has nothing but its "wait" (or "waiter")
+// item, with no value, or type; otherwise SetForm returns an error wrapping
+// ErrNotScalar, and the step is unchanged.
+func (s *WaitStep) SetForm(form StepForm) error {
+	switch form {
+	case StepFormScalar:
+		if s.Scalar != "" {
+			return nil
+		}
+		name, err := scalarName(s.RemainingFields, "wait", "waiter")
+		if err != nil {
+			return err
+		}
+		if s.Key != "" || s.If != "" || s.ContinueOnFailure || s.AllowDependencyFailure {
+			return fmt.Errorf("%w: it has fields other than %q", ErrNotScalar, name)
+		}
+		s.Scalar = name
+		s.RemainingFields = nil
+		return nil
+
+	case StepFormMap:
+		if s.Scalar == "" && !s.isEmpty() {
+			return nil
+		}
+		name := s.Scalar
+		if name == "" {
+			name = "wait"
+		}
+		s.Scalar = ""
+		s.RemainingFields = map[string]any{name: nil}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown step form %q", form)
+	}
+}
+
+// Form returns the form the step is written in.
+func (s *InputStep) Form() StepForm {
+	if s.Scalar != "" {
+		return StepFormScalar
+	}
+	return StepFormMap
+}
+
+// SetForm rewrites the step in the form, keeping its kind (see Kind): "block"
+// becomes "block: ~", and "input: ~" becomes "input". A step can only be
+// written as a scalar if it has nothing but its "block" (or "input", or
+// "manual") item, with no value, or type; otherwise SetForm returns an error
+// wrapping ErrNotScalar, and the step is unchanged. So "block: Deploy?" can't
+// be written as a scalar, as the label would be lost.
+func (s *InputStep) SetForm(form StepForm) error {
+	switch form {
+	case StepFormScalar:
+		if s.Scalar != "" {
+			return nil
+		}
+		kind := s.Kind()
+		if kind == "" {
+			return fmt.Errorf("%w: it has no kind", ErrNotScalar)
+		}
+		if _, err := scalarName(s.RemainingFields, string(kind)); err != nil {
+			return err
+		}
+		if s.Key != "" || s.Label != "" || s.If != "" || s.Prompt != "" ||
+			len(s.Fields) > 0 || s.BlockedState != "" || s.AllowDependencyFailure {
+			return fmt.Errorf("%w: it has fields other than %q", ErrNotScalar, kind)
+		}
+		s.Scalar = string(kind)
+		s.RemainingFields = nil
+		return nil
+
+	case StepFormMap:
+		if s.Scalar == "" {
+			return nil
+		}
+		kind := s.Scalar
+		s.Scalar = ""
+		s.RemainingFields = map[string]any{kind: nil}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown step form %q", form)
+	}
+}
+
+// scalarName checks that the remaining fields of a step being written as a
+// scalar contain nothing but a type, or one of the names with no value (or
+// an empty string), and returns the name to use. It defaults to the first
+// name.
+func scalarName(remaining map[string]any, names ...string) (string, error) {
+	name := names[0]
+	for k, v := range remaining {
+		switch {
+		case k == "type":
+			if t, ok := v.(string); ok && slices.Contains(names, t) {
+				continue
+			}
+			return "", fmt.Errorf("%w: it has type %v", ErrNotScalar, v)
+
+		case slices.Contains(names, k):
+			if v != nil && v != "" {
+				return "", fmt.Errorf("%w: %q has the value %v", ErrNotScalar, k, v)
+			}
+			name = k
+
+		default:
+			return "", fmt.Errorf("%w: it has the field %q", ErrNotScalar, k)
+		}
+	}
+	return name, nil
+}
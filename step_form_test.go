@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStepForm(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - wait
+  - waiter: ~
+  - wait: ~
+    continue_on_failure: true
+  - block
+  - block: Deploy?
+  - type: input
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := []StepForm{StepFormScalar, StepFormMap, StepFormMap, StepFormScalar, StepFormMap, StepFormMap}
+	for i, s := range p.Steps {
+		var got StepForm
+		switch s := s.(type) {
+		case *WaitStep:
+			got = s.Form()
+		case *InputStep:
+			got = s.Form()
+		}
+		if got != want[i] {
+			t.Errorf("p.Steps[%d].Form() = %q, want %q", i, got, want[i])
+		}
+	}
+	if got := new(WaitStep).Form(); got != StepFormScalar {
+		t.Errorf("new(WaitStep).Form() = %q, want %q", got, StepFormScalar)
+	}
+}
+
+func TestStepSetForm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc, input string
+		form        StepForm
+		want        string
+		wantErr     error
+	}{
+		{
+			desc:  "wait to map",
+			input: "wait",
+			form:  StepFormMap,
+			want:  `{"wait":null}`,
+		},
+		{
+			desc:  "waiter to map",
+			input: "waiter",
+			form:  StepFormMap,
+			want:  `{"waiter":null}`,
+		},
+		{
+			desc:  "wait to scalar",
+			input: "wait: ~",
+			form:  StepFormScalar,
+			want:  `"wait"`,
+		},
+		{
+			desc:  "waiter to scalar",
+			input: "{waiter: '', type: waiter}",
+			form:  StepFormScalar,
+			want:  `"waiter"`,
+		},
+		{
+			desc:    "wait with fields to scalar",
+			input:   "{wait: ~, continue_on_failure: true}",
+			form:    StepFormScalar,
+			want:    `{"continue_on_failure":true,"wait":null}`,
+			wantErr: ErrNotScalar,
+		},
+		{
+			desc:    "wait with depends_on to scalar",
+			input:   "{wait: ~, depends_on: a}",
+			form:    StepFormScalar,
+			want:    `{"depends_on":"a","wait":null}`,
+			wantErr: ErrNotScalar,
+		},
+		{
+			desc:  "wait already scalar",
+			input: "wait",
+			form:  StepFormScalar,
+			want:  `"wait"`,
+		},
+		{
+			desc:  "block to map",
+			input: "block",
+			form:  StepFormMap,
+			want:  `{"block":null}`,
+		},
+		{
+			desc:  "input to scalar",
+			input: "input: ~",
+			form:  StepFormScalar,
+			want:  `"input"`,
+		},
+		{
+			desc:  "typed manual to scalar",
+			input: "type: manual",
+			form:  StepFormScalar,
+			want:  `"manual"`,
+		},
+		{
+			desc:    "block with label to scalar",
+			input:   "block: Deploy?",
+			form:    StepFormScalar,
+			want:    `{"block":"Deploy?"}`,
+			wantErr: ErrNotScalar,
+		},
+		{
+			desc:    "block with prompt to scalar",
+			input:   "{block: ~, prompt: 'Sure?'}",
+			form:    StepFormScalar,
+			want:    `{"block":null,"prompt":"Sure?"}`,
+			wantErr: ErrNotScalar,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader("steps:\n  - " + test.input + "\n"))
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			s := p.Steps[0]
+			switch s := s.(type) {
+			case *WaitStep:
+				err = s.SetForm(test.form)
+			case *InputStep:
+				err = s.SetForm(test.form)
+			default:
+				t.Fatalf("p.Steps[0] = %T, want a wait or input step", s)
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("SetForm(%q) error = %v, want %v", test.form, err, test.wantErr)
+			}
+
+			got, err := json.Marshal(s)
+			if err != nil {
+				t.Fatalf("json.Marshal(step) error = %v", err)
+			}
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("json.Marshal(step) diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+// GeneratedByField is the name of the field used to record which generator
+// produced a step. The backend ignores it, and it is not covered by step
+// signatures, but it survives into the uploaded pipeline so that humans
+// reading it can trace steps back to the tool that produced them.
+const GeneratedByField = "x-generated-by"
+
+// SetGeneratedBy records generator (for example, "my-tool v1.2.3") as the
+// producer of the step. Steps that were written as a scalar (such as "wait")
+// are converted to the equivalent mapping form, so that the field can be
+// marshalled. It returns false if the step can't record it (UnknownStep).
+func SetGeneratedBy(s Step, generator string) bool {
+	var rem *map[string]any
+	switch s := s.(type) {
+	case *CommandStep:
+		rem = &s.RemainingFields
+
+	case *GroupStep:
+		rem = &s.RemainingFields
+
+	case *TriggerStep:
+		rem = &s.RemainingFields
+
+	case *WaitStep:
+		if s.Scalar != "" {
+			s.RemainingFields = setField(s.RemainingFields, s.Scalar, nil)
+			s.Scalar = ""
+		}
+		rem = &s.RemainingFields
+
+	case *InputStep:
+		if s.Scalar != "" {
+			s.RemainingFields = setField(s.RemainingFields, s.Scalar, nil)
+			s.Scalar = ""
+		}
+		rem = &s.RemainingFields
+
+	default:
+		return false
+	}
+	*rem = setField(*rem, GeneratedByField, generator)
+	return true
+}
+
+// SetGeneratedBy records generator as the producer of each step, including
+// steps within groups. Steps that can't record it are skipped.
+func (steps Steps) SetGeneratedBy(generator string) {
+	for _, s := range steps {
+		SetGeneratedBy(s, generator)
+		if g, ok := s.(*GroupStep); ok {
+			g.Steps.SetGeneratedBy(generator)
+		}
+	}
+}
+
+// StepGeneratedBy returns the generator recorded by SetGeneratedBy, or the
+// empty string if there is none.
+func StepGeneratedBy(s Step) string {
+	var rem map[string]any
+	switch s := s.(type) {
+	case *CommandStep:
+		rem = s.RemainingFields
+
+	case *GroupStep:
+		rem = s.RemainingFields
+
+	case *TriggerStep:
+		rem = s.RemainingFields
+
+	case *WaitStep:
+		rem = s.RemainingFields
+
+	case *InputStep:
+		rem = s.RemainingFields
+	}
+	gen, _ := rem[GeneratedByField].(string)
+	return gen
+}
+
+// setField sets m[k] = v, allocating m if needed.
+func setField(m map[string]any, k string, v any) map[string]any {
+	if m == nil {
+		m = make(map[string]any)
+	}
+	m[k] = v
+	return m
+}
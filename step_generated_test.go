@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStepsSetGeneratedBy(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - command: make
+  - wait
+  - group: Tests
+    steps:
+      - command: make test
+      - block
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	p.Steps.SetGeneratedBy("gen v1")
+
+	for i, s := range p.Steps {
+		if got, want := StepGeneratedBy(s), "gen v1"; got != want {
+			t.Errorf("StepGeneratedBy(p.Steps[%d]) = %q, want %q", i, got, want)
+		}
+	}
+	if got := p.UnknownFields(); len(got) != 0 {
+		t.Errorf("p.UnknownFields() = %q, want none", got)
+	}
+
+	got, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p) error = %v", err)
+	}
+	want := `steps:
+    - command: make
+      x-generated-by: gen v1
+    - wait: null
+      x-generated-by: gen v1
+    - group: Tests
+      steps:
+        - command: make test
+          x-generated-by: gen v1
+        - block: null
+          x-generated-by: gen v1
+      x-generated-by: gen v1
+`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("yaml.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+
+	if SetGeneratedBy(&UnknownStep{Contents: "llama"}, "gen v1") {
+		t.Errorf("SetGeneratedBy(&UnknownStep{...}, gen v1) = true, want false")
+	}
+}
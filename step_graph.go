@@ -0,0 +1,262 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDependencyCycle is returned by StepGraph.TopologicalOrder if the graph
+// contains a cycle.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// StepNode is a step within a StepGraph.
+type StepNode struct {
+	// Step is the step this node represents.
+	Step Step
+
+	// Key is the step's key (possibly empty).
+	Key string
+
+	// Parent is the node for the group step containing this step, if any.
+	Parent *StepNode
+
+	// Children are the nodes for the steps within this step, if it is a group.
+	Children []*StepNode
+
+	// DependsOn are the nodes this step explicitly depends on (through
+	// depends_on). Dependencies on keys that don't exist are not included -
+	// see StepGraph.Missing.
+	DependsOn []*StepNode
+
+	// Dependents are the nodes that explicitly depend on this step.
+	Dependents []*StepNode
+
+	// name is used by String.
+	name string
+}
+
+// String returns the key of the step, or a description of its position.
+func (n *StepNode) String() string { return n.name }
+
+// MissingDependency is a depends_on entry referring to a key that no step has.
+type MissingDependency struct {
+	Node *StepNode
+	Key  string
+}
+
+// StepGraph is the dependency graph of a sequence of steps.
+//
+// Only explicit dependencies (from key and depends_on) are considered. A group
+// step is treated as finishing after all of its steps, and each step within a
+// group also waits for the group's dependencies.
+type StepGraph struct {
+	// Nodes contains a node for every step (including steps within groups),
+	// in pipeline order.
+	Nodes []*StepNode
+
+	// Missing lists dependencies on keys that don't exist.
+	Missing []MissingDependency
+
+	byKey map[string]*StepNode
+}
+
+// DependencyGraph builds the dependency graph of the steps (including those
+// within group steps). It returns an error if a depends_on is malformed or if
+// two steps have the same key. Problems with the graph itself (missing
+// dependencies, cycles, unreachable steps) are reported through the methods
+// and fields of StepGraph.
+func DependencyGraph(steps Steps) (*StepGraph, error) {
+	g := &StepGraph{byKey: make(map[string]*StepNode)}
+	if err := g.addNodes(steps, nil, "steps"); err != nil {
+		return nil, err
+	}
+
+	for _, n := range g.Nodes {
+		deps, err := StepDependencies(n.Step)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", n, ErrInvalidDependency, err)
+		}
+		for _, d := range deps {
+			dn, ok := g.byKey[d.Key]
+			if !ok {
+				g.Missing = append(g.Missing, MissingDependency{Node: n, Key: d.Key})
+				continue
+			}
+			n.DependsOn = append(n.DependsOn, dn)
+			dn.Dependents = append(dn.Dependents, n)
+		}
+	}
+	return g, nil
+}
+
+func (g *StepGraph) addNodes(steps Steps, parent *StepNode, prefix string) error {
+	for i, s := range steps {
+		n := &StepNode{
+			Step:   s,
+			Key:    StepKey(s),
+			Parent: parent,
+			name:   fmt.Sprintf("%s[%d]", prefix, i),
+		}
+		if n.Key != "" {
+			if _, dupe := g.byKey[n.Key]; dupe {
+				return fmt.Errorf("%s: %w %q", n.name, ErrDuplicateKey, n.Key)
+			}
+			g.byKey[n.Key] = n
+			n.name = n.Key
+		}
+		g.Nodes = append(g.Nodes, n)
+		if parent != nil {
+			parent.Children = append(parent.Children, n)
+		}
+
+		if gs, ok := s.(*GroupStep); ok {
+			if err := g.addNodes(gs.Steps, n, n.name+".steps"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Node returns the node for the step with the given key.
+func (g *StepGraph) Node(key string) (*StepNode, bool) {
+	n, ok := g.byKey[key]
+	return n, ok
+}
+
+// waitsFor returns the nodes that must finish before n can finish: its
+// explicit dependencies, those of the groups containing it, and its children.
+func (n *StepNode) waitsFor() []*StepNode {
+	out := append([]*StepNode(nil), n.DependsOn...)
+	for p := n.Parent; p != nil; p = p.Parent {
+		out = append(out, p.DependsOn...)
+	}
+	return append(out, n.Children...)
+}
+
+// Cycles returns each dependency cycle found in the graph, as a sequence of
+// nodes where each node waits for the next, and the last waits for the first.
+func (g *StepGraph) Cycles() [][]*StepNode {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*StepNode]int, len(g.Nodes))
+	var stack []*StepNode
+	var cycles [][]*StepNode
+
+	var visit func(n *StepNode)
+	visit = func(n *StepNode) {
+		state[n] = visiting
+		stack = append(stack, n)
+		for _, d := range n.waitsFor() {
+			switch state[d] {
+			case unvisited:
+				visit(d)
+
+			case visiting:
+				// Found a back edge: the cycle is the stack from d onwards.
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == d {
+						cycles = append(cycles, append([]*StepNode(nil), stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = visited
+	}
+
+	for _, n := range g.Nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return cycles
+}
+
+// Unreachable returns the nodes for steps that can never run, because they
+// depend (directly or indirectly) on a missing step or are part of a cycle.
+// Nodes are returned in pipeline order.
+func (g *StepGraph) Unreachable() []*StepNode {
+	bad := make(map[*StepNode]bool)
+	for _, m := range g.Missing {
+		bad[m.Node] = true
+	}
+	for _, c := range g.Cycles() {
+		for _, n := range c {
+			bad[n] = true
+		}
+	}
+
+	// Propagate until nothing changes. A step is unreachable if anything it
+	// waits for (other than its own children) is unreachable, or if it is
+	// within an unreachable group.
+	for changed := true; changed; {
+		changed = false
+		for _, n := range g.Nodes {
+			if bad[n] {
+				continue
+			}
+			if n.Parent != nil && bad[n.Parent] {
+				bad[n], changed = true, true
+				continue
+			}
+			for _, d := range n.waitsFor() {
+				if bad[d] && d.Parent != n {
+					bad[n], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	var out []*StepNode
+	for _, n := range g.Nodes {
+		if bad[n] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// TopologicalOrder returns the nodes in an order such that each node comes
+// after everything it waits for. Among nodes with no ordering constraint
+// between them, pipeline order is preserved. It returns an error wrapping
+// ErrDependencyCycle if the graph contains a cycle.
+func (g *StepGraph) TopologicalOrder() ([]*StepNode, error) {
+	remaining := make(map[*StepNode]int, len(g.Nodes))
+	dependents := make(map[*StepNode][]*StepNode, len(g.Nodes))
+	for _, n := range g.Nodes {
+		w := n.waitsFor()
+		remaining[n] = len(w)
+		for _, d := range w {
+			dependents[d] = append(dependents[d], n)
+		}
+	}
+
+	out := make([]*StepNode, 0, len(g.Nodes))
+	done := make(map[*StepNode]bool, len(g.Nodes))
+	for len(out) < len(g.Nodes) {
+		progress := false
+		for _, n := range g.Nodes {
+			if done[n] || remaining[n] > 0 {
+				continue
+			}
+			done[n] = true
+			out = append(out, n)
+			for _, d := range dependents[n] {
+				remaining[d]--
+			}
+			progress = true
+			// Restart from the beginning to preserve pipeline order.
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("%w: %v", ErrDependencyCycle, g.Cycles()[0])
+		}
+	}
+	return out, nil
+}
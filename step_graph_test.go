@@ -0,0 +1,229 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func nodeNames(ns []*StepNode) []string {
+	var out []string
+	for _, n := range ns {
+		out = append(out, n.String())
+	}
+	return out
+}
+
+func TestDependencyGraph(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc            string
+		input           string
+		wantOrder       []string
+		wantMissing     []string
+		wantCycles      [][]string
+		wantUnreachable []string
+	}{
+		{
+			desc: "simple chain",
+			input: `---
+steps:
+  - key: test
+    command: make test
+    depends_on: build
+  - key: build
+    command: make
+  - command: echo unkeyed
+`,
+			wantOrder: []string{"build", "test", "steps[2]"},
+		},
+		{
+			desc: "groups",
+			input: `---
+steps:
+  - key: build
+    command: make
+  - group: Tests
+    key: tests
+    depends_on: build
+    steps:
+      - key: unit
+        command: make unit
+      - key: integration
+        command: make integration
+        depends_on: unit
+  - key: deploy
+    command: make deploy
+    depends_on:
+      - step: tests
+        allow_failure: false
+`,
+			wantOrder: []string{"build", "unit", "integration", "tests", "deploy"},
+		},
+		{
+			desc: "missing dependency",
+			input: `---
+steps:
+  - key: a
+    command: a
+    depends_on: nope
+  - key: b
+    command: b
+    depends_on: a
+  - key: c
+    command: c
+`,
+			wantOrder:       []string{"a", "b", "c"},
+			wantMissing:     []string{"a -> nope"},
+			wantUnreachable: []string{"a", "b"},
+		},
+		{
+			desc: "cycle",
+			input: `---
+steps:
+  - key: a
+    command: a
+    depends_on: b
+  - key: b
+    command: b
+    depends_on: a
+  - key: c
+    command: c
+    depends_on: b
+  - key: d
+    command: d
+`,
+			wantCycles:      [][]string{{"a", "b"}},
+			wantUnreachable: []string{"a", "b", "c"},
+		},
+		{
+			desc: "step depending on its own group",
+			input: `---
+steps:
+  - group: G
+    key: g
+    steps:
+      - key: inner
+        command: inner
+        depends_on: g
+`,
+			wantCycles:      [][]string{{"g", "inner"}},
+			wantUnreachable: []string{"g", "inner"},
+		},
+		{
+			desc: "group with missing dependency",
+			input: `---
+steps:
+  - group: G
+    key: g
+    depends_on: nope
+    steps:
+      - command: inner
+  - key: after
+    command: after
+`,
+			wantOrder:       []string{"g.steps[0]", "g", "after"},
+			wantMissing:     []string{"g -> nope"},
+			wantUnreachable: []string{"g", "g.steps[0]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+
+			g, err := DependencyGraph(p.Steps)
+			if err != nil {
+				t.Fatalf("DependencyGraph(p.Steps) error = %v", err)
+			}
+
+			var missing []string
+			for _, m := range g.Missing {
+				missing = append(missing, m.Node.String()+" -> "+m.Key)
+			}
+			if diff := cmp.Diff(missing, test.wantMissing); diff != "" {
+				t.Errorf("g.Missing diff (-got +want):\n%s", diff)
+			}
+
+			var cycles [][]string
+			for _, c := range g.Cycles() {
+				cycles = append(cycles, nodeNames(c))
+			}
+			if diff := cmp.Diff(cycles, test.wantCycles); diff != "" {
+				t.Errorf("g.Cycles() diff (-got +want):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(nodeNames(g.Unreachable()), test.wantUnreachable); diff != "" {
+				t.Errorf("g.Unreachable() diff (-got +want):\n%s", diff)
+			}
+
+			order, err := g.TopologicalOrder()
+			if test.wantCycles != nil {
+				if !errors.Is(err, ErrDependencyCycle) {
+					t.Errorf("g.TopologicalOrder() error = %v, want %v", err, ErrDependencyCycle)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("g.TopologicalOrder() error = %v", err)
+			}
+			if diff := cmp.Diff(nodeNames(order), test.wantOrder); diff != "" {
+				t.Errorf("g.TopologicalOrder() diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDependencyGraph_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc    string
+		input   string
+		wantErr error
+	}{
+		{
+			desc: "duplicate key",
+			input: `---
+steps:
+  - key: a
+    command: a
+  - key: a
+    command: b
+`,
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			desc: "malformed depends_on",
+			input: `---
+steps:
+  - key: a
+    command: a
+    depends_on: [[a]]
+`,
+			wantErr: ErrInvalidDependency,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+			if _, err := DependencyGraph(p.Steps); !errors.Is(err, test.wantErr) {
+				t.Errorf("DependencyGraph(p.Steps) error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
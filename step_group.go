@@ -1,9 +1,11 @@
 package pipeline
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
 )
 
 // GroupStep models a group step.
@@ -13,31 +15,125 @@ type GroupStep struct {
 	// Fields common to various step types
 	Key string `yaml:"key,omitempty" aliases:"id,identifier"`
 
+	AllowDependencyFailure bool `yaml:"allow_dependency_failure,omitempty"`
+
 	// Group must always exist in a group step (so that we know it is a group).
 	// If it has a value, it is treated as equivalent to the label or name.
 	Group *string `yaml:"group" aliases:"label,name"`
 
 	Steps Steps `yaml:"steps"`
 
+	Notify Notify `yaml:"notify,omitempty"`
+
+	// Signature is only set if groups were signed (see the signature package).
+	Signature *Signature `yaml:"signature,omitempty"`
+
 	// RemainingFields stores any other top-level mapping items so they at least
 	// survive an unmarshal-marshal round-trip.
 	RemainingFields map[string]any `yaml:",inline"`
+
+	// stepsForm is the form Steps was written in, and keepStepsForm is true if
+	// it should be marshaled in that form (see GroupStepsForm).
+	stepsForm     GroupStepsForm
+	keepStepsForm bool
 }
 
 // UnmarshalOrdered unmarshals a group step from an ordered map.
 func (g *GroupStep) UnmarshalOrdered(src any) error {
+	return g.UnmarshalOrderedWith(src)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (g *GroupStep) UnmarshalOrderedWith(src any, opts ...ordered.UnmarshalOption) error {
 	type wrappedGroup GroupStep
-	if err := ordered.Unmarshal(src, (*wrappedGroup)(g)); err != nil {
+	err := ordered.Unmarshal(src, (*wrappedGroup)(g), opts...)
+	w := warning.As(err)
+	if err != nil && w == nil {
 		return fmt.Errorf("unmarshalling GroupStep: %w", err)
 	}
 
 	// Ensure Steps is never nil. Server side expects a sequence.
+	g.recordStepsForm(src)
 	if g.Steps == nil {
 		g.Steps = Steps{}
 	}
+	if w != nil {
+		return w
+	}
 	return nil
 }
 
+// HasLabel reports whether the group has a non-empty label. Groups written
+// with `group: null` (or `group: ~`) have no label, and neither do groups
+// with an empty label.
+func (g *GroupStep) HasLabel() bool {
+	return g.Group != nil && *g.Group != ""
+}
+
+// Label returns the group's label, or "" if it doesn't have one.
+func (g *GroupStep) Label() string {
+	if g.Group == nil {
+		return ""
+	}
+	return *g.Group
+}
+
+// SetLabel sets the group's label. Setting an empty label is the same as
+// `group: ""`; to get `group: null` set Group to nil.
+func (g *GroupStep) SetLabel(label string) {
+	g.Group = &label
+}
+
+// GroupLabelMode chooses how CanonicaliseGroupLabels represents groups
+// without a label.
+type GroupLabelMode int
+
+const (
+	// GroupLabelNull represents groups without a label as `group: null`
+	// (`"group": null` in JSON). This is how groups written with a null label
+	// are parsed.
+	GroupLabelNull GroupLabelMode = iota
+
+	// GroupLabelEmpty represents groups without a label as `group: ""`, for
+	// consumers that expect the label to always be a string.
+	GroupLabelEmpty
+
+	// GroupLabelFromKey uses the group's key as its label, if it has a key.
+	// Groups without a key are represented as for GroupLabelEmpty.
+	GroupLabelFromKey
+)
+
+// CanonicaliseGroupLabels rewrites the labels of all group steps in the
+// pipeline that don't have one (see GroupStep.HasLabel) according to mode, so
+// that they are marshaled consistently. Groups with labels are unchanged.
+func (p *Pipeline) CanonicaliseGroupLabels(mode GroupLabelMode) {
+	p.Steps.walkGroupSteps(func(g *GroupStep) {
+		if g.HasLabel() {
+			return
+		}
+		switch mode {
+		case GroupLabelNull:
+			g.Group = nil
+
+		case GroupLabelEmpty:
+			g.SetLabel("")
+
+		case GroupLabelFromKey:
+			g.SetLabel(g.Key)
+		}
+	})
+}
+
+// walkGroupSteps calls f with each group step, recursing into group steps.
+func (s Steps) walkGroupSteps(f func(*GroupStep)) {
+	for _, step := range s {
+		if g, ok := step.(*GroupStep); ok {
+			f(g)
+			g.Steps.walkGroupSteps(f)
+		}
+	}
+}
+
 func (g *GroupStep) interpolate(tf stringTransformer) error {
 	if err := interpolateString(tf, &g.Key); err != nil {
 		return err
@@ -45,9 +141,13 @@ func (g *GroupStep) interpolate(tf stringTransformer) error {
 	if err := interpolateString(tf, g.Group); err != nil {
 		return err
 	}
+	if err := g.Notify.interpolate(tf); err != nil {
+		return err
+	}
 	if err := g.Steps.interpolate(tf); err != nil {
 		return err
 	}
+	// NB: Do not interpolate Signature.
 	return interpolateMap(tf, g.RemainingFields)
 }
 
@@ -56,5 +156,42 @@ func (GroupStep) stepTag() {}
 // MarshalJSON marshals the step to JSON. Special handling is needed because
 // yaml.v3 has "inline" but encoding/json has no concept of it.
 func (g *GroupStep) MarshalJSON() ([]byte, error) {
-	return inlineFriendlyMarshalJSON(g)
+	form := g.marshalStepsForm()
+	if form == GroupStepsList {
+		return inlineFriendlyMarshalJSON(g)
+	}
+	fields, err := inlineFriendlyFields(g)
+	if err != nil {
+		return nil, err
+	}
+	if form == GroupStepsOmitted {
+		delete(fields, "steps")
+	} else {
+		fields["steps"] = nil
+	}
+	return json.Marshal(fields)
+}
+
+// MarshalYAML returns the step to marshal to YAML, with its steps in the form
+// they should be marshaled in (see GroupStepsForm).
+func (g *GroupStep) MarshalYAML() (any, error) {
+	// Wrap g in a type without a MarshalYAML method, to avoid infinite
+	// recursion.
+	type wrappedGroup GroupStep
+	form := g.marshalStepsForm()
+	if form == GroupStepsList {
+		return (*wrappedGroup)(g), nil
+	}
+	v, err := toGeneric((*wrappedGroup)(g))
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(*ordered.MapSA); ok {
+		if form == GroupStepsOmitted {
+			m.Delete("steps")
+		} else {
+			m.Set("steps", nil)
+		}
+	}
+	return v, nil
 }
@@ -0,0 +1,242 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errGroupNoMatrix       = errors.New("group contains no command steps with a matrix")
+	errGroupMatrixMismatch = errors.New("command steps in the group don't share the same matrix")
+)
+
+// GroupMatrixExpansion is one of the groups produced by
+// GroupStep.ExpandMatrix.
+type GroupMatrixExpansion struct {
+	// Permutation is the choice of matrix values for this group.
+	Permutation MatrixPermutation
+
+	// Group is a copy of the original group, containing the steps expanded for
+	// this permutation.
+	Group *GroupStep
+}
+
+// ExpandMatrix fans a group out into one group for each permutation of the
+// matrix shared by the command steps within it, so that each permutation is
+// shown as its own group in the build. Every command step in the group must
+// have the same matrix; other steps (such as wait steps) are copied into each
+// group unchanged. The command steps are expanded as with
+// CommandStep.ExpandMatrix.
+//
+// To keep keys unique, the keys of the group and of the steps within it are
+// suffixed with the permutation's values (in order of dimension name), such
+// as "tests-linux-amd64", and depends_on references between steps within the
+// group are updated to match. The group's label, if it has one, is suffixed
+// in the same way, such as "Tests (linux, amd64)". The expanded groups have no
+// signature, since the signature of the original group doesn't verify for
+// them. The original group is not modified.
+func (g *GroupStep) ExpandMatrix() ([]*GroupMatrixExpansion, error) {
+	matrix, err := g.sharedMatrix()
+	if err != nil {
+		return nil, err
+	}
+	perms, err := matrix.Permutations()
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand each command step. They share the matrix, so the expansions of
+	// each step are in the same order as perms.
+	expanded := make(map[int][]*MatrixExpansion)
+	for i, s := range g.Steps {
+		c, ok := s.(*CommandStep)
+		if !ok {
+			continue
+		}
+		exps, err := c.ExpandMatrix()
+		if err != nil {
+			return nil, fmt.Errorf("expanding step %d: %w", i, err)
+		}
+		expanded[i] = exps
+	}
+
+	out := make([]*GroupMatrixExpansion, 0, len(perms))
+	for j, perm := range perms {
+		group, err := g.clone()
+		if err != nil {
+			return nil, err
+		}
+		group.Signature = nil
+		for i, exps := range expanded {
+			group.Steps[i] = exps[j].Step
+		}
+
+		keySuffix, labelSuffix := permutationSuffixes(perm)
+		if group.Key != "" {
+			group.Key += "-" + keySuffix
+		}
+		if group.HasLabel() {
+			group.SetLabel(group.Label() + " (" + labelSuffix + ")")
+		}
+
+		renamed := make(map[string]string)
+		for _, s := range group.Steps {
+			if key := StepKey(s); key != "" {
+				renamed[key] = key + "-" + keySuffix
+				setStepKey(s, renamed[key])
+			}
+		}
+		for _, s := range group.Steps {
+			renameDependencies(s, renamed)
+		}
+
+		out = append(out, &GroupMatrixExpansion{
+			Permutation: perm,
+			Group:       group,
+		})
+	}
+	return out, nil
+}
+
+// sharedMatrix returns the matrix of the command steps in the group, which
+// must all be the same.
+func (g *GroupStep) sharedMatrix() (*Matrix, error) {
+	var (
+		matrix *Matrix
+		first  []byte
+	)
+	for i, s := range g.Steps {
+		c, ok := s.(*CommandStep)
+		if !ok {
+			continue
+		}
+		if c.Matrix.IsEmpty() {
+			return nil, fmt.Errorf("%w: step %d has no matrix", errGroupMatrixMismatch, i)
+		}
+		b, err := json.Marshal(c.Matrix)
+		if err != nil {
+			return nil, err
+		}
+		if matrix == nil {
+			matrix, first = c.Matrix, b
+			continue
+		}
+		if !bytes.Equal(b, first) {
+			return nil, fmt.Errorf("%w: step %d has a different matrix", errGroupMatrixMismatch, i)
+		}
+	}
+	if matrix == nil {
+		return nil, errGroupNoMatrix
+	}
+	return matrix, nil
+}
+
+// clone returns a deep copy of the group, made by round-tripping it through
+// JSON.
+func (g *GroupStep) clone() (*GroupStep, error) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return nil, fmt.Errorf("copying group: %w", err)
+	}
+	var n yaml.Node
+	if err := yaml.Unmarshal(b, &n); err != nil {
+		return nil, fmt.Errorf("copying group: %w", err)
+	}
+	cp := new(GroupStep)
+	// Any warnings were already reported when the group was unmarshaled.
+	if err := ordered.Unmarshal(&n, cp); err != nil && !warning.Is(err) {
+		return nil, fmt.Errorf("copying group: %w", err)
+	}
+	cp.stepsForm, cp.keepStepsForm = g.stepsForm, g.keepStepsForm
+	return cp, nil
+}
+
+// permutationSuffixes returns the suffixes for keys and labels of the groups
+// and steps expanded for the permutation.
+func permutationSuffixes(perm MatrixPermutation) (key, label string) {
+	dims := make([]string, 0, len(perm))
+	for dim := range perm {
+		dims = append(dims, dim)
+	}
+	slices.Sort(dims)
+
+	vals := make([]string, 0, len(dims))
+	for _, dim := range dims {
+		vals = append(vals, perm[dim])
+	}
+	return strings.Join(vals, "-"), strings.Join(vals, ", ")
+}
+
+// setStepKey sets the key of a step, for the types of step that have one.
+func setStepKey(s Step, key string) {
+	switch s := s.(type) {
+	case *CommandStep:
+		s.Key = key
+
+	case *GroupStep:
+		s.Key = key
+
+	case *WaitStep:
+		s.Key = key
+
+	case *InputStep:
+		s.Key = key
+
+	case *TriggerStep:
+		s.Key = key
+	}
+}
+
+// renameDependencies replaces the keys in a step's depends_on according to
+// renamed. Malformed depends_on values are left alone.
+func renameDependencies(s Step, renamed map[string]string) {
+	var remaining map[string]any
+	switch s := s.(type) {
+	case *CommandStep:
+		remaining = s.RemainingFields
+
+	case *GroupStep:
+		remaining = s.RemainingFields
+
+	case *WaitStep:
+		remaining = s.RemainingFields
+
+	case *InputStep:
+		remaining = s.RemainingFields
+
+	case *TriggerStep:
+		remaining = s.RemainingFields
+	}
+
+	switch d := remaining["depends_on"].(type) {
+	case string:
+		if r, ok := renamed[d]; ok {
+			remaining["depends_on"] = r
+		}
+
+	case []any:
+		for i, e := range d {
+			switch e := e.(type) {
+			case string:
+				if r, ok := renamed[e]; ok {
+					d[i] = r
+				}
+
+			case *ordered.MapSA:
+				if k, ok := e.Get("step"); ok {
+					if r, ok := renamed[fmt.Sprint(k)]; ok {
+						e.Set("step", r)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestGroupStepExpandMatrix(t *testing.T) {
+	t.Parallel()
+
+	const input = `---
+steps:
+  - group: Tests
+    key: tests
+    signature:
+      algorithm: EdDSA
+      signed_fields: [group, key, step_signatures]
+      value: sig
+    steps:
+      - key: build
+        command: make build GOOS={{matrix.os}}
+        matrix: &matrix
+          setup:
+            os: [linux, darwin]
+            arch: [amd64]
+      - wait
+      - key: test
+        label: Test on {{matrix.os}}
+        command: make test
+        depends_on: build
+        matrix: *matrix
+      - command: make lint
+        depends_on:
+          - step: test
+            allow_failure: true
+          - elsewhere
+        matrix: *matrix
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	group := p.Steps[0].(*GroupStep)
+	before, err := yaml.Marshal(group)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(group) error = %v", err)
+	}
+
+	exps, err := group.ExpandMatrix()
+	if err != nil {
+		t.Fatalf("group.ExpandMatrix() error = %v", err)
+	}
+
+	var got []string
+	for _, exp := range exps {
+		b, err := yaml.Marshal(exp.Group)
+		if err != nil {
+			t.Fatalf("yaml.Marshal(exp.Group) error = %v", err)
+		}
+		got = append(got, string(b))
+	}
+
+	want := []string{
+		`key: tests-amd64-linux
+group: Tests (amd64, linux)
+steps:
+    - key: build-amd64-linux
+      command: make build GOOS=linux
+    - wait
+    - key: test-amd64-linux
+      label: Test on linux
+      command: make test
+      depends_on: build-amd64-linux
+    - command: make lint
+      depends_on:
+        - step: test-amd64-linux
+          allow_failure: true
+        - elsewhere
+`,
+		`key: tests-amd64-darwin
+group: Tests (amd64, darwin)
+steps:
+    - key: build-amd64-darwin
+      command: make build GOOS=darwin
+    - wait
+    - key: test-amd64-darwin
+      label: Test on darwin
+      command: make test
+      depends_on: build-amd64-darwin
+    - command: make lint
+      depends_on:
+        - step: test-amd64-darwin
+          allow_failure: true
+        - elsewhere
+`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("group.ExpandMatrix() diff (-got +want):\n%s", diff)
+	}
+
+	wantPerms := []MatrixPermutation{
+		{"os": "linux", "arch": "amd64"},
+		{"os": "darwin", "arch": "amd64"},
+	}
+	var gotPerms []MatrixPermutation
+	for _, exp := range exps {
+		gotPerms = append(gotPerms, exp.Permutation)
+	}
+	if diff := cmp.Diff(gotPerms, wantPerms); diff != "" {
+		t.Errorf("group.ExpandMatrix() permutations diff (-got +want):\n%s", diff)
+	}
+
+	after, err := yaml.Marshal(group)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(group) error = %v", err)
+	}
+	if diff := cmp.Diff(string(after), string(before)); diff != "" {
+		t.Errorf("group modified by ExpandMatrix (-after +before):\n%s", diff)
+	}
+}
+
+func TestGroupStepExpandMatrix_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc    string
+		input   string
+		wantErr error
+	}{
+		{
+			desc: "no matrix",
+			input: `---
+steps:
+  - group: Tests
+    steps:
+      - wait
+`,
+			wantErr: errGroupNoMatrix,
+		},
+		{
+			desc: "step without matrix",
+			input: `---
+steps:
+  - group: Tests
+    steps:
+      - command: one
+        matrix: [a, b]
+      - command: two
+`,
+			wantErr: errGroupMatrixMismatch,
+		},
+		{
+			desc: "different matrices",
+			input: `---
+steps:
+  - group: Tests
+    steps:
+      - command: one
+        matrix: [a, b]
+      - command: two
+        matrix: [a, c]
+`,
+			wantErr: errGroupMatrixMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse(input) error = %v", err)
+			}
+			_, err = p.Steps[0].(*GroupStep).ExpandMatrix()
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("group.ExpandMatrix() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import "github.com/buildkite/go-pipeline/ordered"
+
+// GroupStepsForm is the way the steps of a group step are written, which
+// matters when a group has no steps:
+//
+//	steps: [...]  # GroupStepsList, including an empty list
+//	steps: null   # GroupStepsNull
+//	              # GroupStepsOmitted: no steps item at all
+//
+// The Buildkite backend expects the steps of a group to be a list, and treats
+// the other forms differently (generally rejecting them), so by default groups
+// are marshaled with a list of steps however they were written. Tools that
+// need to reproduce what the author wrote (such as linters and formatters)
+// can use GroupStep.StepsForm to tell the forms apart, and
+// Pipeline.KeepGroupStepsForms to marshal them as written.
+type GroupStepsForm int
+
+// Forms of the steps of a group step.
+const (
+	GroupStepsList GroupStepsForm = iota
+	GroupStepsNull
+	GroupStepsOmitted
+)
+
+// String returns the form as it is written: "list", "null", or "omitted".
+func (f GroupStepsForm) String() string {
+	switch f {
+	case GroupStepsList:
+		return "list"
+	case GroupStepsNull:
+		return "null"
+	case GroupStepsOmitted:
+		return "omitted"
+	default:
+		return "unknown"
+	}
+}
+
+// StepsForm returns the form the group's steps were written in. Groups with
+// steps are always GroupStepsList.
+func (g *GroupStep) StepsForm() GroupStepsForm {
+	if len(g.Steps) > 0 {
+		return GroupStepsList
+	}
+	return g.stepsForm
+}
+
+// SetStepsForm sets the form of the group's steps, and has the group marshal
+// its steps in that form while it has none.
+func (g *GroupStep) SetStepsForm(form GroupStepsForm) {
+	g.stepsForm = form
+	g.keepStepsForm = true
+}
+
+// KeepGroupStepsForms has all the group steps in the pipeline marshal their
+// steps in the form they were written in (see GroupStepsForm), rather than
+// always as a list.
+func (p *Pipeline) KeepGroupStepsForms() {
+	p.Steps.walkGroupSteps(func(g *GroupStep) {
+		g.keepStepsForm = true
+	})
+}
+
+// marshalStepsForm returns the form to marshal the group's steps in.
+func (g *GroupStep) marshalStepsForm() GroupStepsForm {
+	if !g.keepStepsForm {
+		return GroupStepsList
+	}
+	return g.StepsForm()
+}
+
+// recordStepsForm records the form of the steps in src, the group step being
+// unmarshaled.
+func (g *GroupStep) recordStepsForm(src any) {
+	g.stepsForm = GroupStepsList
+	m, ok := src.(*ordered.MapSA)
+	if !ok {
+		return
+	}
+	switch v, has := m.Get("steps"); {
+	case !has:
+		g.stepsForm = GroupStepsOmitted
+	case v == nil:
+		g.stepsForm = GroupStepsNull
+	}
+}
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestGroupStepLabel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc         string
+		group        *string
+		wantHasLabel bool
+		wantLabel    string
+	}{
+		{desc: "null", group: nil},
+		{desc: "empty", group: ptr("")},
+		{desc: "label", group: ptr("Tests"), wantHasLabel: true, wantLabel: "Tests"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			g := &GroupStep{Group: test.group}
+			if got := g.HasLabel(); got != test.wantHasLabel {
+				t.Errorf("g.HasLabel() = %t, want %t", got, test.wantHasLabel)
+			}
+			if got := g.Label(); got != test.wantLabel {
+				t.Errorf("g.Label() = %q, want %q", got, test.wantLabel)
+			}
+		})
+	}
+}
+
+func TestCanonicaliseGroupLabels(t *testing.T) {
+	t.Parallel()
+
+	input := `steps:
+  - group: ~
+    key: unlabelled
+    steps: [{command: make}]
+  - group: ""
+    steps: [{command: make}]
+  - group: Labelled
+    key: labelled
+    steps: [{command: make}]
+`
+	tests := []struct {
+		mode GroupLabelMode
+		want []string
+	}{
+		{
+			mode: GroupLabelNull,
+			want: []string{`null`, `null`, `"Labelled"`},
+		},
+		{
+			mode: GroupLabelEmpty,
+			want: []string{`""`, `""`, `"Labelled"`},
+		},
+		{
+			mode: GroupLabelFromKey,
+			want: []string{`"unlabelled"`, `""`, `"Labelled"`},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Parse(input) error = %v", err)
+		}
+		p.CanonicaliseGroupLabels(test.mode)
+
+		var got []string
+		for _, s := range p.Steps {
+			b, err := json.Marshal(s)
+			if err != nil {
+				t.Fatalf("json.Marshal(%v) error = %v", s, err)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(b, &fields); err != nil {
+				t.Fatalf("json.Unmarshal(%s) error = %v", b, err)
+			}
+			got = append(got, string(fields["group"]))
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("after p.CanonicaliseGroupLabels(%d), group JSON diff (-got +want):\n%s", test.mode, diff)
+		}
+	}
+}
+
+func TestGroupStepStepsForm(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - group: list
+    steps: [wait]
+  - group: empty
+    steps: []
+  - group: nulled
+    steps: ~
+  - group: omitted
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := []GroupStepsForm{GroupStepsList, GroupStepsList, GroupStepsNull, GroupStepsOmitted}
+	for i, w := range want {
+		if got := p.Steps[i].(*GroupStep).StepsForm(); got != w {
+			t.Errorf("p.Steps[%d].StepsForm() = %v, want %v", i, got, w)
+		}
+	}
+
+	// By default, groups are marshaled with a list of steps.
+	got, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	wantJSON := `{"steps":[{"group":"list","steps":["wait"]},{"group":"empty","steps":[]},{"group":"nulled","steps":[]},{"group":"omitted","steps":[]}]}`
+	if diff := cmp.Diff(string(got), wantJSON); diff != "" {
+		t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+
+	p.KeepGroupStepsForms()
+	got, err = json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	wantJSON = `{"steps":[{"group":"list","steps":["wait"]},{"group":"empty","steps":[]},{"group":"nulled","steps":null},{"group":"omitted"}]}`
+	if diff := cmp.Diff(string(got), wantJSON); diff != "" {
+		t.Errorf("after KeepGroupStepsForms, json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+
+	gotYAML, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(p) error = %v", err)
+	}
+	wantYAML := `steps:
+    - group: list
+      steps:
+        - wait
+    - group: empty
+      steps: []
+    - group: nulled
+      steps: null
+    - group: omitted
+`
+	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
+		t.Errorf("after KeepGroupStepsForms, yaml.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+
+	// Groups with steps are always marshaled with a list.
+	g := p.Steps[3].(*GroupStep)
+	g.Steps = append(g.Steps, &WaitStep{})
+	if got := g.StepsForm(); got != GroupStepsList {
+		t.Errorf("g.StepsForm() after adding a step = %v, want %v", got, GroupStepsList)
+	}
+
+	added := &GroupStep{Group: ptr("new"), Steps: Steps{}}
+	added.SetStepsForm(GroupStepsNull)
+	got, err = json.Marshal(added)
+	if err != nil {
+		t.Fatalf("json.Marshal(added) error = %v", err)
+	}
+	if diff := cmp.Diff(string(got), `{"group":"new","steps":null}`); diff != "" {
+		t.Errorf("json.Marshal(added) diff (-got +want):\n%s", diff)
+	}
+}
@@ -3,42 +3,279 @@ package pipeline
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+)
+
+var (
+	_ ordered.Unmarshaler = (*InputFields)(nil)
+
+	_ = []interface {
+		InputField
+		json.Marshaler
+	}{
+		(*TextField)(nil),
+		(*SelectField)(nil),
+	}
 )
 
+// ErrUnknownInputFieldType is returned (wrapped) when an input step field is
+// neither a text nor a select field.
+var ErrUnknownInputFieldType = errors.New("unknown input field type")
+
 // See the comment in step_scalar.go.
 
-// InputStep models a block or input step.
+// InputStep models a block or input step. Which one the user wrote is kept
+// (see Kind).
 //
 // Standard caveats apply - see the package comment.
 type InputStep struct {
-	Scalar   string         `yaml:"-"`
-	Contents map[string]any `yaml:",inline"`
+	Scalar string `yaml:"-"`
+
+	// Fields common to various step types
+	Key   string `yaml:"key,omitempty" aliases:"id,identifier"`
+	Label string `yaml:"label,omitempty" aliases:"name"`
+	If    string `yaml:"if,omitempty"`
+
+	// Fields that are meaningful specifically for block and input steps
+	Prompt                 string      `yaml:"prompt,omitempty"`
+	Fields                 InputFields `yaml:"fields,omitempty"`
+	BlockedState           string      `yaml:"blocked_state,omitempty"`
+	AllowDependencyFailure bool        `yaml:"allow_dependency_failure,omitempty"`
+
+	// RemainingFields stores any other mapping items (including the "block" or
+	// "input" item itself) so they at least survive an unmarshal-marshal
+	// round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// InputField is a field of an input or block step. It is implemented by
+// *TextField and *SelectField.
+type InputField interface {
+	selfInterpolater
+
+	// FieldKey returns the key the field's value is stored under.
+	FieldKey() string
+
+	inputFieldTag()
+}
+
+// InputFields contains the fields of an input step. It is useful for
+// unmarshaling, since it has logic for determining the correct field type.
+type InputFields []InputField
+
+// TextField models a text field of an input step.
+type TextField struct {
+	Text     string `yaml:"text"`
+	Key      string `yaml:"key"`
+	Hint     string `yaml:"hint,omitempty"`
+	Required *bool  `yaml:"required,omitempty"`
+	Default  string `yaml:"default,omitempty"`
+	Format   string `yaml:"format,omitempty"`
+
+	// RemainingFields stores any other mapping items so they at least survive
+	// an unmarshal-marshal round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// SelectField models a select field of an input step.
+type SelectField struct {
+	Select   string `yaml:"select"`
+	Key      string `yaml:"key"`
+	Hint     string `yaml:"hint,omitempty"`
+	Required *bool  `yaml:"required,omitempty"`
+
+	// Default is a string, or a list of strings if Multiple is true.
+	Default  any             `yaml:"default,omitempty"`
+	Multiple bool            `yaml:"multiple,omitempty"`
+	Options  []*SelectOption `yaml:"options,omitempty"`
+
+	// RemainingFields stores any other mapping items so they at least survive
+	// an unmarshal-marshal round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// SelectOption models an option of a select field.
+type SelectOption struct {
+	Label string `yaml:"label"`
+	Value string `yaml:"value"`
+	Hint  string `yaml:"hint,omitempty"`
+
+	// RemainingFields stores any other mapping items so they at least survive
+	// an unmarshal-marshal round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
 }
 
-// MarshalJSON marshals s.Scalar if it's not empty, otherwise s.Contents if that
-// is not empty. If both s.Scalar and s.Contents are empty, it reports an error.
+// isEmpty reports whether the step has no contents (apart from Scalar).
+func (s *InputStep) isEmpty() bool {
+	return s.Key == "" && s.Label == "" && s.If == "" && s.Prompt == "" &&
+		len(s.Fields) == 0 && s.BlockedState == "" && !s.AllowDependencyFailure &&
+		len(s.RemainingFields) == 0
+}
+
+// MarshalJSON marshals s.Scalar if it's not empty, otherwise the fields of the
+// step if they are not all empty. If both s.Scalar and the fields are empty, it
+// reports an error.
 func (s *InputStep) MarshalJSON() ([]byte, error) {
-	o, err := s.MarshalYAML()
-	if err != nil {
-		return nil, err
+	if s.Scalar != "" || s.isEmpty() {
+		o, err := s.MarshalYAML()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(o)
 	}
-	return json.Marshal(o)
+	return inlineFriendlyMarshalJSON(s)
 }
 
-// MarshalYAML returns s.Scalar if it's not empty, otherwise s.Contents if that
-// is not empty. If both s.Scalar and s.Contents are empty, it reports an error.
+// MarshalYAML returns s.Scalar if it's not empty, otherwise the fields of the
+// step if they are not all empty. If both s.Scalar and the fields are empty, it
+// reports an error.
 func (s *InputStep) MarshalYAML() (any, error) {
 	if s.Scalar != "" {
 		return s.Scalar, nil
 	}
-	if len(s.Contents) == 0 {
+	if s.isEmpty() {
 		return nil, errors.New("empty input step")
 	}
-	return s.Contents, nil
+	// Wrap s in a type without a MarshalYAML method, to avoid infinite
+	// recursion.
+	type wrappedInput InputStep
+	return (*wrappedInput)(s), nil
 }
 
-func (s InputStep) interpolate(tf stringTransformer) error {
-	return interpolateMap(tf, s.Contents)
+func (s *InputStep) interpolate(tf stringTransformer) error {
+	for _, p := range []*string{&s.Key, &s.Label, &s.If, &s.Prompt, &s.BlockedState} {
+		if err := interpolateString(tf, p); err != nil {
+			return err
+		}
+	}
+	if err := interpolateSlice(tf, s.Fields); err != nil {
+		return fmt.Errorf("interpolating fields: %w", err)
+	}
+	if err := interpolateMap(tf, s.RemainingFields); err != nil {
+		return fmt.Errorf("interpolating remaining fields: %w", err)
+	}
+	return nil
 }
 
 func (*InputStep) stepTag() {}
+
+// UnmarshalOrdered unmarshals a slice ([]any) into a slice of fields.
+func (fs *InputFields) UnmarshalOrdered(o any) error {
+	return fs.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (fs *InputFields) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
+	if o == nil {
+		return nil
+	}
+	sl, ok := o.([]any)
+	if !ok {
+		return fmt.Errorf("unmarshaling fields: got %T, want a slice ([]any)", o)
+	}
+	*fs = make(InputFields, 0, len(sl))
+	var warns []error
+	for i, src := range sl {
+		m, ok := src.(*ordered.MapSA)
+		if !ok {
+			return fmt.Errorf("unmarshaling field %d: got %T, want a mapping", i, src)
+		}
+
+		var f InputField
+		switch {
+		case m.Contains("text"):
+			f = new(TextField)
+		case m.Contains("select"):
+			f = new(SelectField)
+		default:
+			return fmt.Errorf("unmarshaling field %d: %w, need one of text or select", i, ErrUnknownInputFieldType)
+		}
+		err := ordered.Unmarshal(m, f, opts...)
+		if w := warning.As(err); w != nil {
+			warns = append(warns, w.Wrapf("while unmarshaling field %d", i))
+		} else if err != nil {
+			return fmt.Errorf("unmarshaling field %d: %w", i, err)
+		}
+		*fs = append(*fs, f)
+	}
+	return warning.Wrap(warns...)
+}
+
+// FieldKey returns f.Key.
+func (f *TextField) FieldKey() string { return f.Key }
+
+// IsRequired reports whether a value must be given for the field. Fields are
+// required unless Required is false.
+func (f *TextField) IsRequired() bool { return f.Required == nil || *f.Required }
+
+// MarshalJSON marshals the field to JSON. Special handling is needed because
+// yaml.v3 has "inline" but encoding/json has no concept of it.
+func (f *TextField) MarshalJSON() ([]byte, error) {
+	return inlineFriendlyMarshalJSON(f)
+}
+
+func (f *TextField) interpolate(tf stringTransformer) error {
+	for _, p := range []*string{&f.Text, &f.Key, &f.Hint, &f.Default, &f.Format} {
+		if err := interpolateString(tf, p); err != nil {
+			return err
+		}
+	}
+	return interpolateMap(tf, f.RemainingFields)
+}
+
+func (*TextField) inputFieldTag() {}
+
+// FieldKey returns f.Key.
+func (f *SelectField) FieldKey() string { return f.Key }
+
+// IsRequired reports whether a value must be chosen for the field. Fields are
+// required unless Required is false.
+func (f *SelectField) IsRequired() bool { return f.Required == nil || *f.Required }
+
+// MarshalJSON marshals the field to JSON. Special handling is needed because
+// yaml.v3 has "inline" but encoding/json has no concept of it.
+func (f *SelectField) MarshalJSON() ([]byte, error) {
+	return inlineFriendlyMarshalJSON(f)
+}
+
+func (f *SelectField) interpolate(tf stringTransformer) error {
+	for _, p := range []*string{&f.Select, &f.Key, &f.Hint} {
+		if err := interpolateString(tf, p); err != nil {
+			return err
+		}
+	}
+	def, err := interpolateAny(tf, f.Default)
+	if err != nil {
+		return err
+	}
+	f.Default = def
+	for _, o := range f.Options {
+		if err := o.interpolate(tf); err != nil {
+			return err
+		}
+	}
+	return interpolateMap(tf, f.RemainingFields)
+}
+
+func (*SelectField) inputFieldTag() {}
+
+// MarshalJSON marshals the option to JSON. Special handling is needed because
+// yaml.v3 has "inline" but encoding/json has no concept of it.
+func (o *SelectOption) MarshalJSON() ([]byte, error) {
+	return inlineFriendlyMarshalJSON(o)
+}
+
+func (o *SelectOption) interpolate(tf stringTransformer) error {
+	if o == nil {
+		return nil
+	}
+	for _, p := range []*string{&o.Label, &o.Value, &o.Hint} {
+		if err := interpolateString(tf, p); err != nil {
+			return err
+		}
+	}
+	return interpolateMap(tf, o.RemainingFields)
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+// InputStepKind distinguishes the kinds of step modelled by InputStep.
+type InputStepKind string
+
+// Kinds of InputStep.
+const (
+	// InputStepBlock is a block step, which stops the build until it is
+	// unblocked. Steps after it depend on it, so they don't run until then.
+	InputStepBlock InputStepKind = "block"
+
+	// InputStepManual is the older name for a block step, and behaves the
+	// same way.
+	InputStepManual InputStepKind = "manual"
+
+	// InputStepInput is an input step, which collects information like a
+	// block step, but doesn't make the steps after it depend on it.
+	InputStepInput InputStepKind = "input"
+)
+
+// inputStepKinds are the kinds, in the order they are looked for.
+var inputStepKinds = []InputStepKind{InputStepBlock, InputStepInput, InputStepManual}
+
+// Kind returns the kind of step the user wrote: whether it was written as a
+// block, input, or manual step (either as a scalar such as "block", an item
+// such as "block: Deploy?", or with a type). It returns the empty string if
+// the step doesn't say, which can happen with steps that aren't unmarshaled.
+func (s *InputStep) Kind() InputStepKind {
+	if s.Scalar != "" {
+		return InputStepKind(s.Scalar)
+	}
+	if t, ok := s.RemainingFields["type"].(string); ok {
+		for _, k := range inputStepKinds {
+			if t == string(k) {
+				return k
+			}
+		}
+	}
+	for _, k := range inputStepKinds {
+		if _, has := s.RemainingFields[string(k)]; has {
+			return k
+		}
+	}
+	return ""
+}
+
+// SetKind changes the kind of the step, keeping the way it is written:
+// "block" becomes "input" for a scalar step, "block: Deploy?" becomes
+// "input: Deploy?", and so on. If the step doesn't have a kind, a "block",
+// "input", or "manual" item with no value is added.
+func (s *InputStep) SetKind(kind InputStepKind) {
+	if s.Scalar != "" {
+		s.Scalar = string(kind)
+		return
+	}
+	if s.RemainingFields == nil {
+		s.RemainingFields = make(map[string]any)
+	}
+	if _, ok := s.RemainingFields["type"].(string); ok {
+		s.RemainingFields["type"] = string(kind)
+		return
+	}
+	var value any
+	for _, k := range inputStepKinds {
+		if v, has := s.RemainingFields[string(k)]; has {
+			value = v
+			delete(s.RemainingFields, string(k))
+			break
+		}
+	}
+	s.RemainingFields[string(kind)] = value
+}
+
+// Blocks reports whether the steps after this one depend on it, which is the
+// case for block (and manual) steps, but not input steps. Steps without a kind
+// are treated as block steps.
+func (s *InputStep) Blocks() bool {
+	return s.Kind() != InputStepInput
+}
+
+// EffectiveBlockedState returns the state the build is shown as while the
+// step is blocked: BlockedState, or "passed" if it isn't set. Input steps
+// don't block the build, so for them it is always the empty string.
+func (s *InputStep) EffectiveBlockedState() string {
+	switch {
+	case !s.Blocks():
+		return ""
+	case s.BlockedState == "":
+		return "passed"
+	default:
+		return s.BlockedState
+	}
+}
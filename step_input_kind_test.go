@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/warning"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInputStepKind(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - block
+  - input
+  - manual
+  - block: Deploy?
+  - input: Details
+    fields: [{text: Reason, key: reason}]
+  - manual: Old style
+  - type: input
+    label: Typed
+  - label: Inferred
+    block: ~
+    blocked_state: failed
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := []struct {
+		kind         InputStepKind
+		blocks       bool
+		blockedState string
+	}{
+		{InputStepBlock, true, "passed"},
+		{InputStepInput, false, ""},
+		{InputStepManual, true, "passed"},
+		{InputStepBlock, true, "passed"},
+		{InputStepInput, false, ""},
+		{InputStepManual, true, "passed"},
+		{InputStepInput, false, ""},
+		{InputStepBlock, true, "failed"},
+	}
+	for i, w := range want {
+		s := p.Steps[i].(*InputStep)
+		if got := s.Kind(); got != w.kind {
+			t.Errorf("p.Steps[%d].Kind() = %q, want %q", i, got, w.kind)
+		}
+		if got := s.Blocks(); got != w.blocks {
+			t.Errorf("p.Steps[%d].Blocks() = %t, want %t", i, got, w.blocks)
+		}
+		if got := s.EffectiveBlockedState(); got != w.blockedState {
+			t.Errorf("p.Steps[%d].EffectiveBlockedState() = %q, want %q", i, got, w.blockedState)
+		}
+	}
+}
+
+func TestInputStepSetKind(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - block
+  - block: Deploy?
+    prompt: Are you sure?
+  - type: block
+    label: Typed
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	for _, s := range p.Steps {
+		s.(*InputStep).SetKind(InputStepInput)
+	}
+	added := &InputStep{Label: "New"}
+	added.SetKind(InputStepBlock)
+	p.Steps = append(p.Steps, added)
+
+	got, err := json.Marshal(p.Steps)
+	if err != nil {
+		t.Fatalf("json.Marshal(p.Steps) error = %v", err)
+	}
+	want := `["input",{"input":"Deploy?","prompt":"Are you sure?"},{"label":"Typed","type":"input"},{"block":null,"label":"New"}]`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("json.Marshal(p.Steps) diff (-got +want):\n%s", diff)
+	}
+	for i, s := range p.Steps[:3] {
+		if got := s.(*InputStep).Kind(); got != InputStepInput {
+			t.Errorf("p.Steps[%d].Kind() = %q, want %q", i, got, InputStepInput)
+		}
+	}
+}
+
+func TestPipelineValidateBlockedStateOnInputStep(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`steps:
+  - block: Deploy?
+    blocked_state: running
+  - input: Details
+    blocked_state: failed
+`))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	err = p.Validate()
+	if !warning.Is(err) {
+		t.Fatalf("p.Validate() = %v, want a warning", err)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("p.Validate() = %v, want it to wrap a ValidationError", err)
+	}
+	if got, want := verr.Path, "steps[1]"; got != want {
+		t.Errorf("verr.Path = %q, want %q", got, want)
+	}
+	if !errors.Is(verr, ErrBlockedStateOnInputStep) {
+		t.Errorf("verr = %v, want %v", verr, ErrBlockedStateOnInputStep)
+	}
+}
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInputStep(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - block: ":rocket: Release"
+    key: release
+    prompt: "Fill out the release details"
+    blocked_state: running
+    depends_on: build
+    fields:
+      - text: Release name
+        key: release-name
+        hint: What should we call it?
+        required: false
+      - select: Stream
+        key: stream
+        default: beta
+        options:
+          - label: Beta
+            value: beta
+          - label: Stable
+            value: stable
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	notRequired := false
+	want := &Pipeline{
+		Steps: Steps{
+			&InputStep{
+				Key:          "release",
+				Prompt:       "Fill out the release details",
+				BlockedState: "running",
+				Fields: InputFields{
+					&TextField{
+						Text:     "Release name",
+						Key:      "release-name",
+						Hint:     "What should we call it?",
+						Required: &notRequired,
+					},
+					&SelectField{
+						Select:  "Stream",
+						Key:     "stream",
+						Default: "beta",
+						Options: []*SelectOption{
+							{Label: "Beta", Value: "beta"},
+							{Label: "Stable", Value: "stable"},
+						},
+					},
+				},
+				RemainingFields: map[string]any{
+					"block":      ":rocket: Release",
+					"depends_on": "build",
+				},
+			},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+
+	gotJSON, err := json.Marshal(p.Steps[0])
+	if err != nil {
+		t.Fatalf("json.Marshal(step) error = %v", err)
+	}
+	const wantJSON = `{"block":":rocket: Release","blocked_state":"running","depends_on":"build","fields":[{"hint":"What should we call it?","key":"release-name","required":false,"text":"Release name"},{"default":"beta","key":"stream","options":[{"label":"Beta","value":"beta"},{"label":"Stable","value":"stable"}],"select":"Stream"}],"key":"release","prompt":"Fill out the release details"}`
+	if diff := cmp.Diff(string(gotJSON), wantJSON); diff != "" {
+		t.Errorf("marshalled JSON diff (-got +want):\n%s", diff)
+	}
+
+	roundTrip, err := Parse(strings.NewReader(`{"steps":[` + string(gotJSON) + `]}`))
+	if err != nil {
+		t.Fatalf("Parse(gotJSON) error = %v", err)
+	}
+	if diff := diffPipeline(roundTrip, want); diff != "" {
+		t.Errorf("round-tripped pipeline diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestInputFields(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - input: Details
+    fields:
+      - text: Name
+        key: name
+      - select: Colours
+        key: colours
+        required: false
+        multiple: true
+        default: [red, blue]
+        options:
+          - { label: Red, value: red }
+          - { label: Blue, value: blue, hint: "Like the sky" }
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+	fields := p.Steps[0].(*InputStep).Fields
+
+	var keys []string
+	var required []bool
+	for _, f := range fields {
+		keys = append(keys, f.FieldKey())
+		switch f := f.(type) {
+		case *TextField:
+			required = append(required, f.IsRequired())
+		case *SelectField:
+			required = append(required, f.IsRequired())
+		}
+	}
+	if diff := cmp.Diff(keys, []string{"name", "colours"}); diff != "" {
+		t.Errorf("field keys diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(required, []bool{true, false}); diff != "" {
+		t.Errorf("field required diff (-got +want):\n%s", diff)
+	}
+
+	sel := fields[1].(*SelectField)
+	if diff := cmp.Diff(sel.Default, []any{"red", "blue"}); diff != "" {
+		t.Errorf("sel.Default diff (-got +want):\n%s", diff)
+	}
+	if got, want := sel.Options[1].Hint, "Like the sky"; got != want {
+		t.Errorf("sel.Options[1].Hint = %q, want %q", got, want)
+	}
+}
+
+func TestInputFieldsUnknownType(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - block: Details
+    fields:
+      - checkbox: Agree
+        key: agree
+`
+	p, err := Parse(strings.NewReader(input))
+	if !errors.Is(err, ErrUnknownInputFieldType) {
+		t.Errorf("Parse(input) error = %v, want %v", err, ErrUnknownInputFieldType)
+	}
+	if _, ok := p.Steps[0].(*UnknownStep); !ok {
+		t.Errorf("p.Steps[0] = %T, want *UnknownStep", p.Steps[0])
+	}
+}
+
+func TestInputStepMarshalEmpty(t *testing.T) {
+	t.Parallel()
+
+	if _, err := json.Marshal(&InputStep{}); err == nil {
+		t.Errorf("json.Marshal(&InputStep{}) error = nil, want non-nil error")
+	}
+}
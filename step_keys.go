@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// This file contains helpers for reading the key and dependencies of any kind
+// of step. Not every step type models these as struct fields, so some of them
+// have to be dug out of Contents or RemainingFields.
+
+// Dependency is a single entry of a step's depends_on.
+type Dependency struct {
+	// Key is the key of the step depended upon.
+	Key string
+
+	// AllowFailure is true if the dependency is satisfied even if the step
+	// depended upon fails.
+	AllowFailure bool
+}
+
+// StepKey returns the key of a step, or the empty string if it has no key.
+func StepKey(s Step) string {
+	switch s := s.(type) {
+	case *CommandStep:
+		return s.Key
+
+	case *GroupStep:
+		return s.Key
+
+	case *WaitStep:
+		return s.Key
+
+	case *InputStep:
+		return s.Key
+
+	case *TriggerStep:
+		return s.Key
+
+	default:
+		return ""
+	}
+}
+
+// StepAllowsDependencyFailure reports whether a step has
+// allow_dependency_failure set, which allows it to run even if any of its
+// dependencies fail.
+func StepAllowsDependencyFailure(s Step) bool {
+	switch s := s.(type) {
+	case *CommandStep:
+		return s.AllowDependencyFailure
+
+	case *GroupStep:
+		return s.AllowDependencyFailure
+
+	case *WaitStep:
+		return s.AllowDependencyFailure
+
+	case *InputStep:
+		return s.AllowDependencyFailure
+
+	case *TriggerStep:
+		return s.AllowDependencyFailure
+
+	default:
+		return false
+	}
+}
+
+// StepDependencies returns the dependencies (from depends_on) of a step.
+// It returns an error if depends_on is malformed.
+func StepDependencies(s Step) ([]Dependency, error) {
+	return parseDependsOn(stepDependsOn(s))
+}
+
+// stepDependsOn returns the raw depends_on value of a step.
+func stepDependsOn(s Step) any {
+	switch s := s.(type) {
+	case *CommandStep:
+		return s.RemainingFields["depends_on"]
+
+	case *GroupStep:
+		return s.RemainingFields["depends_on"]
+
+	case *WaitStep:
+		return s.RemainingFields["depends_on"]
+
+	case *InputStep:
+		return s.RemainingFields["depends_on"]
+
+	case *TriggerStep:
+		return s.RemainingFields["depends_on"]
+
+	default:
+		return nil
+	}
+}
+
+// disallowedFailureKeys returns the keys of depends_on items that explicitly
+// set allow_failure: false. It ignores malformed items.
+func disallowedFailureKeys(dependsOn any) []string {
+	items, ok := dependsOn.([]any)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for _, e := range items {
+		m, ok := asMap(e)
+		if !ok {
+			continue
+		}
+		if af, ok := m["allow_failure"].(bool); ok && !af {
+			key, _ := m["step"].(string)
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseDependsOn interprets the forms depends_on can take:
+//
+//	depends_on: step-key
+//
+//	depends_on:
+//	  - step-key
+//	  - step: other-step-key
+//	    allow_failure: true
+func parseDependsOn(dependsOn any) ([]Dependency, error) {
+	switch d := dependsOn.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		return []Dependency{{Key: d}}, nil
+
+	case []string:
+		deps := make([]Dependency, 0, len(d))
+		for _, k := range d {
+			deps = append(deps, Dependency{Key: k})
+		}
+		return deps, nil
+
+	case []any:
+		deps := make([]Dependency, 0, len(d))
+		for i, e := range d {
+			dep, err := parseDependency(e)
+			if err != nil {
+				return nil, fmt.Errorf("depends_on item %d: %w", i, err)
+			}
+			deps = append(deps, dep)
+		}
+		return deps, nil
+
+	default:
+		return nil, fmt.Errorf("depends_on has unsupported type %T, want a string or a list", dependsOn)
+	}
+}
+
+// parseDependency interprets a single item of a depends_on list.
+func parseDependency(e any) (Dependency, error) {
+	var m map[string]any
+	switch e := e.(type) {
+	case string:
+		return Dependency{Key: e}, nil
+
+	case *ordered.MapSA:
+		m = e.ToMap()
+
+	case map[string]any:
+		m = e
+
+	default:
+		return Dependency{}, fmt.Errorf("unsupported type %T, want a string or a mapping", e)
+	}
+
+	step, ok := m["step"].(string)
+	if !ok {
+		return Dependency{}, fmt.Errorf("mapping must contain a string value for \"step\"")
+	}
+	dep := Dependency{Key: step}
+	switch af := m["allow_failure"].(type) {
+	case nil:
+	case bool:
+		dep.AllowFailure = af
+	default:
+		return Dependency{}, fmt.Errorf("allow_failure has unsupported type %T, want bool", af)
+	}
+	return dep, nil
+}
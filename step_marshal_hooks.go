@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalHooks are functions called when steps of type S (such as
+// *CommandStep) are marshaled to JSON or YAML by a Marshaler, as part of a
+// pipeline or a group. They let programs that embed the library adjust how
+// steps are serialised, for example to strip internal fields or add computed
+// ones.
+type MarshalHooks[S Step] struct {
+	// Before is called with each step before it is marshaled, and returns the
+	// step to marshal in its place. Before must not modify the step it is
+	// given; to change it, return a modified copy. For a group step, the steps
+	// within it have already had their own hooks applied.
+	Before func(S) (S, error)
+
+	// After is called with the step (as returned by Before) and its fields,
+	// in the order they are marshaled to YAML, which it may modify. After is
+	// not called for steps that are marshaled as a scalar, such as "wait".
+	// When After is set, the fields are marshaled to JSON in the same order
+	// as to YAML.
+	After func(S, *ordered.MapSA) error
+}
+
+// Marshaler marshals pipelines to JSON or YAML, applying MarshalHooks to their
+// steps (including steps within groups). Hooks only apply to pipelines
+// marshaled with the Marshaler they were set on: marshaling a pipeline
+// directly (such as with json.Marshal), and the marshaling the library does
+// itself (such as in Encode, Pipeline.Hash, and Pipeline.Redacted), is
+// unaffected by them. The zero Marshaler applies no hooks.
+//
+// A Marshaler can be used concurrently, but not while hooks are being set.
+type Marshaler struct {
+	// hooks holds funcs that apply the hooks for each step type to a step,
+	// and return the value to marshal in its place.
+	hooks map[reflect.Type]func(Step) (any, error)
+}
+
+// SetMarshalHooks sets the hooks m applies to steps of type S, replacing any
+// set before. Setting hooks with neither Before nor After removes them.
+func SetMarshalHooks[S Step](m *Marshaler, hooks MarshalHooks[S]) {
+	t := reflect.TypeFor[S]()
+	if hooks.Before == nil && hooks.After == nil {
+		delete(m.hooks, t)
+		return
+	}
+	if m.hooks == nil {
+		m.hooks = make(map[reflect.Type]func(Step) (any, error))
+	}
+	m.hooks[t] = hooks.apply
+}
+
+// JSON marshals the pipeline to JSON, applying the hooks.
+func (m *Marshaler) JSON(p *Pipeline) ([]byte, error) {
+	hooked, err := m.applyPipeline(p)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(hooked)
+}
+
+// YAML marshals the pipeline to YAML, applying the hooks.
+func (m *Marshaler) YAML(p *Pipeline) ([]byte, error) {
+	hooked, err := m.applyPipeline(p)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(hooked)
+}
+
+// applyPipeline returns a copy of the pipeline with the hooks applied to its
+// steps. The pipeline itself is unchanged.
+func (m *Marshaler) applyPipeline(p *Pipeline) (*Pipeline, error) {
+	steps, err := m.applySteps(p.Steps)
+	if err != nil {
+		return nil, err
+	}
+	hooked := *p
+	hooked.Steps = steps
+	return &hooked, nil
+}
+
+// applySteps returns a copy of the steps with the hooks applied to them.
+func (m *Marshaler) applySteps(steps Steps) (Steps, error) {
+	if len(m.hooks) == 0 || steps == nil {
+		return steps, nil
+	}
+	out := make(Steps, len(steps))
+	for i, step := range steps {
+		// Apply hooks within groups first, so that a group's After hook
+		// gets fields that include its steps as they will be marshaled.
+		if g, ok := step.(*GroupStep); ok && g != nil {
+			inner, err := m.applySteps(g.Steps)
+			if err != nil {
+				return nil, fmt.Errorf("marshal hooks for step %d of %d: %w", i+1, len(steps), err)
+			}
+			g2 := *g
+			g2.Steps = inner
+			step = &g2
+		}
+		hook := m.hooks[reflect.TypeOf(step)]
+		if hook == nil {
+			out[i] = step
+			continue
+		}
+		v, err := hook(step)
+		if err != nil {
+			return nil, fmt.Errorf("marshal hooks for step %d of %d: %w", i+1, len(steps), err)
+		}
+		out[i] = &hookedStep{v: v}
+	}
+	return out, nil
+}
+
+// apply applies the hooks to step, which has type S.
+func (h MarshalHooks[S]) apply(step Step) (any, error) {
+	s := step.(S)
+	if h.Before != nil {
+		var err error
+		if s, err = h.Before(s); err != nil {
+			return nil, err
+		}
+	}
+	if h.After == nil {
+		return s, nil
+	}
+
+	g, err := toGeneric(s)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := g.(*ordered.MapSA)
+	if !ok {
+		return g, nil
+	}
+	if err := h.After(s, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// hookedStep stands in for a step that has had hooks applied, in the copy of
+// a pipeline that a Marshaler marshals. It marshals as the value the hooks
+// returned.
+type hookedStep struct {
+	v any
+}
+
+func (*hookedStep) stepTag() {}
+
+// Hash returns a digest of the value the hooks returned.
+func (h *hookedStep) Hash() (string, error) { return contentHash(h.v) }
+
+func (*hookedStep) interpolate(stringTransformer) error { return nil }
+
+// MarshalJSON marshals the value the hooks returned to JSON.
+func (h *hookedStep) MarshalJSON() ([]byte, error) { return json.Marshal(h.v) }
+
+// MarshalYAML returns the value the hooks returned, to marshal to YAML.
+func (h *hookedStep) MarshalYAML() (any, error) { return h.v, nil }
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshaler(t *testing.T) {
+	t.Parallel()
+
+	var m Marshaler
+	SetMarshalHooks(&m, MarshalHooks[*CommandStep]{
+		Before: func(c *CommandStep) (*CommandStep, error) {
+			c2 := *c
+			c2.Env = maps.Clone(c.Env)
+			delete(c2.Env, "INTERNAL_TOKEN")
+			return &c2, nil
+		},
+		After: func(c *CommandStep, m *ordered.MapSA) error {
+			m.Set("command_lines", strings.Count(c.Command, "\n")+1)
+			return nil
+		},
+	})
+
+	p := &Pipeline{
+		Steps: Steps{
+			&CommandStep{
+				Command: "echo hello\necho goodbye",
+				Env:     map[string]string{"INTERNAL_TOKEN": "xyz", "PUBLIC": "yes"},
+			},
+			&WaitStep{Scalar: "wait"},
+			&GroupStep{
+				Group: ptr("group"),
+				Steps: Steps{&CommandStep{Command: "true"}},
+			},
+		},
+	}
+
+	gotYAML, err := m.YAML(p)
+	if err != nil {
+		t.Fatalf("m.YAML(p) error = %v", err)
+	}
+	const wantYAML = `steps:
+    - command: |-
+        echo hello
+        echo goodbye
+      env:
+        PUBLIC: "yes"
+      command_lines: 2
+    - wait
+    - group: group
+      steps:
+        - command: "true"
+          command_lines: 1
+`
+	if diff := cmp.Diff(string(gotYAML), wantYAML); diff != "" {
+		t.Errorf("m.YAML(p) diff (-got +want):\n%s", diff)
+	}
+
+	gotJSON, err := m.JSON(p)
+	if err != nil {
+		t.Fatalf("m.JSON(p) error = %v", err)
+	}
+	const wantJSON = `{"steps":[{"command":"echo hello\necho goodbye","env":{"PUBLIC":"yes"},"command_lines":2},"wait",{"group":"group","steps":[{"command":"true","command_lines":1}]}]}`
+	if diff := cmp.Diff(string(gotJSON), wantJSON); diff != "" {
+		t.Errorf("m.JSON(p) diff (-got +want):\n%s", diff)
+	}
+
+	// Marshaling the pipeline directly doesn't apply the hooks.
+	plainJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal(p) error = %v", err)
+	}
+	const wantPlainJSON = `{"steps":[{"command":"echo hello\necho goodbye","env":{"INTERNAL_TOKEN":"xyz","PUBLIC":"yes"}},"wait",{"group":"group","steps":[{"command":"true"}]}]}`
+	if diff := cmp.Diff(string(plainJSON), wantPlainJSON); diff != "" {
+		t.Errorf("json.Marshal(p) diff (-got +want):\n%s", diff)
+	}
+
+	// The original step is unchanged.
+	if _, ok := p.Steps[0].(*CommandStep).Env["INTERNAL_TOKEN"]; !ok {
+		t.Errorf("after marshaling, p.Steps[0].Env lacks INTERNAL_TOKEN; Before modified the original step")
+	}
+}
+
+func TestMarshaler_LargePipeline(t *testing.T) {
+	t.Parallel()
+
+	var m Marshaler
+	SetMarshalHooks(&m, MarshalHooks[*CommandStep]{
+		Before: func(c *CommandStep) (*CommandStep, error) {
+			c2 := *c
+			c2.Label = "hooked"
+			return &c2, nil
+		},
+	})
+
+	p := &Pipeline{Steps: make(Steps, streamJSONSteps+1)}
+	for i := range p.Steps {
+		p.Steps[i] = &CommandStep{Command: "true"}
+	}
+	got, err := m.JSON(p)
+	if err != nil {
+		t.Fatalf("m.JSON(p) error = %v", err)
+	}
+	if got, want := strings.Count(string(got), `"label":"hooked"`), len(p.Steps); got != want {
+		t.Errorf("hooked labels in m.JSON(p) = %d, want %d", got, want)
+	}
+}
+
+func TestMarshaler_Error(t *testing.T) {
+	t.Parallel()
+
+	errHook := errors.New("hook failed")
+	var m Marshaler
+	SetMarshalHooks(&m, MarshalHooks[*WaitStep]{
+		After: func(*WaitStep, *ordered.MapSA) error { return errHook },
+	})
+
+	p := &Pipeline{Steps: Steps{&GroupStep{Steps: Steps{&WaitStep{Key: "w"}}}}}
+	if _, err := m.JSON(p); !errors.Is(err, errHook) {
+		t.Errorf("m.JSON(p) error = %v, want %v", err, errHook)
+	}
+	if _, err := m.YAML(p); !errors.Is(err, errHook) {
+		t.Errorf("m.YAML(p) error = %v, want %v", err, errHook)
+	}
+
+	// Removing the hooks leaves nothing to fail.
+	SetMarshalHooks(&m, MarshalHooks[*WaitStep]{})
+	if _, err := m.JSON(p); err != nil {
+		t.Errorf("after removing hooks, m.JSON(p) error = %v", err)
+	}
+}
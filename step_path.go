@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// StepPath locates a step within a pipeline: the group steps containing it,
+// and its index within each list of steps.
+type StepPath struct {
+	// Groups are the group steps containing the step, outermost first. It is
+	// empty for top-level steps.
+	Groups []*GroupStep
+
+	// Indices are the indices of the step (or the group containing it) in
+	// each list of steps, starting with the pipeline's steps. It has one more
+	// element than Groups.
+	Indices []int
+}
+
+// Index returns the index of the step within the list of steps it is in.
+func (sp StepPath) Index() int {
+	if len(sp.Indices) == 0 {
+		return -1
+	}
+	return sp.Indices[len(sp.Indices)-1]
+}
+
+// Depth returns the number of groups containing the step.
+func (sp StepPath) Depth() int {
+	return len(sp.Groups)
+}
+
+// Parent returns the group step containing the step, or nil if it is a
+// top-level step.
+func (sp StepPath) Parent() *GroupStep {
+	if len(sp.Groups) == 0 {
+		return nil
+	}
+	return sp.Groups[len(sp.Groups)-1]
+}
+
+// String returns the path in the form used elsewhere in this package, such as
+// "steps[1].steps[0]".
+func (sp StepPath) String() string {
+	var sb strings.Builder
+	for i, idx := range sp.Indices {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		fmt.Fprintf(&sb, "steps[%d]", idx)
+	}
+	return sb.String()
+}
+
+// AllSteps returns an iterator over all the steps in the pipeline, including
+// those within group steps, with the path to each:
+//
+//	for path, step := range p.AllSteps() {
+//		...
+//	}
+//
+// Each group step is visited before the steps within it. Paths are not
+// shared, so they can be kept after the loop. Steps added or removed while
+// iterating may or may not be visited.
+func (p *Pipeline) AllSteps() iter.Seq2[StepPath, Step] {
+	return p.Steps.All()
+}
+
+// All returns an iterator over the steps, including those within group steps,
+// with the path to each (see Pipeline.AllSteps).
+func (s Steps) All() iter.Seq2[StepPath, Step] {
+	return func(yield func(StepPath, Step) bool) {
+		s.all(StepPath{}, yield)
+	}
+}
+
+// all yields each step in s (within the group at parent), and reports whether
+// to continue.
+func (s Steps) all(parent StepPath, yield func(StepPath, Step) bool) bool {
+	for i, step := range s {
+		path := StepPath{
+			Groups:  slices.Clone(parent.Groups),
+			Indices: append(slices.Clone(parent.Indices), i),
+		}
+		if !yield(path, step) {
+			return false
+		}
+		g, ok := step.(*GroupStep)
+		if !ok || g == nil {
+			continue
+		}
+		inner := StepPath{
+			Groups:  append(slices.Clone(parent.Groups), g),
+			Indices: path.Indices,
+		}
+		if !g.Steps.all(inner, yield) {
+			return false
+		}
+	}
+	return true
+}
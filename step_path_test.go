@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAllSteps(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(strings.NewReader(`---
+steps:
+  - key: build
+    command: make
+  - group: Test
+    key: test
+    steps:
+      - key: unit
+        command: make test
+      - wait
+      - key: lint
+        command: make lint
+  - key: deploy
+    trigger: deploy
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	type visit struct {
+		Path, Key, Parent string
+		Index, Depth      int
+	}
+	var got []visit
+	for path, step := range p.AllSteps() {
+		v := visit{
+			Path:  path.String(),
+			Key:   StepKey(step),
+			Index: path.Index(),
+			Depth: path.Depth(),
+		}
+		if g := path.Parent(); g != nil {
+			v.Parent = g.Key
+		}
+		got = append(got, v)
+	}
+	want := []visit{
+		{Path: "steps[0]", Key: "build", Index: 0},
+		{Path: "steps[1]", Key: "test", Index: 1},
+		{Path: "steps[1].steps[0]", Key: "unit", Parent: "test", Index: 0, Depth: 1},
+		{Path: "steps[1].steps[1]", Parent: "test", Index: 1, Depth: 1},
+		{Path: "steps[1].steps[2]", Key: "lint", Parent: "test", Index: 2, Depth: 1},
+		{Path: "steps[2]", Key: "deploy", Index: 2},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("p.AllSteps() visits diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestAllStepsBreak(t *testing.T) {
+	t.Parallel()
+
+	p := &Pipeline{Steps: Steps{
+		&GroupStep{Key: "g", Steps: Steps{
+			&CommandStep{Key: "a"},
+			&CommandStep{Key: "b"},
+		}},
+		&CommandStep{Key: "c"},
+	}}
+
+	var paths []StepPath
+	for path, step := range p.AllSteps() {
+		paths = append(paths, path)
+		if StepKey(step) == "a" {
+			break
+		}
+	}
+	if got, want := len(paths), 2; got != want {
+		t.Fatalf("visited %d steps before break, want %d", got, want)
+	}
+	// Paths are not shared between iterations.
+	if got, want := paths[0].String(), "steps[0]"; got != want {
+		t.Errorf("paths[0] = %q, want %q", got, want)
+	}
+	if got, want := paths[1].String(), "steps[0].steps[0]"; got != want {
+		t.Errorf("paths[1] = %q, want %q", got, want)
+	}
+}
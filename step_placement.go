@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+)
+
+// Placement describes where a command step's jobs will be scheduled: the
+// cluster and agent queue they target, and any other agent tags they require.
+type Placement struct {
+	// Cluster is the cluster the jobs target, or "" if none is specified.
+	Cluster string
+
+	// Queue is the agent queue the jobs target, or "" if none is specified
+	// (they will run on the default queue).
+	Queue string
+
+	// Tags are the other agent tags the jobs require, such as os=linux. Tags
+	// written without a value (such as "- gpu") have the value "". Tags is nil
+	// if there are none.
+	Tags map[string]string
+}
+
+// Placement resolves where the step's jobs will be scheduled, from the agents,
+// queue, and cluster fields of the step and the pipeline. Each of the cluster,
+// the queue, and each agent tag is taken from the first of these that sets it:
+//   - the step's own queue or cluster field,
+//   - the step's agents (either a mapping, or a list of "key=value" strings),
+//   - the pipeline's queue or cluster field,
+//   - the pipeline's agents.
+//
+// p should be the pipeline containing the step, or nil if there is none.
+// Values that are not strings are formatted with fmt.Sprint.
+func (c *CommandStep) Placement(p *Pipeline) Placement {
+	var pl Placement
+	if p != nil {
+		pl.apply(p.RemainingFields["agents"], p.RemainingFields)
+	}
+	// Steps built without unmarshaling may still have agents in
+	// RemainingFields.
+	var agents any = c.RemainingFields["agents"]
+	if c.Agents != nil {
+		agents = c.Agents
+	}
+	pl.apply(agents, c.RemainingFields)
+	return pl
+}
+
+// apply overrides the placement with the tags in agents, and the fields set in
+// fields, which are the remaining fields of a step or pipeline.
+func (pl *Placement) apply(agents any, fields map[string]any) {
+	for k, v := range agentTags(agents) {
+		switch k {
+		case "cluster":
+			pl.Cluster = v
+		case "queue":
+			pl.Queue = v
+		default:
+			if pl.Tags == nil {
+				pl.Tags = make(map[string]string)
+			}
+			pl.Tags[k] = v
+		}
+	}
+	if v, ok := fields["cluster"]; ok && v != nil {
+		pl.Cluster = fmt.Sprint(v)
+	}
+	if v, ok := fields["queue"]; ok && v != nil {
+		pl.Queue = fmt.Sprint(v)
+	}
+}
+
+// agentTags returns the tags in an `agents` value, which can be either a
+// mapping (`queue: foo`) or a sequence of strings (`- queue=foo`).
+func agentTags(agents any) map[string]string {
+	switch agents := agents.(type) {
+	case *Agents:
+		return agents.ToMap()
+
+	case *ordered.MapSA:
+		out := make(map[string]string, agents.Len())
+		for k, v := range agents.All() {
+			out[k] = fmt.Sprint(v)
+		}
+		return out
+
+	case map[string]any:
+		out := make(map[string]string, len(agents))
+		for k, v := range agents {
+			out[k] = fmt.Sprint(v)
+		}
+		return out
+
+	case map[string]string:
+		return agents
+
+	case []any:
+		out := make(map[string]string, len(agents))
+		for _, a := range agents {
+			if s, ok := a.(string); ok {
+				k, v, _ := strings.Cut(s, "=")
+				out[k] = v
+			}
+		}
+		return out
+
+	case []string:
+		out := make(map[string]string, len(agents))
+		for _, s := range agents {
+			k, v, _ := strings.Cut(s, "=")
+			out[k] = v
+		}
+		return out
+	}
+	return nil
+}
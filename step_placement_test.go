@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCommandStepPlacement(t *testing.T) {
+	t.Parallel()
+
+	const input = `---
+agents:
+  queue: default-queue
+  os: linux
+cluster: main
+steps:
+  - command: one
+  - command: two
+    agents:
+      queue: fast
+      arch: arm64
+  - group: group
+    steps:
+      - command: three
+        agents:
+          - "queue=fast"
+          - "os=macos"
+          - "gpu"
+      - command: four
+        queue: slow
+        cluster: other
+        agents:
+          queue: ignored
+          cluster: ignored
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	got := make(map[string]Placement)
+	p.Steps.walkCommandSteps(func(c *CommandStep) {
+		got[c.Command] = c.Placement(p)
+	})
+
+	want := map[string]Placement{
+		"one": {
+			Cluster: "main",
+			Queue:   "default-queue",
+			Tags:    map[string]string{"os": "linux"},
+		},
+		"two": {
+			Cluster: "main",
+			Queue:   "fast",
+			Tags:    map[string]string{"os": "linux", "arch": "arm64"},
+		},
+		"three": {
+			Cluster: "main",
+			Queue:   "fast",
+			Tags:    map[string]string{"os": "macos", "gpu": ""},
+		},
+		"four": {
+			Cluster: "other",
+			Queue:   "slow",
+			Tags:    map[string]string{"os": "linux"},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("CommandStep.Placement(p) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestCommandStepPlacement_NoPipeline(t *testing.T) {
+	t.Parallel()
+
+	step := &CommandStep{
+		Command: "make",
+		RemainingFields: map[string]any{
+			"agents": map[string]string{"queue": "build", "size": "large"},
+		},
+	}
+	got := step.Placement(nil)
+	want := Placement{
+		Queue: "build",
+		Tags:  map[string]string{"size": "large"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("step.Placement(nil) diff (-got +want):\n%s", diff)
+	}
+
+	if diff := cmp.Diff((&CommandStep{}).Placement(nil), Placement{}); diff != "" {
+		t.Errorf("(&CommandStep{}).Placement(nil) diff (-got +want):\n%s", diff)
+	}
+}
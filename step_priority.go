@@ -0,0 +1,67 @@
+package pipeline
+
+import "strconv"
+
+// EffectivePriority returns the priority the step's jobs will be given, which
+// is the first of these that is set:
+//   - the step's own priority,
+//   - the priority of the group step containing the step,
+//   - the pipeline's default priority,
+//   - 0.
+//
+// p should be the pipeline containing the step, or nil if there is none.
+// Priorities that are not integers (or strings containing integers) are
+// treated as not set.
+func (c *CommandStep) EffectivePriority(p *Pipeline) int {
+	if prio, ok := parsePriority(c.RemainingFields["priority"]); ok {
+		return prio
+	}
+	if p == nil {
+		return 0
+	}
+	if g := p.Steps.groupContaining(c); g != nil {
+		if prio, ok := parsePriority(g.RemainingFields["priority"]); ok {
+			return prio
+		}
+	}
+	if prio, ok := parsePriority(p.RemainingFields["priority"]); ok {
+		return prio
+	}
+	return 0
+}
+
+// groupContaining returns the innermost group step within steps that contains
+// s, or nil if s is not within a group.
+func (steps Steps) groupContaining(s Step) *GroupStep {
+	for _, step := range steps {
+		g, ok := step.(*GroupStep)
+		if !ok {
+			continue
+		}
+		if inner := g.Steps.groupContaining(s); inner != nil {
+			return inner
+		}
+		for _, gs := range g.Steps {
+			if gs == s {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// parsePriority interprets a priority value, which is normally an integer, but
+// may be a string after interpolation.
+func parsePriority(v any) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+
+	case string:
+		prio, err := strconv.Atoi(v)
+		return prio, err == nil
+
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandStepEffectivePriority(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+priority: 1
+steps:
+  - command: own
+    priority: 5
+  - command: pipeline default
+  - group: Tests
+    priority: 3
+    steps:
+      - command: group
+      - command: own in group
+        priority: "-2"
+  - group: Lint
+    steps:
+      - command: pipeline default in group
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	tests := []struct {
+		step *CommandStep
+		want int
+	}{
+		{step: p.Steps[0].(*CommandStep), want: 5},
+		{step: p.Steps[1].(*CommandStep), want: 1},
+		{step: p.Steps[2].(*GroupStep).Steps[0].(*CommandStep), want: 3},
+		{step: p.Steps[2].(*GroupStep).Steps[1].(*CommandStep), want: -2},
+		{step: p.Steps[3].(*GroupStep).Steps[0].(*CommandStep), want: 1},
+	}
+	for _, test := range tests {
+		if got := test.step.EffectivePriority(p); got != test.want {
+			t.Errorf("step %q EffectivePriority(p) = %d, want %d", test.step.Command, got, test.want)
+		}
+	}
+
+	if got, want := p.Steps[1].(*CommandStep).EffectivePriority(nil), 0; got != want {
+		t.Errorf("EffectivePriority(nil) = %d, want %d", got, want)
+	}
+}
@@ -2,22 +2,201 @@ package pipeline
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/buildkite/go-pipeline/warning"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ interface {
+		json.Marshaler
+		yaml.Marshaler
+		ordered.Unmarshaler
+		selfInterpolater
+	} = (*TriggerStep)(nil)
+
+	_ interface {
+		json.Marshaler
+		selfInterpolater
+	} = (*TriggerBuild)(nil)
 )
 
 // TriggerStep models a trigger step.
 //
 // Standard caveats apply - see the package comment.
 type TriggerStep struct {
-	Contents map[string]any `yaml:",inline"`
+	// Fields common to various step types
+	Key   string `yaml:"key,omitempty" aliases:"id,identifier"`
+	Label string `yaml:"label,omitempty" aliases:"name"`
+
+	AllowDependencyFailure bool `yaml:"allow_dependency_failure,omitempty"`
+
+	// Fields that are meaningful specifically for trigger steps
+	Trigger   string        `yaml:"trigger"`
+	Build     *TriggerBuild `yaml:"build,omitempty"`
+	Async     bool          `yaml:"async,omitempty"`
+	Branches  string        `yaml:"branches,omitempty"`
+	Signature *Signature    `yaml:"signature,omitempty"`
+
+	// Skip is either a bool, or a string giving the reason for skipping.
+	Skip any `yaml:"skip,omitempty"`
+
+	// RemainingFields stores any other top-level mapping items so they at least
+	// survive an unmarshal-marshal round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
+
+	// branchesList records that Branches was written as a list of patterns,
+	// so that it marshals back the same way.
+	branchesList bool
+}
+
+// TriggerBuild models the attributes of the build created by a trigger step.
+type TriggerBuild struct {
+	Message  string            `yaml:"message,omitempty"`
+	Commit   string            `yaml:"commit,omitempty"`
+	Branch   string            `yaml:"branch,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	MetaData map[string]string `yaml:"meta_data,omitempty"`
+
+	// RemainingFields stores any other mapping items so they at least survive
+	// an unmarshal-marshal round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// MarshalJSON marshals the step to JSON. Special handling is needed because
+// yaml.v3 has "inline" but encoding/json has no concept of it, and to marshal
+// Branches in the form it was written in.
+func (t *TriggerStep) MarshalJSON() ([]byte, error) {
+	if !t.marshalBranchesList() {
+		return inlineFriendlyMarshalJSON(t)
+	}
+	fields, err := inlineFriendlyFields(t)
+	if err != nil {
+		return nil, err
+	}
+	fields["branches"] = strings.Fields(t.Branches)
+	return json.Marshal(fields)
 }
 
-// MarshalJSON marshals the contents of the step.
-func (t TriggerStep) MarshalJSON() ([]byte, error) {
-	return json.Marshal(t.Contents)
+// MarshalYAML returns the step to marshal to YAML, with Branches in the form
+// it was written in.
+func (t *TriggerStep) MarshalYAML() (any, error) {
+	// Wrap t in a type without a MarshalYAML method, to avoid infinite
+	// recursion.
+	type wrappedTrigger TriggerStep
+	if !t.marshalBranchesList() {
+		return (*wrappedTrigger)(t), nil
+	}
+	v, err := toGeneric((*wrappedTrigger)(t))
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(*ordered.MapSA); ok {
+		m.Set("branches", strings.Fields(t.Branches))
+	}
+	return v, nil
 }
 
-func (s TriggerStep) interpolate(tf stringTransformer) error {
-	return interpolateMap(tf, s.Contents)
+// marshalBranchesList reports whether Branches should be marshaled as a list.
+func (t *TriggerStep) marshalBranchesList() bool {
+	return t.branchesList && t.Branches != ""
 }
 
-func (TriggerStep) stepTag() {}
+// UnmarshalOrdered unmarshals a trigger step from an ordered map.
+func (t *TriggerStep) UnmarshalOrdered(src any) error {
+	return t.UnmarshalOrderedWith(src)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (t *TriggerStep) UnmarshalOrderedWith(src any, opts ...ordered.UnmarshalOption) error {
+	type wrappedTrigger TriggerStep
+	// Unmarshal into this secret type, then process special fields specially.
+	fullTrigger := new(struct {
+		Branches []string `yaml:"branches"`
+
+		// Use inline trickery to capture the rest of the struct.
+		Rem *wrappedTrigger `yaml:",inline"`
+	})
+	fullTrigger.Rem = (*wrappedTrigger)(t)
+	err := ordered.Unmarshal(src, fullTrigger, opts...)
+	w := warning.As(err)
+	if err != nil && w == nil {
+		return fmt.Errorf("unmarshalling TriggerStep: %w", err)
+	}
+
+	// Branches can be either a space-separated string or a list of patterns,
+	// which are equivalent. Normalise to the string form, but remember which
+	// form it was written in.
+	t.Branches = strings.Join(fullTrigger.Branches, " ")
+	if m, ok := src.(*ordered.MapSA); ok {
+		b, _ := m.Get("branches")
+		_, t.branchesList = b.([]any)
+	}
+	if w != nil {
+		return w
+	}
+	return nil
+}
+
+func (t *TriggerStep) interpolate(tf stringTransformer) error {
+	if err := interpolateString(tf, &t.Key); err != nil {
+		return fmt.Errorf("interpolating key: %w", err)
+	}
+	if err := interpolateString(tf, &t.Label); err != nil {
+		return fmt.Errorf("interpolating label: %w", err)
+	}
+	if err := interpolateString(tf, &t.Trigger); err != nil {
+		return fmt.Errorf("interpolating trigger: %w", err)
+	}
+	if err := t.Build.interpolate(tf); err != nil {
+		return fmt.Errorf("interpolating build: %w", err)
+	}
+	if err := interpolateString(tf, &t.Branches); err != nil {
+		return fmt.Errorf("interpolating branches: %w", err)
+	}
+	skip, err := interpolateAny(tf, t.Skip)
+	if err != nil {
+		return fmt.Errorf("interpolating skip: %w", err)
+	}
+	t.Skip = skip
+
+	// NB: Do not interpolate Signature.
+
+	if err := interpolateMap(tf, t.RemainingFields); err != nil {
+		return fmt.Errorf("interpolating remaining fields: %w", err)
+	}
+	return nil
+}
+
+func (*TriggerStep) stepTag() {}
+
+// MarshalJSON marshals the build attributes to JSON. Special handling is
+// needed because yaml.v3 has "inline" but encoding/json has no concept of it.
+func (b *TriggerBuild) MarshalJSON() ([]byte, error) {
+	return inlineFriendlyMarshalJSON(b)
+}
+
+func (b *TriggerBuild) interpolate(tf stringTransformer) error {
+	if b == nil {
+		return nil
+	}
+	if err := interpolateString(tf, &b.Message); err != nil {
+		return err
+	}
+	if err := interpolateString(tf, &b.Commit); err != nil {
+		return err
+	}
+	if err := interpolateString(tf, &b.Branch); err != nil {
+		return err
+	}
+	if err := interpolateMap(tf, b.Env); err != nil {
+		return err
+	}
+	if err := interpolateMap(tf, b.MetaData); err != nil {
+		return err
+	}
+	return interpolateMap(tf, b.RemainingFields)
+}
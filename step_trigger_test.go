@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/go-pipeline/internal/env"
+	"github.com/buildkite/go-pipeline/ordered"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTriggerStep(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+steps:
+  - trigger: deploy-${ENVIRONMENT}
+    id: deploy
+    name: ":rocket: Deploy"
+    async: true
+    branches:
+      - main
+      - release/*
+    skip: "not on Fridays"
+    depends_on: build
+    build:
+      message: "${BUILDKITE_MESSAGE}"
+      commit: abc123
+      branch: main
+      env:
+        REGION: us-east-1
+      meta_data:
+        release-version: 1
+      pull_request_id: 4
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := &Pipeline{
+		Steps: Steps{
+			&TriggerStep{
+				Key:      "deploy",
+				Label:    ":rocket: Deploy",
+				Trigger:  "deploy-${ENVIRONMENT}",
+				Async:    true,
+				Branches: "main release/*",
+				Skip:     "not on Fridays",
+				Build: &TriggerBuild{
+					Message:  "${BUILDKITE_MESSAGE}",
+					Commit:   "abc123",
+					Branch:   "main",
+					Env:      map[string]string{"REGION": "us-east-1"},
+					MetaData: map[string]string{"release-version": "1"},
+					RemainingFields: map[string]any{
+						"pull_request_id": 4,
+					},
+				},
+				RemainingFields: map[string]any{
+					"depends_on": "build",
+				},
+				branchesList: true,
+			},
+		},
+	}
+	if diff := diffPipeline(p, want); diff != "" {
+		t.Errorf("parsed pipeline diff (-got +want):\n%s", diff)
+	}
+
+	gotJSON, err := json.MarshalIndent(p.Steps[0], "", "  ")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent(step) error = %v", err)
+	}
+	const wantJSON = `{
+  "async": true,
+  "branches": [
+    "main",
+    "release/*"
+  ],
+  "build": {
+    "branch": "main",
+    "commit": "abc123",
+    "env": {
+      "REGION": "us-east-1"
+    },
+    "message": "${BUILDKITE_MESSAGE}",
+    "meta_data": {
+      "release-version": "1"
+    },
+    "pull_request_id": 4
+  },
+  "depends_on": "build",
+  "key": "deploy",
+  "label": ":rocket: Deploy",
+  "skip": "not on Fridays",
+  "trigger": "deploy-${ENVIRONMENT}"
+}`
+	if diff := cmp.Diff(string(gotJSON), wantJSON); diff != "" {
+		t.Errorf("marshalled JSON diff (-got +want):\n%s", diff)
+	}
+
+	// Round-trip through the parser.
+	roundTrip, err := Parse(strings.NewReader(`{"steps":[` + string(gotJSON) + `]}`))
+	if err != nil {
+		t.Fatalf("Parse(gotJSON) error = %v", err)
+	}
+	if diff := diffPipeline(roundTrip, want); diff != "" {
+		t.Errorf("round-tripped pipeline diff (-got +want):\n%s", diff)
+	}
+
+	gotYAML, err := yaml.Marshal(p.Steps[0])
+	if err != nil {
+		t.Fatalf("yaml.Marshal(step) error = %v", err)
+	}
+	if want := "branches:\n    - main\n    - release/*\n"; !strings.Contains(string(gotYAML), want) {
+		t.Errorf("yaml.Marshal(step) = %q, want it to contain %q", gotYAML, want)
+	}
+
+	runtimeEnv := env.New(env.FromMap(map[string]string{
+		"ENVIRONMENT":       "production",
+		"BUILDKITE_MESSAGE": "Ship it",
+	}))
+	if err := p.Interpolate(runtimeEnv, false); err != nil {
+		t.Fatalf("p.Interpolate(runtimeEnv, false) error = %v", err)
+	}
+	step := p.Steps[0].(*TriggerStep)
+	if got, want := step.Trigger, "deploy-production"; got != want {
+		t.Errorf("step.Trigger = %q, want %q", got, want)
+	}
+	if got, want := step.Build.Message, "Ship it"; got != want {
+		t.Errorf("step.Build.Message = %q, want %q", got, want)
+	}
+}
+
+func TestTriggerStep_StringBranches(t *testing.T) {
+	t.Parallel()
+
+	var step TriggerStep
+	src := ordered.MapFromItems(
+		ordered.TupleSA{Key: "trigger", Value: "downstream"},
+		ordered.TupleSA{Key: "branches", Value: "main stable/*"},
+	)
+	if err := ordered.Unmarshal(src, &step); err != nil {
+		t.Fatalf("ordered.Unmarshal(src, &step) error = %v", err)
+	}
+	want := TriggerStep{
+		Trigger:  "downstream",
+		Branches: "main stable/*",
+	}
+	if diff := cmp.Diff(step, want, allowUnexported); diff != "" {
+		t.Errorf("unmarshalled step diff (-got +want):\n%s", diff)
+	}
+
+	gotJSON, err := json.Marshal(&step)
+	if err != nil {
+		t.Fatalf("json.Marshal(&step) error = %v", err)
+	}
+	if diff := cmp.Diff(string(gotJSON), `{"branches":"main stable/*","trigger":"downstream"}`); diff != "" {
+		t.Errorf("json.Marshal(&step) diff (-got +want):\n%s", diff)
+	}
+}
@@ -1,6 +1,9 @@
 package pipeline
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // See the comment in step_scalar.go.
 
@@ -8,34 +11,65 @@ import "encoding/json"
 //
 // Standard caveats apply - see the package comment.
 type WaitStep struct {
-	Scalar   string         `yaml:"-"`
-	Contents map[string]any `yaml:",inline"`
+	Scalar string `yaml:"-"`
+
+	// Fields common to various step types
+	Key string `yaml:"key,omitempty" aliases:"id,identifier"`
+	If  string `yaml:"if,omitempty"`
+
+	// Fields that are meaningful specifically for wait steps
+	ContinueOnFailure      bool `yaml:"continue_on_failure,omitempty"`
+	AllowDependencyFailure bool `yaml:"allow_dependency_failure,omitempty"`
+
+	// RemainingFields stores any other mapping items (including the "wait"
+	// item itself) so they at least survive an unmarshal-marshal round-trip.
+	RemainingFields map[string]any `yaml:",inline"`
+}
+
+// isEmpty reports whether the step has no contents (apart from Scalar).
+func (s *WaitStep) isEmpty() bool {
+	return s.Key == "" && s.If == "" && !s.ContinueOnFailure && !s.AllowDependencyFailure && len(s.RemainingFields) == 0
 }
 
 // MarshalJSON marshals a wait step as "wait" if the step is empty, or as the
-// s.Scalar if it is not empty, or as s.Contents.
+// s.Scalar if it is not empty, or as the fields of the step.
 func (s *WaitStep) MarshalJSON() ([]byte, error) {
-	o, err := s.MarshalYAML()
-	if err != nil {
-		return nil, err
+	if s.Scalar != "" || s.isEmpty() {
+		o, err := s.MarshalYAML()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(o)
 	}
-	return json.Marshal(o)
+	return inlineFriendlyMarshalJSON(s)
 }
 
 // MarshalYAML returns a wait step as "wait" if the step is empty, or as the
-// s.Scalar if it is not empty, or as s.Contents.
+// s.Scalar if it is not empty, or as the fields of the step.
 func (s *WaitStep) MarshalYAML() (any, error) {
 	if s.Scalar != "" {
 		return s.Scalar, nil
 	}
-	if len(s.Contents) == 0 {
+	if s.isEmpty() {
 		return "wait", nil
 	}
-	return s.Contents, nil
+	// Wrap s in a type without a MarshalYAML method, to avoid infinite
+	// recursion.
+	type wrappedWait WaitStep
+	return (*wrappedWait)(s), nil
 }
 
 func (s *WaitStep) interpolate(tf stringTransformer) error {
-	return interpolateMap(tf, s.Contents)
+	if err := interpolateString(tf, &s.Key); err != nil {
+		return fmt.Errorf("interpolating key: %w", err)
+	}
+	if err := interpolateString(tf, &s.If); err != nil {
+		return fmt.Errorf("interpolating if: %w", err)
+	}
+	if err := interpolateMap(tf, s.RemainingFields); err != nil {
+		return fmt.Errorf("interpolating remaining fields: %w", err)
+	}
+	return nil
 }
 
 func (*WaitStep) stepTag() {}
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWaitStepMarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc string
+		step *WaitStep
+		want string
+	}{
+		{
+			desc: "empty",
+			step: &WaitStep{},
+			want: `"wait"`,
+		},
+		{
+			desc: "scalar",
+			step: &WaitStep{Scalar: "waiter"},
+			want: `"waiter"`,
+		},
+		{
+			desc: "fields",
+			step: &WaitStep{
+				Key:               "wait-for-it",
+				ContinueOnFailure: true,
+				RemainingFields:   map[string]any{"wait": nil},
+			},
+			want: `{"continue_on_failure":true,"key":"wait-for-it","wait":null}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := json.Marshal(test.step)
+			if err != nil {
+				t.Fatalf("json.Marshal(%+v) error = %v", test.step, err)
+			}
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("json.Marshal(%+v) diff (-got +want):\n%s", test.step, diff)
+			}
+		})
+	}
+}
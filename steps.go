@@ -23,6 +23,11 @@ type Steps []Step
 
 // UnmarshalOrdered unmarshals a slice ([]any) into a slice of steps.
 func (s *Steps) UnmarshalOrdered(o any) error {
+	return s.UnmarshalOrderedWith(o)
+}
+
+// UnmarshalOrderedWith is UnmarshalOrdered, with options for ordered.Unmarshal.
+func (s *Steps) UnmarshalOrderedWith(o any, opts ...ordered.UnmarshalOption) error {
 	if o == nil {
 		if *s == nil {
 			// `steps: null` is normalised to an empty slice.
@@ -41,9 +46,9 @@ func (s *Steps) UnmarshalOrdered(o any) error {
 
 	var warns []error
 	for i, st := range sl {
-		step, err := unmarshalStep(st)
+		step, err := unmarshalStep(st, opts...)
 		if w := warning.As(err); w != nil {
-			warns = append(warns, w.Wrapf("while unmarshaling step %d of %d", i+1, len(sl)))
+			warns = append(warns, w.Wrapf(stepWarningFormat, i+1, len(sl)))
 		} else if err != nil {
 			return err
 		}
@@ -57,13 +62,13 @@ func (s Steps) interpolate(tf stringTransformer) error {
 }
 
 // unmarshalStep unmarshals into the right kind of Step.
-func unmarshalStep(o any) (Step, error) {
+func unmarshalStep(o any, opts ...ordered.UnmarshalOption) (Step, error) {
 	switch o := o.(type) {
 	case string:
 		return NewScalarStep(o)
 
 	case *ordered.MapSA:
-		return stepFromMap(o)
+		return stepFromMap(o, opts...)
 
 	default:
 		return nil, fmt.Errorf("unmarshaling step: unsupported type %T", o)
@@ -71,7 +76,7 @@ func unmarshalStep(o any) (Step, error) {
 }
 
 // stepFromMap parses a step (that was originally a YAML mapping).
-func stepFromMap(o *ordered.MapSA) (Step, error) {
+func stepFromMap(o *ordered.MapSA, opts ...ordered.UnmarshalOption) (Step, error) {
 	sType, hasType := o.Get("type")
 
 	var warns []error
@@ -94,7 +99,7 @@ func stepFromMap(o *ordered.MapSA) (Step, error) {
 	}
 
 	// Decode the step (into the right step type).
-	err = ordered.Unmarshal(o, step)
+	err = ordered.Unmarshal(o, step, opts...)
 	if w := warning.As(err); w != nil {
 		warns = append(warns, w)
 	} else if err != nil {
@@ -115,10 +120,10 @@ func stepByType(sType string) (Step, error) {
 		return new(CommandStep), nil
 
 	case "wait", "waiter":
-		return &WaitStep{Contents: map[string]any{}}, nil
+		return new(WaitStep), nil
 
 	case "block", "input", "manual":
-		return &InputStep{Contents: map[string]any{}}, nil
+		return new(InputStep), nil
 
 	case "trigger":
 		return new(TriggerStep), nil
@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldInfo describes a field that the library models as a typed struct
+// field, rather than leaving it in RemainingFields.
+type FieldInfo struct {
+	// Name is the name of the field in pipeline YAML, e.g. "depends_on".
+	Name string
+
+	// Aliases are other names accepted for the field when parsing.
+	Aliases []string
+
+	// Since is the library version in which the field became a typed field, or
+	// the empty string if it was typed before SupportedFields existed.
+	Since string
+}
+
+// Step type names used by SupportedFields.
+const (
+	FieldsPipeline = "pipeline"
+	FieldsCommand  = "command"
+	FieldsGroup    = "group"
+	FieldsTrigger  = "trigger"
+	FieldsWait     = "wait"
+	FieldsInput    = "input"
+)
+
+// supportedFieldTypes maps the names used by SupportedFields to the struct
+// types whose fields are listed.
+var supportedFieldTypes = map[string]reflect.Type{
+	FieldsPipeline: reflect.TypeOf(Pipeline{}),
+	FieldsCommand:  reflect.TypeOf(CommandStep{}),
+	FieldsGroup:    reflect.TypeOf(GroupStep{}),
+	FieldsTrigger:  reflect.TypeOf(TriggerStep{}),
+	FieldsWait:     reflect.TypeOf(WaitStep{}),
+	FieldsInput:    reflect.TypeOf(InputStep{}),
+}
+
+// extraFieldAliases lists aliases that are handled by custom unmarshaling
+// rather than an aliases struct tag, keyed by "type.field".
+var extraFieldAliases = map[string][]string{
+	"command.command": {"commands"},
+}
+
+// unreleased is the Since of fields that became typed after the latest
+// release. Replace it with the version number when releasing.
+const unreleased = "unreleased"
+
+// fieldSince records when fields became typed, keyed by "type.field", with
+// the empty string for fields that were typed before SupportedFields existed.
+// Every typed field must be listed: when a typed field is added, add it here
+// with the version it will be released in (or unreleased).
+var fieldSince = map[string]string{
+	"pipeline.env":    "",
+	"pipeline.notify": unreleased,
+	"pipeline.steps":  "",
+
+	"command.agents":                   unreleased,
+	"command.allow_dependency_failure": unreleased,
+	"command.artifact_paths":           unreleased,
+	"command.cache":                    "",
+	"command.command":                  "",
+	"command.concurrency":              unreleased,
+	"command.concurrency_group":        unreleased,
+	"command.env":                      "",
+	"command.key":                      "",
+	"command.label":                    "",
+	"command.matrix":                   "",
+	"command.notify":                   unreleased,
+	"command.parallelism":              unreleased,
+	"command.plugins":                  "",
+	"command.retry":                    unreleased,
+	"command.signature":                "",
+	"command.soft_fail":                unreleased,
+	"command.timeout_in_minutes":       unreleased,
+
+	"group.allow_dependency_failure": unreleased,
+	"group.group":                    "",
+	"group.key":                      "",
+	"group.notify":                   unreleased,
+	"group.signature":                unreleased,
+	"group.steps":                    "",
+
+	"trigger.allow_dependency_failure": unreleased,
+	"trigger.async":                    unreleased,
+	"trigger.branches":                 unreleased,
+	"trigger.build":                    unreleased,
+	"trigger.key":                      unreleased,
+	"trigger.label":                    unreleased,
+	"trigger.signature":                unreleased,
+	"trigger.skip":                     unreleased,
+	"trigger.trigger":                  unreleased,
+
+	"wait.allow_dependency_failure": unreleased,
+	"wait.continue_on_failure":      unreleased,
+	"wait.if":                       unreleased,
+	"wait.key":                      unreleased,
+
+	"input.allow_dependency_failure": unreleased,
+	"input.blocked_state":            unreleased,
+	"input.fields":                   unreleased,
+	"input.if":                       unreleased,
+	"input.key":                      unreleased,
+	"input.label":                    unreleased,
+	"input.prompt":                   unreleased,
+}
+
+// SupportedFields returns the typed fields of the pipeline and of each step
+// type, keyed by FieldsPipeline, FieldsCommand, etc, and sorted by name.
+// Downstream tools can use this to check whether the library understands a
+// field (and therefore validates it) before trusting validation results.
+// Fields not listed are kept in RemainingFields, and are not validated.
+func SupportedFields() map[string][]FieldInfo {
+	out := make(map[string][]FieldInfo, len(supportedFieldTypes))
+	for name, typ := range supportedFieldTypes {
+		out[name] = typedFields(name, typ)
+	}
+	return out
+}
+
+// typedFields lists the typed fields of a struct type from its yaml and
+// aliases tags.
+func typedFields(typeName string, typ reflect.Type) []FieldInfo {
+	var fields []FieldInfo
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, ok := f.Tag.Lookup("yaml")
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(opts, "inline") {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		var aliases []string
+		if a := f.Tag.Get("aliases"); a != "" {
+			aliases = strings.Split(a, ",")
+		}
+		key := typeName + "." + name
+		aliases = append(aliases, extraFieldAliases[key]...)
+
+		fields = append(fields, FieldInfo{
+			Name:    name,
+			Aliases: aliases,
+			Since:   fieldSince[key],
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// IsSupportedField reports whether the library models the named field (or an
+// alias of it) of the given type (FieldsPipeline, FieldsCommand, etc) as a
+// typed field.
+func IsSupportedField(typeName, field string) bool {
+	typ, ok := supportedFieldTypes[typeName]
+	if !ok {
+		return false
+	}
+	for _, f := range typedFields(typeName, typ) {
+		if f.Name == field {
+			return true
+		}
+		for _, a := range f.Aliases {
+			if a == field {
+				return true
+			}
+		}
+	}
+	return false
+}
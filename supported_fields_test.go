@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSupportedFields(t *testing.T) {
+	t.Parallel()
+
+	fields := SupportedFields()
+
+	want := []FieldInfo{
+		{Name: "allow_dependency_failure", Since: unreleased},
+		{Name: "continue_on_failure", Since: unreleased},
+		{Name: "if", Since: unreleased},
+		{Name: "key", Aliases: []string{"id", "identifier"}, Since: unreleased},
+	}
+	if diff := cmp.Diff(fields[FieldsWait], want); diff != "" {
+		t.Errorf("SupportedFields()[FieldsWait] diff (-got +want):\n%s", diff)
+	}
+
+	for typeName := range supportedFieldTypes {
+		if len(fields[typeName]) == 0 {
+			t.Errorf("SupportedFields()[%q] is empty", typeName)
+		}
+	}
+}
+
+func TestIsSupportedField(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		typeName, field string
+		want            bool
+	}{
+		{FieldsCommand, "command", true},
+		{FieldsCommand, "commands", true},
+		{FieldsCommand, "name", true},
+		{FieldsCommand, "retry", true},
+		{FieldsCommand, "agents", true},
+		{FieldsCommand, "timeout_in_minutes", true},
+		{FieldsTrigger, "build", true},
+		{FieldsPipeline, "env", true},
+		{FieldsPipeline, "agents", false},
+		{"llama", "key", false},
+	}
+	for _, test := range tests {
+		if got := IsSupportedField(test.typeName, test.field); got != test.want {
+			t.Errorf("IsSupportedField(%q, %q) = %t, want %t", test.typeName, test.field, got, test.want)
+		}
+	}
+}
+
+func TestFieldSinceListsEveryTypedField(t *testing.T) {
+	t.Parallel()
+
+	typed := make(map[string]bool)
+	for typeName, fields := range SupportedFields() {
+		for _, f := range fields {
+			key := typeName + "." + f.Name
+			typed[key] = true
+			if _, ok := fieldSince[key]; !ok {
+				t.Errorf("typed field %q is missing from fieldSince", key)
+			}
+		}
+	}
+	for key := range fieldSince {
+		if !typed[key] {
+			t.Errorf("fieldSince lists %q, which isn't a typed field", key)
+		}
+	}
+
+	// The fields that were typed before SupportedFields existed are fixed;
+	// every field typed since has a version.
+	baseline := []string{
+		"command.cache",
+		"command.command",
+		"command.env",
+		"command.key",
+		"command.label",
+		"command.matrix",
+		"command.plugins",
+		"command.signature",
+		"group.group",
+		"group.key",
+		"group.steps",
+		"pipeline.env",
+		"pipeline.steps",
+	}
+	var got []string
+	for key, since := range fieldSince {
+		if since == "" {
+			got = append(got, key)
+		}
+	}
+	slices.Sort(got)
+	if diff := cmp.Diff(got, baseline); diff != "" {
+		t.Errorf("fields with an empty Since diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,287 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+)
+
+// This file contains helpers for finding fields that the library doesn't
+// understand. Many fields that Buildkite supports are not modelled as struct
+// fields, and are kept in RemainingFields - those are not reported as unknown.
+// Anything else in RemainingFields is likely a typo, or a feature that is newer
+// than this library.
+
+// Buildkite fields that are deliberately left in RemainingFields.
+var (
+	knownPipelineFields = fieldSet(
+		"agents", "cluster", "image", "priority", "queue", "secrets",
+		// Added by the signature package (see signature.ExemptionsField).
+		"signature_exemptions",
+	)
+
+	knownCommandStepFields = fieldSet(
+		"branches", "cancel_on_build_failing", "cluster", "concurrency_method",
+		"depends_on", "if", "if_changed", "image", "priority", "queue",
+		"secrets", "skip", "type",
+	)
+
+	knownGroupStepFields = fieldSet("depends_on", "if", "if_changed", "priority", "skip", "type")
+
+	knownTriggerStepFields = fieldSet("depends_on", "if", "if_changed", "soft_fail", "type")
+
+	knownTriggerBuildFields = fieldSet()
+
+	knownWaitStepFields = fieldSet("wait", "waiter", "branches", "depends_on", "type")
+
+	knownInputStepFields = fieldSet("block", "input", "manual", "branches", "depends_on", "type")
+
+	knownTextFieldFields = fieldSet()
+
+	knownSelectFieldFields = fieldSet()
+
+	knownSelectOptionFields = fieldSet()
+
+	knownMatrixFields = fieldSet()
+
+	knownMatrixAdjustmentFields = fieldSet()
+
+	knownCacheFields = fieldSet()
+
+	knownRetryFields = fieldSet()
+
+	knownAutomaticRetryRuleFields = fieldSet()
+
+	knownManualRetryFields = fieldSet()
+
+	knownSoftFailRuleFields = fieldSet()
+
+	knownNotificationFields = fieldSet("basecamp_campfire", "github_check")
+
+	knownSlackNotificationFields = fieldSet()
+
+	knownGitHubCommitStatusNotificationFields = fieldSet()
+)
+
+func fieldSet(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+// unknownKeys returns the keys of remaining that are not in known (or
+// GeneratedByField), sorted.
+func unknownKeys(remaining map[string]any, known map[string]bool) []string {
+	var out []string
+	for k := range remaining {
+		if !known[k] && k != GeneratedByField {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// withPrefix prepends prefix to each of the field paths in fields.
+func withPrefix(prefix string, fields []string) []string {
+	for i, f := range fields {
+		fields[i] = prefix + "." + f
+	}
+	return fields
+}
+
+// UnknownFields returns the paths of fields within the pipeline that the
+// library doesn't understand, such as "colour" or "steps[2].retyr". Fields of
+// a step are reported by the step's UnknownFields method, prefixed with the
+// path to the step.
+func (p *Pipeline) UnknownFields() []string {
+	out := unknownKeys(p.RemainingFields, knownPipelineFields)
+	out = append(out, p.Notify.unknownFields()...)
+	return append(out, stepsUnknownFields("steps", p.Steps)...)
+}
+
+// stepsUnknownFields collects the unknown fields of a sequence of steps.
+func stepsUnknownFields(prefix string, steps Steps) []string {
+	var out []string
+	for i, s := range steps {
+		u, ok := s.(interface{ UnknownFields() []string })
+		if !ok {
+			continue
+		}
+		for _, f := range u.UnknownFields() {
+			out = append(out, fmt.Sprintf("%s[%d].%s", prefix, i, f))
+		}
+	}
+	return out
+}
+
+// UnknownFields returns the names of fields in the step that the library
+// doesn't understand, including those within the matrix, cache, retry,
+// soft_fail, and notify settings (as paths such as
+// "matrix.adjustments[0].colour").
+func (c *CommandStep) UnknownFields() []string {
+	out := unknownKeys(c.RemainingFields, knownCommandStepFields)
+	out = append(out, withPrefix("matrix", c.Matrix.UnknownFields())...)
+	out = append(out, withPrefix("cache", c.Cache.UnknownFields())...)
+	out = append(out, withPrefix("retry", c.Retry.UnknownFields())...)
+	out = append(out, c.SoftFail.unknownFields()...)
+	return append(out, c.Notify.unknownFields()...)
+}
+
+// UnknownFields returns the paths of fields in the group step, and the steps
+// within it, that the library doesn't understand.
+func (g *GroupStep) UnknownFields() []string {
+	out := unknownKeys(g.RemainingFields, knownGroupStepFields)
+	out = append(out, g.Notify.unknownFields()...)
+	return append(out, stepsUnknownFields("steps", g.Steps)...)
+}
+
+// UnknownFields returns the names of fields in the step that the library
+// doesn't understand, including those within build (as "build.colour").
+func (t *TriggerStep) UnknownFields() []string {
+	out := unknownKeys(t.RemainingFields, knownTriggerStepFields)
+	return append(out, withPrefix("build", t.Build.UnknownFields())...)
+}
+
+// UnknownFields returns the names of fields in the step that the library
+// doesn't understand.
+func (s *WaitStep) UnknownFields() []string {
+	return unknownKeys(s.RemainingFields, knownWaitStepFields)
+}
+
+// UnknownFields returns the paths of fields in the step (including within its
+// fields, such as "fields[0].colour") that the library doesn't understand.
+func (s *InputStep) UnknownFields() []string {
+	out := unknownKeys(s.RemainingFields, knownInputStepFields)
+	for i, f := range s.Fields {
+		u, ok := f.(interface{ UnknownFields() []string })
+		if !ok {
+			continue
+		}
+		out = append(out, withPrefix(fmt.Sprintf("fields[%d]", i), u.UnknownFields())...)
+	}
+	return out
+}
+
+// UnknownFields returns the names of fields in the text field that the
+// library doesn't understand.
+func (f *TextField) UnknownFields() []string {
+	return unknownKeys(f.RemainingFields, knownTextFieldFields)
+}
+
+// UnknownFields returns the paths of fields in the select field (including
+// within its options) that the library doesn't understand.
+func (f *SelectField) UnknownFields() []string {
+	out := unknownKeys(f.RemainingFields, knownSelectFieldFields)
+	for i, o := range f.Options {
+		if o == nil {
+			continue
+		}
+		out = append(out, withPrefix(fmt.Sprintf("options[%d]", i), unknownKeys(o.RemainingFields, knownSelectOptionFields))...)
+	}
+	return out
+}
+
+// UnknownFields returns the names of fields in the build attributes that the
+// library doesn't understand.
+func (b *TriggerBuild) UnknownFields() []string {
+	if b == nil {
+		return nil
+	}
+	return unknownKeys(b.RemainingFields, knownTriggerBuildFields)
+}
+
+// UnknownFields returns the paths of fields in the matrix that the library
+// doesn't understand.
+func (m *Matrix) UnknownFields() []string {
+	if m == nil {
+		return nil
+	}
+	out := unknownKeys(m.RemainingFields, knownMatrixFields)
+	for i, adj := range m.Adjustments {
+		out = append(out, withPrefix(fmt.Sprintf("adjustments[%d]", i), adj.UnknownFields())...)
+	}
+	return out
+}
+
+// UnknownFields returns the names of fields in the adjustment (including
+// within soft_fail rules) that the library doesn't understand.
+func (ma *MatrixAdjustment) UnknownFields() []string {
+	if ma == nil {
+		return nil
+	}
+	out := unknownKeys(ma.RemainingFields, knownMatrixAdjustmentFields)
+	return append(out, ma.SoftFail.unknownFields()...)
+}
+
+// UnknownFields returns the names of fields in the cache settings that the
+// library doesn't understand.
+func (c *Cache) UnknownFields() []string {
+	if c == nil {
+		return nil
+	}
+	return unknownKeys(c.RemainingFields, knownCacheFields)
+}
+
+// UnknownFields returns the paths of fields in the retry settings (including
+// within automatic retry rules, such as "automatic[1].colour") that the
+// library doesn't understand.
+func (r *Retry) UnknownFields() []string {
+	if r == nil {
+		return nil
+	}
+	out := unknownKeys(r.RemainingFields, knownRetryFields)
+	if a := r.Automatic; a != nil {
+		for i, rule := range a.Rules {
+			if rule == nil {
+				continue
+			}
+			prefix := fmt.Sprintf("automatic[%d]", i)
+			if a.single {
+				prefix = "automatic"
+			}
+			out = append(out, withPrefix(prefix, unknownKeys(rule.RemainingFields, knownAutomaticRetryRuleFields))...)
+		}
+	}
+	if r.Manual != nil {
+		out = append(out, withPrefix("manual", unknownKeys(r.Manual.RemainingFields, knownManualRetryFields))...)
+	}
+	return out
+}
+
+// unknownFields returns the paths of fields in soft_fail rules that the
+// library doesn't understand, such as "soft_fail[1].colour".
+func (s *SoftFail) unknownFields() []string {
+	if s == nil {
+		return nil
+	}
+	var out []string
+	for i, r := range s.Rules {
+		if r == nil {
+			continue
+		}
+		out = append(out, withPrefix(fmt.Sprintf("soft_fail[%d]", i), unknownKeys(r.RemainingFields, knownSoftFailRuleFields))...)
+	}
+	return out
+}
+
+// unknownFields returns the paths of fields in notifications that the library
+// doesn't understand, such as "notify[1].slack.colour".
+func (n Notify) unknownFields() []string {
+	var out []string
+	for i, item := range n {
+		if item == nil {
+			continue
+		}
+		prefix := fmt.Sprintf("notify[%d]", i)
+		out = append(out, withPrefix(prefix, unknownKeys(item.RemainingFields, knownNotificationFields))...)
+		if s := item.Slack; s != nil {
+			out = append(out, withPrefix(prefix+".slack", unknownKeys(s.RemainingFields, knownSlackNotificationFields))...)
+		}
+		if g := item.GitHubCommitStatus; g != nil {
+			out = append(out, withPrefix(prefix+".github_commit_status", unknownKeys(g.RemainingFields, knownGitHubCommitStatusNotificationFields))...)
+		}
+	}
+	return out
+}
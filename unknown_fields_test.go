@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPipelineUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	input := `---
+agents:
+  queue: default
+colour: blue
+notify:
+  - slack:
+      channels: ["#builds"]
+      mesage: typo
+    github_check: {}
+steps:
+  - command: make
+    agents: { queue: build }
+    retyr: 3
+    matrix:
+      setup: [a, b]
+      adjustments:
+        - with: a
+          soft_fail: true
+          sofT_fail: true
+    cache:
+      paths: [node_modules]
+      sise: 10g
+    retry:
+      automatic:
+        - limit: 2
+        - limt: 3
+      manual:
+        resaon: no
+    soft_fail:
+      - exit_status: 1
+        exit_stauts: 2
+  - wait
+  - group: Tests
+    depends_on: build
+    colour: red
+    steps:
+      - command: make test
+        timeout_in_minuts: 5
+  - trigger: deploy
+    async: true
+    soft_fail: true
+    build:
+      message: hi
+      mesage: typo
+`
+	p, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse(input) error = %v", err)
+	}
+
+	want := []string{
+		"colour",
+		"notify[0].slack.mesage",
+		"steps[0].retyr",
+		"steps[0].matrix.adjustments[0].sofT_fail",
+		"steps[0].cache.sise",
+		"steps[0].retry.automatic[1].limt",
+		"steps[0].retry.manual.resaon",
+		"steps[0].soft_fail[0].exit_stauts",
+		"steps[2].colour",
+		"steps[2].steps[0].timeout_in_minuts",
+		"steps[3].build.mesage",
+	}
+	if diff := cmp.Diff(p.UnknownFields(), want); diff != "" {
+		t.Errorf("p.UnknownFields() diff (-got +want):\n%s", diff)
+	}
+}
@@ -23,9 +23,13 @@ package warning
 
 import (
 	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
 )
 
+var _ slog.LogValuer = (*Warning)(nil)
+
 // Warning is a kind of error that exists so that parsing/processing functions
 // can produce warnings that do not abort part-way, but can still be reported
 // via the error interface and logged.
@@ -34,8 +38,19 @@ import (
 type Warning struct {
 	message string
 	errs    []error
+	pos     *Position
+}
+
+// Position is a location within a source document, such as a YAML file.
+// Lines and columns are numbered from 1.
+type Position struct {
+	Line   int
+	Column int
 }
 
+// String returns the position in the form "line 42, column 5".
+func (p Position) String() string { return fmt.Sprintf("line %d, column %d", p.Line, p.Column) }
+
 // New creates a new warning that wraps one or more errors. Note that msg is *not* a format string.
 func New(msg string, errs ...error) *Warning { return &Warning{message: msg, errs: errs} }
 
@@ -95,17 +110,23 @@ func As(err error) *Warning {
 //	  ↳ w.errs[1].Error()
 //	  ↳ ...
 //
-// If the warning has no message, it is omitted. If there is no message and also
-// only one child error, that child error's Error() is returned directly.
+// If the warning has a position (see At), " at line L, column C" is appended
+// to the message. If the warning has no message, it is omitted. If there is no
+// message and also only one child error, that child error's Error() is
+// returned directly.
 // Otherwise, Error prepends indentation to sub-error messages that span
 // multiple lines to make them print nicely.
 func (w *Warning) Error() string {
-	if w.message == "" && len(w.errs) == 1 {
+	message := w.message
+	if w.pos != nil {
+		message = strings.TrimPrefix(message+" at "+w.pos.String(), " ")
+	}
+	if message == "" && len(w.errs) == 1 {
 		return w.errs[0].Error()
 	}
 	b := new(strings.Builder)
-	if w.message != "" {
-		fmt.Fprintln(b, w.message)
+	if message != "" {
+		fmt.Fprintln(b, message)
 	}
 	for _, err := range w.errs {
 		if err == nil {
@@ -122,6 +143,37 @@ func (w *Warning) Error() string {
 	return strings.TrimSuffix(b.String(), "\n")
 }
 
+// LogValue returns the warning as a group of attributes for log/slog: its
+// message and position (if it has them), and the errors it wraps, in a group
+// keyed by their index. Wrapped errors that are slog.LogValuers (such as other
+// warnings, and pipeline validation errors) are logged with their own
+// attributes, and other errors as their message.
+func (w *Warning) LogValue() slog.Value {
+	var attrs []slog.Attr
+	if w.message != "" {
+		attrs = append(attrs, slog.String("message", w.message))
+	}
+	if w.pos != nil {
+		attrs = append(attrs, slog.Int("line", w.pos.Line), slog.Int("column", w.pos.Column))
+	}
+	errs := make([]slog.Attr, 0, len(w.errs))
+	for i, err := range w.errs {
+		if err == nil {
+			continue
+		}
+		key := strconv.Itoa(i)
+		if lv, ok := err.(slog.LogValuer); ok {
+			errs = append(errs, slog.Any(key, lv))
+		} else {
+			errs = append(errs, slog.String(key, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		attrs = append(attrs, slog.Attr{Key: "errors", Value: slog.GroupValue(errs...)})
+	}
+	return slog.GroupValue(attrs...)
+}
+
 // Unwrap returns all errors directly wrapped by this warning.
 func (w *Warning) Unwrap() []error { return w.errs }
 
@@ -136,6 +188,24 @@ func (w *Warning) Wrapf(f string, x ...any) *Warning {
 	return &Warning{message: msg, errs: []error{w}}
 }
 
+// Message returns the message of the warning, which may be empty.
+func (w *Warning) Message() string { return w.message }
+
+// At sets the position in the source document that the warning relates to,
+// and returns w.
+func (w *Warning) At(pos Position) *Warning {
+	w.pos = &pos
+	return w
+}
+
+// Position returns the position set with At, if any.
+func (w *Warning) Position() (Position, bool) {
+	if w.pos == nil {
+		return Position{}, false
+	}
+	return *w.pos, true
+}
+
 // Append appends errs as child errors of this warning.
 func (w *Warning) Append(errs ...error) *Warning {
 	w.errs = append(w.errs, errs...)